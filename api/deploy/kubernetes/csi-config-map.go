@@ -29,6 +29,66 @@ type ClusterInfo struct {
 	NFS NFS `json:"nfs"`
 	// Read affinity map options
 	ReadAffinity ReadAffinity `json:"readAffinity"`
+	// Credentials contains the Ceph user credentials for the operations
+	// on the cluster
+	Credentials Credentials `json:"credentials"`
+	// OperationLimits limit the number of concurrent operations on the
+	// cluster
+	OperationLimits OperationLimits `json:"operationLimits"`
+	// SnapshotLimits limit the snapshots that are created of a volume
+	SnapshotLimits SnapshotLimits `json:"snapshotLimits"`
+	// MsMode is the mode of the messenger v2 protocol for the connections
+	// to the cluster, like "secure" to encrypt the traffic on the wire
+	MsMode string `json:"msMode"`
+}
+
+// SnapshotLimits contains the limits for the snapshots of a single volume,
+// that are enforced when a snapshot is created. There is no limit when the
+// value is 0 or empty.
+type SnapshotLimits struct {
+	// MaxSnapshots is the maximum number of snapshots of a volume
+	MaxSnapshots int `json:"maxSnapshots"`
+	// MinInterval is the minimum duration between two snapshots of a
+	// volume, like "1h" or "30m"
+	MinInterval string `json:"minInterval"`
+}
+
+// OperationLimits contains the maximum number of operations of a type that
+// run concurrently on the cluster. Operations that exceed the limit wait
+// until another one finished. There is no limit when the value is 0.
+type OperationLimits struct {
+	// Create limits the creation of volumes
+	Create int `json:"create"`
+	// Delete limits the deletion of volumes
+	Delete int `json:"delete"`
+	// Clone limits the cloning of volumes and restoring of snapshots
+	Clone int `json:"clone"`
+	// Snapshot limits the creation and deletion of snapshots
+	Snapshot int `json:"snapshot"`
+	// Flatten limits the flattening of RBD images
+	Flatten int `json:"flatten"`
+	// Resync limits the resyncing of mirrored RBD images
+	Resync int `json:"resync"`
+	// Sparsify limits the sparsifying of RBD images
+	Sparsify int `json:"sparsify"`
+	// Background limits the flatten, resync and sparsify operations
+	// together, they compete with the IO of the workloads
+	Background int `json:"background"`
+}
+
+// Credentials contains the paths of directories with the keys of a Ceph user
+// (like a mounted Kubernetes Secret with the userID and userKey). The keys
+// replace the ones in the secrets of the requests, so that each operation
+// uses a user with the capabilities it needs. The secrets of the requests
+// are used when no path is set.
+type Credentials struct {
+	// Provisioner is used by the controller for volume and snapshot
+	// operations
+	Provisioner string `json:"provisioner"`
+	// NodeStage is used by the nodeplugin to stage volumes
+	NodeStage string `json:"nodeStage"`
+	// Mirror is used for the replication operations of CSI-Addons
+	Mirror string `json:"mirror"`
 }
 
 type CephFS struct {
@@ -48,8 +108,63 @@ type RBD struct {
 	NetNamespaceFilePath string `json:"netNamespaceFilePath"`
 	// RadosNamespace is a rados namespace in the pool
 	RadosNamespace string `json:"radosNamespace"`
+	// CreateRadosNamespace creates the RadosNamespace in the pool of a
+	// volume when it does not exist yet
+	CreateRadosNamespace bool `json:"createRadosNamespace"`
+	// RadosNamespacePools contains the pools of the volumes, the access to
+	// the RadosNamespace in the pools is validated when the provisioner
+	// starts
+	RadosNamespacePools []string `json:"radosNamespacePools"`
 	// RBD mirror daemons running in the ceph cluster.
 	MirrorDaemonCount int `json:"mirrorDaemonCount"`
+	// MapOptions contains the default map options for RBD volumes, in the
+	// same format as the `mapOptions` StorageClass parameter
+	MapOptions string `json:"mapOptions"`
+	// NodeMapOptions contains map options for nodes with matching labels
+	NodeMapOptions []NodeMapOptions `json:"nodeMapOptions"`
+	// MkfsOptionsAllowList contains the mkfs options that can be set with
+	// the `mkfsOptions` StorageClass parameter, all options are allowed
+	// when the list is empty
+	MkfsOptionsAllowList []string `json:"mkfsOptionsAllowList"`
+	// NamespaceQuotas contains quotas for the volumes in a pool and RADOS
+	// namespace, that are enforced when volumes are created
+	NamespaceQuotas []NamespaceQuota `json:"namespaceQuotas"`
+	// ManagementOps contains the rbd_concurrent_management_ops that are
+	// used by the background operations on the RBD images
+	ManagementOps ManagementOps `json:"managementOps"`
+}
+
+// ManagementOps contains the number of concurrent object operations
+// (rbd_concurrent_management_ops) of the background operations on an RBD
+// image. The Ceph default is used when the value is 0.
+type ManagementOps struct {
+	// Flatten is used when an image is flattened
+	Flatten int `json:"flatten"`
+	// Sparsify is used when the zeroed blocks of an image are deallocated
+	Sparsify int `json:"sparsify"`
+}
+
+// NamespaceQuota limits the size and number of the RBD volumes in the
+// RadosNamespace of the Pool. A limit of 0 is unlimited.
+type NamespaceQuota struct {
+	// Pool is the name of the pool of the volumes
+	Pool string `json:"pool"`
+	// RadosNamespace is the rados namespace in the pool
+	RadosNamespace string `json:"radosNamespace"`
+	// MaxBytes is the maximum of the summed up size of all volumes
+	MaxBytes int64 `json:"maxBytes"`
+	// MaxVolumes is the maximum number of volumes
+	MaxVolumes int `json:"maxVolumes"`
+}
+
+// NodeMapOptions contains map options for RBD volumes that are used on the
+// nodes that have all of the NodeLabels.
+type NodeMapOptions struct {
+	// NodeLabels contains the labels that a node needs to have
+	NodeLabels map[string]string `json:"nodeLabels"`
+	// MapOptions contains the map options, in the same format as the
+	// `mapOptions` StorageClass parameter
+	MapOptions string `json:"mapOptions"`
 }
 
 type NFS struct {
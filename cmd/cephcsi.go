@@ -17,20 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/cephfs"
 	"github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/controller/mirrorpeer"
+	"github.com/ceph/ceph-csi/internal/controller/orphans"
 	"github.com/ceph/ceph-csi/internal/controller/persistentvolume"
 	"github.com/ceph/ceph-csi/internal/liveness"
 	nfsdriver "github.com/ceph/ceph-csi/internal/nfs/driver"
+	"github.com/ceph/ceph-csi/internal/rbd"
 	rbddriver "github.com/ceph/ceph-csi/internal/rbd/driver"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/parameters"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"k8s.io/klog/v2"
 )
@@ -50,6 +57,10 @@ const (
 	pollTime     = 60 // seconds
 	probeTimeout = 3  // seconds
 
+	// tracingShutdownTimeout is the time to export the remaining spans
+	// before the process exits.
+	tracingShutdownTimeout = 5 * time.Second
+
 	// use default namespace if namespace is not set.
 	defaultNS = "default"
 
@@ -57,7 +68,16 @@ const (
 	defaultStagingPath = defaultPluginPath + "/kubernetes.io/csi/"
 )
 
-var conf util.Config
+var (
+	conf util.Config
+
+	// rpcTimeouts is parsed into conf.RPCTimeouts
+	rpcTimeouts string
+
+	// cleanupRadosNamespace is the <clusterID>/<pool>/<namespace> to remove
+	// instead of starting the rbd driver
+	cleanupRadosNamespace string
+)
 
 func init() {
 	// common flags
@@ -82,6 +102,8 @@ func init() {
 		"list of Kubernetes node labels, that determines the topology"+
 			" domain the node belongs to, separated by ','")
 	flag.BoolVar(&conf.EnableReadAffinity, "enable-read-affinity", false, "enable read affinity")
+	flag.BoolVar(&conf.ReservationLock, "reservationlock", false,
+		"serialize the journal reservations of CreateVolume and CreateSnapshot with RADOS locks across provisioners")
 	flag.StringVar(
 		&conf.CrushLocationLabels,
 		"crush-location-labels",
@@ -100,6 +122,12 @@ func init() {
 		"kernelmountoptions",
 		"",
 		"Comma separated string of mount options accepted by cephfs kernel mounter")
+	flag.BoolVar(&conf.KernelMountRecovery, "kernel-mount-recovery", false,
+		"remount stale cephfs kernel mounts of evicted clients on NodeStageVolume, with recover_session=clean")
+	flag.BoolVar(&conf.VolumeMountGroup, "volume-mount-group", false,
+		"apply the fsGroup of pods to cephfs volumes in the node plugin, instead of a recursive change by kubelet")
+	flag.BoolVar(&conf.AsyncDelete, "async-delete", false,
+		"remove cephfs subvolumes in the background, DeleteVolume returns once the deletion is recorded")
 	flag.StringVar(
 		&conf.RadosNamespaceCephFS,
 		"radosnamespacecephfs",
@@ -125,6 +153,75 @@ func init() {
 		"logslowopinterval",
 		time.Second*30,
 		"how often to inform about slow gRPC calls")
+	flag.DurationVar(
+		&conf.DrainTimeout,
+		"draintimeout",
+		time.Second*25,
+		"time to wait for in-flight node requests to finish when the driver is stopped")
+	flag.DurationVar(
+		&conf.LockBreakDeadline,
+		"lockbreakdeadline",
+		0,
+		"time after which a lock of an operation can be released through the metrics server (disabled when 0)")
+	flag.StringVar(
+		&conf.LockBreakTokenFile,
+		"lockbreaktokenfile",
+		"",
+		"file with the bearer token that is required to release a lock through the metrics server")
+	flag.IntVar(
+		&conf.MaxNodeRPCs,
+		"maxnoderpcs",
+		0,
+		"maximum number of concurrent node RPCs, further RPCs wait for a slot (unlimited when 0)")
+	flag.IntVar(
+		&conf.MaxControllerRPCs,
+		"maxcontrollerrpcs",
+		0,
+		"maximum number of concurrent controller RPCs, further RPCs wait for a slot (unlimited when 0)")
+	flag.Int64Var(
+		&conf.MaxVolumesPerNode,
+		"maxvolumespernode",
+		0,
+		"maximum number of volumes that can be published on a node (unlimited when 0, "+
+			"computed from the devices and the memory of the node for rbd when -1)")
+	flag.Float64Var(
+		&conf.MapRate,
+		"maprate",
+		0,
+		"maximum number of RBD images that are mapped per second on a node, further maps wait for their turn "+
+			"(unlimited when 0)")
+	flag.StringVar(
+		&rpcTimeouts,
+		"rpctimeouts",
+		"",
+		"comma separated timeouts for RPCs by method name, like NodeStageVolume=5m,CreateVolume=10m")
+	flag.StringVar(
+		&conf.LogFormat,
+		"logformat",
+		log.TextFormat,
+		"format of the log messages, text or json (json includes the request IDs and gRPC method as fields)")
+	flag.StringVar(
+		&conf.TracingEndpoint,
+		"tracingendpoint",
+		"",
+		"URL of the OTLP gRPC endpoint to export traces to, like http://otel-collector:4317 (disabled when empty)")
+	flag.DurationVar(
+		&conf.GCInterval,
+		"gc-interval",
+		0,
+		"interval of the controller to search for volumes without PersistentVolume (disabled when 0)")
+	flag.DurationVar(
+		&conf.GCGracePeriod,
+		"gc-grace-period",
+		time.Hour,
+		"time a volume needs to be without PersistentVolume before it is reported or deleted")
+	flag.BoolVar(&conf.GCDelete, "gc-delete", false,
+		"delete the volumes without PersistentVolume instead of only reporting them")
+	flag.DurationVar(
+		&conf.CloneTTL,
+		"gc-clone-ttl",
+		24*time.Hour,
+		"time after which a CephFS clone that is not checked by CreateVolume anymore is deleted (disabled when 0)")
 
 	flag.UintVar(
 		&conf.RbdHardMaxCloneDepth,
@@ -148,9 +245,18 @@ func init() {
 		"Minimum number of snapshots required on rbd image to start flattening")
 	flag.BoolVar(&conf.SkipForceFlatten, "skipforceflatten", false,
 		"skip image flattening if kernel support mapping of rbd images which has the deep-flatten feature")
+	flag.BoolVar(&conf.ForceLockBreak, "force-lock-break", false,
+		"break stale exclusive locks of rbd images, held by clients without a watch on the image")
+	flag.BoolVar(&conf.VolumeEvents, "volume-events", false,
+		"post Kubernetes Events on the PVs and PVCs of rbd volumes when images are mapped, unlocked or flattened")
+	flag.BoolVar(&conf.SnapshotMetadata, "enable-snapshot-metadata", false,
+		"serve the CSI SnapshotMetadata service with the allocated and changed blocks of rbd snapshots")
+	flag.StringVar(&cleanupRadosNamespace, "cleanupradosnamespace", "",
+		"remove an empty rados namespace and its journal objects, as <clusterID>/<pool>/<namespace>, and exit")
 
 	flag.BoolVar(&conf.Version, "version", false, "Print cephcsi version information")
 	flag.BoolVar(&conf.EnableProfiling, "enableprofiling", false, "enable go profiling")
+	flag.BoolVar(&conf.EnableMetrics, "enablemetrics", false, "serve the metrics of the operations on the metricsport")
 
 	// CSI-Addons configuration
 	flag.StringVar(&conf.CSIAddonsEndpoint, "csi-addons-endpoint", "unix:///tmp/csi-addons.sock", "CSI-Addons endpoint")
@@ -194,25 +300,59 @@ func printVersion() {
 }
 
 func main() {
+	switch flag.Arg(0) {
+	case inspectVolumeIDCmd:
+		os.Exit(runInspectVolumeID(flag.Args()[1:]))
+	case staticPVCCmd:
+		os.Exit(runStaticPVC(flag.Args()[1:]))
+	case trashRestoreCmd:
+		os.Exit(runTrashRestore(flag.Args()[1:]))
+	case paramsCmd:
+		os.Exit(runParams(flag.Args()[1:]))
+	}
+
 	if conf.Version {
 		printVersion()
 		os.Exit(0)
 	}
+	if err := log.SetFormat(conf.LogFormat); err != nil {
+		logAndExit(err.Error())
+	}
 	log.DefaultLog("Driver version: %s and Git version: %s", util.DriverVersion, util.GitCommit)
 
 	if conf.Vtype == "" {
 		logAndExit("driver type not specified")
 	}
 
+	if err := parameters.Check(); err != nil {
+		logAndExit(err.Error())
+	}
+
 	dname := getDriverName()
 	err := util.ValidateDriverName(dname)
 	if err != nil {
 		logAndExit(err.Error())
 	}
 
+	if conf.TracingEndpoint != "" {
+		err = tracing.Setup(context.Background(), conf.TracingEndpoint, dname, util.DriverVersion)
+		if err != nil {
+			logAndExit(err.Error())
+		}
+	}
+
+	conf.RPCTimeouts, err = util.ParseRPCTimeouts(rpcTimeouts)
+	if err != nil {
+		logAndExit(err.Error())
+	}
+
+	if conf.LockBreakDeadline > 0 && conf.LockBreakTokenFile == "" {
+		logAndExit("--lockbreakdeadline requires --lockbreaktokenfile")
+	}
+
 	setPIDLimit(&conf)
 
-	if conf.EnableProfiling || conf.Vtype == livenessType {
+	if conf.EnableProfiling || conf.EnableMetrics || conf.Vtype == livenessType {
 		// validate metrics endpoint
 		conf.MetricsIP = os.Getenv("POD_IP")
 
@@ -233,6 +373,12 @@ func main() {
 	log.DefaultLog("Starting driver type: %v with name: %v", conf.Vtype, dname)
 	switch conf.Vtype {
 	case rbdType:
+		if cleanupRadosNamespace != "" {
+			runRadosNamespaceCleanup(cleanupRadosNamespace)
+
+			break
+		}
+
 		validateCloneDepthFlag(&conf)
 		validateMaxSnapshotFlag(&conf)
 		driver := rbddriver.NewDriver()
@@ -256,6 +402,14 @@ func main() {
 			ClusterName: conf.ClusterName,
 			InstanceID:  conf.InstanceID,
 			SetMetadata: conf.SetMetadata,
+
+			GCInterval:    conf.GCInterval,
+			GCGracePeriod: conf.GCGracePeriod,
+			GCDelete:      conf.GCDelete,
+			CloneTTL:      conf.CloneTTL,
+		}
+		if conf.EnableMetrics {
+			go util.StartMetricsServer(&conf)
 		}
 		// initialize all controllers before starting.
 		initControllers()
@@ -265,9 +419,21 @@ func main() {
 		}
 	}
 
+	shutdownTracing()
 	os.Exit(0)
 }
 
+// shutdownTracing exports the remaining spans before the process exits.
+func shutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+
+	err := tracing.Shutdown(ctx)
+	if err != nil {
+		log.ErrorLogMsg("%v", err)
+	}
+}
+
 func setPIDLimit(conf *util.Config) {
 	// set pidLimit only for NodeServer
 	// the driver may need a higher PID limit for handling all concurrent requests
@@ -294,6 +460,22 @@ func setPIDLimit(conf *util.Config) {
 func initControllers() {
 	// Add list of controller here.
 	persistentvolume.Init()
+	orphans.Init()
+	mirrorpeer.Init()
+}
+
+// runRadosNamespaceCleanup removes the RADOS namespace of the
+// <clusterID>/<pool>/<namespace> spec.
+func runRadosNamespaceCleanup(spec string) {
+	parts := strings.SplitN(spec, "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		logAndExit(fmt.Sprintf("cleanupradosnamespace %q is not in the <clusterID>/<pool>/<namespace> format", spec))
+	}
+
+	err := rbd.CleanupRadosNamespace(context.Background(), parts[0], parts[1], parts[2])
+	if err != nil {
+		logAndExit(err.Error())
+	}
 }
 
 func validateCloneDepthFlag(conf *util.Config) {
@@ -323,5 +505,6 @@ func validateMaxSnapshotFlag(conf *util.Config) {
 
 func logAndExit(msg string) {
 	klog.Errorln(msg)
+	shutdownTracing()
 	os.Exit(1)
 }
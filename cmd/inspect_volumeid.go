@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/volumeid"
+)
+
+// inspectVolumeIDCmd is the subcommand that decodes and encodes volume
+// handles.
+const inspectVolumeIDCmd = "inspect-volumeid"
+
+// inspectedVolumeID is the output of the inspect-volumeid subcommand.
+type inspectedVolumeID struct {
+	VolumeID       string `json:"volumeID"`
+	Version        uint16 `json:"version"`
+	ClusterID      string `json:"clusterID"`
+	LocationID     int64  `json:"locationID"`
+	RadosNamespace string `json:"radosNamespace,omitempty"`
+	ObjectUUID     string `json:"objectUUID"`
+}
+
+// runInspectVolumeID decodes the volume handle in the arguments, or encodes
+// one with --encode, prints the fields as JSON and returns the exit code.
+func runInspectVolumeID(args []string) int {
+	fs := flag.NewFlagSet(inspectVolumeIDCmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cephcsi %s [options] <volume handle>\n"+
+			"       cephcsi %s --encode --clusterid <id> --locationid <id> --uuid <uuid>\n",
+			inspectVolumeIDCmd, inspectVolumeIDCmd)
+		fs.PrintDefaults()
+	}
+	encode := fs.Bool("encode", false, "encode a volume handle instead of decoding one")
+	clusterID := fs.String("clusterid", "", "clusterID to encode")
+	locationID := fs.Int64("locationid", 0, "ID of the pool (rbd) or filesystem (cephfs) to encode")
+	uuid := fs.String("uuid", "", "UUID of the object in the journal to encode")
+	volType := fs.String("type", "", "look up the RADOS namespace of the [rbd|cephfs] volume in the CSI configuration")
+	configFile := fs.String("config", util.CsiConfigFile, "path of the CSI configuration")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var (
+		h   volumeid.Handle
+		err error
+		out inspectedVolumeID
+	)
+	if *encode {
+		if fs.NArg() != 0 {
+			fs.Usage()
+
+			return 2
+		}
+		h = volumeid.Handle{
+			Version:    volumeid.DefaultVersion,
+			ClusterID:  *clusterID,
+			LocationID: *locationID,
+			ObjectUUID: *uuid,
+		}
+		out.VolumeID, err = h.Encode()
+	} else {
+		if fs.NArg() != 1 {
+			fs.Usage()
+
+			return 2
+		}
+		out.VolumeID = fs.Arg(0)
+		h, err = volumeid.Decode(out.VolumeID)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	out.Version = h.Version
+	out.ClusterID = h.ClusterID
+	out.LocationID = h.LocationID
+	out.ObjectUUID = h.ObjectUUID
+
+	switch *volType {
+	case "":
+	case rbdType:
+		out.RadosNamespace, err = util.GetRBDRadosNamespace(*configFile, h.ClusterID)
+	case cephFSType:
+		out.RadosNamespace, err = util.GetCephFSRadosNamespace(*configFile, h.ClusterID)
+	default:
+		err = fmt.Errorf("unsupported type %q, supported are %q and %q", *volType, rbdType, cephFSType)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
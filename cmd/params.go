@@ -0,0 +1,110 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ceph/ceph-csi/internal/util/parameters"
+)
+
+// paramsCmd is the subcommand that prints the schemas of the parameters of
+// the drivers.
+const paramsCmd = "params"
+
+// runParams prints the schemas of the parameters as a table, or as JSON with
+// --json, and returns the exit code.
+func runParams(args []string) int {
+	fs := flag.NewFlagSet(paramsCmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cephcsi %s [options]\n", paramsCmd)
+		fs.PrintDefaults()
+	}
+	asJSON := fs.Bool("json", false, "print the schemas as JSON")
+	driver := fs.String("type", "", "only print the parameters of the [rbd|cephfs|nfs] driver")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+
+		return 2
+	}
+
+	schemas := []parameters.Schema{}
+	for _, s := range parameters.Schemas() {
+		if *driver == "" || s.Driver == *driver {
+			schemas = append(schemas, s)
+		}
+	}
+	if len(schemas) == 0 {
+		fmt.Fprintf(os.Stderr, "unsupported type %q, supported are %q, %q and %q\n",
+			*driver, parameters.RBD, parameters.CephFS, parameters.NFS)
+
+		return 1
+	}
+
+	var err error
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(schemas)
+	} else {
+		err = printParams(schemas)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return 0
+}
+
+// printParams prints a table with the parameters of the schemas.
+func printParams(schemas []parameters.Schema) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DRIVER\tPARAMETER\tTYPE\tSCOPES\tREQUIRED\tDEFAULT\tDESCRIPTION")
+	for _, s := range schemas {
+		for _, p := range s.Parameters {
+			scopes := make([]string, 0, len(p.Scopes))
+			for _, scope := range p.Scopes {
+				scopes = append(scopes, string(scope))
+			}
+
+			typ := string(p.Type)
+			if len(p.Values) != 0 {
+				typ += "(" + strings.Join(p.Values, "|") + ")"
+			}
+
+			description := p.Description
+			if p.Deprecated != "" {
+				description = "DEPRECATED: " + p.Deprecated
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\t%s\n",
+				s.Driver, p.Name, typ, strings.Join(scopes, ","), p.Required, p.Default, description)
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,308 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/cephfs"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// staticPVCCmd is the subcommand that validates an existing image or
+// subvolume and prints a PersistentVolume for it.
+const staticPVCCmd = "static-pvc"
+
+// staticPVOptions are the flags of the static-pvc subcommand.
+type staticPVOptions struct {
+	volType         string
+	clusterID       string
+	userID          string
+	keyFile         string
+	name            string
+	size            string
+	driverName      string
+	secretName      string
+	secretNamespace string
+
+	// rbd
+	pool       string
+	image      string
+	fsType     string
+	volumeMode string
+
+	// cephfs
+	fsName         string
+	subvolume      string
+	subvolumeGroup string
+}
+
+// runStaticPVC checks the image or subvolume in the arguments and prints a
+// PersistentVolume manifest for it, it returns the exit code.
+func runStaticPVC(args []string) int {
+	var opts staticPVOptions
+	fs := flag.NewFlagSet(staticPVCCmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cephcsi %s --type rbd --clusterid <id> --pool <pool> --image <image> [options]\n"+
+			"       cephcsi %s --type cephfs --clusterid <id> --fsname <fs> --subvolume <subvolume> [options]\n",
+			staticPVCCmd, staticPVCCmd)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.volType, "type", "", "type of the volume [rbd|cephfs]")
+	opts.addCommonFlags(fs)
+	opts.addRBDFlags(fs)
+	fs.StringVar(&opts.fsName, "fsname", "", "name of the CephFS filesystem")
+	fs.StringVar(&opts.subvolume, "subvolume", "", "name of the CephFS subvolume")
+	fs.StringVar(&opts.subvolumeGroup, "subvolumegroup", "",
+		"subvolumegroup of the subvolume (default from the CSI configuration)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+
+		return 2
+	}
+
+	cr, err := opts.credentials()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+	defer cr.DeleteCredentials()
+
+	pv, err := staticPV(context.Background(), &opts, cr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return printPV(pv)
+}
+
+// addCommonFlags adds the flags of the Ceph user and the PersistentVolume
+// to the flag set.
+func (opts *staticPVOptions) addCommonFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.clusterID, "clusterid", "", "clusterID of the cluster in the CSI configuration")
+	fs.StringVar(&opts.userID, "userid", "", "Ceph user to inspect the image or subvolume with")
+	fs.StringVar(&opts.keyFile, "keyfile", "", "file with the key of the Ceph user")
+	fs.StringVar(&opts.name, "name", "", "name of the PersistentVolume (default the image or subvolume name)")
+	fs.StringVar(&opts.size, "size", "", "capacity of the PersistentVolume (default the size of the image or quota)")
+	fs.StringVar(&opts.driverName, "drivername", "", "name of the driver (default by type)")
+	fs.StringVar(&opts.secretName, "secretname", "", "name of the node-stage secret")
+	fs.StringVar(&opts.secretNamespace, "secretnamespace", defaultNS, "namespace of the node-stage secret")
+}
+
+// addRBDFlags adds the flags of the rbd image to the flag set.
+func (opts *staticPVOptions) addRBDFlags(fs *flag.FlagSet) {
+	fs.StringVar(&opts.pool, "pool", "", "pool of the rbd image")
+	fs.StringVar(&opts.image, "image", "", "name of the rbd image")
+	fs.StringVar(&opts.fsType, "fstype", "ext4", "filesystem on the rbd image")
+	fs.StringVar(&opts.volumeMode, "volumemode", string(v1.PersistentVolumeFilesystem),
+		"volumeMode of the rbd PersistentVolume [Filesystem|Block]")
+}
+
+// credentials returns the credentials of the Ceph user in the options, and
+// writes the Ceph configuration file to connect with them.
+func (opts *staticPVOptions) credentials() (*util.Credentials, error) {
+	if opts.clusterID == "" || opts.userID == "" || opts.keyFile == "" {
+		return nil, errors.New("--clusterid, --userid and --keyfile are required")
+	}
+
+	key, err := os.ReadFile(opts.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the key of the Ceph user: %w", err)
+	}
+	cr, err := util.NewUserCredentials(map[string]string{
+		"userID":  opts.userID,
+		"userKey": strings.TrimSpace(string(key)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = util.WriteCephConfig(); err != nil {
+		cr.DeleteCredentials()
+
+		return nil, fmt.Errorf("failed to write ceph configuration file: %w", err)
+	}
+
+	return cr, nil
+}
+
+// printPV prints the PersistentVolume as YAML, it returns the exit code.
+func printPV(pv *v1.PersistentVolume) int {
+	out, err := yaml.Marshal(pv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+	fmt.Print(string(out))
+
+	return 0
+}
+
+// staticPV validates the image or subvolume and returns a PersistentVolume
+// for it.
+func staticPV(ctx context.Context, opts *staticPVOptions, cr *util.Credentials) (*v1.PersistentVolume, error) {
+	var (
+		pv  *v1.PersistentVolume
+		err error
+	)
+	switch opts.volType {
+	case rbdType:
+		pv, err = staticRBDPV(ctx, opts, cr)
+	case cephFSType:
+		pv, err = staticCephFSPV(ctx, opts, cr)
+	default:
+		err = fmt.Errorf("unsupported type %q, supported are %q and %q", opts.volType, rbdType, cephFSType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.size != "" {
+		size, err := resource.ParseQuantity(opts.size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %q: %w", opts.size, err)
+		}
+		pv.Spec.Capacity[v1.ResourceStorage] = size
+	}
+	if pv.Spec.Capacity.Storage().IsZero() {
+		return nil, errors.New("the size of the volume is not known, pass --size")
+	}
+
+	return pv, nil
+}
+
+// newStaticPV returns a PersistentVolume with the settings that are common
+// for static rbd and cephfs volumes.
+func newStaticPV(opts *staticPVOptions, name, defaultDriverName string, size int64) *v1.PersistentVolume {
+	if opts.name != "" {
+		name = opts.name
+	}
+	driverName := opts.driverName
+	if driverName == "" {
+		driverName = defaultDriverName
+	}
+	pv := &v1.PersistentVolume{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "PersistentVolume",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: v1.PersistentVolumeSpec{
+			Capacity: v1.ResourceList{
+				v1.ResourceStorage: *resource.NewQuantity(size, resource.BinarySI),
+			},
+			// ceph-csi does not delete static volumes
+			PersistentVolumeReclaimPolicy: v1.PersistentVolumeReclaimRetain,
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				CSI: &v1.CSIPersistentVolumeSource{
+					Driver:       driverName,
+					VolumeHandle: name,
+					VolumeAttributes: map[string]string{
+						"clusterID":    opts.clusterID,
+						"staticVolume": "true",
+					},
+				},
+			},
+		},
+	}
+	if opts.secretName != "" {
+		pv.Spec.CSI.NodeStageSecretRef = &v1.SecretReference{
+			Name:      opts.secretName,
+			Namespace: opts.secretNamespace,
+		}
+	}
+
+	return pv
+}
+
+// staticRBDPV returns a PersistentVolume for the rbd image, the volume handle
+// of static rbd volumes is the name of the image.
+func staticRBDPV(ctx context.Context, opts *staticPVOptions, cr *util.Credentials) (*v1.PersistentVolume, error) {
+	if opts.pool == "" || opts.image == "" {
+		return nil, errors.New("--pool and --image are required for rbd")
+	}
+
+	volumeMode := v1.PersistentVolumeMode(opts.volumeMode)
+	if volumeMode != v1.PersistentVolumeFilesystem && volumeMode != v1.PersistentVolumeBlock {
+		return nil, fmt.Errorf("invalid volumemode %q", opts.volumeMode)
+	}
+
+	img, err := rbd.InspectStaticImage(ctx, cr, opts.clusterID, opts.pool, opts.image)
+	if err != nil {
+		return nil, err
+	}
+
+	pv := newStaticPV(opts, opts.image, rbdDefaultName, img.Size)
+	pv.Spec.CSI.VolumeHandle = opts.image
+	pv.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteOnce}
+	pv.Spec.VolumeMode = &volumeMode
+	if volumeMode == v1.PersistentVolumeFilesystem {
+		pv.Spec.CSI.FSType = opts.fsType
+	}
+	pv.Spec.CSI.VolumeAttributes["pool"] = opts.pool
+	pv.Spec.CSI.VolumeAttributes["imageFeatures"] = img.ImageFeatures
+	if img.NeedsRbdNbd {
+		pv.Spec.CSI.VolumeAttributes["mounter"] = "rbd-nbd"
+		fmt.Fprintf(os.Stderr, "image %q has features that krbd does not support, it is mapped with rbd-nbd\n",
+			opts.image)
+	}
+
+	return pv, nil
+}
+
+// staticCephFSPV returns a PersistentVolume for the subvolume, the volume
+// handle of static cephfs volumes only needs to be unique.
+func staticCephFSPV(ctx context.Context, opts *staticPVOptions, cr *util.Credentials) (*v1.PersistentVolume, error) {
+	if opts.fsName == "" || opts.subvolume == "" {
+		return nil, errors.New("--fsname and --subvolume are required for cephfs")
+	}
+
+	subvol, err := cephfs.InspectStaticSubvolume(ctx, cr, opts.clusterID, opts.fsName,
+		opts.subvolumeGroup, opts.subvolume)
+	if err != nil {
+		return nil, err
+	}
+
+	pv := newStaticPV(opts, opts.subvolume, cephFSDefaultName, subvol.Size)
+	volumeMode := v1.PersistentVolumeFilesystem
+	pv.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}
+	pv.Spec.VolumeMode = &volumeMode
+	pv.Spec.CSI.VolumeAttributes["fsName"] = opts.fsName
+	pv.Spec.CSI.VolumeAttributes["rootPath"] = subvol.RootPath
+
+	return pv, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ceph/ceph-csi/internal/rbd"
+)
+
+// trashRestoreCmd is the subcommand that restores the image of a deleted
+// volume from the trash and prints a PersistentVolume for it.
+const trashRestoreCmd = "trash-restore"
+
+// runTrashRestore restores the rbd image in the arguments from the trash and
+// prints a static PersistentVolume manifest for it, it returns the exit code.
+func runTrashRestore(args []string) int {
+	opts := staticPVOptions{volType: rbdType}
+	fs := flag.NewFlagSet(trashRestoreCmd, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cephcsi %s --clusterid <id> --pool <pool> --image <image> [options]\n",
+			trashRestoreCmd)
+		fs.PrintDefaults()
+	}
+	opts.addCommonFlags(fs)
+	opts.addRBDFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+
+		return 2
+	}
+
+	if opts.pool == "" || opts.image == "" {
+		fmt.Fprintln(os.Stderr, "--pool and --image are required")
+
+		return 2
+	}
+
+	cr, err := opts.credentials()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+	defer cr.DeleteCredentials()
+
+	ctx := context.Background()
+	err = rbd.RestoreTrashedImage(ctx, cr, opts.clusterID, opts.pool, opts.image)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "restored image %s/%s from trash\n", opts.pool, opts.image)
+
+	pv, err := staticPV(ctx, &opts, cr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+
+		return 1
+	}
+
+	return printPV(pv)
+}
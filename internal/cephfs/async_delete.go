@@ -0,0 +1,281 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// asyncDeleteRetryInterval is the time to wait before the removal of a
+	// deleted volume is retried, it doubles on every failure up to
+	// asyncDeleteMaxRetryInterval.
+	asyncDeleteRetryInterval    = 10 * time.Second
+	asyncDeleteMaxRetryInterval = 10 * time.Minute
+	// asyncDeleteMaxAttempts is the number of attempts to remove a deleted
+	// volume, the removal is resumed when the provisioner restarts.
+	asyncDeleteMaxAttempts = 10
+
+	// snapshotRetentionFeature is the feature of subvolumes that can be
+	// removed while they have snapshots.
+	snapshotRetentionFeature = "snapshot-retention"
+)
+
+// canDeleteAsync returns true when the volume can be removed in the
+// background. Subvolumes without snapshot retention fail to be removed when
+// they have snapshots, the error needs to be returned to the caller.
+// Snapshot-backed volumes do not have a subvolume.
+func canDeleteAsync(volOptions *store.VolumeOptions) bool {
+	return !volOptions.BackingSnapshot && slices.Contains(volOptions.Features, snapshotRetentionFeature)
+}
+
+// hasAsyncDeleteCredentials returns true when the CSI configuration contains
+// the provisioner credentials of the cluster. The removal in the background
+// reads the credentials for every attempt, the credentials of the request are
+// not kept.
+func hasAsyncDeleteCredentials(clusterID string) bool {
+	_, err := configuredProvisionerSecrets(clusterID)
+
+	return err == nil
+}
+
+// deleteVolumeAsync records the deletion of the volume in the journal and
+// removes it in the background.
+func (cs *ControllerServer) deleteVolumeAsync(
+	ctx context.Context,
+	volOptions *store.VolumeOptions,
+	vID *store.VolumeIdentifier,
+	secrets map[string]string,
+) error {
+	err := store.MarkVolumeDeleting(ctx, volOptions, *vID, secrets)
+	if err != nil {
+		return fmt.Errorf("failed to mark volume %s for deletion: %w", vID.VolumeID, err)
+	}
+
+	cs.startVolumeRemoval(vID.VolumeID)
+
+	return nil
+}
+
+// startVolumeRemoval starts the removal of the volume in the background,
+// unless it is running already.
+func (cs *ControllerServer) startVolumeRemoval(volumeID string) {
+	if _, running := cs.pendingRemovals.LoadOrStore(volumeID, struct{}{}); running {
+		return
+	}
+
+	go cs.runVolumeRemoval(volumeID)
+}
+
+// asyncDeleteRetryDelay returns the time to wait after the failed attempt
+// (starting at 1) to remove a deleted volume.
+func asyncDeleteRetryDelay(attempt int) time.Duration {
+	delay := asyncDeleteRetryInterval
+	for range attempt - 1 {
+		delay *= 2
+		if delay >= asyncDeleteMaxRetryInterval {
+			return asyncDeleteMaxRetryInterval
+		}
+	}
+
+	return delay
+}
+
+// runVolumeRemoval removes the volume, failures are retried with an
+// increasing delay for asyncDeleteMaxAttempts attempts. The volume stays
+// marked as deleting in the journal when all attempts failed.
+func (cs *ControllerServer) runVolumeRemoval(volumeID string) {
+	defer cs.pendingRemovals.Delete(volumeID)
+
+	ctx := context.Background()
+	for attempt := 1; ; attempt++ {
+		err := cs.removeVolumeWithConfiguredSecrets(ctx, volumeID)
+		if err == nil {
+			log.DebugLog(ctx, "cephfs: removed deleted volume %s", volumeID)
+
+			return
+		}
+
+		if attempt == asyncDeleteMaxAttempts {
+			log.ErrorLog(ctx, "failed to remove deleted volume %s after %d attempts, "+
+				"the removal is resumed when the provisioner restarts: %v", volumeID, attempt, err)
+
+			return
+		}
+
+		delay := asyncDeleteRetryDelay(attempt)
+		log.ErrorLog(ctx, "failed to remove deleted volume %s, retrying in %s: %v", volumeID, delay, err)
+		time.Sleep(delay)
+	}
+}
+
+// removeVolumeWithConfiguredSecrets removes the volume with the provisioner
+// credentials of the CSI configuration. The credentials are only kept for the
+// attempt.
+func (cs *ControllerServer) removeVolumeWithConfiguredSecrets(ctx context.Context, volumeID string) error {
+	secrets, err := configuredProvisionerSecrets(util.GetClusterIDFromVolumeID(volumeID))
+	if err != nil {
+		return err
+	}
+	defer clear(secrets)
+
+	return cs.removeVolume(ctx, volumeID, secrets)
+}
+
+// removeVolume removes the subvolume and the journal reservation of the
+// volume. The reservation is only removed once the subvolume is gone, or
+// only retains its snapshots. Volumes that are removed already are not an
+// error.
+func (cs *ControllerServer) removeVolume(ctx context.Context, volumeID string, secrets map[string]string) error {
+	volOptions, vID, err := store.NewVolumeOptionsFromVolID(ctx, volumeID, nil, secrets,
+		cs.ClusterName, cs.SetMetadata)
+	switch {
+	case errors.Is(err, util.ErrPoolNotFound), errors.Is(err, util.ErrKeyNotFound):
+		log.DebugLog(ctx, "volume %s is removed already: %v", volumeID, err)
+
+		return nil
+	case errors.Is(err, cerrors.ErrVolumeNotFound):
+		// the subvolume is gone, the reservation needs to be removed
+		return store.UndoVolReservation(ctx, volOptions, *vID, secrets)
+	case err != nil:
+		return err
+	}
+	defer volOptions.Destroy()
+
+	// subvolumes that retain snapshots have no path, they were removed on
+	// a previous attempt
+	if volOptions.BackingSnapshot || volOptions.RootPath != "" {
+		cr, err := util.NewAdminCredentials(secrets)
+		if err != nil {
+			return err
+		}
+		defer cr.DeleteCredentials()
+
+		if err = cs.cleanUpBackingVolume(ctx, volOptions, vID, cr, secrets); err != nil {
+			return err
+		}
+
+		if err = cs.confirmVolumeRemoved(ctx, volOptions); err != nil {
+			return err
+		}
+	}
+
+	return store.UndoVolReservation(ctx, volOptions, *vID, secrets)
+}
+
+// confirmVolumeRemoved checks that the subvolume does not exist anymore, or
+// only retains its snapshots.
+func (cs *ControllerServer) confirmVolumeRemoved(ctx context.Context, volOptions *store.VolumeOptions) error {
+	if volOptions.BackingSnapshot {
+		return nil
+	}
+
+	volClient := core.NewSubVolume(volOptions.GetConnection(),
+		&volOptions.SubVolume, volOptions.ClusterID, cs.ClusterName, cs.SetMetadata)
+	info, err := volClient.GetSubVolumeInfo(ctx)
+	if errors.Is(err, cerrors.ErrVolumeNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Path != "" {
+		return fmt.Errorf("subvolume %s still exists after it was removed", volOptions.VolID)
+	}
+
+	return nil
+}
+
+// ResumeVolumeRemovals restarts the removal of the volumes that were deleted
+// asynchronously before the provisioner restarted. The journals of the
+// filesystems of the clusters with provisioner credentials in the CSI
+// configuration are searched, failures are logged.
+func (cs *ControllerServer) ResumeVolumeRemovals(ctx context.Context) {
+	clusterIDs, err := util.ConfiguredClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to list the clusters in the CSI configuration: %v", err)
+
+		return
+	}
+
+	for _, clusterID := range clusterIDs {
+		secrets, err := configuredProvisionerSecrets(clusterID)
+		if err != nil {
+			log.DebugLog(ctx, "not resuming removals of deleted volumes in cluster %q: %v", clusterID, err)
+
+			continue
+		}
+
+		fsNames, err := listFsNames(ctx, clusterID, secrets)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to list the filesystems of cluster %q: %v", clusterID, err)
+
+			continue
+		}
+
+		for _, fsName := range fsNames {
+			volumes, err := listReservedVolumes(ctx, clusterID, fsName, secrets, store.DeletingAttribute)
+			if err != nil {
+				log.ErrorLog(ctx, "failed to list the volumes of fs %q in cluster %q: %v", fsName, clusterID, err)
+
+				continue
+			}
+
+			for volumeID, deleting := range volumes {
+				if deleting == "" {
+					continue
+				}
+
+				log.DebugLog(ctx, "cephfs: resuming removal of volume %s deleted at %s", volumeID, deleting)
+				cs.startVolumeRemoval(volumeID)
+			}
+		}
+	}
+}
+
+// listFsNames returns the names of the filesystems of the cluster.
+func listFsNames(ctx context.Context, clusterID string, secrets map[string]string) ([]string, error) {
+	cr, err := util.NewAdminCredentials(secrets)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", clusterID, err)
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	return core.NewFileSystem(conn).ListFsNames(ctx)
+}
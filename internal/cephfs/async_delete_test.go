@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+)
+
+func TestCanDeleteAsync(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		volOptions store.VolumeOptions
+		want       bool
+	}{
+		{
+			name: "subvolume with snapshot retention",
+			volOptions: store.VolumeOptions{
+				Features: []string{"snapshot-clone", "snapshot-autoprotect", "snapshot-retention"},
+			},
+			want: true,
+		},
+		{
+			name: "subvolume without snapshot retention",
+			volOptions: store.VolumeOptions{
+				Features: []string{"snapshot-clone", "snapshot-autoprotect"},
+			},
+			want: false,
+		},
+		{
+			name: "snapshot-backed volume",
+			volOptions: store.VolumeOptions{
+				BackingSnapshot: true,
+				Features:        []string{"snapshot-retention"},
+			},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, canDeleteAsync(&tt.volOptions))
+		})
+	}
+}
+
+func TestAsyncDeleteRetryDelay(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, asyncDeleteRetryInterval, asyncDeleteRetryDelay(1))
+	require.Equal(t, 2*asyncDeleteRetryInterval, asyncDeleteRetryDelay(2))
+	require.Equal(t, 4*asyncDeleteRetryInterval, asyncDeleteRetryDelay(3))
+	require.Equal(t, asyncDeleteMaxRetryInterval, asyncDeleteRetryDelay(asyncDeleteMaxAttempts))
+}
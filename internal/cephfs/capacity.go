@@ -0,0 +1,91 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// GetCapacity returns the capacity that is available for new subvolumes of
+// the StorageClass parameters. The capacity of the data pool is limited by
+// the quota of the subvolumegroup, if one is set.
+func (cs *ControllerServer) GetCapacity(
+	ctx context.Context,
+	req *csi.GetCapacityRequest,
+) (*csi.GetCapacityResponse, error) {
+	params := req.GetParameters()
+
+	clusterData, err := store.GetClusterInformation(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	fsName := params["fsName"]
+	if fsName == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required parameter fsName")
+	}
+
+	secrets, err := k8s.GetProvisionerSecret(ctx, params)
+	if err != nil {
+		if errors.Is(err, k8s.ErrNoProvisionerSecret) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	cr, err := util.NewAdminCredentials(secrets)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	conn := &util.ClusterConnection{}
+	if err = conn.Connect(strings.Join(clusterData.Monitors, ","), cr); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to connect to cluster %s: %v", clusterData.ClusterID, err)
+	}
+	defer conn.Destroy()
+
+	fs := core.NewFileSystem(conn)
+	available, err := fs.GetAvailableCapacity(ctx, fsName, clusterData.CephFS.SubvolumeGroup, params["pool"])
+	if err != nil {
+		if errors.Is(err, util.ErrPoolNotFound) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	log.DebugLog(ctx, "cephfs: filesystem %s in cluster %s has %d bytes available",
+		fsName, clusterData.ClusterID, available)
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: available,
+	}, nil
+}
@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
 	"syscall"
 
 	"github.com/ceph/ceph-csi/internal/cephfs/core"
@@ -31,6 +33,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/k8s"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/parameters"
 	rterrors "github.com/ceph/ceph-csi/internal/util/reftracker/errors"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -65,6 +68,22 @@ type ControllerServer struct {
 
 	// Set metadata on volume
 	SetMetadata bool
+
+	// ReservationLock is set to acquire the RADOS lock of the journal for
+	// the request names of CreateVolume and CreateSnapshot
+	ReservationLock bool
+
+	// subvolumeGroups contains the subvolumegroups of StorageClasses that
+	// have been created, keyed by clusterID, fsName and group
+	subvolumeGroups sync.Map
+
+	// AsyncDelete is set to remove the subvolumes of deleted volumes in
+	// the background
+	AsyncDelete bool
+
+	// pendingRemovals contains the IDs of the volumes that are removed in
+	// the background
+	pendingRemovals sync.Map
 }
 
 // createBackingVolume creates the backing subvolume and on any error cleans up any created entities.
@@ -83,7 +102,7 @@ func (cs *ControllerServer) createBackingVolume(
 	if sID != nil {
 		err = parentVolOpt.CopyEncryptionConfig(ctx, volOptions, sID.SnapshotID, vID.VolumeID)
 		if err != nil {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 
 		return cs.createBackingVolumeFromSnapshotSource(ctx, volOptions, parentVolOpt, volClient, sID, secrets)
@@ -92,7 +111,7 @@ func (cs *ControllerServer) createBackingVolume(
 	if parentVolOpt != nil {
 		err = parentVolOpt.CopyEncryptionConfig(ctx, volOptions, pvID.VolumeID, vID.VolumeID)
 		if err != nil {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 
 		return cs.createBackingVolumeFromVolumeSource(ctx, parentVolOpt, volClient, pvID)
@@ -101,7 +120,7 @@ func (cs *ControllerServer) createBackingVolume(
 	if err = volClient.CreateVolume(ctx); err != nil {
 		log.ErrorLog(ctx, "failed to create volume %s: %v", volOptions.RequestName, err)
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	return nil
@@ -197,7 +216,7 @@ func (cs *ControllerServer) checkContentSource(
 				return nil, nil, nil, status.Error(codes.NotFound, err.Error())
 			}
 
-			return nil, nil, nil, status.Error(codes.Internal, err.Error())
+			return nil, nil, nil, util.GRPCError(err)
 		}
 
 		return volOpt, nil, sid, nil
@@ -211,7 +230,7 @@ func (cs *ControllerServer) checkContentSource(
 				return nil, nil, nil, status.Error(codes.NotFound, err.Error())
 			}
 
-			return nil, nil, nil, status.Error(codes.Internal, err.Error())
+			return nil, nil, nil, util.GRPCError(err)
 		}
 
 		return parentVol, pvID, nil, nil
@@ -250,6 +269,10 @@ func checkValidCreateVolumeRequest(
 			if !isRO {
 				return errors.New("backingSnapshot may be used only with read-only access modes")
 			}
+
+			if parentVol.StoresDEKInMetadata() {
+				return errors.New("backingSnapshot can not be used with snapshots that store their DEK in metadata")
+			}
 		}
 	}
 
@@ -264,6 +287,9 @@ func buildCreateVolumeResponse(
 	volumeContext := util.GetVolumeContext(req.GetParameters())
 	volumeContext["subvolumeName"] = vID.FsSubvolName
 	volumeContext["subvolumePath"] = volOptions.RootPath
+	if volOptions.TenantAuthID != "" {
+		volumeContext[store.TenantAuthIDKey] = volOptions.TenantAuthID
+	}
 	volume := &csi.Volume{
 		VolumeId:      vID.VolumeID,
 		CapacityBytes: volOptions.Size,
@@ -293,6 +319,10 @@ func (cs *ControllerServer) CreateVolume(
 
 		return nil, err
 	}
+	err := parameters.Validate(ctx, parameters.CephFS, parameters.StorageClass, req.GetParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	// Configuration
 	secret := req.GetSecrets()
@@ -307,12 +337,13 @@ func (cs *ControllerServer) CreateVolume(
 	defer cr.DeleteCredentials()
 
 	// Existence and conflict checks
-	if acquired := cs.VolumeLocks.TryAcquire(requestName); !acquired {
+	token, acquired := cs.VolumeLocks.TryAcquire(requestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, requestName)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, requestName)
 	}
-	defer cs.VolumeLocks.Release(requestName)
+	defer cs.VolumeLocks.Release(requestName, token)
 
 	volOptions, err := store.NewVolumeOptions(ctx, requestName, cs.ClusterName, cs.SetMetadata, req, cr)
 	if err != nil {
@@ -322,6 +353,17 @@ func (cs *ControllerServer) CreateVolume(
 	}
 	defer volOptions.Destroy()
 
+	if cs.ReservationLock {
+		release, lErr := store.VolJournal.LockReservation(ctx, volOptions.Monitors, volOptions.RadosNamespace, cr,
+			volOptions.MetadataPool, requestName)
+		if lErr != nil {
+			log.ErrorLog(ctx, lErr.Error())
+
+			return nil, status.Error(codes.Aborted, lErr.Error())
+		}
+		defer release()
+	}
+
 	if req.GetCapacityRange() != nil {
 		volOptions.Size = util.RoundOffCephFSVolSize(req.GetCapacityRange().GetRequiredBytes())
 	}
@@ -352,7 +394,7 @@ func (cs *ControllerServer) CreateVolume(
 				return nil, status.Error(codes.NotFound, err.Error())
 			}
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -362,7 +404,7 @@ func (cs *ControllerServer) CreateVolume(
 			return nil, status.Error(codes.Aborted, err.Error())
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// TODO return error message if requested vol size greater than found volume return error
@@ -389,15 +431,44 @@ func (cs *ControllerServer) CreateVolume(
 				}
 				log.ErrorLog(ctx, "failed to expand volume %s: %v", fsutil.VolumeID(vID.FsSubvolName), err)
 
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 		}
 
 		if !volOptions.BackingSnapshot {
+			if sID != nil || pvID != nil {
+				err = unsetParentMetadata(volClient)
+				if err != nil {
+					return nil, util.GRPCError(err)
+				}
+
+				err = copyParentDEK(ctx, volOptions, parentVol, vID, pvID, sID)
+				if err != nil {
+					return nil, util.GRPCError(err)
+				}
+			}
+
 			// Set metadata on restart of provisioner pod when subvolume exist
 			err = volClient.SetAllMetadata(metadata)
 			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
+			}
+
+			err = volClient.SetUserMetadata(k8s.GetUserMetadata(req.GetParameters()))
+			if err != nil {
+				return nil, util.GRPCError(err)
+			}
+
+			if volOptions.PinType != "" {
+				err = volClient.PinVolume(ctx, volOptions.PinType, volOptions.PinSetting)
+				if err != nil {
+					return nil, util.GRPCError(err)
+				}
+			}
+
+			err = authorizeTenant(ctx, volClient, volOptions)
+			if err != nil {
+				return nil, util.GRPCError(err)
 			}
 		}
 
@@ -407,7 +478,7 @@ func (cs *ControllerServer) CreateVolume(
 	// Reservation
 	vID, err = store.ReserveVol(ctx, volOptions, secret)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	defer func() {
@@ -422,6 +493,21 @@ func (cs *ControllerServer) CreateVolume(
 		}
 	}()
 
+	err = cs.ensureSubvolumeGroup(ctx, volOptions)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+
+	if (sID != nil || pvID != nil) && !volOptions.BackingSnapshot {
+		var source *core.SubVolume
+		if pvID != nil {
+			source = &parentVol.SubVolume
+		}
+		if opErr := store.StartCloneOperation(ctx, volOptions, vID, source, cr); opErr != nil {
+			log.WarningLog(ctx, "failed to record the clone operation of %s: %v", vID.FsSubvolName, opErr)
+		}
+	}
+
 	// Create a volume
 	err = cs.createBackingVolume(ctx, volOptions, parentVol, vID, pvID, sID, req.GetSecrets())
 	if err != nil {
@@ -457,7 +543,22 @@ func (cs *ControllerServer) CreateVolume(
 			}
 			log.ErrorLog(ctx, "failed to get subvolume path %s: %v", vID.FsSubvolName, err)
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
+		}
+
+		if sID != nil || pvID != nil {
+			err = unsetParentMetadata(volClient)
+			if err == nil {
+				err = copyParentDEK(ctx, volOptions, parentVol, vID, pvID, sID)
+			}
+			if err != nil {
+				purgeErr := volClient.PurgeVolume(ctx, true)
+				if purgeErr != nil {
+					log.ErrorLog(ctx, "failed to delete volume %s: %v", vID.FsSubvolName, purgeErr)
+				}
+
+				return nil, util.GRPCError(err)
+			}
 		}
 
 		// Set Metadata on PV Create
@@ -468,7 +569,39 @@ func (cs *ControllerServer) CreateVolume(
 				log.ErrorLog(ctx, "failed to delete volume %s: %v", vID.FsSubvolName, purgeErr)
 			}
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
+		}
+
+		err = volClient.SetUserMetadata(k8s.GetUserMetadata(req.GetParameters()))
+		if err != nil {
+			purgeErr := volClient.PurgeVolume(ctx, true)
+			if purgeErr != nil {
+				log.ErrorLog(ctx, "failed to delete volume %s: %v", vID.FsSubvolName, purgeErr)
+			}
+
+			return nil, util.GRPCError(err)
+		}
+
+		if volOptions.PinType != "" {
+			err = volClient.PinVolume(ctx, volOptions.PinType, volOptions.PinSetting)
+			if err != nil {
+				purgeErr := volClient.PurgeVolume(ctx, true)
+				if purgeErr != nil {
+					log.ErrorLog(ctx, "failed to delete volume %s: %v", vID.FsSubvolName, purgeErr)
+				}
+
+				return nil, util.GRPCError(err)
+			}
+		}
+
+		err = authorizeTenant(ctx, volClient, volOptions)
+		if err != nil {
+			purgeErr := volClient.PurgeVolume(ctx, true)
+			if purgeErr != nil {
+				log.ErrorLog(ctx, "failed to delete volume %s: %v", vID.FsSubvolName, purgeErr)
+			}
+
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -478,6 +611,76 @@ func (cs *ControllerServer) CreateVolume(
 	return buildCreateVolumeResponse(req, volOptions, vID), nil
 }
 
+// unsetParentMetadata removes the PV/PVC and snapshot metadata that a clone
+// may have inherited from its parent subvolume or snapshot, so that the
+// metadata of the clone only refers to its own Kubernetes objects.
+func unsetParentMetadata(volClient core.SubVolumeClient) error {
+	keys := slices.Concat(k8s.GetVolumeMetadataKeys(), k8s.GetSnapshotMetadataKeys())
+
+	return volClient.UnsetAllMetadata(keys)
+}
+
+// applySnapshotRetention deletes the snapshots of the subvolume of a volume
+// that is deleted, when its snapshotRetention is "delete". Otherwise the
+// snapshots are retained, and the path and size of the subvolume are recorded
+// in the journal of the snapshots so that they can still be restored once the
+// subvolume has been removed.
+func (cs *ControllerServer) applySnapshotRetention(
+	ctx context.Context,
+	volOptions *store.VolumeOptions,
+	cr *util.Credentials,
+	secrets map[string]string,
+) error {
+	if volOptions.SnapshotRetention != store.SnapshotRetentionDelete {
+		// subvolumes that only retain their snapshots have no path, it
+		// was recorded on a previous attempt
+		if volOptions.RootPath == "" {
+			return nil
+		}
+
+		if err := store.StoreRetainedSubvolume(ctx, volOptions, cr); err != nil {
+			return util.GRPCError(err)
+		}
+
+		return nil
+	}
+
+	snapIDs, err := store.ListSnapshotIDs(ctx, volOptions, volOptions.VolID, cr)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+
+	for _, snapID := range snapIDs {
+		log.DebugLog(ctx, "deleting snapshot %s of volume %s", snapID, volOptions.RequestName)
+		_, err = cs.DeleteSnapshot(ctx, &csi.DeleteSnapshotRequest{
+			SnapshotId: snapID,
+			Secrets:    secrets,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyParentDEK copies the DEK of the parent volume or snapshot to the
+// metadata of the subvolume of a clone, when the KMS does not store the DEK
+// itself.
+func copyParentDEK(
+	ctx context.Context,
+	volOptions,
+	parentVol *store.VolumeOptions,
+	vID, pvID *store.VolumeIdentifier,
+	sID *store.SnapshotIdentifier,
+) error {
+	if sID != nil {
+		return parentVol.CopyDEK(ctx, volOptions, sID.SnapshotID, vID.VolumeID)
+	}
+
+	return parentVol.CopyDEK(ctx, volOptions, pvID.VolumeID, vID.VolumeID)
+}
+
 // DeleteVolume deletes the volume in backend and its reservation.
 func (cs *ControllerServer) DeleteVolume(
 	ctx context.Context,
@@ -493,12 +696,13 @@ func (cs *ControllerServer) DeleteVolume(
 	secrets := req.GetSecrets()
 
 	// lock out parallel delete operations
-	if acquired := cs.VolumeLocks.TryAcquire(string(volID)); !acquired {
+	token, acquired := cs.VolumeLocks.TryAcquire(string(volID))
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, string(volID))
 	}
-	defer cs.VolumeLocks.Release(string(volID))
+	defer cs.VolumeLocks.Release(string(volID), token)
 
 	// lock out volumeID for clone and expand operation
 	if err := cs.OperationLocks.GetDeleteLock(req.GetVolumeId()); err != nil {
@@ -530,19 +734,20 @@ func (cs *ControllerServer) DeleteVolume(
 
 		// All errors other than ErrVolumeNotFound should return an error back to the caller
 		if !errors.Is(err, cerrors.ErrVolumeNotFound) {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		// If error is ErrImageNotFound then we failed to find the subvolume, but found the imageOMap
 		// to lead us to the image, hence the imageOMap needs to be garbage collected, by calling
 		// unreserve for the same
-		if acquired := cs.VolumeLocks.TryAcquire(volOptions.RequestName); !acquired {
+		nameToken, acquired := cs.VolumeLocks.TryAcquire(volOptions.RequestName)
+		if !acquired {
 			return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volOptions.RequestName)
 		}
-		defer cs.VolumeLocks.Release(volOptions.RequestName)
+		defer cs.VolumeLocks.Release(volOptions.RequestName, nameToken)
 
 		if err = store.UndoVolReservation(ctx, volOptions, *vID, secrets); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		return &csi.DeleteVolumeResponse{}, nil
@@ -551,10 +756,22 @@ func (cs *ControllerServer) DeleteVolume(
 
 	// lock out parallel delete and create requests against the same volume name as we
 	// cleanup the subvolume and associated omaps for the same
-	if acquired := cs.VolumeLocks.TryAcquire(volOptions.RequestName); !acquired {
+	nameToken, acquired := cs.VolumeLocks.TryAcquire(volOptions.RequestName)
+	if !acquired {
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volOptions.RequestName)
 	}
-	defer cs.VolumeLocks.Release(volOptions.RequestName)
+	defer cs.VolumeLocks.Release(volOptions.RequestName, nameToken)
+
+	if cs.AsyncDelete && canDeleteAsync(volOptions) && hasAsyncDeleteCredentials(volOptions.ClusterID) {
+		if err = cs.deleteVolumeAsync(ctx, volOptions, vID, secrets); err != nil {
+			log.ErrorLog(ctx, err.Error())
+
+			return nil, util.GRPCError(err)
+		}
+		log.DebugLog(ctx, "cephfs: volume %s is removed in the background", volID)
+
+		return &csi.DeleteVolumeResponse{}, nil
+	}
 
 	// Deleting a volume requires admin credentials
 	cr, err := util.NewAdminCredentials(secrets)
@@ -570,7 +787,7 @@ func (cs *ControllerServer) DeleteVolume(
 	}
 
 	if err := store.UndoVolReservation(ctx, volOptions, *vID, secrets); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(ctx, "cephfs: successfully deleted volume %s", volID)
@@ -601,6 +818,19 @@ func (cs *ControllerServer) cleanUpBackingVolume(
 
 		volClient := core.NewSubVolume(volOptions.GetConnection(),
 			&volOptions.SubVolume, volOptions.ClusterID, cs.ClusterName, cs.SetMetadata)
+		// Remove the access of the tenants first, the cephx users keep
+		// the capabilities for the path of the subvolume otherwise.
+		if err := volClient.DeauthorizeTenants(ctx); err != nil {
+			log.WarningLog(ctx, "failed to deauthorize the tenants of volume %s: %v", volID, err)
+		}
+		if err := cs.applySnapshotRetention(ctx, volOptions, cr, secrets); err != nil {
+			return err
+		}
+		// subvolumes with snapshots are retained, remove the user metadata so
+		// that they are not reported as a volume anymore
+		if err := volClient.SetUserMetadata(nil); err != nil {
+			log.WarningLog(ctx, "failed to remove the user metadata of volume %s: %v", volID, err)
+		}
 		if err := volClient.PurgeVolume(ctx, false); err != nil {
 			log.ErrorLog(ctx, "failed to delete volume %s: %v", volID, err)
 			if errors.Is(err, cerrors.ErrVolumeHasSnapshots) {
@@ -608,7 +838,7 @@ func (cs *ControllerServer) cleanUpBackingVolume(
 			}
 
 			if !errors.Is(err, cerrors.ErrVolumeNotFound) {
-				return status.Error(codes.Internal, err.Error())
+				return util.GRPCError(err)
 			}
 		}
 
@@ -625,7 +855,7 @@ func (cs *ControllerServer) cleanUpBackingVolume(
 			return status.Error(codes.Aborted, err.Error())
 		}
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	if !backingSnapNeedsDelete {
@@ -652,7 +882,7 @@ func (cs *ControllerServer) cleanUpBackingVolume(
 		}
 
 		if fatalErr {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 	} else {
 		snapClient := core.NewSnapshot(snapParentVolOptions.GetConnection(), snapID.FsSnapshotName,
@@ -660,7 +890,7 @@ func (cs *ControllerServer) cleanUpBackingVolume(
 
 		err = deleteSnapshotAndUndoReservation(ctx, snapClient, snapParentVolOptions, snapID, cr)
 		if err != nil {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 	}
 
@@ -702,12 +932,13 @@ func (cs *ControllerServer) ControllerExpandVolume(
 	secret := req.GetSecrets()
 
 	// lock out parallel delete operations
-	if acquired := cs.VolumeLocks.TryAcquire(volID); !acquired {
+	token, acquired := cs.VolumeLocks.TryAcquire(volID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
 	}
-	defer cs.VolumeLocks.Release(volID)
+	defer cs.VolumeLocks.Release(volID, token)
 
 	// lock out volumeID for clone and delete operation
 	if err := cs.OperationLocks.GetExpandLock(volID); err != nil {
@@ -734,10 +965,31 @@ func (cs *ControllerServer) ControllerExpandVolume(
 
 	volClient := core.NewSubVolume(volOptions.GetConnection(),
 		&volOptions.SubVolume, volOptions.ClusterID, cs.ClusterName, cs.SetMetadata)
+
+	// the quota of the subvolume can be reduced, as long as the used bytes
+	// fit in the new quota
+	info, err := volClient.GetSubVolumeInfo(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get info of volume %s: %v", fsutil.VolumeID(volIdentifier.FsSubvolName), err)
+
+		return nil, util.GRPCError(err)
+	}
+
+	if err = core.ValidateShrink(volOptions.VolID, info, RoundOffSize); err != nil {
+		log.ErrorLog(ctx, "failed to shrink volume %s: %v", fsutil.VolumeID(volIdentifier.FsSubvolName), err)
+
+		return nil, status.Error(codes.OutOfRange, err.Error())
+	}
+
+	if info.BytesQuota > RoundOffSize {
+		log.DebugLog(ctx, "shrinking volume %s from %d to %d bytes, %d bytes are in use",
+			fsutil.VolumeID(volIdentifier.FsSubvolName), info.BytesQuota, RoundOffSize, info.BytesUsed)
+	}
+
 	if err = volClient.ResizeVolume(ctx, RoundOffSize); err != nil {
 		log.ErrorLog(ctx, "failed to expand volume %s: %v", fsutil.VolumeID(volIdentifier.FsSubvolName), err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.ControllerExpandVolumeResponse{
@@ -765,18 +1017,19 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	clusterData, err := store.GetClusterInformation(req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	requestName := req.GetName()
 	sourceVolID := req.GetSourceVolumeId()
 	// Existence and conflict checks
-	if acquired := cs.SnapshotLocks.TryAcquire(requestName); !acquired {
+	token, acquired := cs.SnapshotLocks.TryAcquire(requestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, requestName)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, requestName)
 	}
-	defer cs.SnapshotLocks.Release(requestName)
+	defer cs.SnapshotLocks.Release(requestName, token)
 
 	if err = cs.OperationLocks.GetSnapshotCreateLock(sourceVolID); err != nil {
 		log.ErrorLog(ctx, err.Error())
@@ -800,7 +1053,7 @@ func (cs *ControllerServer) CreateSnapshot(
 			return nil, status.Error(codes.NotFound, err.Error())
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer parentVolOptions.Destroy()
 
@@ -816,22 +1069,34 @@ func (cs *ControllerServer) CreateSnapshot(
 		return nil, status.Error(codes.InvalidArgument, "cannot snapshot a snapshot-backed volume")
 	}
 
+	if cs.ReservationLock {
+		release, lErr := store.SnapJournal.LockReservation(ctx, parentVolOptions.Monitors,
+			parentVolOptions.RadosNamespace, cr, parentVolOptions.MetadataPool, requestName)
+		if lErr != nil {
+			log.ErrorLog(ctx, lErr.Error())
+
+			return nil, status.Error(codes.Aborted, lErr.Error())
+		}
+		defer release()
+	}
+
 	cephfsSnap, genSnapErr := store.GenSnapFromOptions(ctx, req)
 	if genSnapErr != nil {
 		return nil, status.Error(codes.Internal, genSnapErr.Error())
 	}
 
 	// lock out parallel snapshot create operations
-	if acquired := cs.VolumeLocks.TryAcquire(sourceVolID); !acquired {
+	sourceToken, acquired := cs.VolumeLocks.TryAcquire(sourceVolID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, sourceVolID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, sourceVolID)
 	}
-	defer cs.VolumeLocks.Release(sourceVolID)
+	defer cs.VolumeLocks.Release(sourceVolID, sourceToken)
 	snapName := req.GetName()
 	sid, err := store.CheckSnapExists(ctx, parentVolOptions, cephfsSnap, cs.ClusterName, cs.SetMetadata, cr)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	volClient := core.NewSubVolume(parentVolOptions.GetConnection(), &parentVolOptions.SubVolume,
@@ -846,7 +1111,7 @@ func (cs *ControllerServer) CreateSnapshot(
 			}
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	metadata := k8s.GetSnapshotMetadata(req.GetParameters())
@@ -858,7 +1123,7 @@ func (cs *ControllerServer) CreateSnapshot(
 				parentVolOptions.ClusterID, cs.ClusterName, cs.SetMetadata, &parentVolOptions.SubVolume)
 			err = snapClient.SetAllSnapshotMetadata(metadata)
 			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 		}
 
@@ -873,10 +1138,20 @@ func (cs *ControllerServer) CreateSnapshot(
 		}, nil
 	}
 
+	err = checkSnapshotLimits(ctx, parentVolOptions, vid, cr, req.GetParameters())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to check snapshot limits of volume %s: %v", sourceVolID, err)
+		if errors.Is(err, util.ErrSnapshotLimitExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
 	// Reservation
 	sID, err := store.ReserveSnap(ctx, parentVolOptions, vid.FsSubvolName, cephfsSnap, cr)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer func() {
 		if err != nil {
@@ -889,15 +1164,21 @@ func (cs *ControllerServer) CreateSnapshot(
 	}()
 	snap, err := cs.doSnapshot(ctx, parentVolOptions, sID.FsSnapshotName, metadata)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// Use same encryption KMS than source volume and copy the passphrase. The passphrase becomes
 	// available under the snapshot id for CreateVolume to use this snap as a backing volume
-	snapVolOptions := store.VolumeOptions{}
-	err = parentVolOptions.CopyEncryptionConfig(ctx, &snapVolOptions, sourceVolID, sID.SnapshotID)
+	snapVolOptions := parentVolOptions.SnapshotOptions(sID.FsSnapshotName)
+	err = parentVolOptions.CopyEncryptionConfig(ctx, snapVolOptions, sourceVolID, sID.SnapshotID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
+	}
+
+	errStore := store.StoreLastSnapshotTime(ctx, parentVolOptions, vid, cr, snap.CreatedAt)
+	if errStore != nil {
+		log.WarningLog(ctx, "failed to store time of snapshot %s of volume %s: %v",
+			sID.FsSnapshotName, sourceVolID, errStore)
 	}
 
 	return &csi.CreateSnapshotResponse{
@@ -952,6 +1233,11 @@ func (cs *ControllerServer) doSnapshot(
 		}
 	}
 
+	errMeta := snapClient.SetUsedBytesMetadata(snap.UsedBytes)
+	if errMeta != nil {
+		log.WarningLog(ctx, "failed to set used bytes of snapshot %s: %v", snapID, errMeta)
+	}
+
 	return snap, err
 }
 
@@ -971,6 +1257,11 @@ func (cs *ControllerServer) validateSnapshotReq(ctx context.Context, req *csi.Cr
 		return status.Error(codes.NotFound, "source Volume ID cannot be empty")
 	}
 
+	err := parameters.Validate(ctx, parameters.CephFS, parameters.VolumeSnapshotClass, req.GetParameters())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	return nil
 }
 
@@ -997,12 +1288,13 @@ func (cs *ControllerServer) DeleteSnapshot(
 		return nil, status.Error(codes.InvalidArgument, "snapshot ID cannot be empty")
 	}
 
-	if acquired := cs.SnapshotLocks.TryAcquire(snapshotID); !acquired {
+	token, acquired := cs.SnapshotLocks.TryAcquire(snapshotID)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, snapshotID)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, snapshotID)
 	}
-	defer cs.SnapshotLocks.Release(snapshotID)
+	defer cs.SnapshotLocks.Release(snapshotID, token)
 
 	// lock out snapshotID for restore operation
 	if err = cs.OperationLocks.GetDeleteLock(snapshotID); err != nil {
@@ -1033,7 +1325,7 @@ func (cs *ControllerServer) DeleteSnapshot(
 				log.ErrorLog(ctx, "failed to remove reservation for snapname (%s) with backing snap (%s) (%s)",
 					sid.RequestName, sid.FsSnapshotName, err)
 
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 
 			return &csi.DeleteSnapshotResponse{}, nil
@@ -1046,24 +1338,25 @@ func (cs *ControllerServer) DeleteSnapshot(
 				log.ErrorLog(ctx, "failed to remove reservation for snapname (%s) with backing snap (%s) (%s)",
 					sid.RequestName, sid.FsSnapshotName, err)
 
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 
 			return &csi.DeleteSnapshotResponse{}, nil
 		default:
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 	defer volOpt.Destroy()
 
 	// safeguard against parallel create or delete requests against the same
 	// name
-	if acquired := cs.SnapshotLocks.TryAcquire(sid.RequestName); !acquired {
+	nameToken, acquired := cs.SnapshotLocks.TryAcquire(sid.RequestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, sid.RequestName)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, sid.RequestName)
 	}
-	defer cs.SnapshotLocks.Release(sid.RequestName)
+	defer cs.SnapshotLocks.Release(sid.RequestName, nameToken)
 
 	if snapInfo.HasPendingClones == "yes" {
 		return nil, status.Errorf(codes.FailedPrecondition, "snapshot %s has pending clones", snapshotID)
@@ -1075,7 +1368,7 @@ func (cs *ControllerServer) DeleteSnapshot(
 			return nil, status.Error(codes.Aborted, err.Error())
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if needsDelete {
@@ -1089,7 +1382,7 @@ func (cs *ControllerServer) DeleteSnapshot(
 			cr,
 		)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
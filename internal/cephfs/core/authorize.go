@@ -0,0 +1,145 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// tenantAuthIDPrefix is the prefix of the cephx users of the tenants.
+const tenantAuthIDPrefix = "csi-tenant-"
+
+// TenantAuthID returns the ID of the cephx user of the tenant.
+func TenantAuthID(tenant string) string {
+	return tenantAuthIDPrefix + tenant
+}
+
+// AuthorizeVolume gives the cephx user of the tenant read-write access to the
+// path of the subvolume, and returns the key of the user. The user is created
+// when it does not exist yet, its capabilities are extended for every
+// subvolume it is authorized for. Authorizing a subvolume again is not an
+// error.
+func (s *subVolumeClient) AuthorizeVolume(ctx context.Context, tenant string) (string, error) {
+	authID := TenantAuthID(tenant)
+	// go-ceph does not support `ceph fs subvolume authorize`, send the
+	// command to the mgr directly.
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":       "fs subvolume authorize",
+		"vol_name":     s.FsName,
+		"group_name":   s.SubvolumeGroup,
+		"sub_name":     s.VolID,
+		"auth_id":      authID,
+		"tenant_id":    tenant,
+		"access_level": "rw",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode authorize command: %w", err)
+	}
+
+	out, err := s.conn.MgrCommand(cmd)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to authorize %s for subvolume %s in fs %s: %s", authID, s.VolID, s.FsName, err)
+
+		return "", err
+	}
+
+	key := strings.Trim(strings.TrimSpace(string(out)), `"`)
+	if key == "" {
+		return "", fmt.Errorf("no key returned when authorizing %s for subvolume %s", authID, s.VolID)
+	}
+
+	return key, nil
+}
+
+// DeauthorizeTenants removes the access of the cephx users of all tenants to
+// the subvolume.
+func (s *subVolumeClient) DeauthorizeTenants(ctx context.Context) error {
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":     "fs subvolume authorized_list",
+		"vol_name":   s.FsName,
+		"group_name": s.SubvolumeGroup,
+		"sub_name":   s.VolID,
+		"format":     "json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode authorized_list command: %w", err)
+	}
+
+	out, err := s.conn.MgrCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to list the users authorized for subvolume %s: %w", s.VolID, err)
+	}
+
+	authIDs, err := parseAuthorizedList(out)
+	if err != nil {
+		return err
+	}
+
+	for _, authID := range authIDs {
+		if !strings.HasPrefix(authID, tenantAuthIDPrefix) {
+			continue
+		}
+
+		cmd, err = json.Marshal(map[string]string{
+			"prefix":     "fs subvolume deauthorize",
+			"vol_name":   s.FsName,
+			"group_name": s.SubvolumeGroup,
+			"sub_name":   s.VolID,
+			"auth_id":    authID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode deauthorize command: %w", err)
+		}
+
+		_, err = s.conn.MgrCommand(cmd)
+		if err != nil {
+			return fmt.Errorf("failed to deauthorize %s for subvolume %s: %w", authID, s.VolID, err)
+		}
+		log.DebugLog(ctx, "deauthorized %s for subvolume %s in fs %s", authID, s.VolID, s.FsName)
+	}
+
+	return nil
+}
+
+// parseAuthorizedList returns the auth IDs of the output of
+// `ceph fs subvolume authorized_list`, which is a list of objects that map
+// the auth ID to its access level, like `[{"alice": "rw"}]`.
+func parseAuthorizedList(out []byte) ([]string, error) {
+	if len(strings.TrimSpace(string(out))) == 0 {
+		return nil, nil
+	}
+
+	var list []map[string]string
+	err := json.Unmarshal(out, &list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the list of authorized users %q: %w", string(out), err)
+	}
+
+	authIDs := []string{}
+	for _, entry := range list {
+		for authID := range entry {
+			authIDs = append(authIDs, authID)
+		}
+	}
+
+	return authIDs, nil
+}
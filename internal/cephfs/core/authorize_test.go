@@ -0,0 +1,50 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseAuthorizedList(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		out     string
+		want    []string
+		wantErr bool
+	}{
+		{"no output", "", nil, false},
+		{"empty list", "[]", []string{}, false},
+		{"single user", `[{"csi-tenant-team-a": "rw"}]`, []string{"csi-tenant-team-a"}, false},
+		{"multiple users", `[{"alice": "r"}, {"csi-tenant-team-a": "rw"}]`, []string{"alice", "csi-tenant-team-a"}, false},
+		{"invalid output", "alice", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseAuthorizedList([]byte(tt.out))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseAuthorizedList(%q) error = %v, wantErr %v", tt.out, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseAuthorizedList(%q) = %v, want %v", tt.out, got, tt.want)
+			}
+		})
+	}
+}
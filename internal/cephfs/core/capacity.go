@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
+)
+
+// subVolumeGroupInfo contains the usage of `ceph fs subvolumegroup info`. The
+// bytes_quota is the string "infinite" when the group has no quota.
+type subVolumeGroupInfo struct {
+	BytesQuota json.RawMessage `json:"bytes_quota"`
+	BytesUsed  int64           `json:"bytes_used"`
+}
+
+// parseSubVolumeGroupQuota returns the bytes that are left in the quota of
+// the subvolumegroup. hasQuota is false when the group has no quota.
+func parseSubVolumeGroupQuota(output []byte) (int64, bool, error) {
+	info := &subVolumeGroupInfo{}
+	if err := json.Unmarshal(output, info); err != nil {
+		return 0, false, fmt.Errorf("failed to parse subvolumegroup info: %w", err)
+	}
+
+	var quota int64
+	switch string(info.BytesQuota) {
+	case "", `"infinite"`:
+		return 0, false, nil
+	}
+
+	if err := json.Unmarshal(info.BytesQuota, &quota); err != nil {
+		return 0, false, fmt.Errorf("failed to parse bytes_quota %s: %w", info.BytesQuota, err)
+	}
+
+	return max(quota-info.BytesUsed, 0), true, nil
+}
+
+// getDataPoolAvailable returns the available bytes of the data pool of the
+// filesystem. The first data pool is the default data pool.
+func getDataPoolAvailable(pools []fsAdmin.PoolInfo, pool string) (int64, error) {
+	for i, p := range pools {
+		if p.Name == pool || (pool == "" && i == 0) {
+			return int64(p.Available), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: data pool %q", util.ErrPoolNotFound, pool)
+}
+
+// GetAvailableCapacity returns the capacity that is available for new
+// subvolumes. This is the available capacity of the data pool, limited by the
+// quota of the subvolumegroup.
+func (f *fileSystem) GetAvailableCapacity(ctx context.Context, fsName, subvolumeGroup, pool string) (int64, error) {
+	fsa, err := f.conn.GetFSAdmin()
+	if err != nil {
+		log.ErrorLog(ctx, "could not get FSAdmin, can not fetch capacity of %s: %s", fsName, err)
+
+		return 0, err
+	}
+
+	info, err := fsa.FetchVolumeInfo(fsName)
+	if err != nil {
+		log.ErrorLog(ctx, "could not fetch info of filesystem %s: %s", fsName, err)
+
+		return 0, err
+	}
+
+	available, err := getDataPoolAvailable(info.Pools.DataPool, pool)
+	if err != nil {
+		return 0, err
+	}
+
+	// go-ceph does not provide the subvolumegroup info, send the command to
+	// the mgr directly.
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":     "fs subvolumegroup info",
+		"vol_name":   fsName,
+		"group_name": subvolumeGroup,
+		"format":     "json",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode subvolumegroup info command: %w", err)
+	}
+
+	output, err := f.conn.MgrCommand(cmd)
+	if err != nil {
+		// the group is created with the first subvolume, and older Ceph
+		// versions do not support the command
+		log.DebugLog(ctx, "could not get info of subvolumegroup %s in %s, ignoring its quota: %s",
+			subvolumeGroup, fsName, err)
+
+		return available, nil
+	}
+
+	left, hasQuota, err := parseSubVolumeGroupQuota(output)
+	if err != nil {
+		return 0, err
+	}
+
+	if hasQuota {
+		available = min(available, left)
+	}
+
+	return available, nil
+}
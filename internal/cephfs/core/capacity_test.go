@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubVolumeGroupQuota(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		output       string
+		wantLeft     int64
+		wantHasQuota bool
+		wantErr      bool
+	}{
+		{
+			name:         "no quota",
+			output:       `{"bytes_quota": "infinite", "bytes_used": 1024}`,
+			wantHasQuota: false,
+		},
+		{
+			name:         "quota",
+			output:       `{"bytes_quota": 10737418240, "bytes_used": 1073741824}`,
+			wantLeft:     9663676416,
+			wantHasQuota: true,
+		},
+		{
+			name:         "quota exceeded",
+			output:       `{"bytes_quota": 1073741824, "bytes_used": 2147483648}`,
+			wantLeft:     0,
+			wantHasQuota: true,
+		},
+		{
+			name:    "invalid quota",
+			output:  `{"bytes_quota": [], "bytes_used": 0}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid output",
+			output:  "not json",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			left, hasQuota, err := parseSubVolumeGroupQuota([]byte(tt.output))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantLeft, left)
+			require.Equal(t, tt.wantHasQuota, hasQuota)
+		})
+	}
+}
+
+func TestGetDataPoolAvailable(t *testing.T) {
+	t.Parallel()
+
+	pools := []fsAdmin.PoolInfo{
+		{Name: "myfs-data0", Available: 3000},
+		{Name: "myfs-ec", Available: 5000},
+	}
+
+	tests := []struct {
+		name    string
+		pool    string
+		want    int64
+		wantErr error
+	}{
+		{
+			name: "default data pool",
+			pool: "",
+			want: 3000,
+		},
+		{
+			name: "additional data pool",
+			pool: "myfs-ec",
+			want: 5000,
+		},
+		{
+			name:    "unknown data pool",
+			pool:    "unknown",
+			wantErr: util.ErrPoolNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getDataPoolAvailable(pools, tt.pool)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -18,12 +18,16 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/ceph/go-ceph/cephfs/admin"
+	"github.com/ceph/go-ceph/rados"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // cephFSCloneState describes the status of the clone.
@@ -67,10 +71,13 @@ func (cs *cephFSCloneState) GetProgressReport() admin.CloneProgressReport {
 func (s *subVolumeClient) CreateCloneFromSubvolume(
 	ctx context.Context,
 	parentvolOpt *SubVolume,
-) error {
+) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.CreateCloneFromSubvolume", attribute.String("subvolume", s.VolID))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	snapshotID := s.VolID
 	snapClient := NewSnapshot(s.conn, snapshotID, s.clusterID, s.clusterName, s.enableMetadata, parentvolOpt)
-	err := snapClient.CreateSnapshot(ctx)
+	err = snapClient.CreateSnapshot(ctx)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to create snapshot %s %v", snapshotID, err)
 
@@ -81,11 +88,11 @@ func (s *subVolumeClient) CreateCloneFromSubvolume(
 		// if any error occurs while cloning, resizing or deleting the snapshot
 		// fails then we need to delete the clone and snapshot.
 		if err != nil && !cerrors.IsCloneRetryError(err) {
-			if err = s.PurgeVolume(ctx, true); err != nil {
-				log.ErrorLog(ctx, "failed to delete volume %s: %v", s.VolID, err)
+			if pErr := s.PurgeVolume(ctx, true); pErr != nil {
+				log.ErrorLog(ctx, "failed to delete volume %s: %v", s.VolID, pErr)
 			}
-			if err = snapClient.DeleteSnapshot(ctx); err != nil {
-				log.ErrorLog(ctx, "failed to delete snapshot %s %v", snapshotID, err)
+			if dErr := snapClient.DeleteSnapshot(ctx); dErr != nil {
+				log.ErrorLog(ctx, "failed to delete snapshot %s %v", snapshotID, dErr)
 			}
 		}
 	}()
@@ -227,3 +234,25 @@ func (s *subVolumeClient) GetCloneState(ctx context.Context) (*cephFSCloneState,
 
 	return state, nil
 }
+
+// CancelClone stops the clone of the subvolume, the subvolume can be purged
+// once the clone is canceled.
+func (s *subVolumeClient) CancelClone(ctx context.Context) error {
+	fsa, err := s.conn.GetFSAdmin()
+	if err != nil {
+		log.ErrorLog(ctx, "could not get FSAdmin, can not cancel clone %s in fs %s: %v", s.VolID, s.FsName, err)
+
+		return err
+	}
+
+	err = fsa.CancelClone(s.FsName, s.SubvolumeGroup, s.VolID)
+	if err != nil {
+		if errors.Is(err, rados.ErrNotFound) {
+			return fmt.Errorf("Failed as %w (internal %w)", cerrors.ErrVolumeNotFound, err)
+		}
+
+		return fmt.Errorf("failed to cancel clone %s in fs %s: %w", s.VolID, s.FsName, err)
+	}
+
+	return nil
+}
@@ -34,6 +34,14 @@ type FileSystem interface {
 	GetMetadataPool(ctx context.Context, fsName string) (string, error)
 	// GetFsName returns the name of the filesystem with the given ID.
 	GetFsName(ctx context.Context, fsID int64) (string, error)
+	// ListFsNames returns the names of all filesystems.
+	ListFsNames(ctx context.Context) ([]string, error)
+	// GetAvailableCapacity returns the capacity that is available for new
+	// subvolumes in the subvolumegroup and data pool of the filesystem.
+	GetAvailableCapacity(ctx context.Context, fsName, subvolumeGroup, pool string) (int64, error)
+	// CreateSubVolumeGroup creates the subvolumegroup with the options, when
+	// it does not exist yet.
+	CreateSubVolumeGroup(ctx context.Context, fsName, group string, opts *SubVolumeGroupOptions) error
 }
 
 // fileSystem is the implementation of FileSystem interface.
@@ -124,3 +132,27 @@ func (f *fileSystem) GetFsName(ctx context.Context, fscID int64) (string, error)
 
 	return "", fmt.Errorf("%w: fscID (%d) not found in Ceph cluster", util.ErrPoolNotFound, fscID)
 }
+
+// ListFsNames returns the names of all filesystems.
+func (f *fileSystem) ListFsNames(ctx context.Context) ([]string, error) {
+	fsa, err := f.conn.GetFSAdmin()
+	if err != nil {
+		log.ErrorLog(ctx, "could not get FSAdmin, can not list filesystems: %s", err)
+
+		return nil, err
+	}
+
+	volumes, err := fsa.EnumerateVolumes()
+	if err != nil {
+		log.ErrorLog(ctx, "could not list volumes: %s", err)
+
+		return nil, err
+	}
+
+	names := make([]string, 0, len(volumes))
+	for _, vol := range volumes {
+		names = append(names, vol.Name)
+	}
+
+	return names, nil
+}
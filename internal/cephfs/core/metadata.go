@@ -20,6 +20,8 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+
 	libcephfs "github.com/ceph/go-ceph/cephfs"
 	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
 )
@@ -27,6 +29,13 @@ import (
 const (
 	// clusterNameKey cluster Key, set on cephfs subvolume.
 	clusterNameKey = "csi.ceph.com/cluster/name"
+	// usedBytesKey is set on subvolume snapshots, it contains the number of
+	// bytes that are used by the snapshot.
+	usedBytesKey = "csi.ceph.com/snapshot/used-bytes"
+	// dekKey is set on the subvolumes and subvolume snapshots of encrypted
+	// volumes when the KMS does not store the DEK itself, it contains the
+	// encrypted DEK.
+	dekKey = "csi.ceph.com/fscrypt/dek"
 )
 
 // ErrSubVolMetadataNotSupported is returned when set/get/list/remove subvolume metadata options are not supported.
@@ -70,6 +79,23 @@ func (s *subVolumeClient) setMetadata(key, value string) error {
 	return err
 }
 
+// getMetadata returns the value of the custom metadata key of the subvolume.
+func (s *subVolumeClient) getMetadata(key string) (string, error) {
+	if !s.supportsSubVolMetadata() {
+		return "", ErrSubVolMetadataNotSupported
+	}
+	fsa, err := s.conn.GetFSAdmin()
+	if err != nil {
+		return "", err
+	}
+	value, err := fsa.GetMetadata(s.FsName, s.SubvolumeGroup, s.VolID, key)
+	if !s.isUnsupportedSubVolMetadata(err) {
+		return "", ErrSubVolMetadataNotSupported
+	}
+
+	return value, err
+}
+
 // removeMetadata removes custom metadata set on the subvolume in a volume
 // using the metadata key.
 func (s *subVolumeClient) removeMetadata(key string) error {
@@ -89,6 +115,23 @@ func (s *subVolumeClient) removeMetadata(key string) error {
 	return err
 }
 
+// listMetadata returns the custom metadata of the subvolume.
+func (s *subVolumeClient) listMetadata() (map[string]string, error) {
+	if !s.supportsSubVolMetadata() {
+		return nil, ErrSubVolMetadataNotSupported
+	}
+	fsa, err := s.conn.GetFSAdmin()
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := fsa.ListMetadata(s.FsName, s.SubvolumeGroup, s.VolID)
+	if !s.isUnsupportedSubVolMetadata(err) {
+		return nil, ErrSubVolMetadataNotSupported
+	}
+
+	return metadata, err
+}
+
 // SetAllMetadata set all the metadata from arg parameters on Ssubvolume.
 func (s *subVolumeClient) SetAllMetadata(parameters map[string]string) error {
 	if !s.enableMetadata {
@@ -149,3 +192,65 @@ func (s *subVolumeClient) UnsetAllMetadata(keys []string) error {
 
 	return nil
 }
+
+// SetUserMetadata sets the user metadata from the StorageClass on the
+// subvolume, and removes user metadata that is not in it, like the user
+// metadata that a clone inherited from its parent. User metadata is set
+// independent of enableMetadata.
+func (s *subVolumeClient) SetUserMetadata(metadata map[string]string) error {
+	current, err := s.listMetadata()
+	if errors.Is(err, ErrSubVolMetadataNotSupported) {
+		if len(metadata) != 0 {
+			return fmt.Errorf("failed to set user metadata on subvolume %v: %w", s, err)
+		}
+
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list metadata of subvolume %v: %w", s, err)
+	}
+
+	for key := range current {
+		if _, ok := metadata[key]; ok || !k8s.IsUserMetadataKey(key) {
+			continue
+		}
+		err = s.removeMetadata(key)
+		if err != nil && !errors.Is(err, libcephfs.ErrNotExist) {
+			return fmt.Errorf("failed to unset metadata key %q on subvolume %v: %w", key, s, err)
+		}
+	}
+
+	for key, value := range metadata {
+		if v, ok := current[key]; ok && v == value {
+			continue
+		}
+		err = s.setMetadata(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to set metadata key %q, value %q on subvolume %v: %w", key, value, s, err)
+		}
+	}
+
+	return nil
+}
+
+// StoreDEK stores the encrypted DEK of the volume in the metadata of the
+// subvolume.
+func (s *subVolumeClient) StoreDEK(dek string) error {
+	err := s.setMetadata(dekKey, dek)
+	if err != nil {
+		return fmt.Errorf("failed to store DEK on subvolume %v: %w", s, err)
+	}
+
+	return nil
+}
+
+// FetchDEK returns the encrypted DEK of the volume from the metadata of the
+// subvolume.
+func (s *subVolumeClient) FetchDEK() (string, error) {
+	dek, err := s.getMetadata(dekKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch DEK of subvolume %v: %w", s, err)
+	}
+
+	return dek, nil
+}
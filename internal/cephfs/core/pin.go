@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// PinTypeExport pins the subvolume to the MDS rank in the pin setting,
+	// -1 removes the pin.
+	PinTypeExport = "export"
+	// PinTypeDistributed spreads the direct children of the subvolume over
+	// all MDS ranks when the pin setting is 1.
+	PinTypeDistributed = "distributed"
+	// PinTypeRandom pins the descendant directories of the subvolume to a
+	// random MDS rank, with the probability in the pin setting.
+	PinTypeRandom = "random"
+)
+
+// ValidatePin checks that the pinType and pinSetting can be passed to
+// `ceph fs subvolume pin`. Both are empty when the subvolume should not be
+// pinned.
+func ValidatePin(pinType, pinSetting string) error {
+	if pinType == "" && pinSetting == "" {
+		return nil
+	}
+
+	if pinType == "" || pinSetting == "" {
+		return fmt.Errorf("pinType %q and pinSetting %q need to be set together", pinType, pinSetting)
+	}
+
+	switch pinType {
+	case PinTypeExport:
+		rank, err := strconv.ParseInt(pinSetting, 10, 64)
+		if err != nil || rank < -1 {
+			return fmt.Errorf("pinSetting %q for pinType %q is not a MDS rank or -1", pinSetting, pinType)
+		}
+	case PinTypeDistributed:
+		if pinSetting != "0" && pinSetting != "1" {
+			return fmt.Errorf("pinSetting %q for pinType %q needs to be 0 or 1", pinSetting, pinType)
+		}
+	case PinTypeRandom:
+		p, err := strconv.ParseFloat(pinSetting, 64)
+		if err != nil || p < 0.0 || p > 1.0 {
+			return fmt.Errorf("pinSetting %q for pinType %q needs to be between 0.0 and 1.0", pinSetting, pinType)
+		}
+	default:
+		return fmt.Errorf("invalid pinType %q, supported are %q, %q and %q",
+			pinType, PinTypeExport, PinTypeDistributed, PinTypeRandom)
+	}
+
+	return nil
+}
+
+// PinVolume sets the pin policy on the subvolume. Pinning a subvolume again
+// with the same policy is not an error.
+func (s *subVolumeClient) PinVolume(ctx context.Context, pinType, pinSetting string) error {
+	// go-ceph does not pass the subvolumegroup with FSAdmin.PinSubVolume(),
+	// send the command to the mgr directly.
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":      "fs subvolume pin",
+		"vol_name":    s.FsName,
+		"group_name":  s.SubvolumeGroup,
+		"sub_name":    s.VolID,
+		"pin_type":    pinType,
+		"pin_setting": pinSetting,
+		"format":      "json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode pin command: %w", err)
+	}
+
+	_, err = s.conn.MgrCommand(cmd)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to set %s pin %s on subvolume %s in fs %s: %s",
+			pinType, pinSetting, s.VolID, s.FsName, err)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+)
+
+func TestValidatePin(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		pinType    string
+		pinSetting string
+		wantErr    bool
+	}{
+		{"not pinned", "", "", false},
+		{"export to rank", PinTypeExport, "1", false},
+		{"remove export pin", PinTypeExport, "-1", false},
+		{"export to invalid rank", PinTypeExport, "-2", true},
+		{"export without rank", PinTypeExport, "rank", true},
+		{"distributed", PinTypeDistributed, "1", false},
+		{"distributed disabled", PinTypeDistributed, "0", false},
+		{"distributed invalid", PinTypeDistributed, "2", true},
+		{"random", PinTypeRandom, "0.01", false},
+		{"random too large", PinTypeRandom, "1.5", true},
+		{"random not a number", PinTypeRandom, "often", true},
+		{"type without setting", PinTypeExport, "", true},
+		{"setting without type", "", "1", true},
+		{"unknown type", "ephemeral", "1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidatePin(tt.pinType, tt.pinSetting)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePin(%q, %q) error = %v, wantErr %v", tt.pinType, tt.pinSetting, err, tt.wantErr)
+			}
+		})
+	}
+}
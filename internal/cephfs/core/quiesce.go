@@ -18,6 +18,7 @@ package core
 
 import (
 	"context"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
@@ -25,6 +26,14 @@ import (
 	"github.com/ceph/go-ceph/cephfs/admin"
 )
 
+// DefaultQuiesceExpiration is the time after which Ceph releases a quiesce
+// set that is not reset, when no other expiration is requested.
+const DefaultQuiesceExpiration = 180 * time.Second
+
+// quiesceTimeout is the time in seconds that Ceph waits for the members of a
+// quiesce set to be quiesced, before the set times out.
+const quiesceTimeout = 180
+
 type QuiesceState string
 
 const (
@@ -92,16 +101,21 @@ type fsQuiesce struct {
 	// subVolumeGroupMapping is a map of subvolumes to groups.
 	subVolumeGroupMapping map[string][]string
 	fsa                   *admin.FSAdmin
+	// expiration is the time in seconds after which Ceph releases the
+	// quiesce set when it is not reset.
+	expiration float64
 }
 
 // NewFSQuiesce returns a new instance of fsQuiesce. It
 // take the filesystem name, the list of volumes to be quiesced, the mapping of
-// subvolumes to groups and the cluster connection as input.
+// subvolumes to groups, the cluster connection and the expiration of the
+// quiesce set as input.
 func NewFSQuiesce(
 	fsName string,
 	volumes []Volume,
 	mapping map[string][]string,
 	conn *util.ClusterConnection,
+	expiration time.Duration,
 ) (FSQuiesceClient, error) {
 	fsa, err := conn.GetFSAdmin()
 	if err != nil {
@@ -114,6 +128,7 @@ func NewFSQuiesce(
 		volumes:               volumes,
 		subVolumeGroupMapping: mapping,
 		fsa:                   fsa,
+		expiration:            expiration.Seconds(),
 	}, nil
 }
 
@@ -151,9 +166,9 @@ func (fq *fsQuiesce) FSQuiesce(
 	reserveName string,
 ) (*admin.QuiesceInfo, error) {
 	opt := &admin.FSQuiesceOptions{
-		Timeout:    180,
+		Timeout:    quiesceTimeout,
 		AwaitFor:   0,
-		Expiration: 180,
+		Expiration: fq.expiration,
 	}
 	log.DebugLog(ctx,
 		"FSQuiesce for reserveName %s: members:%v options:%v",
@@ -176,9 +191,9 @@ func (fq *fsQuiesce) FSQuiesceWithExpireTimeout(ctx context.Context,
 	reserveName string,
 ) (*admin.QuiesceInfo, error) {
 	opt := &admin.FSQuiesceOptions{
-		Timeout:    180,
+		Timeout:    quiesceTimeout,
 		AwaitFor:   0,
-		Expiration: 180,
+		Expiration: fq.expiration,
 	}
 	log.DebugLog(ctx,
 		"FSQuiesceWithExpireTimeout for reserveName %s: members:%v options:%v",
@@ -203,8 +218,8 @@ func (fq *fsQuiesce) ResetFSQuiesce(ctx context.Context,
 	opt := &admin.FSQuiesceOptions{
 		Reset:      true,
 		AwaitFor:   0,
-		Timeout:    180,
-		Expiration: 180,
+		Timeout:    quiesceTimeout,
+		Expiration: fq.expiration,
 	}
 	// Reset the filesystem quiesce so that the timer will be reset, and we can
 	// reuse the same reservation if it has already failed or timed out.
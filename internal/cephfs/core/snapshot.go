@@ -24,10 +24,12 @@ import (
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/ceph/go-ceph/cephfs/admin"
 	"github.com/ceph/go-ceph/rados"
 	"github.com/golang/protobuf/ptypes/timestamp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // SnapshotClient is the interface that holds the signature of snapshot methods
@@ -47,6 +49,15 @@ type SnapshotClient interface {
 	// UnsetAllSnapshotMetadata unset all the metadata from arg keys on
 	// subvolume snapshot.
 	UnsetAllSnapshotMetadata(keys []string) error
+	// SetUsedBytesMetadata sets the number of bytes that are used by the
+	// subvolume snapshot as metadata.
+	SetUsedBytesMetadata(usedBytes int64) error
+	// StoreDEK stores the encrypted DEK of the snapshot in the metadata of
+	// the subvolume snapshot.
+	StoreDEK(dek string) error
+	// FetchDEK returns the encrypted DEK of the snapshot from the metadata
+	// of the subvolume snapshot.
+	FetchDEK() (string, error)
 }
 
 // snapshotClient is the implementation of SnapshotClient interface.
@@ -86,7 +97,16 @@ func NewSnapshot(
 }
 
 // CreateSnapshot creates a snapshot of the subvolume.
-func (s *snapshotClient) CreateSnapshot(ctx context.Context) error {
+func (s *snapshotClient) CreateSnapshot(ctx context.Context) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.CreateSnapshot", attribute.String("snapshot", s.SnapshotID))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, s.clusterID, util.SnapshotOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	fsa, err := s.conn.GetFSAdmin()
 	if err != nil {
 		log.ErrorLog(ctx, "could not get FSAdmin: %s", err)
@@ -106,7 +126,16 @@ func (s *snapshotClient) CreateSnapshot(ctx context.Context) error {
 }
 
 // DeleteSnapshot deletes the snapshot of the subvolume.
-func (s *snapshotClient) DeleteSnapshot(ctx context.Context) error {
+func (s *snapshotClient) DeleteSnapshot(ctx context.Context) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.DeleteSnapshot", attribute.String("snapshot", s.SnapshotID))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, s.clusterID, util.SnapshotOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	fsa, err := s.conn.GetFSAdmin()
 	if err != nil {
 		log.ErrorLog(ctx, "could not get FSAdmin: %s", err)
@@ -129,6 +158,8 @@ type SnapshotInfo struct {
 	CreatedAt        time.Time
 	CreationTime     *timestamp.Timestamp
 	HasPendingClones string
+	// UsedBytes is the recursive size of the files in the snapshot
+	UsedBytes int64
 }
 
 // GetSnapshotInfo returns the snapshot info of the subvolume.
@@ -158,6 +189,7 @@ func (s *snapshotClient) GetSnapshotInfo(ctx context.Context) (SnapshotInfo, err
 	}
 	snap.CreatedAt = info.CreatedAt.Time
 	snap.HasPendingClones = info.HasPendingClones
+	snap.UsedBytes = int64(info.Size)
 
 	return snap, nil
 }
@@ -167,6 +199,12 @@ func (s *snapshotClient) CloneSnapshot(
 	ctx context.Context,
 	cloneSubVol *SubVolume,
 ) error {
+	release, err := util.AcquireOperation(ctx, s.clusterID, util.CloneOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	fsa, err := s.conn.GetFSAdmin()
 	if err != nil {
 		log.ErrorLog(ctx, "could not get FSAdmin: %s", err)
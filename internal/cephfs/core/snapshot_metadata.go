@@ -19,6 +19,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"strconv"
 
 	libcephfs "github.com/ceph/go-ceph/cephfs"
 	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
@@ -67,6 +68,25 @@ func (s *snapshotClient) setSnapshotMetadata(key, value string) error {
 	return err
 }
 
+// getSnapshotMetadata returns the value of the custom metadata key of the
+// subvolume snapshot.
+func (s *snapshotClient) getSnapshotMetadata(key string) (string, error) {
+	if !s.supportsSubVolSnapMetadata() {
+		return "", ErrSubVolSnapMetadataNotSupported
+	}
+	fsa, err := s.conn.GetFSAdmin()
+	if err != nil {
+		return "", err
+	}
+
+	value, err := fsa.GetSnapshotMetadata(s.FsName, s.SubvolumeGroup, s.VolID, s.SnapshotID, key)
+	if !s.isUnsupportedSubVolSnapMetadata(err) {
+		return "", ErrSubVolSnapMetadataNotSupported
+	}
+
+	return value, err
+}
+
 // removeSnapshotMetadata removes custom metadata set on the subvolume
 // snapshot in a volume using the metadata key.
 func (s *snapshotClient) removeSnapshotMetadata(key string) error {
@@ -112,6 +132,22 @@ func (s *snapshotClient) SetAllSnapshotMetadata(parameters map[string]string) er
 	return nil
 }
 
+// SetUsedBytesMetadata sets the number of bytes that are used by the
+// subvolume snapshot as metadata.
+func (s *snapshotClient) SetUsedBytesMetadata(usedBytes int64) error {
+	if !s.enableMetadata {
+		return nil
+	}
+
+	err := s.setSnapshotMetadata(usedBytesKey, strconv.FormatInt(usedBytes, 10))
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on subvolume snapshot %s %s in fs %s: %w",
+			usedBytesKey, s.SnapshotID, s.VolID, s.FsName, err)
+	}
+
+	return nil
+}
+
 // UnsetAllSnapshotMetadata unset all the metadata from arg keys on subvolume
 // snapshot.
 func (s *snapshotClient) UnsetAllSnapshotMetadata(keys []string) error {
@@ -135,3 +171,27 @@ func (s *snapshotClient) UnsetAllSnapshotMetadata(keys []string) error {
 
 	return nil
 }
+
+// StoreDEK stores the encrypted DEK of the snapshot in the metadata of the
+// subvolume snapshot.
+func (s *snapshotClient) StoreDEK(dek string) error {
+	err := s.setSnapshotMetadata(dekKey, dek)
+	if err != nil {
+		return fmt.Errorf("failed to store DEK on subvolume snapshot %s %s in fs %s: %w",
+			s.SnapshotID, s.VolID, s.FsName, err)
+	}
+
+	return nil
+}
+
+// FetchDEK returns the encrypted DEK of the snapshot from the metadata of the
+// subvolume snapshot.
+func (s *snapshotClient) FetchDEK() (string, error) {
+	dek, err := s.getSnapshotMetadata(dekKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch DEK of subvolume snapshot %s %s in fs %s: %w",
+			s.SnapshotID, s.VolID, s.FsName, err)
+	}
+
+	return dek, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
+)
+
+// SubVolumeGroupOptions are the settings of a subvolumegroup that is created
+// by the driver. The settings are only applied when the group is created,
+// existing groups are not modified.
+type SubVolumeGroupOptions struct {
+	// Mode is the permission of the directory of the group, 0 keeps the
+	// default of Ceph.
+	Mode int
+	// UID and GID are the owner of the directory of the group.
+	UID int
+	GID int
+	// PinType and PinSetting are the pin policy of the group, see
+	// ValidatePin.
+	PinType    string
+	PinSetting string
+}
+
+// ParseSubVolumeGroupMode parses the octal permission of the directory of a
+// subvolumegroup, like "0755".
+func ParseSubVolumeGroupMode(mode string) (int, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o7777 {
+		return 0, fmt.Errorf("invalid mode %q for subvolumegroup, needs to be an octal permission", mode)
+	}
+
+	return int(m), nil
+}
+
+// CreateSubVolumeGroup creates the subvolumegroup in the filesystem, when it
+// does not exist yet, and sets its pin policy.
+func (f *fileSystem) CreateSubVolumeGroup(
+	ctx context.Context,
+	fsName, group string,
+	opts *SubVolumeGroupOptions,
+) error {
+	fsa, err := f.conn.GetFSAdmin()
+	if err != nil {
+		log.ErrorLog(ctx, "could not get FSAdmin, can not create subvolumegroup %s: %s", group, err)
+
+		return err
+	}
+
+	groups, err := fsa.ListSubVolumeGroups(fsName)
+	if err != nil {
+		log.ErrorLog(ctx, "could not list subvolumegroups of fs %s: %s", fsName, err)
+
+		return err
+	}
+
+	if slices.Contains(groups, group) {
+		return nil
+	}
+
+	err = fsa.CreateSubVolumeGroup(fsName, group, &fsAdmin.SubVolumeGroupOptions{
+		Uid:  opts.UID,
+		Gid:  opts.GID,
+		Mode: opts.Mode,
+	})
+	if err != nil {
+		log.ErrorLog(ctx, "failed to create subvolumegroup %s in fs %s: %s", group, fsName, err)
+
+		return err
+	}
+	log.DebugLog(ctx, "cephfs: created subvolumegroup %s in fs %s", group, fsName)
+
+	if opts.PinType == "" {
+		return nil
+	}
+
+	_, err = fsa.PinSubVolumeGroup(fsName, group, opts.PinType, opts.PinSetting)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to set %s pin %s on subvolumegroup %s in fs %s: %s",
+			opts.PinType, opts.PinSetting, group, fsName, err)
+
+		return err
+	}
+
+	return nil
+}
@@ -28,9 +28,11 @@ import (
 	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
 	"github.com/ceph/go-ceph/rados"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -49,7 +51,9 @@ var (
 // from fsAdmin.SubVolumeInfo.
 type Subvolume struct {
 	BytesQuota int64
+	BytesUsed  int64
 	Path       string
+	DataPool   string
 	Features   []string
 }
 
@@ -80,11 +84,31 @@ type SubVolumeClient interface {
 	CreateCloneFromSnapshot(ctx context.Context, snap Snapshot) error
 	// CleanupSnapshotFromSubvolume removes the snapshot from the subvolume.
 	CleanupSnapshotFromSubvolume(ctx context.Context, parentVol *SubVolume) error
+	// CancelClone stops the clone of the subvolume.
+	CancelClone(ctx context.Context) error
 
 	// SetAllMetadata set all the metadata from arg parameters on Ssubvolume.
 	SetAllMetadata(parameters map[string]string) error
 	// UnsetAllMetadata unset all the metadata from arg keys on subvolume.
 	UnsetAllMetadata(keys []string) error
+	// SetUserMetadata sets the user metadata on the subvolume, and removes
+	// user metadata that is not in it.
+	SetUserMetadata(metadata map[string]string) error
+	// StoreDEK stores the encrypted DEK of the volume in the metadata of
+	// the subvolume.
+	StoreDEK(dek string) error
+	// FetchDEK returns the encrypted DEK of the volume from the metadata of
+	// the subvolume.
+	FetchDEK() (string, error)
+
+	// PinVolume sets the pin policy of the subvolume.
+	PinVolume(ctx context.Context, pinType, pinSetting string) error
+
+	// AuthorizeVolume gives the cephx user of the tenant access to the
+	// subvolume and returns its key.
+	AuthorizeVolume(ctx context.Context, tenant string) (string, error)
+	// DeauthorizeTenants removes the access of the tenants to the subvolume.
+	DeauthorizeTenants(ctx context.Context) error
 }
 
 // subVolumeClient implements SubVolumeClient interface.
@@ -151,7 +175,10 @@ func (s *subVolumeClient) GetVolumeRootPathCeph(ctx context.Context) (string, er
 }
 
 // GetSubVolumeInfo returns the subvolume information.
-func (s *subVolumeClient) GetSubVolumeInfo(ctx context.Context) (*Subvolume, error) {
+func (s *subVolumeClient) GetSubVolumeInfo(ctx context.Context) (_ *Subvolume, err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.GetSubVolumeInfo", attribute.String("subvolume", s.VolID))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	fsa, err := s.conn.GetFSAdmin()
 	if err != nil {
 		log.ErrorLog(ctx, "could not get FSAdmin, can not fetch metadata pool for %s:", s.FsName, err)
@@ -176,8 +203,10 @@ func (s *subVolumeClient) GetSubVolumeInfo(ctx context.Context) (*Subvolume, err
 
 	subvol := Subvolume{
 		// only set BytesQuota when it is of type ByteCount
-		Path:     info.Path,
-		Features: make([]string, len(info.Features)),
+		Path:      info.Path,
+		BytesUsed: int64(info.BytesUsed),
+		DataPool:  info.DataPool,
+		Features:  make([]string, len(info.Features)),
 	}
 	bc, ok := info.BytesQuota.(fsAdmin.ByteCount)
 	if !ok {
@@ -222,7 +251,16 @@ func newLocalClusterState(clusterID string) {
 }
 
 // CreateVolume creates a subvolume.
-func (s *subVolumeClient) CreateVolume(ctx context.Context) error {
+func (s *subVolumeClient) CreateVolume(ctx context.Context) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.CreateVolume", attribute.String("subvolume", s.VolID))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, s.clusterID, util.CreateOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	newLocalClusterState(s.clusterID)
 
 	ca, err := s.conn.GetFSAdmin()
@@ -252,7 +290,10 @@ func (s *subVolumeClient) CreateVolume(ctx context.Context) error {
 
 // ExpandVolume will expand the volume if the requested size is greater than
 // the subvolume size.
-func (s *subVolumeClient) ExpandVolume(ctx context.Context, bytesQuota int64) error {
+func (s *subVolumeClient) ExpandVolume(ctx context.Context, bytesQuota int64) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.ExpandVolume", attribute.String("subvolume", s.VolID))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// get the subvolume size for comparison with the requested size.
 	info, err := s.GetSubVolumeInfo(ctx)
 	if err != nil {
@@ -267,9 +308,29 @@ func (s *subVolumeClient) ExpandVolume(ctx context.Context, bytesQuota int64) er
 	return err
 }
 
+// ValidateShrink returns ErrShrinkBelowUsage when the quota of the subvolume
+// can not be reduced to bytesQuota, because more bytes are in use. Requests
+// that do not shrink the subvolume are always valid.
+func ValidateShrink(volID string, info *Subvolume, bytesQuota int64) error {
+	// subvolumes without quota are not shrunk, the quota gets set
+	if info.BytesQuota == 0 || bytesQuota >= info.BytesQuota {
+		return nil
+	}
+
+	if bytesQuota < info.BytesUsed {
+		return fmt.Errorf("%w: subvolume %s has a quota of %d bytes and uses %d bytes, %d bytes requested",
+			cerrors.ErrShrinkBelowUsage, volID, info.BytesQuota, info.BytesUsed, bytesQuota)
+	}
+
+	return nil
+}
+
 // ResizeVolume will use the ceph fs subvolume resize command to resize the
-// subvolume.
-func (s *subVolumeClient) ResizeVolume(ctx context.Context, bytesQuota int64) error {
+// subvolume. The subvolume can be shrunk, but not below the used bytes.
+func (s *subVolumeClient) ResizeVolume(ctx context.Context, bytesQuota int64) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.ResizeVolume", attribute.String("subvolume", s.VolID))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	fsa, err := s.conn.GetFSAdmin()
 	if err != nil {
 		log.ErrorLog(ctx, "could not get FSAdmin, can not resize volume %s:", s.FsName, err)
@@ -285,7 +346,16 @@ func (s *subVolumeClient) ResizeVolume(ctx context.Context, bytesQuota int64) er
 }
 
 // PurgSubVolume removes the subvolume.
-func (s *subVolumeClient) PurgeVolume(ctx context.Context, force bool) error {
+func (s *subVolumeClient) PurgeVolume(ctx context.Context, force bool) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.PurgeVolume", attribute.String("subvolume", s.VolID))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, s.clusterID, util.DeleteOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	fsa, err := s.conn.GetFSAdmin()
 	if err != nil {
 		log.ErrorLog(ctx, "could not get FSAdmin %s:", err)
@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateShrink(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		info       Subvolume
+		bytesQuota int64
+		wantErr    bool
+	}{
+		{
+			name:       "expand",
+			info:       Subvolume{BytesQuota: 1024, BytesUsed: 512},
+			bytesQuota: 2048,
+		},
+		{
+			name:       "no quota",
+			info:       Subvolume{BytesUsed: 4096},
+			bytesQuota: 2048,
+		},
+		{
+			name:       "shrink above usage",
+			info:       Subvolume{BytesQuota: 4096, BytesUsed: 1024},
+			bytesQuota: 2048,
+		},
+		{
+			name:       "shrink to usage",
+			info:       Subvolume{BytesQuota: 4096, BytesUsed: 2048},
+			bytesQuota: 2048,
+		},
+		{
+			name:       "shrink below usage",
+			info:       Subvolume{BytesQuota: 4096, BytesUsed: 3072},
+			bytesQuota: 2048,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := ValidateShrink("csi-vol-1", &tt.info, tt.bytesQuota)
+			if tt.wantErr {
+				require.ErrorIs(t, err, cerrors.ErrShrinkBelowUsage)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
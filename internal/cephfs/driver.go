@@ -17,6 +17,7 @@ limitations under the License.
 package cephfs
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/ceph/ceph-csi/internal/cephfs/mounter"
@@ -32,6 +33,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/util/log"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Driver contains the default identity,node and controller struct.
@@ -61,9 +63,9 @@ func NewIdentityServer(d *csicommon.CSIDriver) *IdentityServer {
 func NewControllerServer(d *csicommon.CSIDriver) *ControllerServer {
 	return &ControllerServer{
 		DefaultControllerServer: csicommon.NewDefaultControllerServer(d),
-		VolumeLocks:             util.NewVolumeLocks(),
-		SnapshotLocks:           util.NewVolumeLocks(),
-		VolumeGroupLocks:        util.NewVolumeLocks(),
+		VolumeLocks:             util.NewNamedVolumeLocks("volume"),
+		SnapshotLocks:           util.NewNamedVolumeLocks("snapshot"),
+		VolumeGroupLocks:        util.NewNamedVolumeLocks("volumegroup"),
 		OperationLocks:          util.NewOperationLock(),
 	}
 }
@@ -79,7 +81,7 @@ func NewNodeServer(
 	cliReadAffinityMapOptions := util.ConstructReadAffinityMapOption(crushLocationMap)
 	ns := &NodeServer{
 		DefaultNodeServer:  csicommon.NewDefaultNodeServer(d, t, cliReadAffinityMapOptions, topology, nodeLabels),
-		VolumeLocks:        util.NewVolumeLocks(),
+		VolumeLocks:        util.NewNamedVolumeLocks("node"),
 		kernelMountOptions: kernelMountOptions,
 		fuseMountOptions:   fuseMountOptions,
 		healthChecker:      hc.NewHealthCheckManager(),
@@ -96,6 +98,9 @@ func (fs *Driver) Run(conf *util.Config) {
 		nodeLabels, topology, crushLocationMap map[string]string
 	)
 
+	// load the CSI configuration and reload it when it changes
+	go util.WatchCSIConfig(context.Background(), util.CsiConfigFile)
+
 	// Configuration
 	if err = mounter.LoadAvailableMounters(conf); err != nil {
 		log.FatalLogMsg("cephfs: failed to load ceph mounters: %v", err)
@@ -139,6 +144,12 @@ func (fs *Driver) Run(conf *util.Config) {
 			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
 			csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+			csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+			csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+			csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+			csi.ControllerServiceCapability_RPC_GET_VOLUME,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
 		})
 
 		fs.cd.AddVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
@@ -166,12 +177,25 @@ func (fs *Driver) Run(conf *util.Config) {
 			conf.KernelMountOptions, conf.FuseMountOptions,
 			nodeLabels, topology, crushLocationMap,
 		)
+		fs.ns.kernelMountRecovery = conf.KernelMountRecovery
+		fs.ns.volumeMountGroup = conf.VolumeMountGroup
+		if conf.MaxVolumesPerNode < 0 {
+			// CephFS volumes do not use devices of the node
+			log.WarningLogMsg("the maximum number of volumes per node is not computed for CephFS, it is unlimited")
+		} else {
+			fs.ns.MaxVolumesPerNode = conf.MaxVolumesPerNode
+		}
 	}
 
 	if conf.IsControllerServer {
 		fs.cs = NewControllerServer(fs.cd)
 		fs.cs.ClusterName = conf.ClusterName
 		fs.cs.SetMetadata = conf.SetMetadata
+		fs.cs.ReservationLock = conf.ReservationLock
+		fs.cs.AsyncDelete = conf.AsyncDelete
+		if conf.AsyncDelete {
+			go fs.cs.ResumeVolumeRemovals(context.Background())
+		}
 	}
 	if !conf.IsControllerServer && !conf.IsNodeServer {
 		topology, err = util.GetTopologyFromDomainLabels(conf.DomainLabels, conf.NodeID, conf.DriverName)
@@ -183,6 +207,8 @@ func (fs *Driver) Run(conf *util.Config) {
 			conf.KernelMountOptions, conf.FuseMountOptions,
 			nodeLabels, topology, crushLocationMap,
 		)
+		fs.ns.kernelMountRecovery = conf.KernelMountRecovery
+		fs.ns.volumeMountGroup = conf.VolumeMountGroup
 		fs.cs = NewControllerServer(fs.cd)
 	}
 
@@ -201,13 +227,29 @@ func (fs *Driver) Run(conf *util.Config) {
 	}
 	server.Start(conf.Endpoint, srv, csicommon.MiddlewareServerOptionConfig{
 		LogSlowOpInterval: conf.LogSlowOpInterval,
+		MaxNodeRPCs:       conf.MaxNodeRPCs,
+		MaxControllerRPCs: conf.MaxControllerRPCs,
+		RPCTimeouts:       conf.RPCTimeouts,
 	})
 
-	if conf.EnableProfiling {
+	if conf.EnableProfiling || conf.EnableMetrics {
+		if fs.ns != nil {
+			// export the health of the volumes that are checked
+			prometheus.MustRegister(fs.ns.healthChecker)
+		}
 		go util.StartMetricsServer(conf)
+	}
+	if conf.EnableProfiling {
 		log.DebugLogMsg("Registering profiling handler")
 		go util.EnableProfiling()
 	}
+
+	if fs.ns != nil {
+		csicommon.OnDrain(func(context.Context) {
+			fs.ns.healthChecker.StopAll()
+		})
+	}
+	go csicommon.StopOnSignal(server, conf.DrainTimeout)
 	server.Wait()
 }
 
@@ -229,6 +271,9 @@ func (fs *Driver) setupCSIAddonsServer(conf *util.Config) error {
 	if conf.IsControllerServer {
 		fcs := casceph.NewFenceControllerServer()
 		fs.cas.RegisterService(fcs)
+
+		vqs := casceph.NewVolumeQuiesceServer(fs.cs.VolumeGroupLocks)
+		fs.cas.RegisterService(vqs)
 	}
 
 	// start the server, this does not block, it runs a new go-routine
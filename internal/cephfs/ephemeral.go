@@ -0,0 +1,237 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/cephfs/mounter"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ephemeralContextKey is set to "true" by kubelet in the volume context
+	// of generic ephemeral inline volumes.
+	ephemeralContextKey = "csi.storage.k8s.io/ephemeral"
+	// ephemeralSubvolumePrefix is the prefix of the subvolumes that back
+	// generic ephemeral inline volumes.
+	ephemeralSubvolumePrefix = "csi-ephemeral-"
+)
+
+// isEphemeralVolume returns true when the volume context is of a generic
+// ephemeral inline volume.
+func isEphemeralVolume(volContext map[string]string) bool {
+	return volContext[ephemeralContextKey] == "true"
+}
+
+// ephemeralSubvolumeName returns the name of the subvolume for the inline
+// volume. Kubelet generates volume IDs in the form `csi-<hash>`, these are
+// unique per Pod and volume.
+func ephemeralSubvolumeName(volID string) string {
+	return ephemeralSubvolumePrefix + strings.TrimPrefix(volID, "csi-")
+}
+
+// publishEphemeralVolume creates a subvolume for a generic ephemeral inline
+// volume and mounts it on the target path. Inline volumes are not staged, the
+// subvolume is mounted directly. The subvolume is recorded in the
+// EphemeralMountinfo so that NodeUnpublishVolume can remove it again.
+func (ns *NodeServer) publishEphemeralVolume(
+	ctx context.Context,
+	req *csi.NodePublishVolumeRequest,
+) (*csi.NodePublishVolumeResponse, error) {
+	volID := fsutil.VolumeID(req.GetVolumeId())
+	targetPath := req.GetTargetPath()
+	volCap := req.GetVolumeCapability()
+
+	switch {
+	case volCap == nil:
+		return nil, status.Error(codes.InvalidArgument, "volume capability missing in request")
+	case volID == "":
+		return nil, status.Error(codes.InvalidArgument, "volume ID missing in request")
+	case targetPath == "":
+		return nil, status.Error(codes.InvalidArgument, "target path missing in request")
+	case req.GetReadonly():
+		return nil, status.Error(codes.InvalidArgument, "read-only ephemeral volumes are not supported")
+	}
+
+	token, acquired := ns.VolumeLocks.TryAcquire(targetPath)
+	if !acquired {
+		log.ErrorLog(ctx, util.TargetPathOperationAlreadyExistsFmt, targetPath)
+
+		return nil, status.Errorf(codes.Aborted, util.TargetPathOperationAlreadyExistsFmt, targetPath)
+	}
+	defer ns.VolumeLocks.Release(targetPath, token)
+
+	volOptions, err := store.NewEphemeralVolumeOptions(ephemeralSubvolumeName(string(volID)), req.GetVolumeContext())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer volOptions.Destroy()
+
+	isMnt, err := util.IsMountPoint(ns.Mounter, targetPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.ErrorLog(ctx, "stat failed: %v", err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if isMnt {
+		log.DebugLog(ctx, "cephfs: ephemeral volume %s is already mounted to %s", volID, targetPath)
+
+		return &csi.NodePublishVolumeResponse{}, nil
+	}
+
+	cr, err := util.NewAdminCredentials(req.GetSecrets())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	if err = volOptions.Connect(cr); err != nil {
+		log.ErrorLog(ctx, "failed to connect to cluster %s: %v", volOptions.ClusterID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// record the subvolume before it is created, so that it is removed on
+	// NodeUnpublishVolume even if the plugin restarts in between
+	err = fsutil.WriteEphemeralMountinfo(volID, &fsutil.EphemeralMountinfo{
+		ClusterID:      volOptions.ClusterID,
+		FsName:         volOptions.FsName,
+		SubvolumeGroup: volOptions.SubvolumeGroup,
+		SubvolumeName:  volOptions.VolID,
+		Secrets:        req.GetSecrets(),
+	})
+	if err != nil {
+		log.ErrorLog(ctx, "cephfs: failed to write EphemeralMountinfo for volume %s: %v", volID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	volClient := core.NewSubVolume(volOptions.GetConnection(), &volOptions.SubVolume, volOptions.ClusterID, "", false)
+	if err = volClient.CreateVolume(ctx); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if rmErr := removeEphemeralVolume(ctx, volID); rmErr != nil {
+			log.ErrorLog(ctx, "failed to remove subvolume %s of ephemeral volume %s: %v",
+				volOptions.VolID, volID, rmErr)
+		}
+	}()
+
+	volOptions.RootPath, err = volClient.GetVolumeRootPathCeph(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	mnt, err := mounter.New(volOptions)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to create mounter for volume %s: %v", volID, err.Error())
+	}
+
+	if err = util.CreateMountPoint(targetPath); err != nil {
+		log.ErrorLog(ctx, "failed to create mount point at %s: %v", targetPath, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if err = ns.mount(ctx, mnt, volOptions, volID, targetPath, req.GetSecrets(), volCap); err != nil {
+		return nil, err
+	}
+
+	log.DebugLog(ctx, "cephfs: successfully mounted ephemeral volume %s to %s", volID, targetPath)
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// unpublishEphemeralVolume removes the subvolume of a generic ephemeral inline
+// volume once it is unmounted from the target path.
+func (ns *NodeServer) unpublishEphemeralVolume(
+	ctx context.Context,
+	volID string,
+) (*csi.NodeUnpublishVolumeResponse, error) {
+	if err := removeEphemeralVolume(ctx, fsutil.VolumeID(volID)); err != nil {
+		log.ErrorLog(ctx, "failed to remove ephemeral volume %s: %v", volID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
+
+// removeEphemeralVolume removes the subvolume of a generic ephemeral inline
+// volume and its EphemeralMountinfo. Volumes without EphemeralMountinfo are
+// not ephemeral, nothing is done for them.
+func removeEphemeralVolume(ctx context.Context, volID fsutil.VolumeID) error {
+	mi, err := fsutil.GetEphemeralMountinfo(volID)
+	if err != nil {
+		return err
+	}
+
+	if mi == nil {
+		return nil
+	}
+
+	monitors, err := util.Mons(util.CsiConfigFile, mi.ClusterID)
+	if err != nil {
+		return err
+	}
+
+	cr, err := util.NewAdminCredentials(mi.Secrets)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	conn := &util.ClusterConnection{}
+	if err = conn.Connect(monitors, cr); err != nil {
+		return err
+	}
+	defer conn.Destroy()
+
+	subVolume := &core.SubVolume{
+		VolID:          mi.SubvolumeName,
+		FsName:         mi.FsName,
+		SubvolumeGroup: mi.SubvolumeGroup,
+	}
+	volClient := core.NewSubVolume(conn, subVolume, mi.ClusterID, "", false)
+	err = volClient.PurgeVolume(ctx, true)
+	if err != nil && !errors.Is(err, cerrors.ErrVolumeNotFound) {
+		return err
+	}
+
+	log.DebugLog(ctx, "cephfs: removed subvolume %s of ephemeral volume %s", mi.SubvolumeName, volID)
+
+	return fsutil.RemoveEphemeralMountinfo(volID)
+}
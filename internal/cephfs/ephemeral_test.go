@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsEphemeralVolume(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		volContext map[string]string
+		want       bool
+	}{
+		{
+			name:       "inline volume",
+			volContext: map[string]string{ephemeralContextKey: "true", "clusterID": "cluster-1"},
+			want:       true,
+		},
+		{
+			name:       "persistent volume",
+			volContext: map[string]string{ephemeralContextKey: "false", "clusterID": "cluster-1"},
+			want:       false,
+		},
+		{
+			name:       "without ephemeral key",
+			volContext: map[string]string{"clusterID": "cluster-1"},
+			want:       false,
+		},
+		{
+			name:       "nil context",
+			volContext: nil,
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, isEphemeralVolume(tt.volContext))
+		})
+	}
+}
+
+func TestEphemeralSubvolumeName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		volID string
+		want  string
+	}{
+		{
+			name:  "kubelet volume ID",
+			volID: "csi-8e1bd0c1b3a94a7bf5c06d4f8e5a2a1b",
+			want:  "csi-ephemeral-8e1bd0c1b3a94a7bf5c06d4f8e5a2a1b",
+		},
+		{
+			name:  "volume ID without prefix",
+			volID: "8e1bd0c1b3a94a7bf5c06d4f8e5a2a1b",
+			want:  "csi-ephemeral-8e1bd0c1b3a94a7bf5c06d4f8e5a2a1b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, ephemeralSubvolumeName(tt.volID))
+		})
+	}
+}
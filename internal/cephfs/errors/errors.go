@@ -61,6 +61,10 @@ var (
 
 	// ErrQuiesceInProgress is returned when quiesce operation is in progress.
 	ErrQuiesceInProgress = coreError.New("quiesce operation is in progress")
+
+	// ErrShrinkBelowUsage is returned when the quota of a subvolume would be
+	// reduced below the bytes that are in use.
+	ErrShrinkBelowUsage = coreError.New("requested size is smaller than the used bytes")
 )
 
 // IsCloneRetryError returns true if the clone error is pending,in-progress
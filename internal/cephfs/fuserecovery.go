@@ -134,6 +134,10 @@ func (ns *NodeServer) tryRestoreFuseMountsInNodePublish(
 		return err
 	}
 
+	if _, err = ns.selectMounter(ctx, volID, volOptions, nsMountinfo.VolumeCapability); err != nil {
+		return err
+	}
+
 	volMounter, err = mounter.New(volOptions)
 	if err != nil {
 		return err
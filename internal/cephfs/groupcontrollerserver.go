@@ -86,16 +86,17 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 
 	requestName := req.GetName()
 	// Existence and conflict checks
-	if acquired := cs.VolumeGroupLocks.TryAcquire(requestName); !acquired {
+	token, acquired := cs.VolumeGroupLocks.TryAcquire(requestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, requestName)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, requestName)
 	}
-	defer cs.VolumeGroupLocks.Release(requestName)
+	defer cs.VolumeGroupLocks.Release(requestName, token)
 
 	cr, err := util.NewAdminCredentials(req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
@@ -103,7 +104,7 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get volume group options: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer vg.Destroy()
 
@@ -111,17 +112,18 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to check volume group snapshot exists: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// Get the fs names and subvolume from the volume ids to execute quiesce commands.
-	fsMap, err := getFsNamesAndSubVolumeFromVolumeIDs(ctx, req.GetSecrets(), req.GetSourceVolumeIds(), cr)
+	fsMap, err := store.GetFSQuiesceClients(ctx, req.GetSecrets(), req.GetSourceVolumeIds(), cr,
+		core.DefaultQuiesceExpiration)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get fs names and subvolume from volume ids: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
-	defer destroyFSConnections(fsMap)
+	defer store.DestroyFSQuiesceClients(fsMap)
 
 	needRelease := checkIfFSNeedQuiesceRelease(vgs, req.GetSourceVolumeIds())
 	if needRelease {
@@ -134,7 +136,7 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 		if err != nil {
 			log.ErrorLog(ctx, "failed to reserve volume group: %v", err)
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -148,7 +150,7 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 			}
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if inProgress {
@@ -167,7 +169,7 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 			}
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	response := &csi.CreateVolumeGroupSnapshotResponse{}
@@ -510,90 +512,6 @@ func getClusterIDForVolumeID(fms map[string]core.FSQuiesceClient, volumeID strin
 	return ""
 }
 
-// getFsNamesAndSubVolumeFromVolumeIDs gets the filesystem names and subvolumes
-// from the volumeIDs present in the CreateVolumeGroupSnapshotRequest. It also
-// returns the SubVolumeQuiesceClient for the filesystems present in the
-// volumeIDs.
-func getFsNamesAndSubVolumeFromVolumeIDs(ctx context.Context,
-	secret map[string]string,
-	volIDs []string,
-	cr *util.Credentials) (
-	map[string]core.FSQuiesceClient,
-	error,
-) {
-	type fs struct {
-		fsName                string
-		volumes               []core.Volume
-		subVolumeGroupMapping map[string][]string
-		monitors              string
-	}
-	fm := make(map[string]fs, 0)
-	for _, volID := range volIDs {
-		// Find the volume using the provided VolumeID
-		volOptions, _, err := store.NewVolumeOptionsFromVolID(ctx,
-			volID, nil, secret, "", false)
-		if err != nil {
-			return nil, err
-		}
-		volOptions.Destroy()
-		// choosing monitorIP's and fsName as the unique key
-		// TODO: Need to use something else as the unique key as users can
-		// still choose the different monitorIP's and fsName for subvolumes
-		uniqueName := volOptions.Monitors + volOptions.FsName
-		if _, ok := fm[uniqueName]; !ok {
-			fm[uniqueName] = fs{
-				fsName:                volOptions.FsName,
-				volumes:               make([]core.Volume, 0),
-				subVolumeGroupMapping: make(map[string][]string), // Initialize the map
-				monitors:              volOptions.Monitors,
-			}
-		}
-		a := core.Volume{
-			VolumeID:  volID,
-			ClusterID: volOptions.ClusterID,
-		}
-		// Retrieve the value, modify it, and assign it back
-		val := fm[uniqueName]
-		val.volumes = append(val.volumes, a)
-		existingVolIDInMap := val.subVolumeGroupMapping[volOptions.SubVolume.SubvolumeGroup]
-		val.subVolumeGroupMapping[volOptions.SubVolume.SubvolumeGroup] = append(
-			existingVolIDInMap,
-			volOptions.SubVolume.VolID)
-		fm[uniqueName] = val
-	}
-	fsk := map[string]core.FSQuiesceClient{}
-	var err error
-	defer func() {
-		if err != nil {
-			destroyFSConnections(fsk)
-		}
-	}()
-	for k, v := range fm {
-		conn := &util.ClusterConnection{}
-		if err = conn.Connect(v.monitors, cr); err != nil {
-			return nil, err
-		}
-		fsk[k], err = core.NewFSQuiesce(v.fsName, v.volumes, v.subVolumeGroupMapping, conn)
-		if err != nil {
-			log.ErrorLog(ctx, "failed to get subvolume quiesce: %v", err)
-			conn.Destroy()
-
-			return nil, err
-		}
-	}
-
-	return fsk, nil
-}
-
-// destroyFSConnections destroys connections of all FSQuiesceClient.
-func destroyFSConnections(fsMap map[string]core.FSQuiesceClient) {
-	for _, fm := range fsMap {
-		if fm != nil {
-			fm.Destroy()
-		}
-	}
-}
-
 // matchesSourceVolumeIDs checks if the sourceVolumeIDs and volumeIDsInOMap are
 // equal.
 func matchesSourceVolumeIDs(sourceVolumeIDs, volumeIDsInOMap []string) bool {
@@ -706,16 +624,17 @@ func (cs *ControllerServer) DeleteVolumeGroupSnapshot(ctx context.Context,
 
 	groupSnapshotID := req.GetGroupSnapshotId()
 	// Existence and conflict checks
-	if acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID); !acquired {
+	token, acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
 	}
-	defer cs.VolumeGroupLocks.Release(groupSnapshotID)
+	defer cs.VolumeGroupLocks.Release(groupSnapshotID, token)
 
 	cr, err := util.NewAdminCredentials(req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
@@ -724,7 +643,7 @@ func (cs *ControllerServer) DeleteVolumeGroupSnapshot(ctx context.Context,
 		log.ErrorLog(ctx, "failed to get volume group options: %v", err)
 		err = extractDeleteVolumeGroupError(err)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
@@ -732,26 +651,26 @@ func (cs *ControllerServer) DeleteVolumeGroupSnapshot(ctx context.Context,
 	vgo.Destroy()
 
 	volIds := vgsi.GetVolumeIDs()
-	fsMap, err := getFsNamesAndSubVolumeFromVolumeIDs(ctx, req.GetSecrets(), volIds, cr)
+	fsMap, err := store.GetFSQuiesceClients(ctx, req.GetSecrets(), volIds, cr, core.DefaultQuiesceExpiration)
 	err = extractDeleteVolumeGroupError(err)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get volume group options: %v", err)
 		err = extractDeleteVolumeGroupError(err)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
 	}
 
-	defer destroyFSConnections(fsMap)
+	defer store.DestroyFSQuiesceClients(fsMap)
 
 	err = cs.deleteSnapshotsAndUndoReservation(ctx, vgsi, cr, fsMap, req.GetSecrets())
 	if err != nil {
 		log.ErrorLog(ctx, "failed to delete snapshot and undo reservation: %v", err)
 		err = extractDeleteVolumeGroupError(err)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		return &csi.DeleteVolumeGroupSnapshotResponse{}, nil
@@ -778,3 +697,112 @@ func extractDeleteVolumeGroupError(err error) error {
 
 	return err
 }
+
+// validateVolumeGroupSnapshotGetRequest validates the request for getting a
+// group snapshot of volumes.
+func (cs *ControllerServer) validateVolumeGroupSnapshotGetRequest(
+	ctx context.Context,
+	req *csi.GetVolumeGroupSnapshotRequest,
+) error {
+	if err := cs.Driver.ValidateGroupControllerServiceRequest(
+		csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT); err != nil {
+		log.ErrorLog(ctx, "invalid get volume group snapshot req: %v", protosanitizer.StripSecrets(req))
+
+		return err
+	}
+
+	if req.GetGroupSnapshotId() == "" {
+		return status.Error(codes.InvalidArgument, "volume group snapshot id cannot be empty")
+	}
+
+	return nil
+}
+
+// GetVolumeGroupSnapshot returns the group snapshot with the snapshots of
+// the subvolumes that are recorded in the volume group journal. The
+// snapshots can be used to restore the subvolumes of the group.
+func (cs *ControllerServer) GetVolumeGroupSnapshot(
+	ctx context.Context,
+	req *csi.GetVolumeGroupSnapshotRequest,
+) (*csi.GetVolumeGroupSnapshotResponse, error) {
+	if err := cs.validateVolumeGroupSnapshotGetRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	groupSnapshotID := req.GetGroupSnapshotId()
+	// Existence and conflict checks
+	token, acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID)
+	if !acquired {
+		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
+
+		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
+	}
+	defer cs.VolumeGroupLocks.Release(groupSnapshotID, token)
+
+	cr, err := util.NewAdminCredentials(req.GetSecrets())
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+	defer cr.DeleteCredentials()
+
+	vgo, vgsi, err := store.NewVolumeGroupOptionsFromID(ctx, groupSnapshotID, cr)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get volume group options: %v", err)
+		if extractDeleteVolumeGroupError(err) == nil {
+			return nil, status.Errorf(codes.NotFound, "volume group snapshot %s not found: %v",
+				groupSnapshotID, err)
+		}
+
+		return nil, util.GRPCError(err)
+	}
+	vgo.Destroy()
+
+	groupSnapshot := &csi.VolumeGroupSnapshot{
+		GroupSnapshotId: groupSnapshotID,
+		ReadyToUse:      true,
+	}
+
+	// return the snapshots in a stable order
+	volIDs := vgsi.GetVolumeIDs()
+	sort.Strings(volIDs)
+
+	for _, volID := range volIDs {
+		snapID := vgsi.VolumeSnapshotMap[volID]
+		var (
+			volOptions *store.VolumeOptions
+			info       *core.SnapshotInfo
+		)
+		volOptions, info, _, err = store.NewSnapshotOptionsFromID(ctx, snapID, cr, req.GetSecrets(),
+			cs.ClusterName, cs.SetMetadata)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get snapshot %s of volume %s: %v", snapID, volID, err)
+			if errors.Is(err, cerrors.ErrSnapNotFound) || errors.Is(err, util.ErrKeyNotFound) {
+				return nil, status.Errorf(codes.NotFound, "snapshot %s of volume group snapshot %s not found: %v",
+					snapID, groupSnapshotID, err)
+			}
+
+			return nil, util.GRPCError(err)
+		}
+		volOptions.Destroy()
+
+		// the group snapshot was created when the first of the snapshots
+		// was taken
+		if groupSnapshot.GetCreationTime() == nil ||
+			info.CreationTime.AsTime().Before(groupSnapshot.GetCreationTime().AsTime()) {
+			groupSnapshot.CreationTime = info.CreationTime
+		}
+
+		groupSnapshot.Snapshots = append(groupSnapshot.Snapshots, &csi.Snapshot{
+			SizeBytes:       volOptions.Size,
+			SnapshotId:      snapID,
+			SourceVolumeId:  volID,
+			CreationTime:    info.CreationTime,
+			ReadyToUse:      true,
+			GroupSnapshotId: groupSnapshotID,
+		})
+	}
+
+	return &csi.GetVolumeGroupSnapshotResponse{
+		GroupSnapshot: groupSnapshot,
+	}, nil
+}
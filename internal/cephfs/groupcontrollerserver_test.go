@@ -118,3 +118,53 @@ func TestControllerServer_validateCreateVolumeGroupSnapshotRequest(t *testing.T)
 		})
 	}
 }
+
+func TestControllerServer_validateVolumeGroupSnapshotGetRequest(t *testing.T) {
+	t.Parallel()
+	cs := ControllerServer{
+		DefaultControllerServer: csicommon.NewDefaultControllerServer(
+			csicommon.NewCSIDriver("cephfs.csi.ceph.com", "1.0.0", "test", "default")),
+	}
+	cs.Driver.AddGroupControllerServiceCapabilities([]csi.GroupControllerServiceCapability_RPC_Type{
+		csi.GroupControllerServiceCapability_RPC_CREATE_DELETE_GET_VOLUME_GROUP_SNAPSHOT,
+	})
+
+	tests := []struct {
+		name    string
+		req     *csi.GetVolumeGroupSnapshotRequest
+		wantErr bool
+		code    codes.Code
+	}{
+		{
+			"valid GetVolumeGroupSnapshotRequest",
+			&csi.GetVolumeGroupSnapshotRequest{
+				GroupSnapshotId: "vg-snap-1",
+			},
+			false,
+			codes.OK,
+		},
+		{
+			"empty GroupSnapshotId in GetVolumeGroupSnapshotRequest",
+			&csi.GetVolumeGroupSnapshotRequest{},
+			true,
+			codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := cs.validateVolumeGroupSnapshotGetRequest(context.Background(), tt.req)
+			if tt.wantErr {
+				c := status.Code(err)
+				if c != tt.code {
+					t.Errorf("ControllerServer.validateVolumeGroupSnapshotGetRequest() error = %v, want code %v", err, c)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Errorf("ControllerServer.validateVolumeGroupSnapshotGetRequest() unexpected error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/mounter"
+	hc "github.com/ceph/ceph-csi/internal/health-checker"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// recoverSessionClean is the kernel mount option that makes the client
+// reconnect automatically after it was blocklisted. Dirty data and file locks
+// are dropped on reconnect.
+const recoverSessionClean = "recover_session=clean"
+
+// tryRestoreKernelMountInNodeStage unmounts the kernel mount of the staging
+// target path when it went stale, for example because the client was evicted
+// and blocklisted by the MDS. The mount is detected as stale when the stat
+// health-checker of the volume reported a stale mount error, or when the
+// mountpoint is corrupted. NodeStageVolume mounts the volume again afterwards.
+func (ns *NodeServer) tryRestoreKernelMountInNodeStage(
+	ctx context.Context,
+	volID string,
+	stagingTargetPath string,
+) error {
+	stagingTargetMs, err := ns.getMountState(stagingTargetPath)
+	if err != nil {
+		return err
+	}
+
+	healthy, hcErr := ns.healthChecker.IsHealthy(volID, stagingTargetPath)
+	if stagingTargetMs != msCorrupted && (healthy || !hc.IsStaleMountError(hcErr)) {
+		// Mount seems to be fine.
+		return nil
+	}
+
+	log.WarningLog(ctx, "cephfs: stale kernel mount detected when staging volume %s: %s is %s (%v); attempting recovery",
+		volID, stagingTargetPath, stagingTargetMs, hcErr)
+
+	// The checker keeps reporting the error of the stale mount, a new one is
+	// started once the volume is mounted again.
+	ns.healthChecker.StopSharedChecker(volID)
+
+	// Force the unmount, requests to the MDS of a blocklisted client do not
+	// return otherwise.
+	return mounter.UnmountVolume(ctx, stagingTargetPath, "-f", "--all-targets")
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// snapSourceAttribute is set in the UUID directory of every reserved
+// snapshot, it contains the name of the subvolume of the snapshot.
+const snapSourceAttribute = "source"
+
+// listJournaled returns the IDs of the volumes or snapshots that are
+// reserved in the journals of all filesystems of the clusters in the CSI
+// configuration, mapped to the value of the attribute in their journal.
+// ListVolumes and ListSnapshots requests do not contain secrets, clusters
+// without provisioner credentials in the CSI configuration are skipped.
+func listJournaled(ctx context.Context, jc *journal.Config, attribute string) (map[string]string, error) {
+	clusterIDs, err := util.ConfiguredClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	reserved := map[string]string{}
+	for _, clusterID := range clusterIDs {
+		secrets, err := configuredProvisionerSecrets(clusterID)
+		if err != nil {
+			log.DebugLog(ctx, "not listing cluster %q: %v", clusterID, err)
+
+			continue
+		}
+
+		fsNames, err := listFsNames(ctx, clusterID, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the filesystems of cluster %q: %w", clusterID, err)
+		}
+
+		for _, fsName := range fsNames {
+			values, err := listReserved(ctx, jc, clusterID, fsName, secrets, attribute)
+			if err != nil {
+				return nil, err
+			}
+
+			for id, value := range values {
+				reserved[id] = value
+			}
+		}
+	}
+
+	return reserved, nil
+}
+
+// listSecrets returns the secrets for the cluster, the secrets of the request
+// or the provisioner credentials of the CSI configuration.
+func listSecrets(clusterID string, secrets map[string]string) (map[string]string, error) {
+	if len(secrets) != 0 {
+		return secrets, nil
+	}
+
+	return configuredProvisionerSecrets(clusterID)
+}
+
+// isRemovedError returns true when the error is returned for a volume or
+// snapshot that was removed while it was listed, or that is not created
+// completely yet.
+func isRemovedError(err error) bool {
+	return errors.Is(err, cerrors.ErrVolumeNotFound) || errors.Is(err, cerrors.ErrSnapNotFound) ||
+		errors.Is(err, cerrors.ErrInvalidVolID) || errors.Is(err, util.ErrKeyNotFound) ||
+		errors.Is(err, util.ErrPoolNotFound)
+}
+
+// paginateError returns the gRPC error for an error of util.Paginate.
+func paginateError(err error) error {
+	if errors.Is(err, util.ErrInvalidStartingToken) {
+		return status.Error(codes.Aborted, err.Error())
+	}
+
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// ListVolumes lists the volumes in the journals of the clusters in the CSI
+// configuration that have provisioner credentials configured.
+func (cs *ControllerServer) ListVolumes(
+	ctx context.Context,
+	req *csi.ListVolumesRequest,
+) (*csi.ListVolumesResponse, error) {
+	volumes, err := listJournaled(ctx, store.VolJournal, subvolumeNameAttribute)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to list volumes: %v", err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	volumeIDs := make([]string, 0, len(volumes))
+	for volumeID := range volumes {
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+
+	page, nextToken, err := util.Paginate(volumeIDs, req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		return nil, paginateError(err)
+	}
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, len(page))
+	for _, volumeID := range page {
+		entry, err := cs.listVolumeEntry(ctx, volumeID)
+		if isRemovedError(err) {
+			log.DebugLog(ctx, "not listing volume %s: %v", volumeID, err)
+
+			continue
+		}
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get volume %s: %v", volumeID, err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// listVolumeEntry returns the entry of the volume for a ListVolumes response.
+// Volumes without subvolume are not listed, ControllerGetVolume reports them.
+func (cs *ControllerServer) listVolumeEntry(
+	ctx context.Context,
+	volumeID string,
+) (*csi.ListVolumesResponse_Entry, error) {
+	secrets, err := configuredProvisionerSecrets(util.GetClusterIDFromVolumeID(volumeID))
+	if err != nil {
+		return nil, err
+	}
+
+	volOptions, _, err := store.NewVolumeOptionsFromVolID(ctx, volumeID, nil, secrets, cs.ClusterName, cs.SetMetadata)
+	if err != nil {
+		return nil, err
+	}
+	defer volOptions.Destroy()
+
+	return &csi.ListVolumesResponse_Entry{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: volOptions.Size,
+		},
+		Status: &csi.ListVolumesResponse_VolumeStatus{
+			VolumeCondition: volumeCondition(volOptions),
+		},
+	}, nil
+}
+
+// ListSnapshots lists the snapshots in the journals of the clusters in the
+// CSI configuration that have provisioner credentials configured, optionally
+// filtered by the snapshot ID or the source volume ID.
+func (cs *ControllerServer) ListSnapshots(
+	ctx context.Context,
+	req *csi.ListSnapshotsRequest,
+) (*csi.ListSnapshotsResponse, error) {
+	var snapshotIDs []string
+	if req.GetSnapshotId() != "" {
+		snapshotIDs = []string{req.GetSnapshotId()}
+	} else {
+		snapshots, err := listJournaled(ctx, store.SnapJournal, snapSourceAttribute)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to list snapshots: %v", err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		for snapshotID, source := range snapshots {
+			if req.GetSourceVolumeId() != "" && req.GetSourceVolumeId() != sourceVolumeID(snapshotID, source) {
+				continue
+			}
+			snapshotIDs = append(snapshotIDs, snapshotID)
+		}
+	}
+
+	page, nextToken, err := util.Paginate(snapshotIDs, req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		return nil, paginateError(err)
+	}
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, len(page))
+	for _, snapshotID := range page {
+		entry, err := cs.listSnapshotEntry(ctx, snapshotID, req.GetSecrets())
+		if errors.Is(err, errNoProvisionerCredentials) {
+			log.DebugLog(ctx, "listing snapshot %s without reading it: %v", snapshotID, err)
+			entry, err = unverifiedSnapshotEntry(snapshotID)
+		}
+		if isRemovedError(err) {
+			log.DebugLog(ctx, "not listing snapshot %s: %v", snapshotID, err)
+
+			continue
+		}
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get snapshot %s: %v", snapshotID, err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		if req.GetSourceVolumeId() != "" && entry.GetSnapshot().GetSourceVolumeId() != req.GetSourceVolumeId() {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// sourceVolumeID returns the ID of the volume that the snapshot was created
+// from, given the name of the subvolume of the volume. It is empty when the
+// name of the subvolume does not contain the UUID of a volume.
+func sourceVolumeID(snapshotID, subvolume string) string {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(snapshotID); err != nil {
+		return ""
+	}
+
+	volUUID, ok := journal.GetUUIDFromName(subvolume)
+	if !ok {
+		return ""
+	}
+
+	vi.ObjectUUID = volUUID
+	volumeID, err := vi.ComposeCSIID()
+	if err != nil {
+		return ""
+	}
+
+	return volumeID
+}
+
+// unverifiedSnapshotEntry returns the entry of a snapshot that can not be
+// read, because there are no credentials for its cluster. The snapshot
+// controller checks pre-provisioned snapshots by their ID, without the
+// snapshotter-list-secret these are reported ready to use as long as the ID
+// can be decoded.
+func unverifiedSnapshotEntry(snapshotID string) (*csi.ListSnapshotsResponse_Entry, error) {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(snapshotID); err != nil {
+		return nil, fmt.Errorf("%w: %w", cerrors.ErrInvalidVolID, err)
+	}
+
+	return &csi.ListSnapshotsResponse_Entry{
+		Snapshot: &csi.Snapshot{
+			SnapshotId: snapshotID,
+			ReadyToUse: true,
+		},
+	}, nil
+}
+
+// listSnapshotEntry returns the entry of the snapshot for a ListSnapshots
+// response.
+func (cs *ControllerServer) listSnapshotEntry(
+	ctx context.Context,
+	snapshotID string,
+	reqSecrets map[string]string,
+) (*csi.ListSnapshotsResponse_Entry, error) {
+	secrets, err := listSecrets(util.GetClusterIDFromVolumeID(snapshotID), reqSecrets)
+	if err != nil {
+		return nil, err
+	}
+
+	cr, err := util.NewAdminCredentials(secrets)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.DeleteCredentials()
+
+	volOptions, info, sid, err := store.NewSnapshotOptionsFromID(ctx, snapshotID, cr, secrets,
+		cs.ClusterName, cs.SetMetadata)
+	if err != nil {
+		return nil, err
+	}
+	defer volOptions.Destroy()
+
+	return &csi.ListSnapshotsResponse_Entry{
+		Snapshot: &csi.Snapshot{
+			SizeBytes:      volOptions.Size,
+			SnapshotId:     snapshotID,
+			SourceVolumeId: sourceVolumeID(snapshotID, sid.FsSubvolName),
+			CreationTime:   timestamppb.New(info.CreatedAt),
+			ReadyToUse:     true,
+		},
+	}, nil
+}
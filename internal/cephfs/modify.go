@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// pinTypeParam is the parameter with the type of the pinning of the
+	// subvolume to MDS ranks.
+	pinTypeParam = "pinType"
+	// pinSettingParam is the parameter with the setting for the pinType.
+	pinSettingParam = "pinSetting"
+)
+
+// ControllerModifyVolume modifies the mutable parameters of an existing
+// subvolume. The pinning of the subvolume is the only parameter that can be
+// modified.
+func (cs *ControllerServer) ControllerModifyVolume(
+	ctx context.Context,
+	req *csi.ControllerModifyVolumeRequest,
+) (*csi.ControllerModifyVolumeResponse, error) {
+	if err := cs.validateModifyVolumeRequest(req); err != nil {
+		log.ErrorLog(ctx, "ControllerModifyVolumeRequest validation failed: %v", err)
+
+		return nil, err
+	}
+
+	volID := req.GetVolumeId()
+	params := req.GetMutableParameters()
+	if len(params) == 0 {
+		return &csi.ControllerModifyVolumeResponse{}, nil
+	}
+
+	token, acquired := cs.VolumeLocks.TryAcquire(volID)
+	if !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
+
+		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
+	}
+	defer cs.VolumeLocks.Release(volID, token)
+
+	volOptions, _, err := store.NewVolumeOptionsFromVolID(ctx, volID, nil, req.GetSecrets(),
+		cs.ClusterName, cs.SetMetadata)
+	if err != nil {
+		log.ErrorLog(ctx, "validation and extraction of volume options failed: %v", err)
+
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer volOptions.Destroy()
+
+	if volOptions.BackingSnapshot {
+		return nil, status.Error(codes.InvalidArgument, "cannot modify snapshot-backed volume")
+	}
+
+	volClient := core.NewSubVolume(volOptions.GetConnection(),
+		&volOptions.SubVolume, volOptions.ClusterID, cs.ClusterName, cs.SetMetadata)
+	err = volClient.PinVolume(ctx, params[pinTypeParam], params[pinSettingParam])
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	log.DebugLog(ctx, "cephfs: modified subvolume %s with parameters %v", volOptions.VolID, params)
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	// mountGroupPolicyParam is the StorageClass parameter that selects how
+	// the volume_mount_group (the fsGroup of the Pod) is applied to the
+	// volume, when the node plugin advertises VOLUME_MOUNT_GROUP.
+	mountGroupPolicyParam = "mountGroupPolicy"
+
+	// mountGroupPolicyRootOnly only changes the group of the root of the
+	// volume. New files and directories inherit the group through the
+	// setgid bit of the root.
+	mountGroupPolicyRootOnly = "RootOnly"
+	// mountGroupPolicyRecursive changes the group of all files and
+	// directories, like Kubelet does.
+	mountGroupPolicyRecursive = "Recursive"
+)
+
+// validateMountGroupPolicy checks the mountGroupPolicy parameter, an empty
+// value selects RootOnly.
+func validateMountGroupPolicy(policy string) error {
+	switch policy {
+	case "", mountGroupPolicyRootOnly, mountGroupPolicyRecursive:
+		return nil
+	}
+
+	return fmt.Errorf("invalid %s %q, supported values are %q and %q",
+		mountGroupPolicyParam, policy, mountGroupPolicyRootOnly, mountGroupPolicyRecursive)
+}
+
+// setMountGroup makes the volume at the path accessible by the group, with
+// the ownership and permissions that Kubelet sets for the fsGroup of a Pod.
+func setMountGroup(path, group, policy string) error {
+	if err := validateMountGroupPolicy(policy); err != nil {
+		return err
+	}
+
+	gid, err := strconv.Atoi(group)
+	if err != nil {
+		return fmt.Errorf("invalid volume mount group %q: %w", group, err)
+	}
+
+	if policy != mountGroupPolicyRecursive {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		return changeGroup(path, info, gid)
+	}
+
+	return filepath.WalkDir(path, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		return changeGroup(name, info, gid)
+	})
+}
+
+// changeGroup sets the group of the file, makes it readable and writable by
+// the group, and sets the setgid bit on directories so that new files get
+// the group as well. Symlinks only get the group.
+func changeGroup(name string, info fs.FileInfo, gid int) error {
+	if err := os.Lchown(name, -1, gid); err != nil {
+		return fmt.Errorf("failed to change the group of %s: %w", name, err)
+	}
+
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+
+	mode := info.Mode() | 0o660
+	if info.IsDir() {
+		mode |= fs.ModeSetgid | 0o110
+	}
+
+	if err := os.Chmod(name, mode); err != nil {
+		return fmt.Errorf("failed to change the permissions of %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// applyVolumeMountGroup applies the volume_mount_group of the request to the
+// volume at the path, with the mountGroupPolicy of the volume. Read-only
+// volumes are not changed, like Kubelet does not change them.
+func (ns *NodeServer) applyVolumeMountGroup(req *csi.NodePublishVolumeRequest, path string) error {
+	volCap := req.GetVolumeCapability()
+	group := volCap.GetMount().GetVolumeMountGroup()
+	if !ns.volumeMountGroup || group == "" || req.GetReadonly() ||
+		csicommon.IsReaderOnly([]*csi.VolumeCapability{volCap}) {
+		return nil
+	}
+
+	return setMountGroup(path, group, req.GetVolumeContext()[mountGroupPolicyParam])
+}
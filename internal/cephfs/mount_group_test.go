@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMountGroupPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{name: "default", policy: ""},
+		{name: "root only", policy: "RootOnly"},
+		{name: "recursive", policy: "Recursive"},
+		{name: "invalid", policy: "OnRootMismatch", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateMountGroupPolicy(tt.policy)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSetMountGroup(t *testing.T) {
+	t.Parallel()
+
+	group := strconv.Itoa(os.Getgid())
+
+	tests := []struct {
+		name         string
+		policy       string
+		wantFileMode fs.FileMode
+	}{
+		{
+			name:         "root only",
+			policy:       "RootOnly",
+			wantFileMode: 0o600,
+		},
+		{
+			name:         "recursive",
+			policy:       "Recursive",
+			wantFileMode: 0o660,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			require.NoError(t, os.Chmod(root, 0o700))
+			file := filepath.Join(root, "data")
+			require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+			require.NoError(t, setMountGroup(root, group, tt.policy))
+
+			info, err := os.Stat(root)
+			require.NoError(t, err)
+			require.Equal(t, fs.ModeDir|fs.ModeSetgid|0o770, info.Mode())
+
+			info, err = os.Stat(file)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantFileMode, info.Mode())
+		})
+	}
+
+	require.Error(t, setMountGroup(t.TempDir(), "users", "RootOnly"))
+}
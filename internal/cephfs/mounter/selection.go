@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// Reasons reported when a mounter is selected for a volume.
+const (
+	// SelectionReasonRequested is used when the volume requests a mounter.
+	SelectionReasonRequested = "requested"
+	// SelectionReasonRecorded is used when the mounter was recorded while
+	// staging the volume earlier.
+	SelectionReasonRecorded = "recorded"
+	// SelectionReasonKernelSupported is used when the kernel client supports
+	// all the mount options of the volume.
+	SelectionReasonKernelSupported = "kernel-options-supported"
+	// SelectionReasonKernelUnsupported is used when the kernel client lacks
+	// support for one of the mount options of the volume.
+	SelectionReasonKernelUnsupported = "kernel-options-unsupported"
+	// SelectionReasonOnlyAvailable is used when a single mounter is available.
+	SelectionReasonOnlyAvailable = "only-available"
+)
+
+// kernelOptionSupport lists the kernel versions that added support for
+// mount options which are not available in every kernel CephFS client.
+//
+//nolint:gomnd // numbers specify Kernel versions.
+var kernelOptionSupport = map[string][]util.KernelVersion{
+	"recover_session":   {{Version: 5, PatchLevel: 4}},
+	"nowsync":           {{Version: 5, PatchLevel: 7}},
+	"wsync":             {{Version: 5, PatchLevel: 7}},
+	"read_from_replica": {{Version: 5, PatchLevel: 8}},
+	"crush_location":    {{Version: 5, PatchLevel: 8}},
+	"ms_mode":           {{Version: 5, PatchLevel: 11}},
+}
+
+// unsupportedKernelOptions contains the mount options from
+// kernelOptionSupport that the running kernel does not support.
+var unsupportedKernelOptions = map[string]bool{}
+
+// probeKernelOptions fills unsupportedKernelOptions for the given kernel
+// release.
+func probeKernelOptions(release string) {
+	for option, versions := range kernelOptionSupport {
+		if !util.CheckKernelSupport(release, versions) {
+			log.DefaultLog("kernel %s does not support the %q mount option", release, option)
+			unsupportedKernelOptions[option] = true
+		}
+	}
+}
+
+// Select picks the mounter for a volume without a requested mounter. The
+// kernel client is preferred, unless it does not support one of the
+// kernelMountOptions and ceph-fuse is available. The name of the mounter and
+// the reason for the selection are returned.
+func Select(kernelMountOptions string) (string, string) {
+	return selectMounter(availableMounters, unsupportedKernelOptions, kernelMountOptions)
+}
+
+func selectMounter(available []string, unsupported map[string]bool, kernelMountOptions string) (string, string) {
+	hasKernel, hasFuse := false, false
+	for _, m := range available {
+		switch m {
+		case volumeMounterKernel:
+			hasKernel = true
+		case volumeMounterFuse:
+			hasFuse = true
+		}
+	}
+
+	switch {
+	case hasKernel && !hasFuse:
+		return volumeMounterKernel, SelectionReasonOnlyAvailable
+	case hasFuse && !hasKernel:
+		return volumeMounterFuse, SelectionReasonOnlyAvailable
+	}
+
+	for _, option := range strings.Split(kernelMountOptions, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(option), "=")
+		if unsupported[name] {
+			return volumeMounterFuse, SelectionReasonKernelUnsupported
+		}
+	}
+
+	return volumeMounterKernel, SelectionReasonKernelSupported
+}
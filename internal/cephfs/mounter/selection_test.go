@@ -0,0 +1,97 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mounter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectMounter(t *testing.T) {
+	t.Parallel()
+
+	both := []string{volumeMounterKernel, volumeMounterFuse}
+	unsupported := map[string]bool{"ms_mode": true, "recover_session": true}
+
+	tests := []struct {
+		name         string
+		available    []string
+		unsupported  map[string]bool
+		mountOptions string
+		wantMounter  string
+		wantReason   string
+	}{
+		{
+			name:         "no options",
+			available:    both,
+			unsupported:  unsupported,
+			mountOptions: "",
+			wantMounter:  volumeMounterKernel,
+			wantReason:   SelectionReasonKernelSupported,
+		},
+		{
+			name:         "supported options",
+			available:    both,
+			unsupported:  unsupported,
+			mountOptions: "noatime,nowsync",
+			wantMounter:  volumeMounterKernel,
+			wantReason:   SelectionReasonKernelSupported,
+		},
+		{
+			name:         "unsupported option with value",
+			available:    both,
+			unsupported:  unsupported,
+			mountOptions: "noatime,ms_mode=secure",
+			wantMounter:  volumeMounterFuse,
+			wantReason:   SelectionReasonKernelUnsupported,
+		},
+		{
+			name:         "unsupported option",
+			available:    both,
+			unsupported:  unsupported,
+			mountOptions: "recover_session=clean",
+			wantMounter:  volumeMounterFuse,
+			wantReason:   SelectionReasonKernelUnsupported,
+		},
+		{
+			name:         "only kernel",
+			available:    []string{volumeMounterKernel},
+			unsupported:  unsupported,
+			mountOptions: "ms_mode=secure",
+			wantMounter:  volumeMounterKernel,
+			wantReason:   SelectionReasonOnlyAvailable,
+		},
+		{
+			name:         "only fuse",
+			available:    []string{volumeMounterFuse},
+			unsupported:  map[string]bool{},
+			mountOptions: "",
+			wantMounter:  volumeMounterFuse,
+			wantReason:   SelectionReasonOnlyAvailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			mounter, reason := selectMounter(tt.available, tt.unsupported, tt.mountOptions)
+			require.Equal(t, tt.wantMounter, mounter)
+			require.Equal(t, tt.wantReason, reason)
+		})
+	}
+}
@@ -78,6 +78,7 @@ func LoadAvailableMounters(conf *util.Config) error {
 		if conf.ForceKernelCephFS || util.CheckKernelSupport(release, quotaSupport) {
 			log.DefaultLog("loaded mounter: %s", volumeMounterKernel)
 			availableMounters = append(availableMounters, volumeMounterKernel)
+			probeKernelOptions(release)
 		} else {
 			log.DefaultLog("kernel version < 4.17 might not support quota feature, hence not loading kernel client")
 		}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/mounter"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// selectMounter sets the mounter of a volume that does not request one. The
+// mounter that was recorded when the volume was staged before is reused, so
+// that a volume keeps its mounter until it is unstaged. Otherwise the kernel
+// mount options of the volume decide between the kernel client and ceph-fuse.
+// The reason for the selection is returned.
+func (ns *NodeServer) selectMounter(
+	ctx context.Context,
+	volID fsutil.VolumeID,
+	volOptions *store.VolumeOptions,
+	volCap *csi.VolumeCapability,
+) (string, error) {
+	if volOptions.Mounter != "" {
+		return mounter.SelectionReasonRequested, nil
+	}
+
+	mi, err := fsutil.GetMounterMountinfo(volID)
+	if err != nil {
+		return "", err
+	}
+	if mi != nil && mi.Mounter != "" {
+		volOptions.Mounter = mi.Mounter
+		log.DebugLog(ctx, "cephfs: using recorded mounter %s for volume %s", mi.Mounter, volID)
+
+		return mounter.SelectionReasonRecorded, nil
+	}
+
+	// resolve the kernel mount options like a kernel mount would, on a
+	// copy so that volOptions is not modified
+	kernelOptions := *volOptions
+	err = ns.setMountOptions(mounter.NewKernelMounter(), &kernelOptions, volCap, util.CsiConfigFile)
+	if err != nil {
+		return "", err
+	}
+
+	var reason string
+	volOptions.Mounter, reason = mounter.Select(kernelOptions.KernelMountOptions)
+	log.DebugLog(ctx, "cephfs: selected mounter %s for volume %s, reason: %s", volOptions.Mounter, volID, reason)
+
+	return reason, nil
+}
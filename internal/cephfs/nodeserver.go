@@ -35,6 +35,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/util/fscrypt"
 	iolock "github.com/ceph/ceph-csi/internal/util/lock"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
@@ -51,6 +52,12 @@ type NodeServer struct {
 	kernelMountOptions string
 	fuseMountOptions   string
 	healthChecker      hc.Manager
+	// kernelMountRecovery enables remounting stale kernel mounts of
+	// blocklisted clients.
+	kernelMountRecovery bool
+	// volumeMountGroup advertises the VOLUME_MOUNT_GROUP capability, the
+	// fsGroup of Pods is applied by the node plugin instead of Kubelet.
+	volumeMountGroup bool
 }
 
 func getCredentialsForVolume(
@@ -62,7 +69,21 @@ func getCredentialsForVolume(
 		cr  *util.Credentials
 	)
 
-	if volOptions.ProvisionVolume {
+	if volOptions.TenantAuthID != "" {
+		// The volume is mounted by the cephx user of its tenant, the
+		// node stage secrets need to be the ones of that user
+
+		cr, err = util.NewUserCredentials(secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tenant credentials from node stage secrets: %w", err)
+		}
+		if cr.ID != volOptions.TenantAuthID {
+			cr.DeleteCredentials()
+
+			return nil, fmt.Errorf("%w: got user %q, volume needs user %q",
+				errTenantCredentialsMismatch, cr.ID, volOptions.TenantAuthID)
+		}
+	} else if volOptions.ProvisionVolume {
 		// The volume is provisioned dynamically, use passed in admin credentials
 
 		cr, err = util.NewAdminCredentials(secrets)
@@ -87,21 +108,30 @@ func (ns *NodeServer) getVolumeOptions(
 	volContext,
 	volSecrets map[string]string,
 ) (*store.VolumeOptions, error) {
+	if volContext[store.TenantAuthIDKey] != "" {
+		volOptions, _, err := store.NewVolumeOptionsFromTenantVolume(string(volID), volContext, volSecrets)
+		if err != nil {
+			return nil, util.GRPCError(err)
+		}
+
+		return volOptions, nil
+	}
+
 	volOptions, _, err := store.NewVolumeOptionsFromVolID(ctx, string(volID), volContext, volSecrets, "", false)
 	if err != nil {
 		if !errors.Is(err, cerrors.ErrInvalidVolID) {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		volOptions, _, err = store.NewVolumeOptionsFromStaticVolume(string(volID), volContext, volSecrets)
 		if err != nil {
 			if !errors.Is(err, cerrors.ErrNonStaticVolume) {
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 
 			volOptions, _, err = store.NewVolumeOptionsFromMonitorList(string(volID), volContext, volSecrets)
 			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 		}
 	}
@@ -212,16 +242,17 @@ func (ns *NodeServer) NodeStageVolume(
 	stagingTargetPath := req.GetStagingTargetPath()
 	volID := fsutil.VolumeID(req.GetVolumeId())
 
-	if acquired := ns.VolumeLocks.TryAcquire(req.GetVolumeId()); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(req.GetVolumeId())
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, req.GetVolumeId())
 	}
-	defer ns.VolumeLocks.Release(req.GetVolumeId())
+	defer ns.VolumeLocks.Release(req.GetVolumeId(), token)
 
 	volOptions, err := ns.getVolumeOptions(ctx, volID, req.GetVolumeContext(), req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer volOptions.Destroy()
 
@@ -233,7 +264,7 @@ func (ns *NodeServer) NodeStageVolume(
 			util.CsiConfigFile,
 			volOptions.ClusterID)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -243,16 +274,23 @@ func (ns *NodeServer) NodeStageVolume(
 		}
 	}
 
+	reason, err := ns.selectMounter(ctx, volID, volOptions, req.GetVolumeCapability())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to select mounter for volume %s: %v", volID, err)
+
+		return nil, util.GRPCError(err)
+	}
+
 	mnt, err := mounter.New(volOptions)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to create mounter for volume %s: %v", volID, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = maybeInitializeFileEncryption(ctx, mnt, volOptions)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// Check if the volume is already mounted
@@ -263,17 +301,23 @@ func (ns *NodeServer) NodeStageVolume(
 		}
 	}
 
+	if _, ok := mnt.(mounter.KernelMounter); ok && ns.kernelMountRecovery {
+		if err = ns.tryRestoreKernelMountInNodeStage(ctx, req.GetVolumeId(), stagingTargetPath); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to try to restore kernel mount: %v", err)
+		}
+	}
+
 	isMnt, err := util.IsMountPoint(ns.Mounter, stagingTargetPath)
 	if err != nil {
 		log.ErrorLog(ctx, "stat failed: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if isMnt {
 		log.DebugLog(ctx, "cephfs: volume %s is already mounted to %s, skipping", volID, stagingTargetPath)
 		if err = maybeUnlockFileEncryption(ctx, volOptions, stagingTargetPath, volID); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		ns.startSharedHealthChecker(ctx, req.GetVolumeId(), stagingTargetPath)
@@ -298,7 +342,7 @@ func (ns *NodeServer) NodeStageVolume(
 	log.DebugLog(ctx, "cephfs: successfully mounted volume %s to %s", volID, stagingTargetPath)
 
 	if err = maybeUnlockFileEncryption(ctx, volOptions, stagingTargetPath, volID); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if _, isFuse := mnt.(*mounter.FuseMounter); isFuse {
@@ -316,10 +360,30 @@ func (ns *NodeServer) NodeStageVolume(
 					stagingTargetPath, unmountErr)
 			}
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
+	if reason != mounter.SelectionReasonRequested {
+		// NodePublishVolume and later stagings use the same mounter.
+		if err = fsutil.WriteMounterMountinfo(volID, &fsutil.MounterMountinfo{
+			Mounter: volOptions.Mounter,
+			Reason:  reason,
+		}); err != nil {
+			log.ErrorLog(ctx, "cephfs: failed to write MounterMountinfo for volume %s: %v", volID, err)
+
+			if unmountErr := mounter.UnmountAll(ctx, stagingTargetPath); unmountErr != nil {
+				log.ErrorLog(ctx, "cephfs: failed to unmount %s in WriteMounterMountinfo clean up: %v",
+					stagingTargetPath, unmountErr)
+			}
+
+			return nil, util.GRPCError(err)
+		}
+	}
+
+	log.UsefulLog(ctx, "cephfs: staged volume %s with mounter %s, reason: %s", volID, volOptions.Mounter, reason)
+	metrics.CountMounterSelection(volOptions.Mounter, reason)
+
 	ns.startSharedHealthChecker(ctx, req.GetVolumeId(), stagingTargetPath)
 
 	return &csi.NodeStageVolumeResponse{}, nil
@@ -350,8 +414,11 @@ func (ns *NodeServer) mount(
 	cr, err := getCredentialsForVolume(volOptions, secrets)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get ceph credentials for volume %s: %v", volID, err)
+		if errors.Is(err, errTenantCredentialsMismatch) {
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
@@ -361,7 +428,7 @@ func (ns *NodeServer) mount(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to set mount options for volume %s: %v", volID, err)
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	if err = mnt.Mount(ctx, stagingTargetPath, cr, volOptions); err != nil {
@@ -370,7 +437,7 @@ func (ns *NodeServer) mount(
 			volID,
 			err)
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	defer func() {
@@ -402,7 +469,7 @@ func (ns *NodeServer) mount(
 			log.ErrorLog(ctx,
 				"failed to bind mount snapshot root %s: %v", absoluteSnapshotRoot, err)
 
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 	}
 
@@ -485,6 +552,10 @@ func (ns *NodeServer) NodePublishVolume(
 	ctx context.Context,
 	req *csi.NodePublishVolumeRequest,
 ) (*csi.NodePublishVolumeResponse, error) {
+	if isEphemeralVolume(req.GetVolumeContext()) {
+		return ns.publishEphemeralVolume(ctx, req)
+	}
+
 	mountOptions := []string{"bind", "_netdev"}
 	if err := util.ValidateNodePublishVolumeRequest(req); err != nil {
 		return nil, err
@@ -494,12 +565,13 @@ func (ns *NodeServer) NodePublishVolume(
 	targetPath := req.GetTargetPath()
 	volID := fsutil.VolumeID(req.GetVolumeId())
 
-	if acquired := ns.VolumeLocks.TryAcquire(targetPath); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(targetPath)
+	if !acquired {
 		log.ErrorLog(ctx, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 
 		return nil, status.Errorf(codes.Aborted, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 	}
-	defer ns.VolumeLocks.Release(targetPath)
+	defer ns.VolumeLocks.Release(targetPath, token)
 
 	volOptions := &store.VolumeOptions{}
 	defer volOptions.Destroy()
@@ -508,6 +580,16 @@ func (ns *NodeServer) NodePublishVolume(
 		return nil, status.Errorf(codes.Internal, "failed to detect mounter for volume %s: %v", volID, err.Error())
 	}
 
+	if volOptions.Mounter == "" {
+		mi, err := fsutil.GetMounterMountinfo(volID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to get mounter for volume %s: %v", volID, err.Error())
+		}
+		if mi != nil {
+			volOptions.Mounter = mi.Mounter
+		}
+	}
+
 	volMounter, err := mounter.New(volOptions)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to create mounter for volume %s: %v", volID, err.Error())
@@ -516,7 +598,7 @@ func (ns *NodeServer) NodePublishVolume(
 	if err = util.CreateMountPoint(targetPath); err != nil {
 		log.ErrorLog(ctx, "failed to create mount point at %s: %v", targetPath, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if _, ok := volMounter.(*mounter.FuseMounter); ok {
@@ -536,6 +618,8 @@ func (ns *NodeServer) NodePublishVolume(
 	}
 
 	mountOptions = csicommon.ConstructMountOptions(mountOptions, req.GetVolumeCapability())
+	// the SELinux context is set on the staged filesystem
+	mountOptions = csicommon.RemoveSELinuxMountOptions(mountOptions)
 
 	// Ensure staging target path is a mountpoint.
 
@@ -543,7 +627,7 @@ func (ns *NodeServer) NodePublishVolume(
 	if err != nil {
 		log.ErrorLog(ctx, "stat failed: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	} else if !isMnt {
 		return nil, status.Errorf(
 			codes.Internal, "staging path %s for volume %s is not a mountpoint", stagingTargetPath, volID,
@@ -556,7 +640,7 @@ func (ns *NodeServer) NodePublishVolume(
 	if err != nil {
 		log.ErrorLog(ctx, "stat failed: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if isMnt {
@@ -568,15 +652,43 @@ func (ns *NodeServer) NodePublishVolume(
 	// It's not, mount now
 	encrypted, err := store.IsEncrypted(ctx, req.GetVolumeContext())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	if encrypted {
 		stagingTargetPath = fscrypt.AppendEncyptedSubdirectory(stagingTargetPath)
 		if err = fscrypt.IsDirectoryUnlocked(stagingTargetPath, "ceph"); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
+	if util.IsSingleWriter(req.GetVolumeCapability()) {
+		// the target paths of the Pods differ, the claim of the volume
+		// is serialized by the volume ID
+		volToken, acquired := ns.VolumeLocks.TryAcquire(req.GetVolumeId())
+		if !acquired {
+			log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
+
+			return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, req.GetVolumeId())
+		}
+		defer ns.VolumeLocks.Release(req.GetVolumeId(), volToken)
+
+		// the staging target path is the mountpoint of the volume, the claim
+		// is recorded next to it
+		err = util.ClaimSingleWriter(ctx, ns.Mounter, path.Dir(req.GetStagingTargetPath()),
+			req.GetVolumeContext(), targetPath)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to publish ReadWriteOncePod volume %s: %v", volID, err)
+
+			return nil, util.GRPCError(err)
+		}
+	}
+
+	if err = ns.applyVolumeMountGroup(req, stagingTargetPath); err != nil {
+		log.ErrorLog(ctx, "failed to apply the volume mount group of volume %s: %v", volID, err)
+
+		return nil, util.GRPCError(err)
+	}
+
 	if err = mounter.BindMount(
 		ctx,
 		stagingTargetPath,
@@ -585,7 +697,7 @@ func (ns *NodeServer) NodePublishVolume(
 		mountOptions); err != nil {
 		log.ErrorLog(ctx, "failed to bind-mount volume %s: %v", volID, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(ctx, "cephfs: successfully bind-mounted volume %s to %s", volID, targetPath)
@@ -605,12 +717,13 @@ func (ns *NodeServer) NodeUnpublishVolume(
 
 	targetPath := req.GetTargetPath()
 	volID := req.GetVolumeId()
-	if acquired := ns.VolumeLocks.TryAcquire(targetPath); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(targetPath)
+	if !acquired {
 		log.ErrorLog(ctx, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 
 		return nil, status.Errorf(codes.Aborted, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 	}
-	defer ns.VolumeLocks.Release(targetPath)
+	defer ns.VolumeLocks.Release(targetPath, token)
 
 	// stop the health-checker that may have been started in NodeGetVolumeStats()
 	ns.healthChecker.StopChecker(volID, targetPath)
@@ -623,11 +736,11 @@ func (ns *NodeServer) NodeUnpublishVolume(
 			// targetPath has already been deleted
 			log.DebugLog(ctx, "targetPath: %s has already been deleted", targetPath)
 
-			return &csi.NodeUnpublishVolumeResponse{}, nil
+			return ns.unpublishEphemeralVolume(ctx, volID)
 		}
 
 		if !util.IsCorruptedMountError(err) {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		// Corrupted mounts need to be unmounted properly too,
@@ -637,25 +750,25 @@ func (ns *NodeServer) NodeUnpublishVolume(
 	}
 	if !isMnt {
 		if err = os.Remove(targetPath); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
-		return &csi.NodeUnpublishVolumeResponse{}, nil
+		return ns.unpublishEphemeralVolume(ctx, volID)
 	}
 
 	// Unmount the bind-mount
 	if err = mounter.UnmountVolume(ctx, targetPath); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = os.Remove(targetPath)
 	if err != nil && !os.IsNotExist(err) {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(ctx, "cephfs: successfully unbounded volume %s from %s", req.GetVolumeId(), targetPath)
 
-	return &csi.NodeUnpublishVolumeResponse{}, nil
+	return ns.unpublishEphemeralVolume(ctx, volID)
 }
 
 // NodeUnstageVolume unstages the volume from the staging path.
@@ -672,19 +785,30 @@ func (ns *NodeServer) NodeUnstageVolume(
 
 	ns.healthChecker.StopSharedChecker(volID)
 
-	if acquired := ns.VolumeLocks.TryAcquire(volID); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(volID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
 	}
-	defer ns.VolumeLocks.Release(volID)
+	defer ns.VolumeLocks.Release(volID, token)
 
 	stagingTargetPath := req.GetStagingTargetPath()
 
 	if err = fsutil.RemoveNodeStageMountinfo(fsutil.VolumeID(volID)); err != nil {
 		log.ErrorLog(ctx, "cephfs: failed to remove NodeStageMountinfo for volume %s: %v", volID, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
+	}
+
+	if mi, miErr := fsutil.GetMounterMountinfo(fsutil.VolumeID(volID)); miErr == nil && mi != nil {
+		log.DebugLog(ctx, "cephfs: unstaging volume %s that was staged with mounter %s", volID, mi.Mounter)
+	}
+
+	if err = fsutil.RemoveMounterMountinfo(fsutil.VolumeID(volID)); err != nil {
+		log.ErrorLog(ctx, "cephfs: failed to remove MounterMountinfo for volume %s: %v", volID, err)
+
+		return nil, util.GRPCError(err)
 	}
 
 	isMnt, err := util.IsMountPoint(ns.Mounter, stagingTargetPath)
@@ -699,7 +823,7 @@ func (ns *NodeServer) NodeUnstageVolume(
 		}
 
 		if !util.IsCorruptedMountError(err) {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		// Corrupted mounts need to be unmounted properly too,
@@ -714,7 +838,7 @@ func (ns *NodeServer) NodeUnstageVolume(
 	}
 	// Unmount the volume
 	if err = mounter.UnmountAll(ctx, stagingTargetPath); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(ctx, "cephfs: successfully unmounted volume %s from %s", req.GetVolumeId(), stagingTargetPath)
@@ -727,7 +851,7 @@ func (ns *NodeServer) NodeGetCapabilities(
 	ctx context.Context,
 	req *csi.NodeGetCapabilitiesRequest,
 ) (*csi.NodeGetCapabilitiesResponse, error) {
-	return &csi.NodeGetCapabilitiesResponse{
+	res := &csi.NodeGetCapabilitiesResponse{
 		Capabilities: []*csi.NodeServiceCapability{
 			{
 				Type: &csi.NodeServiceCapability_Rpc{
@@ -758,7 +882,19 @@ func (ns *NodeServer) NodeGetCapabilities(
 				},
 			},
 		},
-	}, nil
+	}
+
+	if ns.volumeMountGroup {
+		res.Capabilities = append(res.Capabilities, &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+				},
+			},
+		})
+	}
+
+	return res, nil
 }
 
 // NodeGetVolumeStats returns volume stats.
@@ -792,6 +928,12 @@ func (ns *NodeServer) NodeGetVolumeStats(
 		}
 	}
 
+	// the volume may have recovered since the last periodic check, it is
+	// only reported as abnormal when a check right away fails as well
+	if !healthy {
+		healthy, msg = ns.healthChecker.CheckVolume(req.GetVolumeId(), targetPath)
+	}
+
 	// !healthy indicates a problem with the volume
 	if !healthy {
 		return &csi.NodeGetVolumeStatsResponse{
@@ -839,6 +981,7 @@ func (ns *NodeServer) setMountOptions(
 		readAffinityMountOptions string
 		kernelMountOptions       string
 		fuseMountOptions         string
+		msMode                   string
 		mountOptions             []string
 		err                      error
 	)
@@ -852,6 +995,11 @@ func (ns *NodeServer) setMountOptions(
 			return err
 		}
 
+		msMode, err = util.GetMsMode(csiConfigFile, volOptions.ClusterID)
+		if err != nil {
+			return err
+		}
+
 		// read affinity mount options
 		readAffinityMountOptions, err = util.GetReadAffinityMapOptions(
 			csiConfigFile, volOptions.ClusterID, ns.CLIReadAffinityOptions, ns.NodeLabels,
@@ -879,6 +1027,10 @@ func (ns *NodeServer) setMountOptions(
 		volOptions.KernelMountOptions = util.MountOptionsAdd(volOptions.KernelMountOptions, configuredMountOptions)
 		volOptions.KernelMountOptions = util.MountOptionsAdd(volOptions.KernelMountOptions, readAffinityMountOptions)
 		volOptions.KernelMountOptions = util.MountOptionsAdd(volOptions.KernelMountOptions, mountOptions...)
+		if ns.kernelMountRecovery {
+			volOptions.KernelMountOptions = util.MountOptionsAdd(volOptions.KernelMountOptions, recoverSessionClean)
+		}
+		volOptions.KernelMountOptions = util.SetMsModeOption(volOptions.KernelMountOptions, msMode)
 	}
 
 	const readOnly = "ro"
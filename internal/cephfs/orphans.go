@@ -0,0 +1,262 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// subvolumeNameAttribute is set in the UUID directory of every reserved
+// volume, it is used to list all reservations in the journal.
+const subvolumeNameAttribute = "imagename"
+
+var errNoProvisionerCredentials = errors.New("no provisioner credentials configured")
+
+// configuredProvisionerSecrets returns the provisioner credentials of the
+// cluster in the CSI configuration.
+func configuredProvisionerSecrets(clusterID string) (map[string]string, error) {
+	secrets, err := util.GetConfiguredSecrets(util.CsiConfigFile, clusterID, util.ProvisionerCredentials, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("%w for cluster %q", errNoProvisionerCredentials, clusterID)
+	}
+
+	return secrets, nil
+}
+
+// ListJournaledVolumes returns the IDs of the volumes that are reserved in
+// the journal of the filesystem of the cluster. The provisioner credentials
+// of the CSI configuration are used.
+func ListJournaledVolumes(ctx context.Context, clusterID, fsName string) ([]string, error) {
+	secrets, err := configuredProvisionerSecrets(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := listReservedVolumes(ctx, clusterID, fsName, secrets, subvolumeNameAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeIDs := make([]string, 0, len(reservations))
+	for volumeID := range reservations {
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+
+	return volumeIDs, nil
+}
+
+// listReservedVolumes returns the IDs of the volumes that are reserved in the
+// journal of the filesystem of the cluster, mapped to the value of the
+// attribute in their journal. The value is empty when the attribute is not
+// set.
+func listReservedVolumes(
+	ctx context.Context,
+	clusterID, fsName string,
+	secrets map[string]string,
+	attribute string,
+) (map[string]string, error) {
+	return listReserved(ctx, store.VolJournal, clusterID, fsName, secrets, attribute)
+}
+
+// listReserved returns the IDs of the volumes or snapshots that are reserved
+// in the journal of the filesystem of the cluster, mapped to the value of the
+// attribute in their journal.
+func listReserved(
+	ctx context.Context,
+	jc *journal.Config,
+	clusterID, fsName string,
+	secrets map[string]string,
+	attribute string,
+) (map[string]string, error) {
+	cr, err := util.NewAdminCredentials(secrets)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", clusterID, err)
+	}
+
+	radosNamespace, err := util.GetCephFSRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rados namespace using clusterID (%s): %w", clusterID, err)
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	fs := core.NewFileSystem(conn)
+	fscID, err := fs.GetFscID(ctx, fsName)
+	if err != nil {
+		return nil, err
+	}
+	metadataPool, err := fs.GetMetadataPool(ctx, fsName)
+	if err != nil {
+		return nil, err
+	}
+	poolID, err := util.GetPoolID(monitors, cr, metadataPool)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := jc.Connect(monitors, radosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	reservations, err := j.ListReservations(ctx, metadataPool, poolID, poolID, attribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list journal of fs %q: %w", fsName, err)
+	}
+
+	volumes := make(map[string]string, len(reservations))
+	for reservedUUID, value := range reservations {
+		volumeID, err := util.GenerateVolID(ctx, monitors, cr, fscID, "", clusterID, reservedUUID)
+		if err != nil {
+			return nil, err
+		}
+		volumes[volumeID] = value
+	}
+
+	return volumes, nil
+}
+
+// DeleteOrphanedVolume removes the subvolume and the journal reservation of a
+// volume that is not referenced by a PersistentVolume anymore. The
+// provisioner credentials of the CSI configuration are used. Volumes that
+// are removed already are not an error.
+func DeleteOrphanedVolume(ctx context.Context, volumeID, clusterName string, setMetadata bool) error {
+	secrets, err := configuredProvisionerSecrets(util.GetClusterIDFromVolumeID(volumeID))
+	if err != nil {
+		return err
+	}
+
+	cs := &ControllerServer{ClusterName: clusterName, SetMetadata: setMetadata}
+
+	return cs.removeVolume(ctx, volumeID, secrets)
+}
+
+// ListJournaledClones returns the IDs of the volumes in the journal of the
+// filesystem of the cluster that are clones which are not complete yet,
+// mapped to the time of the last CreateVolume request that checked them (see
+// store.IsCloneAbandoned). The provisioner credentials of the CSI
+// configuration are used.
+func ListJournaledClones(ctx context.Context, clusterID, fsName string) (map[string]string, error) {
+	secrets, err := configuredProvisionerSecrets(clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := listReservedVolumes(ctx, clusterID, fsName, secrets, store.CloneAttemptAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	clones := map[string]string{}
+	for volumeID, attempt := range reservations {
+		if attempt != "" {
+			clones[volumeID] = attempt
+		}
+	}
+
+	return clones, nil
+}
+
+// DeleteAbandonedClone cancels the clone of the volume, and removes its
+// subvolume, the temporary snapshot on the cloned volume and the journal
+// reservation. The provisioner credentials of the CSI configuration are
+// used. Clones that are removed already are not an error.
+func DeleteAbandonedClone(ctx context.Context, volumeID, clusterName string, setMetadata bool) error {
+	secrets, err := configuredProvisionerSecrets(util.GetClusterIDFromVolumeID(volumeID))
+	if err != nil {
+		return err
+	}
+
+	cr, err := util.NewAdminCredentials(secrets)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	// the details of a subvolume can not be fetched while it is cloned, the
+	// volume options are returned with the error then
+	volOptions, vID, err := store.NewVolumeOptionsFromVolID(ctx, volumeID, nil, secrets, clusterName, setMetadata)
+	if volOptions == nil {
+		if errors.Is(err, util.ErrPoolNotFound) || errors.Is(err, util.ErrKeyNotFound) {
+			log.DebugLog(ctx, "clone %s is removed already: %v", volumeID, err)
+
+			return nil
+		}
+
+		return err
+	}
+	defer volOptions.Destroy()
+
+	op, err := store.FetchCloneOperation(ctx, volOptions, vID, cr)
+	if err != nil {
+		return err
+	}
+	if op == nil {
+		log.DebugLog(ctx, "clone %s is complete, it is not removed", volumeID)
+
+		return nil
+	}
+
+	volClient := core.NewSubVolume(volOptions.GetConnection(), &volOptions.SubVolume,
+		volOptions.ClusterID, clusterName, setMetadata)
+	err = volClient.CancelClone(ctx)
+	if err != nil && !errors.Is(err, cerrors.ErrVolumeNotFound) {
+		// failed clones can not be canceled, they can be purged
+		log.WarningLog(ctx, "failed to cancel clone %s: %v", volumeID, err)
+	}
+
+	err = volClient.PurgeVolume(ctx, true)
+	if err != nil && !errors.Is(err, cerrors.ErrVolumeNotFound) {
+		return err
+	}
+
+	if op.Source != "" {
+		source := volOptions.SubVolume
+		source.VolID = op.Source
+		source.SubvolumeGroup = op.SourceGroup
+		err = volClient.CleanupSnapshotFromSubvolume(ctx, &source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return store.UndoVolReservation(ctx, volOptions, *vID, secrets)
+}
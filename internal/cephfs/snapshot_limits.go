@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// checkSnapshotLimits verifies that a new snapshot of the volume does not
+// exceed the snapshot limits of the CSI config and the VolumeSnapshotClass
+// parameters. It returns util.ErrSnapshotLimitExceeded when it does.
+func checkSnapshotLimits(
+	ctx context.Context,
+	volOptions *store.VolumeOptions,
+	vid *store.VolumeIdentifier,
+	cr *util.Credentials,
+	parameters map[string]string,
+) error {
+	limits, err := util.GetSnapshotLimits(util.CsiConfigFile, volOptions.ClusterID, parameters)
+	if err != nil {
+		return err
+	}
+
+	if !limits.Enabled() {
+		return nil
+	}
+
+	snapshots, err := store.GetSnapshotsCount(ctx, volOptions, vid, cr)
+	if err != nil {
+		return err
+	}
+
+	last, err := store.FetchLastSnapshotTime(ctx, volOptions, vid, cr)
+	if err != nil {
+		return fmt.Errorf("failed to get time of last snapshot of volume %s: %w", vid.VolumeID, err)
+	}
+
+	log.DebugLog(ctx, "volume %s has %d snapshots, last snapshot at %q", vid.VolumeID, snapshots, last)
+
+	return limits.Check(snapshots, last, time.Now())
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// StaticSubvolume contains the details of an existing subvolume that are
+// needed to use it as static PersistentVolume.
+type StaticSubvolume struct {
+	// SubvolumeGroup of the subvolume, the one of the CSI configuration
+	// when not passed to InspectStaticSubvolume.
+	SubvolumeGroup string
+	// RootPath is the path of the subvolume in the filesystem.
+	RootPath string
+	// Size is the quota of the subvolume in bytes, 0 when it has no quota.
+	Size int64
+}
+
+// InspectStaticSubvolume checks that the subvolume exists in the filesystem
+// and can be mounted, and returns the details for a static
+// PersistentVolume.
+func InspectStaticSubvolume(
+	ctx context.Context,
+	cr *util.Credentials,
+	clusterID, fsName, subvolumeGroup, subvolume string,
+) (*StaticSubvolume, error) {
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", clusterID, err)
+	}
+
+	ss := &StaticSubvolume{SubvolumeGroup: subvolumeGroup}
+	if ss.SubvolumeGroup == "" {
+		ss.SubvolumeGroup, err = util.CephFSSubvolumeGroup(util.CsiConfigFile, clusterID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch subvolumegroup using clusterID (%s): %w", clusterID, err)
+		}
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	vol := core.NewSubVolume(conn, &core.SubVolume{
+		VolID:          subvolume,
+		FsName:         fsName,
+		SubvolumeGroup: ss.SubvolumeGroup,
+	}, clusterID, "", false)
+	info, err := vol.GetSubVolumeInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subvolume %q in group %q of fs %q: %w",
+			subvolume, ss.SubvolumeGroup, fsName, err)
+	}
+
+	// subvolumes in the snapshot-retained state have no path, they can not
+	// be mounted
+	if info.Path == "" {
+		return nil, fmt.Errorf("subvolume %q has no path, it may only retain snapshots", subvolume)
+	}
+	ss.RootPath = info.Path
+	ss.Size = info.BytesQuota
+
+	return ss, nil
+}
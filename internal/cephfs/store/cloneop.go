@@ -0,0 +1,298 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
+	"github.com/ceph/go-ceph/cephfs/admin"
+)
+
+// attributes in the journal of a volume that record the state of its clone.
+// They are removed when the clone completes.
+const (
+	cloneStartedAttribute = "clone.started"
+	cloneStageAttribute   = "clone.stage"
+	cloneErrorAttribute   = "clone.error"
+	cloneSourceAttribute  = "clone.source"
+	cloneGroupAttribute   = "clone.sourcegroup"
+	// CloneAttemptAttribute contains the time of the last CreateVolume
+	// request that checked the clone.
+	CloneAttemptAttribute = "clone.attempt"
+)
+
+// stages of a clone that are recorded in the journal.
+const (
+	CloneStageStarted    = "started"
+	CloneStagePending    = "pending"
+	CloneStageInProgress = "in-progress"
+)
+
+var cloneAttributes = []string{
+	cloneStartedAttribute,
+	cloneStageAttribute,
+	cloneErrorAttribute,
+	cloneSourceAttribute,
+	cloneGroupAttribute,
+	CloneAttemptAttribute,
+}
+
+// CloneOperation is the state of a clone that is not complete yet, it is
+// kept in the journal of the volume so that retried CreateVolume requests,
+// restarted provisioners and the controller can find it.
+type CloneOperation struct {
+	// StartedAt is the time the clone was started
+	StartedAt time.Time
+	// LastAttempt is the time of the last CreateVolume request that
+	// checked the clone
+	LastAttempt time.Time
+	// Stage is the last known stage of the clone
+	Stage string
+	// LastError is the error that was returned for the last attempt
+	LastError string
+	// Source is the subvolume of a volume that is cloned, the temporary
+	// snapshot of the clone is created on it. It is empty for clones of
+	// snapshots.
+	Source string
+	// SourceGroup is the subvolume group of the Source
+	SourceGroup string
+}
+
+// attributes returns the journal attributes of the clone operation.
+func (op *CloneOperation) attributes() map[string]string {
+	return map[string]string{
+		cloneStartedAttribute: op.StartedAt.UTC().Format(time.RFC3339),
+		CloneAttemptAttribute: op.LastAttempt.UTC().Format(time.RFC3339),
+		cloneStageAttribute:   op.Stage,
+		cloneErrorAttribute:   op.LastError,
+		cloneSourceAttribute:  op.Source,
+		cloneGroupAttribute:   op.SourceGroup,
+	}
+}
+
+// cloneOperationFromAttributes returns the clone operation of the journal
+// attributes, it is nil when no clone operation is recorded.
+func cloneOperationFromAttributes(attrs map[string]string) *CloneOperation {
+	startedAt, err := time.Parse(time.RFC3339, attrs[cloneStartedAttribute])
+	if err != nil {
+		return nil
+	}
+
+	lastAttempt, err := time.Parse(time.RFC3339, attrs[CloneAttemptAttribute])
+	if err != nil {
+		lastAttempt = startedAt
+	}
+
+	return &CloneOperation{
+		StartedAt:   startedAt,
+		LastAttempt: lastAttempt,
+		Stage:       attrs[cloneStageAttribute],
+		LastError:   attrs[cloneErrorAttribute],
+		Source:      attrs[cloneSourceAttribute],
+		SourceGroup: attrs[cloneGroupAttribute],
+	}
+}
+
+// wrapError adds the state of the clone operation to the error that is
+// returned for the attempt at now.
+func (op *CloneOperation) wrapError(err error, now time.Time) error {
+	return fmt.Errorf("%w (clone started at %s, %s ago, stage %s)", err,
+		op.StartedAt.UTC().Format(time.RFC3339), now.Sub(op.StartedAt).Round(time.Second), op.Stage)
+}
+
+// cloneStage returns the stage of the clone for the error of its clone
+// state.
+func cloneStage(err error) string {
+	if errors.Is(err, cerrors.ErrClonePending) {
+		return CloneStagePending
+	}
+
+	return CloneStageInProgress
+}
+
+// cloneProgressError adds the progress report of a clone in progress to its
+// error, when the report is available.
+func cloneProgressError(err error, report admin.CloneProgressReport) error {
+	if !errors.Is(err, cerrors.ErrCloneInProgress) || report.PercentageCloned == "" {
+		return err
+	}
+
+	return fmt.Errorf("%w. progress report: percentage cloned=%s, amount cloned=%s, files cloned=%s",
+		err, report.PercentageCloned, report.AmountCloned, report.FilesCloned)
+}
+
+// IsCloneAbandoned returns true when the last attempt of the clone, in the
+// format of the CloneAttemptAttribute, is older than the ttl. The clone is
+// not checked by CreateVolume requests anymore then, like when the
+// PersistentVolumeClaim was deleted while it was cloned.
+func IsCloneAbandoned(lastAttempt string, now time.Time, ttl time.Duration) bool {
+	if lastAttempt == "" {
+		return false
+	}
+
+	t, err := time.Parse(time.RFC3339, lastAttempt)
+	if err != nil {
+		// the attempt can not be checked, treat it as recent
+		return false
+	}
+
+	return now.Sub(t) > ttl
+}
+
+// StartCloneOperation records the start of the clone of the volume in its
+// journal. source is the subvolume of the volume that is cloned, it is nil
+// for clones of snapshots.
+func StartCloneOperation(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	vid *VolumeIdentifier,
+	source *core.SubVolume,
+	cr *util.Credentials,
+) error {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(vid.VolumeID); err != nil {
+		return err
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	now := time.Now()
+	op := &CloneOperation{
+		StartedAt:   now,
+		LastAttempt: now,
+		Stage:       CloneStageStarted,
+	}
+	if source != nil {
+		op.Source = source.VolID
+		op.SourceGroup = source.SubvolumeGroup
+	}
+	return j.StoreAttributes(ctx, volOptions.MetadataPool, vi.ObjectUUID, op.attributes())
+}
+
+// FetchCloneOperation returns the clone operation of the volume, it is nil
+// when no clone is recorded.
+func FetchCloneOperation(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	vid *VolumeIdentifier,
+	cr *util.Credentials,
+) (*CloneOperation, error) {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(vid.VolumeID); err != nil {
+		return nil, err
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	attrs, err := j.FetchAttributes(ctx, volOptions.MetadataPool, vi.ObjectUUID, cloneAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloneOperationFromAttributes(attrs), nil
+}
+
+// recordCloneAttempt records the attempt of a CreateVolume request to check
+// the clone, which is not complete yet, and returns the error with the state
+// of the clone. Clones that were started before their operation was
+// recorded start at now.
+func recordCloneAttempt(
+	ctx context.Context,
+	j *journal.Connection,
+	pool, uuid, subvolume string,
+	cloneErr error,
+) error {
+	now := time.Now()
+	op := &CloneOperation{StartedAt: now}
+	attrs, err := j.FetchAttributes(ctx, pool, uuid, cloneAttributes)
+	if err != nil {
+		log.WarningLog(ctx, "failed to fetch the clone operation of %s: %v", subvolume, err)
+	} else if recorded := cloneOperationFromAttributes(attrs); recorded != nil {
+		op = recorded
+	}
+
+	op.LastAttempt = now
+	op.Stage = cloneStage(cloneErr)
+	op.LastError = cloneErr.Error()
+	err = j.StoreAttributes(ctx, pool, uuid, op.attributes())
+	if err != nil {
+		log.WarningLog(ctx, "failed to record the clone operation of %s: %v", subvolume, err)
+	}
+	trackClone(subvolume, true)
+
+	return op.wrapError(cloneErr, now)
+}
+
+// finishCloneOperation removes the clone operation from the journal of the
+// volume once the clone is complete.
+func finishCloneOperation(ctx context.Context, j *journal.Connection, pool, uuid, subvolume string) error {
+	trackClone(subvolume, false)
+
+	return j.RemoveAttributes(ctx, pool, uuid, cloneAttributes)
+}
+
+// cloneTrackingExpiry is the time after which a clone that was not checked
+// anymore is not counted as in flight, the provisioner stops checking clones
+// of deleted PersistentVolumeClaims.
+const cloneTrackingExpiry = 15 * time.Minute
+
+var (
+	// inFlightClones contains the subvolumes of the clones that are
+	// pending or in progress, with the time they were checked last.
+	inFlightClones     = map[string]time.Time{}
+	inFlightClonesLock sync.Mutex
+)
+
+// trackClone adds or removes the subvolume from the clones that are in
+// flight, and updates their metric.
+func trackClone(subvolume string, inFlight bool) {
+	inFlightClonesLock.Lock()
+	defer inFlightClonesLock.Unlock()
+
+	now := time.Now()
+	if inFlight {
+		inFlightClones[subvolume] = now
+	} else {
+		delete(inFlightClones, subvolume)
+	}
+
+	for name, checked := range inFlightClones {
+		if now.Sub(checked) > cloneTrackingExpiry {
+			delete(inFlightClones, name)
+		}
+	}
+	metrics.SetClonesInFlight(len(inFlightClones))
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCloneAbandoned(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		lastAttempt string
+		want        bool
+	}{
+		{
+			name:        "recent attempt",
+			lastAttempt: "2024-05-01T11:00:00Z",
+			want:        false,
+		},
+		{
+			name:        "attempt older than the ttl",
+			lastAttempt: "2024-04-30T11:00:00Z",
+			want:        true,
+		},
+		{
+			name:        "no attempt",
+			lastAttempt: "",
+			want:        false,
+		},
+		{
+			name:        "invalid attempt",
+			lastAttempt: "yesterday",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, IsCloneAbandoned(tt.lastAttempt, now, 24*time.Hour))
+		})
+	}
+}
+
+func TestCloneOperationAttributes(t *testing.T) {
+	t.Parallel()
+
+	startedAt := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	op := &CloneOperation{
+		StartedAt:   startedAt,
+		LastAttempt: startedAt.Add(time.Hour),
+		Stage:       CloneStageInProgress,
+		LastError:   cerrors.ErrCloneInProgress.Error(),
+		Source:      "csi-vol-source",
+		SourceGroup: "csi",
+	}
+	require.Equal(t, op, cloneOperationFromAttributes(op.attributes()))
+
+	require.Nil(t, cloneOperationFromAttributes(map[string]string{}))
+
+	err := op.wrapError(cerrors.ErrClonePending, startedAt.Add(90*time.Minute))
+	require.ErrorIs(t, err, cerrors.ErrClonePending)
+	require.Contains(t, err.Error(), "1h30m0s ago, stage in-progress")
+
+	require.Equal(t, CloneStagePending, cloneStage(cerrors.ErrClonePending))
+	require.Equal(t, CloneStageInProgress, cloneStage(errors.New("clone in progress")))
+}
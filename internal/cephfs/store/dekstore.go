@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	kmsapi "github.com/ceph/ceph-csi/internal/kms"
+)
+
+// dekClient stores and fetches the encrypted DEK in the metadata of a
+// subvolume or subvolume snapshot.
+type dekClient interface {
+	StoreDEK(dek string) error
+	FetchDEK() (string, error)
+}
+
+// subVolumeDEKStore is a kms.DEKStore that keeps the DEK of an encrypted
+// volume in the metadata of its subvolume, or of the subvolume snapshot for
+// snapshots. It is used for KMS that can encrypt DEKs, but can not store them
+// and do not provide a passphrase with GetSecret.
+type subVolumeDEKStore struct {
+	vo *VolumeOptions
+}
+
+var _ kmsapi.DEKStore = &subVolumeDEKStore{}
+
+// client returns the client of the subvolume or snapshot. It is created on
+// each call, as the connection and the name of the subvolume are set after
+// the encryption has been configured.
+func (s *subVolumeDEKStore) client() (dekClient, error) {
+	if s.vo.conn == nil {
+		return nil, errors.New("can not access the DEK of a volume that is not connected")
+	}
+
+	if s.vo.dekSnapshot != "" {
+		return core.NewSnapshot(s.vo.conn, s.vo.dekSnapshot, s.vo.ClusterID, "", false, &s.vo.SubVolume), nil
+	}
+
+	return core.NewSubVolume(s.vo.conn, &s.vo.SubVolume, s.vo.ClusterID, "", false), nil
+}
+
+// StoreDEK saves the encrypted DEK in the metadata of the subvolume or
+// snapshot. The volumeID is not used, the DEK is stored for the VolumeOptions
+// of the DEKStore.
+func (s *subVolumeDEKStore) StoreDEK(ctx context.Context, volumeID, dek string) error {
+	client, err := s.client()
+	if err != nil {
+		return err
+	}
+
+	return client.StoreDEK(dek)
+}
+
+// FetchDEK reads the encrypted DEK from the metadata of the subvolume or
+// snapshot.
+func (s *subVolumeDEKStore) FetchDEK(ctx context.Context, volumeID string) (string, error) {
+	client, err := s.client()
+	if err != nil {
+		return "", err
+	}
+
+	return client.FetchDEK()
+}
+
+// RemoveDEK does not need to remove the DEK from the metadata, the subvolume
+// or snapshot is getting removed.
+func (s *subVolumeDEKStore) RemoveDEK(ctx context.Context, volumeID string) error {
+	return nil
+}
+
+// StoresDEKInMetadata returns true when the DEK of the volume is stored in
+// the metadata of the subvolume or snapshot.
+func (vo *VolumeOptions) StoresDEKInMetadata() bool {
+	return vo.IsEncrypted() &&
+		vo.Encryption.KMS.RequiresDEKStore() == kmsapi.DEKStoreMetadata &&
+		vo.Encryption.HasDEKStore()
+}
+
+// CopyDEK copies the DEK of (vo, vID) to the metadata of the subvolume of
+// (cp, cpVID). The subvolume has to exist, so unlike the passphrases that
+// CopyEncryptionConfig copies, this is done once the clone has been created.
+func (vo *VolumeOptions) CopyDEK(ctx context.Context, cp *VolumeOptions, vID, cpVID string) error {
+	if !vo.StoresDEKInMetadata() || !cp.StoresDEKInMetadata() || cp.dekSnapshot != "" {
+		return nil
+	}
+
+	return vo.copyPassphrase(ctx, cp, vID, cpVID)
+}
+
+// copyPassphrase stores the passphrase of (vo, vID) encrypted for (cp, cpVID).
+func (vo *VolumeOptions) copyPassphrase(ctx context.Context, cp *VolumeOptions, vID, cpVID string) error {
+	passphrase, err := vo.Encryption.GetCryptoPassphrase(ctx, vID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch passphrase for %q (%+v): %w",
+			vID, vo, err)
+	}
+
+	err = cp.Encryption.StoreCryptoPassphrase(ctx, cpVID, passphrase)
+	if err != nil {
+		return fmt.Errorf("failed to store passphrase for %q (%+v): %w",
+			cpVID, cp, err)
+	}
+
+	return nil
+}
+
+// SnapshotOptions returns the VolumeOptions for the snapshot fsSnapshotName of
+// the subvolume of vo, to store the DEK of an encrypted snapshot. The returned
+// VolumeOptions share the connection of vo and must not be destroyed.
+func (vo *VolumeOptions) SnapshotOptions(fsSnapshotName string) *VolumeOptions {
+	return &VolumeOptions{
+		SubVolume:   vo.SubVolume,
+		ClusterID:   vo.ClusterID,
+		Owner:       vo.Owner,
+		conn:        vo.conn,
+		dekSnapshot: fsSnapshotName,
+	}
+}
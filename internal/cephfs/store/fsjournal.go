@@ -20,6 +20,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/cephfs/core"
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
@@ -111,6 +113,7 @@ func CheckVolExists(ctx context.Context,
 		cloneState, cloneStateErr := vol.GetCloneState(ctx)
 		if cloneStateErr != nil {
 			if errors.Is(cloneStateErr, cerrors.ErrVolumeNotFound) {
+				trackClone(vid.FsSubvolName, false)
 				if pvID != nil {
 					err = vol.CleanupSnapshotFromSubvolume(
 						ctx, &parentVolOpt.SubVolume)
@@ -127,23 +130,14 @@ func CheckVolExists(ctx context.Context,
 			return nil, err
 		}
 		err = cloneState.ToError()
-		if errors.Is(err, cerrors.ErrCloneInProgress) {
-			progressReport := cloneState.GetProgressReport()
-			// append progress report only if the progress report parameters are present.
-			if progressReport.PercentageCloned != "" {
-				err = fmt.Errorf("%w. progress report: percentage cloned=%s, amount cloned=%s, files cloned=%s",
-					err,
-					progressReport.PercentageCloned,
-					progressReport.AmountCloned,
-					progressReport.FilesCloned)
-				log.ErrorLog(ctx, err.Error())
-			}
+		if cerrors.IsCloneRetryError(err) {
+			err = recordCloneAttempt(ctx, j, volOptions.MetadataPool, imageUUID, vid.FsSubvolName,
+				cloneProgressError(err, cloneState.GetProgressReport()))
+			log.ErrorLog(ctx, err.Error())
 
 			return nil, err
 		}
-		if errors.Is(err, cerrors.ErrClonePending) {
-			return nil, err
-		}
+		trackClone(vid.FsSubvolName, false)
 		if errors.Is(err, cerrors.ErrCloneFailed) {
 			log.ErrorLog(ctx,
 				"clone failed (%v), deleting subvolume clone. vol=%s, subvol=%s subvolgroup=%s",
@@ -172,6 +166,10 @@ func CheckVolExists(ctx context.Context,
 		if err != nil {
 			return nil, fmt.Errorf("clone is not in complete state for %s: %w", vid.FsSubvolName, err)
 		}
+		err = finishCloneOperation(ctx, j, volOptions.MetadataPool, imageUUID, vid.FsSubvolName)
+		if err != nil {
+			log.WarningLog(ctx, "failed to remove the clone operation of %s: %v", vid.FsSubvolName, err)
+		}
 	}
 
 	if imageData.ImageAttributes.BackingSnapshotID == "" {
@@ -198,9 +196,11 @@ func CheckVolExists(ctx context.Context,
 	}
 
 	// check if topology constraints match what is found
-	// TODO: we need an API to fetch subvolume attributes (size/datapool and others), based
-	// on which we can evaluate which topology this belongs to.
-	// TODO: CephFS topology support is postponed till we get the same
+	err = updateExistingTopology(ctx, volOptions, vol)
+	if err != nil {
+		return nil, err
+	}
+
 	// TODO: size checks
 
 	// found a volume already available, process and return it!
@@ -263,6 +263,31 @@ func updateTopologyConstraints(volOpts *VolumeOptions) error {
 	return nil
 }
 
+// updateExistingTopology sets the topology of an existing subvolume from its
+// data pool, when the volume is created with topologyConstrainedPools.
+func updateExistingTopology(ctx context.Context, volOpts *VolumeOptions, vol core.SubVolumeClient) error {
+	if volOpts.TopologyPools == nil {
+		return nil
+	}
+
+	info, err := vol.GetSubVolumeInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	poolName, _, topology, err := util.MatchPoolAndTopology(volOpts.TopologyPools,
+		volOpts.TopologyRequirement, info.DataPool)
+	if err != nil {
+		return err
+	}
+	if poolName != "" {
+		volOpts.Pool = poolName
+		volOpts.Topology = topology
+	}
+
+	return nil
+}
+
 func getEncryptionConfig(volOptions *VolumeOptions) (string, util.EncryptionType) {
 	if volOptions.IsEncrypted() {
 		return volOptions.Encryption.GetID(), util.EncryptionTypeFile
@@ -308,6 +333,22 @@ func ReserveVol(ctx context.Context, volOptions *VolumeOptions, secret map[strin
 		return nil, err
 	}
 	volOptions.VolID = vid.FsSubvolName
+
+	err = storeSubvolumeGroup(ctx, j, volOptions.MetadataPool, imageUUID, volOptions.SubvolumeGroup)
+	if err == nil && volOptions.SnapshotRetention != "" {
+		err = storeSnapshotRetention(ctx, j, volOptions.MetadataPool, imageUUID, volOptions.SnapshotRetention)
+	}
+	if err != nil {
+		undoErr := j.UndoReservation(ctx, volOptions.MetadataPool, volOptions.MetadataPool,
+			vid.FsSubvolName, volOptions.RequestName)
+		if undoErr != nil {
+			log.WarningLog(ctx, "failed undoing reservation of volume: %s (%s)",
+				volOptions.RequestName, undoErr)
+		}
+
+		return nil, err
+	}
+
 	// generate the volume ID to return to the CO system
 	vid.VolumeID, err = util.GenerateVolID(ctx, volOptions.Monitors, cr, volOptions.FscID,
 		"", volOptions.ClusterID, imageUUID)
@@ -353,6 +394,24 @@ func ReserveSnap(
 		return nil, err
 	}
 
+	err = storeSubvolumeGroup(ctx, j, volOptions.MetadataPool, imageUUID, volOptions.SubvolumeGroup)
+	if err != nil {
+		undoErr := j.UndoReservation(ctx, volOptions.MetadataPool, volOptions.MetadataPool,
+			vid.FsSnapshotName, snap.RequestName)
+		if undoErr != nil {
+			log.WarningLog(ctx, "failed undoing reservation of snapshot: %s (%s)",
+				snap.RequestName, undoErr)
+		}
+
+		return nil, err
+	}
+
+	errCount := updateSnapshotsCount(ctx, volOptions, parentSubVolName, cr, 1)
+	if errCount != nil {
+		log.WarningLog(ctx, "failed to count snapshot %s of subvolume %s: %v",
+			snap.RequestName, parentSubVolName, errCount)
+	}
+
 	// generate the snapshot ID to return to the CO system
 	vid.SnapshotID, err = util.GenerateVolID(ctx, volOptions.Monitors, cr, volOptions.FscID,
 		"", volOptions.ClusterID, imageUUID)
@@ -380,10 +439,29 @@ func UndoSnapReservation(
 	}
 	defer j.Destroy()
 
+	// the source of the snapshot is needed to update the snapshots counter
+	// of the subvolume once the reservation is gone
+	source := ""
+	if reservedID, ok := journal.GetUUIDFromName(vid.FsSnapshotName); ok {
+		source, err = j.FetchAttribute(ctx, volOptions.MetadataPool, reservedID, snapSourceAttribute)
+		if err != nil && !errors.Is(err, util.ErrKeyNotFound) {
+			log.WarningLog(ctx, "failed to get source of snapshot %s: %v", vid.FsSnapshotName, err)
+		}
+	}
+
 	err = j.UndoReservation(ctx, volOptions.MetadataPool,
 		volOptions.MetadataPool, vid.FsSnapshotName, snapName)
+	if err != nil || source == "" {
+		return err
+	}
 
-	return err
+	errCount := updateSnapshotsCount(ctx, volOptions, source, cr, -1)
+	if errCount != nil {
+		log.WarningLog(ctx, "failed to uncount snapshot %s of subvolume %s: %v",
+			vid.FsSnapshotName, source, errCount)
+	}
+
+	return nil
 }
 
 /*
@@ -470,3 +548,378 @@ func CheckSnapExists(
 
 	return sid, nil
 }
+
+// DeletingAttribute is the attribute in the journal of a volume that contains
+// the time when its asynchronous deletion was requested.
+const DeletingAttribute = "deleting"
+
+// MarkVolumeDeleting records in the journal of the volume that it is deleted
+// asynchronously, the reservation is removed once the subvolume is removed.
+func MarkVolumeDeleting(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	vid VolumeIdentifier,
+	secret map[string]string,
+) error {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(vid.VolumeID); err != nil {
+		return err
+	}
+
+	cr, err := util.NewAdminCredentials(secret)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return j.StoreAttribute(ctx, volOptions.MetadataPool, vi.ObjectUUID, DeletingAttribute,
+		time.Now().UTC().Format(time.RFC3339))
+}
+
+// snapSourceAttribute is the attribute in the snapshot journal that contains
+// the name of the subvolume the snapshot was created from.
+const snapSourceAttribute = "source"
+
+// snapshotsCounter is the counter in the journal object of a volume that
+// holds the number of its snapshots.
+const snapshotsCounter = "snapshots"
+
+// GetSnapshotsCount returns the number of snapshots of the volume. The count
+// is kept in the snapshots counter in the journal object of the volume, the
+// counter is initialized from the snapshot journal when it does not exist.
+func GetSnapshotsCount(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	vid *VolumeIdentifier,
+	cr *util.Credentials,
+) (int, error) {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(vid.VolumeID); err != nil {
+		return 0, err
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	oid := j.ReservationObject(vi.ObjectUUID)
+	counters, err := j.GetCounters(ctx, volOptions.MetadataPool, oid)
+	if err != nil {
+		return 0, err
+	}
+	if counters != nil {
+		return int(counters[snapshotsCounter]), nil
+	}
+
+	snapshots := 0
+	err = j.UpdateCounters(ctx, volOptions.MetadataPool, oid, func(counters journal.Counters) (journal.Counters, error) {
+		if counters != nil {
+			// initialized by another request while waiting for the lock
+			snapshots = int(counters[snapshotsCounter])
+
+			return counters, nil
+		}
+
+		var cErr error
+		snapshots, cErr = countSnapshots(ctx, volOptions, vid.FsSubvolName, cr)
+		if cErr != nil {
+			return nil, cErr
+		}
+
+		return journal.Counters{snapshotsCounter: int64(snapshots)}, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to initialize snapshots counter of volume %s: %w", vid.VolumeID, err)
+	}
+
+	return snapshots, nil
+}
+
+// updateSnapshotsCount adds delta to the snapshots counter of the subvolume.
+// Nothing is done when the counter does not exist, it is initialized with
+// the current number of snapshots when the snapshot limits are checked the
+// next time.
+func updateSnapshotsCount(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	subVolName string,
+	cr *util.Credentials,
+	delta int64,
+) error {
+	reservedID, ok := journal.GetUUIDFromName(subVolName)
+	if !ok {
+		// static volumes are not counted
+		return nil
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return j.AddToCounter(ctx, volOptions.MetadataPool, j.ReservationObject(reservedID), snapshotsCounter, delta)
+}
+
+// countSnapshots returns the number of snapshots of the subvolume that are
+// reserved in the snapshot journal. It lists all snapshot reservations, and
+// is only used when the snapshots counter of the volume does not exist yet.
+func countSnapshots(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	subVolName string,
+	cr *util.Credentials,
+) (int, error) {
+	j, err := SnapJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	uuids, err := snapshotReservations(ctx, j, volOptions, subVolName)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(uuids), nil
+}
+
+// snapshotReservations returns the UUIDs of the reservations in the snapshot
+// journal of the snapshots of the subvolume.
+func snapshotReservations(
+	ctx context.Context,
+	j *journal.Connection,
+	volOptions *VolumeOptions,
+	subVolName string,
+) ([]string, error) {
+	reservations, err := j.ListReservations(ctx, volOptions.MetadataPool, util.InvalidPoolID,
+		util.InvalidPoolID, snapSourceAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of fs %q: %w", volOptions.FsName, err)
+	}
+
+	uuids := []string{}
+	for uuid, source := range reservations {
+		if source == subVolName {
+			uuids = append(uuids, uuid)
+		}
+	}
+
+	return uuids, nil
+}
+
+// ListSnapshotIDs returns the IDs of the snapshots of the subvolume that are
+// reserved in the snapshot journal.
+func ListSnapshotIDs(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	subVolName string,
+	cr *util.Credentials,
+) ([]string, error) {
+	j, err := SnapJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	uuids, err := snapshotReservations(ctx, j, volOptions, subVolName)
+	if err != nil {
+		return nil, err
+	}
+
+	snapIDs := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		snapID, err := util.GenerateVolID(ctx, volOptions.Monitors, cr, volOptions.FscID,
+			"", volOptions.ClusterID, uuid)
+		if err != nil {
+			return nil, err
+		}
+		snapIDs = append(snapIDs, snapID)
+	}
+
+	return snapIDs, nil
+}
+
+const (
+	// retainedPathAttribute is the attribute in the snapshot journal that
+	// contains the root path of the subvolume of the snapshot, once the
+	// subvolume has been removed and only retains its snapshots.
+	retainedPathAttribute = "retainedpath"
+	// retainedSizeAttribute is the attribute in the snapshot journal that
+	// contains the size of the subvolume of the snapshot, once the
+	// subvolume has been removed and only retains its snapshots.
+	retainedSizeAttribute = "retainedsize"
+)
+
+// StoreRetainedSubvolume records the root path and the size of the subvolume
+// in the journal of its snapshots before the subvolume is removed. Subvolumes
+// that only retain their snapshots have no path and size anymore, which are
+// needed to restore the snapshots.
+func StoreRetainedSubvolume(ctx context.Context, volOptions *VolumeOptions, cr *util.Credentials) error {
+	j, err := SnapJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	uuids, err := snapshotReservations(ctx, j, volOptions, volOptions.VolID)
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]string{
+		retainedPathAttribute: volOptions.RootPath,
+		retainedSizeAttribute: strconv.FormatInt(volOptions.Size, 10),
+	}
+	for _, uuid := range uuids {
+		err = j.StoreAttributes(ctx, volOptions.MetadataPool, uuid, attrs)
+		if err != nil {
+			return fmt.Errorf("failed to record the retained subvolume %s: %w", volOptions.VolID, err)
+		}
+	}
+
+	return nil
+}
+
+// fetchRetainedSubvolume returns the root path and the size of the subvolume
+// of the snapshot that were recorded when the subvolume was removed. The path
+// is empty when they were not recorded.
+func fetchRetainedSubvolume(ctx context.Context, j *journal.Connection, pool, uuid string) (string, int64, error) {
+	attrs, err := j.FetchAttributes(ctx, pool, uuid, []string{retainedPathAttribute, retainedSizeAttribute})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to fetch the retained subvolume: %w", err)
+	}
+
+	if attrs[retainedPathAttribute] == "" {
+		return "", 0, nil
+	}
+
+	size, err := strconv.ParseInt(attrs[retainedSizeAttribute], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to parse the size of the retained subvolume: %w", err)
+	}
+
+	return attrs[retainedPathAttribute], size, nil
+}
+
+// FetchLastSnapshotTime returns the time of the last snapshot of the volume
+// from the journal. It is empty when the volume has no snapshots yet.
+func FetchLastSnapshotTime(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	vid *VolumeIdentifier,
+	cr *util.Credentials,
+) (string, error) {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(vid.VolumeID); err != nil {
+		return "", err
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return "", err
+	}
+	defer j.Destroy()
+
+	last, err := j.FetchAttribute(ctx, volOptions.MetadataPool, vi.ObjectUUID, util.LastSnapshotAttribute)
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return last, nil
+}
+
+// StoreLastSnapshotTime stores the time of the last snapshot of the volume in
+// the journal, so that the minimum interval between snapshots can be
+// enforced.
+func StoreLastSnapshotTime(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	vid *VolumeIdentifier,
+	cr *util.Credentials,
+	t time.Time,
+) error {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(vid.VolumeID); err != nil {
+		return err
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, volOptions.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return j.StoreAttribute(ctx, volOptions.MetadataPool, vi.ObjectUUID, util.LastSnapshotAttribute,
+		util.FormatSnapshotTime(t))
+}
+
+// subvolumeGroupAttribute is the attribute in the journal of a volume or
+// snapshot that contains the subvolumegroup of the subvolume.
+const subvolumeGroupAttribute = "subvolumegroup"
+
+// storeSubvolumeGroup records the subvolumegroup in the journal of the
+// reservation, so that the group is known when the ID is resolved.
+func storeSubvolumeGroup(ctx context.Context, j *journal.Connection, pool, uuid, group string) error {
+	err := j.StoreAttribute(ctx, pool, uuid, subvolumeGroupAttribute, group)
+	if err != nil {
+		return fmt.Errorf("failed to store subvolumegroup %q: %w", group, err)
+	}
+
+	return nil
+}
+
+// fetchSubvolumeGroup returns the subvolumegroup that is recorded in the
+// journal of the reservation. It is empty for reservations that were made
+// before the group was recorded.
+func fetchSubvolumeGroup(ctx context.Context, j *journal.Connection, pool, uuid string) (string, error) {
+	group, err := j.FetchAttribute(ctx, pool, uuid, subvolumeGroupAttribute)
+	if errors.Is(err, util.ErrKeyNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to fetch subvolumegroup: %w", err)
+	}
+
+	return group, nil
+}
+
+// snapshotRetentionAttribute is the attribute in the journal of a volume that
+// contains the snapshotRetention policy of the volume.
+const snapshotRetentionAttribute = "snapshotretention"
+
+// storeSnapshotRetention records the snapshotRetention policy in the journal
+// of the volume, so that it is known when the volume is deleted.
+func storeSnapshotRetention(ctx context.Context, j *journal.Connection, pool, uuid, retention string) error {
+	err := j.StoreAttribute(ctx, pool, uuid, snapshotRetentionAttribute, retention)
+	if err != nil {
+		return fmt.Errorf("failed to store snapshotRetention %q: %w", retention, err)
+	}
+
+	return nil
+}
+
+// fetchSnapshotRetention returns the snapshotRetention policy that is recorded
+// in the journal of the volume. It is empty for volumes that were created
+// without the policy.
+func fetchSnapshotRetention(ctx context.Context, j *journal.Connection, pool, uuid string) (string, error) {
+	retention, err := j.FetchAttribute(ctx, pool, uuid, snapshotRetentionAttribute)
+	if errors.Is(err, util.ErrKeyNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to fetch snapshotRetention: %w", err)
+	}
+
+	return retention, nil
+}
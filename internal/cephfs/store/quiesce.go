@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// GetFSQuiesceClients gets the filesystem names and subvolumes of the
+// volumeIDs and returns a FSQuiesceClient for each of the filesystems. The
+// quiesce sets that the clients create are released by Ceph when they are not
+// reset within the expiration.
+func GetFSQuiesceClients(ctx context.Context,
+	secret map[string]string,
+	volIDs []string,
+	cr *util.Credentials,
+	expiration time.Duration,
+) (
+	map[string]core.FSQuiesceClient,
+	error,
+) {
+	type fs struct {
+		fsName                string
+		volumes               []core.Volume
+		subVolumeGroupMapping map[string][]string
+		monitors              string
+	}
+	fm := make(map[string]fs, 0)
+	for _, volID := range volIDs {
+		// Find the volume using the provided VolumeID
+		volOptions, _, err := NewVolumeOptionsFromVolID(ctx,
+			volID, nil, secret, "", false)
+		if err != nil {
+			return nil, err
+		}
+		volOptions.Destroy()
+		// choosing monitorIP's and fsName as the unique key
+		// TODO: Need to use something else as the unique key as users can
+		// still choose the different monitorIP's and fsName for subvolumes
+		uniqueName := volOptions.Monitors + volOptions.FsName
+		if _, ok := fm[uniqueName]; !ok {
+			fm[uniqueName] = fs{
+				fsName:                volOptions.FsName,
+				volumes:               make([]core.Volume, 0),
+				subVolumeGroupMapping: make(map[string][]string), // Initialize the map
+				monitors:              volOptions.Monitors,
+			}
+		}
+		a := core.Volume{
+			VolumeID:  volID,
+			ClusterID: volOptions.ClusterID,
+		}
+		// Retrieve the value, modify it, and assign it back
+		val := fm[uniqueName]
+		val.volumes = append(val.volumes, a)
+		existingVolIDInMap := val.subVolumeGroupMapping[volOptions.SubVolume.SubvolumeGroup]
+		val.subVolumeGroupMapping[volOptions.SubVolume.SubvolumeGroup] = append(
+			existingVolIDInMap,
+			volOptions.SubVolume.VolID)
+		fm[uniqueName] = val
+	}
+	fsk := map[string]core.FSQuiesceClient{}
+	var err error
+	defer func() {
+		if err != nil {
+			DestroyFSQuiesceClients(fsk)
+		}
+	}()
+	for k, v := range fm {
+		conn := &util.ClusterConnection{}
+		if err = conn.Connect(v.monitors, cr); err != nil {
+			return nil, err
+		}
+		fsk[k], err = core.NewFSQuiesce(v.fsName, v.volumes, v.subVolumeGroupMapping, conn, expiration)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get subvolume quiesce: %v", err)
+			conn.Destroy()
+
+			return nil, err
+		}
+	}
+
+	return fsk, nil
+}
+
+// DestroyFSQuiesceClients destroys connections of all FSQuiesceClient.
+func DestroyFSQuiesceClients(fsMap map[string]core.FSQuiesceClient) {
+	for _, fm := range fsMap {
+		if fm != nil {
+			fm.Destroy()
+		}
+	}
+}
@@ -25,11 +25,13 @@ import (
 	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
 	"github.com/ceph/ceph-csi/internal/cephfs/core"
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
 	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/journal"
 	kmsapi "github.com/ceph/ceph-csi/internal/kms"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/k8s"
@@ -38,6 +40,17 @@ import (
 
 const (
 	cephfsDefaultEncryptionType = util.EncryptionTypeFile
+
+	// TenantAuthIDKey is the key in the volume context of the cephx user of
+	// the tenant that mounts the volume.
+	TenantAuthIDKey = "tenantAuthID"
+
+	// SnapshotRetentionRetain keeps the snapshots of a subvolume when the
+	// volume is deleted, so that they can still be restored.
+	SnapshotRetentionRetain = "retain"
+	// SnapshotRetentionDelete deletes the snapshots of a subvolume when the
+	// volume is deleted.
+	SnapshotRetentionDelete = "delete"
 )
 
 type VolumeOptions struct {
@@ -57,6 +70,8 @@ type VolumeOptions struct {
 	KernelMountOptions   string `json:"kernelMountOptions"`
 	FuseMountOptions     string `json:"fuseMountOptions"`
 	NetNamespaceFilePath string
+	PinType              string
+	PinSetting           string
 	TopologyPools        *[]util.TopologyConstrainedPool
 	TopologyRequirement  *csi.TopologyRequirement
 	Topology             map[string]string
@@ -66,9 +81,23 @@ type VolumeOptions struct {
 	Encryption *util.VolumeEncryption
 	// Owner is the creator (tenant, Kubernetes Namespace) of the volume
 	Owner string
+	// TenantSecretName is the name of the Secret in the namespace of the
+	// Owner that gets the key of the cephx user of the tenant
+	TenantSecretName string
+	// TenantAuthID is the cephx user of the tenant that mounts the volume
+	TenantAuthID string
+	// SubvolumeGroupOptions are the settings to create the subvolumegroup
+	// with, when the group is set in the parameters
+	SubvolumeGroupOptions *core.SubVolumeGroupOptions
+	// SnapshotRetention is the policy for the snapshots of the subvolume
+	// when the volume is deleted, SnapshotRetentionRetain when empty
+	SnapshotRetention string
 
 	// conn is a connection to the Ceph cluster obtained from a ConnPool
 	conn *util.ClusterConnection
+	// dekSnapshot is the name of the subvolume snapshot for the options of
+	// snapshots, the DEK of encrypted snapshots is stored in its metadata
+	dekSnapshot string
 
 	ProvisionVolume bool `json:"provisionVolume"`
 	BackingSnapshot bool `json:"backingSnapshot"`
@@ -155,6 +184,20 @@ func (v *VolumeOptions) DetectMounter(options map[string]string) error {
 	return extractMounter(&v.Mounter, options)
 }
 
+func extractSnapshotRetention(dest *string, options map[string]string) error {
+	if err := extractOptionalOption(dest, "snapshotRetention", options); err != nil {
+		return err
+	}
+
+	switch *dest {
+	case "", SnapshotRetentionRetain, SnapshotRetentionDelete:
+		return nil
+	}
+
+	return fmt.Errorf("unknown snapshotRetention %q, use %q or %q",
+		*dest, SnapshotRetentionRetain, SnapshotRetentionDelete)
+}
+
 func extractMounter(dest *string, options map[string]string) error {
 	if err := extractOptionalOption(dest, "mounter", options); err != nil {
 		return err
@@ -221,6 +264,70 @@ func fmtBackingSnapshotOptionMismatch(optName, expected, actual string) error {
 		optName, actual, expected)
 }
 
+// subvolumeGroupParams are the parameters with the settings to create the
+// subvolumegroup of the StorageClass with.
+var subvolumeGroupParams = []string{
+	"subvolumeGroupMode",
+	"subvolumeGroupUID",
+	"subvolumeGroupGID",
+	"subvolumeGroupPinType",
+	"subvolumeGroupPinSetting",
+}
+
+// extractSubvolumeGroup sets the subvolumegroup of the parameters, and the
+// settings to create the group with when it does not exist. Without the
+// parameter the group of the CSI configuration is used, which is not created
+// by the driver.
+func extractSubvolumeGroup(opts *VolumeOptions, options map[string]string) error {
+	group := options["subvolumeGroup"]
+	if group == "" {
+		for _, param := range subvolumeGroupParams {
+			if options[param] != "" {
+				return fmt.Errorf("%s can only be set together with subvolumeGroup", param)
+			}
+		}
+
+		return nil
+	}
+
+	groupOpts := &core.SubVolumeGroupOptions{
+		PinType:    options["subvolumeGroupPinType"],
+		PinSetting: options["subvolumeGroupPinSetting"],
+	}
+
+	var err error
+	if mode := options["subvolumeGroupMode"]; mode != "" {
+		groupOpts.Mode, err = core.ParseSubVolumeGroupMode(mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	for param, dest := range map[string]*int{
+		"subvolumeGroupUID": &groupOpts.UID,
+		"subvolumeGroupGID": &groupOpts.GID,
+	} {
+		val, ok := options[param]
+		if !ok || val == "" {
+			continue
+		}
+
+		*dest, err = strconv.Atoi(val)
+		if err != nil || *dest < 0 {
+			return fmt.Errorf("invalid %s %q, needs to be a positive number", param, val)
+		}
+	}
+
+	if err = core.ValidatePin(groupOpts.PinType, groupOpts.PinSetting); err != nil {
+		return fmt.Errorf("invalid pin for subvolumegroup: %w", err)
+	}
+
+	opts.SubvolumeGroup = group
+	opts.SubvolumeGroupOptions = groupOpts
+
+	return nil
+}
+
 // getVolumeOptions validates the basic required basic options provided in the
 // volume parameters and extract the volumeOptions from volume parameters.
 // It contains the following checks:
@@ -295,10 +402,45 @@ func NewVolumeOptions(
 		return nil, err
 	}
 
+	if err = extractOptionalOption(&opts.PinType, "pinType", volOptions); err != nil {
+		return nil, err
+	}
+
+	if err = extractOptionalOption(&opts.PinSetting, "pinSetting", volOptions); err != nil {
+		return nil, err
+	}
+
+	if err = core.ValidatePin(opts.PinType, opts.PinSetting); err != nil {
+		return nil, err
+	}
+
+	if err = extractSnapshotRetention(&opts.SnapshotRetention, volOptions); err != nil {
+		return nil, err
+	}
+
+	if err = extractSubvolumeGroup(opts, volOptions); err != nil {
+		return nil, err
+	}
+
+	if err = extractOptionalOption(&opts.TenantSecretName, "tenantSecretName", volOptions); err != nil {
+		return nil, err
+	}
+
+	if opts.TenantSecretName != "" && opts.Owner == "" {
+		return nil, errors.New("tenantSecretName needs the namespace of the PVC in the parameters," +
+			" enable --extra-create-metadata of the csi-provisioner")
+	}
+
 	if err = opts.InitKMS(ctx, volOptions, req.GetSecrets()); err != nil {
 		return nil, fmt.Errorf("failed to init KMS: %w", err)
 	}
 
+	// the cephx user of the tenant can not take the lock that is needed to
+	// unlock fscrypt on the node
+	if opts.TenantSecretName != "" && opts.IsEncrypted() {
+		return nil, errors.New("tenantSecretName can not be combined with encryption")
+	}
+
 	if backingSnapshotBool != "" {
 		if opts.BackingSnapshot, err = strconv.ParseBool(backingSnapshotBool); err != nil {
 			return nil, fmt.Errorf("failed to parse backingSnapshot: %w", err)
@@ -323,19 +465,13 @@ func NewVolumeOptions(
 		return nil, err
 	}
 
-	// store topology information from the request
+	// store topology information from the request, the data pool of the
+	// subvolume is selected based on it when the volume is reserved
 	opts.TopologyPools, opts.TopologyRequirement, err = util.GetTopologyFromRequest(req)
 	if err != nil {
 		return nil, err
 	}
 
-	// TODO: we need an API to fetch subvolume attributes (size/datapool and others), based
-	// on which we can evaluate which topology this belongs to.
-	// CephFS tracker: https://tracker.ceph.com/issues/44277
-	if opts.TopologyPools != nil {
-		return nil, errors.New("topology based provisioning is not supported for CephFS backed volumes")
-	}
-
 	opts.ProvisionVolume = true
 
 	if opts.BackingSnapshot {
@@ -458,6 +594,18 @@ func NewVolumeOptionsFromVolID(
 	if err != nil {
 		return nil, nil, err
 	}
+
+	group, err := fetchSubvolumeGroup(ctx, j, volOptions.MetadataPool, vi.ObjectUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if group != "" {
+		volOptions.SubvolumeGroup = group
+	}
+	volOptions.SnapshotRetention, err = fetchSnapshotRetention(ctx, j, volOptions.MetadataPool, vi.ObjectUUID)
+	if err != nil {
+		return nil, nil, err
+	}
 	volOptions.RequestName = imageAttributes.RequestName
 	vid.FsSubvolName = imageAttributes.ImageName
 	volOptions.Owner = imageAttributes.Owner
@@ -683,6 +831,101 @@ func NewVolumeOptionsFromMonitorList(
 	return &opts, &vid, nil
 }
 
+// NewEphemeralVolumeOptions generates a new instance of VolumeOptions for a
+// generic ephemeral inline volume from the volume attributes in the Pod spec.
+// The subvolume that backs the inline volume is named subvolName.
+func NewEphemeralVolumeOptions(subvolName string, options map[string]string) (*VolumeOptions, error) {
+	opts, err := getVolumeOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = extractOptionalOption(&opts.Pool, "pool", options); err != nil {
+		return nil, err
+	}
+
+	if err = extractOptionalOption(&opts.KernelMountOptions, "kernelMountOptions", options); err != nil {
+		return nil, err
+	}
+
+	if err = extractOptionalOption(&opts.FuseMountOptions, "fuseMountOptions", options); err != nil {
+		return nil, err
+	}
+
+	if err = extractMounter(&opts.Mounter, options); err != nil {
+		return nil, err
+	}
+
+	if size := options["size"]; size != "" {
+		quantity, qErr := resource.ParseQuantity(size)
+		if qErr != nil {
+			return nil, fmt.Errorf("failed to parse size %q: %w", size, qErr)
+		}
+		opts.Size = util.RoundOffCephFSVolSize(quantity.Value())
+	}
+
+	opts.VolID = subvolName
+	opts.ProvisionVolume = true
+
+	return opts, nil
+}
+
+// NewVolumeOptionsFromTenantVolume generates a new instance of volumeOptions
+// and VolumeIdentifier from the provided CSI volume context of a provisioned
+// volume that is mounted by the cephx user of its tenant. That user can not
+// read the journal, so all the details are taken from the volume context.
+func NewVolumeOptionsFromTenantVolume(
+	volID string,
+	options, secrets map[string]string,
+) (*VolumeOptions, *VolumeIdentifier, error) {
+	var (
+		opts VolumeOptions
+		vid  VolumeIdentifier
+		err  error
+	)
+
+	opts.TenantAuthID = options[TenantAuthIDKey]
+	if opts.TenantAuthID == "" {
+		return nil, nil, fmt.Errorf("%s is not set in the volume context", TenantAuthIDKey)
+	}
+	opts.ProvisionVolume = true
+
+	clusterData, err := GetClusterInformation(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts.ClusterID = clusterData.ClusterID
+	opts.Monitors = strings.Join(clusterData.Monitors, ",")
+	opts.SubvolumeGroup = clusterData.CephFS.SubvolumeGroup
+	opts.Owner = k8s.GetOwner(options)
+
+	if err = extractOption(&opts.RootPath, "subvolumePath", options); err != nil {
+		return nil, nil, err
+	}
+
+	if err = extractOption(&opts.FsName, "fsName", options); err != nil {
+		return nil, nil, err
+	}
+
+	if err = extractOptionalOption(&opts.KernelMountOptions, "kernelMountOptions", options); err != nil {
+		return nil, nil, err
+	}
+
+	if err = extractOptionalOption(&opts.FuseMountOptions, "fuseMountOptions", options); err != nil {
+		return nil, nil, err
+	}
+
+	if err = extractMounter(&opts.Mounter, options); err != nil {
+		return nil, nil, err
+	}
+
+	vid.FsSubvolName = options["subvolumeName"]
+	vid.VolumeID = volID
+
+	return &opts, &vid, nil
+}
+
 // NewVolumeOptionsFromStaticVolume generates a new instance of volumeOptions and
 // VolumeIdentifier from the provided CSI volume context, if the provided context is
 // detected to be a statically provisioned volume.
@@ -842,12 +1085,21 @@ func NewSnapshotOptionsFromID(
 	if err != nil {
 		return &volOptions, nil, &sid, err
 	}
+
+	group, err := fetchSubvolumeGroup(ctx, j, volOptions.MetadataPool, vi.ObjectUUID)
+	if err != nil {
+		return &volOptions, nil, &sid, err
+	}
+	if group != "" {
+		volOptions.SubvolumeGroup = group
+	}
 	// storing request name in snapshot Identifier
 	sid.RequestName = imageAttributes.RequestName
 	sid.FsSnapshotName = imageAttributes.ImageName
 	sid.FsSubvolName = imageAttributes.SourceName
 
 	volOptions.SubVolume.VolID = sid.FsSubvolName
+	volOptions.dekSnapshot = sid.FsSnapshotName
 	volOptions.Owner = imageAttributes.Owner
 	vol := core.NewSubVolume(volOptions.conn, &volOptions.SubVolume, volOptions.ClusterID, clusterName, setMetadata)
 
@@ -865,6 +1117,15 @@ func NewSnapshotOptionsFromID(
 	volOptions.Features = subvolInfo.Features
 	volOptions.Size = subvolInfo.BytesQuota
 	volOptions.RootPath = subvolInfo.Path
+	if volOptions.RootPath == "" {
+		// the subvolume only retains its snapshots, use the path and size
+		// that were recorded when it was removed
+		volOptions.RootPath, volOptions.Size, err = fetchRetainedSubvolume(ctx, j,
+			volOptions.MetadataPool, vi.ObjectUUID)
+		if err != nil {
+			return &volOptions, nil, &sid, err
+		}
+	}
 	snap := core.NewSnapshot(volOptions.conn, sid.FsSnapshotName,
 		volOptions.ClusterID, clusterName, setMetadata, &volOptions.SubVolume)
 	info, err := snap.GetSnapshotInfo(ctx)
@@ -903,6 +1164,12 @@ func GenSnapFromOptions(ctx context.Context, req *csi.CreateSnapshotRequest) (*S
 		cephfsSnap.NamePrefix = namePrefix
 	}
 
+	label, err := k8s.GetSnapshotLabel(snapOptions)
+	if err != nil {
+		return nil, err
+	}
+	cephfsSnap.NamePrefix = journal.GetSnapshotNamePrefix(cephfsSnap.NamePrefix, label)
+
 	return cephfsSnap, nil
 }
 
@@ -955,23 +1222,19 @@ func (vo *VolumeOptions) CopyEncryptionConfig(ctx context.Context, cp *VolumeOpt
 		if errors.Is(err, util.ErrDEKStoreNeeded) {
 			_, err := vo.Encryption.KMS.GetSecret(ctx, "")
 			if errors.Is(err, kmsapi.ErrGetSecretUnsupported) {
-				return err
+				cp.Encryption.SetDEKStore(&subVolumeDEKStore{vo: cp})
 			}
 		}
 	}
 
-	if vo.Encryption.KMS.RequiresDEKStore() == kmsapi.DEKStoreIntegrated {
-		passphrase, err := vo.Encryption.GetCryptoPassphrase(ctx, vID)
-		if err != nil {
-			return fmt.Errorf("failed to fetch passphrase for %q (%+v): %w",
-				vID, vo, err)
-		}
+	// the subvolume of a clone does not exist yet, CopyDEK copies the DEK
+	// to its metadata once it has been created
+	if cp.StoresDEKInMetadata() && cp.dekSnapshot == "" {
+		return nil
+	}
 
-		err = cp.Encryption.StoreCryptoPassphrase(ctx, cpVID, passphrase)
-		if err != nil {
-			return fmt.Errorf("failed to store passphrase for %q (%+v): %w",
-				cpVID, cp, err)
-		}
+	if vo.Encryption.HasDEKStore() {
+		return vo.copyPassphrase(ctx, cp, vID, cpVID)
 	}
 
 	return nil
@@ -994,14 +1257,13 @@ func (vo *VolumeOptions) ConfigureEncryption(
 	vo.Encryption, err = util.NewVolumeEncryption(kmsID, kms)
 
 	if errors.Is(err, util.ErrDEKStoreNeeded) {
-		// fscrypt uses secrets directly from the KMS.
-		// Therefore we do not support an additional DEK
-		// store. Since not all "metadata" KMS support
-		// GetSecret, test for support here. Postpone any
-		// other error handling
+		// fscrypt uses secrets directly from the KMS. Not all
+		// "metadata" KMS support GetSecret, the DEK of the others
+		// is stored in the metadata of the subvolume. Postpone
+		// any other error handling
 		_, err := vo.Encryption.KMS.GetSecret(ctx, "")
 		if errors.Is(err, kmsapi.ErrGetSecretUnsupported) {
-			return err
+			vo.Encryption.SetDEKStore(&subVolumeDEKStore{vo: vo})
 		}
 	}
 
@@ -218,3 +218,148 @@ func TestIsShallowVolumeSupported(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractSubvolumeGroup(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		options   map[string]string
+		wantGroup string
+		wantMode  int
+		wantUID   int
+		wantErr   bool
+	}{
+		{
+			name:      "group of the configuration",
+			options:   map[string]string{},
+			wantGroup: "csi",
+		},
+		{
+			name:      "group of the parameters",
+			options:   map[string]string{"subvolumeGroup": "team-a"},
+			wantGroup: "team-a",
+		},
+		{
+			name: "group with mode and owner",
+			options: map[string]string{
+				"subvolumeGroup":     "team-a",
+				"subvolumeGroupMode": "0750",
+				"subvolumeGroupUID":  "1000",
+				"subvolumeGroupGID":  "1000",
+			},
+			wantGroup: "team-a",
+			wantMode:  0o750,
+			wantUID:   1000,
+		},
+		{
+			name: "group with pin",
+			options: map[string]string{
+				"subvolumeGroup":           "team-a",
+				"subvolumeGroupPinType":    "distributed",
+				"subvolumeGroupPinSetting": "1",
+			},
+			wantGroup: "team-a",
+		},
+		{
+			name:    "settings without group",
+			options: map[string]string{"subvolumeGroupMode": "0750"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid mode",
+			options: map[string]string{"subvolumeGroup": "team-a", "subvolumeGroupMode": "0980"},
+			wantErr: true,
+		},
+		{
+			name:    "negative uid",
+			options: map[string]string{"subvolumeGroup": "team-a", "subvolumeGroupUID": "-1"},
+			wantErr: true,
+		},
+		{
+			name: "invalid pin",
+			options: map[string]string{
+				"subvolumeGroup":        "team-a",
+				"subvolumeGroupPinType": "export",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			opts := &VolumeOptions{}
+			opts.SubvolumeGroup = "csi"
+			err := extractSubvolumeGroup(opts, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractSubvolumeGroup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if opts.SubvolumeGroup != tt.wantGroup {
+				t.Errorf("extractSubvolumeGroup() group = %q, want %q", opts.SubvolumeGroup, tt.wantGroup)
+			}
+			if opts.SubvolumeGroupOptions == nil {
+				return
+			}
+			if opts.SubvolumeGroupOptions.Mode != tt.wantMode {
+				t.Errorf("extractSubvolumeGroup() mode = %o, want %o", opts.SubvolumeGroupOptions.Mode, tt.wantMode)
+			}
+			if opts.SubvolumeGroupOptions.UID != tt.wantUID {
+				t.Errorf("extractSubvolumeGroup() uid = %d, want %d", opts.SubvolumeGroupOptions.UID, tt.wantUID)
+			}
+		})
+	}
+}
+
+func TestExtractSnapshotRetention(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		options   map[string]string
+		retention string
+		wantErr   bool
+	}{
+		{
+			name:      "not set",
+			options:   map[string]string{},
+			retention: "",
+		},
+		{
+			name:      "retain",
+			options:   map[string]string{"snapshotRetention": "retain"},
+			retention: SnapshotRetentionRetain,
+		},
+		{
+			name:      "delete",
+			options:   map[string]string{"snapshotRetention": "delete"},
+			retention: SnapshotRetentionDelete,
+		},
+		{
+			name:    "empty",
+			options: map[string]string{"snapshotRetention": ""},
+			wantErr: true,
+		},
+		{
+			name:    "unknown policy",
+			options: map[string]string{"snapshotRetention": "keep"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var retention string
+			err := extractSnapshotRetention(&retention, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extractSnapshotRetention() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if retention != tt.retention {
+				t.Errorf("extractSnapshotRetention() = %q, want %q", retention, tt.retention)
+			}
+		})
+	}
+}
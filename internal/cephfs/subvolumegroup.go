@@ -0,0 +1,48 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+)
+
+// ensureSubvolumeGroup creates the subvolumegroup that is set in the
+// StorageClass the first time it is used. Groups of the CSI configuration
+// are expected to exist.
+func (cs *ControllerServer) ensureSubvolumeGroup(ctx context.Context, volOptions *store.VolumeOptions) error {
+	if volOptions.SubvolumeGroupOptions == nil || volOptions.BackingSnapshot {
+		return nil
+	}
+
+	key := volOptions.ClusterID + "/" + volOptions.FsName + "/" + volOptions.SubvolumeGroup
+	if _, ok := cs.subvolumeGroups.Load(key); ok {
+		return nil
+	}
+
+	fs := core.NewFileSystem(volOptions.GetConnection())
+	err := fs.CreateSubVolumeGroup(ctx, volOptions.FsName, volOptions.SubvolumeGroup, volOptions.SubvolumeGroupOptions)
+	if err != nil {
+		return fmt.Errorf("failed to create subvolumegroup %q: %w", volOptions.SubvolumeGroup, err)
+	}
+	cs.subvolumeGroups.Store(key, true)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// errTenantCredentialsMismatch is returned when the node stage secrets of a
+// volume are not the ones of the cephx user of its tenant.
+var errTenantCredentialsMismatch = errors.New("node stage secrets are not for the cephx user of the tenant")
+
+// authorizeTenant gives the cephx user of the tenant that owns the volume
+// access to the subvolume, and stores the credentials of the user in the
+// Secret that is configured with the `tenantSecretName` parameter. The
+// Secret is created in the namespace of the tenant, so that it can be used as
+// node-stage secret of the volume.
+func authorizeTenant(
+	ctx context.Context,
+	volClient core.SubVolumeClient,
+	volOptions *store.VolumeOptions,
+) error {
+	if volOptions.TenantSecretName == "" || volOptions.BackingSnapshot {
+		return nil
+	}
+
+	key, err := volClient.AuthorizeVolume(ctx, volOptions.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to authorize tenant %s: %w", volOptions.Owner, err)
+	}
+
+	authID := core.TenantAuthID(volOptions.Owner)
+	err = k8s.StoreSecret(ctx, volOptions.Owner, volOptions.TenantSecretName, map[string]string{
+		"userID":  authID,
+		"userKey": key,
+	})
+	if err != nil {
+		return err
+	}
+	volOptions.TenantAuthID = authID
+	log.DebugLog(ctx, "cephfs: authorized %s for subvolume %s", authID, volOptions.VolID)
+
+	return nil
+}
@@ -29,7 +29,9 @@ import (
 )
 
 // This file provides functionality to store various mount information
-// in a file. It's currently used to restore ceph-fuse mounts.
+// in a file. It's currently used to restore ceph-fuse mounts, to remember the
+// mounter of staged volumes, and to remove the subvolumes of generic ephemeral
+// inline volumes.
 // Mount info is stored in `/csi/mountinfo`.
 
 const (
@@ -147,3 +149,120 @@ func RemoveNodeStageMountinfo(volID VolumeID) error {
 
 	return nil
 }
+
+// EphemeralMountinfo describes the subvolume of a generic ephemeral inline
+// volume. It is used to remove the subvolume once the volume is unpublished.
+type EphemeralMountinfo struct {
+	ClusterID      string            `json:",omitempty"`
+	FsName         string            `json:",omitempty"`
+	SubvolumeGroup string            `json:",omitempty"`
+	SubvolumeName  string            `json:",omitempty"`
+	Secrets        map[string]string `json:",omitempty"`
+}
+
+func fmtEphemeralMountinfoFilename(volID VolumeID) string {
+	return path.Join(mountinfoDir, fmt.Sprintf("ephemeral-%s.json", volID))
+}
+
+// WriteEphemeralMountinfo writes the ephemeral mount info to a file. Unlike
+// NodeStageMountinfo, the record is required to remove the subvolume again,
+// so a missing mountinfo directory is an error.
+func WriteEphemeralMountinfo(volID VolumeID, mi *EphemeralMountinfo) error {
+	bs, err := json.Marshal(mi)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fmtEphemeralMountinfoFilename(volID), bs, 0o600)
+}
+
+// GetEphemeralMountinfo tries to retrieve EphemeralMountinfo for `volID`.
+// If it doesn't exist, `(nil, nil)` is returned.
+func GetEphemeralMountinfo(volID VolumeID) (*EphemeralMountinfo, error) {
+	bs, err := os.ReadFile(fmtEphemeralMountinfoFilename(volID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	mi := &EphemeralMountinfo{}
+	if err = json.Unmarshal(bs, mi); err != nil {
+		return nil, err
+	}
+
+	return mi, nil
+}
+
+// RemoveEphemeralMountinfo tries to remove EphemeralMountinfo for `volID`.
+// If no such record exists for `volID`, it's considered success too.
+func RemoveEphemeralMountinfo(volID VolumeID) error {
+	if err := os.Remove(fmtEphemeralMountinfoFilename(volID)); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MounterMountinfo records the mounter that was selected for a staged volume,
+// so that later operations on the volume use the same mounter.
+type MounterMountinfo struct {
+	Mounter string `json:",omitempty"`
+	Reason  string `json:",omitempty"`
+}
+
+func fmtMounterMountinfoFilename(volID VolumeID) string {
+	return path.Join(mountinfoDir, fmt.Sprintf("mounter-%s.json", volID))
+}
+
+// WriteMounterMountinfo writes the selected mounter to a file. Like
+// NodeStageMountinfo, a missing mountinfo directory is not an error.
+func WriteMounterMountinfo(volID VolumeID, mi *MounterMountinfo) error {
+	bs, err := json.Marshal(mi)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(fmtMounterMountinfoFilename(volID), bs, 0o600)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// GetMounterMountinfo tries to retrieve MounterMountinfo for `volID`.
+// If it doesn't exist, `(nil, nil)` is returned.
+func GetMounterMountinfo(volID VolumeID) (*MounterMountinfo, error) {
+	bs, err := os.ReadFile(fmtMounterMountinfoFilename(volID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	mi := &MounterMountinfo{}
+	if err = json.Unmarshal(bs, mi); err != nil {
+		return nil, err
+	}
+
+	return mi, nil
+}
+
+// RemoveMounterMountinfo tries to remove MounterMountinfo for `volID`.
+// If no such record exists for `volID`, it's considered success too.
+func RemoveMounterMountinfo(volID VolumeID) error {
+	if err := os.Remove(fmtMounterMountinfoFilename(volID)); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -19,6 +19,7 @@ package cephfs
 import (
 	"fmt"
 
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
 	"github.com/ceph/ceph-csi/internal/util"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -81,6 +82,10 @@ func (cs *ControllerServer) validateCreateVolumeRequest(req *csi.CreateVolumeReq
 		}
 	}
 
+	if err = validateMountGroupPolicy(req.GetParameters()[mountGroupPolicyParam]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	return nil
 }
 
@@ -111,3 +116,31 @@ func (cs *ControllerServer) validateExpandVolumeRequest(req *csi.ControllerExpan
 
 	return nil
 }
+
+// validateModifyVolumeRequest validates the Controller ModifyVolume request.
+// Only the pinning of the subvolume can be modified, the other parameters
+// (like fsName, pool or the encryption) are immutable.
+func (cs *ControllerServer) validateModifyVolumeRequest(req *csi.ControllerModifyVolumeRequest) error {
+	if err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_MODIFY_VOLUME); err != nil {
+		return fmt.Errorf("invalid ModifyVolumeRequest: %w", err)
+	}
+
+	if req.GetVolumeId() == "" {
+		return status.Error(codes.InvalidArgument, "Volume ID cannot be empty")
+	}
+
+	params := req.GetMutableParameters()
+	for key := range params {
+		if key != pinTypeParam && key != pinSettingParam {
+			return status.Errorf(codes.InvalidArgument,
+				"parameter %q can not be modified on an existing volume, only %q and %q can be modified",
+				key, pinTypeParam, pinSettingParam)
+		}
+	}
+
+	if err := core.ValidatePin(params[pinTypeParam], params[pinSettingParam]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
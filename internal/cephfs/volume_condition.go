@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ControllerGetVolume returns the condition of the volume. The request has
+// no secrets, the provisioner credentials of the CSI configuration are used.
+// A volume that is reserved in the journal, but has no subvolume or backing
+// snapshot, is abnormal.
+func (cs *ControllerServer) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest,
+) (*csi.ControllerGetVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
+	}
+
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(volumeID); err != nil {
+		return nil, status.Errorf(codes.NotFound, "invalid volume ID %s: %v", volumeID, err)
+	}
+
+	secrets, err := configuredProvisionerSecrets(vi.ClusterID)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get credentials for volume %s: %v", volumeID, err)
+
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	volOptions, _, err := store.NewVolumeOptionsFromVolID(ctx, volumeID, nil, secrets, cs.ClusterName, cs.SetMetadata)
+	var condition *csi.VolumeCondition
+	switch {
+	case err == nil:
+		defer volOptions.Destroy()
+		condition = volumeCondition(volOptions)
+	case volOptions != nil && volOptions.BackingSnapshot && isRemovedError(err):
+		condition = &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("backing snapshot %s does not exist", volOptions.BackingSnapshotID),
+		}
+	case volOptions != nil && errors.Is(err, cerrors.ErrVolumeNotFound):
+		condition = &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("subvolume %s does not exist", volOptions.VolID),
+		}
+	case isRemovedError(err):
+		return nil, status.Errorf(codes.NotFound, "volume %s not found: %v", volumeID, err)
+	default:
+		log.ErrorLog(ctx, "failed to get the condition of volume %s: %v", volumeID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: volOptions.Size,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, nil
+}
+
+// volumeCondition returns the condition of a volume that has a subvolume or
+// backing snapshot. The volume is abnormal when the subvolume was removed
+// and only its snapshots are retained.
+func volumeCondition(volOptions *store.VolumeOptions) *csi.VolumeCondition {
+	if !volOptions.BackingSnapshot && volOptions.RootPath == "" {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("subvolume %s was removed, only its snapshots are retained", volOptions.VolID),
+		}
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is in a healthy condition",
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+)
+
+func TestVolumeCondition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		volOptions   store.VolumeOptions
+		wantAbnormal bool
+		wantMessage  string
+	}{
+		{
+			name: "subvolume",
+			volOptions: store.VolumeOptions{
+				RootPath:  "/volumes/csi/csi-vol-1/2c0b4a3e",
+				SubVolume: core.SubVolume{VolID: "csi-vol-1"},
+			},
+			wantAbnormal: false,
+			wantMessage:  "volume is in a healthy condition",
+		},
+		{
+			name: "subvolume with retained snapshots",
+			volOptions: store.VolumeOptions{
+				SubVolume: core.SubVolume{VolID: "csi-vol-1"},
+			},
+			wantAbnormal: true,
+			wantMessage:  "subvolume csi-vol-1 was removed, only its snapshots are retained",
+		},
+		{
+			name: "snapshot-backed volume",
+			volOptions: store.VolumeOptions{
+				BackingSnapshot: true,
+				RootPath:        "/volumes/csi/csi-vol-1/",
+			},
+			wantAbnormal: false,
+			wantMessage:  "volume is in a healthy condition",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			condition := volumeCondition(&tt.volOptions)
+			require.Equal(t, tt.wantAbnormal, condition.GetAbnormal())
+			require.Equal(t, tt.wantMessage, condition.GetMessage())
+		})
+	}
+}
@@ -17,6 +17,7 @@ package controller
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
 
@@ -43,6 +44,19 @@ type Config struct {
 	ClusterName string
 	InstanceID  string
 	SetMetadata bool
+
+	// GCInterval is the interval of the search for orphaned volumes,
+	// disabled when 0
+	GCInterval time.Duration
+	// GCGracePeriod is the time a volume needs to be orphaned before it
+	// is reported or deleted
+	GCGracePeriod time.Duration
+	// GCDelete is set to delete the orphaned volumes
+	GCDelete bool
+	// CloneTTL is the time after which a CephFS clone that is not checked
+	// by CreateVolume requests anymore is deleted, disabled when 0. It is
+	// independent of GCInterval.
+	CloneTTL time.Duration
 }
 
 // ControllerList holds the list of managers need to be started.
@@ -0,0 +1,316 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mirrorpeer contains the controller that creates and imports the
+// bootstrap tokens of rbd-mirror peers, which are requested with Secrets.
+package mirrorpeer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ctrl "github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// bootstrapLabel marks the Secrets that request a bootstrap operation,
+	// the value is the operation.
+	bootstrapLabel = "rbd.csi.ceph.com/mirror-peer-bootstrap"
+	// bootstrapStatusAnnotation is set on the Secret once the operation
+	// completed, the operation is not repeated afterwards.
+	bootstrapStatusAnnotation = "rbd.csi.ceph.com/mirror-peer-bootstrap-status"
+
+	// operationCreate creates a bootstrap token and stores it in the Secret.
+	operationCreate = "create"
+	// operationImport imports the bootstrap token of the Secret.
+	operationImport = "import"
+
+	// keys in the data of the Secrets.
+	clusterIDKey       = "clusterID"
+	poolKey            = "pool"
+	secretNameKey      = "secretName"
+	secretNamespaceKey = "secretNamespace"
+	tokenKey           = "token"
+	directionKey       = "direction"
+
+	// defaultDirection is the direction of imported peers when the Secret
+	// has none.
+	defaultDirection = "rx-tx"
+)
+
+// errInvalidRequest is returned for Secrets with an invalid request, they are
+// not retried until the Secret changes.
+var errInvalidRequest = errors.New("invalid mirror peer bootstrap request")
+
+// ReconcileMirrorPeer reconciles the Secrets with the bootstrapLabel in the
+// namespace of the driver.
+type ReconcileMirrorPeer struct {
+	client client.Client
+	// secrets reads the Secrets with the bootstrapLabel from the cache of
+	// the controller, which only contains these Secrets
+	secrets client.Reader
+	// apiReader reads the Secrets with the Ceph credentials, they are not
+	// cached
+	apiReader client.Reader
+	recorder  record.EventRecorder
+	config    ctrl.Config
+}
+
+// bootstrapRequest is the operation that a Secret requests.
+type bootstrapRequest struct {
+	operation string
+	clusterID string
+	pool      string
+	// secretName and secretNamespace locate the Secret with the Ceph
+	// credentials for the operation.
+	secretName      string
+	secretNamespace string
+	// token and direction are only used by imports.
+	token     string
+	direction string
+}
+
+var (
+	_ reconcile.Reconciler = &ReconcileMirrorPeer{}
+	_ ctrl.Manager         = &ReconcileMirrorPeer{}
+)
+
+// Init will add the ReconcileMirrorPeer to the list.
+func Init() {
+	ctrl.ControllerList = append(ctrl.ControllerList, &ReconcileMirrorPeer{})
+}
+
+// Add adds the ReconcileMirrorPeer to the manager, it watches the Secrets
+// with the bootstrapLabel in the namespace of the driver. The Secrets are
+// watched with a cache of their own, the cache of the manager would watch
+// all Secrets of the cluster.
+func (r *ReconcileMirrorPeer) Add(mgr manager.Manager, config ctrl.Config) error {
+	secretCache, err := newSecretCache(mgr, config.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create the cache of the secrets: %w", err)
+	}
+	err = mgr.Add(secretCache)
+	if err != nil {
+		return err
+	}
+
+	rmp := &ReconcileMirrorPeer{
+		client:    mgr.GetClient(),
+		secrets:   secretCache,
+		apiReader: mgr.GetAPIReader(),
+		recorder:  mgr.GetEventRecorderFor("mirror-peer-controller"),
+		config:    config,
+	}
+
+	c, err := controller.New(
+		"mirror-peer-controller",
+		mgr,
+		controller.Options{MaxConcurrentReconciles: 1, Reconciler: rmp})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(source.Kind(
+		secretCache,
+		&corev1.Secret{},
+		&handler.TypedEnqueueRequestForObject[*corev1.Secret]{},
+		predicate.NewTypedPredicateFuncs(func(secret *corev1.Secret) bool {
+			_, ok := secret.Labels[bootstrapLabel]
+
+			return ok && secret.Namespace == config.Namespace
+		})),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to watch the changes: %w", err)
+	}
+
+	return nil
+}
+
+// newSecretCache returns a cache that only contains the Secrets with the
+// bootstrapLabel in the namespace.
+func newSecretCache(mgr manager.Manager, namespace string) (cache.Cache, error) {
+	requirement, err := labels.NewRequirement(bootstrapLabel, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return cache.New(mgr.GetConfig(), cache.Options{
+		HTTPClient:           mgr.GetHTTPClient(),
+		Scheme:               mgr.GetScheme(),
+		Mapper:               mgr.GetRESTMapper(),
+		DefaultNamespaces:    map[string]cache.Config{namespace: {}},
+		DefaultLabelSelector: labels.NewSelector().Add(*requirement),
+	})
+}
+
+// parseBootstrapRequest returns the operation that the Secret requests.
+func parseBootstrapRequest(secret *corev1.Secret) (*bootstrapRequest, error) {
+	req := &bootstrapRequest{
+		operation:       secret.Labels[bootstrapLabel],
+		clusterID:       string(secret.Data[clusterIDKey]),
+		pool:            string(secret.Data[poolKey]),
+		secretName:      string(secret.Data[secretNameKey]),
+		secretNamespace: string(secret.Data[secretNamespaceKey]),
+		token:           string(secret.Data[tokenKey]),
+		direction:       string(secret.Data[directionKey]),
+	}
+
+	switch req.operation {
+	case operationCreate:
+	case operationImport:
+		if req.token == "" {
+			return nil, fmt.Errorf("%w: %q is required to import a bootstrap token", errInvalidRequest, tokenKey)
+		}
+		if req.direction == "" {
+			req.direction = defaultDirection
+		}
+		if err := rbd.ValidateMirrorPeerDirection(req.direction); err != nil {
+			return nil, fmt.Errorf("%w: %w", errInvalidRequest, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s %q is not %q or %q",
+			errInvalidRequest, bootstrapLabel, req.operation, operationCreate, operationImport)
+	}
+
+	if req.clusterID == "" || req.pool == "" {
+		return nil, fmt.Errorf("%w: %q and %q are required", errInvalidRequest, clusterIDKey, poolKey)
+	}
+	if req.secretName == "" || req.secretNamespace == "" {
+		return nil, fmt.Errorf("%w: %q and %q are required", errInvalidRequest, secretNameKey, secretNamespaceKey)
+	}
+
+	return req, nil
+}
+
+// getCredentials returns the Ceph credentials of the Secret.
+func (r *ReconcileMirrorPeer) getCredentials(ctx context.Context, name, namespace string) (*util.Credentials, error) {
+	secret := &corev1.Secret{}
+	err := r.apiReader.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s in namespace %s: %w", name, namespace, err)
+	}
+
+	credentials := map[string]string{}
+	for key, value := range secret.Data {
+		credentials[key] = string(value)
+	}
+
+	return util.NewUserCredentials(credentials)
+}
+
+// reconcileSecret runs the operation of the Secret, and marks the Secret as
+// done. Created tokens are stored in the Secret.
+func (r *ReconcileMirrorPeer) reconcileSecret(ctx context.Context, secret *corev1.Secret) error {
+	req, err := parseBootstrapRequest(secret)
+	if err != nil {
+		return err
+	}
+
+	cr, err := r.getCredentials(ctx, req.secretName, req.secretNamespace)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	switch req.operation {
+	case operationCreate:
+		token, cErr := rbd.CreateMirrorPeerBootstrapToken(ctx, req.clusterID, req.pool, cr)
+		if cErr != nil {
+			return cErr
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[tokenKey] = []byte(token)
+	case operationImport:
+		err = rbd.ImportMirrorPeerBootstrapToken(ctx, req.clusterID, req.pool, req.direction, req.token, cr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[bootstrapStatusAnnotation] = "done"
+	err = r.client.Patch(ctx, secret, patch)
+	if err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	log.DebugLog(ctx, "%s of mirror peer bootstrap token for pool %q of cluster %q completed",
+		req.operation, req.pool, req.clusterID)
+
+	return nil
+}
+
+// Reconcile creates or imports the bootstrap token of the Secret, once.
+func (r *ReconcileMirrorPeer) Reconcile(ctx context.Context,
+	request reconcile.Request,
+) (reconcile.Result, error) {
+	secret := &corev1.Secret{}
+	err := r.secrets.Get(ctx, request.NamespacedName, secret)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, err
+	}
+	if !secret.GetDeletionTimestamp().IsZero() {
+		return reconcile.Result{}, nil
+	}
+	if _, ok := secret.Annotations[bootstrapStatusAnnotation]; ok {
+		return reconcile.Result{}, nil
+	}
+
+	err = r.reconcileSecret(ctx, secret)
+	if err != nil {
+		log.ErrorLogMsg("failed mirror peer bootstrap of secret %s: %v", request.NamespacedName, err)
+		r.recorder.Event(secret, corev1.EventTypeWarning, "MirrorPeerBootstrapFailed", err.Error())
+		if errors.Is(err, errInvalidRequest) {
+			// retrying does not help, the Secret needs to be changed
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, err
+	}
+	r.recorder.Event(secret, corev1.EventTypeNormal, "MirrorPeerBootstrapped",
+		fmt.Sprintf("%s of the mirror peer bootstrap token completed", secret.Labels[bootstrapLabel]))
+
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mirrorpeer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseBootstrapRequest(t *testing.T) {
+	t.Parallel()
+
+	secret := func(operation string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{bootstrapLabel: operation},
+			},
+			Data: map[string][]byte{
+				clusterIDKey:       []byte("cluster-1"),
+				poolKey:            []byte("replicapool"),
+				secretNameKey:      []byte("csi-rbd-secret"),
+				secretNamespaceKey: []byte("default"),
+			},
+		}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+
+		return s
+	}
+
+	tests := []struct {
+		name          string
+		secret        *corev1.Secret
+		wantDirection string
+		wantErr       bool
+	}{
+		{
+			name:   "create",
+			secret: secret(operationCreate, nil),
+		},
+		{
+			name:          "import with default direction",
+			secret:        secret(operationImport, map[string]string{tokenKey: "eyJmc2lkIjoi"}),
+			wantDirection: defaultDirection,
+		},
+		{
+			name: "import rx-only",
+			secret: secret(operationImport, map[string]string{
+				tokenKey:     "eyJmc2lkIjoi",
+				directionKey: "rx-only",
+			}),
+			wantDirection: "rx-only",
+		},
+		{
+			name: "import with invalid direction",
+			secret: secret(operationImport, map[string]string{
+				tokenKey:     "eyJmc2lkIjoi",
+				directionKey: "tx-only",
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "import without token",
+			secret:  secret(operationImport, nil),
+			wantErr: true,
+		},
+		{
+			name:    "unknown operation",
+			secret:  secret("delete", nil),
+			wantErr: true,
+		},
+		{
+			name:    "without pool",
+			secret:  secret(operationCreate, map[string]string{poolKey: ""}),
+			wantErr: true,
+		},
+		{
+			name:    "without credentials",
+			secret:  secret(operationCreate, map[string]string{secretNameKey: ""}),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := parseBootstrapRequest(tt.secret)
+			if tt.wantErr {
+				require.ErrorIs(t, err, errInvalidRequest)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.secret.Labels[bootstrapLabel], req.operation)
+			require.Equal(t, "replicapool", req.pool)
+			require.Equal(t, tt.wantDirection, req.direction)
+		})
+	}
+}
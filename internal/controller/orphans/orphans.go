@@ -0,0 +1,441 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package orphans contains the controller that searches for volumes in the
+// Ceph clusters that have no PersistentVolume anymore.
+package orphans
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	ctrl "github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+	"github.com/ceph/ceph-csi/internal/util/volumeid"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// parameters of the StorageClasses that locate the volumes.
+const (
+	clusterIDParam   = "clusterID"
+	poolParam        = "pool"
+	journalPoolParam = "journalPool"
+	fsNameParam      = "fsName"
+)
+
+// cloneCheckInterval is the interval of the search for abandoned CephFS
+// clones when the search for orphaned volumes is disabled.
+const cloneCheckInterval = time.Hour
+
+// OrphanCollector periodically lists the volumes in the journals of the
+// pools and filesystems of the StorageClasses of the driver, and reports
+// or deletes the volumes that have no PersistentVolume.
+type OrphanCollector struct {
+	reader   client.Reader
+	recorder record.EventRecorder
+	config   ctrl.Config
+	// firstSeen contains the time when a volume was found without
+	// PersistentVolume, by volume ID.
+	firstSeen map[string]time.Time
+}
+
+// location is a pool or filesystem of a cluster that contains volumes of
+// the driver.
+type location struct {
+	clusterID   string
+	pool        string
+	journalPool string
+	fsName      string
+	// storageClass is one of the StorageClasses of the location, the
+	// events for the orphaned volumes are recorded on it.
+	storageClass *storagev1.StorageClass
+}
+
+var _ ctrl.Manager = &OrphanCollector{}
+
+// Init will add the OrphanCollector to the list.
+func Init() {
+	ctrl.ControllerList = append(ctrl.ControllerList, &OrphanCollector{})
+}
+
+// Add adds the OrphanCollector to the manager when the search for orphaned
+// volumes or the deletion of abandoned clones is enabled. It only runs on
+// the leader.
+func (oc *OrphanCollector) Add(mgr manager.Manager, config ctrl.Config) error {
+	if collectInterval(config) == 0 {
+		return nil
+	}
+
+	c := &OrphanCollector{
+		reader:    mgr.GetAPIReader(),
+		recorder:  mgr.GetEventRecorderFor("orphan-collector"),
+		config:    config,
+		firstSeen: map[string]time.Time{},
+	}
+
+	return mgr.Add(manager.RunnableFunc(c.run))
+}
+
+// collectInterval returns the interval of the collector. Abandoned clones
+// are searched every cloneCheckInterval when only their deletion is
+// enabled. The collector is disabled when 0 is returned.
+func collectInterval(config ctrl.Config) time.Duration {
+	if config.GCInterval != 0 {
+		return config.GCInterval
+	}
+	if config.CloneTTL != 0 {
+		return cloneCheckInterval
+	}
+
+	return 0
+}
+
+// run searches for orphaned volumes and abandoned clones every
+// collectInterval until the context is done.
+func (oc *OrphanCollector) run(ctx context.Context) error {
+	ticker := time.NewTicker(collectInterval(oc.config))
+	defer ticker.Stop()
+
+	for {
+		oc.collect(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// name returns the name of the location for logs and metrics.
+func (l *location) name() string {
+	if l.fsName != "" {
+		return l.fsName
+	}
+
+	return l.pool
+}
+
+// listVolumes returns the IDs of the volumes that are reserved in the
+// journal of the location.
+func (l *location) listVolumes(ctx context.Context) ([]string, error) {
+	if l.fsName != "" {
+		return cephfs.ListJournaledVolumes(ctx, l.clusterID, l.fsName)
+	}
+
+	return rbd.ListJournaledVolumes(ctx, l.clusterID, l.pool, l.journalPool)
+}
+
+// deleteVolume removes the orphaned volume of the location.
+func (oc *OrphanCollector) deleteVolume(ctx context.Context, l *location, volumeID string) error {
+	if l.fsName != "" {
+		return cephfs.DeleteOrphanedVolume(ctx, volumeID, oc.config.ClusterName, oc.config.SetMetadata)
+	}
+
+	return rbd.DeleteOrphanedVolume(ctx, volumeID)
+}
+
+// collect searches the locations of the StorageClasses for orphaned volumes
+// and abandoned clones. Orphaned volumes are only searched when GCInterval
+// is set. Volumes that are not orphaned anymore, or are in a location that
+// can not be listed, start a new grace period when they are found again.
+func (oc *OrphanCollector) collect(ctx context.Context) {
+	locations, err := oc.listLocations(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to list the StorageClasses: %v", err)
+
+		return
+	}
+
+	searchOrphans := oc.config.GCInterval != 0
+	uuids := map[string]bool{}
+	if searchOrphans {
+		uuids, err = oc.listVolumeUUIDs(ctx)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to list the PersistentVolumes: %v", err)
+
+			return
+		}
+	}
+
+	now := time.Now()
+	seen := map[string]time.Time{}
+	for _, l := range locations {
+		if !searchOrphans && l.fsName == "" {
+			// only CephFS volumes have abandoned clones
+			continue
+		}
+
+		volumeIDs := []string{}
+		if searchOrphans {
+			volumeIDs, err = l.listVolumes(ctx)
+			if err != nil {
+				log.ErrorLog(ctx, "failed to list the volumes of %q in cluster %q: %v", l.name(), l.clusterID, err)
+
+				continue
+			}
+		}
+
+		volumeIDs, err = oc.collectClones(ctx, l, volumeIDs, now)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to list the clones of %q in cluster %q: %v", l.name(), l.clusterID, err)
+
+			continue
+		}
+		if !searchOrphans {
+			continue
+		}
+
+		orphaned := findOrphans(volumeIDs, uuids, oc.firstSeen, seen, now, oc.config.GCGracePeriod)
+		metrics.SetOrphanedVolumes(l.clusterID, l.name(), len(orphaned))
+		for _, volumeID := range orphaned {
+			oc.handleOrphan(ctx, l, volumeID, seen)
+		}
+	}
+	oc.firstSeen = seen
+}
+
+// collectClones returns the volumeIDs without the CephFS clones that are not
+// complete, they have no PersistentVolume yet. Clones that were not checked
+// by a CreateVolume request for longer than the CloneTTL are abandoned and
+// deleted.
+func (oc *OrphanCollector) collectClones(
+	ctx context.Context,
+	l *location,
+	volumeIDs []string,
+	now time.Time,
+) ([]string, error) {
+	if l.fsName == "" {
+		return volumeIDs, nil
+	}
+
+	clones, err := cephfs.ListJournaledClones(ctx, l.clusterID, l.fsName)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, abandoned := splitClones(volumeIDs, clones, now, oc.config.CloneTTL)
+	for _, volumeID := range abandoned {
+		err = cephfs.DeleteAbandonedClone(ctx, volumeID, oc.config.ClusterName, oc.config.SetMetadata)
+		metrics.CountAbandonedCloneDeletion(l.clusterID, err)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to delete abandoned clone %s: %v", volumeID, err)
+			oc.recorder.Eventf(l.storageClass, corev1.EventTypeWarning, "AbandonedCloneDeleteFailed",
+				"failed to delete clone %s in %q: %v", volumeID, l.name(), err)
+
+			continue
+		}
+
+		log.DefaultLog("deleted abandoned clone %s in %q of cluster %q", volumeID, l.name(), l.clusterID)
+		oc.recorder.Eventf(l.storageClass, corev1.EventTypeNormal, "AbandonedCloneDeleted",
+			"deleted clone %s in %q", volumeID, l.name())
+	}
+
+	return volumes, nil
+}
+
+// splitClones returns the volumeIDs that are not in clones, and the clones
+// that are abandoned for longer than the ttl. No clone is abandoned when the
+// ttl is 0.
+func splitClones(
+	volumeIDs []string,
+	clones map[string]string,
+	now time.Time,
+	ttl time.Duration,
+) ([]string, []string) {
+	volumes := make([]string, 0, len(volumeIDs))
+	for _, volumeID := range volumeIDs {
+		if _, ok := clones[volumeID]; !ok {
+			volumes = append(volumes, volumeID)
+		}
+	}
+
+	abandoned := []string{}
+	if ttl == 0 {
+		return volumes, abandoned
+	}
+	for volumeID, lastAttempt := range clones {
+		if store.IsCloneAbandoned(lastAttempt, now, ttl) {
+			abandoned = append(abandoned, volumeID)
+		}
+	}
+	sort.Strings(abandoned)
+
+	return volumes, abandoned
+}
+
+// handleOrphan reports the orphaned volume, and deletes it when GCDelete is
+// set. Deleted volumes are removed from seen.
+func (oc *OrphanCollector) handleOrphan(ctx context.Context, l *location, volumeID string, seen map[string]time.Time) {
+	if !oc.config.GCDelete {
+		log.WarningLog(ctx, "volume %s in %q of cluster %q has no PersistentVolume since %s",
+			volumeID, l.name(), l.clusterID, seen[volumeID].Format(time.RFC3339))
+		oc.recorder.Eventf(l.storageClass, corev1.EventTypeWarning, "OrphanedVolume",
+			"volume %s in %q has no PersistentVolume", volumeID, l.name())
+
+		return
+	}
+
+	err := oc.deleteVolume(ctx, l, volumeID)
+	metrics.CountOrphanedVolumeDeletion(l.clusterID, err)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to delete orphaned volume %s: %v", volumeID, err)
+		oc.recorder.Eventf(l.storageClass, corev1.EventTypeWarning, "OrphanedVolumeDeleteFailed",
+			"failed to delete volume %s in %q: %v", volumeID, l.name(), err)
+
+		return
+	}
+
+	log.DefaultLog("deleted orphaned volume %s in %q of cluster %q", volumeID, l.name(), l.clusterID)
+	oc.recorder.Eventf(l.storageClass, corev1.EventTypeNormal, "OrphanedVolumeDeleted",
+		"deleted volume %s in %q", volumeID, l.name())
+	delete(seen, volumeID)
+}
+
+// listLocations returns the pools and filesystems of the StorageClasses of
+// the driver, each location once.
+func (oc *OrphanCollector) listLocations(ctx context.Context) ([]*location, error) {
+	scList := &storagev1.StorageClassList{}
+	if err := oc.reader.List(ctx, scList); err != nil {
+		return nil, err
+	}
+
+	return storageClassLocations(oc.config.DriverName, scList.Items), nil
+}
+
+// storageClassLocations returns the locations of the StorageClasses of the
+// driver, sorted by cluster and name. StorageClasses without clusterID, or
+// without pool or fsName are skipped.
+func storageClassLocations(driverName string, storageClasses []storagev1.StorageClass) []*location {
+	locations := map[string]*location{}
+	for i := range storageClasses {
+		sc := &storageClasses[i]
+		if sc.Provisioner != driverName {
+			continue
+		}
+
+		l := &location{
+			clusterID:    sc.Parameters[clusterIDParam],
+			pool:         sc.Parameters[poolParam],
+			journalPool:  sc.Parameters[journalPoolParam],
+			fsName:       sc.Parameters[fsNameParam],
+			storageClass: sc,
+		}
+		if l.fsName != "" {
+			l.pool, l.journalPool = "", ""
+		}
+		if l.clusterID == "" || l.name() == "" {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s/%s/%s", l.clusterID, l.pool, l.journalPool, l.fsName)
+		if _, ok := locations[key]; !ok {
+			locations[key] = l
+		}
+	}
+
+	sorted := make([]*location, 0, len(locations))
+	for _, l := range locations {
+		sorted = append(sorted, l)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].clusterID != sorted[j].clusterID {
+			return sorted[i].clusterID < sorted[j].clusterID
+		}
+
+		return sorted[i].name() < sorted[j].name()
+	})
+
+	return sorted
+}
+
+// listVolumeUUIDs returns the object UUIDs of the volume handles of the
+// PersistentVolumes of the driver. The UUIDs are compared instead of the
+// handles, the handles of PersistentVolumes that were restored on another
+// cluster can contain a different clusterID and pool ID.
+func (oc *OrphanCollector) listVolumeUUIDs(ctx context.Context) (map[string]bool, error) {
+	pvList := &corev1.PersistentVolumeList{}
+	if err := oc.reader.List(ctx, pvList); err != nil {
+		return nil, err
+	}
+
+	return volumeUUIDs(oc.config.DriverName, pvList.Items), nil
+}
+
+// volumeUUIDs returns the object UUIDs of the volume handles of the
+// PersistentVolumes of the driver. Handles that can not be decoded, like the
+// ones of static volumes, are skipped.
+func volumeUUIDs(driverName string, pvs []corev1.PersistentVolume) map[string]bool {
+	uuids := map[string]bool{}
+	for i := range pvs {
+		csiSource := pvs[i].Spec.CSI
+		if csiSource == nil || csiSource.Driver != driverName {
+			continue
+		}
+
+		handle, err := volumeid.Decode(csiSource.VolumeHandle)
+		if err != nil {
+			continue
+		}
+		uuids[handle.ObjectUUID] = true
+	}
+
+	return uuids
+}
+
+// findOrphans returns the volumeIDs that have no PersistentVolume with their
+// UUID for longer than the gracePeriod. The time when a volume was found
+// without PersistentVolume is taken from firstSeen, or is now for new
+// volumes, and is recorded in seen.
+func findOrphans(
+	volumeIDs []string,
+	uuids map[string]bool,
+	firstSeen, seen map[string]time.Time,
+	now time.Time,
+	gracePeriod time.Duration,
+) []string {
+	orphaned := []string{}
+	for _, volumeID := range volumeIDs {
+		handle, err := volumeid.Decode(volumeID)
+		if err != nil || uuids[handle.ObjectUUID] {
+			continue
+		}
+
+		since, ok := firstSeen[volumeID]
+		if !ok {
+			since = now
+		}
+		seen[volumeID] = since
+
+		if now.Sub(since) >= gracePeriod {
+			orphaned = append(orphaned, volumeID)
+		}
+	}
+	sort.Strings(orphaned)
+
+	return orphaned
+}
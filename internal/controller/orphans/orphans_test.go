@@ -0,0 +1,180 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package orphans
+
+import (
+	"testing"
+	"time"
+
+	ctrl "github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/util/volumeid"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+)
+
+func testVolumeID(t *testing.T, uuid string) string {
+	t.Helper()
+
+	volumeID, err := volumeid.Handle{
+		Version:    volumeid.DefaultVersion,
+		ClusterID:  "cluster-1",
+		LocationID: 2,
+		ObjectUUID: uuid,
+	}.Encode()
+	require.NoError(t, err)
+
+	return volumeID
+}
+
+func TestFindOrphans(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	inUse := testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110001")
+	newOrphan := testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110002")
+	oldOrphan := testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110003")
+
+	firstSeen := map[string]time.Time{
+		oldOrphan: now.Add(-2 * time.Hour),
+		// in use again, it is not carried over
+		inUse: now.Add(-2 * time.Hour),
+	}
+	seen := map[string]time.Time{}
+	uuids := map[string]bool{"b0285c97-a0ce-11ea-8ed4-0242ac110001": true}
+
+	orphaned := findOrphans([]string{inUse, newOrphan, oldOrphan, "invalid"}, uuids, firstSeen, seen, now, time.Hour)
+	require.Equal(t, []string{oldOrphan}, orphaned)
+	require.Equal(t, map[string]time.Time{
+		newOrphan: now,
+		oldOrphan: now.Add(-2 * time.Hour),
+	}, seen)
+
+	// without grace period new orphans are returned immediately
+	orphaned = findOrphans([]string{newOrphan}, uuids, map[string]time.Time{}, map[string]time.Time{}, now, 0)
+	require.Equal(t, []string{newOrphan}, orphaned)
+}
+
+func TestSplitClones(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	volume := testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110001")
+	clone := testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110002")
+	abandonedClone := testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110003")
+	clones := map[string]string{
+		clone:          "2024-05-01T11:00:00Z",
+		abandonedClone: "2024-04-29T11:00:00Z",
+	}
+
+	volumes, abandoned := splitClones([]string{volume, clone, abandonedClone}, clones, now, 24*time.Hour)
+	require.Equal(t, []string{volume}, volumes)
+	require.Equal(t, []string{abandonedClone}, abandoned)
+
+	// clones are not deleted without ttl
+	volumes, abandoned = splitClones([]string{volume, clone, abandonedClone}, clones, now, 0)
+	require.Equal(t, []string{volume}, volumes)
+	require.Empty(t, abandoned)
+}
+
+func TestCollectInterval(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config ctrl.Config
+		want   time.Duration
+	}{
+		{
+			name:   "orphans and clones",
+			config: ctrl.Config{GCInterval: 30 * time.Minute, CloneTTL: 24 * time.Hour},
+			want:   30 * time.Minute,
+		},
+		{
+			name:   "only orphans",
+			config: ctrl.Config{GCInterval: 30 * time.Minute},
+			want:   30 * time.Minute,
+		},
+		{
+			name:   "only clones",
+			config: ctrl.Config{CloneTTL: 24 * time.Hour},
+			want:   cloneCheckInterval,
+		},
+		{
+			name:   "disabled",
+			config: ctrl.Config{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, collectInterval(tt.config))
+		})
+	}
+}
+
+func TestStorageClassLocations(t *testing.T) {
+	t.Parallel()
+
+	sc := func(name, provisioner string, params map[string]string) storagev1.StorageClass {
+		s := storagev1.StorageClass{Provisioner: provisioner, Parameters: params}
+		s.Name = name
+
+		return s
+	}
+	storageClasses := []storagev1.StorageClass{
+		sc("rbd-a", "rbd.csi.ceph.com", map[string]string{"clusterID": "c2", "pool": "replicapool"}),
+		sc("rbd-b", "rbd.csi.ceph.com", map[string]string{"clusterID": "c2", "pool": "replicapool"}),
+		sc("rbd-c", "rbd.csi.ceph.com", map[string]string{"clusterID": "c1", "pool": "ec", "journalPool": "meta"}),
+		sc("no-cluster", "rbd.csi.ceph.com", map[string]string{"pool": "replicapool"}),
+		sc("no-pool", "rbd.csi.ceph.com", map[string]string{"clusterID": "c1"}),
+		sc("other", "cephfs.csi.ceph.com", map[string]string{"clusterID": "c1", "fsName": "myfs"}),
+	}
+
+	locations := storageClassLocations("rbd.csi.ceph.com", storageClasses)
+	require.Len(t, locations, 2)
+	require.Equal(t, "c1", locations[0].clusterID)
+	require.Equal(t, "ec", locations[0].pool)
+	require.Equal(t, "meta", locations[0].journalPool)
+	require.Equal(t, "c2", locations[1].clusterID)
+	require.Equal(t, "replicapool", locations[1].name())
+	require.Equal(t, "rbd-a", locations[1].storageClass.Name)
+
+	locations = storageClassLocations("cephfs.csi.ceph.com", storageClasses)
+	require.Len(t, locations, 1)
+	require.Equal(t, "myfs", locations[0].name())
+}
+
+func TestVolumeUUIDs(t *testing.T) {
+	t.Parallel()
+
+	pv := func(driver, handle string) corev1.PersistentVolume {
+		p := corev1.PersistentVolume{}
+		p.Spec.CSI = &corev1.CSIPersistentVolumeSource{Driver: driver, VolumeHandle: handle}
+
+		return p
+	}
+	pvs := []corev1.PersistentVolume{
+		pv("rbd.csi.ceph.com", testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110001")),
+		pv("rbd.csi.ceph.com", "static-image"),
+		pv("cephfs.csi.ceph.com", testVolumeID(t, "b0285c97-a0ce-11ea-8ed4-0242ac110002")),
+		{},
+	}
+
+	require.Equal(t, map[string]bool{"b0285c97-a0ce-11ea-8ed4-0242ac110001": true}, volumeUUIDs("rbd.csi.ceph.com", pvs))
+}
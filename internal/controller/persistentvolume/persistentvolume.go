@@ -65,7 +65,7 @@ func newPVReconciler(mgr manager.Manager, config ctrl.Config) reconcile.Reconcil
 	r := &ReconcilePersistentVolume{
 		client: mgr.GetClient(),
 		config: config,
-		Locks:  util.NewVolumeLocks(),
+		Locks:  util.NewNamedVolumeLocks("persistentvolume"),
 	}
 
 	return r
@@ -169,10 +169,11 @@ func (r *ReconcilePersistentVolume) reconcilePV(ctx context.Context, obj runtime
 	}
 
 	// Take lock to process only one volumeHandle at a time.
-	if ok := r.Locks.TryAcquire(pv.Spec.CSI.VolumeHandle); !ok {
+	token, ok := r.Locks.TryAcquire(pv.Spec.CSI.VolumeHandle)
+	if !ok {
 		return fmt.Errorf(util.VolumeOperationAlreadyExistsFmt, pv.Spec.CSI.VolumeHandle)
 	}
-	defer r.Locks.Release(pv.Spec.CSI.VolumeHandle)
+	defer r.Locks.Release(pv.Spec.CSI.VolumeHandle, token)
 
 	cr, err := r.getCredentials(ctx, secretName, secretNamespace)
 	if err != nil {
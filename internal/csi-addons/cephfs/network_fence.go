@@ -79,7 +79,7 @@ func (fcs *FenceControllerServer) FenceClusterNetwork(
 
 	nwFence, err := nf.NewNetworkFence(ctx, cr, req.GetCidrs(), req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = nwFence.AddClientEviction(ctx)
@@ -87,6 +87,8 @@ func (fcs *FenceControllerServer) FenceClusterNetwork(
 		return nil, status.Errorf(codes.Internal, "failed to fence CIDR block %q: %s", nwFence.Cidr, err.Error())
 	}
 
+	nwFence.ReportResult(ctx)
+
 	return &fence.FenceClusterNetworkResponse{}, nil
 }
 
@@ -108,7 +110,7 @@ func (fcs *FenceControllerServer) UnfenceClusterNetwork(
 
 	nwFence, err := nf.NewNetworkFence(ctx, cr, req.GetCidrs(), req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = nwFence.RemoveClientEviction(ctx)
@@ -116,5 +118,7 @@ func (fcs *FenceControllerServer) UnfenceClusterNetwork(
 		return nil, status.Errorf(codes.Internal, "failed to unfence CIDR block %q: %s", nwFence.Cidr, err.Error())
 	}
 
+	nwFence.ReportResult(ctx)
+
 	return &fence.UnfenceClusterNetworkResponse{}, nil
 }
@@ -0,0 +1,382 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// VolumeQuiesceServiceName is the name of the CSI-Addons service that
+	// quiesces and resumes the IO on CephFS volumes.
+	VolumeQuiesceServiceName = "cephfs.csi.ceph.com.VolumeQuiesceController"
+	// QuiesceMethod is the full name of the Quiesce procedure.
+	QuiesceMethod = "/" + VolumeQuiesceServiceName + "/Quiesce"
+	// ResumeMethod is the full name of the Resume procedure.
+	ResumeMethod = "/" + VolumeQuiesceServiceName + "/Resume"
+
+	// fields of the Quiesce and Resume requests
+	quiesceVolumeIDsField  = "volume_ids"
+	quiesceSetIDField      = "set_id"
+	quiesceExpirationField = "expiration"
+
+	// quiesceStateField is the field of the responses that contains the
+	// state of the quiesce set
+	quiesceStateField = "state"
+
+	// secretsField is the field of the requests that contains the secrets,
+	// it is removed from the request before the interceptors run
+	secretsField = "secrets"
+)
+
+// volumeQuiesceController is the interface of the handler of the
+// VolumeQuiesceController service.
+type volumeQuiesceController interface {
+	Quiesce(ctx context.Context, req *structpb.Struct, secrets map[string]string) (*structpb.Struct, error)
+	Resume(ctx context.Context, req *structpb.Struct, secrets map[string]string) (*structpb.Struct, error)
+}
+
+// volumeQuiesceServiceDesc describes the VolumeQuiesceController service.
+// The CSI-Addons specification does not contain a service for quiescing
+// volumes, the requests are a google.protobuf.Struct with the fields:
+//
+//   - volume_ids: the IDs of the volumes to quiesce or resume
+//   - set_id: the ID of the quiesce set
+//   - expiration: the seconds after which Ceph releases the quiesce when it
+//     is not extended by another Quiesce request (optional, Quiesce only)
+//   - secrets: the admin credentials of the Ceph cluster
+//
+// The responses are a google.protobuf.Struct with the state of the quiesce
+// set in the "state" field.
+var volumeQuiesceServiceDesc = grpc.ServiceDesc{
+	ServiceName: VolumeQuiesceServiceName,
+	HandlerType: (*volumeQuiesceController)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Quiesce",
+			Handler:    quiesceHandler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    resumeHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// quiesceHandler decodes the Quiesce request and passes it to the server.
+//
+//nolint:revive // the signature is defined by grpc.MethodDesc
+func quiesceHandler(
+	srv any,
+	ctx context.Context,
+	dec func(any) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (any, error) {
+	return handleQuiesceRequest(srv, ctx, dec, interceptor, QuiesceMethod)
+}
+
+// resumeHandler decodes the Resume request and passes it to the server.
+//
+//nolint:revive // the signature is defined by grpc.MethodDesc
+func resumeHandler(
+	srv any,
+	ctx context.Context,
+	dec func(any) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (any, error) {
+	return handleQuiesceRequest(srv, ctx, dec, interceptor, ResumeMethod)
+}
+
+// handleQuiesceRequest decodes the request of the procedure and passes it to
+// the server. The secrets are removed from the request before the
+// interceptors run, so that they do not get logged.
+//
+//nolint:revive // the arguments are the ones of grpc.MethodDesc
+func handleQuiesceRequest(
+	srv any,
+	ctx context.Context,
+	dec func(any) error,
+	interceptor grpc.UnaryServerInterceptor,
+	method string,
+) (any, error) {
+	req := &structpb.Struct{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	secrets, err := takeSecrets(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	vqc, ok := srv.(volumeQuiesceController)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%T does not implement %s", srv, method)
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		//nolint:forcetypeassert // the request is passed through by the interceptor
+		st := req.(*structpb.Struct)
+		if method == ResumeMethod {
+			return vqc.Resume(ctx, st, secrets)
+		}
+
+		return vqc.Quiesce(ctx, st, secrets)
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: method,
+	}
+
+	return interceptor(ctx, req, info, handler)
+}
+
+// takeSecrets removes the secrets from the request and returns them.
+func takeSecrets(req *structpb.Struct) (map[string]string, error) {
+	fields := req.GetFields()
+	value, ok := fields[secretsField]
+	if !ok {
+		return nil, nil
+	}
+	delete(fields, secretsField)
+
+	st := value.GetStructValue()
+	if st == nil {
+		return nil, fmt.Errorf("%q in the request is not an object", secretsField)
+	}
+
+	secrets := make(map[string]string, len(st.GetFields()))
+	for k, v := range st.GetFields() {
+		s, ok := v.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return nil, fmt.Errorf("secret %q in the request is not a string", k)
+		}
+		secrets[k] = s.StringValue
+	}
+
+	return secrets, nil
+}
+
+// quiesceRequest contains the validated fields of a Quiesce or Resume
+// request.
+type quiesceRequest struct {
+	volumeIDs  []string
+	setID      string
+	expiration time.Duration
+}
+
+// parseQuiesceRequest validates the fields of a Quiesce or Resume request.
+func parseQuiesceRequest(req *structpb.Struct) (*quiesceRequest, error) {
+	fields := req.GetFields()
+	qr := &quiesceRequest{expiration: core.DefaultQuiesceExpiration}
+
+	ids := fields[quiesceVolumeIDsField].GetListValue()
+	for _, v := range ids.GetValues() {
+		s, ok := v.GetKind().(*structpb.Value_StringValue)
+		if !ok || s.StringValue == "" {
+			return nil, fmt.Errorf("%q in the request must only contain volume IDs", quiesceVolumeIDsField)
+		}
+		qr.volumeIDs = append(qr.volumeIDs, s.StringValue)
+	}
+	if len(qr.volumeIDs) == 0 {
+		return nil, fmt.Errorf("empty %q in request", quiesceVolumeIDsField)
+	}
+
+	setID, ok := fields[quiesceSetIDField].GetKind().(*structpb.Value_StringValue)
+	if !ok || setID.StringValue == "" {
+		return nil, fmt.Errorf("empty %q in request", quiesceSetIDField)
+	}
+	qr.setID = setID.StringValue
+
+	if value, ok := fields[quiesceExpirationField]; ok {
+		seconds, ok := value.GetKind().(*structpb.Value_NumberValue)
+		if !ok || seconds.NumberValue <= 0 {
+			return nil, fmt.Errorf("%q in the request must be a positive number of seconds", quiesceExpirationField)
+		}
+		qr.expiration = time.Duration(seconds.NumberValue * float64(time.Second))
+	}
+
+	return qr, nil
+}
+
+// quiesceResponse returns the response with the state of the quiesce set.
+func quiesceResponse(state core.QuiesceState) *structpb.Struct {
+	return &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			quiesceStateField: structpb.NewStringValue(string(state)),
+		},
+	}
+}
+
+// VolumeQuiesceServer implements the VolumeQuiesceController service, it
+// quiesces and resumes the IO on the subvolumes of CephFS volumes with the
+// "fs quiesce" command of Ceph.
+type VolumeQuiesceServer struct {
+	// volumeGroupLocks serializes the requests for a quiesce set with the
+	// VolumeGroupSnapshot requests that use the set ID as request name.
+	volumeGroupLocks *util.VolumeLocks
+}
+
+// NewVolumeQuiesceServer creates a new VolumeQuiesceServer.
+func NewVolumeQuiesceServer(volumeGroupLocks *util.VolumeLocks) *VolumeQuiesceServer {
+	return &VolumeQuiesceServer{volumeGroupLocks: volumeGroupLocks}
+}
+
+func (vqs *VolumeQuiesceServer) RegisterService(server grpc.ServiceRegistrar) {
+	server.RegisterService(&volumeQuiesceServiceDesc, vqs)
+}
+
+// Quiesce quiesces the subvolumes of the volumes in the quiesce set. While
+// Ceph is quiescing the subvolumes the response reports QUIESCING, and the
+// request should be repeated until it reports QUIESCED. Repeating the request
+// for a quiesced set extends the quiesce by the expiration.
+func (vqs *VolumeQuiesceServer) Quiesce(
+	ctx context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*structpb.Struct, error) {
+	qr, err := parseQuiesceRequest(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	fsMap, release, err := vqs.getQuiesceClients(ctx, qr, secrets)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	state := core.Quiesced
+	for _, fq := range fsMap {
+		data, err := fq.FSQuiesce(ctx, qr.setID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to quiesce set %s: %v", qr.setID, err)
+		}
+
+		fsState := core.GetQuiesceState(data.State)
+		if fsState != core.Quiescing && fsState != core.Quiesced {
+			// the set was released, it expired or timed out, quiesce the
+			// members again with the same set ID
+			data, err = fq.ResetFSQuiesce(ctx, qr.setID)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to reset quiesce set %s: %v", qr.setID, err)
+			}
+			fsState = core.GetQuiesceState(data.State)
+		}
+
+		switch fsState {
+		case core.Quiesced:
+		case core.Quiescing:
+			state = core.Quiescing
+		default:
+			return nil, status.Errorf(codes.Internal, "quiesce set %s is in %s state", qr.setID, fsState)
+		}
+	}
+
+	log.DebugLog(ctx, "quiesce set %s of volumes %v is %s", qr.setID, qr.volumeIDs, state)
+
+	return quiesceResponse(state), nil
+}
+
+// Resume releases the quiesce set, so that the IO on the subvolumes of the
+// volumes continues.
+func (vqs *VolumeQuiesceServer) Resume(
+	ctx context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*structpb.Struct, error) {
+	qr, err := parseQuiesceRequest(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	fsMap, release, err := vqs.getQuiesceClients(ctx, qr, secrets)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	for _, fq := range fsMap {
+		data, err := fq.ReleaseFSQuiesce(ctx, qr.setID)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to release quiesce set %s: %v", qr.setID, err)
+		}
+
+		state := core.GetQuiesceState(data.State)
+		if state != core.Released {
+			return nil, status.Errorf(codes.Internal, "quiesce set %s is in %s state", qr.setID, state)
+		}
+	}
+
+	log.DebugLog(ctx, "released quiesce set %s of volumes %v", qr.setID, qr.volumeIDs)
+
+	return quiesceResponse(core.Released), nil
+}
+
+// getQuiesceClients locks the quiesce set and returns the FSQuiesceClient
+// for each filesystem of the volumes. The returned function destroys the
+// clients and releases the lock.
+func (vqs *VolumeQuiesceServer) getQuiesceClients(
+	ctx context.Context,
+	qr *quiesceRequest,
+	secrets map[string]string,
+) (map[string]core.FSQuiesceClient, func(), error) {
+	token, acquired := vqs.volumeGroupLocks.TryAcquire(qr.setID)
+	if !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, qr.setID)
+
+		return nil, nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, qr.setID)
+	}
+
+	cr, err := util.NewAdminCredentials(secrets)
+	if err != nil {
+		vqs.volumeGroupLocks.Release(qr.setID, token)
+
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	fsMap, err := store.GetFSQuiesceClients(ctx, secrets, qr.volumeIDs, cr, qr.expiration)
+	if err != nil {
+		vqs.volumeGroupLocks.Release(qr.setID, token)
+		log.ErrorLog(ctx, "failed to get fs names and subvolume from volume ids: %v", err)
+
+		return nil, nil, util.GRPCError(err)
+	}
+
+	return fsMap, func() {
+		store.DestroyFSQuiesceClients(fsMap)
+		vqs.volumeGroupLocks.Release(qr.setID, token)
+	}, nil
+}
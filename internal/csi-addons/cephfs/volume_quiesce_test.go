@@ -0,0 +1,226 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type fakeQuiesceController struct {
+	method  string
+	req     *structpb.Struct
+	secrets map[string]string
+}
+
+func (f *fakeQuiesceController) Quiesce(
+	_ context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*structpb.Struct, error) {
+	f.method = "Quiesce"
+	f.req = req
+	f.secrets = secrets
+
+	return quiesceResponse(core.Quiesced), nil
+}
+
+func (f *fakeQuiesceController) Resume(
+	_ context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*structpb.Struct, error) {
+	f.method = "Resume"
+	f.req = req
+	f.secrets = secrets
+
+	return quiesceResponse(core.Released), nil
+}
+
+// TestQuiesceHandlers checks that the handlers call the procedure of the
+// method, and that the secrets are removed from the request before the
+// interceptors see it.
+func TestQuiesceHandlers(t *testing.T) {
+	t.Parallel()
+
+	req, err := structpb.NewStruct(map[string]any{
+		"volume_ids": []any{"0001-0009-rook-ceph-0000000000000001-volume"},
+		"set_id":     "backup",
+		"secrets":    map[string]any{"adminID": "admin", "adminKey": "secret"},
+	})
+	require.NoError(t, err)
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	dec := func(m any) error {
+		//nolint:forcetypeassert // the handler decodes into a proto.Message
+		return proto.Unmarshal(data, m.(proto.Message))
+	}
+
+	tests := []struct {
+		method  string
+		handler func(any, context.Context, func(any) error, grpc.UnaryServerInterceptor) (any, error)
+		state   core.QuiesceState
+	}{
+		{
+			method:  "Quiesce",
+			handler: quiesceHandler,
+			state:   core.Quiesced,
+		},
+		{
+			method:  "Resume",
+			handler: resumeHandler,
+			state:   core.Released,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			t.Parallel()
+
+			var intercepted *structpb.Struct
+			interceptor := func(
+				ctx context.Context,
+				req any,
+				info *grpc.UnaryServerInfo,
+				handler grpc.UnaryHandler,
+			) (any, error) {
+				require.Equal(t, "/"+VolumeQuiesceServiceName+"/"+tt.method, info.FullMethod)
+				intercepted, _ = req.(*structpb.Struct)
+
+				return handler(ctx, req)
+			}
+
+			fake := &fakeQuiesceController{}
+			resp, err := tt.handler(fake, context.TODO(), dec, interceptor)
+			require.NoError(t, err)
+			require.Equal(t, tt.method, fake.method)
+			require.NotContains(t, intercepted.GetFields(), secretsField)
+			require.Equal(t, "backup", fake.req.GetFields()[quiesceSetIDField].GetStringValue())
+			require.Equal(t, map[string]string{"adminID": "admin", "adminKey": "secret"}, fake.secrets)
+
+			st, ok := resp.(*structpb.Struct)
+			require.True(t, ok)
+			require.Equal(t, string(tt.state), st.GetFields()[quiesceStateField].GetStringValue())
+		})
+	}
+}
+
+func TestParseQuiesceRequest(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     map[string]any
+		want    *quiesceRequest
+		wantErr bool
+	}{
+		{
+			name: "default expiration",
+			req:  map[string]any{"volume_ids": []any{"vol-1", "vol-2"}, "set_id": "backup"},
+			want: &quiesceRequest{
+				volumeIDs:  []string{"vol-1", "vol-2"},
+				setID:      "backup",
+				expiration: core.DefaultQuiesceExpiration,
+			},
+		},
+		{
+			name: "expiration",
+			req:  map[string]any{"volume_ids": []any{"vol-1"}, "set_id": "backup", "expiration": 600},
+			want: &quiesceRequest{
+				volumeIDs:  []string{"vol-1"},
+				setID:      "backup",
+				expiration: 10 * time.Minute,
+			},
+		},
+		{
+			name:    "no volume IDs",
+			req:     map[string]any{"set_id": "backup"},
+			wantErr: true,
+		},
+		{
+			name:    "volume ID not a string",
+			req:     map[string]any{"volume_ids": []any{1}, "set_id": "backup"},
+			wantErr: true,
+		},
+		{
+			name:    "no set ID",
+			req:     map[string]any{"volume_ids": []any{"vol-1"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative expiration",
+			req:     map[string]any{"volume_ids": []any{"vol-1"}, "set_id": "backup", "expiration": -1},
+			wantErr: true,
+		},
+		{
+			name:    "expiration not a number",
+			req:     map[string]any{"volume_ids": []any{"vol-1"}, "set_id": "backup", "expiration": "1m"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := structpb.NewStruct(tt.req)
+			require.NoError(t, err)
+
+			got, err := parseQuiesceRequest(req)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestQuiesce is a minimal test for the Quiesce() and Resume() procedures.
+// During unit-testing, there is no Ceph cluster available, so only the
+// validation of the request can be tested.
+func TestQuiesce(t *testing.T) {
+	t.Parallel()
+
+	vqs := NewVolumeQuiesceServer(util.NewVolumeLocks())
+
+	for _, fields := range []map[string]any{
+		{},
+		{"volume_ids": []any{"vol-1"}},
+		{"set_id": "backup"},
+	} {
+		req, err := structpb.NewStruct(fields)
+		require.NoError(t, err)
+
+		_, err = vqs.Quiesce(context.TODO(), req, nil)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		_, err = vqs.Resume(context.TODO(), req, nil)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkfence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/parameters"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// evictionConcurrencyKey is the parameter with the maximum number of
+	// client evictions that are sent to the MDS at the same time.
+	evictionConcurrencyKey = "evictionConcurrency"
+	// defaultEvictionConcurrency is used when evictionConcurrencyKey is not
+	// set.
+	defaultEvictionConcurrency = 4
+
+	// hostnameFilter is the filter of the "client evict" command that
+	// matches all the sessions of a host.
+	hostnameFilter = "client_metadata.hostname"
+)
+
+// evictionBatch is a set of clients that is evicted with one filter.
+type evictionBatch struct {
+	filter  string
+	clients []EvictedClient
+}
+
+// parseEvictionConcurrency returns the value of the evictionConcurrencyKey
+// parameter.
+func parseEvictionConcurrency(options map[string]string) (int, error) {
+	val, ok := options[evictionConcurrencyKey]
+	if !ok {
+		return defaultEvictionConcurrency, nil
+	}
+
+	concurrency, err := strconv.Atoi(val)
+	if err == nil && concurrency < 1 {
+		err = errors.New("must be greater than 0")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: %w", parameters.ErrInvalidParameter, evictionConcurrencyKey, err)
+	}
+
+	return concurrency, nil
+}
+
+// normalizeIP returns the IP in the format of net.IP.String(), or the input
+// when it is not an IP address.
+func normalizeIP(ip string) string {
+	addr := net.ParseIP(strings.Trim(ip, "[]"))
+	if addr == nil {
+		return ip
+	}
+
+	return addr.String()
+}
+
+// parseBlocklistedAddrs returns the addresses of the blocklist that have a
+// nonce, range entries are not included.
+func parseBlocklistedAddrs(blocklist string) map[IPWithNonce]bool {
+	addrs := make(map[IPWithNonce]bool)
+	nf := &NetworkFence{}
+	for _, entry := range strings.Split(blocklist, "\n") {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "cidr") || !strings.Contains(entry, "/") {
+			continue
+		}
+
+		addr := nf.parseBlocklistEntry(entry)
+		if addr.IP == "" {
+			continue
+		}
+		addr.IP = normalizeIP(addr.IP)
+		addrs[addr] = true
+	}
+
+	return addrs
+}
+
+// planEvictions returns the batches of active clients in the CIDR blocks that
+// need to be evicted, and the clients that are skipped because their address
+// is blocklisted already. The clients of a host are evicted with one
+// hostnameFilter when all the sessions of the host are in the CIDR blocks,
+// other clients are evicted by their ID.
+func planEvictions(
+	ctx context.Context,
+	cidrs []string,
+	activeClients []activeClient,
+	blocklisted map[IPWithNonce]bool,
+) ([]evictionBatch, []EvictedClient, error) {
+	var (
+		hosts        []string
+		hostSessions = make(map[string]int)
+		matched      = make(map[string][]EvictedClient)
+		skipped      []EvictedClient
+	)
+	for _, client := range activeClients {
+		hostname := client.ClientMetadata.Hostname
+		if hostname != "" {
+			hostSessions[hostname]++
+		}
+
+		clientIP, err := client.fetchIP()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching client IP: %w", err)
+		}
+		// check if the clientIP is in one of the CIDR blocks
+		if !slices.ContainsFunc(cidrs, func(cidr string) bool {
+			return isIPInCIDR(ctx, clientIP, cidr)
+		}) {
+			continue
+		}
+
+		clientID, err := client.fetchID()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error fetching client ID: %w", err)
+		}
+		evicted := EvictedClient{ID: clientID, IP: clientIP, Nonce: client.fetchNonce()}
+		if blocklisted[IPWithNonce{IP: clientIP, Nonce: evicted.Nonce}] {
+			skipped = append(skipped, evicted)
+
+			continue
+		}
+
+		if _, ok := matched[hostname]; !ok {
+			hosts = append(hosts, hostname)
+		}
+		matched[hostname] = append(matched[hostname], evicted)
+	}
+
+	var batches []evictionBatch
+	for _, hostname := range hosts {
+		clients := matched[hostname]
+		if hostname != "" && len(clients) > 1 && len(clients) == hostSessions[hostname] {
+			batches = append(batches, evictionBatch{
+				filter:  hostnameFilter + "=" + hostname,
+				clients: clients,
+			})
+
+			continue
+		}
+
+		for _, client := range clients {
+			batches = append(batches, evictionBatch{
+				filter:  fmt.Sprintf("id=%d", client.ID),
+				clients: []EvictedClient{client},
+			})
+		}
+	}
+
+	return batches, skipped, nil
+}
+
+// evictBatch evicts the clients of the batch. When the MDS does not support
+// the filter of the batch, the clients are evicted one by one.
+func (nf *NetworkFence) evictBatch(ctx context.Context, batch evictionBatch) error {
+	err := nf.evictCephFSClient(ctx, batch.filter)
+	if err == nil || len(batch.clients) == 1 || !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+
+	log.DebugLog(ctx, "evicting clients with filter %q failed, evicting them by ID: %v", batch.filter, err)
+	for _, client := range batch.clients {
+		err = nf.evictCephFSClient(ctx, fmt.Sprintf("id=%d", client.ID))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// evictClients evicts the batches of clients, with at most
+// evictionConcurrency evictions at the same time.
+func (nf *NetworkFence) evictClients(ctx context.Context, batches []evictionBatch) error {
+	var (
+		sem  = semaphore.NewWeighted(int64(nf.evictionConcurrency))
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, batch := range batches {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer sem.Release(1)
+
+			err := nf.evictBatch(ctx, batch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+
+				return
+			}
+			nf.result.EvictedClients = append(nf.result.EvictedClients, batch.clients...)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkfence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newActiveClient(inst, hostname string) activeClient {
+	ac := activeClient{Inst: inst}
+	ac.ClientMetadata.Hostname = hostname
+
+	return ac
+}
+
+func TestParseBlocklistedAddrs(t *testing.T) {
+	t.Parallel()
+
+	blocklist := `cidr:10.1.0.0:0/24 2029-06-01T10:00:00.000000+0000
+10.0.0.1:0/3710147553 2029-06-01T10:00:00.000000+0000
+[fd4a:ecbc:cafd:4e49::1]:0/422650892 2029-06-01T10:00:00.000000+0000
+10.0.0.2:0/0 2029-06-01T10:00:00.000000+0000
+listed 3 entries`
+
+	require.Equal(t, map[IPWithNonce]bool{
+		{IP: "10.0.0.1", Nonce: "3710147553"}:              true,
+		{IP: "fd4a:ecbc:cafd:4e49::1", Nonce: "422650892"}: true,
+		{IP: "10.0.0.2", Nonce: "0"}:                       true,
+	}, parseBlocklistedAddrs(blocklist))
+}
+
+func TestPlanEvictions(t *testing.T) {
+	t.Parallel()
+
+	activeClients := []activeClient{
+		newActiveClient("client.4305 10.0.0.1:0/422650892", "node-1"),
+		newActiveClient("client.4306 v1:10.0.0.1:0/422650893", "node-1"),
+		newActiveClient("client.4307 10.0.0.2:0/422650894", "node-2"),
+		newActiveClient("client.4308 10.0.1.2:0/422650895", "node-2"),
+		newActiveClient("client.4309 10.0.0.3:0/422650896", ""),
+		newActiveClient("client.4310 10.0.0.4:0/422650897", "node-4"),
+		newActiveClient("client.4311 10.0.1.5:0/422650898", "node-5"),
+	}
+	blocklisted := map[IPWithNonce]bool{
+		{IP: "10.0.0.4", Nonce: "422650897"}: true,
+	}
+
+	batches, skipped, err := planEvictions(context.TODO(), []string{"10.0.0.0/24"}, activeClients, blocklisted)
+	require.NoError(t, err)
+	require.Equal(t, []evictionBatch{
+		{
+			filter: "client_metadata.hostname=node-1",
+			clients: []EvictedClient{
+				{ID: 4305, IP: "10.0.0.1", Nonce: "422650892"},
+				{ID: 4306, IP: "10.0.0.1", Nonce: "422650893"},
+			},
+		},
+		{
+			filter:  "id=4307",
+			clients: []EvictedClient{{ID: 4307, IP: "10.0.0.2", Nonce: "422650894"}},
+		},
+		{
+			filter:  "id=4309",
+			clients: []EvictedClient{{ID: 4309, IP: "10.0.0.3", Nonce: "422650896"}},
+		},
+	}, batches)
+	require.Equal(t, []EvictedClient{{ID: 4310, IP: "10.0.0.4", Nonce: "422650897"}}, skipped)
+}
+
+func TestParseEvictionConcurrency(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		options  map[string]string
+		expected int
+		wantErr  bool
+	}{
+		{
+			name:     "not set",
+			options:  map[string]string{},
+			expected: defaultEvictionConcurrency,
+		},
+		{
+			name:     "valid value",
+			options:  map[string]string{evictionConcurrencyKey: "16"},
+			expected: 16,
+		},
+		{
+			name:    "zero",
+			options: map[string]string{evictionConcurrencyKey: "0"},
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			options: map[string]string{evictionConcurrencyKey: "many"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseEvictionConcurrency(tt.options)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
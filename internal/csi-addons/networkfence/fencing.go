@@ -25,7 +25,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
+	"syscall"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
@@ -34,10 +34,9 @@ import (
 )
 
 const (
-	blocklistTime     = "157784760"
-	invalidCommandStr = "invalid command"
+	blocklistTime = 157784760
 	// we can always use mds rank 0, since all the clients have a session with rank-0.
-	mdsRank = 0
+	mdsRank = "0"
 )
 
 // NetworkFence contains the CIDR blocks to be blocked.
@@ -45,11 +44,25 @@ type NetworkFence struct {
 	Cidr     []string
 	Monitors string
 	cr       *util.Credentials
+
+	// reportResult is set when the result should be sent in the response.
+	reportResult bool
+	// fenced is the result of a previous fence operation, passed to an
+	// unfence request.
+	fenced *FenceResult
+	// result records the changes that were made by the operation.
+	result FenceResult
+	// evictionConcurrency is the maximum number of client evictions that
+	// are sent to the MDS at the same time.
+	evictionConcurrency int
 }
 
 // activeClient represents the structure of an active client.
 type activeClient struct {
-	Inst string `json:"inst"`
+	Inst           string `json:"inst"`
+	ClientMetadata struct {
+		Hostname string `json:"hostname"`
+	} `json:"client_metadata"`
 }
 
 // IPWithNonce represents the structure of an IP with nonce
@@ -85,34 +98,73 @@ func NewNetworkFence(
 	}
 
 	nwFence.cr = cr
+	nwFence.result.Cidrs = nwFence.Cidr
+
+	nwFence.reportResult, err = parseReportResults(fenceOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	nwFence.fenced, err = parseFenceResults(fenceOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	nwFence.evictionConcurrency, err = parseEvictionConcurrency(fenceOptions)
+	if err != nil {
+		return nil, err
+	}
 
 	return nwFence, nil
 }
 
+// runCommand sends the command to the cluster of the NetworkFence.
+func (nf *NetworkFence) runCommand(ctx context.Context, cmd *util.CephCommand) ([]byte, error) {
+	conn := &util.ClusterConnection{}
+	if err := conn.Connect(nf.Monitors, nf.cr); err != nil {
+		return nil, fmt.Errorf("failed to connect to the cluster: %w", err)
+	}
+	defer conn.Destroy()
+
+	return util.RunCephCommand(ctx, conn, cmd)
+}
+
+// blocklistCommand returns the command to add or remove (op) the address to
+// the OSD blocklist.
+func blocklistCommand(op, addr string, useRange bool) *util.CephCommand {
+	cmd := &util.CephCommand{
+		Name: "osd blocklist " + op,
+		Command: map[string]any{
+			"prefix":      "osd blocklist",
+			"blocklistop": op,
+			"addr":        addr,
+		},
+	}
+	if useRange {
+		cmd.Name = "osd blocklist range " + op
+		cmd.Command["range"] = "range"
+	}
+	if op == "add" {
+		cmd.Command["expire"] = float64(blocklistTime)
+	}
+
+	return cmd
+}
+
 // addCephBlocklist adds an IP to ceph osd blocklist.
 func (nf *NetworkFence) addCephBlocklist(ctx context.Context, ip string, useRange bool) error {
-	arg := []string{
-		"--id", nf.cr.ID,
-		"--keyfile=" + nf.cr.KeyFile,
-		"-m", nf.Monitors,
-	}
 	// TODO: add blocklist till infinity.
 	// Currently, ceph does not provide the functionality to blocklist IPs
 	// for infinite time. As a workaround, add a blocklist for 5 YEARS to
 	// represent infinity from ceph-csi side.
 	// At any point in this time, the IPs can be unblocked by an UnfenceClusterReq.
 	// This needs to be updated once ceph provides functionality for the same.
-	cmd := []string{"osd", "blocklist"}
-	if useRange {
-		cmd = append(cmd, "range")
-	}
-	cmd = append(cmd, "add", ip, blocklistTime)
-	cmd = append(cmd, arg...)
-	_, stdErr, err := util.ExecCommand(ctx, "ceph", cmd...)
+	_, err := nf.runCommand(ctx, blocklistCommand("add", ip, useRange))
 	if err != nil {
-		return fmt.Errorf("failed to blocklist IP %q: %w stderr: %q", ip, err, stdErr)
+		return fmt.Errorf("failed to blocklist IP %q: %w", ip, err)
 	}
 	log.DebugLog(ctx, "blocklisted IP %q successfully", ip)
+	nf.result.addBlocklistEntry(ip, useRange)
 
 	return nil
 }
@@ -130,7 +182,8 @@ func (nf *NetworkFence) AddNetworkFence(ctx context.Context) error {
 			if err == nil {
 				continue
 			}
-			if !strings.Contains(err.Error(), invalidCommandStr) {
+			// clusters without range support reject the command
+			if !errors.Is(err, syscall.EINVAL) {
 				return fmt.Errorf("failed to add blocklist range %q: %w", cidr, err)
 			}
 			hasBlocklistRangeSupport = false
@@ -154,41 +207,37 @@ func (nf *NetworkFence) AddNetworkFence(ctx context.Context) error {
 }
 
 func (nf *NetworkFence) listActiveClients(ctx context.Context) ([]activeClient, error) {
-	arg := []string{
-		"--id", nf.cr.ID,
-		"--keyfile=" + nf.cr.KeyFile,
-		"-m", nf.Monitors,
-	}
-	// FIXME: replace the ceph command with go-ceph API in future
-	cmd := []string{"tell", fmt.Sprintf("mds.%d", mdsRank), "client", "ls"}
-	cmd = append(cmd, arg...)
-	stdout, stdErr, err := util.ExecCommandWithTimeout(ctx, 2*time.Minute, "ceph", cmd...)
+	stdout, err := nf.runCommand(ctx, &util.CephCommand{
+		Name:    "client ls",
+		MDS:     mdsRank,
+		Command: map[string]any{"prefix": "client ls", "format": "json"},
+		Args:    []string{"tell", "mds." + mdsRank, "client", "ls"},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list active clients: %w, stderr: %q", err, stdErr)
+		return nil, fmt.Errorf("failed to list active clients: %w", err)
 	}
 
 	var activeClients []activeClient
-	if err := json.Unmarshal([]byte(stdout), &activeClients); err != nil {
+	if err := json.Unmarshal(stdout, &activeClients); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
 	}
 
 	return activeClients, nil
 }
 
-func (nf *NetworkFence) evictCephFSClient(ctx context.Context, clientID int) error {
-	arg := []string{
-		"--id", nf.cr.ID,
-		"--keyfile=" + nf.cr.KeyFile,
-		"-m", nf.Monitors,
-	}
-	// FIXME: replace the ceph command with go-ceph API in future
-	cmd := []string{"tell", fmt.Sprintf("mds.%d", mdsRank), "client", "evict", fmt.Sprintf("id=%d", clientID)}
-	cmd = append(cmd, arg...)
-	_, stdErr, err := util.ExecCommandWithTimeout(ctx, 2*time.Minute, "ceph", cmd...)
+// evictCephFSClient evicts the clients that match the filter, like
+// "id=4305", from CephFS.
+func (nf *NetworkFence) evictCephFSClient(ctx context.Context, filter string) error {
+	_, err := nf.runCommand(ctx, &util.CephCommand{
+		Name:    "client evict",
+		MDS:     mdsRank,
+		Command: map[string]any{"prefix": "client evict", "filters": []string{filter}},
+		Args:    []string{"tell", "mds." + mdsRank, "client", "evict", filter},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to evict client %d: %w, stderr: %q", clientID, err, stdErr)
+		return fmt.Errorf("failed to evict client %q: %w", filter, err)
 	}
-	log.DebugLog(ctx, "client %s has been evicted from CephFS\n", clientID)
+	log.DebugLog(ctx, "client %q has been evicted from CephFS", filter)
 
 	return nil
 }
@@ -220,6 +269,14 @@ func (ac *activeClient) fetchIP() (string, error) {
 	return ParseClientIP(ac.Inst)
 }
 
+func (ac *activeClient) fetchNonce() string {
+	// example: "inst": "client.4305 172.21.9.34:0/422650892",
+	// then returning value will be 422650892
+	_, nonce, _ := strings.Cut(ac.Inst, "/")
+
+	return nonce
+}
+
 func (ac *activeClient) fetchID() (int, error) {
 	// example: "inst": "client.4305 172.21.9.34:0/422650892",
 	// then returning value will be 4305
@@ -239,41 +296,33 @@ func (ac *activeClient) fetchID() (int, error) {
 }
 
 // AddClientEviction blocks access for all the IPs in the CIDR block
-// using client eviction, it also blocks the entire CIDR.
+// using client eviction, it also blocks the entire CIDR. Clients that are
+// blocklisted already are skipped.
 func (nf *NetworkFence) AddClientEviction(ctx context.Context) error {
-	evictedIPs := make(map[string]bool)
 	// fetch active clients
 	activeClients, err := nf.listActiveClients(ctx)
 	if err != nil {
 		return err
 	}
-	// iterate through CIDR blocks and check if any active client matches
-	for _, cidr := range nf.Cidr {
-		for _, client := range activeClients {
-			var clientIP string
-			clientIP, err = client.fetchIP()
-			if err != nil {
-				return fmt.Errorf("error fetching client IP: %w", err)
-			}
-			// check if the clientIP is in the CIDR block
-			if isIPInCIDR(ctx, clientIP, cidr) {
-				var clientID int
-				clientID, err = client.fetchID()
-				if err != nil {
-					return fmt.Errorf("error fetching client ID: %w", err)
-				}
-				// evict the client
-				err = nf.evictCephFSClient(ctx, clientID)
-				if err != nil {
-					return fmt.Errorf("error evicting client %d: %w", clientID, err)
-				}
-				log.DebugLog(ctx, "client %d has been evicted\n", clientID)
-				// add the CIDR to the list of blocklisted IPs
-				evictedIPs[clientIP] = true
-			}
-		}
+
+	blocklist, err := nf.getCephBlocklist(ctx)
+	if err != nil {
+		return err
 	}
 
+	batches, skipped, err := planEvictions(ctx, nf.Cidr, activeClients, parseBlocklistedAddrs(blocklist))
+	if err != nil {
+		return err
+	}
+	nf.result.SkippedClients = skipped
+
+	err = nf.evictClients(ctx, batches)
+	if err != nil {
+		return fmt.Errorf("error evicting clients: %w", err)
+	}
+	log.UsefulLog(ctx, "evicted %d clients with %d commands, skipped %d blocklisted clients",
+		len(nf.result.EvictedClients), len(batches), len(skipped))
+
 	// add the range based blocklist for CIDR
 	err = nf.AddNetworkFence(ctx)
 	if err != nil {
@@ -328,31 +377,19 @@ func GetCIDR(cidrs Cidrs) ([]string, error) {
 // removeCephBlocklist removes an IP from ceph osd blocklist.
 // the value of nonce is ignored if useRange is true.
 func (nf *NetworkFence) removeCephBlocklist(ctx context.Context, ip, nonce string, useRange bool) error {
-	arg := []string{
-		"--id", nf.cr.ID,
-		"--keyfile=" + nf.cr.KeyFile,
-		"-m", nf.Monitors,
-	}
-	cmd := []string{"osd", "blocklist"}
-	if useRange {
-		cmd = append(cmd, "range")
-	}
-
+	addr := ip
 	// If nonce is not empty and we are not using
 	// range based blocks, we need to add the nonce
 	if nonce != "" && !useRange {
-		cmd = append(cmd, "rm", fmt.Sprintf("%s:0/%s", ip, nonce))
-	} else {
-		cmd = append(cmd, "rm", ip)
+		addr = fmt.Sprintf("%s:0/%s", ip, nonce)
 	}
 
-	cmd = append(cmd, arg...)
-
-	_, stdErr, err := util.ExecCommand(ctx, "ceph", cmd...)
+	_, err := nf.runCommand(ctx, blocklistCommand("rm", addr, useRange))
 	if err != nil {
-		return fmt.Errorf("failed to unblock IP %q: %v %w", ip, stdErr, err)
+		return fmt.Errorf("failed to unblock IP %q: %w", ip, err)
 	}
 	log.DebugLog(ctx, "unblocked IP %q successfully", ip)
+	nf.result.addBlocklistEntry(ip, useRange)
 
 	return nil
 }
@@ -361,6 +398,8 @@ func (nf *NetworkFence) removeCephBlocklist(ctx context.Context, ip, nonce strin
 // using a network fence.
 // Unfencing one of the protocols(CephFS or RBD) suggests the node is expected to be recovered, so
 // both CephFS and RBD are expected to work again too.
+// The entries of a FenceResult that is passed with the request are removed as
+// well, even if they are not covered by the CIDR blocks anymore.
 // example:
 // Create RBD NetworkFence CR for one IP 10.10.10.10
 // Created CephFS NetworkFence CR for IP range but above IP comes in the Range
@@ -377,7 +416,8 @@ func (nf *NetworkFence) RemoveNetworkFence(ctx context.Context) error {
 			if err == nil {
 				continue
 			}
-			if !strings.Contains(err.Error(), invalidCommandStr) {
+			// clusters without range support reject the command
+			if !errors.Is(err, syscall.EINVAL) {
 				return fmt.Errorf("failed to remove blocklist range %q: %w", cidr, err)
 			}
 			hasBlocklistRangeSupport = false
@@ -400,7 +440,9 @@ func (nf *NetworkFence) RemoveNetworkFence(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	// remove the entries of the fence operation that are not part of the
+	// CIDR blocks anymore
+	return nf.removeRecordedEntries(ctx)
 }
 
 func (nf *NetworkFence) RemoveClientEviction(ctx context.Context) error {
@@ -435,20 +477,15 @@ func (nf *NetworkFence) RemoveClientEviction(ctx context.Context) error {
 
 // getCephBlocklist fetches the ceph blocklist and returns it as a string.
 func (nf *NetworkFence) getCephBlocklist(ctx context.Context) (string, error) {
-	arg := []string{
-		"--id", nf.cr.ID,
-		"--keyfile=" + nf.cr.KeyFile,
-		"-m", nf.Monitors,
-	}
-	// FIXME: replace the ceph command with go-ceph API in future
-	cmd := []string{"osd", "blocklist", "ls"}
-	cmd = append(cmd, arg...)
-	stdout, stdErr, err := util.ExecCommandWithTimeout(ctx, 2*time.Minute, "ceph", cmd...)
+	stdout, err := nf.runCommand(ctx, &util.CephCommand{
+		Name:    "osd blocklist ls",
+		Command: map[string]any{"prefix": "osd blocklist ls"},
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to get the ceph blocklist: %w, stderr: %q", err, stdErr)
+		return "", fmt.Errorf("failed to get the ceph blocklist: %w", err)
 	}
 
-	return stdout, nil
+	return string(stdout), nil
 }
 
 // parseBlocklistEntry parses a single entry from the ceph blocklist
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkfence
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/parameters"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// reportResultsKey is the parameter that enables reporting the
+	// FenceResult of the operation in the response.
+	reportResultsKey = "reportFenceResults"
+	// fenceResultsKey is the parameter of an unfence request that contains
+	// the FenceResult of the fence operation that is undone.
+	fenceResultsKey = "fenceResults"
+	// FenceResultsHeader is the gRPC response header that contains the
+	// FenceResult as JSON.
+	FenceResultsHeader = "ceph-csi-fence-results"
+)
+
+// EvictedClient is a CephFS client that was evicted while fencing, or
+// skipped because it was blocklisted already.
+type EvictedClient struct {
+	ID    int    `json:"id"`
+	IP    string `json:"ip"`
+	Nonce string `json:"nonce"`
+}
+
+// FenceResult records the entries that were added to (or removed from) the
+// OSD blocklist and the clients that were evicted for the CIDR blocks of a
+// NetworkFence.
+type FenceResult struct {
+	Cidrs          []string        `json:"cidrs"`
+	Ranges         []string        `json:"ranges,omitempty"`
+	IPs            []string        `json:"ips,omitempty"`
+	EvictedClients []EvictedClient `json:"evictedClients,omitempty"`
+	SkippedClients []EvictedClient `json:"skippedClients,omitempty"`
+}
+
+// addBlocklistEntry records an address of the blocklist.
+func (fr *FenceResult) addBlocklistEntry(addr string, useRange bool) {
+	if useRange {
+		fr.Ranges = append(fr.Ranges, addr)
+	} else {
+		fr.IPs = append(fr.IPs, addr)
+	}
+}
+
+// outside returns the entries of the FenceResult that are not covered by the
+// CIDR blocks, so that they can be removed even when the CIDR blocks changed
+// since the fence operation.
+func (fr *FenceResult) outside(ctx context.Context, cidrs []string) *FenceResult {
+	covered := func(ip string) bool {
+		return slices.ContainsFunc(cidrs, func(cidr string) bool {
+			return isIPInCIDR(ctx, ip, cidr)
+		})
+	}
+
+	res := &FenceResult{Cidrs: fr.Cidrs}
+	for _, r := range fr.Ranges {
+		if !slices.Contains(cidrs, r) {
+			res.Ranges = append(res.Ranges, r)
+		}
+	}
+	for _, ip := range fr.IPs {
+		if !covered(ip) {
+			res.IPs = append(res.IPs, ip)
+		}
+	}
+	for _, client := range fr.EvictedClients {
+		if !covered(client.IP) {
+			res.EvictedClients = append(res.EvictedClients, client)
+		}
+	}
+
+	return res
+}
+
+// parseReportResults returns the value of the reportResultsKey parameter.
+func parseReportResults(options map[string]string) (bool, error) {
+	val, ok := options[reportResultsKey]
+	if !ok {
+		return false, nil
+	}
+
+	report, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("%w %q: %w", parameters.ErrInvalidParameter, reportResultsKey, err)
+	}
+
+	return report, nil
+}
+
+// parseFenceResults returns the FenceResult that is passed in the
+// fenceResultsKey parameter, or nil when the parameter is not set.
+func parseFenceResults(options map[string]string) (*FenceResult, error) {
+	val, ok := options[fenceResultsKey]
+	if !ok || strings.TrimSpace(val) == "" {
+		return nil, nil
+	}
+
+	res := &FenceResult{}
+	err := json.Unmarshal([]byte(val), res)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", parameters.ErrInvalidParameter, fenceResultsKey, err)
+	}
+
+	return res, nil
+}
+
+// ReportResult sends the FenceResult of the operation in the
+// FenceResultsHeader of the response, when it was requested with the
+// reportResultsKey parameter.
+func (nf *NetworkFence) ReportResult(ctx context.Context) {
+	if !nf.reportResult {
+		return
+	}
+
+	data, err := json.Marshal(nf.result)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to marshal fence results: %v", err)
+
+		return
+	}
+	log.DebugLog(ctx, "fence results: %s", data)
+
+	err = grpc.SetHeader(ctx, metadata.Pairs(FenceResultsHeader, string(data)))
+	if err != nil {
+		log.DebugLog(ctx, "failed to set %s header: %v", FenceResultsHeader, err)
+	}
+}
+
+// removeRecordedEntries removes the blocklist entries of a previous fence
+// operation that are not covered by the CIDR blocks of the NetworkFence.
+func (nf *NetworkFence) removeRecordedEntries(ctx context.Context) error {
+	if nf.fenced == nil {
+		return nil
+	}
+
+	stale := nf.fenced.outside(ctx, nf.Cidr)
+	for _, r := range stale.Ranges {
+		err := nf.removeCephBlocklist(ctx, r, "", true)
+		if err != nil {
+			return fmt.Errorf("failed to remove blocklist range %q: %w", r, err)
+		}
+	}
+	for _, ip := range stale.IPs {
+		err := nf.removeCephBlocklist(ctx, ip, "0", false)
+		if err != nil {
+			return err
+		}
+	}
+	for _, client := range stale.EvictedClients {
+		err := nf.removeCephBlocklist(ctx, client.IP, client.Nonce, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package networkfence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFenceResultOutside(t *testing.T) {
+	t.Parallel()
+
+	fenced := &FenceResult{
+		Cidrs:  []string{"10.0.0.0/24", "10.0.1.0/31"},
+		Ranges: []string{"10.0.0.0/24"},
+		IPs:    []string{"10.0.1.0", "10.0.1.1"},
+		EvictedClients: []EvictedClient{
+			{ID: 4305, IP: "10.0.0.10", Nonce: "422650892"},
+			{ID: 4306, IP: "10.0.1.1", Nonce: "422650893"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		cidrs    []string
+		expected *FenceResult
+	}{
+		{
+			name:     "same CIDR blocks",
+			cidrs:    fenced.Cidrs,
+			expected: &FenceResult{Cidrs: fenced.Cidrs},
+		},
+		{
+			name:  "changed CIDR blocks",
+			cidrs: []string{"10.0.0.0/25"},
+			expected: &FenceResult{
+				Cidrs:  fenced.Cidrs,
+				Ranges: []string{"10.0.0.0/24"},
+				IPs:    []string{"10.0.1.0", "10.0.1.1"},
+				EvictedClients: []EvictedClient{
+					{ID: 4306, IP: "10.0.1.1", Nonce: "422650893"},
+				},
+			},
+		},
+		{
+			name:  "no CIDR blocks",
+			cidrs: nil,
+			expected: &FenceResult{
+				Cidrs:          fenced.Cidrs,
+				Ranges:         fenced.Ranges,
+				IPs:            fenced.IPs,
+				EvictedClients: fenced.EvictedClients,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.expected, fenced.outside(context.TODO(), tt.cidrs))
+		})
+	}
+}
+
+func TestParseFenceResults(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		options  map[string]string
+		expected *FenceResult
+		wantErr  bool
+	}{
+		{
+			name:     "not set",
+			options:  map[string]string{},
+			expected: nil,
+		},
+		{
+			name: "valid results",
+			options: map[string]string{
+				fenceResultsKey: `{"cidrs":["10.0.0.0/24"],"ips":["10.0.0.1"],` +
+					`"evictedClients":[{"id":4305,"ip":"10.0.0.1","nonce":"422650892"}]}`,
+			},
+			expected: &FenceResult{
+				Cidrs: []string{"10.0.0.0/24"},
+				IPs:   []string{"10.0.0.1"},
+				EvictedClients: []EvictedClient{
+					{ID: 4305, IP: "10.0.0.1", Nonce: "422650892"},
+				},
+			},
+		},
+		{
+			name:    "invalid results",
+			options: map[string]string{fenceResultsKey: "10.0.0.0/24"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseFenceResults(tt.options)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, got)
+		})
+	}
+}
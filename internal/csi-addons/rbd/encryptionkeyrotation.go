@@ -53,16 +53,17 @@ func (ekrs *EncryptionKeyRotationServer) EncryptionKeyRotate(
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
 
-	if acquired := ekrs.volLock.TryAcquire(volID); !acquired {
+	token, acquired := ekrs.volLock.TryAcquire(volID)
+	if !acquired {
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
 	}
-	defer ekrs.volLock.Release(volID)
+	defer ekrs.volLock.Release(volID, token)
 
 	// Get the credentials required to authenticate
 	// against a ceph cluster
 	creds, err := util.NewUserCredentials(req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer creds.DeleteCredentials()
 
@@ -0,0 +1,238 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	rbdutil "github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// VolumeMigrationServiceName is the name of the CSI-Addons service that
+	// moves the image of a volume to a different pool.
+	VolumeMigrationServiceName = "rbd.csi.ceph.com.VolumeMigrationController"
+	// MigrateVolumeMethod is the full name of the MigrateVolume procedure.
+	MigrateVolumeMethod = "/" + VolumeMigrationServiceName + "/MigrateVolume"
+
+	// fields of the MigrateVolume request
+	migrateVolumeIDField = "volume_id"
+	migratePoolField     = "pool"
+	migrateDataPoolField = "data_pool"
+
+	// secretsField is the field of the requests that contains the secrets,
+	// it is removed from the request before the interceptors run
+	secretsField = "secrets"
+)
+
+// volumeMigrationController is the interface of the handler of the
+// VolumeMigrationController service.
+type volumeMigrationController interface {
+	MigrateVolume(ctx context.Context, req *structpb.Struct, secrets map[string]string) (*emptypb.Empty, error)
+}
+
+// volumeMigrationServiceDesc describes the VolumeMigrationController service.
+// The CSI-Addons specification does not contain a service for migrating
+// volumes, the request is a google.protobuf.Struct with the fields:
+//
+//   - volume_id: the ID of the volume to migrate
+//   - pool: the pool to move the image to (optional)
+//   - data_pool: the data pool to store the data of the image in (optional)
+//   - secrets: the credentials to use for the migration
+var volumeMigrationServiceDesc = grpc.ServiceDesc{
+	ServiceName: VolumeMigrationServiceName,
+	HandlerType: (*volumeMigrationController)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "MigrateVolume",
+			Handler:    migrateVolumeHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// migrateVolumeHandler decodes the MigrateVolume request and passes it to the
+// server. The secrets are removed from the request before the interceptors
+// run, so that they do not get logged.
+//
+//nolint:revive // the signature is defined by grpc.MethodDesc
+func migrateVolumeHandler(
+	srv any,
+	ctx context.Context,
+	dec func(any) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (any, error) {
+	req := &structpb.Struct{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	secrets, err := takeSecrets(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	vmc, ok := srv.(volumeMigrationController)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%T does not implement MigrateVolume", srv)
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		//nolint:forcetypeassert // the request is passed through by the interceptor
+		return vmc.MigrateVolume(ctx, req.(*structpb.Struct), secrets)
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MigrateVolumeMethod,
+	}
+
+	return interceptor(ctx, req, info, handler)
+}
+
+// takeSecrets removes the secrets from the request and returns them.
+func takeSecrets(req *structpb.Struct) (map[string]string, error) {
+	fields := req.GetFields()
+	value, ok := fields[secretsField]
+	if !ok {
+		return nil, nil
+	}
+	delete(fields, secretsField)
+
+	st := value.GetStructValue()
+	if st == nil {
+		return nil, fmt.Errorf("%q in the request is not an object", secretsField)
+	}
+
+	secrets := make(map[string]string, len(st.GetFields()))
+	for k, v := range st.GetFields() {
+		s, ok := v.GetKind().(*structpb.Value_StringValue)
+		if !ok {
+			return nil, fmt.Errorf("secret %q in the request is not a string", k)
+		}
+		secrets[k] = s.StringValue
+	}
+
+	return secrets, nil
+}
+
+// getStringField returns the value of the string field in the request.
+func getStringField(req *structpb.Struct, name string) (string, error) {
+	value, ok := req.GetFields()[name]
+	if !ok {
+		return "", nil
+	}
+
+	s, ok := value.GetKind().(*structpb.Value_StringValue)
+	if !ok {
+		return "", fmt.Errorf("%q in the request is not a string", name)
+	}
+
+	return s.StringValue, nil
+}
+
+// VolumeMigrationServer implements the VolumeMigrationController service,
+// it moves the image of a volume to a different pool or data pool with an
+// RBD live-migration.
+type VolumeMigrationServer struct {
+	volumeLocks *util.VolumeLocks
+}
+
+// NewVolumeMigrationServer creates a new VolumeMigrationServer.
+func NewVolumeMigrationServer(volumeLocks *util.VolumeLocks) *VolumeMigrationServer {
+	return &VolumeMigrationServer{volumeLocks: volumeLocks}
+}
+
+func (vms *VolumeMigrationServer) RegisterService(server grpc.ServiceRegistrar) {
+	server.RegisterService(&volumeMigrationServiceDesc, vms)
+}
+
+// MigrateVolume moves the image of the volume to the pool and/or data pool
+// from the request. The call returns once the migration is committed, an
+// interrupted migration continues when the request is repeated.
+func (vms *VolumeMigrationServer) MigrateVolume(
+	ctx context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*emptypb.Empty, error) {
+	var volumeID, pool, dataPool string
+	for field, value := range map[string]*string{
+		migrateVolumeIDField: &volumeID,
+		migratePoolField:     &pool,
+		migrateDataPoolField: &dataPool,
+	} {
+		var err error
+		*value, err = getStringField(req, field)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
+	}
+	if pool == "" && dataPool == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty pool and data pool in request")
+	}
+
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+	defer cr.DeleteCredentials()
+
+	token, acquired := vms.volumeLocks.TryAcquire(volumeID)
+	if !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
+
+		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer vms.volumeLocks.Release(volumeID, token)
+
+	log.DebugLog(ctx, "migrating volume %s to pool %q and data pool %q", volumeID, pool, dataPool)
+
+	err = rbdutil.MigrateVolume(ctx, volumeID, pool, dataPool, cr)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to migrate volume %s: %v", volumeID, err)
+
+		switch {
+		case errors.Is(err, rbdutil.ErrImageNotFound):
+			return nil, status.Errorf(codes.NotFound, "volume ID %s not found", volumeID)
+		case errors.Is(err, rbdutil.ErrInvalidArgument):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, rbdutil.ErrFailedPrecondition):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
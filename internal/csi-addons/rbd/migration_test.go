@@ -0,0 +1,158 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type fakeMigrationController struct {
+	req     *structpb.Struct
+	secrets map[string]string
+}
+
+func (f *fakeMigrationController) MigrateVolume(
+	_ context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*emptypb.Empty, error) {
+	f.req = req
+	f.secrets = secrets
+
+	return &emptypb.Empty{}, nil
+}
+
+// TestMigrateVolumeHandler checks that the secrets are removed from the
+// request before the interceptors see it.
+func TestMigrateVolumeHandler(t *testing.T) {
+	t.Parallel()
+
+	req, err := structpb.NewStruct(map[string]any{
+		"volume_id": "0001-0009-rook-ceph-0000000000000001-volume",
+		"pool":      "ssd",
+		"secrets":   map[string]any{"userID": "admin", "userKey": "secret"},
+	})
+	require.NoError(t, err)
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	dec := func(m any) error {
+		//nolint:forcetypeassert // the handler decodes into a proto.Message
+		return proto.Unmarshal(data, m.(proto.Message))
+	}
+
+	var intercepted *structpb.Struct
+	interceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		require.Equal(t, MigrateVolumeMethod, info.FullMethod)
+		intercepted, _ = req.(*structpb.Struct)
+
+		return handler(ctx, req)
+	}
+
+	fake := &fakeMigrationController{}
+	_, err = migrateVolumeHandler(fake, context.TODO(), dec, interceptor)
+	require.NoError(t, err)
+	require.NotContains(t, intercepted.GetFields(), secretsField)
+	require.Equal(t, "ssd", fake.req.GetFields()[migratePoolField].GetStringValue())
+	require.Equal(t, map[string]string{"userID": "admin", "userKey": "secret"}, fake.secrets)
+}
+
+func TestTakeSecrets(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		req     map[string]any
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "no secrets",
+			req:  map[string]any{"volume_id": "vol"},
+			want: nil,
+		},
+		{
+			name: "secrets",
+			req:  map[string]any{"secrets": map[string]any{"userID": "admin"}},
+			want: map[string]string{"userID": "admin"},
+		},
+		{
+			name:    "secrets not an object",
+			req:     map[string]any{"secrets": "admin"},
+			wantErr: true,
+		},
+		{
+			name:    "secret not a string",
+			req:     map[string]any{"secrets": map[string]any{"userID": 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := structpb.NewStruct(tt.req)
+			require.NoError(t, err)
+
+			got, err := takeSecrets(req)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			require.NotContains(t, req.GetFields(), secretsField)
+		})
+	}
+}
+
+// TestMigrateVolume is a minimal test for the MigrateVolume() procedure.
+// During unit-testing, there is no Ceph cluster available, so only the
+// validation of the request can be tested.
+func TestMigrateVolume(t *testing.T) {
+	t.Parallel()
+
+	vms := NewVolumeMigrationServer(util.NewVolumeLocks())
+
+	for _, fields := range []map[string]any{
+		{},
+		{"volume_id": "vol"},
+		{"volume_id": 1, "pool": "ssd"},
+	} {
+		req, err := structpb.NewStruct(fields)
+		require.NoError(t, err)
+
+		_, err = vms.MigrateVolume(context.TODO(), req, nil)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
@@ -69,13 +69,13 @@ func (fcs *FenceControllerServer) FenceClusterNetwork(
 
 	cr, err := util.NewUserCredentials(req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
 	nwFence, err := nf.NewNetworkFence(ctx, cr, req.GetCidrs(), req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = nwFence.AddNetworkFence(ctx)
@@ -83,6 +83,8 @@ func (fcs *FenceControllerServer) FenceClusterNetwork(
 		return nil, status.Errorf(codes.Internal, "failed to fence CIDR block %q: %s", nwFence.Cidr, err.Error())
 	}
 
+	nwFence.ReportResult(ctx)
+
 	return &fence.FenceClusterNetworkResponse{}, nil
 }
 
@@ -104,7 +106,7 @@ func (fcs *FenceControllerServer) UnfenceClusterNetwork(
 
 	nwFence, err := nf.NewNetworkFence(ctx, cr, req.GetCidrs(), req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = nwFence.RemoveNetworkFence(ctx)
@@ -112,6 +114,8 @@ func (fcs *FenceControllerServer) UnfenceClusterNetwork(
 		return nil, status.Errorf(codes.Internal, "failed to unfence CIDR block %q: %s", nwFence.Cidr, err.Error())
 	}
 
+	nwFence.ReportResult(ctx)
+
 	return &fence.UnfenceClusterNetworkResponse{}, nil
 }
 
@@ -134,7 +138,7 @@ func (fcs *FenceControllerServer) GetFenceClients(
 
 	monitors, _ /* clusterID*/, err := util.GetMonsAndClusterID(ctx, clusterID, false)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// Get the cluster ID of the ceph cluster.
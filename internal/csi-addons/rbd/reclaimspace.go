@@ -61,16 +61,17 @@ func (rscs *ReclaimSpaceControllerServer) ControllerReclaimSpace(
 
 	cr, err := util.NewUserCredentials(req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := rscs.volumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := rscs.volumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rscs.volumeLocks.Release(volumeID)
+	defer rscs.volumeLocks.Release(volumeID, token)
 
 	rbdVol, err := rbdutil.GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
 	if err != nil {
@@ -78,7 +79,7 @@ func (rscs *ReclaimSpaceControllerServer) ControllerReclaimSpace(
 	}
 	defer rbdVol.Destroy(ctx)
 
-	err = rbdVol.Sparsify()
+	err = rbdVol.Sparsify(ctx)
 	if errors.Is(err, rbdutil.ErrImageInUse) {
 		// FIXME: https://github.com/csi-addons/kubernetes-csi-addons/issues/406.
 		// treat sparsify call as no-op if volume is in use.
@@ -125,12 +126,13 @@ func (rsns *ReclaimSpaceNodeServer) NodeReclaimSpace(
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
 
-	if acquired := rsns.volumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := rsns.volumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rsns.volumeLocks.Release(volumeID)
+	defer rsns.volumeLocks.Release(volumeID, token)
 
 	// path can either be the staging path on the node, or the volume path
 	// inside an application container
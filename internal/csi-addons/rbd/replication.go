@@ -38,6 +38,7 @@ import (
 	"github.com/csi-addons/spec/lib/go/replication"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -83,6 +84,41 @@ const (
 	// (default) If set to "never", the image with parent will not be flattened.
 	// If set to "force", the image with parent will be flattened.
 	flattenModeKey = "flattenMode"
+
+	// rpoThresholdKey to get the rpoThreshold from the parameters.
+	// (optional) rpoThreshold is the maximum age of the last synced snapshot
+	// of an image that is force promoted, like "15m". Images with an older
+	// or unknown last sync are not force promoted.
+	rpoThresholdKey = "rpoThreshold"
+
+	// autoResyncKey to get the autoResync option from the parameters.
+	// (optional) If set to "true", DemoteVolume resyncs secondary images
+	// that are in split-brain.
+	autoResyncKey = "autoResync"
+
+	// replicationPathHeader is the gRPC response header with the path that
+	// PromoteVolume or DemoteVolume took, the responses of the CSI-Addons
+	// specification have no field for it.
+	replicationPathHeader = "ceph-csi-replication-path"
+)
+
+// replicationPath is the path that PromoteVolume or DemoteVolume took.
+type replicationPath string
+
+const (
+	// pathPrimary is reported when the image was primary already.
+	pathPrimary replicationPath = "primary"
+	// pathPromoted is reported when the image was promoted without force.
+	pathPromoted replicationPath = "promoted"
+	// pathForcePromoted is reported when the image was force promoted.
+	pathForcePromoted replicationPath = "force-promoted"
+	// pathSecondary is reported when the image was secondary already.
+	pathSecondary replicationPath = "secondary"
+	// pathDemoted is reported when the image was demoted.
+	pathDemoted replicationPath = "demoted"
+	// pathResync is reported when a resync of the image in split-brain was
+	// requested.
+	pathResync replicationPath = "resync"
 )
 
 // ReplicationServer struct of rbd CSI driver with supported methods of Replication
@@ -150,6 +186,52 @@ func getFlattenMode(ctx context.Context, parameters map[string]string) (types.Fl
 	return mode, status.Errorf(codes.InvalidArgument, "%q=%q is not supported", flattenModeKey, val)
 }
 
+// getRPOThreshold gets the rpoThreshold from the input GRPC request
+// parameters, 0 when it is not set.
+func getRPOThreshold(parameters map[string]string) (time.Duration, error) {
+	val, ok := parameters[rpoThresholdKey]
+	if !ok {
+		return 0, nil
+	}
+
+	threshold, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "failed to parse %s %q: %v", rpoThresholdKey, val, err)
+	}
+	if threshold <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "%s %q needs to be positive", rpoThresholdKey, val)
+	}
+
+	return threshold, nil
+}
+
+// getAutoResync gets the autoResync option from the input GRPC request
+// parameters, false when it is not set.
+func getAutoResync(parameters map[string]string) (bool, error) {
+	val, ok := parameters[autoResyncKey]
+	if !ok {
+		return false, nil
+	}
+
+	autoResync, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "failed to parse %s %q: %v", autoResyncKey, val, err)
+	}
+
+	return autoResync, nil
+}
+
+// reportReplicationPath logs the path that was taken for the volume and
+// sends it in the replicationPathHeader of the response.
+func reportReplicationPath(ctx context.Context, volumeID string, path replicationPath) {
+	log.UsefulLog(ctx, "replication path for volume %s: %s", volumeID, path)
+
+	err := grpc.SetHeader(ctx, metadata.Pairs(replicationPathHeader, string(path)))
+	if err != nil {
+		log.DebugLog(ctx, "failed to set %s header: %v", replicationPathHeader, err)
+	}
+}
+
 // getMirroringMode gets the mirroring mode from the input GRPC request parameters.
 // mirroringMode is the key to check the mode in the parameters.
 func getMirroringMode(ctx context.Context, parameters map[string]string) (librbd.ImageMirrorMode, error) {
@@ -238,6 +320,50 @@ func getSchedulingDetails(parameters map[string]string) (admin.Interval, admin.S
 		admin.StartTime(parameters[schedulingStartTimeKey])
 }
 
+// getStaleSchedules returns the schedules that have a different interval than
+// the requested one. The start time of the schedules is not compared, the MGR
+// returns it in a normalized format that may differ from the parameter.
+func getStaleSchedules(schedules []admin.ScheduleTerm, interval admin.Interval) []admin.ScheduleTerm {
+	var stale []admin.ScheduleTerm
+	for _, schedule := range schedules {
+		if schedule.Interval != interval {
+			stale = append(stale, schedule)
+		}
+	}
+
+	return stale
+}
+
+// updateSnapshotScheduling adds the snapshot schedule to the mirror and
+// removes the schedules with a different interval, so that the interval of
+// a volume can be changed with the parameters of the replication request.
+func updateSnapshotScheduling(
+	ctx context.Context,
+	mirror types.Mirror,
+	interval admin.Interval,
+	startTime admin.StartTime,
+) error {
+	schedules, err := mirror.ListSnapshotSchedules()
+	if err != nil {
+		return fmt.Errorf("failed to list snapshot schedules: %w", err)
+	}
+
+	err = mirror.AddSnapshotScheduling(interval, startTime)
+	if err != nil {
+		return fmt.Errorf("failed to add snapshot schedule at interval %s: %w", interval, err)
+	}
+
+	for _, schedule := range getStaleSchedules(schedules, interval) {
+		err = mirror.RemoveSnapshotScheduling(schedule.Interval, schedule.StartTime)
+		if err != nil {
+			return fmt.Errorf("failed to remove snapshot schedule at interval %s: %w", schedule.Interval, err)
+		}
+		log.DebugLog(ctx, "Removed scheduling at interval %s, start time %s", schedule.Interval, schedule.StartTime)
+	}
+
+	return nil
+}
+
 // validateSchedulingInterval return the interval as it is if its ending with
 // `m|h|d` or else it will return error.
 func validateSchedulingInterval(interval string) error {
@@ -249,6 +375,18 @@ func validateSchedulingInterval(interval string) error {
 	return errors.New("interval specified without d, h, m suffix")
 }
 
+// getMirrorSecrets returns the secrets with the mirror credentials that are
+// configured for the cluster of the volume.
+func getMirrorSecrets(volumeID string, secrets map[string]string) (map[string]string, error) {
+	clusterID := util.GetClusterIDFromVolumeID(volumeID)
+	secrets, err := util.GetConfiguredSecrets(util.CsiConfigFile, clusterID, util.MirrorCredentials, secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+
+	return secrets, nil
+}
+
 // EnableVolumeReplication extracts the RBD volume information from the
 // volumeID, If the image is present it will enable the mirroring based on the
 // user provided information.
@@ -259,9 +397,13 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getMirrorSecrets(volumeID, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
@@ -270,14 +412,15 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 		return nil, err
 	}
 
-	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := rs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rs.VolumeLocks.Release(volumeID)
+	defer rs.VolumeLocks.Release(volumeID, token)
 
-	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), req.GetSecrets())
+	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), secrets)
 	defer mgr.Destroy(ctx)
 
 	rbdVol, err := mgr.GetVolumeByID(ctx, volumeID)
@@ -286,7 +429,7 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 	}
 	mirror, err := rbdVol.ToMirror()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// extract the mirroring mode
@@ -304,7 +447,7 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	if info.GetState() != librbd.MirrorImageEnabled.String() {
 		err = rbdVol.HandleParentImageExistence(ctx, flattenMode)
@@ -317,7 +460,7 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 		if err != nil {
 			log.ErrorLog(ctx, err.Error())
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -334,20 +477,25 @@ func (rs *ReplicationServer) DisableVolumeReplication(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getMirrorSecrets(volumeID, req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := rs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rs.VolumeLocks.Release(volumeID)
+	defer rs.VolumeLocks.Release(volumeID, token)
 
-	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), req.GetSecrets())
+	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), secrets)
 	defer mgr.Destroy(ctx)
 
 	rbdVol, err := mgr.GetVolumeByID(ctx, volumeID)
@@ -356,7 +504,7 @@ func (rs *ReplicationServer) DisableVolumeReplication(ctx context.Context,
 	}
 	mirror, err := rbdVol.ToMirror()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// extract the force option
@@ -369,7 +517,7 @@ func (rs *ReplicationServer) DisableVolumeReplication(ctx context.Context,
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	switch info.GetState() {
 	// image is already in disabled state
@@ -402,20 +550,30 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getMirrorSecrets(volumeID, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	rpoThreshold, err := getRPOThreshold(req.GetParameters())
+	if err != nil {
+		return nil, err
+	}
+
+	token, acquired := rs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rs.VolumeLocks.Release(volumeID)
+	defer rs.VolumeLocks.Release(volumeID, token)
 
-	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), req.GetSecrets())
+	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), secrets)
 	defer mgr.Destroy(ctx)
 
 	rbdVol, err := mgr.GetVolumeByID(ctx, volumeID)
@@ -424,14 +582,14 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 	}
 	mirror, err := rbdVol.ToMirror()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	info, err := mirror.GetMirroringInfo(ctx)
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if info.GetState() != librbd.MirrorImageEnabled.String() {
@@ -443,35 +601,19 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 	}
 
 	// promote secondary to primary
+	path := pathPrimary
 	if !info.IsPrimary() {
-		if req.GetForce() {
-			// workaround for https://github.com/ceph/ceph-csi/issues/2736
-			// TODO: remove this workaround when the issue is fixed
-			err = mirror.ForcePromote(ctx, cr)
-		} else {
-			err = mirror.Promote(ctx, req.GetForce())
-		}
+		path, err = promoteImage(ctx, cr, mirror, req.GetForce(), rpoThreshold)
 		if err != nil {
-			log.ErrorLog(ctx, err.Error())
-			// In case of the DR the image on the primary site cannot be
-			// demoted as the cluster is down, during failover the image need
-			// to be force promoted. RBD returns `Device or resource busy`
-			// error message if the image cannot be promoted for above reason.
-			// Return FailedPrecondition so that replication operator can send
-			// request to force promote the image.
-			if strings.Contains(err.Error(), "Device or resource busy") {
-				return nil, status.Error(codes.FailedPrecondition, err.Error())
-			}
-
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, err
 		}
 	}
 
 	interval, startTime := getSchedulingDetails(req.GetParameters())
 	if interval != admin.NoInterval {
-		err = mirror.AddSnapshotScheduling(interval, startTime)
+		err = updateSnapshotScheduling(ctx, mirror, interval, startTime)
 		if err != nil {
-			return nil, err
+			return nil, util.GRPCError(err)
 		}
 		log.DebugLog(
 			ctx,
@@ -481,9 +623,99 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 			rbdVol)
 	}
 
+	reportReplicationPath(ctx, volumeID, path)
+
 	return &replication.PromoteVolumeResponse{}, nil
 }
 
+// promoteImage promotes the secondary image. The image is promoted without
+// force first, which succeeds when it was demoted on the other cluster. When
+// the other cluster did not demote the image, like when it is down, the image
+// is force promoted if requested, after its last sync was checked against the
+// rpoThreshold.
+func promoteImage(
+	ctx context.Context,
+	cr *util.Credentials,
+	mirror types.Mirror,
+	force bool,
+	rpoThreshold time.Duration,
+) (replicationPath, error) {
+	err := mirror.Promote(ctx, false)
+	if err == nil {
+		return pathPromoted, nil
+	}
+	log.ErrorLog(ctx, err.Error())
+	// In case of the DR the image on the primary site cannot be demoted as
+	// the cluster is down, during failover the image need to be force
+	// promoted. RBD returns `Device or resource busy` error message if the
+	// image cannot be promoted for above reason. Return FailedPrecondition
+	// so that replication operator can send request to force promote the
+	// image.
+	if !strings.Contains(err.Error(), "Device or resource busy") {
+		return "", util.GRPCError(err)
+	}
+	if !force {
+		return "", status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	if rpoThreshold > 0 {
+		sts, sErr := mirror.GetGlobalMirroringStatus(ctx)
+		if sErr != nil {
+			log.ErrorLog(ctx, sErr.Error())
+
+			return "", util.GRPCError(sErr)
+		}
+		localStatus, sErr := sts.GetLocalSiteStatus()
+		if sErr != nil {
+			log.ErrorLog(ctx, sErr.Error())
+
+			return "", status.Errorf(codes.Internal, "failed to get local status: %v", sErr)
+		}
+		err = checkLastSyncAge(ctx, localStatus, rpoThreshold, time.Now())
+		if err != nil {
+			log.ErrorLog(ctx, err.Error())
+
+			return "", err
+		}
+	}
+
+	// workaround for https://github.com/ceph/ceph-csi/issues/2736
+	// TODO: remove this workaround when the issue is fixed
+	err = mirror.ForcePromote(ctx, cr)
+	if err != nil {
+		log.ErrorLog(ctx, err.Error())
+
+		return "", util.GRPCError(err)
+	}
+
+	return pathForcePromoted, nil
+}
+
+// checkLastSyncAge returns a FailedPrecondition error when the last synced
+// snapshot of the local image is older than the rpoThreshold, or when the
+// time of the last sync is not known.
+func checkLastSyncAge(
+	ctx context.Context,
+	localStatus types.SiteStatus,
+	rpoThreshold time.Duration,
+	now time.Time,
+) error {
+	info, err := getLastSyncInfo(ctx, localStatus.GetDescription())
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition,
+			"refusing to force promote, the last sync is not known: %v", err)
+	}
+
+	age := now.Sub(info.GetLastSyncTime().AsTime())
+	if age > rpoThreshold {
+		return status.Errorf(codes.FailedPrecondition,
+			"refusing to force promote, the last sync was %s ago, more than the %s of %s",
+			age.Truncate(time.Second), rpoThresholdKey, rpoThreshold)
+	}
+
+	return nil
+}
+
 // DemoteVolume extracts the RBD volume information from the
 // volumeID, If the image is present, mirroring is enabled and the
 // image is in promoted state it will demote the volume as secondary.
@@ -495,20 +727,30 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getMirrorSecrets(volumeID, req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	autoResync, err := getAutoResync(req.GetParameters())
+	if err != nil {
+		return nil, err
+	}
+
+	token, acquired := rs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rs.VolumeLocks.Release(volumeID)
+	defer rs.VolumeLocks.Release(volumeID, token)
 
-	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), req.GetSecrets())
+	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), secrets)
 	defer mgr.Destroy(ctx)
 
 	rbdVol, err := mgr.GetVolumeByID(ctx, volumeID)
@@ -517,21 +759,21 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 	}
 	mirror, err := rbdVol.ToMirror()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	creationTime, err := rbdVol.GetCreationTime(ctx)
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	info, err := mirror.GetMirroringInfo(ctx)
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if info.GetState() != librbd.MirrorImageEnabled.String() {
@@ -543,6 +785,7 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 	}
 
 	// demote image to secondary
+	path := pathSecondary
 	if info.IsPrimary() {
 		// store the image creation time for resync
 		_, err = rbdVol.GetMetadata(imageCreationTimeKey)
@@ -553,20 +796,111 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 		if err != nil {
 			log.ErrorLog(ctx, err.Error())
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		err = mirror.Demote(ctx)
 		if err != nil {
 			log.ErrorLog(ctx, err.Error())
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
+		path = pathDemoted
 	}
 
+	if autoResync {
+		resynced, rErr := resyncSplitBrain(ctx, rbdVol, mirror, creationTime)
+		if rErr != nil {
+			return nil, rErr
+		}
+		if resynced {
+			path = pathResync
+		}
+	}
+
+	reportReplicationPath(ctx, volumeID, path)
+
 	return &replication.DemoteVolumeResponse{}, nil
 }
 
+// isSplitBrain returns true when the mirroring of the local image stopped
+// because of a split-brain, the image was primary on both clusters.
+func isSplitBrain(localStatus types.SiteStatus) bool {
+	return localStatus.GetState() == librbd.MirrorImageStatusStateError.String() &&
+		strings.Contains(localStatus.GetDescription(), "split-brain")
+}
+
+// resyncSplitBrain requests a resync of the secondary image when it is in
+// split-brain, and returns true when it did. The rbd-mirror daemon reports
+// the split-brain some time after the demotion, a later DemoteVolume
+// resyncs the image then. Like ResyncVolume, the image is only resynced when
+// its creation time matches the one that was stored on demotion, the image
+// that is recreated by the resync does not have it. The image ID in the
+// journal is repaired once the recreated image is replaying.
+func resyncSplitBrain(
+	ctx context.Context,
+	rbdVol types.Volume,
+	mirror types.Mirror,
+	creationTime *time.Time,
+) (bool, error) {
+	sts, err := mirror.GetGlobalMirroringStatus(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, err.Error())
+
+		return false, getGRPCError(err)
+	}
+	localStatus, err := sts.GetLocalSiteStatus()
+	if err != nil {
+		log.ErrorLog(ctx, err.Error())
+
+		return false, status.Errorf(codes.Internal, "failed to get local status: %v", err)
+	}
+
+	savedImageTime, err := rbdVol.GetMetadata(imageCreationTimeKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return false, status.Errorf(codes.Internal,
+			"failed to get %s key from image metadata for %s: %s",
+			imageCreationTimeKey,
+			rbdVol,
+			err.Error())
+	}
+
+	if !isSplitBrain(localStatus) {
+		if savedImageTime == "" && localStatus.IsUP() &&
+			localStatus.GetState() == librbd.MirrorImageStatusStateReplaying.String() {
+			err = rbdVol.RepairResyncedImageID(ctx, true)
+			if err != nil {
+				return false, status.Errorf(codes.Internal, "failed to resync Image ID: %s", err.Error())
+			}
+		}
+
+		return false, nil
+	}
+
+	if savedImageTime == "" {
+		log.DebugLog(ctx, "image %s is in split-brain, but was resynced already", rbdVol)
+
+		return false, nil
+	}
+	st, err := timestampFromString(savedImageTime)
+	if err != nil {
+		return false, status.Errorf(codes.Internal, "failed to parse image creation time: %s", err.Error())
+	}
+	if !st.Equal(*creationTime) {
+		log.DebugLog(ctx, "image %s is in split-brain, but was recreated already", rbdVol)
+
+		return false, nil
+	}
+
+	log.UsefulLog(ctx, "resyncing image %s in split-brain: %s", rbdVol, localStatus.GetDescription())
+	err = mirror.Resync(ctx)
+	if err != nil {
+		return false, getGRPCError(err)
+	}
+
+	return true, nil
+}
+
 // checkRemoteSiteStatus checks the state of the remote cluster.
 // It returns true if the state of the remote cluster is up and unknown.
 func checkRemoteSiteStatus(ctx context.Context, mirrorStatus []types.SiteStatus) bool {
@@ -606,19 +940,24 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getMirrorSecrets(volumeID, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := rs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rs.VolumeLocks.Release(volumeID)
-	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), req.GetSecrets())
+	defer rs.VolumeLocks.Release(volumeID, token)
+	mgr := rbd.NewManager(rs.csiID, req.GetParameters(), secrets)
 	defer mgr.Destroy(ctx)
 
 	rbdVol, err := mgr.GetVolumeByID(ctx, volumeID)
@@ -627,7 +966,7 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 	}
 	mirror, err := rbdVol.ToMirror()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	info, err := mirror.GetMirroringInfo(ctx)
@@ -660,7 +999,7 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 		}
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	ready := false
 
@@ -698,6 +1037,11 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 		return nil, status.Errorf(codes.Internal, "failed to get image info for %s: %s", rbdVol, err.Error())
 	}
 
+	clusterID, err := rbdVol.GetClusterID(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get cluster of %s: %s", rbdVol, err.Error())
+	}
+
 	// image creation time is stored in the image metadata. it looks like
 	// `"seconds:1692879841 nanos:631526669"`
 	// If the image gets resynced the local image creation time will be
@@ -719,17 +1063,29 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 		}
 		log.DebugLog(ctx, "image %s, savedImageTime=%v, currentImageTime=%v", rbdVol, st, creationTime)
 		if req.GetForce() && st.Equal(*creationTime) {
+			// the resync counts against the limits of the background
+			// operations until the image is reported as ready
+			if !util.StartBackgroundOperation(clusterID, util.ResyncOperation, volumeID) {
+				return nil, status.Errorf(codes.ResourceExhausted,
+					"resync of volume %s waits until other background operations finished", rbdVol)
+			}
 			err = mirror.Resync(ctx)
 			if err != nil {
+				util.FinishBackgroundOperation(clusterID, util.ResyncOperation, volumeID)
+
 				return nil, getGRPCError(err)
 			}
 		}
 	}
 
+	if ready {
+		util.FinishBackgroundOperation(clusterID, util.ResyncOperation, volumeID)
+	}
+
 	if !ready {
 		err = checkVolumeResyncStatus(ctx, localStatus)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -800,8 +1156,8 @@ func getGRPCError(err error) error {
 		}
 	}
 
-	// Handle any other non nil error not listed in the map as internal error
-	return status.Error(codes.Internal, err.Error())
+	// Classify any other non nil error that is not listed in the map
+	return util.GRPCError(err)
 }
 
 // GetVolumeReplicationInfo extracts the RBD volume information from the volumeID, If the
@@ -813,19 +1169,24 @@ func (rs *ReplicationServer) GetVolumeReplicationInfo(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getMirrorSecrets(volumeID, req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := rs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer rs.VolumeLocks.Release(volumeID)
-	mgr := rbd.NewManager(rs.csiID, nil, req.GetSecrets())
+	defer rs.VolumeLocks.Release(volumeID, token)
+	mgr := rbd.NewManager(rs.csiID, nil, secrets)
 	defer mgr.Destroy(ctx)
 
 	rbdVol, err := mgr.GetVolumeByID(ctx, volumeID)
@@ -843,7 +1204,7 @@ func (rs *ReplicationServer) GetVolumeReplicationInfo(ctx context.Context,
 	}
 	mirror, err := rbdVol.ToMirror()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	info, err := mirror.GetMirroringInfo(ctx)
@@ -869,7 +1230,7 @@ func (rs *ReplicationServer) GetVolumeReplicationInfo(ctx context.Context,
 		}
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	remoteStatus, err := mirrorStatus.GetRemoteSiteStatus(ctx)
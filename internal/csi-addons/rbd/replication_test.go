@@ -216,6 +216,48 @@ func TestGetSchedulingDetails(t *testing.T) {
 	}
 }
 
+func TestGetStaleSchedules(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		schedules []admin.ScheduleTerm
+		interval  admin.Interval
+		want      []admin.ScheduleTerm
+	}{
+		{
+			"no schedules",
+			nil,
+			admin.Interval("1h"),
+			nil,
+		},
+		{
+			"same interval",
+			[]admin.ScheduleTerm{
+				{Interval: "1h", StartTime: "14:00:00-05:00"},
+			},
+			admin.Interval("1h"),
+			nil,
+		},
+		{
+			"changed interval",
+			[]admin.ScheduleTerm{
+				{Interval: "1h", StartTime: "14:00:00-05:00"},
+				{Interval: "5m"},
+			},
+			admin.Interval("5m"),
+			[]admin.ScheduleTerm{
+				{Interval: "1h", StartTime: "14:00:00-05:00"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, getStaleSchedules(tt.schedules, tt.interval))
+		})
+	}
+}
+
 func TestCheckVolumeResyncStatus(t *testing.T) {
 	ctx := context.TODO()
 	t.Parallel()
@@ -741,3 +783,176 @@ func Test_getFlattenMode(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRPOThreshold(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		want       time.Duration
+		wantErr    bool
+	}{
+		{
+			name:       "rpoThreshold not set",
+			parameters: map[string]string{},
+			want:       0,
+		},
+		{
+			name:       "rpoThreshold in minutes",
+			parameters: map[string]string{rpoThresholdKey: "15m"},
+			want:       15 * time.Minute,
+		},
+		{
+			name:       "invalid rpoThreshold",
+			parameters: map[string]string{rpoThresholdKey: "1d"},
+			wantErr:    true,
+		},
+		{
+			name:       "zero rpoThreshold",
+			parameters: map[string]string{rpoThresholdKey: "0s"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getRPOThreshold(tt.parameters)
+			if tt.wantErr {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetAutoResync(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		want       bool
+		wantErr    bool
+	}{
+		{
+			name:       "autoResync not set",
+			parameters: map[string]string{},
+			want:       false,
+		},
+		{
+			name:       "autoResync enabled",
+			parameters: map[string]string{autoResyncKey: "true"},
+			want:       true,
+		},
+		{
+			name:       "invalid autoResync",
+			parameters: map[string]string{autoResyncKey: "yes please"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getAutoResync(tt.parameters)
+			if tt.wantErr {
+				require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckLastSyncAge(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+	now := time.Unix(1684675261, 0).Add(10 * time.Minute)
+	replaying := `replaying, {"last_snapshot_bytes":81920,"last_snapshot_sync_seconds":0,` +
+		`"local_snapshot_timestamp":1684675261,"remote_snapshot_timestamp":1684675261,"replay_state":"idle"}`
+	tests := []struct {
+		name         string
+		description  string
+		rpoThreshold time.Duration
+		wantErr      bool
+	}{
+		{
+			name:         "last sync within the threshold",
+			description:  replaying,
+			rpoThreshold: 15 * time.Minute,
+		},
+		{
+			name:         "last sync older than the threshold",
+			description:  replaying,
+			rpoThreshold: 5 * time.Minute,
+			wantErr:      true,
+		},
+		{
+			name:         "last sync not known",
+			description:  "stopped",
+			rpoThreshold: 15 * time.Minute,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			localStatus := corerbd.SiteMirrorImageStatus{
+				SiteMirrorImageStatus: librbd.SiteMirrorImageStatus{
+					Description: tt.description,
+				},
+			}
+			err := checkLastSyncAge(ctx, localStatus, tt.rpoThreshold, now)
+			if tt.wantErr {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestIsSplitBrain(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		state       librbd.MirrorImageStatusState
+		description string
+		want        bool
+	}{
+		{
+			name:        "split-brain",
+			state:       librbd.MirrorImageStatusStateError,
+			description: "split-brain",
+			want:        true,
+		},
+		{
+			name:        "other error",
+			state:       librbd.MirrorImageStatusStateError,
+			description: "failed to bootstrap",
+			want:        false,
+		},
+		{
+			name:        "replaying",
+			state:       librbd.MirrorImageStatusStateReplaying,
+			description: "replaying",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			localStatus := corerbd.SiteMirrorImageStatus{
+				SiteMirrorImageStatus: librbd.SiteMirrorImageStatus{
+					State:       tt.state,
+					Description: tt.description,
+				},
+			}
+			require.Equal(t, tt.want, isSplitBrain(localStatus))
+		})
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+
+	rbdutil "github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// SnapshotExportServiceName is the name of the CSI-Addons service that
+	// exports snapshots to an object store.
+	SnapshotExportServiceName = "rbd.csi.ceph.com.SnapshotExportController"
+	// ExportSnapshotMethod is the full name of the ExportSnapshot procedure.
+	ExportSnapshotMethod = "/" + SnapshotExportServiceName + "/ExportSnapshot"
+
+	// fields of the ExportSnapshot request
+	exportSnapshotIDField = "snapshot_id"
+	exportKeyField        = "key"
+)
+
+// snapshotExportController is the interface of the handler of the
+// SnapshotExportController service.
+type snapshotExportController interface {
+	ExportSnapshot(ctx context.Context, req *structpb.Struct, secrets map[string]string) (*emptypb.Empty, error)
+}
+
+// snapshotExportServiceDesc describes the SnapshotExportController service.
+// The CSI-Addons specification does not contain a service for exporting
+// snapshots, the request is a google.protobuf.Struct with the fields:
+//
+//   - snapshot_id: the ID of the CSI snapshot to export
+//   - key: the name of the object to store the snapshot in
+//   - secrets: the credentials of the Ceph cluster and the object store
+var snapshotExportServiceDesc = grpc.ServiceDesc{
+	ServiceName: SnapshotExportServiceName,
+	HandlerType: (*snapshotExportController)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ExportSnapshot",
+			Handler:    exportSnapshotHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+// exportSnapshotHandler decodes the ExportSnapshot request and passes it to
+// the server. The secrets are removed from the request before the
+// interceptors run, so that they do not get logged.
+//
+//nolint:revive // the signature is defined by grpc.MethodDesc
+func exportSnapshotHandler(
+	srv any,
+	ctx context.Context,
+	dec func(any) error,
+	interceptor grpc.UnaryServerInterceptor,
+) (any, error) {
+	req := &structpb.Struct{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	secrets, err := takeSecrets(req)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sec, ok := srv.(snapshotExportController)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%T does not implement ExportSnapshot", srv)
+	}
+
+	handler := func(ctx context.Context, req any) (any, error) {
+		//nolint:forcetypeassert // the request is passed through by the interceptor
+		return sec.ExportSnapshot(ctx, req.(*structpb.Struct), secrets)
+	}
+	if interceptor == nil {
+		return handler(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExportSnapshotMethod,
+	}
+
+	return interceptor(ctx, req, info, handler)
+}
+
+// SnapshotExportServer implements the SnapshotExportController service, it
+// stores the contents of a snapshot in an S3 compatible object store.
+type SnapshotExportServer struct {
+	snapshotLocks *util.VolumeLocks
+}
+
+// NewSnapshotExportServer creates a new SnapshotExportServer.
+func NewSnapshotExportServer(snapshotLocks *util.VolumeLocks) *SnapshotExportServer {
+	return &SnapshotExportServer{snapshotLocks: snapshotLocks}
+}
+
+func (ses *SnapshotExportServer) RegisterService(server grpc.ServiceRegistrar) {
+	server.RegisterService(&snapshotExportServiceDesc, ses)
+}
+
+// ExportSnapshot stores the snapshot from the request as object key in the
+// object store that is configured in the secrets. The object is in the
+// "rbd diff v1" format and can be applied to an image with
+// `rbd import-diff`.
+func (ses *SnapshotExportServer) ExportSnapshot(
+	ctx context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*emptypb.Empty, error) {
+	var snapshotID, key string
+	for field, value := range map[string]*string{
+		exportSnapshotIDField: &snapshotID,
+		exportKeyField:        &key,
+	} {
+		var err error
+		*value, err = getStringField(req, field)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if snapshotID == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty snapshot ID in request")
+	}
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty key in request")
+	}
+
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+	defer cr.DeleteCredentials()
+
+	token, acquired := ses.snapshotLocks.TryAcquire(snapshotID)
+	if !acquired {
+		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, snapshotID)
+
+		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, snapshotID)
+	}
+	defer ses.snapshotLocks.Release(snapshotID, token)
+
+	log.DebugLog(ctx, "exporting snapshot %s to %q", snapshotID, key)
+
+	err = rbdutil.ExportSnapshot(ctx, snapshotID, key, secrets, cr)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to export snapshot %s: %v", snapshotID, err)
+
+		switch {
+		case errors.Is(err, rbdutil.ErrSnapNotFound), errors.Is(err, rbdutil.ErrImageNotFound):
+			return nil, status.Errorf(codes.NotFound, "snapshot ID %s not found", snapshotID)
+		case errors.Is(err, rbdutil.ErrInvalidArgument):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	return &emptypb.Empty{}, nil
+}
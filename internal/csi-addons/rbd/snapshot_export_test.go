@@ -0,0 +1,109 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type fakeExportController struct {
+	req     *structpb.Struct
+	secrets map[string]string
+}
+
+func (f *fakeExportController) ExportSnapshot(
+	_ context.Context,
+	req *structpb.Struct,
+	secrets map[string]string,
+) (*emptypb.Empty, error) {
+	f.req = req
+	f.secrets = secrets
+
+	return &emptypb.Empty{}, nil
+}
+
+// TestExportSnapshotHandler checks that the secrets are removed from the
+// request before the interceptors see it.
+func TestExportSnapshotHandler(t *testing.T) {
+	t.Parallel()
+
+	req, err := structpb.NewStruct(map[string]any{
+		"snapshot_id": "0001-0009-rook-ceph-0000000000000001-snapshot",
+		"key":         "backups/snapshot",
+		"secrets":     map[string]any{"userID": "admin", "s3SecretAccessKey": "secret"},
+	})
+	require.NoError(t, err)
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	dec := func(m any) error {
+		//nolint:forcetypeassert // the handler decodes into a proto.Message
+		return proto.Unmarshal(data, m.(proto.Message))
+	}
+
+	var intercepted *structpb.Struct
+	interceptor := func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		require.Equal(t, ExportSnapshotMethod, info.FullMethod)
+		intercepted, _ = req.(*structpb.Struct)
+
+		return handler(ctx, req)
+	}
+
+	fake := &fakeExportController{}
+	_, err = exportSnapshotHandler(fake, context.TODO(), dec, interceptor)
+	require.NoError(t, err)
+	require.NotContains(t, intercepted.GetFields(), secretsField)
+	require.Equal(t, "backups/snapshot", fake.req.GetFields()[exportKeyField].GetStringValue())
+	require.Equal(t, map[string]string{"userID": "admin", "s3SecretAccessKey": "secret"}, fake.secrets)
+}
+
+// TestExportSnapshot is a minimal test for the ExportSnapshot() procedure.
+// During unit-testing, there is no Ceph cluster available, so only the
+// validation of the request can be tested.
+func TestExportSnapshot(t *testing.T) {
+	t.Parallel()
+
+	ses := NewSnapshotExportServer(util.NewVolumeLocks())
+
+	for _, fields := range []map[string]any{
+		{},
+		{"snapshot_id": "snap"},
+		{"key": "backup"},
+		{"snapshot_id": 1, "key": "backup"},
+	} {
+		req, err := structpb.NewStruct(fields)
+		require.NoError(t, err)
+
+		_, err = ses.ExportSnapshot(context.TODO(), req, nil)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
@@ -87,7 +87,7 @@ func (cas *CSIAddonsServer) RegisterService(svc CSIAddonsService) {
 // returned.
 func (cas *CSIAddonsServer) Start(middlewareConfig csicommon.MiddlewareServerOptionConfig) error {
 	// create the gRPC server and register services
-	cas.server = grpc.NewServer(csicommon.NewMiddlewareServerOption(middlewareConfig))
+	cas.server = grpc.NewServer(csicommon.NewServerOptions(middlewareConfig)...)
 
 	for _, svc := range cas.services {
 		svc.RegisterService(cas.server)
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// nodeServicePrefix is the prefix of the methods of the CSI node service.
+	nodeServicePrefix = "/csi.v1.Node/"
+	// nodeStageMethod is refused while draining.
+	nodeStageMethod = nodeServicePrefix + "NodeStageVolume"
+
+	// drainPollInterval is the interval to check for in-flight requests.
+	drainPollInterval = 100 * time.Millisecond
+)
+
+// drainer keeps track of the in-flight requests of the node service, so that
+// they can finish before the nodeplugin is stopped.
+type drainer struct {
+	mutex    sync.Mutex
+	draining bool
+	inflight int
+	hooks    []func(ctx context.Context)
+}
+
+var nodeDrainer = &drainer{}
+
+// OnDrain registers a function that is called after the in-flight requests
+// finished while draining. It can be used to flush state to disk, or to stop
+// go routines that work on the volumes.
+func OnDrain(hook func(ctx context.Context)) {
+	nodeDrainer.mutex.Lock()
+	defer nodeDrainer.mutex.Unlock()
+
+	nodeDrainer.hooks = append(nodeDrainer.hooks, hook)
+}
+
+// begin registers an in-flight request, it returns false when the request
+// needs to be refused.
+func (d *drainer) begin(method string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.draining && method == nodeStageMethod {
+		return false
+	}
+	d.inflight++
+
+	return true
+}
+
+// end unregisters an in-flight request.
+func (d *drainer) end() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.inflight--
+}
+
+// idle returns true when no requests are in-flight.
+func (d *drainer) idle() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.inflight == 0
+}
+
+// drain refuses new NodeStageVolume requests, waits until the in-flight
+// requests finished and calls the hooks. When the ctx is done before all
+// requests finished, the hooks are not called and the error of the ctx is
+// returned.
+func (d *drainer) drain(ctx context.Context) error {
+	d.mutex.Lock()
+	d.draining = true
+	d.mutex.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for !d.idle() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	d.mutex.Lock()
+	hooks := d.hooks
+	d.mutex.Unlock()
+
+	for _, hook := range hooks {
+		hook(ctx)
+	}
+
+	return nil
+}
+
+// drainGRPC tracks the in-flight requests of the node service, and refuses
+// NodeStageVolume requests with a retriable error while draining.
+func drainGRPC(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if !strings.HasPrefix(info.FullMethod, nodeServicePrefix) {
+		return handler(ctx, req)
+	}
+
+	if !nodeDrainer.begin(info.FullMethod) {
+		return nil, status.Error(codes.Unavailable, "the nodeplugin is draining, retry the request later")
+	}
+	defer nodeDrainer.end()
+
+	return handler(ctx, req)
+}
+
+// StopOnSignal drains the in-flight requests when SIGTERM or SIGINT is
+// received, and stops the server gracefully afterwards. The server is stopped
+// forcefully when draining and stopping takes longer than the timeout.
+func StopOnSignal(server NonBlockingGRPCServer, timeout time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	sig := <-signals
+	log.DefaultLog("received signal %v, draining the requests", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := nodeDrainer.drain(ctx)
+	if err != nil {
+		log.ErrorLogMsg("failed to drain the requests: %v", err)
+		server.ForceStop()
+
+		return
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		server.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.DefaultLog("drained the requests, stopped the server")
+	case <-ctx.Done():
+		log.ErrorLogMsg("failed to stop the server gracefully: %v", ctx.Err())
+		server.ForceStop()
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainerBegin(t *testing.T) {
+	t.Parallel()
+
+	d := &drainer{}
+	require.True(t, d.begin(nodeStageMethod))
+	require.True(t, d.begin(nodeServicePrefix+"NodeUnstageVolume"))
+	require.False(t, d.idle())
+
+	d.draining = true
+	require.False(t, d.begin(nodeStageMethod))
+	require.True(t, d.begin(nodeServicePrefix+"NodePublishVolume"))
+
+	d.end()
+	d.end()
+	d.end()
+	require.True(t, d.idle())
+}
+
+func TestDrainerDrain(t *testing.T) {
+	t.Parallel()
+
+	d := &drainer{}
+	flushed := false
+	d.hooks = append(d.hooks, func(context.Context) {
+		flushed = true
+	})
+
+	require.True(t, d.begin(nodeServicePrefix+"NodeUnstageVolume"))
+
+	// the in-flight request does not finish in time
+	ctx, cancel := context.WithTimeout(context.Background(), 3*drainPollInterval)
+	defer cancel()
+	require.ErrorIs(t, d.drain(ctx), context.DeadlineExceeded)
+	require.False(t, flushed)
+
+	go func() {
+		time.Sleep(2 * drainPollInterval)
+		d.end()
+	}()
+
+	require.NoError(t, d.drain(context.Background()))
+	require.True(t, flushed)
+}
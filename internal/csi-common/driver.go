@@ -85,6 +85,11 @@ func (d *CSIDriver) GetInstanceID() string {
 	return d.instance
 }
 
+// GetNodeID returns the ID of the node the CSI driver runs on.
+func (d *CSIDriver) GetNodeID() string {
+	return d.nodeID
+}
+
 // ValidateControllerServiceRequest validates the controller
 // plugin capabilities.
 func (d *CSIDriver) ValidateControllerServiceRequest(c csi.ControllerServiceCapability_RPC_Type) error {
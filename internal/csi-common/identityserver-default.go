@@ -19,6 +19,7 @@ package csicommon
 import (
 	"context"
 
+	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -50,6 +51,7 @@ func (ids *DefaultIdentityServer) GetPluginInfo(
 	return &csi.GetPluginInfoResponse{
 		Name:          ids.Driver.name,
 		VendorVersion: ids.Driver.version,
+		Manifest:      util.GetCSIConfigManifest(),
 	}, nil
 }
 
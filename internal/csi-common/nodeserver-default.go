@@ -18,6 +18,7 @@ package csicommon
 
 import (
 	"context"
+	"strings"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
 
@@ -35,6 +36,9 @@ type DefaultNodeServer struct {
 	NodeLabels map[string]string
 	// CLIReadAffinityOptions contains map options passed through command line to enable read affinity.
 	CLIReadAffinityOptions string
+	// MaxVolumesPerNode is the number of volumes of the driver that can be
+	// published on the node, unlimited when 0
+	MaxVolumesPerNode int64
 }
 
 // NodeGetInfo returns node ID.
@@ -51,6 +55,7 @@ func (ns *DefaultNodeServer) NodeGetInfo(
 	return &csi.NodeGetInfoResponse{
 		NodeId:             ns.Driver.nodeID,
 		AccessibleTopology: csiTopology,
+		MaxVolumesPerNode:  ns.MaxVolumesPerNode,
 	}, nil
 }
 
@@ -106,3 +111,31 @@ func MountOptionContains(mountOptions []string, opt string) bool {
 
 	return false
 }
+
+// seLinuxMountOptions are the prefixes of the mount options that set the
+// SELinux context of a filesystem.
+var seLinuxMountOptions = []string{"context=", "fscontext=", "defcontext=", "rootcontext="}
+
+// RemoveSELinuxMountOptions returns the mount options without the options
+// that set the SELinux context. Kubelet adds the context of the Pod to the
+// mount flags when seLinuxMount is enabled in the CSIDriver, the filesystem
+// gets the context when the volume is staged. Bind mounts share the context
+// of the staged filesystem and can not set a different one.
+func RemoveSELinuxMountOptions(mountOptions []string) []string {
+	options := make([]string, 0, len(mountOptions))
+	for _, opt := range mountOptions {
+		isSELinux := false
+		for _, prefix := range seLinuxMountOptions {
+			if strings.HasPrefix(opt, prefix) {
+				isSELinux = true
+
+				break
+			}
+		}
+		if !isSELinux {
+			options = append(options, opt)
+		}
+	}
+
+	return options
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// controllerServicePrefix is the prefix of the methods of the CSI
+	// controller service.
+	controllerServicePrefix = "/csi.v1.Controller/"
+	// groupControllerServicePrefix is the prefix of the methods of the CSI
+	// group controller service.
+	groupControllerServicePrefix = "/csi.v1.GroupController/"
+)
+
+// rpcLimiter limits the number of concurrent RPCs of the node and controller
+// services.
+type rpcLimiter struct {
+	node       *semaphore.Weighted
+	controller *semaphore.Weighted
+}
+
+// newRPCLimiter returns a rpcLimiter, or nil when there are no limits.
+func newRPCLimiter(maxNodeRPCs, maxControllerRPCs int) *rpcLimiter {
+	if maxNodeRPCs <= 0 && maxControllerRPCs <= 0 {
+		return nil
+	}
+
+	rl := &rpcLimiter{}
+	if maxNodeRPCs > 0 {
+		rl.node = semaphore.NewWeighted(int64(maxNodeRPCs))
+	}
+	if maxControllerRPCs > 0 {
+		rl.controller = semaphore.NewWeighted(int64(maxControllerRPCs))
+	}
+
+	return rl
+}
+
+// semaphoreFor returns the semaphore for the class of the method, or nil when
+// the method is not limited.
+func (rl *rpcLimiter) semaphoreFor(method string) *semaphore.Weighted {
+	switch {
+	case strings.HasPrefix(method, nodeServicePrefix):
+		return rl.node
+	case strings.HasPrefix(method, controllerServicePrefix),
+		strings.HasPrefix(method, groupControllerServicePrefix):
+		return rl.controller
+	}
+
+	return nil
+}
+
+// intercept waits until the number of running RPCs of the class of the
+// method is below the limit. When the deadline of the request is reached while
+// waiting, the request fails with codes.ResourceExhausted.
+func (rl *rpcLimiter) intercept(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	sem := rl.semaphoreFor(info.FullMethod)
+	if sem == nil {
+		return handler(ctx, req)
+	}
+
+	if err := sem.Acquire(ctx, 1); err != nil {
+		log.WarningLog(ctx, "too many concurrent requests, %s was not started: %v", info.FullMethod, err)
+
+		return nil, status.Errorf(codes.ResourceExhausted, "too many concurrent requests: %v", err)
+	}
+	defer sem.Release(1)
+
+	return handler(ctx, req)
+}
+
+// rpcTimeoutInterceptor returns an interceptor that sets a deadline for the
+// methods with a timeout. The timeouts are key'd by the name of the method
+// without service, like "NodeStageVolume".
+//
+// The handler is expected to stop and clean up when the deadline is reached.
+// If it returns an error after the deadline, the error is replaced by
+// codes.DeadlineExceeded, so that the caller retries the request.
+func rpcTimeoutInterceptor(timeouts map[string]time.Duration) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		timeout, ok := timeouts[path.Base(info.FullMethod)]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		resp, err := handler(ctx, req)
+		if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.ErrorLog(ctx, "%s did not finish within %s: %v", info.FullMethod, timeout, err)
+
+			return nil, status.Errorf(codes.DeadlineExceeded, "%s did not finish within %s: %v",
+				path.Base(info.FullMethod), timeout, err)
+		}
+
+		return resp, err
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewRPCLimiter(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, newRPCLimiter(0, 0))
+
+	rl := newRPCLimiter(1, 0)
+	require.NotNil(t, rl.semaphoreFor(nodeStageMethod))
+	require.Nil(t, rl.semaphoreFor(controllerServicePrefix+"CreateVolume"))
+	require.Nil(t, rl.semaphoreFor("/csi.v1.Identity/Probe"))
+
+	rl = newRPCLimiter(0, 1)
+	require.Nil(t, rl.semaphoreFor(nodeStageMethod))
+	require.NotNil(t, rl.semaphoreFor(controllerServicePrefix+"CreateVolume"))
+	require.NotNil(t, rl.semaphoreFor(groupControllerServicePrefix+"CreateVolumeGroupSnapshot"))
+}
+
+func TestRPCLimiterIntercept(t *testing.T) {
+	t.Parallel()
+
+	rl := newRPCLimiter(1, 0)
+	info := &grpc.UnaryServerInfo{FullMethod: nodeStageMethod}
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	go func() {
+		_, _ = rl.intercept(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			close(started)
+			<-finish
+
+			return nil, nil
+		})
+	}()
+	<-started
+
+	// the limit is reached, the request waits until its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := rl.intercept(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	close(finish)
+	_, err = rl.intercept(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
+
+func TestRPCTimeoutInterceptor(t *testing.T) {
+	t.Parallel()
+
+	interceptor := rpcTimeoutInterceptor(map[string]time.Duration{
+		"NodeStageVolume": 10 * time.Millisecond,
+	})
+	waitForDeadline := func(ctx context.Context, _ interface{}) (interface{}, error) {
+		<-ctx.Done()
+
+		return nil, errors.New("stopped")
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: nodeStageMethod}
+	_, err := interceptor(context.Background(), nil, info, waitForDeadline)
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	// methods without timeout do not get a deadline
+	info = &grpc.UnaryServerInfo{FullMethod: nodeServicePrefix + "NodePublishVolume"}
+	_, err = interceptor(context.Background(), nil, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		_, ok := ctx.Deadline()
+		require.False(t, ok)
+
+		return nil, nil
+	})
+	require.NoError(t, err)
+}
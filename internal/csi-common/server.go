@@ -46,6 +46,8 @@ type Servers struct {
 	CS csi.ControllerServer
 	NS csi.NodeServer
 	GS csi.GroupControllerServer
+	// SMS is the SnapshotMetadata service, it is only registered when set.
+	SMS csi.SnapshotMetadataServer
 }
 
 // NewNonBlockingGRPCServer return non-blocking GRPC.
@@ -89,6 +91,8 @@ func (s *nonBlockingGRPCServer) serve(
 	srv Servers,
 	middlewareConfig MiddlewareServerOptionConfig,
 ) {
+	defer s.wg.Done()
+
 	proto, addr, err := parseEndpoint(endpoint)
 	if err != nil {
 		klog.Fatal(err.Error())
@@ -106,7 +110,7 @@ func (s *nonBlockingGRPCServer) serve(
 		klog.Fatalf("Failed to listen: %v", err)
 	}
 
-	server := grpc.NewServer(NewMiddlewareServerOption(middlewareConfig))
+	server := grpc.NewServer(NewServerOptions(middlewareConfig)...)
 	s.server = server
 
 	if srv.IS != nil {
@@ -121,6 +125,9 @@ func (s *nonBlockingGRPCServer) serve(
 	if srv.GS != nil {
 		csi.RegisterGroupControllerServer(server, srv.GS)
 	}
+	if srv.SMS != nil {
+		csi.RegisterSnapshotMetadataServer(server, srv.SMS)
+	}
 
 	log.DefaultLog("Listening for connections on address: %#v", listener.Addr())
 	err = server.Serve(listener)
@@ -27,6 +27,8 @@ import (
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/csi-addons/spec/lib/go/replication"
@@ -114,6 +116,14 @@ func NewGroupControllerServiceCapability(ctrlCap csi.GroupControllerServiceCapab
 // are instantiated when starting gRPC servers.
 type MiddlewareServerOptionConfig struct {
 	LogSlowOpInterval time.Duration
+	// MaxNodeRPCs is the maximum number of concurrent RPCs of the node
+	// service, unlimited when 0
+	MaxNodeRPCs int
+	// MaxControllerRPCs is the maximum number of concurrent RPCs of the
+	// controller and group controller services, unlimited when 0
+	MaxControllerRPCs int
+	// RPCTimeouts contains the timeouts for methods, by method name
+	RPCTimeouts map[string]time.Duration
 }
 
 // NewMiddlewareServerOption creates a new grpc.ServerOption that configures a
@@ -122,6 +132,8 @@ func NewMiddlewareServerOption(config MiddlewareServerOptionConfig) grpc.ServerO
 	middleWare := []grpc.UnaryServerInterceptor{
 		contextIDInjector,
 		logGRPC,
+		recordMetrics,
+		drainGRPC,
 	}
 
 	if config.LogSlowOpInterval > 0 {
@@ -137,11 +149,27 @@ func NewMiddlewareServerOption(config MiddlewareServerOptionConfig) grpc.ServerO
 		})
 	}
 
+	if rl := newRPCLimiter(config.MaxNodeRPCs, config.MaxControllerRPCs); rl != nil {
+		middleWare = append(middleWare, rl.intercept)
+	}
+
+	if len(config.RPCTimeouts) > 0 {
+		middleWare = append(middleWare, rpcTimeoutInterceptor(config.RPCTimeouts))
+	}
+
 	middleWare = append(middleWare, panicHandler)
 
 	return grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(middleWare...))
 }
 
+// NewServerOptions returns the options for the gRPC servers, the middleware
+// interceptors and the tracing of the calls (when enabled).
+func NewServerOptions(config MiddlewareServerOptionConfig) []grpc.ServerOption {
+	return append(
+		[]grpc.ServerOption{NewMiddlewareServerOption(config)},
+		tracing.ServerOptions()...)
+}
+
 // GetIDFromReplication returns the volumeID for Replication.
 func GetIDFromReplication(req interface{}) string {
 	getID := func(r interface {
@@ -250,6 +278,7 @@ func contextIDInjector(
 ) (interface{}, error) {
 	atomic.AddUint64(&id, 1)
 	ctx = context.WithValue(ctx, log.CtxKey, id)
+	ctx = context.WithValue(ctx, log.Method, info.FullMethod)
 	if reqID := getReqID(req); reqID != "" {
 		ctx = context.WithValue(ctx, log.ReqID, reqID)
 	}
@@ -268,7 +297,7 @@ func logGRPC(
 
 	resp, err := handler(ctx, req)
 	if err != nil {
-		klog.Errorf(log.Log(ctx, "GRPC error: %v"), err)
+		log.ErrorLog(ctx, "GRPC error: %v", err)
 	} else {
 		log.TraceLog(ctx, "GRPC response: %s", protosanitizer.StripSecrets(resp))
 	}
@@ -276,6 +305,48 @@ func logGRPC(
 	return resp, err
 }
 
+// getClusterID returns the clusterID of the request, from the parameters or
+// volume context when they contain it, or from the volume or snapshot ID
+// otherwise. An empty clusterID is returned when it is unknown.
+func getClusterID(req interface{}) string {
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		return r.GetParameters()[util.ClusterIDKey]
+	case *csi.CreateSnapshotRequest:
+		return util.GetClusterIDFromVolumeID(r.GetSourceVolumeId())
+	case *csi.NodeStageVolumeRequest:
+		if clusterID := r.GetVolumeContext()[util.ClusterIDKey]; clusterID != "" {
+			return clusterID
+		}
+	case *csi.NodePublishVolumeRequest:
+		if clusterID := r.GetVolumeContext()[util.ClusterIDKey]; clusterID != "" {
+			return clusterID
+		}
+	}
+
+	return util.GetClusterIDFromVolumeID(getReqID(req))
+}
+
+// recordMetrics records the duration and the status code of failed calls in
+// the metrics of the operations.
+func recordMetrics(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	code := ""
+	if err != nil {
+		code = status.Code(err).String()
+	}
+	metrics.ObserveOperation(info.FullMethod, getClusterID(req), time.Since(start), code)
+
+	return resp, err
+}
+
 func logSlowGRPC(
 	logInterval time.Duration,
 	ctx context.Context,
@@ -738,3 +738,38 @@ func TestIsReaderOnly(t *testing.T) {
 		})
 	}
 }
+
+func TestRemoveSELinuxMountOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		mountOptions []string
+		want         []string
+	}{
+		{
+			name:         "without SELinux options",
+			mountOptions: []string{"bind", "_netdev", "noatime"},
+			want:         []string{"bind", "_netdev", "noatime"},
+		},
+		{
+			name: "with context",
+			mountOptions: []string{
+				"bind", "_netdev", `context="system_u:object_r:container_file_t:s0:c1,c2"`,
+			},
+			want: []string{"bind", "_netdev"},
+		},
+		{
+			name:         "with other SELinux options",
+			mountOptions: []string{"bind", "fscontext=system_u:object_r:nfs_t:s0", "rootcontext=unconfined_u"},
+			want:         []string{"bind"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, RemoveSELinuxMountOptions(tt.mountOptions))
+		})
+	}
+}
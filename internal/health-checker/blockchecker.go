@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// blockSize is the size of the read from the block-device. It is the largest
+// logical block size that devices use, so that the read is aligned for
+// O_DIRECT.
+const blockSize = 4096
+
+var _ volumeChecker = &blockChecker{}
+
+type blockChecker struct {
+	checker
+
+	// device is the path to the block-device that is used for checking.
+	device string
+}
+
+func newBlockChecker(device string) ConditionChecker {
+	bc := &blockChecker{
+		device: device,
+	}
+	bc.initDefaults(bc)
+	bc.fsType = "block"
+
+	bc.checker.runChecker = func() {
+		bc.isRunning = true
+
+		ticker := time.NewTicker(bc.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-bc.commands: // STOP command received
+				bc.isRunning = false
+
+				return
+			case now := <-ticker.C:
+				bc.runCheck(now)
+			}
+		}
+	}
+
+	return bc
+}
+
+// checkVolume reads the first block of the device.
+func (bc *blockChecker) checkVolume(time.Time) error {
+	return bc.readBlock()
+}
+
+// readBlock reads the first block of the device with O_DIRECT, so that the
+// data is read from the Ceph cluster and not from the page-cache. A stale
+// krbd or rbd-nbd device fails the read, or blocks it. A blocked read is
+// detected by isHealthy(), as the lastUpdate is not refreshed anymore.
+//
+// Writing to the device is not possible, as there is no area on the device
+// that is not used by the application.
+func (bc *blockChecker) readBlock() error {
+	fd, err := unix.Open(bc.device, unix.O_RDONLY|unix.O_DIRECT|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open block-device %q: %w", bc.device, err)
+	}
+	defer unix.Close(fd) //nolint:errcheck // read-only, nothing to flush
+
+	// O_DIRECT requires a buffer aligned to the logical block size, memory
+	// that is mapped is aligned to the page size
+	buf, err := unix.Mmap(-1, 0, blockSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return fmt.Errorf("failed to allocate buffer for reading %q: %w", bc.device, err)
+	}
+	defer unix.Munmap(buf) //nolint:errcheck // nothing to recover
+
+	_, err = unix.Pread(fd, buf, 0)
+	if err != nil {
+		return &os.PathError{Op: "read", Path: bc.device, Err: err}
+	}
+
+	return nil
+}
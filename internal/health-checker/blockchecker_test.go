@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestBlockCheckerReadBlock(t *testing.T) {
+	t.Parallel()
+
+	// a regular file is used instead of a block-device
+	device := filepath.Join(t.TempDir(), "device")
+	err := os.WriteFile(device, make([]byte, 2*blockSize), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create %q: %v", device, err)
+	}
+
+	bc, ok := newBlockChecker(device).(*blockChecker)
+	if !ok {
+		t.Fatal("failed to convert to *blockChecker")
+	}
+
+	err = bc.readBlock()
+	if errors.Is(err, unix.EINVAL) {
+		t.Skipf("O_DIRECT is not supported on the filesystem of %q", device)
+	}
+	if err != nil {
+		t.Errorf("failed to read block: %v", err)
+	}
+
+	bc.device = filepath.Join(t.TempDir(), "missing")
+	if err = bc.readBlock(); err == nil {
+		t.Error("reading a missing device should fail")
+	}
+
+	if st := bc.status(); st.fsType != "block" {
+		t.Errorf("unexpected fstype %q", st.fsType)
+	}
+}
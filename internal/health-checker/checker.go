@@ -17,9 +17,13 @@ limitations under the License.
 package healthchecker
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"syscall"
 	"time"
+
+	mount "k8s.io/mount-utils"
 )
 
 // command is what is sent through the channel to terminate the go routine.
@@ -30,7 +34,15 @@ const (
 	stopCommand = command("STOP")
 )
 
+// volumeChecker runs a single health check of a volume. The final checker
+// structs implement it, and pass themselves to initDefaults().
+type volumeChecker interface {
+	checkVolume(now time.Time) error
+}
+
 type checker struct {
+	volumeChecker
+
 	// interval contains the time to sleep between health checks.
 	interval time.Duration
 
@@ -47,16 +59,32 @@ type checker struct {
 	err        error
 	lastUpdate time.Time
 
+	// fsType is the type of the filesystem that is checked
+	fsType string
+
+	// checkStarted is set while a health check is running
+	checkStarted time.Time
+	// lastCheckDuration is the time it took to run the last health check
+	lastCheckDuration time.Duration
+	// consecutiveFailures is the number of health checks that failed since
+	// the last successful one
+	consecutiveFailures uint64
+
 	// commands is the channel to read commands from; when to stop.
 	commands chan command
 
+	// checkMutex serializes the periodic and the on-demand health checks
+	checkMutex *sync.Mutex
+
 	runChecker func()
 }
 
-func (c *checker) initDefaults() {
+func (c *checker) initDefaults(vc volumeChecker) {
+	c.volumeChecker = vc
 	c.interval = 60 * time.Second
 	c.timeout = 15 * time.Second
 	c.mutex = &sync.RWMutex{}
+	c.checkMutex = &sync.Mutex{}
 	c.isRunning = false
 	c.err = nil
 	c.healthy = true
@@ -105,3 +133,118 @@ func (c *checker) isHealthy() (bool, error) {
 
 	return c.healthy, c.err
 }
+
+// runCheck runs a health check and records its result.
+func (c *checker) runCheck(now time.Time) {
+	c.checkMutex.Lock()
+	defer c.checkMutex.Unlock()
+
+	c.beginCheck()
+	c.finishCheck(c.checkVolume(now), now)
+}
+
+// checkNow runs a health check right away, instead of returning the result
+// of the last periodic check. When the check does not finish within the
+// timeout, the volume is reported as unhealthy and the check continues in
+// the background. No new check is started while a check is blocked for
+// longer than the timeout already.
+func (c *checker) checkNow() (bool, error) {
+	c.mutex.RLock()
+	started := c.checkStarted
+	c.mutex.RUnlock()
+	if !started.IsZero() && time.Since(started) > c.timeout {
+		return false, fmt.Errorf("health-check has been running for %f seconds", time.Since(started).Seconds())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.runCheck(time.Now())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(c.timeout):
+		return false, fmt.Errorf("health-check did not respond within %f seconds", c.timeout.Seconds())
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.healthy, c.err
+}
+
+// beginCheck records the start of a health check.
+func (c *checker) beginCheck() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.checkStarted = time.Now()
+}
+
+// finishCheck records the result of the health check that was started with
+// beginCheck(). The lastUpdate is set to ts when the check succeeded.
+func (c *checker) finishCheck(err error, ts time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastCheckDuration = time.Since(c.checkStarted)
+	c.checkStarted = time.Time{}
+
+	if err != nil {
+		c.healthy = false
+		c.err = err
+		c.consecutiveFailures++
+
+		return
+	}
+
+	c.healthy = true
+	c.err = nil
+	c.lastUpdate = ts
+	c.consecutiveFailures = 0
+}
+
+// checkerStatus contains the details of a checker that are exported as
+// metrics.
+type checkerStatus struct {
+	fsType              string
+	healthy             bool
+	lastCheckDuration   time.Duration
+	consecutiveFailures uint64
+}
+
+func (c *checker) status() checkerStatus {
+	healthy, _ := c.isHealthy()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	// a health check that hangs (like on a stuck mount) does not finish,
+	// report the time it is running already in that case
+	duration := c.lastCheckDuration
+	if !c.checkStarted.IsZero() {
+		if running := time.Since(c.checkStarted); running > duration {
+			duration = running
+		}
+	}
+
+	return checkerStatus{
+		fsType:              c.fsType,
+		healthy:             healthy,
+		lastCheckDuration:   duration,
+		consecutiveFailures: c.consecutiveFailures,
+	}
+}
+
+// IsStaleMountError returns true when the error that a checker reported
+// indicates that the mount is not usable anymore, for example because the
+// client was evicted and blocklisted (the kernel returns ESHUTDOWN). Such a
+// mount needs to be unmounted and mounted again to recover.
+func IsStaleMountError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	return mount.IsCorruptedMnt(err) || errors.Is(err, syscall.ESHUTDOWN)
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+	"testing"
+)
+
+func TestIsStaleMountError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"no error", nil, false},
+		{"not found", &fs.PathError{Op: "stat", Path: "/mnt", Err: syscall.ENOENT}, false},
+		{"blocklisted", &fs.PathError{Op: "stat", Path: "/mnt", Err: syscall.ESHUTDOWN}, true},
+		{"io error", &fs.PathError{Op: "stat", Path: "/mnt", Err: syscall.EIO}, true},
+		{"stale handle", &fs.PathError{Op: "stat", Path: "/mnt", Err: syscall.ESTALE}, true},
+		{"timeout", errors.New("health-check has not responded for 90 seconds"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsStaleMountError(tt.err); got != tt.want {
+				t.Errorf("IsStaleMountError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"time"
 )
 
+var _ volumeChecker = &fileChecker{}
+
 type fileChecker struct {
 	checker
 
@@ -34,7 +36,8 @@ func newFileChecker(dir string) ConditionChecker {
 	fc := &fileChecker{
 		filename: path.Join(dir, "csi-volume-condition.ts"),
 	}
-	fc.initDefaults()
+	fc.initDefaults(fc)
+	fc.fsType = getFsType(dir)
 
 	fc.checker.runChecker = func() {
 		fc.isRunning = true
@@ -49,42 +52,7 @@ func newFileChecker(dir string) ConditionChecker {
 
 				return
 			case now := <-ticker.C:
-				err := fc.writeTimestamp(now)
-				if err != nil {
-					fc.mutex.Lock()
-					fc.healthy = false
-					fc.err = err
-					fc.mutex.Unlock()
-
-					continue
-				}
-
-				ts, err := fc.readTimestamp()
-				if err != nil {
-					fc.mutex.Lock()
-					fc.healthy = false
-					fc.err = err
-					fc.mutex.Unlock()
-
-					continue
-				}
-
-				// verify that the written timestamp is read back
-				if now.Compare(ts) != 0 {
-					fc.mutex.Lock()
-					fc.healthy = false
-					fc.err = errors.New("timestamp read from file does not match what was written")
-					fc.mutex.Unlock()
-
-					continue
-				}
-
-				// run health check, write a timestamp to a file, read it back
-				fc.mutex.Lock()
-				fc.healthy = true
-				fc.err = nil
-				fc.lastUpdate = ts
-				fc.mutex.Unlock()
+				fc.runCheck(now)
 			}
 		}
 	}
@@ -92,6 +60,27 @@ func newFileChecker(dir string) ConditionChecker {
 	return fc
 }
 
+// checkVolume writes the timestamp to the file, and verifies that it is read
+// back.
+func (fc *fileChecker) checkVolume(now time.Time) error {
+	err := fc.writeTimestamp(now)
+	if err != nil {
+		return err
+	}
+
+	ts, err := fc.readTimestamp()
+	if err != nil {
+		return err
+	}
+
+	// verify that the written timestamp is read back
+	if now.Compare(ts) != 0 {
+		return errors.New("timestamp read from file does not match what was written")
+	}
+
+	return nil
+}
+
 // readTimestamp reads the JSON formatted timestamp from the file.
 func (fc *fileChecker) readTimestamp() (time.Time, error) {
 	var ts time.Time
@@ -21,6 +21,8 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // CheckerType describes the type of health-check that needs to be done.
@@ -32,6 +34,9 @@ const (
 	// FileCheckerType writes and reads a timestamp to a file for checking the
 	// volume health.
 	FileCheckerType
+	// BlockCheckerType reads the first block of a block-device with O_DIRECT
+	// for checking the volume health.
+	BlockCheckerType
 )
 
 // Manager provides the API for getting the health status of a volume. The main
@@ -44,7 +49,12 @@ const (
 // Once the volumeID is not active anymore (when NodeUnstageVolume is called),
 // the ConditionChecker needs to be stopped, which can be done by
 // Manager.StopChecker().
+//
+// The Manager is a prometheus.Collector as well, it exports the health of the
+// volumes with running checkers as metrics.
 type Manager interface {
+	prometheus.Collector
+
 	// StartChecker starts a health-checker of the requested type for the
 	// volumeID using the path. The path usually is the publishTargetPath, and
 	// a unique path for this checker. If the path can be used by multiple
@@ -59,12 +69,21 @@ type Manager interface {
 	StopChecker(volumeID, path string)
 	StopSharedChecker(volumeID string)
 
+	// StopAll stops all checkers, without waiting for a checker that is
+	// blocked on an unhealthy volume.
+	StopAll()
+
 	// IsHealthy locates the checker for the volumeID and path. If no checker
 	// is found, `true` is returned together with an error message.
 	// When IsHealthy runs into an internal error, it is assumed that the
 	// volume is healthy. Only when it is confirmed that the volume is
 	// unhealthy, `false` is returned together with an error message.
 	IsHealthy(volumeID, path string) (bool, error)
+
+	// CheckVolume locates the checker for the volumeID and path, like
+	// IsHealthy, and runs a health check right away instead of returning the
+	// result of the last periodic check.
+	CheckVolume(volumeID, path string) (bool, error)
 }
 
 // ConditionChecker describes the interface that a health status reporter needs
@@ -79,6 +98,14 @@ type ConditionChecker interface {
 
 	// isHealthy returns the status of the volume, without blocking.
 	isHealthy() (bool, error)
+
+	// status returns the details of the checker for the metrics, without
+	// blocking.
+	status() checkerStatus
+
+	// checkNow runs a health check and returns its result, it blocks at most
+	// for the timeout of the checker.
+	checkNow() (bool, error)
 }
 
 type healthCheckManager struct {
@@ -107,6 +134,8 @@ func (hcm *healthCheckManager) createChecker(volumeID, path string, ct CheckerTy
 		return hcm.startFileChecker(volumeID, path, shared)
 	case StatCheckerType:
 		return hcm.startStatChecker(volumeID, path, shared)
+	case BlockCheckerType:
+		return hcm.startBlockChecker(volumeID, path, shared)
 	}
 
 	return nil
@@ -132,12 +161,19 @@ func (hcm *healthCheckManager) startStatChecker(volumeID, path string, shared bo
 	return hcm.startChecker(cc, volumeID, path, shared)
 }
 
+// startBlockChecker initializes the blockChecker and starts it.
+func (hcm *healthCheckManager) startBlockChecker(volumeID, device string, shared bool) error {
+	cc := newBlockChecker(device)
+
+	return hcm.startChecker(cc, volumeID, device, shared)
+}
+
 // startChecker adds the checker to its map and starts it.
 // Shared checkers are key'd by their volumeID, whereas non-shared checkers
-// are key'd by theit volumeID+path.
+// are key'd by their volumeID+path.
 func (hcm *healthCheckManager) startChecker(cc ConditionChecker, volumeID, path string, shared bool) error {
 	key := volumeID
-	if shared {
+	if !shared {
 		key = fallbackKey(volumeID, path)
 	}
 
@@ -177,24 +213,57 @@ func (hcm *healthCheckManager) StopChecker(volumeID, path string) {
 	cc.stop()
 }
 
+func (hcm *healthCheckManager) StopAll() {
+	hcm.checkers.Range(func(key, value any) bool {
+		hcm.checkers.Delete(key)
+
+		cc, ok := value.(ConditionChecker)
+		if ok {
+			// stop() blocks until the checker reads the command
+			go cc.stop()
+		}
+
+		return true
+	})
+}
+
 func (hcm *healthCheckManager) IsHealthy(volumeID, path string) (bool, error) {
+	cc, err := hcm.getChecker(volumeID, path)
+	if err != nil {
+		return true, err
+	}
+
+	return cc.isHealthy()
+}
+
+func (hcm *healthCheckManager) CheckVolume(volumeID, path string) (bool, error) {
+	cc, err := hcm.getChecker(volumeID, path)
+	if err != nil {
+		return true, err
+	}
+
+	return cc.checkNow()
+}
+
+// getChecker returns the ConditionChecker for the volumeID and path.
+func (hcm *healthCheckManager) getChecker(volumeID, path string) (ConditionChecker, error) {
 	// load the 'old' ConditionChecker if it exists
 	old, ok := hcm.checkers.Load(volumeID)
 	if !ok {
 		// try fallback which include an optional (unique) path (usually publishTargetPath)
 		old, ok = hcm.checkers.Load(fallbackKey(volumeID, path))
 		if !ok {
-			return true, fmt.Errorf("no ConditionChecker for volume-id: %s", volumeID)
+			return nil, fmt.Errorf("no ConditionChecker for volume-id: %s", volumeID)
 		}
 	}
 
 	// 'old' was loaded, cast it to ConditionChecker
 	cc, ok := old.(ConditionChecker)
 	if !ok {
-		return true, fmt.Errorf("failed to cast cc to ConditionChecker for volume-id %q", volumeID)
+		return nil, fmt.Errorf("failed to cast cc to ConditionChecker for volume-id %q", volumeID)
 	}
 
-	return cc.isHealthy()
+	return cc, nil
 }
 
 // fallbackKey returns the key for a checker in the map. If the path is empty,
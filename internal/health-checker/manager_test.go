@@ -17,6 +17,7 @@ limitations under the License.
 package healthchecker
 
 import (
+	"os"
 	"testing"
 )
 
@@ -83,3 +84,69 @@ func TestSharedChecker(t *testing.T) {
 	t.Log("stop the checker")
 	mgr.StopSharedChecker(volumeID)
 }
+
+func TestStopAll(t *testing.T) {
+	t.Parallel()
+
+	volumeID := "fake-volume-id"
+	volumePath := t.TempDir()
+	mgr := NewHealthCheckManager()
+
+	err := mgr.StartChecker(volumeID, volumePath, StatCheckerType)
+	if err != nil {
+		t.Fatalf("ConditionChecker could not get started: %v", err)
+	}
+	err = mgr.StartSharedChecker(volumeID, volumePath, StatCheckerType)
+	if err != nil {
+		t.Fatalf("ConditionChecker could not get started: %v", err)
+	}
+
+	mgr.StopAll()
+
+	healthy, msg := mgr.IsHealthy(volumeID, volumePath)
+	if !(healthy && msg != nil) {
+		t.Error("ConditionChecker was not stopped, did not get an error")
+	}
+}
+
+func TestCheckVolume(t *testing.T) {
+	t.Parallel()
+
+	volumeID := "fake-volume-id"
+	volumePath := t.TempDir()
+	mgr := NewHealthCheckManager()
+
+	// expected to have an error in msg
+	healthy, msg := mgr.CheckVolume(volumeID, volumePath)
+	if !(healthy && msg != nil) {
+		t.Error("ConditionChecker was not started yet, did not get an error")
+	}
+
+	err := mgr.StartChecker(volumeID, volumePath, StatCheckerType)
+	if err != nil {
+		t.Fatalf("ConditionChecker could not get started: %v", err)
+	}
+	defer mgr.StopChecker(volumeID, volumePath)
+
+	t.Log("check health on demand, should be healthy")
+	healthy, msg = mgr.CheckVolume(volumeID, volumePath)
+	if !healthy || msg != nil {
+		t.Errorf("volume is unhealthy: %s", msg)
+	}
+
+	t.Log("remove the volume, check on demand should report it right away")
+	err = os.Remove(volumePath)
+	if err != nil {
+		t.Fatalf("failed to remove %q: %v", volumePath, err)
+	}
+	healthy, msg = mgr.CheckVolume(volumeID, volumePath)
+	if healthy || msg == nil {
+		t.Error("volume is healthy after it was removed")
+	}
+
+	t.Log("the result of the check on demand is returned by IsHealthy")
+	healthy, _ = mgr.IsHealthy(volumeID, volumePath)
+	if healthy {
+		t.Error("volume is healthy after it was removed")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	metricLabels = []string{"volume_id", "path", "fstype"}
+
+	healthyDesc = prometheus.NewDesc(
+		"csi_volume_healthy",
+		"Health of the volume, 1 when healthy and 0 when not",
+		metricLabels, nil)
+	checkDurationDesc = prometheus.NewDesc(
+		"csi_volume_health_check_duration_seconds",
+		"Duration of the last health check of the volume, or of the running check when it takes longer",
+		metricLabels, nil)
+	consecutiveFailuresDesc = prometheus.NewDesc(
+		"csi_volume_health_check_consecutive_failures",
+		"Number of health checks of the volume that failed since the last successful one",
+		metricLabels, nil)
+)
+
+// filesystem magic numbers as returned by statfs(), see statfs(2)
+var fsTypes = map[int64]string{
+	0x00c36400: "ceph",
+	0x65735546: "fuse",
+	0x0000ef53: "ext4",
+	0x58465342: "xfs",
+	0x00006969: "nfs",
+	0x01021994: "tmpfs",
+}
+
+// getFsType returns the type of the filesystem that contains the path.
+func getFsType(path string) string {
+	var st unix.Statfs_t
+	err := unix.Statfs(path, &st)
+	if err != nil {
+		return "unknown"
+	}
+
+	//nolint:unconvert // the type of Statfs_t.Type depends on the architecture
+	magic := int64(st.Type)
+	if fsType, ok := fsTypes[magic]; ok {
+		return fsType
+	}
+
+	return fmt.Sprintf("0x%x", magic)
+}
+
+// Describe sends the descriptions of the metrics of the checkers to the
+// channel, it implements prometheus.Collector.
+func (hcm *healthCheckManager) Describe(ch chan<- *prometheus.Desc) {
+	ch <- healthyDesc
+	ch <- checkDurationDesc
+	ch <- consecutiveFailuresDesc
+}
+
+// Collect sends the metrics of all running checkers to the channel, it
+// implements prometheus.Collector.
+func (hcm *healthCheckManager) Collect(ch chan<- prometheus.Metric) {
+	hcm.checkers.Range(func(key, value any) bool {
+		cc, ok := value.(ConditionChecker)
+		if !ok {
+			return true
+		}
+
+		// the key is the volumeID, optionally followed by ":<path>", see
+		// fallbackKey()
+		k, _ := key.(string)
+		volumeID, path, _ := strings.Cut(k, ":")
+
+		st := cc.status()
+		healthy := 0.0
+		if st.healthy {
+			healthy = 1.0
+		}
+
+		ch <- prometheus.MustNewConstMetric(healthyDesc, prometheus.GaugeValue,
+			healthy, volumeID, path, st.fsType)
+		ch <- prometheus.MustNewConstMetric(checkDurationDesc, prometheus.GaugeValue,
+			st.lastCheckDuration.Seconds(), volumeID, path, st.fsType)
+		ch <- prometheus.MustNewConstMetric(consecutiveFailuresDesc, prometheus.GaugeValue,
+			float64(st.consecutiveFailures), volumeID, path, st.fsType)
+
+		return true
+	})
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package healthchecker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGetFsType(t *testing.T) {
+	t.Parallel()
+
+	if fsType := getFsType(t.TempDir()); fsType == "" || fsType == "unknown" {
+		t.Errorf("failed to detect the filesystem type: %q", fsType)
+	}
+
+	if fsType := getFsType("/does/not/exist"); fsType != "unknown" {
+		t.Errorf("expected unknown filesystem type, got %q", fsType)
+	}
+}
+
+func TestManagerCollect(t *testing.T) {
+	t.Parallel()
+
+	volumeID := "fake-volume-id"
+	volumePath := t.TempDir()
+	mgr := NewHealthCheckManager()
+
+	if count := testutil.CollectAndCount(mgr); count != 0 {
+		t.Errorf("expected no metrics without checkers, got %d", count)
+	}
+
+	err := mgr.StartChecker(volumeID, volumePath, StatCheckerType)
+	if err != nil {
+		t.Fatalf("ConditionChecker could not get started: %v", err)
+	}
+	defer mgr.StopChecker(volumeID, volumePath)
+
+	if count := testutil.CollectAndCount(mgr); count != 3 {
+		t.Errorf("expected 3 metrics for a single checker, got %d", count)
+	}
+
+	expected := fmt.Sprintf(`
+# HELP csi_volume_healthy Health of the volume, 1 when healthy and 0 when not
+# TYPE csi_volume_healthy gauge
+csi_volume_healthy{fstype=%q,path=%q,volume_id=%q} 1
+`, getFsType(volumePath), volumePath, volumeID)
+	err = testutil.CollectAndCompare(mgr, strings.NewReader(expected), "csi_volume_healthy")
+	if err != nil {
+		t.Errorf("unexpected metrics: %v", err)
+	}
+}
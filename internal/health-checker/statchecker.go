@@ -21,6 +21,8 @@ import (
 	"time"
 )
 
+var _ volumeChecker = &statChecker{}
+
 type statChecker struct {
 	checker
 
@@ -32,7 +34,8 @@ func newStatChecker(dir string) ConditionChecker {
 	sc := &statChecker{
 		dirname: dir,
 	}
-	sc.initDefaults()
+	sc.initDefaults(sc)
+	sc.fsType = getFsType(dir)
 
 	sc.checker.runChecker = func() {
 		sc.isRunning = true
@@ -47,24 +50,17 @@ func newStatChecker(dir string) ConditionChecker {
 
 				return
 			case now := <-ticker.C:
-				_, err := os.Stat(sc.dirname)
-				if err != nil {
-					sc.mutex.Lock()
-					sc.healthy = false
-					sc.err = err
-					sc.mutex.Unlock()
-
-					continue
-				}
-
-				sc.mutex.Lock()
-				sc.healthy = true
-				sc.err = nil
-				sc.lastUpdate = now
-				sc.mutex.Unlock()
+				sc.runCheck(now)
 			}
 		}
 	}
 
 	return sc
 }
+
+// checkVolume verifies that the directory can be stat'd.
+func (sc *statChecker) checkVolume(time.Time) error {
+	_, err := os.Stat(sc.dirname)
+
+	return err
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/lock"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+const (
+	// counterPrefix is the prefix of the omap keys of counters.
+	counterPrefix = "csi.counter."
+	// counterLockName is the name of the lock on the object with the
+	// counters, it serializes the updates of the counters.
+	counterLockName = "csi.counters"
+	// counterLockDuration is the time after which a counter lock expires,
+	// when the instance that holds it does not release it.
+	counterLockDuration = time.Minute
+)
+
+// Counters maps the names of counters to their values.
+type Counters map[string]int64
+
+// GetCounters returns the counters that are stored in the omap of the object
+// in the pool. The returned Counters are nil when the object has no counters
+// yet.
+func (conn *Connection) GetCounters(ctx context.Context, pool, oid string) (Counters, error) {
+	ioctx, err := conn.counterIoctx(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer ioctx.Destroy()
+
+	return readCounters(ioctx, oid)
+}
+
+// UpdateCounters updates the counters in the omap of the object in the pool.
+// The update function gets the current values of the counters, or nil when
+// the object has no counters yet, and returns the new values. When update
+// returns an error, the counters are not changed. Updates are serialized
+// with an exclusive RADOS lock on the object, so that all instances of the
+// driver that share the journal can update the counters.
+func (conn *Connection) UpdateCounters(
+	ctx context.Context,
+	pool, oid string,
+	update func(Counters) (Counters, error),
+) error {
+	ioctx, err := conn.counterIoctx(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	lck := lock.NewLock(ioctx, oid, counterLockName, counterLockName,
+		"lock for the counters in "+oid, counterLockDuration)
+	for {
+		err = lck.LockExclusive(ctx)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, lock.ErrBusy) {
+			return fmt.Errorf("failed to acquire the counter lock of %s: %w", oid, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed waiting for the counter lock of %s: %w", oid, ctx.Err())
+		case <-time.After(reservationLockRetryInterval):
+		}
+	}
+	defer lck.Unlock(ctx)
+
+	counters, err := readCounters(ioctx, oid)
+	if err != nil {
+		return err
+	}
+
+	counters, err = update(counters)
+	if err != nil {
+		return err
+	}
+
+	pairs := make(map[string][]byte, len(counters))
+	for name, value := range counters {
+		pairs[counterPrefix+name] = []byte(strconv.FormatInt(value, 10))
+	}
+	err = ioctx.SetOmap(oid, pairs)
+	if err != nil {
+		return fmt.Errorf("failed to store the counters in %s: %w", oid, err)
+	}
+	log.DebugLog(ctx, "updated counters in %s: %v", oid, counters)
+
+	return nil
+}
+
+// errNoCounters is returned by the update function of AddToCounter when the
+// counters were removed while waiting for the lock.
+var errNoCounters = errors.New("object has no counters")
+
+// AddToCounter adds delta to the counter with the name in the omap of the
+// object in the pool. The counter does not drop below zero. Nothing is done
+// when the object has no counters, so that counters which are initialized
+// on demand are not created with a partial value.
+func (conn *Connection) AddToCounter(ctx context.Context, pool, oid, name string, delta int64) error {
+	counters, err := conn.GetCounters(ctx, pool, oid)
+	if err != nil || counters == nil {
+		return err
+	}
+
+	err = conn.UpdateCounters(ctx, pool, oid, func(counters Counters) (Counters, error) {
+		if counters == nil {
+			return nil, errNoCounters
+		}
+		counters[name] = max(counters[name]+delta, 0)
+
+		return counters, nil
+	})
+	if errors.Is(err, errNoCounters) {
+		return nil
+	}
+
+	return err
+}
+
+// ReservationObject returns the name of the object that holds the attributes
+// of the reservation with the reservedUUID. Counters that belong to a single
+// volume or snapshot can be kept in it, they are removed together with the
+// reservation.
+func (conn *Connection) ReservationObject(reservedUUID string) string {
+	return conn.config.cephUUIDDirectoryPrefix + reservedUUID
+}
+
+// counterIoctx returns an IOContext for the pool and the namespace of the
+// journal.
+func (conn *Connection) counterIoctx(pool string) (*rados.IOContext, error) {
+	ioctx, err := conn.conn.GetIoctx(pool)
+	if err != nil {
+		return nil, omapPoolError(err)
+	}
+
+	if conn.config.namespace != "" {
+		ioctx.SetNamespace(conn.config.namespace)
+	}
+
+	return ioctx, nil
+}
+
+// readCounters reads the counters from the omap of the object.
+func readCounters(ioctx *rados.IOContext, oid string) (Counters, error) {
+	values, err := ioctx.GetAllOmapValues(oid, "", counterPrefix, chunkSize)
+	if err != nil {
+		if errors.Is(err, rados.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read the counters in %s: %w", oid, err)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	counters := make(Counters, len(values))
+	for key, value := range values {
+		n, err := strconv.ParseInt(string(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %q in %s: %w", key, oid, err)
+		}
+		counters[key[len(counterPrefix):]] = n
+	}
+
+	return counters, nil
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/lock"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// reservationLockShards is the number of locks on the csiDirectory that
+	// the request names are hashed over. The number of locks on the object
+	// stays bounded, and requests for different names rarely wait for each
+	// other.
+	reservationLockShards = 128
+
+	// reservationLockDuration is the time after which a reservation lock
+	// expires, when the instance that holds it does not release or renew
+	// it.
+	reservationLockDuration = 5 * time.Minute
+
+	// reservationLockRenewInterval is the time between renewals of a held
+	// reservation lock. A single delayed or failed renewal does not let the
+	// lock expire.
+	reservationLockRenewInterval = reservationLockDuration / 3
+
+	// reservationLockRetryInterval is the time between attempts to acquire
+	// a reservation lock that is held by another instance.
+	reservationLockRetryInterval = 100 * time.Millisecond
+)
+
+// reservationLockName returns the name of the lock for the request name.
+func reservationLockName(reqName string) string {
+	return fmt.Sprintf("csi.reservation.%d", crc32.ChecksumIEEE([]byte(reqName))%reservationLockShards)
+}
+
+// LockReservation connects to the cluster and acquires the reservation lock
+// for the request name in the journal pool. The returned function releases
+// the lock and the connection.
+func (cj *Config) LockReservation(
+	ctx context.Context,
+	monitors, namespace string,
+	cr *util.Credentials,
+	journalPool, reqName string,
+) (func(), error) {
+	conn, err := cj.Connect(monitors, namespace, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := conn.LockReservation(ctx, journalPool, reqName)
+	if err != nil {
+		conn.Destroy()
+
+		return nil, err
+	}
+
+	return func() {
+		release()
+		conn.Destroy()
+	}, nil
+}
+
+// LockReservation acquires an exclusive RADOS lock for the request name on
+// the csiDirectory of the journal pool, so that the instances of the driver
+// that share the journal do not reserve the same request name concurrently.
+// It waits until the lock is released by the other instance, or the context
+// is done. The lock is renewed until it is released, so that it does not
+// expire while a long running request holds it. The returned function
+// releases the lock, it needs to be called before the Connection is
+// destroyed.
+func (conn *Connection) LockReservation(ctx context.Context, journalPool, reqName string) (func(), error) {
+	cj := conn.config
+
+	ioctx, err := conn.conn.GetIoctx(journalPool)
+	if err != nil {
+		return nil, err
+	}
+	if cj.namespace != "" {
+		ioctx.SetNamespace(cj.namespace)
+	}
+
+	lockName := reservationLockName(reqName)
+	lck := lock.NewLock(ioctx, cj.csiDirectory, lockName, reqName,
+		"reservation lock for "+reqName, reservationLockDuration)
+	for {
+		err = lck.LockExclusive(ctx)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, lock.ErrBusy) {
+			ioctx.Destroy()
+
+			return nil, fmt.Errorf("failed to acquire reservation lock %s for %s: %w", lockName, reqName, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			ioctx.Destroy()
+
+			return nil, fmt.Errorf("failed waiting for reservation lock %s for %s: %w", lockName, reqName, ctx.Err())
+		case <-time.After(reservationLockRetryInterval):
+		}
+	}
+	log.DebugLog(ctx, "acquired reservation lock %s for %s", lockName, reqName)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		renewReservationLock(ctx, lck, reservationLockRenewInterval, stop)
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+		lck.Unlock(ctx)
+		ioctx.Destroy()
+	}, nil
+}
+
+// renewReservationLock renews the lock every interval until stop is closed.
+// A failed renewal is logged and retried at the next interval, the lock only
+// expires when renewals fail for the whole duration of the lock.
+func renewReservationLock(ctx context.Context, lck lock.IOCtxLock, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := lck.Renew(ctx); err != nil {
+				log.ErrorLog(ctx, "failed to renew reservation lock: %v", err)
+			}
+		}
+	}
+}
@@ -26,8 +26,11 @@ import (
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
+	"github.com/ceph/go-ceph/rados"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Length of string representation of uuid, xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx is 36 bytes.
@@ -143,6 +146,10 @@ type Config struct {
 	// object map is maintained, during topology based provisioning
 	csiJournalPool string
 
+	// pool ID where the image is stored, in case it was moved to a different pool than the one
+	// holding the per Ceph volume object map (for example by a live-migration of the image)
+	csiImagePoolKey string
+
 	// source volume name key in per Ceph snapshot object map, containing Ceph source volume uuid
 	// for which the snapshot was created
 	cephSnapSourceKey string
@@ -175,6 +182,7 @@ func NewCSIVolumeJournal(suffix string) *Config {
 		csiNameKey:              "csi.volname",
 		csiImageKey:             "csi.imagename",
 		csiJournalPool:          "csi.journalpool",
+		csiImagePoolKey:         "csi.imagepool",
 		cephSnapSourceKey:       "",
 		namespace:               "",
 		csiImageIDKey:           "csi.imageid",
@@ -238,6 +246,36 @@ func (cj *Config) GetNameForUUID(prefix, uid string, isSnapshot bool) string {
 	return prefix + uid
 }
 
+// GetSnapshotNamePrefix returns the prefix of the names of snapshots that
+// contain a label, the default prefix is used when prefix is empty. The UUID
+// stays at the end of the name, so that GetUUIDFromName() keeps working.
+func GetSnapshotNamePrefix(prefix, label string) string {
+	if label == "" {
+		return prefix
+	}
+	if prefix == "" {
+		prefix = defaultSnapshotNamingPrefix
+	}
+
+	return prefix + label + "-"
+}
+
+// GetUUIDFromName returns the UUID at the end of a volume or snapshot name
+// that was returned by GetNameForUUID. false is returned when the name does
+// not end with a UUID.
+func GetUUIDFromName(name string) (string, bool) {
+	if len(name) < uuidEncodedLength {
+		return "", false
+	}
+
+	uid := name[len(name)-uuidEncodedLength:]
+	if _, err := uuid.Parse(uid); err != nil {
+		return "", false
+	}
+
+	return uid, true
+}
+
 // ImageData contains image name and stored CSI properties.
 type ImageData struct {
 	ImageUUID       string
@@ -292,7 +330,10 @@ Return values:
 func (conn *Connection) CheckReservation(ctx context.Context,
 	journalPool, reqName, namePrefix, snapParentName, kmsConfig string,
 	encryptionType util.EncryptionType,
-) (*ImageData, error) {
+) (_ *ImageData, err error) {
+	ctx, span := tracing.StartSpan(ctx, "journal.CheckReservation", attribute.String("reqName", reqName))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	var (
 		snapSource       bool
 		objUUID          string
@@ -443,7 +484,10 @@ Input arguments:
 */
 func (conn *Connection) UndoReservation(ctx context.Context,
 	csiJournalPool, volJournalPool, volName, reqName string,
-) error {
+) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "journal.UndoReservation", attribute.String("reqName", reqName))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// delete volume UUID omap (first, inverse of create order)
 
 	cj := conn.config
@@ -474,7 +518,7 @@ func (conn *Connection) UndoReservation(ctx context.Context,
 	}
 
 	// delete the request name key (last, inverse of create order)
-	err := removeMapKeys(ctx, conn, csiJournalPool, cj.namespace, cj.csiDirectory,
+	err = removeMapKeys(ctx, conn, csiJournalPool, cj.namespace, cj.csiDirectory,
 		[]string{cj.csiNameKeyPrefix + reqName})
 	if err != nil {
 		log.ErrorLog(ctx, "failed removing oMap key %s (%s)", cj.csiNameKeyPrefix+reqName, err)
@@ -568,13 +612,15 @@ func (conn *Connection) ReserveName(ctx context.Context,
 	reqName, namePrefix, parentName, kmsConf, volUUID, owner,
 	backingSnapshotID string,
 	encryptionType util.EncryptionType,
-) (string, string, error) {
+) (_ string, _ string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "journal.ReserveName", attribute.String("reqName", reqName))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// TODO: Take in-arg as ImageAttributes?
 	var (
 		snapSource bool
 		nameKeyVal string
 		cj         = conn.config
-		err        error
 	)
 
 	if parentName != "" {
@@ -694,6 +740,7 @@ type ImageAttributes struct {
 	ImageID           string              // Contains the image id
 	GroupID           string              // Contains the group id of the image
 	JournalPoolID     int64               // Pool ID of the CSI journal pool, stored in big endian format (on-disk data)
+	ImagePoolID       int64               // Pool ID of the image, if it was moved by a live-migration
 	BackingSnapshotID string              // ID of the snapshot on which the CephFS snapshot-backed volume is based
 }
 
@@ -702,9 +749,11 @@ func (conn *Connection) GetImageAttributes(
 	ctx context.Context,
 	pool, objectUUID string,
 	snapSource bool,
-) (*ImageAttributes, error) {
+) (_ *ImageAttributes, err error) {
+	ctx, span := tracing.StartSpan(ctx, "journal.GetImageAttributes", attribute.String("uuid", objectUUID))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	var (
-		err             error
 		imageAttributes = &ImageAttributes{}
 		cj              = conn.config
 	)
@@ -721,6 +770,7 @@ func (conn *Connection) GetImageAttributes(
 		cj.encryptKMSKey,
 		cj.encryptionType,
 		cj.csiJournalPool,
+		cj.csiImagePoolKey,
 		cj.cephSnapSourceKey,
 		cj.csiImageIDKey,
 		cj.ownerKey,
@@ -770,6 +820,18 @@ func (conn *Connection) GetImageAttributes(
 		imageAttributes.JournalPoolID = int64(binary.BigEndian.Uint64(buf64))
 	}
 
+	imagePoolIDStr, found := values[cj.csiImagePoolKey]
+	if !found || cj.csiImagePoolKey == "" {
+		imageAttributes.ImagePoolID = util.InvalidPoolID
+	} else {
+		var buf64 []byte
+		buf64, err = hex.DecodeString(imagePoolIDStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode string: %w", err)
+		}
+		imageAttributes.ImagePoolID = int64(binary.BigEndian.Uint64(buf64))
+	}
+
 	if snapSource {
 		imageAttributes.SourceName, found = values[cj.cephSnapSourceKey]
 		if !found {
@@ -792,6 +854,33 @@ func (conn *Connection) StoreImageID(ctx context.Context, pool, reservedUUID, im
 	return nil
 }
 
+// StoreImageLocation stores the image ID and the ID of the pool where the
+// image is located in the UUID directory. Both keys are updated in a single
+// operation, so that the journal always points to an existing image.
+func (conn *Connection) StoreImageLocation(
+	ctx context.Context,
+	pool, reservedUUID, imageID string,
+	imagePoolID int64,
+) error {
+	cj := conn.config
+	if cj.csiImagePoolKey == "" {
+		return errors.New("invalid request, csiImagePoolKey is nil")
+	}
+
+	buf64 := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf64, uint64(imagePoolID))
+	err := setOMapKeys(ctx, conn, pool, cj.namespace, cj.cephUUIDDirectoryPrefix+reservedUUID,
+		map[string]string{
+			cj.csiImageIDKey:   imageID,
+			cj.csiImagePoolKey: hex.EncodeToString(buf64),
+		})
+	if err != nil {
+		return fmt.Errorf("failed to store image location: %w", err)
+	}
+
+	return nil
+}
+
 // StoreAttribute stores an attribute (key/value) in omap.
 func (conn *Connection) StoreAttribute(ctx context.Context, pool, reservedUUID, attribute, value string) error {
 	key := conn.config.commonPrefix + attribute
@@ -804,6 +893,62 @@ func (conn *Connection) StoreAttribute(ctx context.Context, pool, reservedUUID,
 	return nil
 }
 
+// StoreAttributes stores the attributes (key/value) in omap.
+func (conn *Connection) StoreAttributes(ctx context.Context, pool, reservedUUID string, attrs map[string]string) error {
+	pairs := make(map[string]string, len(attrs))
+	for attribute, value := range attrs {
+		pairs[conn.config.commonPrefix+attribute] = value
+	}
+	err := setOMapKeys(ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID, pairs)
+	if err != nil {
+		return fmt.Errorf("failed to set attributes %v: %w", attrs, err)
+	}
+
+	return nil
+}
+
+// FetchAttributes fetches the attributes (keys) in omap. Attributes that are
+// not set are not part of the returned map.
+func (conn *Connection) FetchAttributes(
+	ctx context.Context,
+	pool, reservedUUID string,
+	attributes []string,
+) (map[string]string, error) {
+	keys := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		keys = append(keys, conn.config.commonPrefix+attribute)
+	}
+	values, err := getOMapValues(
+		ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID,
+		conn.config.commonPrefix, keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get values for keys %v from OMAP: %w", keys, err)
+	}
+
+	attrs := make(map[string]string, len(values))
+	for _, attribute := range attributes {
+		if value, ok := values[conn.config.commonPrefix+attribute]; ok {
+			attrs[attribute] = value
+		}
+	}
+
+	return attrs, nil
+}
+
+// RemoveAttributes removes the attributes (keys) from omap.
+func (conn *Connection) RemoveAttributes(ctx context.Context, pool, reservedUUID string, attributes []string) error {
+	keys := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		keys = append(keys, conn.config.commonPrefix+attribute)
+	}
+	err := removeMapKeys(ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID, keys)
+	if err != nil {
+		return fmt.Errorf("failed to remove attributes %v: %w", attributes, err)
+	}
+
+	return nil
+}
+
 // StoreGroupID stores an groupID in omap.
 func (conn *Connection) StoreGroupID(ctx context.Context, pool, reservedUUID, groupID string) error {
 	err := setOMapKeys(ctx, conn, pool, conn.config.namespace, conn.config.cephUUIDDirectoryPrefix+reservedUUID,
@@ -827,12 +972,139 @@ func (conn *Connection) FetchAttribute(ctx context.Context, pool, reservedUUID,
 
 	value, ok := values[key]
 	if !ok {
-		return "", fmt.Errorf("failed to find key %q in returned map: %v", key, values)
+		return "", fmt.Errorf("%w: failed to find key %q in returned map: %v", util.ErrKeyNotFound, key, values)
 	}
 
 	return value, nil
 }
 
+// ListReservations returns the UUIDs of the volumes that are reserved in the
+// csiDirectory of the journalPool and are located in the pool with
+// imagePoolID, mapped to the value of the attribute in their UUID directory.
+// The value is empty when the attribute is not set.
+func (conn *Connection) ListReservations(
+	ctx context.Context,
+	journalPool string,
+	journalPoolID, imagePoolID int64,
+	attribute string,
+) (map[string]string, error) {
+	reservations, err := conn.listReservations(ctx, journalPool, journalPoolID, attribute,
+		func(poolID int64) bool { return poolID == imagePoolID })
+	if err != nil {
+		return nil, err
+	}
+
+	if reservations[imagePoolID] == nil {
+		return map[string]string{}, nil
+	}
+
+	return reservations[imagePoolID], nil
+}
+
+// ListAllReservations returns the UUIDs of all volumes that are reserved in
+// the csiDirectory of the journalPool, grouped by the ID of the pool they are
+// located in, and mapped to the value of the attribute in their UUID
+// directory. The value is empty when the attribute is not set.
+func (conn *Connection) ListAllReservations(
+	ctx context.Context,
+	journalPool string,
+	journalPoolID int64,
+	attribute string,
+) (map[int64]map[string]string, error) {
+	return conn.listReservations(ctx, journalPool, journalPoolID, attribute,
+		func(int64) bool { return true })
+}
+
+// listReservations returns the reservations in the csiDirectory of the
+// journalPool that are located in a pool for which match returns true.
+func (conn *Connection) listReservations(
+	ctx context.Context,
+	journalPool string,
+	journalPoolID int64,
+	attribute string,
+	match func(poolID int64) bool,
+) (map[int64]map[string]string, error) {
+	cj := conn.config
+
+	values, err := listOMapValues(ctx, conn, journalPool, cj.namespace, cj.csiDirectory, cj.csiNameKeyPrefix)
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) {
+			// no volumes have been reserved yet
+			return map[int64]map[string]string{}, nil
+		}
+
+		return nil, err
+	}
+
+	key := cj.commonPrefix + attribute
+	reservations := map[int64]map[string]string{}
+	for _, objUUIDAndPool := range values {
+		poolID := journalPoolID
+		objUUID := objUUIDAndPool
+		if len(objUUIDAndPool) != uuidEncodedLength {
+			poolIDStr, uuid, found := strings.Cut(objUUIDAndPool, "/")
+			if !found {
+				continue
+			}
+			buf64, decodeErr := hex.DecodeString(poolIDStr)
+			if decodeErr != nil || len(buf64) != 8 {
+				continue
+			}
+			poolID = int64(binary.BigEndian.Uint64(buf64))
+			objUUID = uuid
+		}
+
+		if !match(poolID) {
+			continue
+		}
+
+		attrs, err := getOMapValues(ctx, conn, journalPool, cj.namespace,
+			cj.cephUUIDDirectoryPrefix+objUUID, cj.commonPrefix, []string{key})
+		if err != nil {
+			if errors.Is(err, util.ErrKeyNotFound) {
+				// stale reservation without UUID directory
+				continue
+			}
+
+			return nil, err
+		}
+
+		if reservations[poolID] == nil {
+			reservations[poolID] = map[string]string{}
+		}
+		reservations[poolID][objUUID] = attrs[key]
+	}
+
+	return reservations, nil
+}
+
+// CreateDirectory creates the csiDirectory object in the journalPool when it
+// does not exist yet. Creating it validates that the journal can be written
+// in the pool and namespace of the connection.
+func (conn *Connection) CreateDirectory(ctx context.Context, journalPool string) error {
+	cj := conn.config
+
+	ioctx, err := conn.conn.GetIoctx(journalPool)
+	if err != nil {
+		return omapPoolError(err)
+	}
+	defer ioctx.Destroy()
+
+	if cj.namespace != "" {
+		ioctx.SetNamespace(cj.namespace)
+	}
+
+	err = ioctx.Create(cj.csiDirectory, rados.CreateIdempotent)
+	if err != nil {
+		return fmt.Errorf("failed to create %q (pool=%q, namespace=%q): %w",
+			cj.csiDirectory, journalPool, cj.namespace, err)
+	}
+	log.DebugLog(ctx, "created journal directory %q (pool=%q, namespace=%q)",
+		cj.csiDirectory, journalPool, cj.namespace)
+
+	return nil
+}
+
 // Destroy frees any resources and invalidates the journal connection.
 func (conn *Connection) Destroy() {
 	// invalidate cluster connection metadata
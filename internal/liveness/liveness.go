@@ -18,11 +18,13 @@ package liveness
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
 
+	"github.com/container-storage-interface/spec/lib/go/csi"
 	connlib "github.com/kubernetes-csi/csi-lib-utils/connection"
 	"github.com/kubernetes-csi/csi-lib-utils/metrics"
 	"github.com/kubernetes-csi/csi-lib-utils/rpc"
@@ -36,6 +38,50 @@ var liveness = prometheus.NewGauge(prometheus.GaugeOpts{
 	Help:      "Liveness Probe",
 })
 
+var (
+	configInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "csi",
+		Name:      "config_info",
+		Help:      "Revision of the CSI configuration that is loaded by the driver",
+	}, []string{"revision"})
+
+	configRejectedEntries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "csi",
+		Name:      "config_rejected_entries",
+		Help:      "Number of entries of the CSI configuration that were rejected by the driver",
+	})
+)
+
+// getConfigRevision records the revision of the CSI configuration that is
+// loaded by the driver, from the manifest of GetPluginInfo.
+func getConfigRevision(timeout time.Duration, csiConn *grpc.ClientConn) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	info, err := csi.NewIdentityClient(csiConn).GetPluginInfo(ctx, &csi.GetPluginInfoRequest{})
+	if err != nil {
+		log.ErrorLogMsg("failed to get plugin info: %v", err)
+
+		return
+	}
+
+	configInfo.Reset()
+	revision, ok := info.GetManifest()[util.CSIConfigRevisionKey]
+	if !ok {
+		// the driver did not load the configuration
+		return
+	}
+	configInfo.WithLabelValues(revision).Set(1)
+
+	rejected, err := strconv.Atoi(info.GetManifest()[util.CSIConfigRejectedEntriesKey])
+	if err != nil {
+		log.ErrorLogMsg("failed to parse the number of rejected entries: %v", err)
+
+		return
+	}
+	configRejectedEntries.Set(float64(rejected))
+}
+
 func getLiveness(timeout time.Duration, csiConn *grpc.ClientConn) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -62,9 +108,11 @@ func getLiveness(timeout time.Duration, csiConn *grpc.ClientConn) {
 func recordLiveness(endpoint, drivername string, pollTime, timeout time.Duration) {
 	liveMetricsManager := metrics.NewCSIMetricsManager(drivername)
 	// register prometheus metrics
-	err := prometheus.Register(liveness)
-	if err != nil {
-		log.FatalLogMsg(err.Error())
+	for _, collector := range []prometheus.Collector{liveness, configInfo, configRejectedEntries} {
+		err := prometheus.Register(collector)
+		if err != nil {
+			log.FatalLogMsg(err.Error())
+		}
 	}
 
 	csiConn, err := connlib.Connect(context.Background(), endpoint, liveMetricsManager)
@@ -79,6 +127,7 @@ func recordLiveness(endpoint, drivername string, pollTime, timeout time.Duration
 	defer ticker.Stop()
 	for range ticker.C {
 		getLiveness(timeout, csiConn)
+		getConfigRevision(timeout, csiConn)
 	}
 }
 
@@ -19,6 +19,7 @@ package controller
 import (
 	"context"
 	"errors"
+	"slices"
 
 	"github.com/ceph/ceph-csi/internal/cephfs"
 	"github.com/ceph/ceph-csi/internal/cephfs/store"
@@ -27,6 +28,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/journal"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/parameters"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
@@ -79,6 +81,17 @@ func (cs *Server) CreateVolume(
 ) (*csi.CreateVolumeResponse, error) {
 	// nfs does not supports shallow snapshots
 	req.Parameters["backingSnapshot"] = "false"
+
+	err := parameters.Validate(ctx, parameters.NFS, parameters.StorageClass, req.GetParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// validate the export options before the backend volume is created
+	if _, err = parseExportOptions(req.GetParameters()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	res, err := cs.backendServer.CreateVolume(ctx, req)
 	if err != nil {
 		return nil, err
@@ -109,7 +122,9 @@ func (cs *Server) CreateVolume(
 	defer nfsVolume.Destroy()
 
 	err = nfsVolume.CreateExport(backend)
-	if err != nil {
+	if errors.Is(err, ErrUnsupportedProtocol) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	} else if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "failed to create export: %v", err)
 	}
 
@@ -119,6 +134,13 @@ func (cs *Server) CreateVolume(
 	// allow mounting
 	backend.VolumeContext["share"] = nfsVolume.GetExportPath()
 
+	// without a "server" parameter, the NodeServer selects one of the
+	// servers of the NFS-cluster
+	err = nfsVolume.SetServers(backend.VolumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get NFS servers: %v", err)
+	}
+
 	return &csi.CreateVolumeResponse{Volume: backend}, nil
 }
 
@@ -158,6 +180,57 @@ func (cs *Server) DeleteVolume(
 	return cs.backendServer.DeleteVolume(ctx, req)
 }
 
+// ControllerModifyVolume modifies the options of the NFS-export with the
+// mutable parameters. Only the export options (secTypes, clients, squash,
+// transports and nfsVersions) can be modified.
+func (cs *Server) ControllerModifyVolume(
+	ctx context.Context,
+	req *csi.ControllerModifyVolumeRequest,
+) (*csi.ControllerModifyVolumeResponse, error) {
+	params := req.GetMutableParameters()
+	for key := range params {
+		if !slices.Contains(exportOptionParams, key) {
+			return nil, status.Errorf(codes.InvalidArgument, "parameter %q can not be modified, supported are %v",
+				key, exportOptionParams)
+		}
+	}
+
+	cr, err := util.NewAdminCredentials(req.GetSecrets())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to retrieve admin credentials: %v", err)
+
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	nfsVolume, err := NewNFSVolume(ctx, req.GetVolumeId())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = nfsVolume.Connect(cr)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to connect: %v", err)
+	}
+	defer nfsVolume.Destroy()
+
+	err = nfsVolume.ModifyExport(params)
+	switch {
+	case errors.Is(err, ErrInvalidExportOptions):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrUnsupportedProtocol):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "failed to modify export: %v", err)
+	}
+
+	log.DebugLog(ctx, "NFS-export %q has been modified", nfsVolume)
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
 // ControllerExpandVolume calls the backend (CephFS) procedure to expand the
 // volume. There is no interaction with the NFS-server needed to publish the
 // new size.
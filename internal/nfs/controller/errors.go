@@ -40,4 +40,12 @@ var (
 	// ErrFilesystemNotFound is returned in case the filesystem
 	// does not exist.
 	ErrFilesystemNotFound = fmt.Errorf("filesystem %w", ErrNotFound)
+
+	// ErrInvalidExportOptions is returned when the options for the
+	// NFS-export in the parameters are not valid.
+	ErrInvalidExportOptions = errors.New("invalid export options")
+
+	// ErrUnsupportedProtocol is returned when an NFS protocol version is
+	// requested that is not enabled in the NFS-cluster.
+	ErrUnsupportedProtocol = errors.New("unsupported NFS protocol")
 )
@@ -0,0 +1,240 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ceph/go-ceph/common/admin/nfs"
+)
+
+const (
+	// secTypesParam is the comma separated list of security flavors of the
+	// NFS-export.
+	secTypesParam = "secTypes"
+	// clientsParam is the comma separated list of hostnames, networks or IP
+	// addresses that can access the NFS-export.
+	clientsParam = "clients"
+	// squashParam is the squash mode of the NFS-export.
+	squashParam = "squash"
+	// transportsParam is the comma separated list of transport protocols
+	// of the NFS-export.
+	transportsParam = "transports"
+	// nfsVersionsParam is the comma separated list of NFS protocol versions
+	// of the NFS-export.
+	nfsVersionsParam = "nfsVersions"
+
+	nfsV3 = 3
+	nfsV4 = 4
+)
+
+var (
+	// exportOptionParams are the parameters that configure the NFS-export,
+	// these can be modified with ControllerModifyVolume.
+	exportOptionParams = []string{secTypesParam, clientsParam, squashParam, transportsParam, nfsVersionsParam}
+
+	secTypes = []nfs.SecType{nfs.SysSec, nfs.NoneSec, nfs.Krb5Sec, nfs.Krb5iSec, nfs.Krb5pSec}
+
+	// squashModes maps the value of the squash parameter to the SquashMode.
+	squashModes = map[string]nfs.SquashMode{
+		"none":   nfs.NoneSquash,
+		"root":   nfs.RootSquash,
+		"all":    nfs.AllSquash,
+		"rootid": nfs.RootIDSquash,
+	}
+
+	transports = []string{"TCP", "UDP"}
+
+	// hostnameRegex matches hostnames, optionally with wildcards like
+	// `*.example.com`.
+	hostnameRegex = regexp.MustCompile(
+		`^[a-zA-Z0-9*]([a-zA-Z0-9*-]*[a-zA-Z0-9*])?(\.[a-zA-Z0-9*]([a-zA-Z0-9*-]*[a-zA-Z0-9*])?)*$`)
+)
+
+// exportOptions contains the configurable options of an NFS-export.
+type exportOptions struct {
+	secTypes   []nfs.SecType
+	clients    []string
+	squash     nfs.SquashMode
+	transports []string
+	protocols  []int
+}
+
+// splitList splits a comma separated list, and drops empty entries.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// validateClient checks that the client is an IP address, a network in CIDR
+// notation, or a hostname.
+func validateClient(client string) error {
+	if net.ParseIP(client) != nil {
+		return nil
+	}
+
+	if strings.Contains(client, "/") {
+		if _, _, err := net.ParseCIDR(client); err != nil {
+			return fmt.Errorf("invalid network %q in %s: %w", client, clientsParam, err)
+		}
+
+		return nil
+	}
+
+	if !hostnameRegex.MatchString(client) {
+		return fmt.Errorf("invalid client %q in %s", client, clientsParam)
+	}
+
+	return nil
+}
+
+// parseExportOptions parses and validates the options of the NFS-export from
+// the parameters. Unset options are empty.
+func parseExportOptions(params map[string]string) (*exportOptions, error) {
+	opts := &exportOptions{}
+
+	for _, secType := range splitList(params[secTypesParam]) {
+		st := nfs.SecType(strings.ToLower(secType))
+		if !slices.Contains(secTypes, st) {
+			return nil, fmt.Errorf("invalid security flavor %q in %s, supported are %v", secType, secTypesParam, secTypes)
+		}
+		opts.secTypes = append(opts.secTypes, st)
+	}
+
+	for _, client := range splitList(params[clientsParam]) {
+		if err := validateClient(client); err != nil {
+			return nil, err
+		}
+		opts.clients = append(opts.clients, client)
+	}
+
+	if squash := params[squashParam]; squash != "" {
+		mode, ok := squashModes[strings.ToLower(squash)]
+		if !ok {
+			return nil, fmt.Errorf("invalid %s mode %q, supported are none, root, all and rootid", squashParam, squash)
+		}
+		opts.squash = mode
+	}
+
+	for _, transport := range splitList(params[transportsParam]) {
+		t := strings.ToUpper(transport)
+		if !slices.Contains(transports, t) {
+			return nil, fmt.Errorf("invalid transport %q in %s, supported are %v", transport, transportsParam, transports)
+		}
+		opts.transports = append(opts.transports, t)
+	}
+
+	for _, version := range splitList(params[nfsVersionsParam]) {
+		switch version {
+		case "3":
+			opts.protocols = append(opts.protocols, nfsV3)
+		case "4":
+			opts.protocols = append(opts.protocols, nfsV4)
+		default:
+			return nil, fmt.Errorf("invalid NFS version %q in %s, supported are 3 and 4", version, nfsVersionsParam)
+		}
+	}
+
+	return opts, nil
+}
+
+// apply sets the options on the export. Options that are not set keep the
+// value of the export.
+func (opts *exportOptions) apply(export *nfs.ExportInfo) {
+	if len(opts.secTypes) != 0 {
+		export.SecType = opts.secTypes
+	}
+
+	if opts.squash != nfs.Unspecifiedquash {
+		export.Squash = opts.squash
+		for i := range export.Clients {
+			export.Clients[i].Squash = opts.squash
+		}
+	}
+
+	if len(opts.clients) != 0 {
+		// like `ceph nfs export create` with client_addr, only the clients
+		// can access the export
+		export.AccessType = "none"
+		export.Clients = []nfs.ClientInfo{{
+			Addresses:  opts.clients,
+			AccessType: "rw",
+			Squash:     export.Squash,
+		}}
+	}
+
+	if len(opts.transports) != 0 {
+		export.Transports = opts.transports
+	}
+
+	if len(opts.protocols) != 0 {
+		export.Protocols = opts.protocols
+	}
+}
+
+// needsApply returns true when the options can not be passed while creating
+// the export, and need to be applied to the export afterwards.
+func (opts *exportOptions) needsApply() bool {
+	return len(opts.transports) != 0 || len(opts.protocols) != 0
+}
+
+// enabledProtocols returns the NFS protocol versions that are enabled with
+// `Protocols` in the NFS_CORE_PARAM block of the NFS-Ganesha configuration.
+// NFS-clusters that are deployed by Ceph only enable NFSv4 by default.
+func enabledProtocols(ganeshaConfig string) []int {
+	protocols := []int{nfsV4}
+
+	inCoreParam := false
+	for _, line := range strings.Split(ganeshaConfig, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(strings.ToUpper(line), "NFS_CORE_PARAM"):
+			inCoreParam = true
+		case strings.HasPrefix(line, "}"):
+			inCoreParam = false
+		case inCoreParam:
+			key, value, found := strings.Cut(line, "=")
+			if !found || !strings.EqualFold(strings.TrimSpace(key), "Protocols") {
+				continue
+			}
+
+			protocols = []int{}
+			for _, p := range strings.Split(strings.Trim(strings.TrimSpace(value), ";"), ",") {
+				p = strings.TrimSpace(p)
+				switch {
+				case p == "3" || strings.EqualFold(p, "NFS3") || strings.EqualFold(p, "NFSv3"):
+					protocols = append(protocols, nfsV3)
+				case p == "4" || strings.EqualFold(p, "NFS4") || strings.EqualFold(p, "NFSv4"):
+					protocols = append(protocols, nfsV4)
+				}
+			}
+		}
+	}
+
+	return protocols
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/ceph/go-ceph/common/admin/nfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExportOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    *exportOptions
+		wantErr bool
+	}{
+		{
+			name:   "no options",
+			params: map[string]string{"fsName": "myfs"},
+			want:   &exportOptions{},
+		},
+		{
+			name: "all options",
+			params: map[string]string{
+				secTypesParam:   "sys, krb5p",
+				clientsParam:    "192.168.0.10,192.168.1.0/24,*.example.com",
+				squashParam:     "Root",
+				transportsParam: "tcp",
+			},
+			want: &exportOptions{
+				secTypes:   []nfs.SecType{nfs.SysSec, nfs.Krb5pSec},
+				clients:    []string{"192.168.0.10", "192.168.1.0/24", "*.example.com"},
+				squash:     nfs.RootSquash,
+				transports: []string{"TCP"},
+			},
+		},
+		{
+			name:    "invalid security flavor",
+			params:  map[string]string{secTypesParam: "krb6"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid network",
+			params:  map[string]string{clientsParam: "192.168.1.0/33"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid hostname",
+			params:  map[string]string{clientsParam: "host_name"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid squash mode",
+			params:  map[string]string{squashParam: "some"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid transport",
+			params:  map[string]string{transportsParam: "RDMA"},
+			wantErr: true,
+		},
+		{
+			name:   "NFSv3 and NFSv4",
+			params: map[string]string{nfsVersionsParam: "3,4"},
+			want:   &exportOptions{protocols: []int{nfsV3, nfsV4}},
+		},
+		{
+			name:    "invalid NFS version",
+			params:  map[string]string{nfsVersionsParam: "4.2"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseExportOptions(tt.params)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExportOptionsApply(t *testing.T) {
+	t.Parallel()
+
+	export := nfs.ExportInfo{
+		AccessType: "RW",
+		Squash:     nfs.NoneSquash,
+		SecType:    []nfs.SecType{nfs.SysSec},
+		Transports: []string{"TCP"},
+	}
+
+	opts := &exportOptions{
+		clients: []string{"10.0.0.0/8"},
+		squash:  nfs.AllSquash,
+	}
+	opts.apply(&export)
+
+	require.Equal(t, "none", export.AccessType)
+	require.Equal(t, nfs.AllSquash, export.Squash)
+	require.Equal(t, []nfs.SecType{nfs.SysSec}, export.SecType)
+	require.Equal(t, []string{"TCP"}, export.Transports)
+	require.Equal(t, []nfs.ClientInfo{{
+		Addresses:  []string{"10.0.0.0/8"},
+		AccessType: "rw",
+		Squash:     nfs.AllSquash,
+	}}, export.Clients)
+}
+
+func TestEnabledProtocols(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config string
+		want   []int
+	}{
+		{
+			name:   "no user configuration",
+			config: "",
+			want:   []int{nfsV4},
+		},
+		{
+			name:   "other block",
+			config: "LOG {\n\tDefault_Log_Level = DEBUG;\n}\n",
+			want:   []int{nfsV4},
+		},
+		{
+			name:   "NFSv3 enabled",
+			config: "NFS_CORE_PARAM {\n\tProtocols = 3, 4;\n}\n",
+			want:   []int{nfsV3, nfsV4},
+		},
+		{
+			name:   "named protocols",
+			config: "NFS_CORE_PARAM {\n\tprotocols = NFSv3;\n}\n",
+			want:   []int{nfsV3},
+		},
+		{
+			name:   "protocols in other block",
+			config: "EXPORT_DEFAULTS {\n\tProtocols = 3, 4;\n}\n",
+			want:   []int{nfsV4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, enabledProtocols(tt.config))
+		})
+	}
+}
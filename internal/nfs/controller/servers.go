@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// nfsServer is an address that serves the exports of an NFS-cluster.
+type nfsServer struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	Port     int    `json:"port"`
+}
+
+// String returns the server in the `hostname=ip:port` format that the
+// NodeServer parses from the `servers` volume context parameter.
+func (s nfsServer) String() string {
+	return s.Hostname + "=" + s.IP + ":" + strconv.Itoa(s.Port)
+}
+
+// nfsClusterInfo is the output of `ceph nfs cluster info` for a cluster.
+type nfsClusterInfo struct {
+	VirtualIP string      `json:"virtual_ip"`
+	Port      int         `json:"port"`
+	Backend   []nfsServer `json:"backend"`
+}
+
+// parseNFSServers returns the servers of the NFS-cluster from the output of
+// `ceph nfs cluster info`. The virtual IP of the ingress service is the only
+// server when it is configured, otherwise all NFS-Ganesha backends are
+// returned.
+func parseNFSServers(nfsCluster string, output []byte) ([]nfsServer, error) {
+	clusters := map[string]nfsClusterInfo{}
+	err := json.Unmarshal(output, &clusters)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse info of NFS-cluster %q: %w", nfsCluster, err)
+	}
+
+	info, ok := clusters[nfsCluster]
+	if !ok {
+		return nil, fmt.Errorf("NFS-cluster %q %w", nfsCluster, ErrNotFound)
+	}
+
+	if info.VirtualIP != "" {
+		// the address of the ingress can contain a prefix length
+		vip, _, _ := strings.Cut(info.VirtualIP, "/")
+
+		return []nfsServer{{IP: vip, Port: info.Port}}, nil
+	}
+
+	if len(info.Backend) == 0 {
+		return nil, fmt.Errorf("NFS-cluster %q has no backends", nfsCluster)
+	}
+
+	return info.Backend, nil
+}
+
+// getNFSServers returns the servers of the NFS-cluster.
+func (nv *NFSVolume) getNFSServers(nfsCluster string) ([]nfsServer, error) {
+	if !nv.connected {
+		return nil, fmt.Errorf("can not get servers of NFS-cluster for %q: %w", nv, ErrNotConnected)
+	}
+
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":     "nfs cluster info",
+		"cluster_id": nfsCluster,
+		"format":     "json",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cluster info command: %w", err)
+	}
+
+	output, err := nv.conn.MgrCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info of NFS-cluster %q: %w", nfsCluster, err)
+	}
+
+	return parseNFSServers(nfsCluster, output)
+}
+
+// SetServers sets the `server` volume context parameter to the first server
+// of the NFS-cluster, and the `servers` parameter to all servers, so that the
+// NodeServer can select one of them. Volume contexts that contain a `server`
+// already are not modified.
+func (nv *NFSVolume) SetServers(vctx map[string]string) error {
+	if vctx["server"] != "" {
+		return nil
+	}
+
+	servers, err := nv.getNFSServers(vctx["nfsCluster"])
+	if err != nil {
+		return err
+	}
+
+	list := make([]string, 0, len(servers))
+	for _, s := range servers {
+		list = append(list, s.String())
+	}
+
+	vctx["server"] = servers[0].IP
+	vctx["servers"] = strings.Join(list, ",")
+
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNFSServers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		output  string
+		want    []nfsServer
+		wantErr bool
+	}{
+		{
+			name: "ingress",
+			output: `{"nfs1": {"virtual_ip": "10.0.0.100/24", "port": 2049, "monitor_port": 9049,
+				"backend": [{"hostname": "host1", "ip": "10.0.0.1", "port": 12049}]}}`,
+			want: []nfsServer{{IP: "10.0.0.100", Port: 2049}},
+		},
+		{
+			name: "backends",
+			output: `{"nfs1": {"virtual_ip": null, "backend": [
+				{"hostname": "host1", "ip": "10.0.0.1", "port": 2049},
+				{"hostname": "host2", "ip": "10.0.0.2", "port": 2049}]}}`,
+			want: []nfsServer{
+				{Hostname: "host1", IP: "10.0.0.1", Port: 2049},
+				{Hostname: "host2", IP: "10.0.0.2", Port: 2049},
+			},
+		},
+		{
+			name:    "other cluster",
+			output:  `{"nfs2": {"virtual_ip": "10.0.0.100", "port": 2049}}`,
+			wantErr: true,
+		},
+		{
+			name:    "no backends",
+			output:  `{"nfs1": {"virtual_ip": null, "backend": []}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseNFSServers("nfs1", []byte(tt.output))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNFSServerString(t *testing.T) {
+	t.Parallel()
+
+	s := nfsServer{Hostname: "host1", IP: "fd00::1", Port: 2049}
+	require.Equal(t, "host1=fd00::1:2049", s.String())
+}
@@ -18,8 +18,10 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 
 	fscore "github.com/ceph/ceph-csi/internal/cephfs/core"
@@ -131,14 +133,22 @@ func (nv *NFSVolume) CreateExport(backend *csi.Volume) error {
 	fs := vctx["fsName"]
 	nfsCluster := vctx["nfsCluster"]
 	path := vctx["subvolumePath"]
-	secTypes := vctx["secTypes"]
-	clients := vctx["clients"]
 
-	err := nv.setNFSCluster(nfsCluster)
+	opts, err := parseExportOptions(vctx)
+	if err != nil {
+		return err
+	}
+
+	err = nv.setNFSCluster(nfsCluster)
 	if err != nil {
 		return fmt.Errorf("failed to set NFS-cluster: %w", err)
 	}
 
+	err = nv.checkProtocols(nfsCluster, opts.protocols)
+	if err != nil {
+		return err
+	}
+
 	nfsa, err := nv.conn.GetNFSAdmin()
 	if err != nil {
 		return fmt.Errorf("failed to get NFSAdmin: %w", err)
@@ -149,21 +159,16 @@ func (nv *NFSVolume) CreateExport(backend *csi.Volume) error {
 		ClusterID:      nfsCluster,
 		PseudoPath:     nv.GetExportPath(),
 		Path:           path,
-	}
-
-	if secTypes != "" {
-		export.SecType = []nfs.SecType{}
-		for _, secType := range strings.Split(secTypes, ",") {
-			export.SecType = append(export.SecType, nfs.SecType(secType))
-		}
-	}
-
-	if clients != "" {
-		export.ClientAddr = strings.Split(clients, ",")
+		SecType:        opts.secTypes,
+		ClientAddr:     opts.clients,
+		Squash:         opts.squash,
 	}
 
 	_, err = nfsa.CreateCephFSExport(export)
 	switch {
+	case err == nil && opts.needsApply():
+		// the transports and protocols can not be passed on creation
+		return nv.updateExport(nfsCluster, opts)
 	case err == nil:
 		return nil
 	case strings.Contains(err.Error(), "rados: ret=-2"): // try with the old command
@@ -187,6 +192,103 @@ func (nv *NFSVolume) CreateExport(backend *csi.Volume) error {
 	return nil
 }
 
+// ModifyExport validates the export options in the parameters, and applies
+// them to the existing NFS-export. Options that are not in the parameters
+// are not modified.
+func (nv *NFSVolume) ModifyExport(params map[string]string) error {
+	if !nv.connected {
+		return fmt.Errorf("can not modify export for %q: %w", nv, ErrNotConnected)
+	}
+
+	opts, err := parseExportOptions(params)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidExportOptions, err)
+	}
+
+	nfsCluster, err := nv.getNFSCluster()
+	if err != nil {
+		return fmt.Errorf("failed to identify NFS cluster: %w", err)
+	}
+
+	err = nv.checkProtocols(nfsCluster, opts.protocols)
+	if err != nil {
+		return err
+	}
+
+	return nv.updateExport(nfsCluster, opts)
+}
+
+// checkProtocols verifies that the NFS protocol versions are enabled in the
+// NFS-cluster. The user defined configuration of the NFS-cluster is read with
+// `ceph nfs cluster config get`.
+func (nv *NFSVolume) checkProtocols(nfsCluster string, protocols []int) error {
+	if len(protocols) == 0 || slices.Equal(protocols, []int{nfsV4}) {
+		return nil
+	}
+
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":     "nfs cluster config get",
+		"cluster_id": nfsCluster,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode cluster config get command: %w", err)
+	}
+
+	config, err := nv.conn.MgrCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to get configuration of NFS-cluster %q: %w", nfsCluster, err)
+	}
+
+	enabled := enabledProtocols(string(config))
+	for _, p := range protocols {
+		if !slices.Contains(enabled, p) {
+			return fmt.Errorf("%w: NFSv%d is not enabled in NFS-cluster %q, add it to Protocols in the "+
+				"NFS_CORE_PARAM block with `ceph nfs cluster config set`", ErrUnsupportedProtocol, p, nfsCluster)
+		}
+	}
+
+	return nil
+}
+
+// updateExport applies the options to the NFS-export with
+// `ceph nfs export apply`.
+func (nv *NFSVolume) updateExport(nfsCluster string, opts *exportOptions) error {
+	nfsa, err := nv.conn.GetNFSAdmin()
+	if err != nil {
+		return fmt.Errorf("failed to get NFSAdmin: %w", err)
+	}
+
+	export, err := nfsa.ExportInfo(nfsCluster, nv.GetExportPath())
+	if err != nil && strings.Contains(err.Error(), "No export info found") {
+		return ErrExportNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get export %q from NFS-cluster %q: %w", nv, nfsCluster, err)
+	}
+
+	opts.apply(&export)
+
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":     "nfs export apply",
+		"cluster_id": nfsCluster,
+		"format":     "json",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode export apply command: %w", err)
+	}
+
+	config, err := json.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("failed to encode export %q: %w", nv, err)
+	}
+
+	_, err = nv.conn.MgrCommandWithInputBuffer(cmd, config)
+	if err != nil {
+		return fmt.Errorf("failed to update export %q in NFS-cluster %q: %w", nv, nfsCluster, err)
+	}
+
+	return nil
+}
+
 // createExportCommand returns the "ceph nfs export create ..." command
 // arguments (without "ceph"). The order of the parameters matches old Ceph
 // releases, new Ceph releases added --option formats, which can be added  when
@@ -17,6 +17,8 @@ limitations under the License.
 package driver
 
 import (
+	"context"
+
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
 	"github.com/ceph/ceph-csi/internal/nfs/controller"
 	"github.com/ceph/ceph-csi/internal/nfs/identity"
@@ -38,6 +40,9 @@ func NewDriver() *Driver {
 // Run start a non-blocking grpc controller,node and identityserver for
 // ceph CSI driver which can serve multiple parallel requests.
 func (fs *Driver) Run(conf *util.Config) {
+	// load the CSI configuration and reload it when it changes
+	go util.WatchCSIConfig(context.Background(), util.CsiConfigFile)
+
 	// Initialize default library driver
 	cd := csicommon.NewCSIDriver(conf.DriverName, util.DriverVersion, conf.NodeID, conf.InstanceID)
 	if cd == nil {
@@ -51,6 +56,7 @@ func (fs *Driver) Run(conf *util.Config) {
 			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 			csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
+			csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
 		})
 		// VolumeCapabilities are validated by the CephFS Controller
 		cd.AddVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
@@ -79,12 +85,18 @@ func (fs *Driver) Run(conf *util.Config) {
 
 	server.Start(conf.Endpoint, srv, csicommon.MiddlewareServerOptionConfig{
 		LogSlowOpInterval: conf.LogSlowOpInterval,
+		MaxNodeRPCs:       conf.MaxNodeRPCs,
+		MaxControllerRPCs: conf.MaxControllerRPCs,
+		RPCTimeouts:       conf.RPCTimeouts,
 	})
 
-	if conf.EnableProfiling {
+	if conf.EnableProfiling || conf.EnableMetrics {
 		go util.StartMetricsServer(conf)
+	}
+	if conf.EnableProfiling {
 		log.DebugLogMsg("Registering profiling handler")
 		go util.EnableProfiling()
 	}
+	go csicommon.StopOnSignal(server, conf.DrainTimeout)
 	server.Wait()
 }
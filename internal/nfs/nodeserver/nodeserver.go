@@ -19,7 +19,11 @@ package nodeserver
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
@@ -40,6 +44,13 @@ const (
 	paramServer    = "server"
 	paramShare     = "share"
 	paramClusterID = "clusterID"
+	// Servers of the NFS-cluster, `hostname=ip:port` entries separated by
+	// commas.
+	paramServers = "servers"
+	// Comma separated mount options from the StorageClass.
+	paramMountOptions = "nfsMountOptions"
+
+	defaultNFSPort = 2049
 )
 
 // NodeServer struct of ceph CSI driver with supported methods of CSI
@@ -76,19 +87,35 @@ func (ns *NodeServer) NodePublishVolume(
 		mountOptions = append(mountOptions, "ro")
 	}
 
-	source, err := getSource(req.GetVolumeContext())
+	volContext := req.GetVolumeContext()
+	if volContext[paramServers] != "" {
+		server, sErr := selectServer(volContext[paramServers], ns.Driver.GetNodeID())
+		if sErr != nil {
+			return nil, status.Error(codes.InvalidArgument, sErr.Error())
+		}
+		log.DebugLog(ctx, "nfs: selected server %s for volume %q", server, volumeID)
+
+		volContext = maps.Clone(volContext)
+		volContext[paramServer] = server.ip
+		if server.port != defaultNFSPort {
+			mountOptions = addMountOptions(mountOptions, "port="+strconv.Itoa(server.port))
+		}
+	}
+	mountOptions = addMountOptions(mountOptions, volContext[paramMountOptions])
+
+	source, err := getSource(volContext)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	clusterID := req.GetVolumeContext()[paramClusterID]
+	clusterID := volContext[paramClusterID]
 	netNamespaceFilePath := ""
 	if clusterID != "" {
 		netNamespaceFilePath, err = util.GetNFSNetNamespaceFilePath(
 			util.CsiConfigFile,
 			clusterID)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
@@ -106,7 +133,7 @@ func (ns *NodeServer) NodePublishVolume(
 			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	log.DebugLog(ctx, "nfs: successfully mounted volume %q mount %q to %q succeeded",
 		volumeID, source, targetPath)
@@ -225,7 +252,7 @@ func (ns *NodeServer) mountNFS(
 	}
 
 	if len(mountOptions) > 0 {
-		args = append(append(args, "-o"), mountOptions...)
+		args = append(args, "-o", strings.Join(mountOptions, ","))
 	}
 
 	log.DefaultLog("nfs: mounting volumeID(%v) source(%s) targetPath(%s) mountflags(%v)",
@@ -282,3 +309,83 @@ func getSource(volContext map[string]string) (string, error) {
 
 	return fmt.Sprintf("%s:%s", server, baseDir), nil
 }
+
+// nfsServer is a server of the NFS-cluster from the `servers` parameter.
+type nfsServer struct {
+	hostname string
+	ip       string
+	port     int
+}
+
+func (s nfsServer) String() string {
+	return fmt.Sprintf("%s (%s port %d)", s.hostname, s.ip, s.port)
+}
+
+// parseServers parses the `hostname=ip:port` entries of the `servers`
+// parameter.
+func parseServers(servers string) ([]nfsServer, error) {
+	var parsed []nfsServer
+	for _, entry := range strings.Split(servers, ",") {
+		hostname, addr, found := strings.Cut(entry, "=")
+		i := strings.LastIndex(addr, ":")
+		if !found || i == -1 {
+			return nil, fmt.Errorf("invalid server %q in %s", entry, paramServers)
+		}
+
+		port, err := strconv.Atoi(addr[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port of server %q in %s: %w", entry, paramServers, err)
+		}
+
+		parsed = append(parsed, nfsServer{hostname: hostname, ip: addr[:i], port: port})
+	}
+
+	return parsed, nil
+}
+
+// selectServer selects the server of the NFS-cluster that the node mounts
+// the volume from. A server that runs on the node itself is preferred,
+// otherwise the nodes are spread over the servers by their ID. A node always
+// selects the same server while the servers of the NFS-cluster do not change.
+func selectServer(servers, nodeID string) (nfsServer, error) {
+	parsed, err := parseServers(servers)
+	if err != nil {
+		return nfsServer{}, err
+	}
+
+	nodeHost, _, _ := strings.Cut(nodeID, ".")
+	for _, server := range parsed {
+		host, _, _ := strings.Cut(server.hostname, ".")
+		if host != "" && strings.EqualFold(host, nodeHost) {
+			return server, nil
+		}
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(nodeID))
+
+	return parsed[h.Sum32()%uint32(len(parsed))], nil
+}
+
+// addMountOptions adds the comma separated options to the mount options,
+// unless an option with the same name is set already.
+func addMountOptions(mountOptions []string, options string) []string {
+	for _, opt := range strings.Split(options, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(opt, "=")
+		set := slices.ContainsFunc(mountOptions, func(o string) bool {
+			n, _, _ := strings.Cut(o, "=")
+
+			return n == name
+		})
+		if !set {
+			mountOptions = append(mountOptions, opt)
+		}
+	}
+
+	return mountOptions
+}
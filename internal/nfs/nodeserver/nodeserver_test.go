@@ -17,6 +17,7 @@ limitations under the License.
 package nodeserver
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -170,3 +171,81 @@ func Test_getSource(t *testing.T) {
 		})
 	}
 }
+
+func Test_selectServer(t *testing.T) {
+	t.Parallel()
+	servers := "node-a=10.0.0.1:2049,node-b.example.com=10.0.0.2:2049,node-c=fd00::3:12049"
+	tests := []struct {
+		name    string
+		servers string
+		nodeID  string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "local server",
+			servers: servers,
+			nodeID:  "node-b",
+			want:    "10.0.0.2",
+		},
+		{
+			name:    "local server with domain",
+			servers: servers,
+			nodeID:  "node-a.example.com",
+			want:    "10.0.0.1",
+		},
+		{
+			name:    "ingress",
+			servers: "=192.168.1.10:2049",
+			nodeID:  "node-d",
+			want:    "192.168.1.10",
+		},
+		{
+			name:    "invalid entry",
+			servers: "node-a",
+			nodeID:  "node-a",
+			wantErr: true,
+		},
+		{
+			name:    "invalid port",
+			servers: "node-a=10.0.0.1:nfs",
+			nodeID:  "node-a",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := selectServer(tt.servers, tt.nodeID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("selectServer() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if got.ip != tt.want {
+				t.Errorf("selectServer() = %v, want %v", got.ip, tt.want)
+			}
+		})
+	}
+
+	// nodes without a local server always select the same server
+	first, err := selectServer(servers, "node-x")
+	if err != nil {
+		t.Fatalf("selectServer() error = %v", err)
+	}
+	for range 5 {
+		got, err := selectServer(servers, "node-x")
+		if err != nil || got != first {
+			t.Errorf("selectServer() = %v, %v, want %v", got, err, first)
+		}
+	}
+}
+
+func Test_addMountOptions(t *testing.T) {
+	t.Parallel()
+	got := addMountOptions([]string{"ro", "timeo=100"}, "nconnect=4, timeo=600,,retrans=2")
+	want := []string{"ro", "timeo=100", "nconnect=4", "retrans=2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("addMountOptions() = %v, want %v", got, want)
+	}
+}
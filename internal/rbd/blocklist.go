@@ -0,0 +1,269 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// krbdNoShareOption is the map option that makes krbd create a new
+	// client instance for the mapping, instead of sharing the client of the
+	// other mappings of the cluster.
+	krbdNoShareOption = "noshare"
+	// krbdForceUnmapOption unmaps the device even when it is open.
+	krbdForceUnmapOption = "force"
+
+	// krbdSysfsDevices contains a directory per krbd device, with the
+	// address of the client of the device in client_addr.
+	krbdSysfsDevices = "/sys/bus/rbd/devices"
+	// kmsgPath is the kernel log.
+	kmsgPath = "/dev/kmsg"
+	// kmsgRecordSize is the maximum size of a record of the kernel log.
+	kmsgRecordSize = 8192
+)
+
+// isBlocklistedMapError returns true when the map failed because the client
+// instance is blocklisted. krbd returns EBLOCKLISTED, which is ESHUTDOWN.
+func isBlocklistedMapError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+
+	return strings.Contains(msg, fmt.Sprintf("(%d)", syscall.ESHUTDOWN)) || strings.Contains(msg, "blocklisted")
+}
+
+// krbdDeviceID returns the ID of the krbd device, like 0 for /dev/rbd0.
+func krbdDeviceID(devicePath string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(devicePath, "/dev/rbd"))
+	if err != nil || !strings.HasPrefix(devicePath, "/dev/rbd") {
+		return 0, fmt.Errorf("%q is not a krbd device", devicePath)
+	}
+
+	return id, nil
+}
+
+// splitClientAddr returns the IP and the nonce of a client address, like
+// "10.0.0.1:0/3412341234" or "[fd00::1]:0/3412341234".
+func splitClientAddr(addr string) (net.IP, string, error) {
+	hostPort, nonce, ok := strings.Cut(addr, "/")
+	if !ok {
+		return nil, "", fmt.Errorf("client address %q has no nonce", addr)
+	}
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid client address %q: %w", addr, err)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, "", fmt.Errorf("invalid IP in client address %q", addr)
+	}
+
+	return ip, nonce, nil
+}
+
+// isAddrBlocklisted returns true when the client address is in the output
+// of `ceph osd blocklist ls`. An entry matches the address itself, all
+// clients of the IP with nonce 0, or a range of IPs with the `cidr:` prefix.
+func isAddrBlocklisted(blocklist, addr string) (bool, error) {
+	ip, nonce, err := splitClientAddr(addr)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Split(blocklist, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		entry := fields[0]
+
+		if cidr, ok := strings.CutPrefix(entry, "cidr:"); ok {
+			// like "cidr:10.0.0.0:0/24"
+			network, prefix, found := strings.Cut(cidr, "/")
+			if !found {
+				continue
+			}
+			host, _, sErr := net.SplitHostPort(network)
+			if sErr != nil {
+				continue
+			}
+			_, ipNet, pErr := net.ParseCIDR(host + "/" + prefix)
+			if pErr == nil && ipNet.Contains(ip) {
+				return true, nil
+			}
+
+			continue
+		}
+
+		entryIP, entryNonce, sErr := splitClientAddr(entry)
+		if sErr != nil || !entryIP.Equal(ip) {
+			continue
+		}
+		if entryNonce == "0" || entryNonce == nonce {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// hasBlocklistedKernelMessages returns true when the kernel log contains
+// messages of the krbd device about the blocklisting of its client, after the
+// device was mapped the last time.
+func hasBlocklistedKernelMessages(kernelLog io.Reader, id int) bool {
+	prefix := fmt.Sprintf("rbd: rbd%d: ", id)
+	blocklisted := false
+
+	scanner := bufio.NewScanner(kernelLog)
+	for scanner.Scan() {
+		// records of /dev/kmsg start with "level,seq,time,flags;"
+		_, msg, found := strings.Cut(scanner.Text(), ";")
+		if !found {
+			msg = scanner.Text()
+		}
+		msg, ok := strings.CutPrefix(msg, prefix)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(msg, "capacity "):
+			// the device was mapped (again)
+			blocklisted = false
+		case strings.Contains(msg, "blocklisted"),
+			strings.Contains(msg, fmt.Sprintf("-%d", syscall.ESHUTDOWN)):
+			blocklisted = true
+		}
+	}
+
+	return blocklisted
+}
+
+// readKernelLog returns true when the kernel log contains messages about the
+// blocklisting of the client of the krbd device.
+func readKernelLog(id int) (bool, error) {
+	f, err := os.OpenFile(kmsgPath, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// every read returns one record, the buffer needs to fit the longest
+	// record
+	var records strings.Builder
+	buf := make([]byte, kmsgRecordSize)
+	for {
+		n, rErr := f.Read(buf)
+		if errors.Is(rErr, syscall.EPIPE) {
+			// the record was overwritten, continue with the next one
+			continue
+		}
+		if errors.Is(rErr, syscall.EAGAIN) || errors.Is(rErr, io.EOF) {
+			break
+		}
+		if rErr != nil {
+			return false, rErr
+		}
+		records.Write(buf[:n])
+	}
+
+	return hasBlocklistedKernelMessages(strings.NewReader(records.String()), id), nil
+}
+
+// isKrbdDeviceBlocklisted returns true when the krbd device uses a client
+// instance that is, or was, blocklisted. I/O of these devices fails, even
+// after the client was removed from the blocklist again, when the node was
+// unfenced.
+func isKrbdDeviceBlocklisted(ctx context.Context, rv *rbdVolume, devicePath string) bool {
+	id, err := krbdDeviceID(devicePath)
+	if err != nil {
+		return false
+	}
+
+	blocklisted, err := readKernelLog(id)
+	if err != nil {
+		log.DebugLog(ctx, "rbd: failed to read the kernel log: %v", err)
+	}
+	if blocklisted {
+		return true
+	}
+
+	if rv.conn == nil {
+		return false
+	}
+
+	addr, err := os.ReadFile(filepath.Join(krbdSysfsDevices, strconv.Itoa(id), "client_addr"))
+	if err != nil {
+		log.DebugLog(ctx, "rbd: failed to read the client address of %s: %v", devicePath, err)
+
+		return false
+	}
+
+	out, err := util.RunCephCommand(ctx, rv.conn, &util.CephCommand{
+		Name:    "osd blocklist ls",
+		Command: map[string]any{"prefix": "osd blocklist ls"},
+	})
+	if err != nil {
+		log.WarningLog(ctx, "rbd: failed to get the OSD blocklist: %v", err)
+
+		return false
+	}
+
+	blocklisted, err = isAddrBlocklisted(string(out), strings.TrimSpace(string(addr)))
+	if err != nil {
+		log.WarningLog(ctx, "rbd: failed to check the client address of %s: %v", devicePath, err)
+	}
+
+	return blocklisted
+}
+
+// remapBlocklistedDevice unmaps the krbd device when its client is
+// blocklisted, and sets the noshare map option so that the next map of the
+// image creates a new client instance. It returns true when the device was
+// unmapped.
+func remapBlocklistedDevice(ctx context.Context, rv *rbdVolume, devicePath string) (bool, error) {
+	if !isKrbdDeviceBlocklisted(ctx, rv, devicePath) {
+		return false, nil
+	}
+
+	log.WarningLog(ctx, "rbd: device %s of image %s uses a blocklisted client, mapping the image again",
+		devicePath, rv)
+
+	unmapOptions := mergeMapOptions(rv.UnmapOptions, krbdForceUnmapOption)
+	err := detachRBDDevice(ctx, devicePath, rv.VolID, unmapOptions, rv.isBlockEncrypted())
+	if err != nil {
+		return false, fmt.Errorf("failed to unmap device %s with a blocklisted client: %w", devicePath, err)
+	}
+	rv.MapOptions = mergeMapOptions(rv.MapOptions, krbdNoShareOption)
+
+	return true, nil
+}
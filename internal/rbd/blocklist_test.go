@@ -0,0 +1,176 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsBlocklistedMapError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "no error",
+			err:  nil,
+			want: false,
+		},
+		{
+			name: "ESHUTDOWN",
+			err: errors.New("rbd: map failed with error exit status 108, rbd error output: " +
+				"rbd: map failed: (108) Cannot send after transport endpoint shutdown"),
+			want: true,
+		},
+		{
+			name: "other error",
+			err:  errors.New("rbd: map failed: (2) No such file or directory"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, isBlocklistedMapError(tt.err))
+		})
+	}
+}
+
+func TestKrbdDeviceID(t *testing.T) {
+	t.Parallel()
+
+	id, err := krbdDeviceID("/dev/rbd12")
+	require.NoError(t, err)
+	require.Equal(t, 12, id)
+
+	_, err = krbdDeviceID("/dev/nbd0")
+	require.Error(t, err)
+}
+
+func TestIsAddrBlocklisted(t *testing.T) {
+	t.Parallel()
+
+	blocklist := `10.0.0.1:0/3412341234 2029-10-18T10:00:00.000000+0000
+10.0.0.2:0/0 2029-10-18T10:00:00.000000+0000
+[fd00::3]:0/1234 2029-10-18T10:00:00.000000+0000
+cidr:10.1.0.0:0/16 2029-10-18T10:00:00.000000+0000
+listed 4 entries
+`
+	tests := []struct {
+		name    string
+		addr    string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "same address",
+			addr: "10.0.0.1:0/3412341234",
+			want: true,
+		},
+		{
+			name: "other nonce",
+			addr: "10.0.0.1:0/1",
+			want: false,
+		},
+		{
+			name: "all clients of the IP",
+			addr: "10.0.0.2:0/42",
+			want: true,
+		},
+		{
+			name: "IPv6",
+			addr: "[fd00::3]:0/1234",
+			want: true,
+		},
+		{
+			name: "range",
+			addr: "10.1.20.30:0/42",
+			want: true,
+		},
+		{
+			name: "not listed",
+			addr: "10.2.0.1:0/42",
+			want: false,
+		},
+		{
+			name:    "invalid address",
+			addr:    "10.0.0.1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := isAddrBlocklisted(blocklist, tt.addr)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHasBlocklistedKernelMessages(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		kernelLog string
+		want      bool
+	}{
+		{
+			name:      "mapped",
+			kernelLog: "6,100,1000,-;rbd: rbd0: capacity 1073741824 features 0x3d\n",
+			want:      false,
+		},
+		{
+			name: "blocklisted",
+			kernelLog: "6,100,1000,-;rbd: rbd0: capacity 1073741824 features 0x3d\n" +
+				"4,101,2000,-;rbd: rbd0: encountered watch error: -108\n",
+			want: true,
+		},
+		{
+			name: "other device",
+			kernelLog: "6,100,1000,-;rbd: rbd0: capacity 1073741824 features 0x3d\n" +
+				"4,101,2000,-;rbd: rbd1: failed to acquire lock: -108\n",
+			want: false,
+		},
+		{
+			name: "mapped again",
+			kernelLog: "4,101,2000,-;rbd: rbd0: encountered watch error: -108\n" +
+				"6,102,3000,-;rbd: rbd0: capacity 1073741824 features 0x3d\n" +
+				" SUBSYSTEM=block\n",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, hasBlocklistedKernelMessages(strings.NewReader(tt.kernelLog), 0))
+		})
+	}
+}
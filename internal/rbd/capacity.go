@@ -0,0 +1,119 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// getCapacityPool returns the pool that stores the data of the volumes that
+// are created with the parameters. With topologyConstrainedPools the pool that
+// matches the topology is used. The data of images with a data pool (like an
+// erasure coded pool) is stored in the data pool.
+func getCapacityPool(params map[string]string, topology *csi.Topology) (string, error) {
+	pool, dataPool, err := util.GetPoolFromTopology(params, topology)
+	if err != nil {
+		return "", err
+	}
+
+	if pool == "" {
+		pool = params["pool"]
+		dataPool = params["dataPool"]
+	}
+
+	if pool == "" {
+		return "", errors.New("missing required parameter pool")
+	}
+
+	if dataPool != "" {
+		return dataPool, nil
+	}
+
+	return pool, nil
+}
+
+// GetCapacity returns the capacity that is available in the pool of the
+// StorageClass parameters. Images in a RADOS namespace share the capacity of
+// the pool, the available capacity of the pool is reported for them too.
+func (cs *ControllerServer) GetCapacity(
+	ctx context.Context,
+	req *csi.GetCapacityRequest,
+) (*csi.GetCapacityResponse, error) {
+	params := req.GetParameters()
+
+	clusterID := params["clusterID"]
+	if clusterID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required parameter clusterID")
+	}
+
+	pool, err := getCapacityPool(params, req.GetAccessibleTopology())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	secrets, err := k8s.GetProvisionerSecret(ctx, params)
+	if err != nil {
+		if errors.Is(err, k8s.ErrNoProvisionerSecret) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, _, err := util.GetMonsAndClusterID(ctx, clusterID, false)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	conn := &util.ClusterConnection{}
+	if err = conn.Connect(monitors, cr); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to connect to cluster %s: %v", clusterID, err)
+	}
+	defer conn.Destroy()
+
+	available, err := conn.GetPoolMaxAvail(pool)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get available capacity of pool %s: %v", pool, err)
+
+		if errors.Is(err, util.ErrPoolNotFound) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	log.DebugLog(ctx, "pool %s in cluster %s has %d bytes available", pool, clusterID, available)
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: available,
+	}, nil
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCapacityPool(t *testing.T) {
+	t.Parallel()
+
+	topologyPools := `[
+		{"poolName": "pool-zone1", "domainSegments": [{"domainLabel": "zone", "value": "zone1"}]},
+		{"poolName": "pool-zone2", "dataPool": "ec-zone2",
+		 "domainSegments": [{"domainLabel": "zone", "value": "zone2"}]}
+	]`
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		topology *csi.Topology
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:   "pool",
+			params: map[string]string{"pool": "replicapool"},
+			want:   "replicapool",
+		},
+		{
+			name:   "data pool",
+			params: map[string]string{"pool": "replicapool", "dataPool": "ec-data"},
+			want:   "ec-data",
+		},
+		{
+			name: "topology constrained pool",
+			params: map[string]string{
+				"pool":                     "replicapool",
+				"topologyConstrainedPools": topologyPools,
+			},
+			topology: &csi.Topology{Segments: map[string]string{"topology.rbd.csi.ceph.com/zone": "zone1"}},
+			want:     "pool-zone1",
+		},
+		{
+			name:     "topology constrained data pool",
+			params:   map[string]string{"topologyConstrainedPools": topologyPools},
+			topology: &csi.Topology{Segments: map[string]string{"topology.rbd.csi.ceph.com/zone": "zone2"}},
+			want:     "ec-zone2",
+		},
+		{
+			name:     "no matching topology",
+			params:   map[string]string{"topologyConstrainedPools": topologyPools},
+			topology: &csi.Topology{Segments: map[string]string{"topology.rbd.csi.ceph.com/zone": "zone3"}},
+			wantErr:  true,
+		},
+		{
+			name:    "missing pool",
+			params:  map[string]string{"clusterID": "cluster-1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getCapacityPool(tt.params, tt.topology)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -117,6 +117,7 @@ func (rv *rbdVolume) generateTempClone() *rbdVolume {
 	tempClone.ClusterID = rv.ClusterID
 	tempClone.Monitors = rv.Monitors
 	tempClone.Pool = rv.Pool
+	tempClone.DataPool = rv.DataPool
 	tempClone.RadosNamespace = rv.RadosNamespace
 	// The temp cloned image name will be always (rbd image name + "-temp")
 	// this name will be always unique, as cephcsi never creates an image with
@@ -134,6 +135,11 @@ func (rv *rbdVolume) createCloneFromImage(ctx context.Context, parentVol *rbdVol
 	defer j.Destroy()
 
 	err = rv.doSnapClone(ctx, parentVol)
+	if err != nil && rv.isCrossNamespaceClone(parentVol) && needsCopyFallback(err) {
+		log.WarningLog(ctx, "cloning %s into namespace %q is not supported, copying the data instead: %v",
+			parentVol, rv.RadosNamespace, err)
+		err = rv.createCopyFromImage(ctx, parentVol)
+	}
 	if err != nil {
 		return err
 	}
@@ -167,6 +173,15 @@ func (rv *rbdVolume) createCloneFromImage(ctx context.Context, parentVol *rbdVol
 		return err
 	}
 
+	if rv.isCrossNamespaceClone(parentVol) {
+		err = rv.storeCloneLineage(ctx, parentVol)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to store lineage of volume %s: %v", rv, err)
+
+			return err
+		}
+	}
+
 	// expand the image if the requested size is greater than the current size
 	err = rv.expand()
 	if err != nil {
@@ -225,6 +240,12 @@ func (rv *rbdVolume) doSnapClone(ctx context.Context, parentVol *rbdVolume) erro
 
 		return err
 	}
+	err = tempClone.setUserMetadata(nil)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to unset user metadata on temp clone image %q: %v", tempClone, err)
+
+		return err
+	}
 
 	// create snap of temp clone from temporary cloned image
 	// create final clone
@@ -0,0 +1,180 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the attributes in the journal of a volume that was restored from a snapshot
+// in a different Ceph cluster. They record the lineage of the volume, and are
+// stored once all data of the snapshot has been copied.
+const (
+	sourceClusterIDAttribute  = "source-cluster-id"
+	sourceSnapshotIDAttribute = "source-snapshot-id"
+)
+
+// isInSameCluster returns true when both images are stored in the same Ceph
+// cluster. Different clusterIDs in the configuration can point to the same
+// Ceph cluster (for example with different RADOS namespaces), the FSIDs of
+// the clusters are compared for them.
+func (ri *rbdImage) isInSameCluster(other *rbdImage) (bool, error) {
+	if ri.ClusterID == other.ClusterID {
+		return true, nil
+	}
+
+	fsID, err := ri.conn.GetFSID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get FSID of cluster %q: %w", ri.ClusterID, err)
+	}
+
+	otherFSID, err := other.conn.GetFSID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get FSID of cluster %q: %w", other.ClusterID, err)
+	}
+
+	return fsID == otherFSID, nil
+}
+
+// isRemoteSnapshot returns true when the snapshot is stored in a different
+// Ceph cluster than the volume, an RBD clone can not be used to restore it.
+func (rv *rbdVolume) isRemoteSnapshot(rbdSnap *rbdSnapshot) (bool, error) {
+	sameCluster, err := rv.isInSameCluster(&rbdSnap.rbdImage)
+	if err != nil {
+		return false, err
+	}
+
+	return !sameCluster, nil
+}
+
+// isCopiedFromRemoteSnapshot returns true when the lineage of the volume is
+// recorded in the journal, which means the copy from the snapshot in the
+// other cluster completed.
+func (rv *rbdVolume) isCopiedFromRemoteSnapshot(ctx context.Context) (bool, error) {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, rv.conn.Creds)
+	if err != nil {
+		return false, err
+	}
+	defer j.Destroy()
+
+	snapshotID, err := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, sourceSnapshotIDAttribute)
+	if err != nil {
+		log.DebugLog(ctx, "no source snapshot recorded for volume %s: %v", rv, err)
+
+		return false, nil
+	}
+
+	return snapshotID != "", nil
+}
+
+// storeSourceLineage stores the clusterID and the ID of the snapshot that the
+// volume was copied from in the journal.
+func (rv *rbdVolume) storeSourceLineage(ctx context.Context, rbdSnap *rbdSnapshot) error {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, rv.conn.Creds)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	err = j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, sourceClusterIDAttribute, rbdSnap.ClusterID)
+	if err != nil {
+		return err
+	}
+
+	return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, sourceSnapshotIDAttribute, rbdSnap.VolID)
+}
+
+// remoteSnapshotSource returns the image and the name of the RBD snapshot
+// that contain the data of the snapshot. Like for a restore in the same
+// cluster, the data is read from the clone image of the snapshot, which has
+// an RBD snapshot with the same name.
+func remoteSnapshotSource(rbdSnap *rbdSnapshot) (*rbdVolume, string) {
+	// update parent name(rbd image name in snapshot)
+	rbdSnap.RbdImageName = rbdSnap.RbdSnapName
+
+	return rbdSnap.toVolume(), rbdSnap.RbdSnapName
+}
+
+// copyFromRemoteSnapshot copies the data and the encryption configuration of
+// the snapshot in a different cluster to the image of the volume, which needs
+// to exist already. The copy is done with a connection to each cluster, like
+// `rbd export | rbd import`, and can be repeated when it was interrupted.
+func (rv *rbdVolume) copyFromRemoteSnapshot(ctx context.Context, rbdSnap *rbdSnapshot) error {
+	parentVol, snapName := remoteSnapshotSource(rbdSnap)
+	parentVol.conn = rbdSnap.conn.Copy()
+	defer parentVol.Destroy(ctx)
+
+	log.DebugLog(ctx, "copying snapshot %s from cluster %s to volume %s in cluster %s",
+		rbdSnap, rbdSnap.ClusterID, rv, rv.ClusterID)
+
+	err := rv.copyImageData(ctx, parentVol, snapName, true)
+	if err != nil {
+		return fmt.Errorf("failed to copy snapshot %q to %q: %w", rbdSnap, rv, err)
+	}
+
+	err = parentVol.copyEncryptionConfig(ctx, &rv.rbdImage, true)
+	if err != nil {
+		return fmt.Errorf("failed to copy encryption config for %q: %w", rv, err)
+	}
+
+	return rv.storeSourceLineage(ctx, rbdSnap)
+}
+
+// createFromRemoteSnapshot creates the image of the volume and copies the
+// snapshot from a different cluster to it. The image is removed again when
+// the copy fails.
+func (rv *rbdVolume) createFromRemoteSnapshot(ctx context.Context, rbdSnap *rbdSnapshot, cr *util.Credentials) error {
+	err := createImage(ctx, rv, cr)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to create volume %s: %v", rv, err)
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	err = rv.copyFromRemoteSnapshot(ctx, rbdSnap)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to copy snapshot %s to volume %s: %v", rbdSnap, rv, err)
+
+		deleteErr := rv.Delete(ctx)
+		if deleteErr != nil {
+			log.ErrorLog(ctx, "failed to delete rbd image %s: %v", rv, deleteErr)
+		}
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return nil
+}
+
+// resumeCopyFromRemoteSnapshot copies the snapshot from a different cluster
+// to the existing image of the volume again, when the lineage of the volume
+// is not recorded in the journal yet.
+func (rv *rbdVolume) resumeCopyFromRemoteSnapshot(ctx context.Context, rbdSnap *rbdSnapshot) error {
+	copied, err := rv.isCopiedFromRemoteSnapshot(ctx)
+	if err != nil || copied {
+		return err
+	}
+
+	return rv.copyFromRemoteSnapshot(ctx, rbdSnap)
+}
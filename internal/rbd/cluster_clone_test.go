@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteSnapshotSource(t *testing.T) {
+	t.Parallel()
+
+	rbdSnap := &rbdSnapshot{}
+	rbdSnap.ClusterID = "cluster-2"
+	rbdSnap.Monitors = "mon-2"
+	rbdSnap.Pool = "replicapool"
+	rbdSnap.RadosNamespace = "tenant"
+	rbdSnap.JournalPool = "replicapool"
+	rbdSnap.VolID = "0001-0009-cluster-2-0000000000000002-snapshot"
+	rbdSnap.ImageID = "clone-image-id"
+	// the snapshot refers to the image of the volume it was taken from
+	rbdSnap.RbdImageName = "csi-vol-source"
+	rbdSnap.RbdSnapName = "csi-snap-clone"
+
+	source, snapName := remoteSnapshotSource(rbdSnap)
+
+	// the data is read from the RBD snapshot of the clone image
+	require.Equal(t, "csi-snap-clone", source.RbdImageName)
+	require.Equal(t, "csi-snap-clone", snapName)
+	require.Equal(t, "csi-snap-clone", rbdSnap.RbdImageName)
+	require.Equal(t, "clone-image-id", source.ImageID)
+	require.Equal(t, "cluster-2", source.ClusterID)
+	require.Equal(t, "mon-2", source.Monitors)
+	require.Equal(t, "replicapool", source.Pool)
+	require.Equal(t, "tenant", source.RadosNamespace)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// selectCluster sets the clusterID parameter of the request to the first
+// healthy cluster of the clusterIDs parameter, when the parameter is set.
+// A healthy cluster that has the name of the volume reserved in its journal
+// already is preferred, so that a retried request does not provision the
+// volume on another cluster when an earlier cluster in the list became
+// healthy again. Volumes with a data source are provisioned on the cluster
+// of the source, when it is in the list.
+func (cs *ControllerServer) selectCluster(ctx context.Context, req *csi.CreateVolumeRequest) error {
+	clusterIDs := util.GetClusterIDs(req.GetParameters())
+	if len(clusterIDs) == 0 {
+		return nil
+	}
+	if req.GetParameters()[util.ClusterIDKey] != "" {
+		return status.Errorf(codes.InvalidArgument, "%s and %s parameters can not be combined",
+			util.ClusterIDKey, util.ClusterIDsKey)
+	}
+
+	clusterID, err := cs.selectedCluster(ctx, req, clusterIDs)
+	if err != nil {
+		return err
+	}
+
+	log.DebugLog(ctx, "selected cluster %q out of %v for volume %q", clusterID, clusterIDs, req.GetName())
+	req.Parameters[util.ClusterIDKey] = clusterID
+
+	return nil
+}
+
+// selectedCluster returns the cluster of the data source when it is in the
+// list, the healthy cluster that has the volume reserved, or the first healthy
+// cluster.
+func (cs *ControllerServer) selectedCluster(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest,
+	clusterIDs []string,
+) (string, error) {
+	sourceID := contentSourceID(req.GetVolumeContentSource())
+	if clusterID := util.GetClusterIDFromVolumeID(sourceID); slices.Contains(clusterIDs, clusterID) {
+		return clusterID, nil
+	}
+
+	clusterID, err := util.SelectCluster(ctx, clusterIDs,
+		func(ctx context.Context, clusterID string) error {
+			return checkClusterQuorum(ctx, clusterID, req.GetSecrets())
+		},
+		func(ctx context.Context, clusterID string) (bool, error) {
+			return cs.isReservedInCluster(ctx, clusterID, req)
+		})
+	if err != nil {
+		if errors.Is(err, util.ErrNoHealthyCluster) {
+			return "", status.Error(codes.Unavailable, err.Error())
+		}
+
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	return clusterID, nil
+}
+
+// isReservedInCluster returns true when the name of the volume is reserved in
+// the journal of the cluster, an earlier request started to provision the
+// volume there.
+func (cs *ControllerServer) isReservedInCluster(
+	ctx context.Context,
+	clusterID string,
+	req *csi.CreateVolumeRequest,
+) (bool, error) {
+	clusterReq, ok := proto.Clone(req).(*csi.CreateVolumeRequest)
+	if !ok {
+		return false, fmt.Errorf("failed to copy the request of volume %q", req.GetName())
+	}
+	clusterReq.Parameters[util.ClusterIDKey] = clusterID
+
+	secrets, err := getProvisionerSecrets(clusterID, req.GetSecrets())
+	if err != nil {
+		return false, err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
+	if err != nil {
+		return false, err
+	}
+	defer cr.DeleteCredentials()
+
+	rbdVol, err := cs.parseVolCreateRequest(ctx, clusterReq, cr)
+	if err != nil {
+		return false, err
+	}
+	defer rbdVol.Destroy(ctx)
+
+	err = updateTopologyConstraints(rbdVol, nil)
+	if err != nil {
+		return false, err
+	}
+
+	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
+	if err != nil {
+		return false, err
+	}
+	defer j.Destroy()
+
+	kmsID, encryptionType := getEncryptionConfig(rbdVol)
+	imageData, err := j.CheckReservation(
+		ctx, rbdVol.JournalPool, rbdVol.RequestName, rbdVol.NamePrefix, "", kmsID, encryptionType)
+	if err != nil {
+		return false, err
+	}
+
+	return imageData != nil, nil
+}
+
+// contentSourceID returns the ID of the snapshot or volume that is the data
+// source of a volume, or an empty string.
+func contentSourceID(source *csi.VolumeContentSource) string {
+	switch {
+	case source.GetSnapshot() != nil:
+		return source.GetSnapshot().GetSnapshotId()
+	case source.GetVolume() != nil:
+		return source.GetVolume().GetVolumeId()
+	}
+
+	return ""
+}
+
+// checkClusterQuorum checks the quorum of the monitors of the cluster with
+// the provisioner credentials of the cluster.
+func checkClusterQuorum(ctx context.Context, clusterID string, secrets map[string]string) error {
+	secrets, err := getProvisionerSecrets(clusterID, secrets)
+	if err != nil {
+		return err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, _, err := util.GetMonsAndClusterID(ctx, clusterID, false)
+	if err != nil {
+		return err
+	}
+
+	return util.CheckClusterQuorum(ctx, monitors, cr)
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// compressionHintParam is the StorageClass parameter with the hint for
+	// BlueStore whether the data of the volume can be compressed.
+	compressionHintParam = "compressionHint"
+	// compressionModeParam is the StorageClass parameter with the BlueStore
+	// compression mode that the pool of the volume needs to have.
+	compressionModeParam = "compressionMode"
+
+	// compressionHintOption is the librbd option that adds the compression
+	// hint to the writes of the image.
+	compressionHintOption = "rbd_compression_hint"
+	// krbdCompressionHintOption is the krbd map option that adds the
+	// compression hint to the writes of the device.
+	krbdCompressionHintOption = "compression_hint"
+)
+
+var (
+	// compressionHints are the values of the rbd_compression_hint option.
+	compressionHints = []string{"none", "compressible", "incompressible"}
+	// compressionModes are the values of the compression_mode of a pool.
+	compressionModes = []string{"none", "passive", "aggressive", "force"}
+
+	// krbdCompressionHintSupport is the kernel version that added the
+	// compression_hint map option.
+	krbdCompressionHintSupport = []util.KernelVersion{
+		{
+			Version:    5,
+			PatchLevel: 8,
+			SubLevel:   0,
+		},
+	}
+)
+
+// parseCompressionOptions returns the compression hint and mode from the
+// parameters, both are empty when not set.
+func parseCompressionOptions(parameters map[string]string) (string, string, error) {
+	hint := parameters[compressionHintParam]
+	if hint != "" && !slices.Contains(compressionHints, hint) {
+		return "", "", fmt.Errorf("%w: invalid %s %q, supported values are %v",
+			ErrInvalidArgument, compressionHintParam, hint, compressionHints)
+	}
+
+	mode := parameters[compressionModeParam]
+	if mode != "" && !slices.Contains(compressionModes, mode) {
+		return "", "", fmt.Errorf("%w: invalid %s %q, supported values are %v",
+			ErrInvalidArgument, compressionModeParam, mode, compressionModes)
+	}
+
+	return hint, mode, nil
+}
+
+// applyCompressionHint sets the compression hint as image configuration
+// override, so that librbd and krbd clients pass it to BlueStore with every
+// write.
+func (rv *rbdVolume) applyCompressionHint(ctx context.Context) error {
+	if rv.CompressionHint == "" {
+		return nil
+	}
+
+	key := imageConfigMetaPrefix + compressionHintOption
+	err := rv.SetMetadata(key, rv.CompressionHint)
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", key, rv, err)
+	}
+	log.DebugLog(ctx, "set compression hint %s on image %s", rv.CompressionHint, rv)
+
+	return nil
+}
+
+// addKrbdCompressionHint adds the compression hint to the krbd map options,
+// krbd does not read the image configuration overrides from the image
+// metadata. The hint is not added when the kernel does not support it.
+func addKrbdCompressionHint(ctx context.Context, mapOptions, hint string) string {
+	if hint == "" {
+		return mapOptions
+	}
+
+	release, err := util.GetKernelVersion()
+	if err != nil {
+		log.WarningLog(ctx, "failed to get the kernel version, not setting the compression hint: %v", err)
+
+		return mapOptions
+	}
+	if !util.CheckKernelSupport(release, krbdCompressionHintSupport) {
+		log.WarningLog(ctx, "kernel version %q does not support the %s map option",
+			release, krbdCompressionHintOption)
+
+		return mapOptions
+	}
+
+	return mergeCompressionHint(mapOptions, hint)
+}
+
+// mergeCompressionHint adds the compression_hint map option, unless it is
+// set in the map options already.
+func mergeCompressionHint(mapOptions, hint string) string {
+	return mergeMapOptions(krbdCompressionHintOption+"="+hint, mapOptions)
+}
+
+// checkCompressionMode verifies that the pool that stores the data of the
+// volume uses the requested BlueStore compression mode. The compression mode
+// is a property of the pool, it can not be set for a single image.
+func (rv *rbdVolume) checkCompressionMode(ctx context.Context) error {
+	if rv.CompressionMode == "" {
+		return nil
+	}
+
+	pool := rv.Pool
+	if rv.DataPool != "" {
+		pool = rv.DataPool
+	}
+
+	out, err := util.RunCephCommand(ctx, rv.conn, &util.CephCommand{
+		Name: "osd pool get",
+		Command: map[string]any{
+			"prefix": "osd pool get",
+			"pool":   pool,
+			"var":    "compression_mode",
+			"format": "json",
+		},
+		Args: []string{"osd", "pool", "get", pool, "compression_mode", "--format=json"},
+	})
+	if errors.Is(err, syscall.ENOENT) {
+		return fmt.Errorf("%w: %s %q is requested, but compression_mode is not set on pool %q",
+			ErrInvalidArgument, compressionModeParam, rv.CompressionMode, pool)
+	} else if err != nil {
+		return fmt.Errorf("failed to get the compression mode of pool %q: %w", pool, err)
+	}
+
+	mode, err := parsePoolCompressionMode(out)
+	if err != nil {
+		return fmt.Errorf("failed to get the compression mode of pool %q: %w", pool, err)
+	}
+
+	if mode != rv.CompressionMode {
+		return fmt.Errorf("%w: %s %q is requested, but pool %q uses compression_mode %q",
+			ErrInvalidArgument, compressionModeParam, rv.CompressionMode, pool, mode)
+	}
+
+	return nil
+}
+
+// parsePoolCompressionMode returns the compression mode from the JSON output
+// of `ceph osd pool get <pool> compression_mode`.
+func parsePoolCompressionMode(out []byte) (string, error) {
+	var result struct {
+		CompressionMode string `json:"compression_mode"`
+	}
+
+	err := json.Unmarshal(out, &result)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %q: %w", string(out), err)
+	}
+
+	return result.CompressionMode, nil
+}
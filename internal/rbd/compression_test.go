@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompressionOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		wantHint   string
+		wantMode   string
+		wantErr    bool
+	}{
+		{"not set", map[string]string{}, "", "", false},
+		{"hint", map[string]string{"compressionHint": "compressible"}, "compressible", "", false},
+		{
+			"hint and mode",
+			map[string]string{"compressionHint": "incompressible", "compressionMode": "aggressive"},
+			"incompressible",
+			"aggressive",
+			false,
+		},
+		{"invalid hint", map[string]string{"compressionHint": "yes"}, "", "", true},
+		{"invalid mode", map[string]string{"compressionMode": "lz4"}, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			hint, mode, err := parseCompressionOptions(tt.parameters)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidArgument)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantHint, hint)
+			require.Equal(t, tt.wantMode, mode)
+		})
+	}
+}
+
+func TestParsePoolCompressionMode(t *testing.T) {
+	t.Parallel()
+
+	mode, err := parsePoolCompressionMode([]byte(`{"pool":"rbd","pool_id":2,"compression_mode":"passive"}`))
+	require.NoError(t, err)
+	require.Equal(t, "passive", mode)
+
+	_, err = parsePoolCompressionMode([]byte("compression_mode: passive"))
+	require.Error(t, err)
+}
+
+func TestMergeCompressionHint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		mapOptions string
+		hint       string
+		want       string
+	}{
+		{"no map options", "", "compressible", "compression_hint=compressible"},
+		{"other map options", "queue_depth=128", "incompressible", "compression_hint=incompressible,queue_depth=128"},
+		{"set in the map options", "compression_hint=none", "compressible", "compression_hint=none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, mergeCompressionHint(tt.mapOptions, tt.hint))
+		})
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/k8s"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/parameters"
 
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -62,6 +63,10 @@ type ControllerServer struct {
 
 	// Set metadata on volume
 	SetMetadata bool
+
+	// ReservationLock is set to acquire the RADOS lock of the journal for
+	// the request names of CreateVolume and CreateSnapshot
+	ReservationLock bool
 }
 
 func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.CreateVolumeRequest) error {
@@ -78,7 +83,15 @@ func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.Crea
 	if req.GetVolumeCapabilities() == nil {
 		return status.Error(codes.InvalidArgument, "volume Capabilities cannot be empty")
 	}
+	for _, vc := range req.GetVolumeCapabilities() {
+		if err := validateVolumeCapability(vc); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
 	options := req.GetParameters()
+	if err := parameters.Validate(ctx, parameters.RBD, parameters.StorageClass, options); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	if value, ok := options["clusterID"]; !ok || value == "" {
 		return status.Error(codes.InvalidArgument, "empty cluster ID to provision volume from")
 	}
@@ -103,8 +116,48 @@ func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.Crea
 		return status.Error(codes.InvalidArgument, "empty volume name prefix to provision volume from")
 	}
 
+	if value, ok := options[sourceImageParam]; ok {
+		if value == "" {
+			return status.Error(codes.InvalidArgument, "empty source image to provision volume from")
+		}
+		if req.GetVolumeContentSource() != nil {
+			return status.Errorf(codes.InvalidArgument,
+				"%s parameter can not be combined with a volume content source", sourceImageParam)
+		}
+	}
+
+	if value, ok := options[thickProvisionParam]; ok {
+		thick, err := strconv.ParseBool(value)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid %s value %q: %v", thickProvisionParam, value, err)
+		}
+		if thick && (req.GetVolumeContentSource() != nil || options[sourceImageParam] != "") {
+			return status.Errorf(codes.InvalidArgument,
+				"%s is only supported for volumes without a data source", thickProvisionParam)
+		}
+	}
+
+	if err := validateCloneWarmup(options[cloneWarmupParam], options["mounter"]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err := validateConfiguredMkfsOptions(options["clusterID"], options[mkfsOptionsParam])
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = validateFsckMode(options[fsckModeParam])
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	_, err = parseMkfsAlignment(options)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	// Allow readonly access mode for volume with content source
-	err := util.CheckReadOnlyManyIsSupported(req)
+	err = util.CheckReadOnlyManyIsSupported(req)
 	if err != nil {
 		return err
 	}
@@ -114,6 +167,44 @@ func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.Crea
 		return status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	_, err = parseQoSSpec(req.GetParameters())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	_, _, err = parseCompressionOptions(req.GetParameters())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	_, err = parsePodIOLimits(req.GetParameters())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+// validateVolumeCapability checks that the access mode of the capability is
+// supported. Multi-node writer access modes are only supported for block
+// volumes, reader-only access modes can not be mounted read-write.
+func validateVolumeCapability(vc *csi.VolumeCapability) error {
+	mode := vc.GetAccessMode().GetMode()
+	switch mode { //nolint:exhaustive // only check what we want
+	case csi.VolumeCapability_AccessMode_UNKNOWN:
+		return errors.New("access mode cannot be empty")
+	case csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
+		csi.VolumeCapability_AccessMode_MULTI_NODE_SINGLE_WRITER:
+		if vc.GetBlock() == nil {
+			return fmt.Errorf("access mode %s is only supported on rbd `block` type volumes", mode)
+		}
+	case csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
+		csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY:
+		if vc.GetMount() != nil && csicommon.MountOptionContains(vc.GetMount().GetMountFlags(), "rw") {
+			return fmt.Errorf("access mode %s can not be combined with the `rw` mount option", mode)
+		}
+	}
+
 	return nil
 }
 
@@ -128,9 +219,29 @@ func validateStriping(parameters map[string]string) error {
 		return errors.New("stripeUnit must be specified when stripeCount is specified")
 	}
 
+	var (
+		objSize uint64
+		unit    uint64
+		count   uint64
+		err     error
+	)
+	if stripeUnit != "" {
+		unit, err = strconv.ParseUint(stripeUnit, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse stripeUnit %s: %w", stripeUnit, err)
+		}
+		count, err = strconv.ParseUint(stripeCount, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse stripeCount %s: %w", stripeCount, err)
+		}
+		if unit == 0 || count == 0 {
+			return errors.New("stripeUnit and stripeCount must be greater than 0")
+		}
+	}
+
 	objectSize := parameters["objectSize"]
 	if objectSize != "" {
-		objSize, err := strconv.ParseUint(objectSize, 10, 64)
+		objSize, err = strconv.ParseUint(objectSize, 10, 64)
 		if err != nil {
 			return fmt.Errorf("failed to parse objectSize %s: %w", objectSize, err)
 		}
@@ -144,6 +255,10 @@ func validateStriping(parameters map[string]string) error {
 		if objSize == 0 || (objSize&(objSize-1)) != 0 {
 			return fmt.Errorf("objectSize %s is not power of 2", objectSize)
 		}
+
+		// the stripe unit can only be validated against the default
+		// objectSize of the pool once it is known
+		return checkStripingLayout(objSize, unit, count)
 	}
 
 	return nil
@@ -208,6 +323,12 @@ func (cs *ControllerServer) parseVolCreateRequest(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	// the passphrase of an encrypted volume is removed on DeleteVolume, the
+	// image could not be used after restoring it from the trash
+	if rbdVol.TrashExpiry > 0 && (rbdVol.isBlockEncrypted() || rbdVol.isFileEncrypted()) {
+		return nil, status.Errorf(codes.InvalidArgument, "%s can not be combined with encryption", trashExpiryParam)
+	}
+
 	rbdVol.RequestName = req.GetName()
 
 	// Volume Size - Default is 1 GiB
@@ -235,7 +356,7 @@ func (cs *ControllerServer) parseVolCreateRequest(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to connect to volume %v: %v", rbdVol.RbdImageName, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// NOTE: rbdVol does not contain VolID and RbdImageName populated, everything
@@ -306,7 +427,7 @@ func getGRPCErrorForCreateVolume(err error) error {
 		return status.Error(codes.Aborted, err.Error())
 	}
 
-	return status.Error(codes.Internal, err.Error())
+	return util.GRPCError(err)
 }
 
 func checkValidCreateVolumeRequest(rbdVol, parentVol *rbdVolume, rbdSnap *rbdSnapshot) error {
@@ -342,6 +463,19 @@ func checkValidCreateVolumeRequest(rbdVol, parentVol *rbdVolume, rbdSnap *rbdSna
 func (cs *ControllerServer) CreateVolume(
 	ctx context.Context,
 	req *csi.CreateVolumeRequest,
+) (*csi.CreateVolumeResponse, error) {
+	err := cs.selectCluster(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return cs.createVolume(ctx, req)
+}
+
+// createVolume creates the volume in the cluster of the clusterID parameter.
+func (cs *ControllerServer) createVolume(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest,
 ) (*csi.CreateVolumeResponse, error) {
 	err := cs.validateVolumeReq(ctx, req)
 	if err != nil {
@@ -351,7 +485,11 @@ func (cs *ControllerServer) CreateVolume(
 	// TODO: create/get a connection from the ConnPool, and do not pass the
 	// credentials to any of the utility functions.
 
-	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	secrets, err := getProvisionerSecrets(req.GetParameters()["clusterID"], req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -362,12 +500,24 @@ func (cs *ControllerServer) CreateVolume(
 	}
 	defer rbdVol.Destroy(ctx)
 	// Existence and conflict checks
-	if acquired := cs.VolumeLocks.TryAcquire(req.GetName()); !acquired {
+	token, acquired := cs.VolumeLocks.TryAcquire(req.GetName())
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, req.GetName())
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, req.GetName())
 	}
-	defer cs.VolumeLocks.Release(req.GetName())
+	defer cs.VolumeLocks.Release(req.GetName(), token)
+
+	if cs.ReservationLock {
+		release, lErr := volJournal.LockReservation(ctx, rbdVol.Monitors, rbdVol.RadosNamespace, cr,
+			rbdVol.JournalPool, req.GetName())
+		if lErr != nil {
+			log.ErrorLog(ctx, lErr.Error())
+
+			return nil, status.Error(codes.Aborted, lErr.Error())
+		}
+		defer release()
+	}
 
 	parentVol, rbdSnap, err := checkContentSource(ctx, req, cr)
 	if err != nil {
@@ -382,14 +532,15 @@ func (cs *ControllerServer) CreateVolume(
 
 	err = updateTopologyConstraints(rbdVol, rbdSnap)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
+	rbdVol.inheritDataPool(parentVol, rbdSnap)
 
 	found, err := rbdVol.Exists(ctx, parentVol)
 	if err != nil {
 		return nil, getGRPCErrorForCreateVolume(err)
 	} else if found {
-		return cs.repairExistingVolume(ctx, req, rbdVol, rbdSnap)
+		return cs.repairExistingVolume(ctx, req, rbdVol, parentVol, rbdSnap)
 	}
 
 	err = checkValidCreateVolumeRequest(rbdVol, parentVol, rbdSnap)
@@ -397,15 +548,61 @@ func (cs *ControllerServer) CreateVolume(
 		return nil, err
 	}
 
+	err = rbdVol.validateStripingWithPoolDefaults(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to validate striping of volume %s: %v", rbdVol, err)
+		if errors.Is(err, ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.checkCompressionMode(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to validate compression of volume %s: %v", rbdVol, err)
+		if errors.Is(err, ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.chargeNamespaceQuota(ctx, cr)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to check quota for volume %s: %v", rbdVol, err)
+		if errors.Is(err, ErrQuotaExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+	// the quota is released by undoVolReservation once the volume is
+	// reserved in the journal
+	quotaCharged := true
+	defer func() {
+		if quotaCharged {
+			rbdVol.releaseNamespaceQuotaOf(ctx, cr, rbdVol.VolSize)
+		}
+	}()
+
 	err = flattenParentImage(ctx, parentVol, rbdSnap, cr)
 	if err != nil {
 		return nil, err
 	}
 
+	err = rbdVol.ensureRadosNamespace(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to create namespace for volume %s: %v", rbdVol, err)
+
+		return nil, util.GRPCError(err)
+	}
+
 	err = reserveVol(ctx, rbdVol, cr)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
+	quotaCharged = false
 	defer func() {
 		if err != nil {
 			errDefer := undoVolReservation(ctx, rbdVol, cr)
@@ -432,7 +629,42 @@ func (cs *ControllerServer) CreateVolume(
 			log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v", rbdVol, deleteErr)
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.setUserMetadata(k8s.GetUserMetadata(req.GetParameters()))
+	if err != nil {
+		if deleteErr := rbdVol.Delete(ctx); deleteErr != nil {
+			log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v", rbdVol, deleteErr)
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.applyQoS(ctx)
+	if err != nil {
+		if deleteErr := rbdVol.Delete(ctx); deleteErr != nil {
+			log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v", rbdVol, deleteErr)
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.applyCompressionHint(ctx)
+	if err != nil {
+		if deleteErr := rbdVol.Delete(ctx); deleteErr != nil {
+			log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v", rbdVol, deleteErr)
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	if parentVol != nil || rbdSnap != nil || rbdVol.SourceImage != nil {
+		// the volume is usable without the warmup, the err of the
+		// function must stay nil to keep the reservation
+		if wErr := rbdVol.startWarmup(ctx); wErr != nil {
+			log.WarningLog(ctx, "failed to start the warmup of %s: %v", rbdVol, wErr)
+		}
 	}
 
 	return buildCreateVolumeResponse(ctx, req, rbdVol)
@@ -516,14 +748,30 @@ func flattenParentImage(
 // that the state is corrected to what was requested. It is needed to call this
 // when the process of creating a volume was interrupted.
 func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.CreateVolumeRequest,
-	rbdVol *rbdVolume, rbdSnap *rbdSnapshot,
+	rbdVol, parentVol *rbdVolume, rbdSnap *rbdSnapshot,
 ) (*csi.CreateVolumeResponse, error) {
 	vcs := req.GetVolumeContentSource()
 
 	switch {
 	// rbdVol is a restore from snapshot, rbdSnap is passed
 	case vcs.GetSnapshot() != nil:
-		err := rbdSnap.repairEncryptionConfig(ctx, &rbdVol.rbdImage)
+		remote, err := rbdVol.isRemoteSnapshot(rbdSnap)
+		if err != nil {
+			return nil, util.GRPCError(err)
+		}
+
+		// continue the copy from a snapshot in a different cluster, in
+		// case it was interrupted
+		if remote {
+			err = rbdVol.resumeCopyFromRemoteSnapshot(ctx, rbdSnap)
+			if err != nil {
+				log.ErrorLog(ctx, "failed to copy snapshot %s to volume %s: %v", rbdSnap, rbdVol, err)
+
+				return nil, util.GRPCError(err)
+			}
+		}
+
+		err = rbdSnap.repairEncryptionConfig(ctx, &rbdVol.rbdImage)
 		if err != nil {
 			return nil, err
 		}
@@ -536,8 +784,39 @@ func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.C
 			return nil, err
 		}
 
+		// add the flatten task again, in case it was not added before
+		if !remote {
+			err = rbdVol.flattenRestoreToPool(ctx, rbdSnap.Pool)
+		}
+		if err != nil {
+			log.ErrorLog(ctx, "failed to flatten volume %s: %v", rbdVol, err)
+
+			return nil, err
+		}
+
 	// rbdVol is a clone from parentVol
 	case vcs.GetVolume() != nil:
+		// continue the clone from a volume in a different RADOS namespace,
+		// in case it was interrupted
+		if rbdVol.isCrossNamespaceClone(parentVol) {
+			err := rbdVol.resumeCloneAcrossNamespace(ctx, parentVol)
+			if err != nil {
+				log.ErrorLog(ctx, "failed to clone volume %s to volume %s: %v", parentVol, rbdVol, err)
+
+				return nil, util.GRPCError(err)
+			}
+		}
+
+		// expand the image if the requested size is greater than the current size
+		err := rbdVol.expand()
+		if err != nil {
+			log.ErrorLog(ctx, "failed to resize volume %s: %v", rbdVol, err)
+
+			return nil, err
+		}
+
+	// rbdVol is a clone from a source image
+	case rbdVol.SourceImage != nil:
 		// expand the image if the requested size is greater than the current size
 		err := rbdVol.expand()
 		if err != nil {
@@ -554,6 +833,14 @@ func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.C
 				return nil, fmt.Errorf("failed to setup encryption for image %s: %w", rbdVol, err)
 			}
 		}
+
+		// continue the allocation in case it was interrupted
+		err := rbdVol.resumeThickProvision(ctx)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to thick-provision volume %s: %v", rbdVol, err)
+
+			return nil, util.GRPCError(err)
+		}
 	}
 
 	// Set metadata on restart of provisioner pod when image exist
@@ -563,6 +850,21 @@ func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.C
 		return nil, err
 	}
 
+	err = rbdVol.setUserMetadata(k8s.GetUserMetadata(req.GetParameters()))
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.applyQoS(ctx)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+
+	err = rbdVol.applyCompressionHint(ctx)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+
 	return buildCreateVolumeResponse(ctx, req, rbdVol)
 }
 
@@ -579,7 +881,7 @@ func flattenTemporaryClonedImages(ctx context.Context, rbdVol *rbdVolume, cr *ut
 			return status.Error(codes.InvalidArgument, err.Error())
 		}
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	if len(snaps) > int(maxSnapshotsOnImage) {
@@ -597,7 +899,7 @@ func flattenTemporaryClonedImages(ctx context.Context, rbdVol *rbdVolume, cr *ut
 			rbdVol.RbdImageName,
 			cr)
 		if err != nil {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 
 		return status.Errorf(codes.ResourceExhausted, "rbd image %s has %d snapshots", rbdVol, len(snaps))
@@ -622,7 +924,7 @@ func flattenTemporaryClonedImages(ctx context.Context, rbdVol *rbdVolume, cr *ut
 			rbdVol.RbdImageName,
 			cr)
 		if err != nil {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 	}
 
@@ -636,12 +938,13 @@ func (cs *ControllerServer) createVolumeFromSnapshot(
 	rbdVol *rbdVolume,
 	snapshotID string,
 ) error {
-	if acquired := cs.SnapshotLocks.TryAcquire(snapshotID); !acquired {
+	token, acquired := cs.SnapshotLocks.TryAcquire(snapshotID)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, snapshotID)
 
 		return status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, snapshotID)
 	}
-	defer cs.SnapshotLocks.Release(snapshotID)
+	defer cs.SnapshotLocks.Release(snapshotID, token)
 
 	rbdSnap, err := genSnapFromSnapID(ctx, snapshotID, cr, secrets)
 	if err != nil {
@@ -651,10 +954,18 @@ func (cs *ControllerServer) createVolumeFromSnapshot(
 			return status.Error(codes.InvalidArgument, err.Error())
 		}
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 	defer rbdSnap.Destroy(ctx)
 
+	remote, err := rbdVol.isRemoteSnapshot(rbdSnap)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	if remote {
+		return rbdVol.createFromRemoteSnapshot(ctx, rbdSnap, cr)
+	}
+
 	// update parent name(rbd image name in snapshot)
 	rbdSnap.RbdImageName = rbdSnap.RbdSnapName
 	parentVol := rbdSnap.toVolume()
@@ -703,6 +1014,13 @@ func (cs *ControllerServer) createVolumeFromSnapshot(
 		return err
 	}
 
+	err = rbdVol.flattenRestoreToPool(ctx, parentVol.Pool)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to flatten volume %s: %v", rbdVol, err)
+
+		return err
+	}
+
 	return nil
 }
 
@@ -717,7 +1035,7 @@ func (cs *ControllerServer) createBackingImage(
 
 	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 	defer j.Destroy()
 
@@ -743,12 +1061,17 @@ func (cs *ControllerServer) createBackingImage(
 		defer cs.OperationLocks.ReleaseCloneLock(parentVol.VolID)
 
 		return rbdVol.createCloneFromImage(ctx, parentVol)
+	case rbdVol.SourceImage != nil:
+		err = cs.createVolumeFromSourceImage(ctx, rbdVol)
+		if err != nil {
+			return err
+		}
 	default:
 		err = createImage(ctx, rbdVol, cr)
 		if err != nil {
 			log.ErrorLog(ctx, "failed to create volume: %v", err)
 
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 	}
 
@@ -763,7 +1086,43 @@ func (cs *ControllerServer) createBackingImage(
 	}()
 	err = rbdVol.storeImageID(ctx, j)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
+	}
+
+	if rbdVol.ThickProvision {
+		err = rbdVol.thickProvision(ctx)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to thick-provision volume %s: %v", rbdVol, err)
+
+			return util.GRPCError(err)
+		}
+	}
+
+	return nil
+}
+
+// createVolumeFromSourceImage clones the latest protected snapshot of the
+// source image that is configured in the StorageClass.
+func (cs *ControllerServer) createVolumeFromSourceImage(ctx context.Context, rbdVol *rbdVolume) error {
+	if rbdVol.isBlockEncrypted() || rbdVol.isFileEncrypted() {
+		return status.Errorf(codes.InvalidArgument,
+			"cannot create encrypted volume from unencrypted source image %q", rbdVol.SourceImage)
+	}
+
+	err := rbdVol.createCloneFromSourceImage(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to create volume from source image: %v", err)
+
+		switch {
+		case errors.Is(err, ErrInvalidArgument):
+			return status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, ErrImageNotFound):
+			return status.Error(codes.NotFound, err.Error())
+		case errors.Is(err, ErrNoProtectedSnapshot):
+			return status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return util.GRPCError(err)
 	}
 
 	return nil
@@ -792,7 +1151,7 @@ func checkContentSource(
 		if err != nil {
 			log.ErrorLog(ctx, "failed to get backend snapshot for %s: %v", snapshotID, err)
 			if !errors.Is(err, ErrSnapNotFound) {
-				return nil, nil, status.Error(codes.Internal, err.Error())
+				return nil, nil, util.GRPCError(err)
 			}
 
 			return nil, nil, status.Errorf(codes.NotFound, "%s snapshot does not exist", snapshotID)
@@ -812,7 +1171,7 @@ func checkContentSource(
 		if err != nil {
 			log.ErrorLog(ctx, "failed to get backend image for %s: %v", volID, err)
 			if !errors.Is(err, ErrImageNotFound) {
-				return nil, nil, status.Error(codes.Internal, err.Error())
+				return nil, nil, util.GRPCError(err)
 			}
 
 			return nil, nil, status.Errorf(codes.NotFound, "%s image does not exist", volID)
@@ -858,21 +1217,22 @@ func (cs *ControllerServer) checkErrAndUndoReserve(
 		}
 	} else {
 		// All errors other than ErrImageNotFound should return an error back to the caller
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// If error is ErrImageNotFound then we failed to find the image, but found the imageOMap
 	// to lead us to the image, hence the imageOMap needs to be garbage collected, by calling
 	// unreserve for the same
-	if acquired := cs.VolumeLocks.TryAcquire(rbdVol.RequestName); !acquired {
+	nameToken, acquired := cs.VolumeLocks.TryAcquire(rbdVol.RequestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, rbdVol.RequestName)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, rbdVol.RequestName)
 	}
-	defer cs.VolumeLocks.Release(rbdVol.RequestName)
+	defer cs.VolumeLocks.Release(rbdVol.RequestName, nameToken)
 
 	if err = undoVolReservation(ctx, rbdVol, cr); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.DeleteVolumeResponse{}, nil
@@ -898,18 +1258,23 @@ func (cs *ControllerServer) DeleteVolume(
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
 
-	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	secrets, err := getProvisionerSecrets(util.GetClusterIDFromVolumeID(volumeID), req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 	defer cr.DeleteCredentials()
 
-	if acquired := cs.VolumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := cs.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer cs.VolumeLocks.Release(volumeID)
+	defer cs.VolumeLocks.Release(volumeID, token)
 
 	// lock out volumeID for clone and expand operation
 	if err = cs.OperationLocks.GetDeleteLock(volumeID); err != nil {
@@ -945,12 +1310,13 @@ func (cs *ControllerServer) DeleteVolume(
 
 	// lock out parallel create requests against the same volume name as we
 	// clean up the image and associated omaps for the same
-	if acquired := cs.VolumeLocks.TryAcquire(rbdVol.RequestName); !acquired {
+	nameToken, acquired := cs.VolumeLocks.TryAcquire(rbdVol.RequestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, rbdVol.RequestName)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, rbdVol.RequestName)
 	}
-	defer cs.VolumeLocks.Release(rbdVol.RequestName)
+	defer cs.VolumeLocks.Release(rbdVol.RequestName, nameToken)
 
 	return cleanupRBDImage(ctx, rbdVol, cr)
 }
@@ -963,7 +1329,7 @@ func cleanupRBDImage(ctx context.Context,
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	// Cleanup only omap data if the following condition is met
 	// Mirroring is enabled on the image
@@ -994,7 +1360,7 @@ func cleanupRBDImage(ctx context.Context,
 				log.ErrorLog(ctx, "failed to remove reservation for volume (%s) with backing image (%s) (%s)",
 					rbdVol.RequestName, rbdVol.RbdImageName, err)
 
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 
 			return &csi.DeleteVolumeResponse{}, nil
@@ -1009,7 +1375,7 @@ func cleanupRBDImage(ctx context.Context,
 	if err != nil {
 		log.ErrorLog(ctx, "failed getting information for image (%s): (%s)", rbdVol, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	if inUse {
 		log.ErrorLog(ctx, "rbd %s is still being used", rbdVol)
@@ -1017,13 +1383,54 @@ func cleanupRBDImage(ctx context.Context,
 		return nil, status.Errorf(codes.Internal, "rbd %s is still being used", rbdVol.RbdImageName)
 	}
 
+	err = rbdVol.checkMirroredDeletion(ctx, cr, info)
+	if err != nil {
+		log.ErrorLog(ctx, err.Error())
+
+		return nil, err
+	}
+
+	trashExpiry, err := rbdVol.fetchTrashExpiry(ctx, cr)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get trash expiry of volume %s: %v", rbdVol, err)
+
+		return nil, util.GRPCError(err)
+	}
+	if trashExpiry > 0 {
+		// the image is kept, remove the user metadata so that it is not
+		// reported as a volume anymore
+		err = rbdVol.setUserMetadata(nil)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to remove user metadata of %s: %v", rbdVol, err)
+
+			return nil, util.GRPCError(err)
+		}
+
+		// keep the images in the trash, so that they can be restored
+		err = rbdVol.moveToTrash(ctx, trashExpiry)
+		if err != nil {
+			log.ErrorLog(ctx, err.Error())
+
+			return nil, util.GRPCError(err)
+		}
+
+		if err = undoVolReservation(ctx, rbdVol, cr); err != nil {
+			log.ErrorLog(ctx, "failed to remove reservation for volume (%s) with backing image (%s) (%s)",
+				rbdVol.RequestName, rbdVol.RbdImageName, err)
+
+			return nil, util.GRPCError(err)
+		}
+
+		return &csi.DeleteVolumeResponse{}, nil
+	}
+
 	// delete the temporary rbd image created as part of volume clone during
 	// create volume
 	err = rbdVol.DeleteTempImage(ctx)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to delete temporary rbd image: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// Deleting rbd image
@@ -1032,14 +1439,14 @@ func cleanupRBDImage(ctx context.Context,
 		log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v",
 			rbdVol, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if err = undoVolReservation(ctx, rbdVol, cr); err != nil {
 		log.ErrorLog(ctx, "failed to remove reservation for volume (%s) with backing image (%s) (%s)",
 			rbdVol.RequestName, rbdVol.RbdImageName, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.DeleteVolumeResponse{}, nil
@@ -1083,9 +1490,13 @@ func (cs *ControllerServer) CreateSnapshot(
 		return nil, err
 	}
 
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getProvisionerSecrets(util.GetClusterIDFromVolumeID(req.GetSourceVolumeId()), req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
@@ -1121,19 +1532,31 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	rbdSnap, err := genSnapFromOptions(ctx, rbdVol, req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	rbdSnap.RbdImageName = rbdVol.RbdImageName
 	rbdSnap.VolSize = rbdVol.VolSize
 	rbdSnap.SourceVolumeID = req.GetSourceVolumeId()
 	rbdSnap.RequestName = req.GetName()
 
-	if acquired := cs.SnapshotLocks.TryAcquire(req.GetName()); !acquired {
+	token, acquired := cs.SnapshotLocks.TryAcquire(req.GetName())
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, req.GetName())
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, req.GetName())
 	}
-	defer cs.SnapshotLocks.Release(req.GetName())
+	defer cs.SnapshotLocks.Release(req.GetName(), token)
+
+	if cs.ReservationLock {
+		release, lErr := snapJournal.LockReservation(ctx, rbdSnap.Monitors, rbdSnap.RadosNamespace, cr,
+			rbdSnap.JournalPool, req.GetName())
+		if lErr != nil {
+			log.ErrorLog(ctx, lErr.Error())
+
+			return nil, status.Error(codes.Aborted, lErr.Error())
+		}
+		defer release()
+	}
 
 	// Take lock on parent rbd image
 	if err = cs.OperationLocks.GetSnapshotCreateLock(rbdSnap.SourceVolumeID); err != nil {
@@ -1157,6 +1580,16 @@ func (cs *ControllerServer) CreateSnapshot(
 		return cloneFromSnapshot(ctx, rbdVol, rbdSnap, cr, req.GetParameters())
 	}
 
+	err = rbdVol.checkSnapshotLimits(ctx, rbdSnap, cr, req.GetParameters())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to check snapshot limits of volume %s: %v", rbdVol, err)
+		if errors.Is(err, util.ErrSnapshotLimitExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
 	err = flattenTemporaryClonedImages(ctx, rbdVol, cr)
 	if err != nil {
 		return nil, err
@@ -1164,7 +1597,7 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	err = reserveSnap(ctx, rbdSnap, rbdVol, cr)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer func() {
 		if err != nil && !errors.Is(err, ErrFlattenInProgress) {
@@ -1177,7 +1610,7 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	vol, err := cs.doSnapshotClone(ctx, rbdVol, rbdSnap, cr)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// Update the metadata on snapshot not on the original image
@@ -1196,19 +1629,35 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	err = rbdVol.unsetAllMetadata(k8s.GetVolumeMetadataKeys())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
+	}
+	// the user metadata of the volume is not copied to its snapshots
+	err = rbdVol.setUserMetadata(nil)
+	if err != nil {
+		return nil, util.GRPCError(err)
 	}
 	// Set snapshot-name/snapshot-namespace/snapshotcontent-name details
 	// on RBD backend image as metadata on create
 	metadata := k8s.GetSnapshotMetadata(req.GetParameters())
 	err = rbdVol.setAllMetadata(metadata)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	csiSnap, err := vol.toSnapshot().ToCSI(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
+	}
+
+	errStore := storeSnapshotUsage(ctx, rbdSnap, rbdVol)
+	if errStore != nil {
+		log.WarningLog(ctx, "failed to store used bytes of snapshot %s: %v", rbdSnap, errStore)
+	}
+
+	errStore = rbdVol.storeLastSnapshotTime(ctx, cr, csiSnap.GetCreationTime().AsTime())
+	if errStore != nil {
+		log.WarningLog(ctx, "failed to store time of snapshot %s of volume %s: %v",
+			rbdSnap.RbdSnapName, req.GetSourceVolumeId(), errStore)
 	}
 
 	return &csi.CreateSnapshotResponse{
@@ -1239,7 +1688,7 @@ func cloneFromSnapshot(
 
 	err = rbdVol.copyEncryptionConfig(ctx, &vol.rbdImage, false)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	err = vol.flattenRbdImage(ctx, false, rbdHardMaxCloneDepth, rbdSoftMaxCloneDepth)
@@ -1261,13 +1710,13 @@ func cloneFromSnapshot(
 		metadata := k8s.GetSnapshotMetadata(parameters)
 		err = rbdVol.setAllMetadata(metadata)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
 	csiSnap, err := rbdSnap.ToCSI(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.CreateSnapshotResponse{
@@ -1292,6 +1741,9 @@ func (cs *ControllerServer) validateSnapshotReq(ctx context.Context, req *csi.Cr
 	}
 
 	options := req.GetParameters()
+	if err := parameters.Validate(ctx, parameters.RBD, parameters.VolumeSnapshotClass, options); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	if value, ok := options["snapshotNamePrefix"]; ok && value == "" {
 		return status.Error(codes.InvalidArgument, "empty snapshot name prefix to provision snapshot from")
 	}
@@ -1397,9 +1849,13 @@ func (cs *ControllerServer) DeleteSnapshot(
 		return nil, err
 	}
 
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	secrets, err := getProvisionerSecrets(util.GetClusterIDFromVolumeID(req.GetSnapshotId()), req.GetSecrets())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, err
+	}
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
 	}
 	defer cr.DeleteCredentials()
 
@@ -1408,12 +1864,13 @@ func (cs *ControllerServer) DeleteSnapshot(
 		return nil, status.Error(codes.InvalidArgument, "snapshot ID cannot be empty")
 	}
 
-	if acquired := cs.SnapshotLocks.TryAcquire(snapshotID); !acquired {
+	token, acquired := cs.SnapshotLocks.TryAcquire(snapshotID)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, snapshotID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, snapshotID)
 	}
-	defer cs.SnapshotLocks.Release(snapshotID)
+	defer cs.SnapshotLocks.Release(snapshotID, token)
 
 	// lock out snapshotID for restore operation
 	if err = cs.OperationLocks.GetDeleteLock(snapshotID); err != nil {
@@ -1449,24 +1906,25 @@ func (cs *ControllerServer) DeleteSnapshot(
 
 			err = cleanUpImageAndSnapReservation(ctx, rbdSnap, cr)
 			if err != nil {
-				return nil, status.Error(codes.Internal, err.Error())
+				return nil, util.GRPCError(err)
 			}
 
 			return &csi.DeleteSnapshotResponse{}, nil
 		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer rbdSnap.Destroy(ctx)
 
 	// safeguard against parallel create or delete requests against the same
 	// name
-	if acquired := cs.SnapshotLocks.TryAcquire(rbdSnap.RequestName); !acquired {
+	nameToken, acquired := cs.SnapshotLocks.TryAcquire(rbdSnap.RequestName)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, rbdSnap.RequestName)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, rbdSnap.RequestName)
 	}
-	defer cs.SnapshotLocks.Release(rbdSnap.RequestName)
+	defer cs.SnapshotLocks.Release(rbdSnap.RequestName, nameToken)
 
 	// Deleting snapshot and cloned volume
 	log.DebugLog(ctx, "deleting cloned rbd volume %s", rbdSnap.RbdSnapName)
@@ -1475,7 +1933,7 @@ func (cs *ControllerServer) DeleteSnapshot(
 
 	err = rbdVol.Connect(cr)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	defer rbdVol.Destroy(ctx)
 
@@ -1486,14 +1944,14 @@ func (cs *ControllerServer) DeleteSnapshot(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to delete image: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	err = undoSnapReservation(ctx, rbdSnap, cr)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to remove reservation for snapname (%s) with backing snap (%s) on image (%s) (%s)",
 			rbdSnap.RequestName, rbdSnap.RbdSnapName, rbdSnap.RbdImageName, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.DeleteSnapshotResponse{}, nil
@@ -1505,7 +1963,7 @@ func cleanUpImageAndSnapReservation(ctx context.Context, rbdSnap *rbdSnapshot, c
 	rbdVol := rbdSnap.toVolume()
 	err := rbdVol.Connect(cr)
 	if err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 	defer rbdVol.Destroy(ctx)
 
@@ -1514,14 +1972,14 @@ func cleanUpImageAndSnapReservation(ctx context.Context, rbdSnap *rbdSnapshot, c
 	if err != nil {
 		log.ErrorLog(ctx, "failed to delete rbd image: %q with error: %v", rbdVol.Pool, rbdVol.VolName, err)
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 	err = undoSnapReservation(ctx, rbdSnap, cr)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to remove reservation for snapname (%s) with backing snap %q",
 			rbdSnap.RequestName, rbdSnap, err)
 
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	return nil
@@ -1550,14 +2008,19 @@ func (cs *ControllerServer) ControllerExpandVolume(
 	}
 
 	// lock out parallel requests against the same volume ID
-	if acquired := cs.VolumeLocks.TryAcquire(volID); !acquired {
+	token, acquired := cs.VolumeLocks.TryAcquire(volID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
 	}
-	defer cs.VolumeLocks.Release(volID)
+	defer cs.VolumeLocks.Release(volID, token)
 
-	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	secrets, err := getProvisionerSecrets(util.GetClusterIDFromVolumeID(volID), req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
@@ -1598,17 +2061,66 @@ func (cs *ControllerServer) ControllerExpandVolume(
 	// always round up the request size in bytes to the nearest MiB/GiB
 	volSize := util.RoundOffBytes(req.GetCapacityRange().GetRequiredBytes())
 
+	// RBD images can not be shrunk, a request that is satisfied by the
+	// current size succeeds, unless the image is larger than the limit
+	err = validateExpandSize(rbdVol.VolSize, volSize, req.GetCapacityRange().GetLimitBytes())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to expand rbd image %s: %v", rbdVol, err)
+
+		return nil, status.Error(codes.OutOfRange, err.Error())
+	}
+
+	// the LUKS device and the filesystem of encrypted volumes are resized
+	// by NodeExpandVolume, record the requested size before the image is
+	// resized so that a retried expansion reports the same size
+	if rbdVol.isBlockEncrypted() {
+		volSize, err = rbdVol.recordRequestedSize(ctx, volSize)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to record requested size of rbd image: %s with error: %v", rbdVol, err)
+
+			return nil, util.GRPCError(err)
+		}
+	}
+
 	// resize volume if required
 	if rbdVol.VolSize < volSize {
 		log.DebugLog(ctx, "rbd volume %s size is %v,resizing to %v", rbdVol, rbdVol.VolSize, volSize)
+		err = rbdVol.prepareThickProvisionResize()
+		if err != nil {
+			log.ErrorLog(ctx, "failed to prepare allocation of rbd image: %s with error: %v", rbdVol, err)
+
+			return nil, util.GRPCError(err)
+		}
+
 		err = rbdVol.resize(volSize)
 		if err != nil {
 			log.ErrorLog(ctx, "failed to resize rbd image: %s with error: %v", rbdVol, err)
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
+		}
+
+		if sErr := rbdVol.updateVolumeSize(ctx, cr); sErr != nil {
+			// the volume is resized, only the quota accounting is off
+			log.WarningLog(ctx, "failed to store size of rbd image %s in the journal: %v", rbdVol, sErr)
 		}
 	}
 
+	// allocate the new extents of thick-provisioned images
+	err = rbdVol.resumeThickProvision(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to allocate rbd image: %s with error: %v", rbdVol, err)
+
+		return nil, util.GRPCError(err)
+	}
+
+	// re-apply the QoS limits, they may depend on the size of the volume
+	err = rbdVol.updateQoS(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to update QoS of rbd image: %s with error: %v", rbdVol, err)
+
+		return nil, util.GRPCError(err)
+	}
+
 	return &csi.ControllerExpandVolumeResponse{
 		CapacityBytes:         rbdVol.VolSize,
 		NodeExpansionRequired: nodeExpansion,
@@ -16,7 +16,11 @@ limitations under the License.
 
 package rbd
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
 
 func TestValidateStriping(t *testing.T) {
 	t.Parallel()
@@ -70,6 +74,30 @@ func TestValidateStriping(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "when stripeCount is 0",
+			parameters: map[string]string{
+				"stripeUnit":  "4096",
+				"stripeCount": "0",
+			},
+			wantErr: true,
+		},
+		{
+			name: "when stripeUnit is not a factor of objectSize",
+			parameters: map[string]string{
+				"stripeUnit":  "12288",
+				"stripeCount": "8",
+				"objectSize":  "4194304",
+			},
+			wantErr: true,
+		},
+		{
+			name: "when objectSize is too large",
+			parameters: map[string]string{
+				"objectSize": "67108864",
+			},
+			wantErr: true,
+		},
 		{
 			name:       "when no stripe parameters are specified",
 			parameters: map[string]string{},
@@ -85,3 +113,85 @@ func TestValidateStriping(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateVolumeCapability(t *testing.T) {
+	t.Parallel()
+	block := &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+	mount := func(flags ...string) *csi.VolumeCapability_Mount {
+		return &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{MountFlags: flags}}
+	}
+	capability := func(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability_AccessMode {
+		return &csi.VolumeCapability_AccessMode{Mode: mode}
+	}
+	tests := []struct {
+		name    string
+		vc      *csi.VolumeCapability
+		wantErr bool
+	}{
+		{
+			name: "empty access mode",
+			vc: &csi.VolumeCapability{
+				AccessType: mount(),
+				AccessMode: capability(csi.VolumeCapability_AccessMode_UNKNOWN),
+			},
+			wantErr: true,
+		},
+		{
+			name: "single node writer filesystem",
+			vc: &csi.VolumeCapability{
+				AccessType: mount(),
+				AccessMode: capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			},
+			wantErr: false,
+		},
+		{
+			name: "multi node multi writer block",
+			vc: &csi.VolumeCapability{
+				AccessType: block,
+				AccessMode: capability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER),
+			},
+			wantErr: false,
+		},
+		{
+			name: "multi node multi writer filesystem",
+			vc: &csi.VolumeCapability{
+				AccessType: mount(),
+				AccessMode: capability(csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER),
+			},
+			wantErr: true,
+		},
+		{
+			name: "multi node reader only filesystem",
+			vc: &csi.VolumeCapability{
+				AccessType: mount(),
+				AccessMode: capability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			},
+			wantErr: false,
+		},
+		{
+			name: "multi node reader only block",
+			vc: &csi.VolumeCapability{
+				AccessType: block,
+				AccessMode: capability(csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY),
+			},
+			wantErr: false,
+		},
+		{
+			name: "single node reader only with rw mount option",
+			vc: &csi.VolumeCapability{
+				AccessType: mount("rw"),
+				AccessMode: capability(csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if err := validateVolumeCapability(ts.vc); (err != nil) != ts.wantErr {
+				t.Errorf("validateVolumeCapability() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+const (
+	// copyParallelismParam is the StorageClass parameter with the number of
+	// extents that are copied at the same time, when the data of a volume
+	// is copied instead of cloned.
+	copyParallelismParam = "copyParallelism"
+	// copyVerifyParam is the StorageClass parameter that enables reading
+	// back the copied extents and comparing their checksums.
+	copyVerifyParam = "copyVerify"
+
+	defaultCopyParallelism = 4
+	maxCopyParallelism     = 32
+
+	// copyReadSize is the maximum number of bytes that is copied at once
+	// between images.
+	copyReadSize = 4 * 1024 * 1024
+
+	// copyProgressAttribute is the attribute in the journal with the
+	// progress of the copy, as "<offset>/<size>". All data of the source
+	// before the offset has been copied.
+	copyProgressAttribute = "copy-progress"
+	// copyProgressInterval is the number of bytes the progress needs to
+	// advance before it is stored in the journal again.
+	copyProgressInterval = 256 * 1024 * 1024
+)
+
+// castagnoli is the table of the CRC-32C checksums of the copied extents.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// imageExtent is a range of an image that contains data.
+type imageExtent struct {
+	offset uint64
+	length uint64
+}
+
+// copyTarget is the image the data is copied to, it is read again to verify
+// the checksums.
+type copyTarget interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// copyEngine copies extents from the source to the target image with
+// parallel workers.
+type copyEngine struct {
+	src         io.ReaderAt
+	dst         copyTarget
+	parallelism int
+	verify      bool
+	// storeProgress is called with the offset before which all data has
+	// been copied.
+	storeProgress func(offset uint64) error
+}
+
+// parseCopyOptions returns the parallelism of copies and whether copied data
+// is verified.
+func parseCopyOptions(volOptions map[string]string) (int, bool, error) {
+	parallelism := defaultCopyParallelism
+	if val, ok := volOptions[copyParallelismParam]; ok {
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to parse %s %q: %w", copyParallelismParam, val, err)
+		}
+		if n < 1 || n > maxCopyParallelism {
+			return 0, false, fmt.Errorf("%s %q needs to be between 1 and %d",
+				copyParallelismParam, val, maxCopyParallelism)
+		}
+		parallelism = n
+	}
+
+	verify := false
+	if val, ok := volOptions[copyVerifyParam]; ok {
+		var err error
+		verify, err = strconv.ParseBool(val)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to parse %s %q: %w", copyVerifyParam, val, err)
+		}
+	}
+
+	return parallelism, verify, nil
+}
+
+// formatCopyProgress returns the value of the copy progress in the journal.
+func formatCopyProgress(offset, size uint64) string {
+	return fmt.Sprintf("%d/%d", offset, size)
+}
+
+// parseCopyProgress parses the copy progress from the journal.
+func parseCopyProgress(progress string) (uint64, uint64, error) {
+	offsetValue, sizeValue, found := strings.Cut(progress, "/")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid copy progress %q", progress)
+	}
+
+	offset, err := strconv.ParseUint(offsetValue, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid copy progress %q: %w", progress, err)
+	}
+
+	size, err := strconv.ParseUint(sizeValue, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid copy progress %q: %w", progress, err)
+	}
+
+	if offset > size {
+		return 0, 0, fmt.Errorf("invalid copy progress %q: offset beyond size", progress)
+	}
+
+	return offset, size, nil
+}
+
+// appendExtent splits the extent in parts of at most copyReadSize and adds
+// the parts that end after the resume offset.
+func appendExtent(extents []imageExtent, offset, length, resume uint64) []imageExtent {
+	for length > 0 {
+		n := min(length, copyReadSize)
+		if offset+n > resume {
+			extents = append(extents, imageExtent{offset: offset, length: n})
+		}
+		offset += n
+		length -= n
+	}
+
+	return extents
+}
+
+// copy copies the extents, which need to be sorted by their offset. The
+// progress is stored when it advanced by copyProgressInterval, and when all
+// extents have been copied.
+func (e *copyEngine) copy(ctx context.Context, extents []imageExtent, size uint64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	work := make(chan int)
+	results := make(chan copyResult)
+
+	var wg sync.WaitGroup
+	for range max(e.parallelism, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.worker(ctx, extents, work, results)
+		}()
+	}
+
+	go func() {
+		defer close(work)
+		for i := range extents {
+			select {
+			case work <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var (
+		copyErr  error
+		done     = make([]bool, len(extents))
+		next     = 0
+		progress = uint64(0)
+		stored   = uint64(0)
+	)
+	for res := range results {
+		if res.err != nil {
+			if copyErr == nil {
+				copyErr = res.err
+				cancel()
+			}
+
+			continue
+		}
+
+		done[res.index] = true
+		for next < len(extents) && done[next] {
+			next++
+		}
+		if next < len(extents) {
+			progress = extents[next].offset
+		} else {
+			progress = size
+		}
+
+		if copyErr == nil && progress-stored >= copyProgressInterval {
+			copyErr = e.storeProgress(progress)
+			if copyErr != nil {
+				cancel()
+			}
+			stored = progress
+		}
+	}
+
+	if copyErr != nil {
+		return copyErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return e.storeProgress(size)
+}
+
+// copyResult is the result of copying the extent with the index.
+type copyResult struct {
+	index int
+	err   error
+}
+
+// worker copies the extents with the indexes it receives, until the channel
+// is closed.
+func (e *copyEngine) worker(ctx context.Context, extents []imageExtent, work <-chan int, results chan<- copyResult) {
+	buf := make([]byte, copyReadSize)
+	var verifyBuf []byte
+	if e.verify {
+		verifyBuf = make([]byte, copyReadSize)
+	}
+
+	for i := range work {
+		err := ctx.Err()
+		if err == nil {
+			err = e.copyExtent(extents[i], buf, verifyBuf)
+		}
+		results <- copyResult{index: i, err: err}
+	}
+}
+
+// copyExtent copies the extent from the source to the target image. The
+// checksum of the data is compared with the data in the target image, when
+// verifyBuf is set.
+func (e *copyEngine) copyExtent(extent imageExtent, buf, verifyBuf []byte) error {
+	data := buf[:extent.length]
+	read, err := e.src.ReadAt(data, int64(extent.offset))
+	if err != nil && !(errors.Is(err, io.EOF) && read > 0) {
+		return fmt.Errorf("failed to read %d bytes at offset %d: %w", extent.length, extent.offset, err)
+	}
+	data = data[:read]
+
+	_, err = e.dst.WriteAt(data, int64(extent.offset))
+	if err != nil {
+		return fmt.Errorf("failed to write %d bytes at offset %d: %w", read, extent.offset, err)
+	}
+
+	if verifyBuf == nil {
+		return nil
+	}
+
+	written := verifyBuf[:read]
+	_, err = e.dst.ReadAt(written, int64(extent.offset))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read back %d bytes at offset %d: %w", read, extent.offset, err)
+	}
+	if crc32.Checksum(data, castagnoli) != crc32.Checksum(written, castagnoli) {
+		return fmt.Errorf("%w: %d bytes at offset %d", ErrChecksumMismatch, read, extent.offset)
+	}
+
+	return nil
+}
+
+// copyImageData writes the allocated extents of the snapshot of the source
+// image, including the data of its parents, to the image of the volume. The
+// progress is stored in the journal of the volume. When resume is set, the
+// copy continues after the progress that was stored before.
+func (rv *rbdVolume) copyImageData(ctx context.Context, source *rbdVolume, snapName string, resume bool) error {
+	err := source.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	srcImage, err := librbd.OpenImageReadOnly(source.ioctx, source.RbdImageName, snapName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			err = fmt.Errorf("%w: %w", ErrSnapNotFound, err)
+		}
+
+		return err
+	}
+	defer srcImage.Close()
+
+	dstImage, err := rv.open()
+	if err != nil {
+		return err
+	}
+	defer dstImage.Close()
+
+	size, err := srcImage.GetSize()
+	if err != nil {
+		return err
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, rv.conn.Creds)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	start := uint64(0)
+	if resume {
+		progress, fErr := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, copyProgressAttribute)
+		if fErr == nil && progress != "" {
+			offset, progressSize, pErr := parseCopyProgress(progress)
+			switch {
+			case pErr != nil:
+				log.WarningLog(ctx, "ignoring copy progress of volume %s: %v", rv, pErr)
+			case progressSize == size:
+				start = offset
+			}
+		}
+	}
+
+	var extents []imageExtent
+	err = srcImage.DiffIterate(librbd.DiffIterateConfig{
+		Offset:        start,
+		Length:        size - start,
+		IncludeParent: librbd.IncludeParent,
+		WholeObject:   librbd.DisableWholeObject,
+		Callback: func(offset, length uint64, exists int, _ interface{}) int {
+			if exists == 0 {
+				// the new image does not contain data at the offset
+				return 0
+			}
+			extents = appendExtent(extents, offset, length, start)
+
+			return 0
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the extents of %q: %w", source, err)
+	}
+
+	log.DebugLog(ctx, "copying %d extents of %s from offset %d to %s with %d workers",
+		len(extents), source, start, rv, rv.CopyParallelism)
+
+	engine := &copyEngine{
+		src:         srcImage,
+		dst:         dstImage,
+		parallelism: rv.CopyParallelism,
+		verify:      rv.CopyVerify,
+		storeProgress: func(offset uint64) error {
+			log.DebugLog(ctx, "copied %d of %d bytes of %s to %s", offset, size, source, rv)
+
+			return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, copyProgressAttribute,
+				formatCopyProgress(offset, size))
+		},
+	}
+
+	return engine.copy(ctx, extents, size)
+}
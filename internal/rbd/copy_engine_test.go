@@ -0,0 +1,186 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memImage is an image in memory. When corrupt is set, the first byte of
+// every write is changed.
+type memImage struct {
+	mutex   sync.Mutex
+	data    []byte
+	corrupt bool
+}
+
+func (m *memImage) ReadAt(p []byte, off int64) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return copy(p, m.data[off:]), nil
+}
+
+func (m *memImage) WriteAt(p []byte, off int64) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	n := copy(m.data[off:], p)
+	if m.corrupt && n > 0 {
+		m.data[off]++
+	}
+
+	return n, nil
+}
+
+func TestParseCopyOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		options         map[string]string
+		wantParallelism int
+		wantVerify      bool
+		wantErr         bool
+	}{
+		{
+			name:            "defaults",
+			options:         map[string]string{},
+			wantParallelism: defaultCopyParallelism,
+		},
+		{
+			name:            "parallelism and verify",
+			options:         map[string]string{copyParallelismParam: "16", copyVerifyParam: "true"},
+			wantParallelism: 16,
+			wantVerify:      true,
+		},
+		{
+			name:    "zero parallelism",
+			options: map[string]string{copyParallelismParam: "0"},
+			wantErr: true,
+		},
+		{
+			name:    "too many workers",
+			options: map[string]string{copyParallelismParam: "33"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid verify",
+			options: map[string]string{copyVerifyParam: "sometimes"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			parallelism, verify, err := parseCopyOptions(tt.options)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantParallelism, parallelism)
+			require.Equal(t, tt.wantVerify, verify)
+		})
+	}
+}
+
+func TestParseCopyProgress(t *testing.T) {
+	t.Parallel()
+
+	offset, size, err := parseCopyProgress(formatCopyProgress(4096, 8192))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), offset)
+	require.Equal(t, uint64(8192), size)
+
+	for _, progress := range []string{"", "4096", "a/8192", "4096/b", "8192/4096"} {
+		_, _, err = parseCopyProgress(progress)
+		require.Error(t, err, progress)
+	}
+}
+
+func TestAppendExtent(t *testing.T) {
+	t.Parallel()
+
+	extents := appendExtent(nil, 0, 2*copyReadSize+10, 0)
+	require.Equal(t, []imageExtent{
+		{offset: 0, length: copyReadSize},
+		{offset: copyReadSize, length: copyReadSize},
+		{offset: 2 * copyReadSize, length: 10},
+	}, extents)
+
+	// the parts before the resume offset are skipped
+	extents = appendExtent(nil, 0, 2*copyReadSize+10, copyReadSize)
+	require.Equal(t, []imageExtent{
+		{offset: copyReadSize, length: copyReadSize},
+		{offset: 2 * copyReadSize, length: 10},
+	}, extents)
+}
+
+func TestCopyEngine(t *testing.T) {
+	t.Parallel()
+
+	size := uint64(3*copyReadSize + 512)
+	src := make([]byte, size)
+	for i := range src {
+		src[i] = byte(i % 251)
+	}
+
+	// the second part of the image is not allocated
+	var extents []imageExtent
+	extents = appendExtent(extents, 0, copyReadSize, 0)
+	extents = appendExtent(extents, 2*copyReadSize, copyReadSize+512, 0)
+
+	dst := &memImage{data: make([]byte, size)}
+	var progress []uint64
+	engine := &copyEngine{
+		src:         bytes.NewReader(src),
+		dst:         dst,
+		parallelism: 3,
+		verify:      true,
+		storeProgress: func(offset uint64) error {
+			progress = append(progress, offset)
+
+			return nil
+		},
+	}
+
+	err := engine.copy(context.Background(), extents, size)
+	require.NoError(t, err)
+	require.Equal(t, src[:copyReadSize], dst.data[:copyReadSize])
+	require.Equal(t, make([]byte, copyReadSize), dst.data[copyReadSize:2*copyReadSize])
+	require.Equal(t, src[2*copyReadSize:], dst.data[2*copyReadSize:])
+	require.Equal(t, []uint64{size}, progress)
+
+	// corrupted writes are detected by the checksums
+	engine.dst = &memImage{data: make([]byte, size), corrupt: true}
+	progress = nil
+	err = engine.copy(context.Background(), extents, size)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+	require.Empty(t, progress)
+
+	// without verification the copy succeeds
+	engine.verify = false
+	err = engine.copy(context.Background(), extents, size)
+	require.NoError(t, err)
+}
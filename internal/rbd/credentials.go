@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// getConfiguredSecrets returns the secrets with the credentials of the type
+// that are configured for the cluster, or the secrets of the request when
+// there are none.
+func getConfiguredSecrets(
+	clusterID string,
+	credType util.CredentialsType,
+	secrets map[string]string,
+) (map[string]string, error) {
+	secrets, err := util.GetConfiguredSecrets(util.CsiConfigFile, clusterID, credType, secrets)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return secrets, nil
+}
+
+// getProvisionerSecrets returns the secrets for the operations of the
+// controller.
+func getProvisionerSecrets(clusterID string, secrets map[string]string) (map[string]string, error) {
+	return getConfiguredSecrets(clusterID, util.ProvisionerCredentials, secrets)
+}
+
+// getNodeStageSecrets returns the secrets to stage a volume. The clusterID of
+// static volumes is part of the volume context.
+func getNodeStageSecrets(
+	volID string,
+	volContext, secrets map[string]string,
+) (map[string]string, error) {
+	clusterID := volContext["clusterID"]
+	if clusterID == "" {
+		clusterID = util.GetClusterIDFromVolumeID(volID)
+	}
+
+	return getConfiguredSecrets(clusterID, util.NodeStageCredentials, secrets)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// rbdHeaderPrefix is the prefix of the RADOS object that contains the
+	// header of an image, followed by the ID of the image.
+	rbdHeaderPrefix = "rbd_header."
+	// dataPoolIDKey is the key in the omap of the image header that
+	// contains the ID of the data pool of the image.
+	dataPoolIDKey = "data_pool_id"
+)
+
+// getDataPool returns the name of the data pool of the image with the id, or
+// an empty string when the data is stored in the pool of the image. go-ceph
+// does not provide rbd_get_data_pool_id(), the ID of the data pool is read
+// from the header of the image instead.
+func (ri *rbdImage) getDataPool(id string) (string, error) {
+	err := ri.openIoctx()
+	if err != nil {
+		return "", err
+	}
+
+	values, err := ri.ioctx.GetOmapValues(rbdHeaderPrefix+id, "", dataPoolIDKey, 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the data pool of image %s: %w", ri, err)
+	}
+
+	value, ok := values[dataPoolIDKey]
+	if !ok {
+		return "", nil
+	}
+
+	poolID, err := decodeDataPoolID(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the data pool of image %s: %w", ri, err)
+	}
+	if poolID < 0 {
+		return "", nil
+	}
+
+	return ri.conn.GetPoolName(poolID)
+}
+
+// decodeDataPoolID decodes the ID of the data pool from the image header,
+// where it is stored as a little-endian int64. -1 means there is no data
+// pool.
+func decodeDataPoolID(value []byte) (int64, error) {
+	if len(value) != 8 {
+		return 0, fmt.Errorf("invalid length %d of the data pool ID", len(value))
+	}
+
+	//nolint:gosec // the value was encoded from an int64
+	return int64(binary.LittleEndian.Uint64(value)), nil
+}
+
+// inheritDataPool uses the data pool of the snapshot or volume that a new
+// volume is created from, when the StorageClass does not set a data pool. The
+// data of volumes that are restored or cloned from an image with an erasure
+// coded data pool is then stored in that data pool too. Volumes that are
+// created in another pool or cluster than their source do not inherit the
+// data pool, the StorageClass selects different storage for them.
+func (rv *rbdVolume) inheritDataPool(parentVol *rbdVolume, rbdSnap *rbdSnapshot) {
+	if rv.DataPool != "" {
+		return
+	}
+
+	source := &rbdImage{}
+	switch {
+	case rbdSnap != nil:
+		source = &rbdSnap.rbdImage
+	case parentVol != nil:
+		source = &parentVol.rbdImage
+	}
+
+	if source.ClusterID == rv.ClusterID && source.Pool == rv.Pool {
+		rv.DataPool = source.DataPool
+	}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeDataPoolID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		value   []byte
+		want    int64
+		wantErr bool
+	}{
+		{"pool 5", []byte{5, 0, 0, 0, 0, 0, 0, 0}, 5, false},
+		{"pool 258", []byte{2, 1, 0, 0, 0, 0, 0, 0}, 258, false},
+		{"no data pool", []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1, false},
+		{"too short", []byte{5, 0, 0, 0}, 0, true},
+		{"empty", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := decodeDataPoolID(tt.value)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestInheritDataPool(t *testing.T) {
+	t.Parallel()
+
+	ecVol := &rbdVolume{rbdImage: rbdImage{ClusterID: "cluster-1", Pool: "pool", DataPool: "ec-pool"}}
+	ecSnap := &rbdSnapshot{rbdImage: rbdImage{ClusterID: "cluster-1", Pool: "pool", DataPool: "ec-snap-pool"}}
+	otherPoolVol := &rbdVolume{rbdImage: rbdImage{ClusterID: "cluster-1", Pool: "archive", DataPool: "ec-pool"}}
+	otherClusterVol := &rbdVolume{rbdImage: rbdImage{ClusterID: "cluster-2", Pool: "pool", DataPool: "ec-pool"}}
+
+	tests := []struct {
+		name      string
+		dataPool  string
+		parentVol *rbdVolume
+		rbdSnap   *rbdSnapshot
+		want      string
+	}{
+		{"new volume", "", nil, nil, ""},
+		{"restore from snapshot", "", nil, ecSnap, "ec-snap-pool"},
+		{"clone from volume", "", ecVol, nil, "ec-pool"},
+		{"data pool of the StorageClass", "sc-pool", ecVol, nil, "sc-pool"},
+		{"clone from another pool", "", otherPoolVol, nil, ""},
+		{"clone from another cluster", "", otherClusterVol, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rv := &rbdVolume{rbdImage: rbdImage{ClusterID: "cluster-1", Pool: "pool", DataPool: tt.dataPool}}
+			rv.inheritDataPool(tt.parentVol, tt.rbdSnap)
+			require.Equal(t, tt.want, rv.DataPool)
+		})
+	}
+}
@@ -0,0 +1,261 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// kernelLogPath is the device that the records of the kernel log are
+	// read from.
+	kernelLogPath = "/dev/kmsg"
+
+	// deviceErrorWindow is the time that a volume is reported as abnormal
+	// after an error of its device was logged.
+	deviceErrorWindow = 10 * time.Minute
+
+	deviceErrorIO         = "io"
+	deviceErrorDisconnect = "disconnect"
+	deviceErrorTimeout    = "timeout"
+)
+
+// deviceErrorPatterns match the kernel log messages of errors of krbd and
+// rbd-nbd devices, the first submatch is the name of the device.
+var deviceErrorPatterns = []struct {
+	re   *regexp.Regexp
+	kind string
+}{
+	{re: regexp.MustCompile(`I/O error, dev ((?:rbd|nbd)\d+)`), kind: deviceErrorIO},
+	{re: regexp.MustCompile(`block (nbd\d+): Connection timed out`), kind: deviceErrorTimeout},
+	{re: regexp.MustCompile(`block (nbd\d+): (?:Dead connection|Receive control failed)`), kind: deviceErrorDisconnect},
+	{re: regexp.MustCompile(`rbd: (rbd\d+): encountered watch error`), kind: deviceErrorDisconnect},
+	{re: regexp.MustCompile(`rbd: (rbd\d+): .* result -\d+`), kind: deviceErrorIO},
+}
+
+// deviceError is the last error of a device in the kernel log.
+type deviceError struct {
+	kind    string
+	message string
+	time    time.Time
+}
+
+// deviceErrorTracker records the errors of the krbd and rbd-nbd devices that
+// are logged by the kernel.
+type deviceErrorTracker struct {
+	mutex  sync.Mutex
+	errors map[string]deviceError
+	now    func() time.Time
+}
+
+// deviceErrors contains the device errors of the node, they are recorded
+// once StartDeviceErrorWatcher is called.
+var deviceErrors = newDeviceErrorTracker(time.Now)
+
+func newDeviceErrorTracker(now func() time.Time) *deviceErrorTracker {
+	return &deviceErrorTracker{
+		errors: make(map[string]deviceError),
+		now:    now,
+	}
+}
+
+// parseKernelLogRecord returns the message of a record of /dev/kmsg, which
+// has the format "<priority>,<sequence>,<timestamp>,<flags>;<message>".
+// Continuation lines with the properties of the record are skipped.
+func parseKernelLogRecord(record string) (string, bool) {
+	if strings.HasPrefix(record, " ") {
+		return "", false
+	}
+
+	_, message, found := strings.Cut(record, ";")
+	if !found {
+		return "", false
+	}
+
+	return strings.TrimSpace(message), true
+}
+
+// classifyDeviceError returns the device and the kind of the error, when the
+// message is about an error of a krbd or rbd-nbd device.
+func classifyDeviceError(message string) (string, string, bool) {
+	for _, p := range deviceErrorPatterns {
+		m := p.re.FindStringSubmatch(message)
+		if m != nil {
+			return m[1], p.kind, true
+		}
+	}
+
+	return "", "", false
+}
+
+// deviceType returns the type of the device, like it is used for the
+// mapOptions.
+func deviceType(device string) string {
+	if strings.HasPrefix(device, "nbd") {
+		return accessTypeNbd
+	}
+
+	return accessTypeKRbd
+}
+
+// record counts the error of the kernel log message, when it is about a
+// krbd or rbd-nbd device.
+func (t *deviceErrorTracker) record(ctx context.Context, message string) {
+	device, kind, ok := classifyDeviceError(message)
+	if !ok {
+		return
+	}
+
+	log.WarningLog(ctx, "kernel reported %s error of device %s: %s", kind, device, message)
+	metrics.CountDeviceError(deviceType(device), device, kind)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.errors[device] = deviceError{kind: kind, message: message, time: t.now()}
+}
+
+// lastError returns the last error of the device, when it was logged within
+// the deviceErrorWindow.
+func (t *deviceErrorTracker) lastError(device string) (deviceError, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	devErr, ok := t.errors[device]
+	if !ok {
+		return deviceError{}, false
+	}
+
+	if t.now().Sub(devErr.time) > deviceErrorWindow {
+		delete(t.errors, device)
+
+		return deviceError{}, false
+	}
+
+	return devErr, true
+}
+
+// watch records the device errors of the records that are read from the
+// kernel log, until reading fails.
+func (t *deviceErrorTracker) watch(ctx context.Context, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for {
+		record, err := reader.ReadString('\n')
+		switch {
+		case errors.Is(err, syscall.EPIPE):
+			// records were overwritten before they were read, continue
+			// with the next record
+			continue
+		case err != nil:
+			return err
+		}
+
+		if message, ok := parseKernelLogRecord(record); ok {
+			t.record(ctx, message)
+		}
+	}
+}
+
+// StartDeviceErrorWatcher reads the kernel log of the node in the
+// background, and counts the errors of the krbd and rbd-nbd devices. A volume
+// is reported as abnormal by NodeGetVolumeStats after an error of its device.
+func StartDeviceErrorWatcher(ctx context.Context) error {
+	kmsg, err := os.Open(kernelLogPath)
+	if err != nil {
+		return fmt.Errorf("failed to open kernel log %q: %w", kernelLogPath, err)
+	}
+
+	// skip the records that were logged before the nodeplugin started
+	_, err = kmsg.Seek(0, io.SeekEnd)
+	if err != nil {
+		kmsg.Close() //nolint:errcheck // read-only, nothing to flush
+
+		return fmt.Errorf("failed to seek to the end of kernel log %q: %w", kernelLogPath, err)
+	}
+
+	go func() {
+		defer kmsg.Close() //nolint:errcheck // read-only, nothing to flush
+
+		err := deviceErrors.watch(ctx, kmsg)
+		log.ErrorLog(ctx, "stopped reading kernel log %q: %v", kernelLogPath, err)
+	}()
+
+	return nil
+}
+
+// blockDeviceName returns the name of the block device of the path, the
+// device itself for a block volume, or the device that the filesystem is
+// mounted from.
+func blockDeviceName(path string) (string, error) {
+	var st unix.Stat_t
+	err := unix.Stat(path, &st)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %q: %w", path, err)
+	}
+
+	dev := st.Dev
+	if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+		dev = st.Rdev
+	}
+
+	link := fmt.Sprintf("/sys/dev/block/%d:%d", unix.Major(dev), unix.Minor(dev))
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the device of %q: %w", path, err)
+	}
+
+	return filepath.Base(target), nil
+}
+
+// deviceErrorCondition returns an abnormal condition when the kernel logged
+// an error of the device of the volume recently, nil otherwise.
+func deviceErrorCondition(ctx context.Context, targetPath string) *csi.VolumeCondition {
+	device, err := blockDeviceName(targetPath)
+	if err != nil {
+		log.DebugLog(ctx, "not checking device errors of %q: %v", targetPath, err)
+
+		return nil
+	}
+
+	devErr, ok := deviceErrors.lastError(device)
+	if !ok {
+		return nil
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: true,
+		Message: fmt.Sprintf("%s error of device %s at %s: %s",
+			devErr.kind, device, devErr.time.Format(time.RFC3339), devErr.message),
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKernelLogRecord(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		record  string
+		message string
+		ok      bool
+	}{
+		{
+			name:    "record",
+			record:  "3,1234,5678901,-;I/O error, dev nbd0, sector 2048 op 0x1:(WRITE)\n",
+			message: "I/O error, dev nbd0, sector 2048 op 0x1:(WRITE)",
+			ok:      true,
+		},
+		{
+			name:   "continuation line",
+			record: " SUBSYSTEM=block\n",
+			ok:     false,
+		},
+		{
+			name:   "no message",
+			record: "garbage\n",
+			ok:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			message, ok := parseKernelLogRecord(tt.record)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.message, message)
+		})
+	}
+}
+
+func TestClassifyDeviceError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		message string
+		device  string
+		kind    string
+		ok      bool
+	}{
+		{
+			message: "I/O error, dev rbd3, sector 0 op 0x0:(READ) flags 0x0 phys_seg 1 prio class 2",
+			device:  "rbd3",
+			kind:    deviceErrorIO,
+			ok:      true,
+		},
+		{
+			message: "block nbd1: Connection timed out",
+			device:  "nbd1",
+			kind:    deviceErrorTimeout,
+			ok:      true,
+		},
+		{
+			message: "block nbd1: Dead connection, failed to find a fallback",
+			device:  "nbd1",
+			kind:    deviceErrorDisconnect,
+			ok:      true,
+		},
+		{
+			message: "rbd: rbd0: encountered watch error: -107",
+			device:  "rbd0",
+			kind:    deviceErrorDisconnect,
+			ok:      true,
+		},
+		{
+			message: "rbd: rbd0: write at objno 12 0~4096 result -108",
+			device:  "rbd0",
+			kind:    deviceErrorIO,
+			ok:      true,
+		},
+		{
+			message: "I/O error, dev sda, sector 0 op 0x0:(READ)",
+			ok:      false,
+		},
+		{
+			message: "block nbd0: shutting down sockets",
+			ok:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.message, func(t *testing.T) {
+			t.Parallel()
+			device, kind, ok := classifyDeviceError(tt.message)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.device, device)
+			require.Equal(t, tt.kind, kind)
+		})
+	}
+}
+
+func TestDeviceErrorTracker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tracker := newDeviceErrorTracker(func() time.Time { return now })
+
+	kmsg := strings.NewReader("6,100,1000,-;nbd: registered device at major 43\n" +
+		"3,101,2000,-;block nbd0: Connection timed out\n" +
+		" SUBSYSTEM=block\n" +
+		"3,102,3000,-;I/O error, dev rbd1, sector 8 op 0x1:(WRITE)\n")
+	err := tracker.watch(context.TODO(), kmsg)
+	require.ErrorIs(t, err, io.EOF)
+
+	devErr, ok := tracker.lastError("nbd0")
+	require.True(t, ok)
+	require.Equal(t, deviceErrorTimeout, devErr.kind)
+	require.Equal(t, "block nbd0: Connection timed out", devErr.message)
+
+	devErr, ok = tracker.lastError("rbd1")
+	require.True(t, ok)
+	require.Equal(t, deviceErrorIO, devErr.kind)
+
+	_, ok = tracker.lastError("rbd0")
+	require.False(t, ok)
+
+	// errors are not reported after the deviceErrorWindow
+	now = now.Add(deviceErrorWindow + time.Second)
+	_, ok = tracker.lastError("nbd0")
+	require.False(t, ok)
+}
@@ -17,15 +17,43 @@ limitations under the License.
 package rbd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
+	librbd "github.com/ceph/go-ceph/rbd"
 )
 
+// volumeUsageInterval is the minimal time between two updates of the usage of
+// a volume in the Ceph cluster. Kubelet calls NodeGetVolumeStats every minute,
+// calculating the usage for each call would add load on the cluster.
+const volumeUsageInterval = 5 * time.Minute
+
+// imageUsage contains the consumption of an image in the Ceph cluster.
+type imageUsage struct {
+	// provisioned is the size of the image
+	provisioned uint64
+	// allocated is the number of bytes that are allocated by the image,
+	// without its snapshots and parent
+	allocated uint64
+	// snapshots is the number of snapshots of the image
+	snapshots int
+}
+
 // Sparsify checks the size of the objects in the RBD image and calls
 // rbd_sparify() to free zero-filled blocks and reduce the storage consumption
 // of the image.
 // This function will return ErrImageInUse if the image is in use, since
 // sparsifying an image on which i/o is in progress is not optimal.
-func (ri *rbdImage) Sparsify() error {
+// Sparsifying waits for the limits of the sparsify and background operations
+// of the cluster.
+func (ri *rbdImage) Sparsify(ctx context.Context) error {
 	inUse, err := ri.isInUse()
 	if err != nil {
 		return fmt.Errorf("failed to check if image is in use: %w", err)
@@ -35,6 +63,15 @@ func (ri *rbdImage) Sparsify() error {
 		return ErrImageInUse
 	}
 
+	release, err := util.AcquireOperation(ctx, ri.ClusterID, util.SparsifyOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ri.setManagementOps(ctx, util.SparsifyOperation)
+	defer ri.resetManagementOps(ctx)
+
 	image, err := ri.open()
 	if err != nil {
 		return err
@@ -53,3 +90,171 @@ func (ri *rbdImage) Sparsify() error {
 
 	return nil
 }
+
+// getUsage returns the usage of the image like `rbd du` does. When the
+// fast-diff feature is enabled on the image, the object map is used and no
+// objects need to be listed.
+func (ri *rbdImage) getUsage() (*imageUsage, error) {
+	image, err := ri.open()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get size of image %q: %w", ri, err)
+	}
+
+	usage := &imageUsage{provisioned: size}
+	err = image.DiffIterate(librbd.DiffIterateConfig{
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.ExcludeParent,
+		WholeObject:   librbd.EnableWholeObject,
+		Callback: func(_, length uint64, exists int, _ interface{}) int {
+			if exists != 0 {
+				usage.allocated += length
+			}
+
+			return 0
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocated extents of image %q: %w", ri, err)
+	}
+
+	snaps, err := image.GetSnapshotNames()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of image %q: %w", ri, err)
+	}
+	usage.snapshots = len(snaps)
+
+	return usage, nil
+}
+
+// getSnapshotUsage returns the number of bytes that are allocated by the
+// snapshot of the image, including the data of its parents. It is the amount
+// of data that a full backup of the snapshot needs to transfer. When the
+// fast-diff feature is enabled on the image, the object map is used.
+func (ri *rbdImage) getSnapshotUsage(snapName string) (uint64, error) {
+	err := ri.openIoctx()
+	if err != nil {
+		return 0, err
+	}
+
+	image, err := librbd.OpenImageReadOnly(ri.ioctx, ri.RbdImageName, snapName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			err = fmt.Errorf("%w: %w", ErrImageNotFound, err)
+		}
+
+		return 0, fmt.Errorf("failed to open image %q at snapshot %q: %w", ri, snapName, err)
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of image %q: %w", ri, err)
+	}
+
+	var used uint64
+	err = image.DiffIterate(librbd.DiffIterateConfig{
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.IncludeParent,
+		WholeObject:   librbd.EnableWholeObject,
+		Callback: func(_, length uint64, exists int, _ interface{}) int {
+			if exists != 0 {
+				used += length
+			}
+
+			return 0
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get allocated extents of snapshot %q of image %q: %w", snapName, ri, err)
+	}
+
+	return used, nil
+}
+
+// storeSnapshotUsage calculates the number of bytes that are allocated by
+// the snapshot, and stores it in the metadata of the image of the snapshot.
+// cloneVol is the image of the snapshot.
+func storeSnapshotUsage(ctx context.Context, rbdSnap *rbdSnapshot, cloneVol *rbdVolume) error {
+	if !cloneVol.EnableMetadata {
+		return nil
+	}
+
+	used, err := cloneVol.getSnapshotUsage(rbdSnap.RbdSnapName)
+	if err != nil {
+		return err
+	}
+
+	log.DebugLog(ctx, "snapshot %s allocates %d bytes", rbdSnap, used)
+
+	return cloneVol.SetMetadata(usedBytesKey, strconv.FormatUint(used, 10))
+}
+
+// updateVolumeUsage records the usage of the volume in the Ceph cluster as
+// metrics. NodeGetVolumeStats requests do not contain secrets, the usage is
+// only updated when credentials for NodeStage operations are configured for
+// the cluster in the CSI configuration.
+func (ns *NodeServer) updateVolumeUsage(ctx context.Context, volumeID string) {
+	now := time.Now()
+	if last, ok := ns.volumeUsageUpdated.Load(volumeID); ok {
+		if ts, ok := last.(time.Time); ok && now.Sub(ts) < volumeUsageInterval {
+			return
+		}
+	}
+	ns.volumeUsageUpdated.Store(volumeID, now)
+
+	clusterID := util.GetClusterIDFromVolumeID(volumeID)
+	if clusterID == "" {
+		// static volume, the volume can not be resolved
+		return
+	}
+
+	secrets, err := util.GetConfiguredSecrets(util.CsiConfigFile, clusterID, util.NodeStageCredentials, nil)
+	if err != nil {
+		log.WarningLog(ctx, "failed to get credentials for the usage of volume %q: %v", volumeID, err)
+
+		return
+	}
+	if len(secrets) == 0 {
+		return
+	}
+
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
+	if err != nil {
+		log.WarningLog(ctx, "failed to get credentials for the usage of volume %q: %v", volumeID, err)
+
+		return
+	}
+	defer cr.DeleteCredentials()
+
+	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, secrets)
+	if err != nil {
+		log.WarningLog(ctx, "failed to get volume %q for the usage: %v", volumeID, err)
+
+		return
+	}
+	defer rbdVol.Destroy(ctx)
+
+	usage, err := rbdVol.getUsage()
+	if err != nil {
+		log.WarningLog(ctx, "failed to get usage of volume %q: %v", volumeID, err)
+
+		return
+	}
+
+	metrics.SetVolumeUsage(volumeID, usage.provisioned, usage.allocated, usage.snapshots)
+}
+
+// deleteVolumeUsage removes the usage of the volume, once it is not staged on
+// the node anymore.
+func (ns *NodeServer) deleteVolumeUsage(volumeID string) {
+	ns.volumeUsageUpdated.Delete(volumeID)
+	metrics.DeleteVolumeUsage(volumeID)
+}
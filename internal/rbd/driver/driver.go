@@ -17,6 +17,7 @@ limitations under the License.
 package rbddriver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -24,6 +25,7 @@ import (
 	casrbd "github.com/ceph/ceph-csi/internal/csi-addons/rbd"
 	csiaddons "github.com/ceph/ceph-csi/internal/csi-addons/server"
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
+	hc "github.com/ceph/ceph-csi/internal/health-checker"
 	"github.com/ceph/ceph-csi/internal/rbd"
 	"github.com/ceph/ceph-csi/internal/rbd/features"
 	"github.com/ceph/ceph-csi/internal/util"
@@ -31,6 +33,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/util/log"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Driver contains the default identity,node and controller struct.
@@ -39,6 +42,7 @@ type Driver struct {
 	ids *rbd.IdentityServer
 	ns  *rbd.NodeServer
 	cs  *rbd.ControllerServer
+	sms *rbd.SnapshotMetadataServer
 
 	// cas is the CSIAddonsServer where CSI-Addons services are handled
 	cas *csiaddons.CSIAddonsServer
@@ -60,9 +64,9 @@ func NewIdentityServer(d *csicommon.CSIDriver) *rbd.IdentityServer {
 func NewControllerServer(d *csicommon.CSIDriver) *rbd.ControllerServer {
 	return &rbd.ControllerServer{
 		DefaultControllerServer: csicommon.NewDefaultControllerServer(d),
-		VolumeLocks:             util.NewVolumeLocks(),
-		SnapshotLocks:           util.NewVolumeLocks(),
-		VolumeGroupLocks:        util.NewVolumeLocks(),
+		VolumeLocks:             util.NewNamedVolumeLocks("volume"),
+		SnapshotLocks:           util.NewNamedVolumeLocks("snapshot"),
+		VolumeGroupLocks:        util.NewNamedVolumeLocks("volumegroup"),
 		OperationLocks:          util.NewOperationLock(),
 	}
 }
@@ -76,7 +80,8 @@ func NewNodeServer(
 	cliReadAffinityMapOptions := util.ConstructReadAffinityMapOption(crushLocationMap)
 	ns := rbd.NodeServer{
 		DefaultNodeServer: csicommon.NewDefaultNodeServer(d, t, cliReadAffinityMapOptions, topology, nodeLabels),
-		VolumeLocks:       util.NewVolumeLocks(),
+		VolumeLocks:       util.NewNamedVolumeLocks("node"),
+		HealthChecker:     hc.NewHealthCheckManager(),
 	}
 
 	return &ns
@@ -92,6 +97,9 @@ func (r *Driver) Run(conf *util.Config) {
 		err                                    error
 		nodeLabels, topology, crushLocationMap map[string]string
 	)
+	// load the CSI configuration and reload it when it changes
+	go util.WatchCSIConfig(context.Background(), util.CsiConfigFile)
+
 	// update clone soft and hard limit
 	rbd.SetGlobalInt("rbdHardMaxCloneDepth", conf.RbdHardMaxCloneDepth)
 	rbd.SetGlobalInt("rbdSoftMaxCloneDepth", conf.RbdSoftMaxCloneDepth)
@@ -112,18 +120,27 @@ func (r *Driver) Run(conf *util.Config) {
 			csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
 			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
+			csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+			csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+			csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+			csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+			csi.ControllerServiceCapability_RPC_GET_VOLUME,
+			csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
 		})
 		// We only support the multi-writer option when using block, but it's a supported capability for the plugin in
 		// general
-		// In addition, we want to add the remaining modes like MULTI_NODE_READER_ONLY,
-		// MULTI_NODE_SINGLE_WRITER etc, but need to do some verification of RO modes first
-		// will work those as follow-up features
+		// The reader-only modes map the image read-only on all nodes, without
+		// checking for other watchers.
+		// In addition, we want to add the remaining modes like
+		// MULTI_NODE_SINGLE_WRITER etc, will work those as follow-up features
 		r.cd.AddVolumeCapabilityAccessModes(
 			[]csi.VolumeCapability_AccessMode_Mode{
 				csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER,
 				csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER,
 				csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER,
 				csi.VolumeCapability_AccessMode_SINGLE_NODE_MULTI_WRITER,
+				csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY,
+				csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY,
 			})
 
 		// GroupSnapGetInfo is used within the VolumeGroupSnapshot implementation
@@ -151,6 +168,13 @@ func (r *Driver) Run(conf *util.Config) {
 		crushLocationMap = util.GetCrushLocationMap(conf.CrushLocationLabels, nodeLabels)
 	}
 
+	if conf.VolumeEvents && k8s.RunsOnKubernetes() {
+		err = k8s.EnableVolumeEvents(conf.DriverName, conf.NodeID)
+		if err != nil {
+			log.FatalLogMsg(err.Error())
+		}
+	}
+
 	// Create GRPC servers
 	r.ids = NewIdentityServer(r.cd)
 
@@ -160,6 +184,10 @@ func (r *Driver) Run(conf *util.Config) {
 			log.FatalLogMsg(err.Error())
 		}
 		r.ns = NewNodeServer(r.cd, conf.Vtype, nodeLabels, topology, crushLocationMap)
+		r.ns.ForceLockBreak = conf.ForceLockBreak
+		if conf.EnableReadAffinity {
+			r.ns.CrushLocationLabels = conf.CrushLocationLabels
+		}
 
 		var attr string
 		attr, err = rbd.GetKrbdSupportedFeatures()
@@ -174,12 +202,31 @@ func (r *Driver) Run(conf *util.Config) {
 		rbd.SetGlobalInt("krbdFeatures", krbdFeatures)
 
 		rbd.SetRbdNbdToolFeatures()
+		rbd.SetMapRate(conf.MapRate)
+
+		r.ns.MaxVolumesPerNode = conf.MaxVolumesPerNode
+		if conf.MaxVolumesPerNode < 0 {
+			// computed after the nbd module is loaded, the nbd devices are
+			// counted too
+			r.ns.MaxVolumesPerNode, err = rbd.MaxVolumesPerNode()
+			if err != nil {
+				log.FatalLogMsg("failed to compute the maximum number of volumes of the node: %v", err)
+			}
+		}
 	}
 
 	if conf.IsControllerServer {
 		r.cs = NewControllerServer(r.cd)
 		r.cs.ClusterName = conf.ClusterName
 		r.cs.SetMetadata = conf.SetMetadata
+		r.cs.ReservationLock = conf.ReservationLock
+
+		go rbd.ValidateRadosNamespaces(context.Background())
+
+		if conf.SnapshotMetadata {
+			r.sms = rbd.NewSnapshotMetadataServer()
+			r.ids.SnapshotMetadata = true
+		}
 	}
 
 	// configure CSI-Addons server and components
@@ -188,6 +235,21 @@ func (r *Driver) Run(conf *util.Config) {
 		log.FatalLogMsg(err.Error())
 	}
 
+	if conf.IsNodeServer {
+		// the rbd-nbd devices need to be available before the staged
+		// volumes are published again
+		// TODO: move the healer to csi-addons
+		err = rbd.RunVolumeHealer(r.ns, conf)
+		if err != nil {
+			log.ErrorLogMsg("healer had failures, err %v\n", err)
+		}
+
+		err = rbd.StartDeviceErrorWatcher(context.Background())
+		if err != nil {
+			log.WarningLogMsg("errors of rbd devices are not reported: %v", err)
+		}
+	}
+
 	s := csicommon.NewNonBlockingGRPCServer()
 	srv := csicommon.Servers{
 		IS: r.ids,
@@ -195,21 +257,28 @@ func (r *Driver) Run(conf *util.Config) {
 		NS: r.ns,
 		GS: r.cs,
 	}
+	if r.sms != nil {
+		srv.SMS = r.sms
+	}
 	s.Start(conf.Endpoint, srv, csicommon.MiddlewareServerOptionConfig{
 		LogSlowOpInterval: conf.LogSlowOpInterval,
+		MaxNodeRPCs:       conf.MaxNodeRPCs,
+		MaxControllerRPCs: conf.MaxControllerRPCs,
+		RPCTimeouts:       conf.RPCTimeouts,
 	})
 
 	r.startProfiling(conf)
 
-	if conf.IsNodeServer {
-		go func() {
-			// TODO: move the healer to csi-addons
-			err := rbd.RunVolumeHealer(r.ns, conf)
-			if err != nil {
-				log.ErrorLogMsg("healer had failures, err %v\n", err)
-			}
-		}()
+	if conf.IsNodeServer && k8s.RunsOnKubernetes() {
+		go rbd.RefreshNodeLabels(context.Background(), r.ns, conf.NodeID)
 	}
+
+	go util.WatchCredentials(context.Background(), util.CsiConfigFile)
+
+	if r.ns != nil {
+		csicommon.OnDrain(r.ns.FlushState)
+	}
+	go csicommon.StopOnSignal(s, conf.DrainTimeout)
 	s.Wait()
 }
 
@@ -240,6 +309,12 @@ func (r *Driver) setupCSIAddonsServer(conf *util.Config) error {
 
 		vgcs := casrbd.NewVolumeGroupServer(conf.InstanceID)
 		r.cas.RegisterService(vgcs)
+
+		vms := casrbd.NewVolumeMigrationServer(r.cs.VolumeLocks)
+		r.cas.RegisterService(vms)
+
+		ses := casrbd.NewSnapshotExportServer(r.cs.SnapshotLocks)
+		r.cas.RegisterService(ses)
 	}
 
 	if conf.IsNodeServer {
@@ -267,8 +342,14 @@ func (r *Driver) setupCSIAddonsServer(conf *util.Config) error {
 // startProfiling checks which profiling options are enabled in the config and
 // starts the required profiling services.
 func (r *Driver) startProfiling(conf *util.Config) {
-	if conf.EnableProfiling {
+	if conf.EnableProfiling || conf.EnableMetrics {
+		if r.ns != nil {
+			// export the health of the block-devices that are checked
+			prometheus.MustRegister(r.ns.HealthChecker)
+		}
 		go util.StartMetricsServer(conf)
+	}
+	if conf.EnableProfiling {
 		log.DebugLogMsg("Registering profiling handler")
 		go util.EnableProfiling()
 	}
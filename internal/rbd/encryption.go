@@ -68,8 +68,8 @@ const (
 	rbdDefaultEncryptionType = util.EncryptionTypeBlock
 
 	// Luks slots.
-	luksSlot0 = "0"
-	luksSlot1 = "1"
+	luksSlot0 = 0
+	luksSlot1 = 1
 )
 
 // checkRbdImageEncrypted verifies if rbd image was encrypted when created.
@@ -541,6 +541,14 @@ func (rv *rbdVolume) RotateEncryptionKey(ctx context.Context) error {
 		return fmt.Errorf("failed to remove the backup key from luksSlot1: %w", err)
 	}
 
-	// Return error accordingly.
+	// Step 6: Only the new key is expected in the header, the rotation
+	// succeeded already, so other keys are only reported
+	slots, err := luks.KeySlots(devicePath)
+	if err != nil {
+		log.WarningLog(ctx, "failed to list the key slots of %q: %v", rv, err)
+	} else if len(slots) != 1 || slots[0] != luksSlot0 {
+		log.WarningLog(ctx, "unexpected key slots %v of %q after key rotation", slots, rv)
+	}
+
 	return nil
 }
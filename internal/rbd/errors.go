@@ -57,4 +57,16 @@ var (
 	ErrInvalidArgument = errors.New("invalid arguments provided")
 	// ErrImageInUse is returned when the image is in use.
 	ErrImageInUse = errors.New("image is in use")
+	// ErrQuotaExceeded is returned when a volume does not fit in the quota of
+	// the RADOS namespace.
+	ErrQuotaExceeded = errors.New("quota of the rados namespace exceeded")
+	// ErrNamespaceNotEmpty is returned when a RADOS namespace that should be
+	// removed still contains images.
+	ErrNamespaceNotEmpty = errors.New("rados namespace is not empty")
+	// ErrShrinkNotSupported is returned when an image would need to be
+	// shrunk to satisfy a request.
+	ErrShrinkNotSupported = errors.New("shrinking an image is not supported")
+	// ErrChecksumMismatch is returned when the data that was copied to an
+	// image differs from the data of the source.
+	ErrChecksumMismatch = errors.New("checksum of the copied data does not match")
 )
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+const (
+	// requestedSizeMetaKey is the image metadata key where the size of the
+	// last expansion of an encrypted volume is recorded. The size is stored
+	// before the image is resized, so that an interrupted expansion is
+	// resumed with the same size.
+	requestedSizeMetaKey = "rbd.csi.ceph.com/requested-size"
+
+	// deviceResizeTimeout is the time NodeExpandVolume waits for the mapped
+	// device to reach the requested size.
+	deviceResizeTimeout = 10 * time.Second
+	// deviceResizePollInterval is the interval to check the size of the
+	// mapped device while waiting for it to be resized.
+	deviceResizePollInterval = 500 * time.Millisecond
+)
+
+// errDeviceNotResized is returned when the mapped device did not reach the
+// requested size before deviceResizeTimeout expired.
+var errDeviceNotResized = errors.New("device has not been resized yet")
+
+// expandTargetSize returns the size the image should be expanded to, which
+// is the larger of volSize and the recorded size of a previous (possibly
+// interrupted) expansion.
+func expandTargetSize(volSize int64, recorded string) (int64, error) {
+	if recorded == "" {
+		return volSize, nil
+	}
+
+	size, err := strconv.ParseInt(recorded, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %q: %w", requestedSizeMetaKey, recorded, err)
+	}
+
+	return max(size, volSize), nil
+}
+
+// validateExpandSize returns ErrShrinkNotSupported when an image of the
+// current size does not satisfy a request for volSize bytes with limitBytes
+// as upper bound (0 when no limit is set). Images are never shrunk, requests
+// for less than the current size are satisfied by the current size.
+func validateExpandSize(current, volSize, limitBytes int64) error {
+	if limitBytes > 0 && current > limitBytes {
+		return fmt.Errorf("%w: image has %d bytes, a size between %d and %d bytes is requested",
+			ErrShrinkNotSupported, current, volSize, limitBytes)
+	}
+
+	return nil
+}
+
+// recordRequestedSize stores the size of the expansion in the image metadata
+// and returns the size the image should be expanded to.
+func (rv *rbdVolume) recordRequestedSize(ctx context.Context, volSize int64) (int64, error) {
+	recorded, err := rv.GetMetadata(requestedSizeMetaKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return 0, fmt.Errorf("failed to get metadata key %q on %q: %w", requestedSizeMetaKey, rv, err)
+	}
+
+	size, err := expandTargetSize(volSize, recorded)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strconv.FormatInt(size, 10)
+	if value == recorded {
+		return size, nil
+	}
+
+	err = rv.SetMetadata(requestedSizeMetaKey, value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set metadata key %q on %q: %w", requestedSizeMetaKey, rv, err)
+	}
+	log.DebugLog(ctx, "recorded requested size %d of encrypted image %s", size, rv)
+
+	return size, nil
+}
+
+// waitForDeviceSize waits until the mapped device has (at least) the
+// requested size. The kernel updates the size of the device once it notices
+// that the image was resized, this may take a moment after the
+// ControllerExpandVolume procedure returned. The size of the device is
+// returned, errDeviceNotResized when it did not reach the requested size.
+// The sizes of the devices of concurrent requests are checked together by
+// nodeExpandBatcher.
+func waitForDeviceSize(ctx context.Context, devicePath string, size uint64) (uint64, error) {
+	log.DebugLog(ctx, "waiting for device %s to be resized to %d bytes", devicePath, size)
+
+	return nodeExpandBatcher.waitForSize(ctx, devicePath, size, deviceResizeTimeout)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxConcurrentFsResizes is the number of filesystems that NodeExpandVolume
+// grows at the same time on a node.
+const maxConcurrentFsResizes = 8
+
+// nodeExpandBatcher coalesces the work of the NodeExpandVolume requests of
+// the node.
+var nodeExpandBatcher = newExpandBatcher(maxConcurrentFsResizes, deviceResizePollInterval, getDeviceSize)
+
+// expandBatcher coalesces the work of concurrent NodeExpandVolume requests.
+// The sizes of all devices that wait to be resized are checked in a single
+// loop, each device once per interval, and the filesystems are grown by a
+// bounded number of workers.
+type expandBatcher struct {
+	// getSize returns the size of a device
+	getSize  func(ctx context.Context, devicePath string) (uint64, error)
+	interval time.Duration
+
+	mu      sync.Mutex
+	waiters map[*sizeWaiter]bool
+	polling bool
+
+	// growSlots has a slot for every filesystem that can be grown at the
+	// same time
+	growSlots chan struct{}
+}
+
+// sizeWaiter is a request that waits for a device to reach a size.
+type sizeWaiter struct {
+	devicePath string
+	size       uint64
+	// lastSize is the size of the device at the last check
+	lastSize uint64
+	done     chan sizeResult
+}
+
+// sizeResult is the size of a device, or the error of checking it.
+type sizeResult struct {
+	size uint64
+	err  error
+}
+
+func newExpandBatcher(
+	workers int,
+	interval time.Duration,
+	getSize func(ctx context.Context, devicePath string) (uint64, error),
+) *expandBatcher {
+	return &expandBatcher{
+		getSize:   getSize,
+		interval:  interval,
+		waiters:   map[*sizeWaiter]bool{},
+		growSlots: make(chan struct{}, workers),
+	}
+}
+
+// waitForSize waits until the device has (at least) the size, and returns
+// the size of the device. errDeviceNotResized is returned when the device
+// did not reach the size before the timeout.
+func (b *expandBatcher) waitForSize(
+	ctx context.Context,
+	devicePath string,
+	size uint64,
+	timeout time.Duration,
+) (uint64, error) {
+	w := &sizeWaiter{
+		devicePath: devicePath,
+		size:       size,
+		done:       make(chan sizeResult, 1),
+	}
+	b.add(w)
+	defer b.remove(w)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-w.done:
+		return r.size, r.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-timer.C:
+		b.mu.Lock()
+		devSize := w.lastSize
+		b.mu.Unlock()
+
+		return devSize, fmt.Errorf("%w: %s has %d bytes, %d bytes requested",
+			errDeviceNotResized, devicePath, devSize, size)
+	}
+}
+
+// add registers the waiter, and starts the loop that checks the devices
+// when it is not running.
+func (b *expandBatcher) add(w *sizeWaiter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.waiters[w] = true
+	if !b.polling {
+		b.polling = true
+		go b.poll()
+	}
+}
+
+// remove unregisters the waiter.
+func (b *expandBatcher) remove(w *sizeWaiter) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.waiters, w)
+}
+
+// devicePaths returns the devices that are waited for, each device once.
+// The loop stops when there is no waiter anymore.
+func (b *expandBatcher) devicePaths() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.waiters) == 0 {
+		b.polling = false
+
+		return nil
+	}
+
+	seen := map[string]bool{}
+	devices := []string{}
+	for w := range b.waiters {
+		if !seen[w.devicePath] {
+			seen[w.devicePath] = true
+			devices = append(devices, w.devicePath)
+		}
+	}
+
+	return devices
+}
+
+// poll checks the sizes of the devices until no request waits anymore.
+func (b *expandBatcher) poll() {
+	for {
+		devices := b.devicePaths()
+		if devices == nil {
+			return
+		}
+
+		sizes := make(map[string]sizeResult, len(devices))
+		for _, devicePath := range devices {
+			size, err := b.getSize(context.Background(), devicePath)
+			sizes[devicePath] = sizeResult{size: size, err: err}
+		}
+
+		b.mu.Lock()
+		for w := range b.waiters {
+			r, ok := sizes[w.devicePath]
+			if !ok {
+				// added after the check, it is checked next time
+				continue
+			}
+			w.lastSize = r.size
+			if r.err != nil || r.size >= w.size {
+				w.done <- r
+				delete(b.waiters, w)
+			}
+		}
+		b.mu.Unlock()
+
+		time.Sleep(b.interval)
+	}
+}
+
+// grow runs the resize of a filesystem when a worker is available.
+func (b *expandBatcher) grow(ctx context.Context, resize func() error) error {
+	select {
+	case b.growSlots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-b.growSlots }()
+
+	return resize()
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDevices returns the sizes of devices, and counts the checks.
+type fakeDevices struct {
+	mu     sync.Mutex
+	sizes  map[string]uint64
+	checks map[string]int
+}
+
+func (fd *fakeDevices) getSize(_ context.Context, devicePath string) (uint64, error) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	fd.checks[devicePath]++
+	size, ok := fd.sizes[devicePath]
+	if !ok {
+		return 0, errors.New("no such device")
+	}
+
+	return size, nil
+}
+
+func (fd *fakeDevices) resize(devicePath string, size uint64) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+
+	fd.sizes[devicePath] = size
+}
+
+func TestExpandBatcherWaitForSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		device     string
+		size       uint64
+		resize     uint64
+		want       uint64
+		wantErr    bool
+		notResized bool
+	}{
+		{
+			name:   "resized",
+			device: "/dev/rbd0",
+			size:   2048,
+			resize: 2048,
+			want:   2048,
+		},
+		{
+			name:       "not resized",
+			device:     "/dev/rbd0",
+			size:       2048,
+			resize:     1024,
+			want:       1024,
+			wantErr:    true,
+			notResized: true,
+		},
+		{
+			name:    "missing device",
+			device:  "/dev/rbd1",
+			size:    2048,
+			resize:  2048,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fd := &fakeDevices{sizes: map[string]uint64{"/dev/rbd0": 1024}, checks: map[string]int{}}
+			b := newExpandBatcher(1, time.Millisecond, fd.getSize)
+			go func() {
+				time.Sleep(5 * time.Millisecond)
+				fd.resize("/dev/rbd0", tt.resize)
+			}()
+
+			got, err := b.waitForSize(context.Background(), tt.device, tt.size, 100*time.Millisecond)
+			if !tt.wantErr {
+				require.NoError(t, err)
+				require.Equal(t, tt.want, got)
+
+				return
+			}
+			require.Error(t, err)
+			if tt.notResized {
+				require.ErrorIs(t, err, errDeviceNotResized)
+				require.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExpandBatcherCoalesce(t *testing.T) {
+	t.Parallel()
+
+	fd := &fakeDevices{sizes: map[string]uint64{"/dev/rbd0": 1024}, checks: map[string]int{}}
+	b := newExpandBatcher(1, 10*time.Millisecond, fd.getSize)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := b.waitForSize(context.Background(), "/dev/rbd0", 2048, time.Second)
+			require.NoError(t, err)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	fd.resize("/dev/rbd0", 2048)
+	wg.Wait()
+
+	// the device is checked once per interval, not once per request
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	require.Less(t, fd.checks["/dev/rbd0"], 20)
+}
+
+func TestExpandBatcherGrow(t *testing.T) {
+	t.Parallel()
+
+	const workers = 2
+	b := newExpandBatcher(workers, time.Millisecond, nil)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.grow(context.Background(), func() error {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+
+				return nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, peak.Load(), int32(workers))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b.growSlots <- struct{}{}
+	b.growSlots <- struct{}{}
+	require.ErrorIs(t, b.grow(ctx, func() error { return nil }), context.Canceled)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandTargetSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		volSize  int64
+		recorded string
+		want     int64
+		wantErr  bool
+	}{
+		{
+			name:    "nothing recorded",
+			volSize: 2048,
+			want:    2048,
+		},
+		{
+			name:     "smaller size recorded",
+			volSize:  2048,
+			recorded: "1024",
+			want:     2048,
+		},
+		{
+			name:     "interrupted expansion",
+			volSize:  2048,
+			recorded: "4096",
+			want:     4096,
+		},
+		{
+			name:     "invalid size recorded",
+			volSize:  2048,
+			recorded: "4k",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := expandTargetSize(tt.volSize, tt.recorded)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateExpandSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		current    int64
+		volSize    int64
+		limitBytes int64
+		wantErr    bool
+	}{
+		{
+			name:    "expand",
+			current: 1024,
+			volSize: 2048,
+		},
+		{
+			name:    "smaller without limit",
+			current: 2048,
+			volSize: 1024,
+		},
+		{
+			name:       "smaller within limit",
+			current:    2048,
+			volSize:    1024,
+			limitBytes: 4096,
+		},
+		{
+			name:       "larger than limit",
+			current:    4096,
+			volSize:    1024,
+			limitBytes: 2048,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateExpandSize(tt.current, tt.volSize, tt.limitBytes)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrShrinkNotSupported)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/s3"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// exportDiffHeader is the header of the "rbd diff v1" format that is written
+// by `rbd export-diff` and can be applied with `rbd import-diff`.
+const exportDiffHeader = "rbd diff v1\n"
+
+// the tags of the records in the "rbd diff v1" format.
+const (
+	diffTagFromSnap = 'f'
+	diffTagToSnap   = 't'
+	diffTagSize     = 's'
+	diffTagData     = 'w'
+	diffTagZero     = 'z'
+	diffTagEnd      = 'e'
+)
+
+// exportReadSize is the maximum number of bytes that is read from the image
+// at once while exporting.
+const exportReadSize = 4 * 1024 * 1024
+
+// diffWriter writes the records of the "rbd diff v1" format.
+type diffWriter struct {
+	w io.Writer
+}
+
+func (dw *diffWriter) write(data ...any) error {
+	for _, d := range data {
+		var err error
+		switch v := d.(type) {
+		case []byte:
+			_, err = dw.w.Write(v)
+		case string:
+			_, err = io.WriteString(dw.w, v)
+		default:
+			err = binary.Write(dw.w, binary.LittleEndian, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHeader writes the header, the optional names of the snapshots and the
+// size of the image.
+func (dw *diffWriter) writeHeader(fromSnap, toSnap string, size uint64) error {
+	err := dw.write(exportDiffHeader)
+	if err != nil {
+		return err
+	}
+
+	if fromSnap != "" {
+		err = dw.write(byte(diffTagFromSnap), uint32(len(fromSnap)), fromSnap)
+		if err != nil {
+			return err
+		}
+	}
+
+	if toSnap != "" {
+		err = dw.write(byte(diffTagToSnap), uint32(len(toSnap)), toSnap)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dw.write(byte(diffTagSize), size)
+}
+
+// writeData writes a record with the data at the offset of the image.
+func (dw *diffWriter) writeData(offset uint64, data []byte) error {
+	return dw.write(byte(diffTagData), offset, uint64(len(data)), data)
+}
+
+// writeZero writes a record for an extent of the image that was discarded.
+func (dw *diffWriter) writeZero(offset, length uint64) error {
+	return dw.write(byte(diffTagZero), offset, length)
+}
+
+// writeEnd writes the record that terminates the diff.
+func (dw *diffWriter) writeEnd() error {
+	return dw.write(byte(diffTagEnd))
+}
+
+// exportSnapshot writes the contents of the image at the RBD snapshot
+// snapName in the "rbd diff v1" format to w. The whole image, including the
+// data of its parent, is exported.
+func (ri *rbdImage) exportSnapshot(ctx context.Context, snapName string, w io.Writer) error {
+	err := ri.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	image, err := librbd.OpenImageReadOnly(ri.ioctx, ri.RbdImageName, snapName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			err = fmt.Errorf("%w: %w", ErrImageNotFound, err)
+		}
+
+		return fmt.Errorf("failed to open image %q at snapshot %q: %w", ri, snapName, err)
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return fmt.Errorf("failed to get size of image %q: %w", ri, err)
+	}
+
+	dw := &diffWriter{w: w}
+	err = dw.writeHeader("", "", size)
+	if err != nil {
+		return err
+	}
+
+	log.DebugLog(ctx, "exporting image %s at snapshot %q", ri, snapName)
+
+	var exportErr error
+	buf := make([]byte, exportReadSize)
+	err = image.DiffIterate(librbd.DiffIterateConfig{
+		Offset:        0,
+		Length:        size,
+		IncludeParent: librbd.IncludeParent,
+		WholeObject:   librbd.DisableWholeObject,
+		Callback: func(offset, length uint64, exists int, _ interface{}) int {
+			exportErr = exportExtent(image, dw, buf, offset, length, exists != 0)
+			if exportErr != nil {
+				return -1
+			}
+
+			return 0
+		},
+	})
+	if exportErr != nil {
+		return fmt.Errorf("failed to export image %q: %w", ri, exportErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to iterate over the extents of image %q: %w", ri, err)
+	}
+
+	return dw.writeEnd()
+}
+
+// exportExtent writes the data of the extent of the image, or a zero record
+// for an extent that does not exist (anymore).
+func exportExtent(image *librbd.Image, dw *diffWriter, buf []byte, offset, length uint64, exists bool) error {
+	if !exists {
+		return dw.writeZero(offset, length)
+	}
+
+	for length > 0 {
+		n := min(length, uint64(len(buf)))
+		read, err := image.ReadAt(buf[:n], int64(offset))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read %d bytes at offset %d: %w", n, offset, err)
+		}
+
+		err = dw.writeData(offset, buf[:read])
+		if err != nil {
+			return err
+		}
+
+		if uint64(read) < n {
+			// reading at the end of the image
+			return nil
+		}
+		offset += n
+		length -= n
+	}
+
+	return nil
+}
+
+// ExportSnapshot exports the CSI snapshot to the object store that is
+// configured in the secrets. A CSI snapshot is stored as a clone image with
+// an RBD snapshot of the same name, the contents of the clone image at that
+// RBD snapshot are stored in the "rbd diff v1" format as object key. The
+// object can be applied to an empty image with `rbd import-diff`.
+func ExportSnapshot(
+	ctx context.Context,
+	snapshotID,
+	key string,
+	secrets map[string]string,
+	cr *util.Credentials,
+) error {
+	cfg, err := s3.NewConfig(secrets)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidArgument, err)
+	}
+
+	rbdSnap, err := genSnapFromSnapID(ctx, snapshotID, cr, secrets)
+	if err != nil {
+		if errors.Is(err, util.ErrPoolNotFound) || errors.Is(err, util.ErrKeyNotFound) {
+			err = fmt.Errorf("%w: %w", ErrSnapNotFound, err)
+		}
+
+		return err
+	}
+	defer rbdSnap.Destroy(ctx)
+
+	// the data of the snapshot is in the clone image
+	rbdSnap.RbdImageName = rbdSnap.RbdSnapName
+
+	upload, err := s3.NewUploader(ctx, cfg, key)
+	if err != nil {
+		return err
+	}
+
+	err = rbdSnap.exportSnapshot(ctx, rbdSnap.RbdSnapName, upload)
+	if err != nil {
+		abortErr := upload.Abort()
+		if abortErr != nil {
+			log.ErrorLog(ctx, "failed to abort the upload of snapshot %s: %v", rbdSnap, abortErr)
+		}
+
+		return err
+	}
+
+	err = upload.Close()
+	if err != nil {
+		return err
+	}
+
+	log.DebugLog(ctx, "exported snapshot %s to %q in bucket %q", rbdSnap, key, cfg.Bucket)
+
+	return nil
+}
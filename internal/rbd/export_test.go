@@ -0,0 +1,69 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffWriter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		fromSnap string
+		toSnap   string
+		want     []byte
+	}{
+		{
+			name: "full export",
+			want: []byte("rbd diff v1\n" +
+				"s\x00\x20\x00\x00\x00\x00\x00\x00" +
+				"w\x00\x02\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00abc" +
+				"z\x00\x04\x00\x00\x00\x00\x00\x00\x00\x10\x00\x00\x00\x00\x00\x00" +
+				"e"),
+		},
+		{
+			name:     "diff between snapshots",
+			fromSnap: "snap1",
+			toSnap:   "snap2",
+			want: []byte("rbd diff v1\n" +
+				"f\x05\x00\x00\x00snap1" +
+				"t\x05\x00\x00\x00snap2" +
+				"s\x00\x20\x00\x00\x00\x00\x00\x00" +
+				"w\x00\x02\x00\x00\x00\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x00abc" +
+				"z\x00\x04\x00\x00\x00\x00\x00\x00\x00\x10\x00\x00\x00\x00\x00\x00" +
+				"e"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			buf := &bytes.Buffer{}
+			dw := &diffWriter{w: buf}
+
+			require.NoError(t, dw.writeHeader(tt.fromSnap, tt.toSnap, 0x2000))
+			require.NoError(t, dw.writeData(0x200, []byte("abc")))
+			require.NoError(t, dw.writeZero(0x400, 0x1000))
+			require.NoError(t, dw.writeEnd())
+			require.Equal(t, tt.want, buf.Bytes())
+		})
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	// fsckModeParam is the StorageClass parameter that enables checking the
+	// filesystem of a volume on NodeStageVolume.
+	fsckModeParam = "fsckMode"
+
+	// fsckModeWarn checks the filesystem and logs the errors that are found.
+	fsckModeWarn = "warn"
+	// fsckModeRepair checks the filesystem and repairs the errors.
+	fsckModeRepair = "repair"
+	// fsckModeFail checks the filesystem and fails NodeStageVolume when
+	// errors are found.
+	fsckModeFail = "fail"
+
+	// e2fsck exit codes, see e2fsck(8).
+	e2fsckErrorsCorrected = 1
+	e2fsckRebootRequired  = 2
+	// xfs_repair exit codes, see xfs_repair(8).
+	xfsRepairCorrupted = 1
+	xfsRepairDirtyLog  = 2
+)
+
+// validateFsckMode checks that the mode is empty (disabled) or a supported
+// fsckMode.
+func validateFsckMode(mode string) error {
+	switch mode {
+	case "", fsckModeWarn, fsckModeRepair, fsckModeFail:
+		return nil
+	}
+
+	return fmt.Errorf("%w: invalid %s %q, supported are %q, %q and %q", ErrInvalidArgument,
+		fsckModeParam, mode, fsckModeWarn, fsckModeRepair, fsckModeFail)
+}
+
+// exitStatus returns the exit status of a command, or -1 if the command
+// could not be executed.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var ee utilexec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitStatus()
+	}
+
+	return -1
+}
+
+// extFilesystemIsDirty parses the output of `dumpe2fs -h` and returns true
+// when the filesystem was not unmounted cleanly.
+func extFilesystemIsDirty(dumpe2fsOutput string) bool {
+	for _, line := range strings.Split(dumpe2fsOutput, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch strings.TrimSpace(key) {
+		case "Filesystem state":
+			if value != "clean" {
+				return true
+			}
+		case "Filesystem features":
+			if strings.Contains(value, "needs_recovery") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkFilesystem checks the filesystem on the device before it is mounted.
+// ext filesystems are only checked when they were not unmounted cleanly. xfs
+// does not record an unclean unmount in the superblock, its log is replayed
+// on mount; xfs filesystems are checked by checkFailedMount when mounting
+// fails.
+func checkFilesystem(ctx context.Context, exec utilexec.Interface, mode, fsType, devicePath string) error {
+	if mode == "" {
+		return nil
+	}
+
+	if strings.HasPrefix(fsType, "ext") {
+		return checkExtFilesystem(ctx, exec, mode, devicePath)
+	}
+
+	return nil
+}
+
+// checkFailedMount checks the filesystem on the device after mounting it
+// failed. It returns true when the filesystem was repaired, and mounting
+// should be retried.
+func checkFailedMount(ctx context.Context, exec utilexec.Interface, mode, fsType, devicePath string) (bool, error) {
+	if mode == "" || fsType != "xfs" {
+		return false, nil
+	}
+
+	return checkXfsFilesystem(ctx, exec, mode, devicePath)
+}
+
+func checkExtFilesystem(ctx context.Context, exec utilexec.Interface, mode, devicePath string) error {
+	out, err := exec.Command("dumpe2fs", "-h", devicePath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to read superblock of %s: %w, output: %s", devicePath, err, string(out))
+	}
+
+	if !extFilesystemIsDirty(string(out)) {
+		return nil
+	}
+
+	log.WarningLog(ctx, "filesystem on %s was not unmounted cleanly, checking it (fsckMode %s)", devicePath, mode)
+
+	if mode == fsckModeRepair {
+		// -p replays the journal and repairs what can be repaired safely
+		out, err = exec.Command("e2fsck", "-p", "-f", devicePath).CombinedOutput()
+		switch exitStatus(err) {
+		case 0, e2fsckErrorsCorrected, e2fsckRebootRequired:
+			log.DebugLog(ctx, "e2fsck repaired filesystem on %s: %s", devicePath, string(out))
+
+			return nil
+		}
+
+		return fmt.Errorf("%w: e2fsck could not repair filesystem on %s: %w, output: %s",
+			ErrFailedPrecondition, devicePath, err, string(out))
+	}
+
+	out, err = exec.Command("e2fsck", "-n", "-f", devicePath).CombinedOutput()
+
+	return reportFilesystemErrors(ctx, mode, devicePath, err, string(out))
+}
+
+func checkXfsFilesystem(ctx context.Context, exec utilexec.Interface, mode, devicePath string) (bool, error) {
+	log.WarningLog(ctx, "mounting the filesystem on %s failed, checking it (fsckMode %s)", devicePath, mode)
+
+	out, err := exec.Command("xfs_repair", "-n", devicePath).CombinedOutput()
+	switch exitStatus(err) {
+	case 0:
+		return false, nil
+	case xfsRepairDirtyLog:
+		// the mount should have replayed the log, repairing the
+		// filesystem requires zeroing the log (xfs_repair -L) which
+		// loses the metadata changes in it, that is left to the admin
+		return false, fmt.Errorf("%w: filesystem on %s has a dirty log that could not be replayed by mounting it, "+
+			"output: %s", ErrFailedPrecondition, devicePath, string(out))
+	case xfsRepairCorrupted:
+		if mode != fsckModeRepair {
+			break
+		}
+
+		log.WarningLog(ctx, "repairing corrupted filesystem on %s", devicePath)
+		out, err = exec.Command("xfs_repair", devicePath).CombinedOutput()
+		if err != nil {
+			return false, fmt.Errorf("%w: xfs_repair could not repair filesystem on %s: %w, output: %s",
+				ErrFailedPrecondition, devicePath, err, string(out))
+		}
+
+		return true, nil
+	}
+
+	return false, reportFilesystemErrors(ctx, mode, devicePath, err, string(out))
+}
+
+// reportFilesystemErrors logs the errors of a read-only filesystem check, and
+// returns an error when the mode is fsckModeFail.
+func reportFilesystemErrors(ctx context.Context, mode, devicePath string, err error, output string) error {
+	if err == nil {
+		return nil
+	}
+
+	if exitStatus(err) == -1 {
+		return fmt.Errorf("failed to check filesystem on %s: %w", devicePath, err)
+	}
+
+	if mode == fsckModeFail {
+		return fmt.Errorf("%w: filesystem on %s has errors: %s", ErrFailedPrecondition, devicePath, output)
+	}
+
+	log.WarningLog(ctx, "filesystem on %s has errors: %s", devicePath, output)
+
+	return nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	utilexec "k8s.io/utils/exec"
+)
+
+func TestExtFilesystemIsDirty(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		output string
+		want   bool
+	}{
+		{
+			name: "clean filesystem",
+			output: `Filesystem volume name:   <none>
+Filesystem features:      has_journal ext_attr resize_inode dir_index filetype extent
+Filesystem state:         clean
+Errors behavior:          Continue`,
+			want: false,
+		},
+		{
+			name: "journal needs recovery",
+			output: `Filesystem features:      has_journal ext_attr filetype needs_recovery extent
+Filesystem state:         clean`,
+			want: true,
+		},
+		{
+			name: "errors recorded",
+			output: `Filesystem features:      has_journal ext_attr filetype extent
+Filesystem state:         clean with errors`,
+			want: true,
+		},
+		{
+			name: "not clean",
+			output: `Filesystem features:      has_journal
+Filesystem state:         not clean`,
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := extFilesystemIsDirty(ts.output); got != ts.want {
+				t.Errorf("extFilesystemIsDirty() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestValidateFsckMode(t *testing.T) {
+	t.Parallel()
+	for _, mode := range []string{"", fsckModeWarn, fsckModeRepair, fsckModeFail} {
+		if err := validateFsckMode(mode); err != nil {
+			t.Errorf("validateFsckMode(%q) error = %v", mode, err)
+		}
+	}
+	if err := validateFsckMode("always"); err == nil {
+		t.Error("validateFsckMode(\"always\") expected an error")
+	}
+}
+
+// fakeExec runs no commands, it returns the exit code that is configured for
+// the command line.
+type fakeExec struct {
+	utilexec.Interface
+
+	exitCodes map[string]int
+	commands  []string
+}
+
+type fakeCmd struct {
+	utilexec.Cmd
+
+	code int
+}
+
+func (f *fakeExec) Command(cmd string, args ...string) utilexec.Cmd {
+	cmdline := strings.Join(append([]string{cmd}, args...), " ")
+	f.commands = append(f.commands, cmdline)
+
+	return &fakeCmd{code: f.exitCodes[cmdline]}
+}
+
+func (c *fakeCmd) CombinedOutput() ([]byte, error) {
+	if c.code == 0 {
+		return nil, nil
+	}
+
+	return nil, utilexec.CodeExitError{Err: errors.New("failed"), Code: c.code}
+}
+
+func TestCheckFailedMount(t *testing.T) {
+	t.Parallel()
+	const dev = "/dev/rbd0"
+	tests := []struct {
+		name         string
+		mode         string
+		fsType       string
+		exitCodes    map[string]int
+		wantRepaired bool
+		wantErr      error
+		wantCommands []string
+	}{
+		{
+			name:   "disabled",
+			mode:   "",
+			fsType: "xfs",
+		},
+		{
+			name:   "ext4 is checked before mounting",
+			mode:   fsckModeRepair,
+			fsType: "ext4",
+		},
+		{
+			name:         "xfs without errors",
+			mode:         fsckModeFail,
+			fsType:       "xfs",
+			wantCommands: []string{"xfs_repair -n " + dev},
+		},
+		{
+			name:         "xfs with dirty log",
+			mode:         fsckModeRepair,
+			fsType:       "xfs",
+			exitCodes:    map[string]int{"xfs_repair -n " + dev: xfsRepairDirtyLog},
+			wantErr:      ErrFailedPrecondition,
+			wantCommands: []string{"xfs_repair -n " + dev},
+		},
+		{
+			name:         "xfs corrupted, warn",
+			mode:         fsckModeWarn,
+			fsType:       "xfs",
+			exitCodes:    map[string]int{"xfs_repair -n " + dev: xfsRepairCorrupted},
+			wantCommands: []string{"xfs_repair -n " + dev},
+		},
+		{
+			name:         "xfs corrupted, fail",
+			mode:         fsckModeFail,
+			fsType:       "xfs",
+			exitCodes:    map[string]int{"xfs_repair -n " + dev: xfsRepairCorrupted},
+			wantErr:      ErrFailedPrecondition,
+			wantCommands: []string{"xfs_repair -n " + dev},
+		},
+		{
+			name:         "xfs corrupted, repair",
+			mode:         fsckModeRepair,
+			fsType:       "xfs",
+			exitCodes:    map[string]int{"xfs_repair -n " + dev: xfsRepairCorrupted},
+			wantRepaired: true,
+			wantCommands: []string{"xfs_repair -n " + dev, "xfs_repair " + dev},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			exec := &fakeExec{exitCodes: ts.exitCodes}
+			repaired, err := checkFailedMount(context.TODO(), exec, ts.mode, ts.fsType, dev)
+			if !errors.Is(err, ts.wantErr) || (ts.wantErr == nil && err != nil) {
+				t.Errorf("checkFailedMount() error = %v, want %v", err, ts.wantErr)
+			}
+			if repaired != ts.wantRepaired {
+				t.Errorf("checkFailedMount() repaired = %v, want %v", repaired, ts.wantRepaired)
+			}
+			if strings.Join(exec.commands, ";") != strings.Join(ts.wantCommands, ";") {
+				t.Errorf("checkFailedMount() ran %q, want %q", exec.commands, ts.wantCommands)
+			}
+		})
+	}
+}
@@ -52,12 +52,13 @@ func (cs *ControllerServer) CreateVolumeGroupSnapshot(
 	)
 
 	// Existence and conflict checks
-	if acquired := cs.VolumeGroupLocks.TryAcquire(vgsName); !acquired {
+	token, acquired := cs.VolumeGroupLocks.TryAcquire(vgsName)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, vgsName)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, vgsName)
 	}
-	defer cs.VolumeGroupLocks.Release(vgsName)
+	defer cs.VolumeGroupLocks.Release(vgsName, token)
 
 	mgr := NewManager(cs.Driver.GetInstanceID(), req.GetParameters(), req.GetSecrets())
 	defer mgr.Destroy(ctx)
@@ -178,12 +179,13 @@ func (cs *ControllerServer) DeleteVolumeGroupSnapshot(
 	groupSnapshotID := req.GetGroupSnapshotId()
 
 	// Existence and conflict checks
-	if acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID); !acquired {
+	token, acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
 	}
-	defer cs.VolumeGroupLocks.Release(groupSnapshotID)
+	defer cs.VolumeGroupLocks.Release(groupSnapshotID, token)
 
 	mgr := NewManager(cs.Driver.GetInstanceID(), nil, req.GetSecrets())
 	defer mgr.Destroy(ctx)
@@ -217,12 +219,13 @@ func (cs *ControllerServer) GetVolumeGroupSnapshot(
 	groupSnapshotID := req.GetGroupSnapshotId()
 
 	// Existence and conflict checks
-	if acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID); !acquired {
+	token, acquired := cs.VolumeGroupLocks.TryAcquire(groupSnapshotID)
+	if !acquired {
 		log.ErrorLog(ctx, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
 
 		return nil, status.Errorf(codes.Aborted, util.SnapshotOperationAlreadyExistsFmt, groupSnapshotID)
 	}
-	defer cs.VolumeGroupLocks.Release(groupSnapshotID)
+	defer cs.VolumeGroupLocks.Release(groupSnapshotID, token)
 
 	mgr := NewManager(cs.Driver.GetInstanceID(), nil, req.GetSecrets())
 	defer mgr.Destroy(ctx)
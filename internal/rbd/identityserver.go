@@ -29,6 +29,9 @@ import (
 // identity server spec.
 type IdentityServer struct {
 	*csicommon.DefaultIdentityServer
+
+	// SnapshotMetadata is set when the SnapshotMetadata service is served.
+	SnapshotMetadata bool
 }
 
 // GetPluginCapabilities returns available capabilities of the rbd driver.
@@ -73,6 +76,16 @@ func (is *IdentityServer) GetPluginCapabilities(
 		caps = append(caps, &gcs)
 	}
 
+	if is.SnapshotMetadata {
+		caps = append(caps, &csi.PluginCapability{
+			Type: &csi.PluginCapability_Service_{
+				Service: &csi.PluginCapability_Service{
+					Type: csi.PluginCapability_Service_SNAPSHOT_METADATA_SERVICE,
+				},
+			},
+		})
+	}
+
 	return &csi.GetPluginCapabilitiesResponse{
 		Capabilities: caps,
 	}, nil
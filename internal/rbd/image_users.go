@@ -0,0 +1,177 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// imageUsers contains the clients that use an image, excluding the client
+// of Ceph-CSI that inspects the image.
+type imageUsers struct {
+	watchers   []librbd.ImageWatcher
+	lockOwners []string
+}
+
+// clientName returns the name (client.<id>) of a watcher, as used for lock
+// owners.
+func clientName(id int64) string {
+	return "client." + strconv.FormatInt(id, 10)
+}
+
+// watcherIP returns the IP address of the address of a watcher, which is
+// formatted like `10.0.0.1:0/2310812345` or `v1:[fd00::1]:0/2310812345`.
+func watcherIP(addr string) string {
+	addr = strings.TrimPrefix(addr, "v1:")
+	addr = strings.TrimPrefix(addr, "v2:")
+	if i := strings.LastIndex(addr, "/"); i != -1 {
+		addr = addr[:i]
+	}
+	if i := strings.LastIndex(addr, ":"); i != -1 {
+		addr = addr[:i]
+	}
+
+	return strings.Trim(addr, "[]")
+}
+
+// staleLockOwners returns the lock owners that do not have a watch on the
+// image anymore. The clients that held these locks are gone, and did not
+// release the lock.
+func (iu *imageUsers) staleLockOwners() []string {
+	var stale []string
+	for _, owner := range iu.lockOwners {
+		found := false
+		for _, w := range iu.watchers {
+			if clientName(w.Id) == owner {
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			stale = append(stale, owner)
+		}
+	}
+
+	return stale
+}
+
+// String returns a description of the users of the image, that can be
+// returned to the Container Orchestrator.
+func (iu *imageUsers) String() string {
+	watchers := make([]string, 0, len(iu.watchers))
+	for _, w := range iu.watchers {
+		watchers = append(watchers, fmt.Sprintf("%s (ip %s)", clientName(w.Id), watcherIP(w.Addr)))
+	}
+
+	desc := "watchers: [" + strings.Join(watchers, ", ") + "]"
+	if len(iu.lockOwners) != 0 {
+		desc += ", exclusive lock owners: [" + strings.Join(iu.lockOwners, ", ") + "]"
+	}
+
+	return desc
+}
+
+// getImageUsers lists the watchers and the exclusive lock owners of the
+// image. The watcher of the connection that opens the image is not included.
+func (ri *rbdImage) getImageUsers() (*imageUsers, error) {
+	image, err := ri.open()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	watchers, err := image.ListWatchers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list watchers of %q: %w", ri, err)
+	}
+
+	owners, err := image.LockGetOwners()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lock owners of %q: %w", ri, err)
+	}
+
+	self, err := ri.conn.GetInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
+	users := &imageUsers{}
+	for _, w := range watchers {
+		if uint64(w.Id) != self {
+			users.watchers = append(users.watchers, w)
+		}
+	}
+	for _, owner := range owners {
+		if owner.Mode == librbd.LockModeExclusive {
+			users.lockOwners = append(users.lockOwners, owner.Owner)
+		}
+	}
+
+	return users, nil
+}
+
+// breakStaleLocks breaks the exclusive locks of owners that do not have a
+// watch on the image anymore.
+func (ri *rbdImage) breakStaleLocks(ctx context.Context) error {
+	users, err := ri.getImageUsers()
+	if err != nil {
+		return err
+	}
+
+	stale := users.staleLockOwners()
+	if len(stale) == 0 {
+		return nil
+	}
+
+	image, err := ri.open()
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	for _, owner := range stale {
+		log.WarningLog(ctx, "breaking stale exclusive lock of %s on image %s", owner, ri)
+
+		err = image.LockBreak(librbd.LockModeExclusive, owner)
+		if err != nil {
+			return fmt.Errorf("failed to break exclusive lock of %s on %q: %w", owner, ri, err)
+		}
+	}
+
+	return nil
+}
+
+// imageInUseError returns an error that wraps ErrFailedPrecondition and
+// describes the watchers and lock owners of the image.
+func (ri *rbdImage) imageInUseError(ctx context.Context) error {
+	users, err := ri.getImageUsers()
+	if err != nil {
+		log.WarningLog(ctx, "failed to get users of image %s: %v", ri, err)
+
+		return fmt.Errorf("%w: rbd image %s is still being used", ErrFailedPrecondition, ri)
+	}
+
+	return fmt.Errorf("%w: rbd image %s is still being used by %s", ErrFailedPrecondition, ri, users)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"reflect"
+	"testing"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+func TestWatcherIP(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"10.0.0.1:0/2310812345", "10.0.0.1"},
+		{"v1:10.0.0.1:0/2310812345", "10.0.0.1"},
+		{"v2:[fd00::1]:0/2310812345", "fd00::1"},
+		{"[fd00::1]:0/2310812345", "fd00::1"},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.addr, func(t *testing.T) {
+			t.Parallel()
+			if got := watcherIP(ts.addr); got != ts.want {
+				t.Errorf("watcherIP(%q) = %q, want %q", ts.addr, got, ts.want)
+			}
+		})
+	}
+}
+
+func TestImageUsers(t *testing.T) {
+	t.Parallel()
+	users := &imageUsers{
+		watchers: []librbd.ImageWatcher{
+			{Addr: "10.0.0.1:0/2310812345", Id: 4123},
+		},
+		lockOwners: []string{"client.4123", "client.5001"},
+	}
+
+	stale := users.staleLockOwners()
+	if !reflect.DeepEqual(stale, []string{"client.5001"}) {
+		t.Errorf("staleLockOwners() = %v, want [client.5001]", stale)
+	}
+
+	want := "watchers: [client.4123 (ip 10.0.0.1)], exclusive lock owners: [client.4123, client.5001]"
+	if got := users.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,474 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// journaledObject is a volume or snapshot that is reserved in a journal.
+type journaledObject struct {
+	// id is the volume or snapshot ID
+	id string
+	// poolID is the ID of the pool of the image
+	poolID int64
+	// value is the value of the attribute that was listed
+	value string
+}
+
+// listJournaled returns the volumes or snapshots that are reserved in the
+// journals of all pools of the clusters in the CSI configuration, with the
+// value of the attribute in their journal. ListVolumes and ListSnapshots
+// requests do not contain secrets, clusters without provisioner credentials
+// in the CSI configuration are skipped.
+func listJournaled(ctx context.Context, jc *journal.Config, attribute string) ([]journaledObject, error) {
+	clusterIDs, err := util.ConfiguredClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []journaledObject
+	for _, clusterID := range clusterIDs {
+		clusterObjects, err := listJournaledInCluster(ctx, jc, clusterID, attribute)
+		if errors.Is(err, errNoProvisionerCredentials) {
+			log.DebugLog(ctx, "not listing cluster %q: %v", clusterID, err)
+
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list cluster %q: %w", clusterID, err)
+		}
+
+		objects = append(objects, clusterObjects...)
+	}
+
+	return objects, nil
+}
+
+// listJournaledInCluster returns the volumes or snapshots that are reserved
+// in the journals of all pools of the cluster. Pools that can not be read
+// with the provisioner credentials are skipped.
+func listJournaledInCluster(
+	ctx context.Context,
+	jc *journal.Config,
+	clusterID, attribute string,
+) ([]journaledObject, error) {
+	cr, monitors, err := configuredProvisionerCredentials(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.DeleteCredentials()
+
+	radosNamespace, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rados namespace using clusterID (%s): %w", clusterID, err)
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	pools, err := conn.ListPools()
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := jc.Connect(monitors, radosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	var objects []journaledObject
+	for _, pool := range pools {
+		journalPoolID, err := util.GetPoolID(monitors, cr, pool)
+		if err != nil {
+			return nil, err
+		}
+
+		reservations, err := j.ListAllReservations(ctx, pool, journalPoolID, attribute)
+		if err != nil {
+			log.WarningLog(ctx, "skipping journal in pool %q of cluster %q: %v", pool, clusterID, err)
+
+			continue
+		}
+
+		for poolID, values := range reservations {
+			for reservedUUID, value := range values {
+				id, err := util.GenerateVolID(ctx, monitors, cr, poolID, "", clusterID, reservedUUID)
+				if err != nil {
+					return nil, err
+				}
+
+				objects = append(objects, journaledObject{id: id, poolID: poolID, value: value})
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// listCredentials contains the credentials of the clusters of the entries of
+// a ListVolumes or ListSnapshots response.
+type listCredentials struct {
+	// secrets of the request, used for all clusters when set
+	secrets map[string]string
+	// clusters contains the credentials by clusterID
+	clusters map[string]*util.Credentials
+}
+
+// get returns the credentials for the cluster, the secrets of the request or
+// the provisioner credentials of the CSI configuration.
+func (lc *listCredentials) get(ctx context.Context, clusterID string) (*util.Credentials, error) {
+	if cr, ok := lc.clusters[clusterID]; ok {
+		return cr, nil
+	}
+
+	var (
+		cr  *util.Credentials
+		err error
+	)
+	if len(lc.secrets) != 0 {
+		cr, err = util.NewUserCredentialsWithMigration(lc.secrets)
+	} else {
+		cr, _, err = configuredProvisionerCredentials(ctx, clusterID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lc.clusters == nil {
+		lc.clusters = map[string]*util.Credentials{}
+	}
+	lc.clusters[clusterID] = cr
+
+	return cr, nil
+}
+
+// destroy deletes the credentials of all clusters.
+func (lc *listCredentials) destroy() {
+	for _, cr := range lc.clusters {
+		cr.DeleteCredentials()
+	}
+}
+
+// isRemovedError returns true when the error is returned for a volume or
+// snapshot that was removed while it was listed, or that is not created
+// completely yet.
+func isRemovedError(err error) bool {
+	return errors.Is(err, ErrImageNotFound) || errors.Is(err, ErrSnapNotFound) ||
+		errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound)
+}
+
+// paginateError returns the gRPC error for an error of util.Paginate.
+func paginateError(err error) error {
+	if errors.Is(err, util.ErrInvalidStartingToken) {
+		return status.Error(codes.Aborted, err.Error())
+	}
+
+	return status.Error(codes.InvalidArgument, err.Error())
+}
+
+// ListVolumes lists the volumes in the journals of the clusters in the CSI
+// configuration that have provisioner credentials configured. The nodes that
+// use a volume are the Kubernetes nodes with the address of a watcher of the
+// image.
+func (cs *ControllerServer) ListVolumes(
+	ctx context.Context,
+	req *csi.ListVolumesRequest,
+) (*csi.ListVolumesResponse, error) {
+	volumes, err := listJournaled(ctx, volJournal, imageNameAttribute)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to list volumes: %v", err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	volumeIDs := make([]string, 0, len(volumes))
+	for _, vol := range volumes {
+		volumeIDs = append(volumeIDs, vol.id)
+	}
+
+	page, nextToken, err := util.Paginate(volumeIDs, req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		return nil, paginateError(err)
+	}
+
+	nodeNames, err := k8s.GetNodeNamesByAddress(ctx)
+	if err != nil {
+		log.WarningLog(ctx, "failed to get the nodes of the volumes: %v", err)
+	}
+
+	creds := &listCredentials{}
+	defer creds.destroy()
+
+	entries := make([]*csi.ListVolumesResponse_Entry, 0, len(page))
+	for _, volumeID := range page {
+		entry, err := listVolumeEntry(ctx, volumeID, creds, nodeNames)
+		if isRemovedError(err) {
+			log.DebugLog(ctx, "not listing volume %s: %v", volumeID, err)
+
+			continue
+		}
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get volume %s: %v", volumeID, err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// listVolumeEntry returns the entry of the volume for a ListVolumes response.
+// Volumes without image are not listed, ControllerGetVolume reports them.
+func listVolumeEntry(
+	ctx context.Context,
+	volumeID string,
+	creds *listCredentials,
+	nodeNames map[string]string,
+) (*csi.ListVolumesResponse_Entry, error) {
+	cr, err := creds.get(ctx, util.GetClusterIDFromVolumeID(volumeID))
+	if err != nil {
+		return nil, err
+	}
+
+	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, nil)
+	defer func() {
+		if rbdVol != nil {
+			rbdVol.Destroy(ctx)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := rbdVol.getImageUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []string
+	for _, w := range users.watchers {
+		node, ok := nodeNames[watcherIP(w.Addr)]
+		if ok && !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+
+	condition, err := rbdVol.volumeCondition(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csi.ListVolumesResponse_Entry{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: rbdVol.VolSize,
+		},
+		Status: &csi.ListVolumesResponse_VolumeStatus{
+			PublishedNodeIds: nodes,
+			VolumeCondition:  condition,
+		},
+	}, nil
+}
+
+// ListSnapshots lists the snapshots in the journals of the clusters in the
+// CSI configuration that have provisioner credentials configured, optionally
+// filtered by the snapshot ID or the source volume ID.
+func (cs *ControllerServer) ListSnapshots(
+	ctx context.Context,
+	req *csi.ListSnapshotsRequest,
+) (*csi.ListSnapshotsResponse, error) {
+	var snapshotIDs []string
+	if req.GetSnapshotId() != "" {
+		snapshotIDs = []string{req.GetSnapshotId()}
+	} else {
+		snapshots, err := listJournaled(ctx, snapJournal, snapSourceAttribute)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to list snapshots: %v", err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		for _, snap := range snapshots {
+			if req.GetSourceVolumeId() != "" && req.GetSourceVolumeId() != sourceVolumeID(snap) {
+				continue
+			}
+			snapshotIDs = append(snapshotIDs, snap.id)
+		}
+	}
+
+	page, nextToken, err := util.Paginate(snapshotIDs, req.GetMaxEntries(), req.GetStartingToken())
+	if err != nil {
+		return nil, paginateError(err)
+	}
+
+	creds := &listCredentials{secrets: req.GetSecrets()}
+	defer creds.destroy()
+
+	entries := make([]*csi.ListSnapshotsResponse_Entry, 0, len(page))
+	for _, snapshotID := range page {
+		entry, err := listSnapshotEntry(ctx, snapshotID, creds)
+		if errors.Is(err, errNoProvisionerCredentials) {
+			log.DebugLog(ctx, "listing snapshot %s without reading it: %v", snapshotID, err)
+			entry, err = unverifiedSnapshotEntry(snapshotID)
+		}
+		if isRemovedError(err) || errors.Is(err, ErrInvalidVolID) {
+			log.DebugLog(ctx, "not listing snapshot %s: %v", snapshotID, err)
+
+			continue
+		}
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get snapshot %s: %v", snapshotID, err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		if req.GetSourceVolumeId() != "" && entry.GetSnapshot().GetSourceVolumeId() != req.GetSourceVolumeId() {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: nextToken,
+	}, nil
+}
+
+// sourceVolumeID returns the ID of the volume that the snapshot was created
+// from, the value of the snapshot is the name of the image of the volume.
+// It is empty when the name of the image does not contain the UUID of a
+// volume.
+func sourceVolumeID(snap journaledObject) string {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(snap.id); err != nil {
+		return ""
+	}
+
+	volUUID, ok := journal.GetUUIDFromName(snap.value)
+	if !ok {
+		return ""
+	}
+
+	vi.ObjectUUID = volUUID
+	volumeID, err := vi.ComposeCSIID()
+	if err != nil {
+		return ""
+	}
+
+	return volumeID
+}
+
+// listSnapshotEntry returns the entry of the snapshot for a ListSnapshots
+// response.
+func listSnapshotEntry(
+	ctx context.Context,
+	snapshotID string,
+	creds *listCredentials,
+) (*csi.ListSnapshotsResponse_Entry, error) {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(snapshotID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidVolID, err)
+	}
+
+	cr, err := creds.get(ctx, vi.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	rbdSnap, err := genSnapFromSnapID(ctx, snapshotID, cr, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rbdSnap.Destroy(ctx)
+
+	// the RbdImageName of group snapshots is not the source, it is read from
+	// the journal instead
+	j, err := snapJournal.Connect(rbdSnap.Monitors, rbdSnap.RadosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	source, err := snapshotSource(ctx, j, rbdSnap)
+	if err != nil {
+		return nil, err
+	}
+
+	csiSnap, err := rbdSnap.ToCSI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	csiSnap.SourceVolumeId = sourceVolumeID(journaledObject{id: snapshotID, value: source})
+
+	return &csi.ListSnapshotsResponse_Entry{
+		Snapshot: csiSnap,
+	}, nil
+}
+
+// unverifiedSnapshotEntry returns the entry of a snapshot that can not be
+// read, because there are no credentials for its cluster. The snapshot
+// controller checks pre-provisioned snapshots by their ID, without the
+// snapshotter-list-secret these are reported ready to use as long as the ID
+// can be decoded.
+func unverifiedSnapshotEntry(snapshotID string) (*csi.ListSnapshotsResponse_Entry, error) {
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(snapshotID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidVolID, err)
+	}
+
+	return &csi.ListSnapshotsResponse_Entry{
+		Snapshot: &csi.Snapshot{
+			SnapshotId: snapshotID,
+			ReadyToUse: true,
+		},
+	}, nil
+}
+
+// attributeFetcher reads the attributes of reservations in a journal.
+type attributeFetcher interface {
+	FetchAttribute(ctx context.Context, pool, reservedUUID, attribute string) (string, error)
+}
+
+// snapshotSource returns the name of the image the snapshot was created
+// from. The attribute is stored in the journal pool of the snapshot, which
+// is not the pool of its image when the StorageClass sets a journalPool.
+func snapshotSource(ctx context.Context, j attributeFetcher, rbdSnap *rbdSnapshot) (string, error) {
+	return j.FetchAttribute(ctx, rbdSnap.JournalPool, rbdSnap.ReservedID, snapSourceAttribute)
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceVolumeID(t *testing.T) {
+	t.Parallel()
+
+	snapshotID := "0001-0009-cluster-1-0000000000000003-2c0b4a3e-7c1f-4b8a-9d5e-3f6a1b2c3d4e"
+
+	tests := []struct {
+		name   string
+		snap   journaledObject
+		wantID string
+	}{
+		{
+			name: "image with default prefix",
+			snap: journaledObject{
+				id:    snapshotID,
+				value: "csi-vol-8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+			},
+			wantID: "0001-0009-cluster-1-0000000000000003-8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+		},
+		{
+			name: "image with custom prefix",
+			snap: journaledObject{
+				id:    snapshotID,
+				value: "tenant-a-8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+			},
+			wantID: "0001-0009-cluster-1-0000000000000003-8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+		},
+		{
+			name: "image without UUID",
+			snap: journaledObject{
+				id:    snapshotID,
+				value: "static-image",
+			},
+		},
+		{
+			name: "invalid snapshot ID",
+			snap: journaledObject{
+				id:    "invalid",
+				value: "csi-vol-8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.wantID, sourceVolumeID(tt.snap))
+		})
+	}
+}
+
+// fakeJournal holds the attributes of reservations per pool and UUID.
+type fakeJournal map[string]map[string]map[string]string
+
+func (fj fakeJournal) FetchAttribute(_ context.Context, pool, reservedUUID, attribute string) (string, error) {
+	value, ok := fj[pool][reservedUUID][attribute]
+	if !ok {
+		return "", fmt.Errorf("attribute %q of %q not found in pool %q", attribute, reservedUUID, pool)
+	}
+
+	return value, nil
+}
+
+func TestSnapshotSource(t *testing.T) {
+	t.Parallel()
+
+	reservedID := "2c0b4a3e-7c1f-4b8a-9d5e-3f6a1b2c3d4e"
+	source := "csi-vol-8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3"
+	j := fakeJournal{
+		"journal-pool": {
+			reservedID: {snapSourceAttribute: source},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		snap    *rbdSnapshot
+		wantErr bool
+	}{
+		{
+			name: "separate journal pool",
+			snap: &rbdSnapshot{rbdImage: rbdImage{
+				Pool:        "image-pool",
+				JournalPool: "journal-pool",
+				ReservedID:  reservedID,
+			}},
+		},
+		{
+			name: "journal in image pool",
+			snap: &rbdSnapshot{rbdImage: rbdImage{
+				Pool:        "journal-pool",
+				JournalPool: "journal-pool",
+				ReservedID:  reservedID,
+			}},
+		},
+		{
+			name: "unknown reservation",
+			snap: &rbdSnapshot{rbdImage: rbdImage{
+				Pool:        "image-pool",
+				JournalPool: "journal-pool",
+				ReservedID:  "8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := snapshotSource(context.TODO(), j, tt.snap)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, source, got)
+		})
+	}
+}
+
+func TestUnverifiedSnapshotEntry(t *testing.T) {
+	t.Parallel()
+
+	snapshotID := "0001-0009-cluster-1-0000000000000003-2c0b4a3e-7c1f-4b8a-9d5e-3f6a1b2c3d4e"
+	entry, err := unverifiedSnapshotEntry(snapshotID)
+	require.NoError(t, err)
+	require.Equal(t, snapshotID, entry.GetSnapshot().GetSnapshotId())
+	require.True(t, entry.GetSnapshot().GetReadyToUse())
+
+	_, err = unverifiedSnapshotEntry("invalid")
+	require.ErrorIs(t, err, ErrInvalidVolID)
+}
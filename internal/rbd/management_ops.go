@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/ceph/go-ceph/rbd/admin"
+)
+
+// managementOpsKey is the key in the image metadata that overrides the
+// rbd_concurrent_management_ops option of librbd for the image. librbd reads
+// the option when the image is opened, by this process or the Ceph Manager.
+const managementOpsKey = "conf_rbd_concurrent_management_ops"
+
+// flattenTaskInterval is the interval in which the provisioner checks if a
+// flatten task of the Ceph Manager finished.
+const flattenTaskInterval = time.Minute
+
+// flattenTaskWatchers contains the images of which the flatten task is
+// watched already.
+var flattenTaskWatchers sync.Map
+
+// getManagementOps returns the configured rbd_concurrent_management_ops for
+// the operation, 0 means that the Ceph default is used.
+func getManagementOps(ops kubernetes.ManagementOps, op util.OperationType) int {
+	switch op {
+	case util.FlattenOperation:
+		return ops.Flatten
+	case util.SparsifyOperation:
+		return ops.Sparsify
+	}
+
+	return 0
+}
+
+// setManagementOps stores the rbd_concurrent_management_ops that are
+// configured for the operation in the image metadata, so that the operation
+// does not issue more object operations in parallel. Failures are logged, the
+// operation runs with the Ceph default in that case.
+func (ri *rbdImage) setManagementOps(ctx context.Context, op util.OperationType) {
+	ops, err := util.GetRBDManagementOps(util.CsiConfigFile, ri.ClusterID)
+	if err != nil {
+		log.WarningLog(ctx, "failed to get the management ops of cluster %q: %v", ri.ClusterID, err)
+
+		return
+	}
+
+	value := getManagementOps(ops, op)
+	if value <= 0 {
+		return
+	}
+
+	err = ri.SetMetadata(managementOpsKey, strconv.Itoa(value))
+	if err != nil {
+		log.WarningLog(ctx, "failed to set %s for the %s of image %s: %v", managementOpsKey, op, ri, err)
+	}
+}
+
+// resetManagementOps removes the rbd_concurrent_management_ops from the image
+// metadata again, once the operation finished.
+func (ri *rbdImage) resetManagementOps(ctx context.Context) {
+	err := ri.RemoveMetadata(managementOpsKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		log.WarningLog(ctx, "failed to remove %s from image %s: %v", managementOpsKey, ri, err)
+	}
+}
+
+// watchFlattenTask waits in the background until the Ceph Manager finished
+// the flatten task of the image. The rbd_concurrent_management_ops are then
+// removed from the image metadata, and the limits of the flatten are
+// released. Nothing happens when the task is watched already.
+func (ri *rbdImage) watchFlattenTask(ctx context.Context, taskID string) {
+	key := ri.ClusterID + "/" + ri.String()
+	if _, loaded := flattenTaskWatchers.LoadOrStore(key, taskID); loaded {
+		return
+	}
+
+	image := &rbdImage{
+		ClusterID:      ri.ClusterID,
+		Pool:           ri.Pool,
+		RadosNamespace: ri.RadosNamespace,
+		RbdImageName:   ri.RbdImageName,
+		conn:           ri.conn.Copy(),
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), util.BackgroundOperationTimeout)
+		defer cancel()
+		defer flattenTaskWatchers.Delete(key)
+		defer image.Destroy(ctx)
+
+		ta, err := image.conn.GetTaskAdmin()
+		if err != nil {
+			log.WarningLog(ctx, "failed to watch the flatten task of image %s: %v", image, err)
+		} else {
+			waitForTask(ctx, ta.GetTaskByID, taskID, flattenTaskInterval)
+		}
+
+		image.resetManagementOps(ctx)
+		util.FinishBackgroundOperation(image.ClusterID, util.FlattenOperation, image.String())
+	}()
+}
+
+// waitForTask returns once getTask does not return the task anymore, which
+// means that the Ceph Manager finished it, or when the ctx is done.
+func waitForTask(
+	ctx context.Context,
+	getTask func(taskID string) (admin.TaskResponse, error),
+	taskID string,
+	interval time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.WarningLog(ctx, "stopped waiting for task %s: %v", taskID, ctx.Err())
+
+			return
+		case <-ticker.C:
+		}
+
+		_, err := getTask(taskID)
+		if err != nil {
+			log.DebugLog(ctx, "task %s is not listed anymore: %v", taskID, err)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/ceph/go-ceph/rbd/admin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetManagementOps(t *testing.T) {
+	t.Parallel()
+
+	ops := kubernetes.ManagementOps{Flatten: 2, Sparsify: 4}
+	tests := []struct {
+		name string
+		op   util.OperationType
+		want int
+	}{
+		{"flatten", util.FlattenOperation, 2},
+		{"sparsify", util.SparsifyOperation, 4},
+		{"resync uses the rbd-mirror configuration", util.ResyncOperation, 0},
+		{"other operations use the Ceph default", util.CreateOperation, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, getManagementOps(ops, tt.op))
+		})
+	}
+}
+
+func TestWaitForTask(t *testing.T) {
+	t.Parallel()
+
+	t.Run("until the task is not listed", func(t *testing.T) {
+		t.Parallel()
+
+		calls := 0
+		getTask := func(taskID string) (admin.TaskResponse, error) {
+			calls++
+			if calls < 3 {
+				return admin.TaskResponse{ID: taskID, InProgress: true}, nil
+			}
+
+			return admin.TaskResponse{}, errors.New("task not found")
+		}
+
+		waitForTask(context.TODO(), getTask, "task-1", time.Millisecond)
+		require.Equal(t, 3, calls)
+	})
+
+	t.Run("until the ctx is done", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		getTask := func(taskID string) (admin.TaskResponse, error) {
+			return admin.TaskResponse{ID: taskID, InProgress: true}, nil
+		}
+
+		waitForTask(ctx, getTask, "task-1", time.Hour)
+	})
+}
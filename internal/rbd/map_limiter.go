@@ -0,0 +1,238 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+)
+
+const (
+	// mapBackoffBase is the time a map of an image is delayed after the
+	// first failed map, doubled with every further failure up to
+	// mapBackoffMax.
+	mapBackoffBase = time.Second
+	mapBackoffMax  = 2 * time.Minute
+)
+
+// errMapBackoff is returned when the map of an image is delayed for longer
+// than the deadline of the request, because the previous map failed. It
+// wraps EAGAIN, so that the CO retries the request.
+var errMapBackoff = fmt.Errorf("previous map of the image failed: %w", syscall.EAGAIN)
+
+// nodeMapLimiter limits the rate of the maps of the node, configured with
+// SetMapRate.
+var nodeMapLimiter = newMapLimiter(0, time.Now)
+
+// SetMapRate sets the number of RBD images that can be mapped per second on
+// the node, unlimited when 0.
+func SetMapRate(rate float64) {
+	interval := time.Duration(0)
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	nodeMapLimiter.mu.Lock()
+	defer nodeMapLimiter.mu.Unlock()
+
+	nodeMapLimiter.interval = interval
+}
+
+// mapLimiter limits the rate of the maps of images, so that many NodeStage
+// requests at once (like after a reboot of the node) do not overload the
+// node and the monitors. The maps start in the order of the requests, every
+// image gets a turn before an image that is mapped again. Maps of an image
+// whose previous map failed are delayed with an exponential backoff.
+type mapLimiter struct {
+	now func() time.Time
+
+	mu sync.Mutex
+	// interval is the time between the start of two maps, unlimited when 0
+	interval time.Duration
+	// next is the time the next map can start
+	next time.Time
+	// waiting is the number of maps that wait for their turn
+	waiting int
+	// failures contains the images whose last map failed
+	failures map[string]mapFailure
+}
+
+// mapFailure records the failed maps of an image.
+type mapFailure struct {
+	count int
+	last  time.Time
+}
+
+func newMapLimiter(interval time.Duration, now func() time.Time) *mapLimiter {
+	return &mapLimiter{
+		now:      now,
+		interval: interval,
+		failures: map[string]mapFailure{},
+	}
+}
+
+// backoff returns the time a map of the image needs to wait after the
+// previous failed map.
+func (f mapFailure) backoff() time.Duration {
+	if f.count == 0 {
+		return 0
+	}
+
+	backoff := mapBackoffBase
+	for range f.count - 1 {
+		backoff *= 2
+		if backoff >= mapBackoffMax {
+			return mapBackoffMax
+		}
+	}
+
+	return backoff
+}
+
+// reserve returns the time the map of the image can start. The second
+// return value is set when the map is delayed by a previous failure, the
+// third when the map is counted as waiting, done needs to be called for it
+// then.
+func (ml *mapLimiter) reserve(image string) (time.Time, bool, bool) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := ml.now()
+	start := now
+	delayed := false
+	if f, ok := ml.failures[image]; ok {
+		if retry := f.last.Add(f.backoff()); retry.After(start) {
+			start = retry
+			delayed = true
+		}
+	}
+
+	if ml.interval > 0 {
+		// the images that are not delayed take the next free turn, a
+		// delayed image the first turn after its backoff
+		if ml.next.After(start) {
+			start = ml.next
+		}
+		ml.next = start.Add(ml.interval)
+	}
+
+	if !start.After(now) {
+		return start, delayed, false
+	}
+
+	ml.waiting++
+	metrics.SetMapQueueDepth(ml.waiting)
+
+	return start, delayed, true
+}
+
+// release returns the turn of a map that was not started.
+func (ml *mapLimiter) release(start time.Time) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if ml.interval > 0 && ml.next.Equal(start.Add(ml.interval)) {
+		ml.next = start
+	}
+}
+
+// done records that a map waited for its turn.
+func (ml *mapLimiter) done() {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.waiting--
+	metrics.SetMapQueueDepth(ml.waiting)
+}
+
+// record records the result of the map of the image. The failures of an
+// image are forgotten when it was not mapped for twice the mapBackoffMax.
+func (ml *mapLimiter) record(image string, err error) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	if err == nil {
+		delete(ml.failures, image)
+
+		return
+	}
+
+	now := ml.now()
+	f := ml.failures[image]
+	f.count++
+	f.last = now
+	ml.failures[image] = f
+
+	// forget the images that were not mapped again for a while
+	for img, f := range ml.failures {
+		if now.Sub(f.last) > 2*mapBackoffMax {
+			delete(ml.failures, img)
+		}
+	}
+}
+
+// run maps the image with mapImage once it is the turn of the image.
+// errMapBackoff is returned when the turn is after the deadline of the
+// context.
+func (ml *mapLimiter) run(ctx context.Context, image string, mapImage func() (string, error)) (string, error) {
+	start, delayed, waiting := ml.reserve(image)
+	if waiting {
+		defer ml.done()
+	}
+
+	// the turn can pass before the wait is calculated
+	wait := start.Sub(ml.now())
+	if wait > 0 {
+		if delayed {
+			metrics.CountMapBackoff()
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && deadline.Before(start) {
+			ml.release(start)
+			if delayed {
+				return "", fmt.Errorf("%w: %s can be mapped again in %s", errMapBackoff, image, wait.Round(time.Second))
+			}
+
+			return "", fmt.Errorf("%w: %s can not be mapped before the deadline", syscall.EAGAIN, image)
+		}
+
+		log.DebugLog(ctx, "waiting %s for the turn to map %s", wait, image)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			ml.release(start)
+
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	devicePath, err := mapImage()
+	if ctx.Err() == nil {
+		ml.record(image, err)
+	}
+
+	return devicePath, err
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapFailureBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		count int
+		want  time.Duration
+	}{
+		{
+			name:  "no failure",
+			count: 0,
+			want:  0,
+		},
+		{
+			name:  "first failure",
+			count: 1,
+			want:  mapBackoffBase,
+		},
+		{
+			name:  "third failure",
+			count: 3,
+			want:  4 * mapBackoffBase,
+		},
+		{
+			name:  "many failures",
+			count: 100,
+			want:  mapBackoffMax,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, mapFailure{count: tt.count}.backoff())
+		})
+	}
+}
+
+func TestMapLimiterReserve(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ml := newMapLimiter(time.Second, func() time.Time { return now })
+
+	// the maps take turns in the order of the requests
+	for i, image := range []string{"pool/a", "pool/b", "pool/c"} {
+		start, delayed, waiting := ml.reserve(image)
+		require.Equal(t, now.Add(time.Duration(i)*time.Second), start)
+		require.False(t, delayed)
+		// only the maps after the first one wait for their turn
+		require.Equal(t, i > 0, waiting)
+	}
+	require.Equal(t, 2, ml.waiting)
+
+	// a returned turn is taken by the next map
+	start, _, _ := ml.reserve("pool/d")
+	ml.release(start)
+	again, _, _ := ml.reserve("pool/e")
+	require.Equal(t, start, again)
+
+	// a failed image waits for its backoff (2s), and takes the first
+	// free turn afterwards
+	ml.record("pool/a", errors.New("map failed"))
+	ml.record("pool/a", errors.New("map failed"))
+	start, delayed, _ := ml.reserve("pool/a")
+	require.True(t, delayed)
+	require.Equal(t, now.Add(4*time.Second), start)
+
+	ml.record("pool/a", nil)
+	require.Empty(t, ml.failures)
+}
+
+func TestMapLimiterRun(t *testing.T) {
+	t.Parallel()
+
+	ml := newMapLimiter(0, time.Now)
+	mapErr := errors.New("map failed")
+
+	_, err := ml.run(context.Background(), "pool/a", func() (string, error) { return "", mapErr })
+	require.ErrorIs(t, err, mapErr)
+
+	// the backoff of the failed image is longer than the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), mapBackoffBase/10)
+	defer cancel()
+	_, err = ml.run(ctx, "pool/a", func() (string, error) { return "/dev/rbd0", nil })
+	require.ErrorIs(t, err, errMapBackoff)
+	require.ErrorIs(t, err, syscall.EAGAIN)
+
+	// other images are not delayed
+	devicePath, err := ml.run(context.Background(), "pool/b", func() (string, error) { return "/dev/rbd0", nil })
+	require.NoError(t, err)
+	require.Equal(t, "/dev/rbd0", devicePath)
+}
+
+func TestMapLimiterRunWaiting(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	ml := newMapLimiter(time.Second, func() time.Time { return now })
+
+	// the first map takes the current turn, the next map waits
+	_, _, waiting := ml.reserve("pool/a")
+	require.False(t, waiting)
+
+	// the turn of the map passes between the reservation and the check of
+	// the wait, the map is not counted as waiting afterwards
+	calls := 0
+	ml.now = func() time.Time {
+		calls++
+		if calls == 1 {
+			return start
+		}
+
+		return start.Add(2 * time.Second)
+	}
+	_, err := ml.run(context.Background(), "pool/b", func() (string, error) { return "/dev/rbd0", nil })
+	require.NoError(t, err)
+	require.Equal(t, 0, ml.waiting)
+}
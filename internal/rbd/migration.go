@@ -19,6 +19,7 @@ package rbd
 import (
 	"context"
 	"encoding/hex"
+	"fmt"
 	"strings"
 
 	"github.com/ceph/ceph-csi/internal/util"
@@ -115,3 +116,68 @@ func genVolFromMigVolID(ctx context.Context, migVolID *migrationVolID, cr *util.
 
 	return rv, nil
 }
+
+// genVolFromMigVolIDWithImageInfo populates an rbdVolume from the migration
+// volID like genVolFromMigVolID, and reads the size and features of the image
+// from the cluster. The encryption of images that were encrypted with the
+// passphrase from the secrets is configured as well. The data pool of erasure
+// coded images does not need to be known, it is handled by librbd.
+func genVolFromMigVolIDWithImageInfo(
+	ctx context.Context,
+	migVolID *migrationVolID,
+	cr *util.Credentials,
+	secrets map[string]string,
+) (*rbdVolume, error) {
+	rv, err := genVolFromMigVolID(ctx, migVolID, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rv.getImageInfo()
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get image details %s: %v", rv, err)
+		rv.Destroy(ctx)
+
+		return nil, err
+	}
+
+	err = rv.initMigratedKMS(ctx, nil, secrets)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to configure encryption of %s: %v", rv, err)
+		rv.Destroy(ctx)
+
+		return nil, err
+	}
+
+	return rv, nil
+}
+
+// initMigratedKMS configures the encryption of a migrated in-tree volume.
+// The encryption options from the volume context are used when they are set.
+// Otherwise the encryption state in the image metadata is checked, and block
+// encryption is configured for encrypted images with the KMS of the
+// "encryptionKMSID" in the volume context, or with the passphrase from the
+// secrets when no KMS is set.
+func (rv *rbdVolume) initMigratedKMS(ctx context.Context, volContext, secrets map[string]string) error {
+	if _, ok := volContext["encrypted"]; ok {
+		return rv.initKMS(ctx, volContext, secrets)
+	}
+
+	state, err := rv.checkRbdImageEncrypted(ctx)
+	if err != nil {
+		return err
+	}
+
+	if state != rbdImageEncrypted && state != rbdImageEncryptionPrepared {
+		return nil
+	}
+
+	log.DebugLog(ctx, "migrated image %s is encrypted (state %q)", rv, state)
+
+	err = rv.configureBlockEncryption(volContext["encryptionKMSID"], secrets)
+	if err != nil {
+		return fmt.Errorf("invalid encryption kms configuration: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// forceDeleteMirroredParam is the StorageClass parameter that allows
+	// deleting volumes with images that are mirrored, but not primary.
+	forceDeleteMirroredParam = "forceDeleteMirrored"
+
+	// forceDeleteMirroredAttribute is the attribute in the journal that is
+	// set when the volume was created with forceDeleteMirrored. The
+	// StorageClass parameters are not passed to DeleteVolume.
+	forceDeleteMirroredAttribute = "forcedeletemirrored"
+)
+
+// parseForceDeleteMirrored returns the forceDeleteMirrored parameter of the
+// StorageClass, false when it is not set.
+func parseForceDeleteMirrored(volOptions map[string]string) (bool, error) {
+	val, ok := volOptions[forceDeleteMirroredParam]
+	if !ok {
+		return false, nil
+	}
+
+	force, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s %q: %w", forceDeleteMirroredParam, val, err)
+	}
+
+	return force, nil
+}
+
+// storeForceDeleteMirrored stores the forceDeleteMirrored parameter of the
+// volume in the journal, it is only stored when set.
+func (rv *rbdVolume) storeForceDeleteMirrored(ctx context.Context, j *journal.Connection) error {
+	if !rv.ForceDeleteMirrored {
+		return nil
+	}
+
+	return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, forceDeleteMirroredAttribute,
+		strconv.FormatBool(rv.ForceDeleteMirrored))
+}
+
+// fetchForceDeleteMirrored returns the forceDeleteMirrored parameter of the
+// volume from the journal, false when the volume has none.
+func (rv *rbdVolume) fetchForceDeleteMirrored(ctx context.Context, cr *util.Credentials) (bool, error) {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return false, err
+	}
+	defer j.Destroy()
+
+	val, err := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, forceDeleteMirroredAttribute)
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	force, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q of volume %s: %w", forceDeleteMirroredAttribute, val, rv, err)
+	}
+
+	return force, nil
+}
+
+// mirroringAllowsDeletion returns true when an image with the mirroring state
+// can be deleted without breaking the replication. Images that are not
+// mirrored and primary images can be deleted, the secondary images follow
+// the primary.
+func mirroringAllowsDeletion(state string, primary bool) bool {
+	switch state {
+	case librbd.MirrorImageDisabled.String():
+		return true
+	case librbd.MirrorImageEnabled.String():
+		return primary
+	}
+
+	return false
+}
+
+// checkMirroredDeletion returns a FailedPrecondition error when the image of
+// the volume is mirrored, but not primary, unless the volume was created with
+// forceDeleteMirrored. Mirroring is disabled on forced deletions, so that the
+// image can be removed.
+func (rv *rbdVolume) checkMirroredDeletion(
+	ctx context.Context,
+	cr *util.Credentials,
+	info types.MirrorInfo,
+) error {
+	if mirroringAllowsDeletion(info.GetState(), info.IsPrimary()) {
+		return nil
+	}
+
+	force, err := rv.fetchForceDeleteMirrored(ctx, cr)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	if !force {
+		return status.Errorf(codes.FailedPrecondition,
+			"refusing to delete image %s with mirroring state %q (primary=%t), disable mirroring "+
+				"on the image or set %s in the StorageClass",
+			rv, info.GetState(), info.IsPrimary(), forceDeleteMirroredParam)
+	}
+
+	log.WarningLog(ctx, "forcing deletion of image %s with mirroring state %q (primary=%t)",
+		rv, info.GetState(), info.IsPrimary())
+
+	err = rv.DisableMirroring(ctx, true)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+
+	return nil
+}
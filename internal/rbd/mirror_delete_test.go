@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForceDeleteMirrored(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "not set",
+			options: map[string]string{},
+			want:    false,
+		},
+		{
+			name:    "true",
+			options: map[string]string{forceDeleteMirroredParam: "true"},
+			want:    true,
+		},
+		{
+			name:    "false",
+			options: map[string]string{forceDeleteMirroredParam: "false"},
+			want:    false,
+		},
+		{
+			name:    "invalid",
+			options: map[string]string{forceDeleteMirroredParam: "always"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseForceDeleteMirrored(tt.options)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMirroringAllowsDeletion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		state   librbd.MirrorImageState
+		primary bool
+		want    bool
+	}{
+		{
+			name:  "disabled",
+			state: librbd.MirrorImageDisabled,
+			want:  true,
+		},
+		{
+			name:    "enabled primary",
+			state:   librbd.MirrorImageEnabled,
+			primary: true,
+			want:    true,
+		},
+		{
+			name:  "enabled secondary",
+			state: librbd.MirrorImageEnabled,
+			want:  false,
+		},
+		{
+			name:    "disabling",
+			state:   librbd.MirrorImageDisabling,
+			primary: true,
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, mirroringAllowsDeletion(tt.state.String(), tt.primary))
+		})
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// mirrorPeerDirections are the directions of the mirroring with an imported
+// peer, by the names that `rbd mirror pool peer bootstrap import` uses.
+var mirrorPeerDirections = map[string]librbd.MirrorPeerDirection{
+	"rx-only": librbd.MirrorPeerDirectionRx,
+	"rx-tx":   librbd.MirrorPeerDirectionRxTx,
+}
+
+// ValidateMirrorPeerDirection returns an error when the direction is not
+// rx-only or rx-tx.
+func ValidateMirrorPeerDirection(direction string) error {
+	if _, ok := mirrorPeerDirections[direction]; !ok {
+		return fmt.Errorf("%w: mirror peer direction %q is not rx-only or rx-tx", ErrInvalidArgument, direction)
+	}
+
+	return nil
+}
+
+// CreateMirrorPeerBootstrapToken creates a bootstrap token for the pool of the
+// cluster, that is imported on the peer cluster to mirror the pool. The user
+// of the credentials needs permissions to create the client.rbd-mirror-peer
+// user, whose key is part of the token.
+func CreateMirrorPeerBootstrapToken(
+	ctx context.Context,
+	clusterID, pool string,
+	cr *util.Credentials,
+) (string, error) {
+	var token string
+	err := withPoolIoctx(clusterID, pool, cr, func(ioctx *rados.IOContext) error {
+		var err error
+		token, err = librbd.CreateMirrorPeerBootstrapToken(ioctx)
+		if err != nil {
+			return fmt.Errorf("failed to create mirror peer bootstrap token for pool %q: %w", pool, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	log.DebugLog(ctx, "created mirror peer bootstrap token for pool %q of cluster %q", pool, clusterID)
+
+	return token, nil
+}
+
+// ImportMirrorPeerBootstrapToken imports the bootstrap token of the peer
+// cluster for the pool of the cluster, and enables the mirroring of the pool
+// in the direction.
+func ImportMirrorPeerBootstrapToken(
+	ctx context.Context,
+	clusterID, pool, direction, token string,
+	cr *util.Credentials,
+) error {
+	if err := ValidateMirrorPeerDirection(direction); err != nil {
+		return err
+	}
+
+	err := withPoolIoctx(clusterID, pool, cr, func(ioctx *rados.IOContext) error {
+		err := librbd.ImportMirrorPeerBootstrapToken(ioctx, mirrorPeerDirections[direction], token)
+		if err != nil {
+			return fmt.Errorf("failed to import mirror peer bootstrap token for pool %q: %w", pool, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.DebugLog(ctx, "imported mirror peer bootstrap token for pool %q of cluster %q (%s)",
+		pool, clusterID, direction)
+
+	return nil
+}
+
+// withPoolIoctx connects to the monitors of the cluster with the credentials
+// and calls fn with the IO context of the pool.
+func withPoolIoctx(clusterID, pool string, cr *util.Credentials, fn func(*rados.IOContext) error) error {
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch monitors using clusterID (%s): %w", clusterID, err)
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to cluster %q for pool %q: %w", clusterID, pool, err)
+	}
+	defer conn.Destroy()
+
+	ioctx, err := conn.GetIoctx(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	return fn(ioctx)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// mkfsOptionsParam is the StorageClass parameter with the options that are
+// passed to mkfs when a new filesystem is created on the volume.
+const mkfsOptionsParam = "mkfsOptions"
+
+// mkfsOptionName returns the name of a mkfs option. Short options may have
+// the value appended (`-Obigalloc`), long options can contain the value after
+// a `=` (`--sectorsize=4096`).
+func mkfsOptionName(arg string) string {
+	if strings.HasPrefix(arg, "--") {
+		name, _, _ := strings.Cut(arg, "=")
+
+		return name
+	}
+
+	if len(arg) > 2 {
+		return arg[:2]
+	}
+
+	return arg
+}
+
+// validateMkfsOptions checks that all options in mkfsOptions are part of the
+// allowList. Arguments that do not start with a `-` are values of the option
+// before it. All options are valid when the allowList is empty.
+func validateMkfsOptions(mkfsOptions string, allowList []string) error {
+	args := strings.Fields(mkfsOptions)
+	if len(args) != 0 && !strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("%w: %s %q does not start with an option", ErrInvalidArgument, mkfsOptionsParam, mkfsOptions)
+	}
+
+	if len(allowList) == 0 {
+		return nil
+	}
+
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name := mkfsOptionName(arg)
+		if !slices.Contains(allowList, name) {
+			return fmt.Errorf("%w: mkfs option %q is not in the allow list %v", ErrInvalidArgument, name, allowList)
+		}
+	}
+
+	return nil
+}
+
+// validateConfiguredMkfsOptions validates the mkfsOptions against the allow
+// list that is configured for the cluster.
+func validateConfiguredMkfsOptions(clusterID, mkfsOptions string) error {
+	if mkfsOptions == "" {
+		return nil
+	}
+
+	allowList, err := util.GetRBDMkfsOptionsAllowList(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+
+	return validateMkfsOptions(mkfsOptions, allowList)
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// mkfsAlignmentParam is the StorageClass parameter that disables the
+	// alignment of new filesystems to the striping of the image.
+	mkfsAlignmentParam = "mkfsAlignment"
+
+	// fsBlockSize is the default block size of xfs, and of ext4 filesystems
+	// of ext4MinAlignSize and larger. The stripe unit needs to be a multiple
+	// of it, stride and stripe_width of ext4 are in blocks.
+	fsBlockSize = 4096
+	// ext4MinAlignSize is the size below which mke2fs uses smaller blocks
+	// (the "small" and "floppy" types in mke2fs.conf), these filesystems
+	// are not aligned.
+	ext4MinAlignSize = 512 << 20
+)
+
+// stripeGeometry contains the striping of an image. A stripe unit of data is
+// written to an object, before the next stripe unit is written to the next
+// of stripeCount objects.
+type stripeGeometry struct {
+	stripeUnit  uint64
+	stripeCount uint64
+}
+
+// parseMkfsAlignment returns whether new filesystems should be aligned to the
+// striping of the image, which is the default.
+func parseMkfsAlignment(volumeContext map[string]string) (bool, error) {
+	val, ok := volumeContext[mkfsAlignmentParam]
+	if !ok || val == "" {
+		return true, nil
+	}
+
+	align, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid %s %q: %w", ErrInvalidArgument, mkfsAlignmentParam, val, err)
+	}
+
+	return align, nil
+}
+
+// getStripeGeometry returns the striping of the image.
+func (ri *rbdImage) getStripeGeometry() (*stripeGeometry, error) {
+	image, err := ri.open()
+	if err != nil {
+		return nil, err
+	}
+	defer image.Close()
+
+	stripeUnit, err := image.GetStripeUnit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the stripe unit of image %s: %w", ri, err)
+	}
+
+	stripeCount, err := image.GetStripeCount()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the stripe count of image %s: %w", ri, err)
+	}
+
+	return &stripeGeometry{stripeUnit: stripeUnit, stripeCount: stripeCount}, nil
+}
+
+// alignMkfsArgs adds the options to the mkfs arguments that align the new
+// filesystem to the striping of the image, so that sequential writes fill
+// whole objects. Failures to get the striping are logged, the filesystem is
+// created without alignment then.
+func (rv *rbdVolume) alignMkfsArgs(ctx context.Context, fsType string, args []string) []string {
+	if fsType != "ext4" && fsType != "xfs" {
+		return args
+	}
+
+	geo, err := rv.getStripeGeometry()
+	if err != nil {
+		log.WarningLog(ctx, "not aligning the filesystem of %s to the striping: %v", rv, err)
+
+		return args
+	}
+
+	aligned := geo.mkfsArgs(fsType, args, rv.VolSize)
+	if !slices.Equal(aligned, args) {
+		log.DebugLog(ctx, "aligning the filesystem of %s to stripe unit %d and stripe count %d",
+			rv, geo.stripeUnit, geo.stripeCount)
+	}
+
+	return aligned
+}
+
+// mkfsArgs returns the mkfs arguments with the alignment options for the
+// filesystem type. The arguments are returned unchanged when they contain
+// alignment options already, or when the filesystem can not be aligned.
+func (geo *stripeGeometry) mkfsArgs(fsType string, args []string, size int64) []string {
+	if geo.stripeUnit == 0 || geo.stripeCount == 0 {
+		return args
+	}
+
+	switch fsType {
+	case "ext4":
+		return geo.ext4Args(args, size)
+	case "xfs":
+		return geo.xfsArgs(args)
+	}
+
+	return args
+}
+
+// ext4Args adds stride and stripe_width to the extended options of mke2fs.
+// mke2fs only uses the last -E argument, the options are added to an
+// existing one.
+func (geo *stripeGeometry) ext4Args(args []string, size int64) []string {
+	if size < ext4MinAlignSize || geo.stripeUnit%fsBlockSize != 0 {
+		return args
+	}
+	if containsMkfsArg(args, "-b", "stride=", "stripe_width=", "stripe-width=") {
+		return args
+	}
+
+	stride := geo.stripeUnit / fsBlockSize
+	options := fmt.Sprintf("stride=%d,stripe_width=%d", stride, stride*geo.stripeCount)
+
+	args = slices.Clone(args)
+	for i := len(args) - 1; i >= 0; i-- {
+		switch {
+		case args[i] == "-E" && i+1 < len(args):
+			args[i+1] += "," + options
+
+			return args
+		case strings.HasPrefix(args[i], "-E"):
+			args[i] += "," + options
+
+			return args
+		}
+	}
+
+	return append(args, "-E", options)
+}
+
+// xfsArgs adds the stripe unit and width in the data section options of
+// mkfs.xfs.
+func (geo *stripeGeometry) xfsArgs(args []string) []string {
+	if geo.stripeUnit%fsBlockSize != 0 {
+		return args
+	}
+	if containsMkfsArg(args, "su=", "sunit=", "sw=", "swidth=") {
+		return args
+	}
+
+	return append(slices.Clone(args), "-d", fmt.Sprintf("su=%d,sw=%d", geo.stripeUnit, geo.stripeCount))
+}
+
+// containsMkfsArg returns true when one of the arguments, or one of the comma
+// separated options in an argument, starts with one of the prefixes. The flag
+// in front of an option, like "-E" in "-Estride=16", is ignored.
+func containsMkfsArg(args []string, prefixes ...string) bool {
+	for _, arg := range args {
+		for _, option := range strings.Split(arg, ",") {
+			if len(option) > 2 && option[0] == '-' && strings.Contains(option, "=") {
+				option = option[2:]
+			}
+
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(option, prefix) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
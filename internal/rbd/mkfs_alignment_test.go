@@ -0,0 +1,166 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMkfsAlignment(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		ctx     map[string]string
+		want    bool
+		wantErr bool
+	}{
+		{"not set", map[string]string{}, true, false},
+		{"empty", map[string]string{mkfsAlignmentParam: ""}, true, false},
+		{"enabled", map[string]string{mkfsAlignmentParam: "true"}, true, false},
+		{"disabled", map[string]string{mkfsAlignmentParam: "false"}, false, false},
+		{"invalid", map[string]string{mkfsAlignmentParam: "maybe"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseMkfsAlignment(tt.ctx)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidArgument)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStripeGeometryMkfsArgs(t *testing.T) {
+	t.Parallel()
+	defaultGeo := stripeGeometry{stripeUnit: 4 << 20, stripeCount: 1}
+	stripedGeo := stripeGeometry{stripeUnit: 64 << 10, stripeCount: 16}
+	tests := []struct {
+		name   string
+		geo    stripeGeometry
+		fsType string
+		args   []string
+		size   int64
+		want   []string
+	}{
+		{
+			name:   "ext4 default striping",
+			geo:    defaultGeo,
+			fsType: "ext4",
+			args:   []string{"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1"},
+			size:   1 << 30,
+			want:   []string{"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1,stride=1024,stripe_width=1024"},
+		},
+		{
+			name:   "ext4 separate -E",
+			geo:    stripedGeo,
+			fsType: "ext4",
+			args:   []string{"-E", "nodiscard"},
+			size:   1 << 30,
+			want:   []string{"-E", "nodiscard,stride=16,stripe_width=256"},
+		},
+		{
+			name:   "ext4 without -E",
+			geo:    stripedGeo,
+			fsType: "ext4",
+			args:   []string{"-m0"},
+			size:   1 << 30,
+			want:   []string{"-m0", "-E", "stride=16,stripe_width=256"},
+		},
+		{
+			name:   "ext4 small volume",
+			geo:    defaultGeo,
+			fsType: "ext4",
+			args:   []string{"-m0"},
+			size:   256 << 20,
+			want:   []string{"-m0"},
+		},
+		{
+			name:   "ext4 stride set",
+			geo:    defaultGeo,
+			fsType: "ext4",
+			args:   []string{"-Estride=8"},
+			size:   1 << 30,
+			want:   []string{"-Estride=8"},
+		},
+		{
+			name:   "ext4 block size set",
+			geo:    defaultGeo,
+			fsType: "ext4",
+			args:   []string{"-b", "1024"},
+			size:   1 << 30,
+			want:   []string{"-b", "1024"},
+		},
+		{
+			name:   "xfs default striping",
+			geo:    defaultGeo,
+			fsType: "xfs",
+			args:   []string{"-K"},
+			want:   []string{"-K", "-d", "su=4194304,sw=1"},
+		},
+		{
+			name:   "xfs striped",
+			geo:    stripedGeo,
+			fsType: "xfs",
+			args:   []string{"-K"},
+			want:   []string{"-K", "-d", "su=65536,sw=16"},
+		},
+		{
+			name:   "xfs sunit set",
+			geo:    defaultGeo,
+			fsType: "xfs",
+			args:   []string{"-K", "-d", "sunit=8,swidth=8"},
+			want:   []string{"-K", "-d", "sunit=8,swidth=8"},
+		},
+		{
+			name:   "xfs unaligned stripe unit",
+			geo:    stripeGeometry{stripeUnit: 512, stripeCount: 4},
+			fsType: "xfs",
+			args:   []string{"-K"},
+			want:   []string{"-K"},
+		},
+		{
+			name:   "unknown striping",
+			geo:    stripeGeometry{},
+			fsType: "xfs",
+			args:   []string{"-K"},
+			want:   []string{"-K"},
+		},
+		{
+			name:   "unsupported filesystem",
+			geo:    defaultGeo,
+			fsType: "btrfs",
+			args:   []string{},
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			orig := append([]string{}, tt.args...)
+			got := tt.geo.mkfsArgs(tt.fsType, tt.args, tt.size)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, orig, tt.args, "the arguments were modified")
+		})
+	}
+}
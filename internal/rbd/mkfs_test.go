@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateMkfsOptions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		mkfsOptions string
+		allowList   []string
+		wantErr     bool
+	}{
+		{
+			name:        "empty allow list permits all options",
+			mkfsOptions: "-m0 -Ediscard -i1024",
+			allowList:   nil,
+			wantErr:     false,
+		},
+		{
+			name:        "value without option",
+			mkfsOptions: "reflink=1",
+			allowList:   nil,
+			wantErr:     true,
+		},
+		{
+			name:        "ext4 bigalloc",
+			mkfsOptions: "-Obigalloc -C 65536",
+			allowList:   []string{"-O", "-C"},
+			wantErr:     false,
+		},
+		{
+			name:        "xfs reflink",
+			mkfsOptions: "-m reflink=1",
+			allowList:   []string{"-m"},
+			wantErr:     false,
+		},
+		{
+			name:        "btrfs long option",
+			mkfsOptions: "--nodiscard --sectorsize=4096",
+			allowList:   []string{"--nodiscard", "--sectorsize"},
+			wantErr:     false,
+		},
+		{
+			name:        "option not in allow list",
+			mkfsOptions: "-Obigalloc -Enodiscard",
+			allowList:   []string{"-O"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateMkfsOptions(ts.mkfsOptions, ts.allowList)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("validateMkfsOptions() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("validateMkfsOptions() error = %v, expected ErrInvalidArgument", err)
+			}
+		})
+	}
+}
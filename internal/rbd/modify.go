@@ -0,0 +1,262 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// imageFeaturesParam is the parameter with the comma separated list of
+// features of the image.
+const imageFeaturesParam = "imageFeatures"
+
+// mutableImageFeatures are the features that librbd can enable and disable
+// on existing images, in the order they need to be enabled.
+var mutableImageFeatures = []string{
+	librbd.FeatureNameExclusiveLock,
+	librbd.FeatureNameObjectMap,
+	librbd.FeatureNameFastDiff,
+}
+
+// isMutableParameter returns true when the parameter can be modified with
+// ControllerModifyVolume.
+func isMutableParameter(param string) bool {
+	if param == imageFeaturesParam {
+		return true
+	}
+
+	if _, ok := qosParameters[param]; ok {
+		return true
+	}
+
+	_, ok := qosPerGiBParameters[param]
+
+	return ok
+}
+
+// validateMutableParameters returns ErrInvalidArgument when one of the
+// parameters can not be modified on an existing volume, like the pool or the
+// encryption of the volume.
+func validateMutableParameters(params map[string]string) error {
+	for param := range params {
+		if !isMutableParameter(param) {
+			return fmt.Errorf("%w: parameter %q can not be modified on an existing volume, "+
+				"only %q and the QoS parameters can be modified", ErrInvalidArgument, param, imageFeaturesParam)
+		}
+	}
+
+	return nil
+}
+
+// getImageFeatureUpdates returns the features that need to be enabled and
+// disabled on an image with the current features to get the features in the
+// comma separated list. Only the mutableImageFeatures can be changed, other
+// features that are missing on the image result in an ErrInvalidArgument.
+func getImageFeatureUpdates(
+	current librbd.FeatureSet,
+	imageFeatures string,
+) ([]string, []string, error) {
+	if imageFeatures == "" {
+		return nil, nil, fmt.Errorf("%w: empty %s parameter", ErrInvalidArgument, imageFeaturesParam)
+	}
+
+	names := strings.Split(imageFeatures, ",")
+	for _, name := range names {
+		if _, found := supportedFeatures[name]; !found {
+			return nil, nil, fmt.Errorf("%w: invalid feature %s", ErrInvalidArgument, name)
+		}
+
+		if !slices.Contains(mutableImageFeatures, name) && !slices.Contains(current.Names(), name) {
+			return nil, nil, fmt.Errorf("%w: feature %s can not be enabled on an existing image, "+
+				"only %v can be modified", ErrInvalidArgument, name, mutableImageFeatures)
+		}
+	}
+
+	// the features of the image after the update, the features that are
+	// not mutable are kept as they are
+	updated := librbd.FeatureSetFromNames(names)
+	for _, name := range current.Names() {
+		if !slices.Contains(mutableImageFeatures, name) {
+			updated |= librbd.FeatureSetFromNames([]string{name})
+		}
+	}
+
+	updatedNames := updated.Names()
+	for _, name := range updatedNames {
+		for _, r := range supportedFeatures[name].dependsOn {
+			if !slices.Contains(updatedNames, r) {
+				return nil, nil, fmt.Errorf("%w: feature %s requires %s to be set", ErrInvalidArgument, name, r)
+			}
+		}
+	}
+
+	var enable, disable []string
+	for _, name := range mutableImageFeatures {
+		hasFeature := slices.Contains(current.Names(), name)
+		wantFeature := slices.Contains(updatedNames, name)
+
+		switch {
+		case wantFeature && !hasFeature:
+			enable = append(enable, name)
+		case !wantFeature && hasFeature:
+			// features are disabled in the reverse order
+			disable = append([]string{name}, disable...)
+		}
+	}
+
+	return enable, disable, nil
+}
+
+// updateImageFeatures enables and disables the mutableImageFeatures on the
+// image so that it has the features in the comma separated list.
+func (ri *rbdImage) updateImageFeatures(ctx context.Context, imageFeatures string) error {
+	enable, disable, err := getImageFeatureUpdates(ri.ImageFeatureSet, imageFeatures)
+	if err != nil {
+		return err
+	}
+
+	if len(enable) == 0 && len(disable) == 0 {
+		return nil
+	}
+
+	image, err := ri.open()
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	for _, name := range disable {
+		feature := librbd.FeatureSetFromNames([]string{name})
+		err = image.UpdateFeatures(uint64(feature), false)
+		if err != nil {
+			return fmt.Errorf("failed to disable feature %s on %q: %w", name, ri, err)
+		}
+		ri.ImageFeatureSet &^= feature
+	}
+
+	for _, name := range enable {
+		feature := librbd.FeatureSetFromNames([]string{name})
+		err = image.UpdateFeatures(uint64(feature), true)
+		if err != nil {
+			return fmt.Errorf("failed to enable feature %s on %q: %w", name, ri, err)
+		}
+		ri.ImageFeatureSet |= feature
+	}
+
+	log.DebugLog(ctx, "enabled features %v and disabled features %v on image %s", enable, disable, ri)
+
+	return nil
+}
+
+// ControllerModifyVolume modifies the mutable parameters of an existing
+// volume. The QoS limits and the mutableImageFeatures of the image can be
+// modified, all other parameters are rejected.
+func (cs *ControllerServer) ControllerModifyVolume(
+	ctx context.Context,
+	req *csi.ControllerModifyVolumeRequest,
+) (*csi.ControllerModifyVolumeResponse, error) {
+	err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_MODIFY_VOLUME)
+	if err != nil {
+		log.ErrorLog(ctx, "invalid modify volume req: %v", protosanitizer.StripSecrets(req))
+
+		return nil, err
+	}
+
+	volID := req.GetVolumeId()
+	if volID == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID cannot be empty")
+	}
+
+	params := req.GetMutableParameters()
+	if err = validateMutableParameters(params); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	qos, err := parseQoSSpec(params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	token, acquired := cs.VolumeLocks.TryAcquire(volID)
+	if !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
+
+		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
+	}
+	defer cs.VolumeLocks.Release(volID, token)
+
+	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	rbdVol, err := genVolFromVolIDWithMigration(ctx, volID, cr, req.GetSecrets())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrImageNotFound):
+			err = status.Errorf(codes.NotFound, "volume ID %s not found", volID)
+		case errors.Is(err, util.ErrPoolNotFound):
+			log.ErrorLog(ctx, "failed to get backend volume for %s: %v", volID, err)
+			err = status.Errorf(codes.NotFound, err.Error())
+		default:
+			err = status.Errorf(codes.Internal, err.Error())
+		}
+
+		return nil, err
+	}
+	defer rbdVol.Destroy(ctx)
+
+	if imageFeatures, ok := params[imageFeaturesParam]; ok {
+		err = rbdVol.updateImageFeatures(ctx, imageFeatures)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to update features of rbd image %s: %v", rbdVol, err)
+
+			if errors.Is(err, ErrInvalidArgument) {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	if qos != nil {
+		err = rbdVol.modifyQoS(ctx, qos)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to modify QoS of rbd image %s: %v", rbdVol, err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	log.DebugLog(ctx, "modified rbd image %s with parameters %v", rbdVol, params)
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
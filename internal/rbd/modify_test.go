@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMutableParameters(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "no parameters",
+			params: map[string]string{},
+		},
+		{
+			name: "QoS and image features",
+			params: map[string]string{
+				"qosIOPSLimit":  "1000",
+				"qosPerGiBIOPS": "10",
+				"imageFeatures": "layering,exclusive-lock",
+			},
+		},
+		{
+			name:    "pool",
+			params:  map[string]string{"pool": "replicapool"},
+			wantErr: true,
+		},
+		{
+			name: "encryption",
+			params: map[string]string{
+				"qosIOPSLimit": "1000",
+				"encrypted":    "true",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateMutableParameters(tt.params)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidArgument)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGetImageFeatureUpdates(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		current       []string
+		imageFeatures string
+		enable        []string
+		disable       []string
+		wantErr       bool
+	}{
+		{
+			name:          "unchanged",
+			current:       []string{"layering", "exclusive-lock"},
+			imageFeatures: "layering,exclusive-lock",
+		},
+		{
+			name:          "enable object-map and fast-diff",
+			current:       []string{"layering"},
+			imageFeatures: "layering,exclusive-lock,object-map,fast-diff",
+			enable:        []string{"exclusive-lock", "object-map", "fast-diff"},
+		},
+		{
+			name:          "disable object-map and fast-diff",
+			current:       []string{"layering", "exclusive-lock", "object-map", "fast-diff"},
+			imageFeatures: "layering,exclusive-lock",
+			disable:       []string{"fast-diff", "object-map"},
+		},
+		{
+			name:          "immutable features are kept",
+			current:       []string{"layering", "deep-flatten"},
+			imageFeatures: "exclusive-lock",
+			enable:        []string{"exclusive-lock"},
+		},
+		{
+			name:          "enable layering",
+			current:       []string{"exclusive-lock"},
+			imageFeatures: "layering,exclusive-lock",
+			wantErr:       true,
+		},
+		{
+			name:          "missing dependency",
+			current:       []string{"layering"},
+			imageFeatures: "layering,object-map",
+			wantErr:       true,
+		},
+		{
+			name:          "exclusive-lock needed by journaling",
+			current:       []string{"layering", "exclusive-lock", "journaling"},
+			imageFeatures: "layering",
+			wantErr:       true,
+		},
+		{
+			name:          "invalid feature",
+			current:       []string{"layering"},
+			imageFeatures: "layering,no-such-feature",
+			wantErr:       true,
+		},
+		{
+			name:          "empty",
+			current:       []string{"layering"},
+			imageFeatures: "",
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			enable, disable, err := getImageFeatureUpdates(librbd.FeatureSetFromNames(tt.current), tt.imageFeatures)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidArgument)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.enable, enable)
+			require.Equal(t, tt.disable, disable)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// the attributes in the journal of a volume that was cloned from a volume in
+// a different RADOS namespace. They record the lineage of the volume, and are
+// stored once the clone or the copy of the data completed.
+const (
+	sourceVolumeIDAttribute       = "source-volume-id"
+	sourceRadosNamespaceAttribute = "source-rados-namespace"
+)
+
+// copyFallbackErrnos are the errors of librbd that reject an RBD clone into a
+// different RADOS namespace, the data of the parent is copied instead. EINVAL
+// is not included, it is returned for invalid clone options as well, which a
+// copy would hide.
+var copyFallbackErrnos = []syscall.Errno{
+	syscall.EXDEV,
+	syscall.EOPNOTSUPP,
+	syscall.ENOSYS,
+}
+
+// isCrossNamespaceClone returns true when the volume is cloned from a parent
+// in a different RADOS namespace.
+func (rv *rbdVolume) isCrossNamespaceClone(parentVol *rbdVolume) bool {
+	return parentVol != nil && rv.RadosNamespace != parentVol.RadosNamespace
+}
+
+// needsCopyFallback returns true when the error of cloning the image shows
+// that the cluster does not support clones across RADOS namespaces.
+func needsCopyFallback(err error) bool {
+	var ec interface{ ErrorCode() int }
+	if !errors.As(err, &ec) {
+		return false
+	}
+
+	code := ec.ErrorCode()
+	if code < 0 {
+		code = -code
+	}
+
+	for _, errno := range copyFallbackErrnos {
+		if syscall.Errno(code) == errno {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isClonedAcrossNamespace returns true when the lineage of the volume is
+// recorded in the journal, which means the clone or the copy from the parent
+// in the other RADOS namespace completed.
+func (rv *rbdVolume) isClonedAcrossNamespace(ctx context.Context) (bool, error) {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, rv.conn.Creds)
+	if err != nil {
+		return false, err
+	}
+	defer j.Destroy()
+
+	volumeID, err := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, sourceVolumeIDAttribute)
+	if err != nil {
+		log.DebugLog(ctx, "no source volume recorded for volume %s: %v", rv, err)
+
+		return false, nil
+	}
+
+	return volumeID != "", nil
+}
+
+// storeCloneLineage stores the ID and the RADOS namespace of the volume that
+// the volume was cloned from in the journal.
+func (rv *rbdVolume) storeCloneLineage(ctx context.Context, parentVol *rbdVolume) error {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, rv.conn.Creds)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	err = j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, sourceRadosNamespaceAttribute,
+		parentVol.RadosNamespace)
+	if err != nil {
+		return err
+	}
+
+	return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, sourceVolumeIDAttribute, parentVol.VolID)
+}
+
+// copyFromImage copies the data of the parent volume to the image of the
+// volume, which needs to exist already. A temporary snapshot of the parent is
+// taken in the RADOS namespace of the parent, it has the same name as the
+// snapshot of an RBD clone so that checkCloneImage() removes it when the copy
+// was interrupted.
+func (rv *rbdVolume) copyFromImage(ctx context.Context, parentVol *rbdVolume) error {
+	snap := &rbdSnapshot{}
+	snap.RbdSnapName = rv.generateTempClone().RbdImageName
+	snap.Pool = parentVol.Pool
+	snap.RadosNamespace = parentVol.RadosNamespace
+
+	// the copy can only continue from the stored progress when the
+	// snapshot of the interrupted copy still exists
+	err := parentVol.createSnapshot(ctx, snap)
+	resume := errors.Is(err, librbd.ErrExist)
+	if err != nil && !resume {
+		return fmt.Errorf("failed to create snapshot %q: %w", snap, err)
+	}
+
+	log.DebugLog(ctx, "copying volume %s in namespace %q to volume %s in namespace %q",
+		parentVol, parentVol.RadosNamespace, rv, rv.RadosNamespace)
+
+	err = rv.copyImageData(ctx, parentVol, snap.RbdSnapName, resume)
+	if err != nil {
+		err = fmt.Errorf("failed to copy volume %q to %q: %w", parentVol, rv, err)
+	}
+
+	errSnap := parentVol.deleteSnapshot(ctx, snap)
+	if errSnap != nil && !errors.Is(errSnap, ErrSnapNotFound) {
+		log.ErrorLog(ctx, "failed to delete snapshot %s: %v", snap, errSnap)
+		if err == nil {
+			err = errSnap
+		}
+	}
+
+	return err
+}
+
+// createCopyFromImage creates the image of the volume and copies the data of
+// the parent volume in a different RADOS namespace to it. The image is
+// removed again when the copy fails.
+func (rv *rbdVolume) createCopyFromImage(ctx context.Context, parentVol *rbdVolume) error {
+	err := createImage(ctx, rv, rv.conn.Creds)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to create volume %s: %v", rv, err)
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	err = rv.copyFromImage(ctx, parentVol)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to copy volume %s to volume %s: %v", parentVol, rv, err)
+
+		deleteErr := rv.Delete(ctx)
+		if deleteErr != nil {
+			log.ErrorLog(ctx, "failed to delete rbd image %s: %v", rv, deleteErr)
+		}
+
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	return nil
+}
+
+// resumeCloneAcrossNamespace completes a clone from a parent in a different
+// RADOS namespace, when the lineage of the volume is not recorded in the
+// journal yet. An image without parent was created by the copy fallback, the
+// data is copied again in that case.
+func (rv *rbdVolume) resumeCloneAcrossNamespace(ctx context.Context, parentVol *rbdVolume) error {
+	cloned, err := rv.isClonedAcrossNamespace(ctx)
+	if err != nil || cloned {
+		return err
+	}
+
+	if rv.ParentName == "" {
+		err = rv.copyFromImage(ctx, parentVol)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rv.storeCloneLineage(ctx, parentVol)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type rbdErrorCode int
+
+func (e rbdErrorCode) Error() string {
+	return fmt.Sprintf("rbd: ret=%d", int(e))
+}
+
+func (e rbdErrorCode) ErrorCode() int {
+	return int(e)
+}
+
+func TestNeedsCopyFallback(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "cross device clone",
+			err:  fmt.Errorf("failed to create rbd clone: %w", rbdErrorCode(-18)),
+			want: true,
+		},
+		{
+			name: "invalid argument",
+			err:  rbdErrorCode(-22),
+			want: false,
+		},
+		{
+			name: "not supported",
+			err:  rbdErrorCode(-95),
+			want: true,
+		},
+		{
+			name: "not implemented",
+			err:  rbdErrorCode(-38),
+			want: true,
+		},
+		{
+			name: "permission denied",
+			err:  rbdErrorCode(-1),
+			want: false,
+		},
+		{
+			name: "error without errno",
+			err:  errors.New("clone failed"),
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, needsCopyFallback(tt.err))
+		})
+	}
+}
+
+func TestIsCrossNamespaceClone(t *testing.T) {
+	t.Parallel()
+
+	rv := &rbdVolume{}
+	rv.RadosNamespace = "tenant-b"
+
+	parentVol := &rbdVolume{}
+	parentVol.RadosNamespace = "tenant-a"
+	require.True(t, rv.isCrossNamespaceClone(parentVol))
+
+	parentVol.RadosNamespace = "tenant-b"
+	require.False(t, rv.isCrossNamespaceClone(parentVol))
+
+	require.False(t, rv.isCrossNamespaceClone(nil))
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// nodeLabelsRefreshInterval is the interval to check the labels of the node
+// for changes.
+const nodeLabelsRefreshInterval = time.Minute
+
+// getNodeLabels returns the labels of the node and the read affinity map
+// options that are derived from the CRUSH location labels of the command line.
+func (ns *NodeServer) getNodeLabels() (map[string]string, string) {
+	ns.nodeLabelsMutex.RLock()
+	defer ns.nodeLabelsMutex.RUnlock()
+
+	return ns.NodeLabels, ns.CLIReadAffinityOptions
+}
+
+// setNodeLabels updates the labels of the node, and the read affinity map
+// options when read affinity is enabled on the command line. It returns true
+// when the labels changed.
+func (ns *NodeServer) setNodeLabels(ctx context.Context, nodeLabels map[string]string) bool {
+	ns.nodeLabelsMutex.Lock()
+	defer ns.nodeLabelsMutex.Unlock()
+
+	if maps.Equal(ns.NodeLabels, nodeLabels) {
+		return false
+	}
+	ns.NodeLabels = nodeLabels
+
+	if ns.CrushLocationLabels != "" {
+		crushLocationMap := util.GetCrushLocationMap(ns.CrushLocationLabels, nodeLabels)
+		ns.CLIReadAffinityOptions = util.ConstructReadAffinityMapOption(crushLocationMap)
+		log.DebugLog(ctx, "read affinity map options of the node are %q", ns.CLIReadAffinityOptions)
+	}
+
+	return true
+}
+
+// RefreshNodeLabels periodically reads the labels of the node, so that the
+// read affinity and map options of the node follow changes of the labels.
+// Volumes that are mapped already keep their options, new maps use the
+// options derived from the current labels.
+func RefreshNodeLabels(ctx context.Context, ns *NodeServer, nodeName string) {
+	ticker := time.NewTicker(nodeLabelsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		nodeLabels, err := k8s.GetNodeLabels(nodeName)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to refresh labels of node %q: %v", nodeName, err)
+
+			continue
+		}
+
+		if ns.setNodeLabels(ctx, nodeLabels) {
+			log.DefaultLog("labels of node %q changed", nodeName)
+		}
+	}
+}
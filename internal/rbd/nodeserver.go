@@ -21,10 +21,13 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
+	hc "github.com/ceph/ceph-csi/internal/health-checker"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/fscrypt"
 	"github.com/ceph/ceph-csi/internal/util/log"
@@ -33,6 +36,7 @@ import (
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/kubernetes/pkg/volume"
 	mount "k8s.io/mount-utils"
 	utilexec "k8s.io/utils/exec"
@@ -45,6 +49,21 @@ type NodeServer struct {
 	// A map storing all volumes with ongoing operations so that additional operations
 	// for that same volume (as defined by VolumeID) return an Aborted error
 	VolumeLocks *util.VolumeLocks
+	// ForceLockBreak is set to break exclusive locks of images on
+	// NodeStage, when the lock owner does not watch the image anymore.
+	ForceLockBreak bool
+	// CrushLocationLabels are the node labels that the read affinity map
+	// options are derived from, when read affinity is enabled on the
+	// command line.
+	CrushLocationLabels string
+	// nodeLabelsMutex protects NodeLabels and CLIReadAffinityOptions, they
+	// are updated when the labels of the node change.
+	nodeLabelsMutex sync.RWMutex
+	// HealthChecker checks the health of the published block-devices.
+	HealthChecker hc.Manager
+	// volumeUsageUpdated contains the time of the last update of the usage
+	// of a volume, map[volumeID]time.Time
+	volumeUsageUpdated sync.Map
 }
 
 // stageTransaction struct represents the state a transaction was when it either completed
@@ -101,13 +120,23 @@ var (
 	xfsHasReflink = xfsReflinkUnset
 
 	mkfsDefaultArgs = map[string][]string{
-		"ext4": {"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1"},
-		"xfs":  {"-K"},
+		"ext4":  {"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1"},
+		"xfs":   {"-K"},
+		"btrfs": {"--nodiscard"},
 	}
 
 	mountDefaultOpts = map[string][]string{
 		"xfs": {"nouuid"},
 	}
+
+	// readOnlyMountOpts contains the mount options per filesystem type that
+	// are needed to mount a filesystem from a read-only mapped image. The
+	// journal of the filesystem can not be replayed on a read-only device,
+	// which is required for crash-consistent snapshots.
+	readOnlyMountOpts = map[string][]string{
+		"ext4": {"noload"},
+		"xfs":  {"norecovery"},
+	}
 )
 
 // parseBoolOption checks if parameters contain option and parse it. If it is
@@ -139,6 +168,21 @@ func healerStageTransaction(ctx context.Context, cr *util.Credentials, volOps *r
 	if imgInfo.DevicePath == "" {
 		return fmt.Errorf("device is empty in image metadata, at stagingPath: %s", metaDataPath)
 	}
+
+	// the nodeplugin may have been restarted without stopping the rbd-nbd
+	// process, the device does not need to be attached again then
+	if _, found := findDeviceMappingImage(ctx, imgInfo.Pool, imgInfo.RadosNamespace, imgInfo.ImageName, true); found {
+		log.DebugLog(ctx, "rbd volID: %s is still attached to device: %s", volOps.VolID, imgInfo.DevicePath)
+
+		return nil
+	}
+
+	// attach with the options of the initial mapping, the configuration
+	// may have changed since then
+	if imgInfo.MapOptions != "" {
+		volOps.MapOptions = imgInfo.MapOptions
+	}
+
 	var devicePath string
 	devicePath, err = attachRBDImage(ctx, volOps, imgInfo.DevicePath, cr)
 	if err != nil {
@@ -149,6 +193,12 @@ func healerStageTransaction(ctx context.Context, cr *util.Credentials, volOps *r
 	return nil
 }
 
+// FlushState stops the health-checkers of the volumes. It is called when the
+// nodeplugin drained the in-flight requests before it is stopped.
+func (ns *NodeServer) FlushState(_ context.Context) {
+	ns.HealthChecker.StopAll()
+}
+
 // populateRbdVol update the fields in rbdVolume struct based on the request it received.
 // this function also receive the credentials and secrets args as it differs in its data.
 // The credentials are used directly by functions like voljournal.Connect() and other functions
@@ -183,16 +233,17 @@ func (ns *NodeServer) populateRbdVol(
 	var rv *rbdVolume
 
 	isStaticVol := parseBoolOption(ctx, req.GetVolumeContext(), staticVol, false)
+	isMigrationVol := isStaticVol && req.GetVolumeContext()[intreeMigrationKey] == intreeMigrationLabel
 	// get rbd image name from the volume journal
 	// for static volumes, the image name is actually the volume ID itself
 	if isStaticVol {
-		if req.GetVolumeContext()[intreeMigrationKey] == intreeMigrationLabel {
+		if isMigrationVol {
 			// if migration static volume, use imageName as volID
 			volID = req.GetVolumeContext()["imageName"]
 		}
 		rv, err = genVolFromVolumeOptions(ctx, req.GetVolumeContext(), disableInUseChecks, true)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 		rv.RbdImageName = volID
 	} else {
@@ -203,7 +254,6 @@ func (ns *NodeServer) populateRbdVol(
 
 			return nil, status.Errorf(codes.Internal, "error generating volume %s: %v", volID, err)
 		}
-		rv.DataPool = req.GetVolumeContext()["dataPool"]
 		var ok bool
 		if rv.Mounter, ok = req.GetVolumeContext()["mounter"]; !ok {
 			rv.Mounter = rbdDefaultMounter
@@ -211,12 +261,13 @@ func (ns *NodeServer) populateRbdVol(
 	}
 
 	rv.DisableInUseChecks = disableInUseChecks
+	rv.forceLockBreak = ns.ForceLockBreak
 
 	err = rv.Connect(cr)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to connect to volume %s: %v", rv, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	// in case of any error call Destroy for cleanup.
 	defer func() {
@@ -229,35 +280,33 @@ func (ns *NodeServer) populateRbdVol(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get image details %s: %v", rv, err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
-	err = rv.initKMS(ctx, req.GetVolumeContext(), req.GetSecrets())
+	if isMigrationVol {
+		err = rv.initMigratedKMS(ctx, req.GetVolumeContext(), req.GetSecrets())
+	} else {
+		err = rv.initKMS(ctx, req.GetVolumeContext(), req.GetSecrets())
+	}
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
-	features := strings.Join(rv.ImageFeatureSet.Names(), ",")
-	isFeatureExist, err := isKrbdFeatureSupported(ctx, features)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		log.ErrorLog(ctx, "failed checking krbd features %q: %v", features, err)
+	err = rv.selectMounter(ctx, parseBoolOption(ctx, req.GetVolumeContext(), tryOtherMounters, false))
+	if err != nil {
+		if errors.Is(err, ErrFailedPrecondition) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
-	if rv.Mounter == rbdDefaultMounter && !isFeatureExist {
-		if !parseBoolOption(ctx, req.GetVolumeContext(), tryOtherMounters, false) {
-			log.ErrorLog(ctx, "unsupported krbd Feature, set `tryOtherMounters:true` or fix krbd driver")
-			err = errors.New("unsupported krbd Feature")
-
-			return nil, status.Error(codes.Internal, err.Error())
+	err = ns.getMapOptions(ctx, req, rv)
+	if err != nil {
+		if errors.Is(err, ErrInvalidArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
 		}
-		// fallback to rbd-nbd,
-		rv.Mounter = rbdNbdMounter
-	}
 
-	err = ns.getMapOptions(req, rv)
-	if err != nil {
 		return nil, err
 	}
 
@@ -275,12 +324,61 @@ func (ns *NodeServer) populateRbdVol(
 	return rv, err
 }
 
+// selectMounter checks that the kernel supports the features of the image
+// when krbd is used for mapping. With tryOtherMounters or the `auto` mounter,
+// rbd-nbd is used when the kernel lacks a feature. The `auto` mounter is
+// resolved to the mounter that is used, so that it can be stashed for unstage.
+func (rv *rbdVolume) selectMounter(ctx context.Context, tryOtherMounters bool) error {
+	if rv.Mounter != rbdDefaultMounter && rv.Mounter != rbdAutoMounter {
+		return nil
+	}
+
+	features := strings.Join(rv.ImageFeatureSet.Names(), ",")
+	isFeatureExist, err := isKrbdFeatureSupported(ctx, features)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.ErrorLog(ctx, "failed checking krbd features %q: %v", features, err)
+
+		return err
+	}
+
+	if isFeatureExist {
+		rv.Mounter = rbdDefaultMounter
+
+		return nil
+	}
+
+	if rv.Mounter == rbdAutoMounter {
+		if !hasNBD {
+			return fmt.Errorf("%w: krbd does not support image features %q and rbd-nbd is not available",
+				ErrFailedPrecondition, features)
+		}
+		log.DebugLog(ctx, "krbd does not support image features %q of %s, using rbd-nbd", features, rv)
+	} else if !tryOtherMounters {
+		log.ErrorLog(ctx, "unsupported krbd Feature, set `tryOtherMounters:true` or fix krbd driver")
+
+		return errors.New("unsupported krbd Feature")
+	}
+
+	// fallback to rbd-nbd,
+	rv.Mounter = rbdNbdMounter
+
+	return nil
+}
+
 // appendReadAffinityMapOptions appends readAffinityMapOptions to mapOptions
-// if mounter is rbdDefaultMounter and readAffinityMapOptions is not empty.
+// if mounter is rbdDefaultMounter or rbdNbdMounter and readAffinityMapOptions
+// is not empty. The options are converted to librbd options for rbd-nbd.
 func (rv *rbdVolume) appendReadAffinityMapOptions(readAffinityMapOptions string) {
 	switch {
-	case readAffinityMapOptions == "" || rv.Mounter != rbdDefaultMounter:
+	case readAffinityMapOptions == "":
 		return
+	case rv.Mounter == rbdNbdMounter:
+		readAffinityMapOptions = util.ConvertReadAffinityMapOptionsForNbd(readAffinityMapOptions)
+	case rv.Mounter != rbdDefaultMounter:
+		return
+	}
+
+	switch {
 	case rv.MapOptions != "":
 		rv.MapOptions += "," + readAffinityMapOptions
 	default:
@@ -309,19 +407,27 @@ func (ns *NodeServer) NodeStageVolume(
 	if err = util.ValidateNodeStageVolumeRequest(req); err != nil {
 		return nil, err
 	}
+	if err = validateVolumeCapability(req.GetVolumeCapability()); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	volID := req.GetVolumeId()
-	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	secrets, err := getNodeStageSecrets(volID, req.GetVolumeContext(), req.GetSecrets())
+	if err != nil {
+		return nil, err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 	defer cr.DeleteCredentials()
-	if acquired := ns.VolumeLocks.TryAcquire(volID); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(volID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
 	}
-	defer ns.VolumeLocks.Release(volID)
+	defer ns.VolumeLocks.Release(volID, token)
 
 	stagingParentPath := req.GetStagingTargetPath()
 	stagingTargetPath := stagingParentPath + "/" + volID
@@ -332,7 +438,7 @@ func (ns *NodeServer) NodeStageVolume(
 		// check if stagingPath is already mounted
 		isNotMnt, err = isNotMountPoint(ns.Mounter, stagingTargetPath)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		} else if !isNotMnt {
 			log.DebugLog(ctx, "rbd: volume %s is already mounted to %s, skipping", volID, stagingTargetPath)
 
@@ -349,12 +455,12 @@ func (ns *NodeServer) NodeStageVolume(
 
 	rv.NetNamespaceFilePath, err = util.GetRBDNetNamespaceFilePath(util.CsiConfigFile, rv.ClusterID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	if isHealer {
 		err = healerStageTransaction(ctx, cr, rv, stagingParentPath)
 		if err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		return &csi.NodeStageVolumeResponse{}, nil
@@ -362,9 +468,10 @@ func (ns *NodeServer) NodeStageVolume(
 
 	// Stash image details prior to mapping the image (useful during Unstage as it has no
 	// voloptions passed to the RPC as per the CSI spec)
+	rv.objects = rv.volumeObjects()
 	err = stashRBDImageMetadata(rv, stagingParentPath)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	// perform the actual staging and if this fails, have undoStagingTransaction
@@ -376,7 +483,11 @@ func (ns *NodeServer) NodeStageVolume(
 		}
 	}()
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		if errors.Is(err, ErrFailedPrecondition) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(
@@ -403,7 +514,13 @@ func (ns *NodeServer) stageTransaction(
 	if req.GetVolumeCapability().GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY {
 		log.ExtendedLog(ctx, "setting disableInUseChecks on rbd volume to: %v", req.GetVolumeId)
 		volOptions.DisableInUseChecks = true
+	}
+
+	// map the image read-only for reader-only access modes, the exclusive
+	// lock can not be acquired with a read-only mapping
+	if csicommon.IsReaderOnly([]*csi.VolumeCapability{req.GetVolumeCapability()}) {
 		volOptions.readOnly = true
+		volOptions.MapOptions = removeMapOption(volOptions.MapOptions, "exclusive")
 	}
 
 	err = flattenImageBeforeMapping(ctx, volOptions)
@@ -421,6 +538,8 @@ func (ns *NodeServer) stageTransaction(
 
 	log.DebugLog(ctx, "rbd image: %s was successfully mapped at %s\n",
 		volOptions, devicePath)
+	volOptions.objects.Event(ctx, corev1.EventTypeNormal, eventVolumeMapped,
+		"Mapped image %s at %s on node %s", volOptions, devicePath, ns.Driver.GetNodeID())
 
 	// userspace mounters like nbd need the device path as a reference while
 	// restarting the userspace processes on a nodeplugin restart. For kernel
@@ -439,6 +558,8 @@ func (ns *NodeServer) stageTransaction(
 			return transaction, err
 		}
 		transaction.isBlockEncrypted = true
+		volOptions.objects.Event(ctx, corev1.EventTypeNormal, eventEncryptionUnlocked,
+			"Unlocked encrypted image %s on node %s", volOptions, ns.Driver.GetNodeID())
 	}
 
 	if volOptions.isFileEncrypted() {
@@ -458,7 +579,7 @@ func (ns *NodeServer) stageTransaction(
 	transaction.isStagePathCreated = true
 
 	// nodeStage Path
-	err = ns.mountVolumeToStagePath(ctx, req, staticVol, stagingTargetPath, devicePath, volOptions.isFileEncrypted())
+	err = ns.mountVolumeToStagePath(ctx, req, staticVol, stagingTargetPath, devicePath, volOptions)
 	if err != nil {
 		return transaction, err
 	}
@@ -471,6 +592,8 @@ func (ns *NodeServer) stageTransaction(
 			return transaction, fmt.Errorf("file system encryption unlock in %s image %s failed: %w",
 				stagingTargetPath, volOptions.VolID, err)
 		}
+		volOptions.objects.Event(ctx, corev1.EventTypeNormal, eventEncryptionUnlocked,
+			"Unlocked the encrypted filesystem of image %s on node %s", volOptions, ns.Driver.GetNodeID())
 	}
 
 	// As we are supporting the restore of a volume to a bigger size and
@@ -507,7 +630,7 @@ func resizeNodeStagePath(ctx context.Context,
 	if transaction.isBlockEncrypted {
 		devicePath, err = resizeEncryptedDevice(ctx, volID, stagingTargetPath, devicePath)
 		if err != nil {
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 
 		// If this is a AccessType=Block volume, do not attempt
@@ -670,12 +793,12 @@ func (ns *NodeServer) createStageMountPoint(ctx context.Context, mountPath strin
 		if err != nil {
 			log.ErrorLog(ctx, "failed to create mountPath:%s with error: %v", mountPath, err)
 
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 		if err = pathFile.Close(); err != nil {
 			log.ErrorLog(ctx, "failed to close mountPath:%s with error: %v", mountPath, err)
 
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 
 		return nil
@@ -686,7 +809,7 @@ func (ns *NodeServer) createStageMountPoint(ctx context.Context, mountPath strin
 		if !os.IsExist(err) {
 			log.ErrorLog(ctx, "failed to create mountPath:%s with error: %v", mountPath, err)
 
-			return status.Error(codes.Internal, err.Error())
+			return util.GRPCError(err)
 		}
 	}
 
@@ -709,12 +832,13 @@ func (ns *NodeServer) NodePublishVolume(
 	volID := req.GetVolumeId()
 	stagingPath += "/" + volID
 
-	if acquired := ns.VolumeLocks.TryAcquire(targetPath); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(targetPath)
+	if !acquired {
 		log.ErrorLog(ctx, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 
 		return nil, status.Errorf(codes.Aborted, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 	}
-	defer ns.VolumeLocks.Release(targetPath)
+	defer ns.VolumeLocks.Release(targetPath, token)
 
 	// Check if that target path exists properly
 	notMnt, err := ns.createTargetMountPath(ctx, targetPath, isBlock)
@@ -728,15 +852,47 @@ func (ns *NodeServer) NodePublishVolume(
 
 	fileEncrypted, err := IsFileEncrypted(ctx, req.GetVolumeContext())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	if fileEncrypted {
 		stagingPath = fscrypt.AppendEncyptedSubdirectory(stagingPath)
 		if err = fscrypt.IsDirectoryUnlocked(stagingPath, req.GetVolumeCapability().GetMount().GetFsType()); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
+		}
+	}
+
+	if util.IsSingleWriter(req.GetVolumeCapability()) {
+		// the target paths of the Pods differ, the claim of the volume
+		// is serialized by the volume ID
+		volToken, acquired := ns.VolumeLocks.TryAcquire(volID)
+		if !acquired {
+			log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
+
+			return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
+		}
+		defer ns.VolumeLocks.Release(volID, volToken)
+
+		// the staging directory contains the stash of the image metadata
+		err = util.ClaimSingleWriter(ctx, ns.Mounter, req.GetStagingTargetPath(), req.GetVolumeContext(), targetPath)
+		if err == nil {
+			err = ns.lockSingleWriter(ctx, req)
+		}
+		if err != nil {
+			log.ErrorLog(ctx, "failed to publish ReadWriteOncePod volume %s: %v", volID, err)
+
+			return nil, util.GRPCError(err)
 		}
 	}
 
+	// the limits are set before mounting, a published volume is not
+	// published again on retries
+	err = applyPodIOLimits(req.GetVolumeContext(), stagingPath)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to set IO limits for volume %s: %v", volID, err)
+
+		return nil, util.GRPCError(err)
+	}
+
 	// Publish Path
 	err = ns.mountVolume(ctx, stagingPath, req)
 	if err != nil {
@@ -745,15 +901,28 @@ func (ns *NodeServer) NodePublishVolume(
 
 	log.DebugLog(ctx, "rbd: successfully mounted stagingPath %s to targetPath %s", stagingPath, targetPath)
 
+	if isBlock {
+		ns.startBlockHealthChecker(ctx, volID, targetPath)
+	}
+
 	return &csi.NodePublishVolumeResponse{}, nil
 }
 
+// startBlockHealthChecker starts a health-checker for the block-device that is
+// published on the targetPath.
+func (ns *NodeServer) startBlockHealthChecker(ctx context.Context, volumeID, targetPath string) {
+	err := ns.HealthChecker.StartChecker(volumeID, targetPath, hc.BlockCheckerType)
+	if err != nil {
+		log.WarningLog(ctx, "failed to start healthchecker: %v", err)
+	}
+}
+
 func (ns *NodeServer) mountVolumeToStagePath(
 	ctx context.Context,
 	req *csi.NodeStageVolumeRequest,
 	staticVol bool,
 	stagingPath, devicePath string,
-	fileEncryption bool,
+	rv *rbdVolume,
 ) error {
 	readOnly := false
 	fsType := req.GetVolumeCapability().GetMount().GetFsType()
@@ -787,6 +956,12 @@ func (ns *NodeServer) mountVolumeToStagePath(
 		if !csicommon.MountOptionContains(opt, rOnly) {
 			opt = append(opt, rOnly)
 		}
+		// the image is mapped read-only, skip the journal replay
+		for _, roOpt := range readOnlyMountOpts[existingFormat] {
+			if !csicommon.MountOptionContains(opt, roOpt) {
+				opt = append(opt, roOpt)
+			}
+		}
 	}
 	if csicommon.MountOptionContains(opt, rOnly) {
 		readOnly = true
@@ -798,23 +973,36 @@ func (ns *NodeServer) mountVolumeToStagePath(
 		// if the VolumeContext contains "mkfsOptions", use those as args instead
 		volumeCtx := req.GetVolumeContext()
 		if volumeCtx != nil {
-			mkfsOptions := volumeCtx["mkfsOptions"]
+			mkfsOptions := volumeCtx[mkfsOptionsParam]
 			if mkfsOptions != "" {
-				args = strings.Split(mkfsOptions, " ")
+				err = validateConfiguredMkfsOptions(volumeCtx["clusterID"], mkfsOptions)
+				if err != nil {
+					return err
+				}
+				args = strings.Fields(mkfsOptions)
 			}
 		}
 
+		align, err := parseMkfsAlignment(volumeCtx)
+		if err != nil {
+			return err
+		}
+		if align {
+			args = rv.alignMkfsArgs(ctx, fsType, args)
+		}
+
 		// add extra arguments depending on the filesystem
 		mkfs := "mkfs." + fsType
 		switch fsType {
 		case "ext4":
-			if fileEncryption {
+			if rv.isFileEncrypted() {
 				args = append(args, "-Oencrypt")
 			}
 		case "xfs":
-			// always disable reflink
-			// TODO: make enabling an option, see ceph/ceph-csi#1256
-			if ns.xfsSupportsReflink() {
+			// disable reflink, unless it is configured in the mkfsOptions
+			if ns.xfsSupportsReflink() && !slices.ContainsFunc(args, func(arg string) bool {
+				return strings.Contains(arg, "reflink=")
+			}) {
 				args = append(args, "-m", "reflink=0")
 			}
 		case "":
@@ -832,12 +1020,35 @@ func (ns *NodeServer) mountVolumeToStagePath(
 		}
 	}
 
+	fsckMode := req.GetVolumeContext()[fsckModeParam]
+	err = validateFsckMode(fsckMode)
+	if err != nil {
+		return err
+	}
+	checkFs := existingFormat != "" && !readOnly && !isBlock
+
+	if checkFs {
+		err = checkFilesystem(ctx, diskMounter.Exec, fsckMode, existingFormat, devicePath)
+		if err != nil {
+			return err
+		}
+	}
+
 	if isBlock {
 		opt = append(opt, "bind")
 		err = diskMounter.MountSensitiveWithoutSystemd(devicePath, stagingPath, fsType, opt, nil)
 	} else {
 		err = diskMounter.FormatAndMount(devicePath, stagingPath, fsType, opt)
 	}
+	if err != nil && checkFs {
+		repaired, checkErr := checkFailedMount(ctx, diskMounter.Exec, fsckMode, existingFormat, devicePath)
+		switch {
+		case checkErr != nil:
+			err = checkErr
+		case repaired:
+			err = diskMounter.FormatAndMount(devicePath, stagingPath, fsType, opt)
+		}
+	}
 	if err != nil {
 		log.ErrorLog(ctx,
 			"failed to mount device path (%s) to staging path (%s) for volume "+
@@ -860,6 +1071,8 @@ func (ns *NodeServer) mountVolume(ctx context.Context, stagingPath string, req *
 	targetPath := req.GetTargetPath()
 
 	mountOptions = csicommon.ConstructMountOptions(mountOptions, req.GetVolumeCapability())
+	// the SELinux context is set on the staged filesystem
+	mountOptions = csicommon.RemoveSELinuxMountOptions(mountOptions)
 
 	log.DebugLog(ctx, "target %v\nisBlock %v\nfstype %v\nstagingPath %v\nreadonly %v\nmountflags %v\n",
 		targetPath, isBlock, fsType, stagingPath, readOnly, mountOptions)
@@ -868,7 +1081,7 @@ func (ns *NodeServer) mountVolume(ctx context.Context, stagingPath string, req *
 		mountOptions = append(mountOptions, "ro")
 	}
 	if err := util.Mount(ns.Mounter, stagingPath, targetPath, fsType, mountOptions); err != nil {
-		return status.Error(codes.Internal, err.Error())
+		return util.GRPCError(err)
 	}
 
 	return nil
@@ -881,7 +1094,7 @@ func (ns *NodeServer) createTargetMountPath(ctx context.Context, mountPath strin
 		return notMnt, nil
 	}
 	if !os.IsNotExist(err) {
-		return false, status.Error(codes.Internal, err.Error())
+		return false, util.GRPCError(err)
 	}
 	if isBlock {
 		// #nosec
@@ -894,12 +1107,12 @@ func (ns *NodeServer) createTargetMountPath(ctx context.Context, mountPath strin
 		if err = pathFile.Close(); err != nil {
 			log.DebugLog(ctx, "Failed to close mountPath:%s with error: %v", mountPath, err)
 
-			return notMnt, status.Error(codes.Internal, err.Error())
+			return notMnt, util.GRPCError(err)
 		}
 	} else {
 		// Create a mountpath directory
 		if err = util.CreateMountPoint(mountPath); err != nil {
-			return notMnt, status.Error(codes.Internal, err.Error())
+			return notMnt, util.GRPCError(err)
 		}
 	}
 	notMnt = true
@@ -919,12 +1132,16 @@ func (ns *NodeServer) NodeUnpublishVolume(
 
 	targetPath := req.GetTargetPath()
 
-	if acquired := ns.VolumeLocks.TryAcquire(targetPath); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(targetPath)
+	if !acquired {
 		log.ErrorLog(ctx, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 
 		return nil, status.Errorf(codes.Aborted, util.TargetPathOperationAlreadyExistsFmt, targetPath)
 	}
-	defer ns.VolumeLocks.Release(targetPath)
+	defer ns.VolumeLocks.Release(targetPath, token)
+
+	// stop the health-checker of a published block-device
+	ns.HealthChecker.StopChecker(req.GetVolumeId(), targetPath)
 
 	isMnt, err := ns.Mounter.IsMountPoint(targetPath)
 	if err != nil {
@@ -939,18 +1156,18 @@ func (ns *NodeServer) NodeUnpublishVolume(
 	}
 	if !isMnt {
 		if err = os.Remove(targetPath); err != nil {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		return &csi.NodeUnpublishVolumeResponse{}, nil
 	}
 
 	if err = ns.Mounter.Unmount(targetPath); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	if err = os.Remove(targetPath); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(ctx, "rbd: successfully unbound volume %s from %s", req.GetVolumeId(), targetPath)
@@ -983,12 +1200,13 @@ func (ns *NodeServer) NodeUnstageVolume(
 
 	volID := req.GetVolumeId()
 
-	if acquired := ns.VolumeLocks.TryAcquire(volID); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(volID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
 	}
-	defer ns.VolumeLocks.Release(volID)
+	defer ns.VolumeLocks.Release(volID, token)
 
 	stagingParentPath := req.GetStagingTargetPath()
 	stagingTargetPath := getStagingTargetPath(req)
@@ -1007,7 +1225,7 @@ func (ns *NodeServer) NodeUnstageVolume(
 		if err != nil {
 			log.ExtendedLog(ctx, "failed to unmount targetPath: %s with error: %v", stagingTargetPath, err)
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 		log.DebugLog(ctx, "successfully unmounted volume (%s) from staging path (%s)",
 			req.GetVolumeId(), stagingTargetPath)
@@ -1020,22 +1238,25 @@ func (ns *NodeServer) NodeUnstageVolume(
 		if !os.IsNotExist(err) {
 			log.ErrorLog(ctx, "failed to remove staging target path (%s): (%v)", stagingTargetPath, err)
 
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 	}
 
+	// the volume is not used on this node anymore
+	ns.deleteVolumeUsage(volID)
+
 	imgInfo, err := lookupRBDImageMetadataStash(stagingParentPath)
 	if err != nil {
 		log.UsefulLog(ctx, "failed to find image metadata: %v", err)
 		// It is an error if it was mounted, as we should have found the image metadata file with
 		// no errors
 		if isMnt {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		// If not mounted, and error is anything other than metadata file missing, it is an error
 		if !errors.Is(err, ErrMissingStash) {
-			return nil, status.Error(codes.Internal, err.Error())
+			return nil, util.GRPCError(err)
 		}
 
 		// It was not mounted and image metadata is also missing, we are done as the last step in
@@ -1064,15 +1285,17 @@ func (ns *NodeServer) NodeUnstageVolume(
 			stagingTargetPath,
 			err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	log.DebugLog(ctx, "successfully unmapped volume (%s)", req.GetVolumeId())
+	imgInfo.VolumeObjects.Event(ctx, corev1.EventTypeNormal, eventVolumeUnmapped,
+		"Unmapped image %s on node %s", imageSpec, ns.Driver.GetNodeID())
 
 	if err = cleanupRBDImageMetadataStash(stagingParentPath); err != nil {
 		log.ErrorLog(ctx, "failed to cleanup image metadata stash (%v)", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.NodeUnstageVolumeResponse{}, nil
@@ -1134,18 +1357,19 @@ func (ns *NodeServer) NodeExpandVolume(
 		return nil, status.Error(codes.InvalidArgument, "volume path must be provided")
 	}
 
-	if acquired := ns.VolumeLocks.TryAcquire(volumeID); !acquired {
+	token, acquired := ns.VolumeLocks.TryAcquire(volumeID)
+	if !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
-	defer ns.VolumeLocks.Release(volumeID)
+	defer ns.VolumeLocks.Release(volumeID, token)
 
 	imgInfo, err := lookupRBDImageMetadataStash(volumePath)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to find image metadata: %v", err)
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 	devicePath, found := findDeviceMappingImage(
 		ctx,
@@ -1158,34 +1382,60 @@ func (ns *NodeServer) NodeExpandVolume(
 			"failed to get device for stagingtarget path %v", volumePath)
 	}
 
-	mapperFile, mapperPath := util.VolumeMapper(volumeID)
+	// wait for the kernel to notice the new size of the image, the LUKS
+	// device and the filesystem can only be resized afterwards
+	devSize, err := waitForDeviceSize(ctx, devicePath, uint64(req.GetCapacityRange().GetRequiredBytes()))
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get size of device %s: %v", devicePath, err)
+
+		if errors.Is(err, errDeviceNotResized) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
 	if imgInfo.Encrypted {
-		// The volume is encrypted, resize an active mapping
-		err = util.ResizeEncryptedVolume(ctx, mapperFile)
+		// The volume is encrypted, resize the active mapping if it is
+		// smaller than the device. Use mapper device path for fs resize.
+		devicePath, err = resizeEncryptedDevice(ctx, volumeID, volumePath, devicePath)
 		if err != nil {
-			log.ErrorLog(ctx, "failed to resize device %s, mapper %s: %w",
-				devicePath, mapperFile, err)
-
-			return nil, status.Errorf(codes.Internal,
-				"failed to resize device %s, mapper %s: %v", devicePath, mapperFile, err)
+			return nil, util.GRPCError(err)
 		}
-		// Use mapper device path for fs resize
-		devicePath = mapperPath
 	}
 
 	if req.GetVolumeCapability().GetBlock() == nil {
-		// TODO check size and return success or error
 		volumePath += "/" + volumeID
-		resizer := mount.NewResizeFs(utilexec.New())
-		var ok bool
-		ok, err = resizer.Resize(devicePath, volumePath)
-		if !ok {
-			return nil, status.Errorf(codes.Internal,
-				"rbd: resize failed on path %s, error: %v", req.GetVolumePath(), err)
+		// the filesystems are grown by a limited number of workers, so
+		// that many expansions at once do not overload the node
+		err = nodeExpandBatcher.grow(ctx, func() error {
+			resizer := mount.NewResizeFs(utilexec.New())
+			ok, rErr := resizer.NeedResize(devicePath, volumePath)
+			if rErr != nil {
+				return status.Errorf(codes.Internal,
+					"rbd: need resize check failed on device %s and path %s, error: %v", devicePath, volumePath, rErr)
+			}
+
+			if ok {
+				ok, rErr = resizer.Resize(devicePath, volumePath)
+				if !ok {
+					return status.Errorf(codes.Internal,
+						"rbd: resize failed on path %s, error: %v", req.GetVolumePath(), rErr)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, util.GRPCError(err)
 		}
 	}
 
-	return &csi.NodeExpandVolumeResponse{}, nil
+	// report the size of the image, like ControllerExpandVolume does, not
+	// the size of the LUKS device that is smaller by the size of the header
+	return &csi.NodeExpandVolumeResponse{
+		CapacityBytes: int64(devSize),
+	}, nil
 }
 
 // NodeGetCapabilities returns the supported capabilities of the node server.
@@ -1327,6 +1577,10 @@ func (ns *NodeServer) NodeGetVolumeStats(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	// the usage in the Ceph cluster is exported as metrics, it is not part
+	// of the response
+	go ns.updateVolumeUsage(context.WithoutCancel(ctx), req.GetVolumeId())
+
 	stat, err := os.Stat(targetPath)
 	if err != nil {
 		if util.IsCorruptedMountError(err) {
@@ -1343,10 +1597,16 @@ func (ns *NodeServer) NodeGetVolumeStats(
 		return nil, status.Errorf(codes.InvalidArgument, "failed to get stat for targetpath %q: %v", targetPath, err)
 	}
 
+	// errors of the device in the kernel log are not detected by the
+	// health-checker when the volume is not used
+	if condition := deviceErrorCondition(ctx, targetPath); condition != nil {
+		return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+	}
+
 	if stat.Mode().IsDir() {
 		return csicommon.FilesystemNodeGetVolumeStats(ctx, ns.Mounter, targetPath, true)
 	} else if (stat.Mode() & os.ModeDevice) == os.ModeDevice {
-		return blockNodeGetVolumeStats(ctx, targetPath)
+		return ns.blockNodeGetVolumeStats(ctx, req.GetVolumeId(), targetPath)
 	}
 
 	return nil, fmt.Errorf("targetpath %q is not a block device", targetPath)
@@ -1355,17 +1615,47 @@ func (ns *NodeServer) NodeGetVolumeStats(
 // blockNodeGetVolumeStats gets the metrics for a `volumeMode: Block` type of
 // volume. At the moment, only the size of the block-device can be returned, as
 // there are no secrets in the NodeGetVolumeStats request that enables us to
-// connect to the Ceph cluster.
+// connect to the Ceph cluster. The condition of the volume is reported by the
+// health-checker that reads from the block-device.
 //
 // TODO: https://github.com/container-storage-interface/spec/issues/371#issuecomment-756834471
-func blockNodeGetVolumeStats(ctx context.Context, targetPath string) (*csi.NodeGetVolumeStatsResponse, error) {
+func (ns *NodeServer) blockNodeGetVolumeStats(
+	ctx context.Context,
+	volumeID, targetPath string,
+) (*csi.NodeGetVolumeStatsResponse, error) {
+	healthy, msg := ns.HealthChecker.IsHealthy(volumeID, targetPath)
+
+	// If healthy and an error is returned, it means that the checker was not
+	// started. This could happen when the node-plugin was restarted and the
+	// volume is already published.
+	if healthy && msg != nil {
+		ns.startBlockHealthChecker(ctx, volumeID, targetPath)
+	}
+
+	// the volume may have recovered since the last periodic check, it is
+	// only reported as abnormal when a check right away fails as well
+	if !healthy {
+		healthy, msg = ns.HealthChecker.CheckVolume(volumeID, targetPath)
+	}
+
+	// !healthy indicates a problem with the block-device, reading the size
+	// may hang in that case
+	if !healthy {
+		return &csi.NodeGetVolumeStatsResponse{
+			VolumeCondition: &csi.VolumeCondition{
+				Abnormal: true,
+				Message:  msg.Error(),
+			},
+		}, nil
+	}
+
 	mp := volume.NewMetricsBlock(targetPath)
 	m, err := mp.GetMetrics()
 	if err != nil {
 		err = fmt.Errorf("failed to get metrics: %w", err)
 		log.ErrorLog(ctx, err.Error())
 
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, util.GRPCError(err)
 	}
 
 	return &csi.NodeGetVolumeStatsResponse{
@@ -147,7 +147,7 @@ func TestNodeServer_appendReadAffinityMapOptions(t *testing.T) {
 				readAffinityMapOptions: "read_from_replica=localize,crush_location=region:west",
 				mounter:                rbdNbdMounter,
 			},
-			want: "",
+			want: "rbd_read_from_replica_policy=localize,crush_location=region=west",
 		},
 		{
 			name: "filled mapOptions, filled crushLocationMap & default mounter",
@@ -165,7 +165,7 @@ func TestNodeServer_appendReadAffinityMapOptions(t *testing.T) {
 				readAffinityMapOptions: "read_from_replica=localize,crush_location=region:west",
 				mounter:                rbdNbdMounter,
 			},
-			want: "notrim",
+			want: "notrim,rbd_read_from_replica_policy=localize,crush_location=region=west",
 		},
 		{
 			name: "filled mapOptions, empty readAffinityMapOptions & default mounter",
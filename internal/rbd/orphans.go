@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// imageNameAttribute is set in the UUID directory of every reserved volume,
+// it is used to list all reservations in the journal.
+const imageNameAttribute = "imagename"
+
+// ListJournaledVolumes returns the IDs of the volumes that are reserved in
+// the journal of the journalPool and are located in the pool of the cluster.
+// The provisioner credentials of the CSI configuration are used.
+func ListJournaledVolumes(ctx context.Context, clusterID, pool, journalPool string) ([]string, error) {
+	if journalPool == "" {
+		journalPool = pool
+	}
+
+	cr, monitors, err := configuredProvisionerCredentials(ctx, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.DeleteCredentials()
+
+	radosNamespace, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rados namespace using clusterID (%s): %w", clusterID, err)
+	}
+
+	journalPoolID, imagePoolID, err := util.GetPoolIDs(ctx, monitors, journalPool, pool, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := volJournal.Connect(monitors, radosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	reservations, err := j.ListReservations(ctx, journalPool, journalPoolID, imagePoolID, imageNameAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes in pool %q: %w", pool, err)
+	}
+
+	volumeIDs := make([]string, 0, len(reservations))
+	for reservedUUID := range reservations {
+		volumeID, err := util.GenerateVolID(ctx, monitors, cr, imagePoolID, pool, clusterID, reservedUUID)
+		if err != nil {
+			return nil, err
+		}
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+
+	return volumeIDs, nil
+}
+
+// DeleteOrphanedVolume removes the image and the journal reservation of a
+// volume that is not referenced by a PersistentVolume anymore. The
+// provisioner credentials of the CSI configuration are used. Volumes that
+// are removed already are not an error.
+func DeleteOrphanedVolume(ctx context.Context, volumeID string) error {
+	cr, _, err := configuredProvisionerCredentials(ctx, util.GetClusterIDFromVolumeID(volumeID))
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, nil)
+	defer func() {
+		if rbdVol != nil {
+			rbdVol.Destroy(ctx)
+		}
+	}()
+	switch {
+	case errors.Is(err, util.ErrPoolNotFound), errors.Is(err, util.ErrKeyNotFound):
+		log.DebugLog(ctx, "volume %s is removed already: %v", volumeID, err)
+
+		return nil
+	case errors.Is(err, ErrImageNotFound):
+		// the image is gone, the reservation needs to be removed
+		if err = rbdVol.ensureImageCleanup(ctx); err != nil {
+			return fmt.Errorf("failed to cleanup image %q: %w", rbdVol, err)
+		}
+
+		return undoVolReservation(ctx, rbdVol, cr)
+	case err != nil:
+		return err
+	}
+
+	_, err = cleanupRBDImage(ctx, rbdVol, cr)
+
+	return err
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// podIOLimitParameters maps the StorageClass parameters, or the volume
+// attributes of a static volume, for the IO limits of the Pods that use the
+// volume to the keys of the cgroup v2 io.max file.
+var podIOLimitParameters = map[string]string{
+	"podReadBPSLimit":   "rbps",
+	"podWriteBPSLimit":  "wbps",
+	"podReadIOPSLimit":  "riops",
+	"podWriteIOPSLimit": "wiops",
+}
+
+// errPodInfoMissing is returned when IO limits are requested for a Pod, but
+// the volume context does not contain the Pod information.
+var errPodInfoMissing = errors.New("pod information missing, podInfoOnMount needs to be enabled in the CSIDriver")
+
+// parsePodIOLimits returns the IO limits for the Pods that use the volume,
+// keyed by the keys of the cgroup v2 io.max file. In case no limits are set,
+// nil is returned.
+func parsePodIOLimits(parameters map[string]string) (map[string]uint64, error) {
+	limits, err := parseQoSLimits(parameters, podIOLimitParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	for param, key := range podIOLimitParameters {
+		if limit, ok := limits[key]; ok && limit == 0 {
+			return nil, fmt.Errorf("%s needs to be larger than 0", param)
+		}
+	}
+
+	return limits, nil
+}
+
+// applyPodIOLimits limits the IO of the Pod that the volume is published for
+// on the RBD device of the volume, when the volume context contains IO
+// limits. The stagingPath is the device for block volumes, or the filesystem
+// on the device.
+func applyPodIOLimits(volumeContext map[string]string, stagingPath string) error {
+	limits, err := parsePodIOLimits(volumeContext)
+	if err != nil || limits == nil {
+		return err
+	}
+
+	podUID := volumeContext[util.PodUIDKey]
+	if podUID == "" {
+		return errPodInfoMissing
+	}
+
+	return util.SetPodIOLimits(podUID, stagingPath, limits)
+}
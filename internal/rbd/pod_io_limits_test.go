@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePodIOLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		want       map[string]uint64
+		wantErr    bool
+	}{
+		{
+			name:       "no limits",
+			parameters: map[string]string{"pool": "replicapool"},
+			want:       nil,
+		},
+		{
+			name: "read and write limits",
+			parameters: map[string]string{
+				"podReadBPSLimit":   "104857600",
+				"podWriteIOPSLimit": "500",
+			},
+			want: map[string]uint64{"rbps": 104857600, "wiops": 500},
+		},
+		{
+			name:       "invalid limit",
+			parameters: map[string]string{"podReadIOPSLimit": "fast"},
+			wantErr:    true,
+		},
+		{
+			name:       "zero limit",
+			parameters: map[string]string{"podWriteBPSLimit": "0"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			limits, err := parsePodIOLimits(tt.parameters)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, limits)
+		})
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// MigrateVolume moves the image of the volume to a different pool and/or
+// data pool with a live-migration. The volume ID does not change, the per
+// image journal stays in the pool that is part of the volume ID and records
+// the pool where the image is located after the migration.
+//
+// The image must not be in use while the migration is prepared, clients
+// need to reopen the image after that. Image metadata, including the QoS
+// configuration, is carried over to the new image by librbd.
+//
+// When targetPool is empty, the image stays in its current pool. When
+// targetDataPool is empty, the data of the image is stored in targetPool.
+// An interrupted migration is continued when MigrateVolume is called again
+// with the same arguments.
+func MigrateVolume(
+	ctx context.Context,
+	volumeID,
+	targetPool,
+	targetDataPool string,
+	cr *util.Credentials,
+) error {
+	if targetPool == "" && targetDataPool == "" {
+		return fmt.Errorf("%w: a target pool or data pool is required for migration", ErrInvalidArgument)
+	}
+
+	rv, err := GenVolFromVolID(ctx, volumeID, cr, nil)
+	if rv != nil {
+		defer rv.Destroy(ctx)
+	}
+	if err != nil && (!errors.Is(err, ErrImageNotFound) || rv == nil || rv.RbdImageName == "") {
+		return err
+	}
+
+	if targetPool == "" {
+		targetPool = rv.Pool
+	}
+
+	switch {
+	case err != nil:
+		// the image is missing from the pool that is recorded in the
+		// journal, a previous attempt might have been interrupted after
+		// the migration was prepared
+		err = rv.resumeMigration(ctx, targetPool)
+	case rv.isMigrating(ctx):
+		log.DebugLog(ctx, "continuing the migration of image %s", rv)
+	default:
+		err = rv.prepareMigration(ctx, targetPool, targetDataPool)
+	}
+	if err != nil {
+		return err
+	}
+
+	return rv.finishMigration(ctx)
+}
+
+// isMigrating returns true when the image is the target of a live-migration
+// that has not been committed yet.
+func (rv *rbdVolume) isMigrating(ctx context.Context) bool {
+	err := rv.openIoctx()
+	if err != nil {
+		return false
+	}
+
+	status, err := librbd.MigrationStatus(rv.ioctx, rv.RbdImageName)
+	if err != nil {
+		// librbd returns an error for images that are not migrating
+		log.DebugLog(ctx, "no migration status for image %s: %v", rv, err)
+
+		return false
+	}
+
+	return status.DestImageName == rv.RbdImageName && status.DestPoolID == int(rv.ioctx.GetPoolID())
+}
+
+// prepareMigration checks that the image can be migrated, prepares the
+// migration to the target pool and records the new location of the image
+// in the journal.
+func (rv *rbdVolume) prepareMigration(ctx context.Context, targetPool, targetDataPool string) error {
+	inUse, err := rv.isInUse()
+	if err != nil {
+		return fmt.Errorf("failed to check if image %q is in use: %w", rv, err)
+	}
+	if inUse {
+		return fmt.Errorf("%w: image %q can not be migrated", ErrImageInUse, rv)
+	}
+
+	info, err := rv.GetMirroringInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if info.GetState() == librbd.MirrorImageEnabled.String() {
+		return fmt.Errorf("%w: image %q has mirroring enabled", ErrFailedPrecondition, rv)
+	}
+
+	err = rv.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	targetIoctx, err := rv.conn.GetIoctx(targetPool)
+	if err != nil {
+		return err
+	}
+	defer targetIoctx.Destroy()
+	targetIoctx.SetNamespace(rv.RadosNamespace)
+
+	options := librbd.NewRbdImageOptions()
+	defer options.Destroy()
+	if targetDataPool != "" {
+		err = options.SetString(librbd.RbdImageOptionDataPool, targetDataPool)
+		if err != nil {
+			return fmt.Errorf("failed to set data pool: %w", err)
+		}
+	}
+
+	log.DebugLog(ctx, "preparing migration of image %s to pool %s (data pool %q)", rv, targetPool, targetDataPool)
+
+	err = librbd.MigrationPrepare(rv.ioctx, rv.RbdImageName, targetIoctx, rv.RbdImageName, options)
+	if err != nil {
+		return fmt.Errorf("failed to prepare migration of image %q to pool %q: %w", rv, targetPool, err)
+	}
+
+	sourcePool := rv.Pool
+	err = rv.storeMigrationTarget(ctx, targetPool)
+	if err != nil {
+		// the journal still points to the source, roll back
+		abortErr := librbd.MigrationAbort(targetIoctx, rv.RbdImageName)
+		if abortErr != nil {
+			log.ErrorLog(ctx, "failed to abort migration of image %s/%s: %v", sourcePool, rv.RbdImageName, abortErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// resumeMigration verifies that the image with the same name in the target
+// pool is the target of a live-migration of this volume, and records the new
+// location of the image in the journal.
+func (rv *rbdVolume) resumeMigration(ctx context.Context, targetPool string) error {
+	sourcePoolID, err := util.GetPoolID(rv.Monitors, rv.conn.Creds, rv.Pool)
+	if err != nil {
+		return err
+	}
+
+	targetIoctx, err := rv.conn.GetIoctx(targetPool)
+	if err != nil {
+		return err
+	}
+	defer targetIoctx.Destroy()
+	targetIoctx.SetNamespace(rv.RadosNamespace)
+
+	status, err := librbd.MigrationStatus(targetIoctx, rv.RbdImageName)
+	if err != nil {
+		return fmt.Errorf("%w: image %q is not migrating to pool %q: %w", ErrImageNotFound, rv, targetPool, err)
+	}
+
+	if int64(status.SourcePoolID) != sourcePoolID || status.SourceImageName != rv.RbdImageName {
+		return fmt.Errorf("%w: image %s/%s is migrating from image %q in pool ID %d", ErrImageNotFound,
+			targetPool, rv.RbdImageName, status.SourceImageName, status.SourcePoolID)
+	}
+
+	log.DebugLog(ctx, "resuming migration of image %s to pool %s", rv, targetPool)
+
+	return rv.storeMigrationTarget(ctx, targetPool)
+}
+
+// storeMigrationTarget updates the volume to point to the image in the target
+// pool, and stores the pool and the new image ID in the journal.
+func (rv *rbdVolume) storeMigrationTarget(ctx context.Context, targetPool string) error {
+	volJournalPool := rv.volJournalPool()
+
+	if rv.ioctx != nil {
+		rv.ioctx.Destroy()
+		rv.ioctx = nil
+	}
+	rv.Pool = targetPool
+	rv.VolJournalPool = volJournalPool
+
+	// the image in the target pool has a different image ID
+	rv.ImageID = ""
+	err := rv.getImageID()
+	if err != nil {
+		return fmt.Errorf("failed to get image ID of migration target %q: %w", rv, err)
+	}
+
+	imagePoolID, err := util.GetPoolID(rv.Monitors, rv.conn.Creds, rv.Pool)
+	if err != nil {
+		return err
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, rv.conn.Creds)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	err = j.StoreImageLocation(ctx, volJournalPool, rv.ReservedID, rv.ImageID, imagePoolID)
+	if err != nil {
+		return fmt.Errorf("failed to store location of %q: %w", rv, err)
+	}
+
+	return nil
+}
+
+// finishMigration copies all data to the target image and commits the
+// migration, which removes the source image.
+func (rv *rbdVolume) finishMigration(ctx context.Context) error {
+	err := rv.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	status, err := librbd.MigrationStatus(rv.ioctx, rv.RbdImageName)
+	if err != nil {
+		return fmt.Errorf("failed to get migration status of image %q: %w", rv, err)
+	}
+
+	// a previous attempt may have copied all data already
+	if status.State != librbd.MigrationImageExecuted {
+		log.DebugLog(ctx, "executing migration of image %s", rv)
+
+		err = librbd.MigrationExecute(rv.ioctx, rv.RbdImageName)
+		if err != nil {
+			return fmt.Errorf("failed to execute migration of image %q: %w", rv, err)
+		}
+	}
+
+	err = librbd.MigrationCommit(rv.ioctx, rv.RbdImageName)
+	if err != nil {
+		return fmt.Errorf("failed to commit migration of image %q: %w", rv, err)
+	}
+
+	log.DebugLog(ctx, "migration of image %s completed", rv)
+
+	return nil
+}
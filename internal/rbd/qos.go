@@ -0,0 +1,242 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+const (
+	// qosMetaKey is the image metadata key where the QoS specification of
+	// the volume is stored, so that the limits can be re-applied when the
+	// volume gets expanded.
+	qosMetaKey = "rbd.csi.ceph.com/qos"
+
+	// imageConfigMetaPrefix is the prefix librbd uses for image metadata
+	// that overrides the client configuration for a single image.
+	imageConfigMetaPrefix = "conf_"
+)
+
+// qosParameters maps the StorageClass parameters to the librbd QoS
+// configuration options that get set on the image.
+var qosParameters = map[string]string{
+	"qosIOPSLimit":      "rbd_qos_iops_limit",
+	"qosReadIOPSLimit":  "rbd_qos_read_iops_limit",
+	"qosWriteIOPSLimit": "rbd_qos_write_iops_limit",
+	"qosBPSLimit":       "rbd_qos_bps_limit",
+	"qosReadBPSLimit":   "rbd_qos_read_bps_limit",
+	"qosWriteBPSLimit":  "rbd_qos_write_bps_limit",
+	"qosIOPSBurst":      "rbd_qos_iops_burst",
+	"qosReadIOPSBurst":  "rbd_qos_read_iops_burst",
+	"qosWriteIOPSBurst": "rbd_qos_write_iops_burst",
+	"qosBPSBurst":       "rbd_qos_bps_burst",
+	"qosReadBPSBurst":   "rbd_qos_read_bps_burst",
+	"qosWriteBPSBurst":  "rbd_qos_write_bps_burst",
+}
+
+// qosPerGiBParameters maps the StorageClass parameters for capacity
+// proportional limits to the librbd QoS configuration options. The value of
+// the option is calculated by multiplying the parameter with the size of the
+// volume in GiB.
+var qosPerGiBParameters = map[string]string{
+	"qosPerGiBIOPS":           "rbd_qos_iops_limit",
+	"qosPerGiBReadIOPS":       "rbd_qos_read_iops_limit",
+	"qosPerGiBWriteIOPS":      "rbd_qos_write_iops_limit",
+	"qosPerGiBBandwidth":      "rbd_qos_bps_limit",
+	"qosPerGiBReadBandwidth":  "rbd_qos_read_bps_limit",
+	"qosPerGiBWriteBandwidth": "rbd_qos_write_bps_limit",
+}
+
+// qosSpec describes the QoS limits that were requested for a volume. It is
+// stored as JSON in the image metadata.
+type qosSpec struct {
+	// Limits contains the librbd QoS options with their static values.
+	Limits map[string]uint64 `json:"limits,omitempty"`
+	// PerGiB contains the librbd QoS options with their value per GiB of
+	// the volume size. When the same option is also set in Limits, the
+	// static value is used as upper bound.
+	PerGiB map[string]uint64 `json:"perGiB,omitempty"`
+}
+
+// parseQoSSpec returns the qosSpec from the QoS related parameters. In case
+// no QoS parameters are set, nil is returned.
+func parseQoSSpec(parameters map[string]string) (*qosSpec, error) {
+	limits, err := parseQoSLimits(parameters, qosParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	perGiB, err := parseQoSLimits(parameters, qosPerGiBParameters)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(limits) == 0 && len(perGiB) == 0 {
+		return nil, nil
+	}
+
+	return &qosSpec{
+		Limits: limits,
+		PerGiB: perGiB,
+	}, nil
+}
+
+// parseQoSLimits returns the librbd QoS options with their values for all
+// parameters that are listed in the options map.
+func parseQoSLimits(parameters, options map[string]string) (map[string]uint64, error) {
+	var limits map[string]uint64
+
+	for param, option := range options {
+		val, ok := parameters[param]
+		if !ok {
+			continue
+		}
+
+		limit, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %q: %w", param, val, err)
+		}
+
+		if limits == nil {
+			limits = map[string]uint64{}
+		}
+		limits[option] = limit
+	}
+
+	return limits, nil
+}
+
+// limitsForSize returns the librbd QoS options and their values for a volume
+// of the given size in bytes.
+func (qs *qosSpec) limitsForSize(size int64) map[string]uint64 {
+	limits := make(map[string]uint64, len(qs.Limits)+len(qs.PerGiB))
+	for option, limit := range qs.Limits {
+		limits[option] = limit
+	}
+
+	// the size of the volume in GiB, rounded up so that small volumes get
+	// at least the limits of a single GiB
+	sizeGiB := uint64(math.Ceil(float64(size) / helpers.GiB))
+	if sizeGiB == 0 {
+		sizeGiB = 1
+	}
+
+	for option, perGiB := range qs.PerGiB {
+		limit := perGiB * sizeGiB
+		if maxLimit, ok := qs.Limits[option]; ok && maxLimit < limit {
+			limit = maxLimit
+		}
+		limits[option] = limit
+	}
+
+	return limits
+}
+
+// applyQoS stores the QoS specification in the image metadata and sets the
+// QoS limits as image configuration overrides.
+func (rv *rbdVolume) applyQoS(ctx context.Context) error {
+	if rv.QoS == nil {
+		return nil
+	}
+
+	spec, err := json.Marshal(rv.QoS)
+	if err != nil {
+		return fmt.Errorf("failed to marshal QoS specification: %w", err)
+	}
+
+	err = rv.SetMetadata(qosMetaKey, string(spec))
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", qosMetaKey, rv, err)
+	}
+
+	for option, limit := range rv.QoS.limitsForSize(rv.VolSize) {
+		key := imageConfigMetaPrefix + option
+		err = rv.SetMetadata(key, strconv.FormatUint(limit, 10))
+		if err != nil {
+			return fmt.Errorf("failed to set metadata key %q on %q: %w", key, rv, err)
+		}
+		log.DebugLog(ctx, "set QoS option %s=%d on image %s", option, limit, rv)
+	}
+
+	return nil
+}
+
+// updateQoS reads the QoS specification from the image metadata and
+// re-applies the limits. This is needed after the image has been resized.
+func (rv *rbdVolume) updateQoS(ctx context.Context) error {
+	spec, err := rv.GetMetadata(qosMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get metadata key %q on %q: %w", qosMetaKey, rv, err)
+	}
+
+	qs := &qosSpec{}
+	err = json.Unmarshal([]byte(spec), qs)
+	if err != nil {
+		return fmt.Errorf("failed to parse QoS specification %q of %q: %w", spec, rv, err)
+	}
+	rv.QoS = qs
+
+	return rv.applyQoS(ctx)
+}
+
+// modifyQoS replaces the QoS specification of the volume with qs. The librbd
+// QoS options of the current specification that are not part of qs anymore
+// are removed from the image.
+func (rv *rbdVolume) modifyQoS(ctx context.Context, qs *qosSpec) error {
+	spec, err := rv.GetMetadata(qosMetaKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to get metadata key %q on %q: %w", qosMetaKey, rv, err)
+	}
+
+	if spec != "" {
+		current := &qosSpec{}
+		err = json.Unmarshal([]byte(spec), current)
+		if err != nil {
+			return fmt.Errorf("failed to parse QoS specification %q of %q: %w", spec, rv, err)
+		}
+
+		newLimits := qs.limitsForSize(rv.VolSize)
+		for option := range current.limitsForSize(rv.VolSize) {
+			if _, ok := newLimits[option]; ok {
+				continue
+			}
+
+			key := imageConfigMetaPrefix + option
+			err = rv.RemoveMetadata(key)
+			if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+				return fmt.Errorf("failed to remove metadata key %q on %q: %w", key, rv, err)
+			}
+			log.DebugLog(ctx, "removed QoS option %s from image %s", option, rv)
+		}
+	}
+
+	rv.QoS = qs
+
+	return rv.applyQoS(ctx)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+func TestParseQoSSpec(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		want       *qosSpec
+		wantErr    bool
+	}{
+		{
+			name:       "no QoS parameters",
+			parameters: map[string]string{"pool": "replicapool"},
+			want:       nil,
+		},
+		{
+			name: "static limits",
+			parameters: map[string]string{
+				"qosReadIOPSLimit": "1000",
+				"qosWriteBPSBurst": "1048576",
+			},
+			want: &qosSpec{
+				Limits: map[string]uint64{
+					"rbd_qos_read_iops_limit": 1000,
+					"rbd_qos_write_bps_burst": 1048576,
+				},
+			},
+		},
+		{
+			name: "per GiB limits",
+			parameters: map[string]string{
+				"qosIOPSLimit":       "5000",
+				"qosPerGiBIOPS":      "100",
+				"qosPerGiBBandwidth": "1048576",
+			},
+			want: &qosSpec{
+				Limits: map[string]uint64{
+					"rbd_qos_iops_limit": 5000,
+				},
+				PerGiB: map[string]uint64{
+					"rbd_qos_iops_limit": 100,
+					"rbd_qos_bps_limit":  1048576,
+				},
+			},
+		},
+		{
+			name:       "invalid per GiB limit",
+			parameters: map[string]string{"qosPerGiBReadIOPS": "ten"},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid limit",
+			parameters: map[string]string{"qosIOPSLimit": "-1"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseQoSSpec(tt.parameters)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseQoSSpec() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQoSSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQoSLimitsForSize(t *testing.T) {
+	t.Parallel()
+	spec := &qosSpec{
+		Limits: map[string]uint64{
+			"rbd_qos_iops_limit": 5000,
+			"rbd_qos_iops_burst": 8000,
+		},
+		PerGiB: map[string]uint64{
+			"rbd_qos_iops_limit": 100,
+			"rbd_qos_bps_limit":  1024,
+		},
+	}
+	tests := []struct {
+		name string
+		size int64
+		want map[string]uint64
+	}{
+		{
+			name: "smaller than 1GiB",
+			size: 512 * helpers.MiB,
+			want: map[string]uint64{
+				"rbd_qos_iops_limit": 100,
+				"rbd_qos_iops_burst": 8000,
+				"rbd_qos_bps_limit":  1024,
+			},
+		},
+		{
+			name: "10GiB",
+			size: 10 * helpers.GiB,
+			want: map[string]uint64{
+				"rbd_qos_iops_limit": 1000,
+				"rbd_qos_iops_burst": 8000,
+				"rbd_qos_bps_limit":  10240,
+			},
+		},
+		{
+			name: "capped by static limit",
+			size: 100 * helpers.GiB,
+			want: map[string]uint64{
+				"rbd_qos_iops_limit": 5000,
+				"rbd_qos_iops_burst": 8000,
+				"rbd_qos_bps_limit":  102400,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := spec.limitsForSize(tt.size)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("limitsForSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// sizeAttribute is the attribute in the journal that contains the size
+	// of the volume in bytes.
+	sizeAttribute = "size"
+
+	// quotaVolumesCounter and quotaBytesCounter are the counters of the
+	// volumes and bytes in use in a pool and RADOS namespace, they are
+	// compared to the quota of the RADOS namespace.
+	quotaVolumesCounter = "volumes"
+	quotaBytesCounter   = "bytes"
+)
+
+// errNoQuotaCounters is returned by the update functions of the quota counters
+// when the counters do not exist and no quota is configured, the counters are
+// not created then.
+var errNoQuotaCounters = errors.New("no quota counters")
+
+// quotaCountersObject returns the name of the object in the journal pool that
+// contains the usage counters of the volumes in the pool.
+func quotaCountersObject(pool string) string {
+	return "csi.quota." + pool
+}
+
+// checkQuota returns ErrQuotaExceeded when a new volume of requestBytes would
+// exceed the quota, given the number of volumes and bytes that are in use.
+func checkQuota(quota *kubernetes.NamespaceQuota, volumes int, usedBytes, requestBytes int64) error {
+	if quota.MaxVolumes > 0 && volumes+1 > quota.MaxVolumes {
+		return fmt.Errorf("%w: %d of %d volumes in use in pool %q and namespace %q",
+			ErrQuotaExceeded, volumes, quota.MaxVolumes, quota.Pool, quota.RadosNamespace)
+	}
+
+	if quota.MaxBytes > 0 && usedBytes+requestBytes > quota.MaxBytes {
+		return fmt.Errorf("%w: %d of %d bytes in use in pool %q and namespace %q, %d bytes requested",
+			ErrQuotaExceeded, usedBytes, quota.MaxBytes, quota.Pool, quota.RadosNamespace, requestBytes)
+	}
+
+	return nil
+}
+
+// addUsage returns the quota counters with the volumes and bytes added. The
+// counters do not drop below 0, volumes that were created before the counters
+// existed may be subtracted.
+func addUsage(counters journal.Counters, volumes, bytes int64) journal.Counters {
+	updated := journal.Counters{
+		quotaVolumesCounter: max(counters[quotaVolumesCounter]+volumes, 0),
+		quotaBytesCounter:   max(counters[quotaBytesCounter]+bytes, 0),
+	}
+
+	return updated
+}
+
+// storeVolumeSize stores the size of the volume in the journal, so that it
+// can be accounted for in the quota of the RADOS namespace.
+func (rv *rbdVolume) storeVolumeSize(ctx context.Context, j *journal.Connection) error {
+	return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, sizeAttribute, strconv.FormatInt(rv.VolSize, 10))
+}
+
+// fetchVolumeSize returns the size of the volume that is stored in the
+// journal. Volumes that were created before sizes were stored return the
+// size of the image.
+func (rv *rbdVolume) fetchVolumeSize(ctx context.Context, j *journal.Connection) int64 {
+	sizeStr, err := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, sizeAttribute)
+	if err == nil && sizeStr != "" {
+		if size, pErr := strconv.ParseInt(sizeStr, 10, 64); pErr == nil {
+			return size
+		}
+	}
+
+	return rv.VolSize
+}
+
+// updateVolumeSize updates the size of the volume in the journal and the
+// quota counters after the volume was expanded. Static volumes do not have a
+// journal entry.
+func (rv *rbdVolume) updateVolumeSize(ctx context.Context, cr *util.Credentials) error {
+	if rv.ReservedID == "" {
+		return nil
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	oldSize := rv.fetchVolumeSize(ctx, j)
+	err = rv.storeVolumeSize(ctx, j)
+	if err != nil {
+		return err
+	}
+
+	return rv.updateQuotaCounters(ctx, j, 0, rv.VolSize-oldSize)
+}
+
+// updateQuotaCounters adds the volumes and bytes to the quota counters, when
+// the counters exist.
+func (rv *rbdVolume) updateQuotaCounters(ctx context.Context, j *journal.Connection, volumes, bytes int64) error {
+	oid := quotaCountersObject(rv.Pool)
+	counters, err := j.GetCounters(ctx, rv.JournalPool, oid)
+	if err != nil || counters == nil {
+		return err
+	}
+
+	err = j.UpdateCounters(ctx, rv.JournalPool, oid, func(counters journal.Counters) (journal.Counters, error) {
+		if counters == nil {
+			return nil, errNoQuotaCounters
+		}
+
+		return addUsage(counters, volumes, bytes), nil
+	})
+	if errors.Is(err, errNoQuotaCounters) {
+		return nil
+	}
+
+	return err
+}
+
+// releaseNamespaceQuota subtracts the volume from the quota counters. It is
+// called when the reservation of the volume is removed from the journal.
+func (rv *rbdVolume) releaseNamespaceQuota(ctx context.Context, j *journal.Connection, size int64) {
+	err := rv.updateQuotaCounters(ctx, j, -1, -size)
+	if err != nil {
+		// the quota accounts for the volume until the counters are
+		// recreated
+		log.WarningLog(ctx, "failed to release the quota of volume %s: %v", rv, err)
+	}
+}
+
+// getReservedVolumeSize returns the size of the image of a volume that has no
+// size stored in the journal, like volumes that were created before quotas
+// were supported. 0 is returned when the image does not exist (yet).
+func (rv *rbdVolume) getReservedVolumeSize(
+	ctx context.Context,
+	j *journal.Connection,
+	cr *util.Credentials,
+	reservedUUID string,
+) (int64, error) {
+	attrs, err := j.GetImageAttributes(ctx, rv.JournalPool, reservedUUID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	vol := &rbdVolume{}
+	vol.Monitors = rv.Monitors
+	vol.ClusterID = rv.ClusterID
+	vol.Pool = rv.Pool
+	vol.RadosNamespace = rv.RadosNamespace
+	vol.RbdImageName = attrs.ImageName
+	if err = vol.Connect(cr); err != nil {
+		return 0, err
+	}
+	defer vol.Destroy(ctx)
+
+	err = vol.getImageInfo()
+	if err != nil {
+		if errors.Is(err, ErrImageNotFound) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return vol.VolSize, nil
+}
+
+// countNamespaceUsage returns the number of volumes and bytes that are
+// reserved in the journal of the pool. It lists all reservations, and is only
+// used to initialize the quota counters.
+func (rv *rbdVolume) countNamespaceUsage(
+	ctx context.Context,
+	j *journal.Connection,
+	cr *util.Credentials,
+) (journal.Counters, error) {
+	journalPoolID, imagePoolID, err := util.GetPoolIDs(ctx, rv.Monitors, rv.JournalPool, rv.Pool, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := j.ListReservations(ctx, rv.JournalPool, journalPoolID, imagePoolID, sizeAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes in pool %q: %w", rv.Pool, err)
+	}
+
+	var usedBytes int64
+	for reservedUUID, sizeStr := range reservations {
+		var size int64
+		if sizeStr != "" {
+			size, err = strconv.ParseInt(sizeStr, 10, 64)
+		} else {
+			size, err = rv.getReservedVolumeSize(ctx, j, cr, reservedUUID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of volume %s: %w", reservedUUID, err)
+		}
+
+		usedBytes += size
+	}
+
+	log.DebugLog(ctx, "%d volumes with %d bytes reserved in pool %q and namespace %q",
+		len(reservations), usedBytes, rv.Pool, rv.RadosNamespace)
+
+	return journal.Counters{
+		quotaVolumesCounter: int64(len(reservations)),
+		quotaBytesCounter:   usedBytes,
+	}, nil
+}
+
+// chargeNamespaceQuota verifies that the new volume fits in the quota that is
+// configured for the pool and RADOS namespace of the volume, and adds it to
+// the quota counters. It returns ErrQuotaExceeded when the volume does not
+// fit. The counters are kept in the journal pool and are initialized from the
+// reservations in the journal when a quota is configured. The volume needs to
+// be released with releaseNamespaceQuota when it is not created.
+func (rv *rbdVolume) chargeNamespaceQuota(ctx context.Context, cr *util.Credentials) error {
+	quota, err := util.GetRBDNamespaceQuota(util.CsiConfigFile, rv.ClusterID, rv.Pool, rv.RadosNamespace)
+	if err != nil {
+		return err
+	}
+	if quota != nil && quota.MaxBytes == 0 && quota.MaxVolumes == 0 {
+		quota = nil
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	if quota == nil {
+		// keep the counters up to date, in case a quota was configured
+		// before
+		return rv.updateQuotaCounters(ctx, j, 1, rv.VolSize)
+	}
+
+	return j.UpdateCounters(ctx, rv.JournalPool, quotaCountersObject(rv.Pool),
+		func(counters journal.Counters) (journal.Counters, error) {
+			if counters == nil {
+				var cErr error
+				counters, cErr = rv.countNamespaceUsage(ctx, j, cr)
+				if cErr != nil {
+					return nil, cErr
+				}
+			}
+
+			qErr := checkQuota(quota, int(counters[quotaVolumesCounter]), counters[quotaBytesCounter], rv.VolSize)
+			if qErr != nil {
+				return nil, qErr
+			}
+
+			return addUsage(counters, 1, rv.VolSize), nil
+		})
+}
+
+// releaseNamespaceQuotaOf connects to the journal and subtracts the volume of
+// size bytes from the quota counters.
+func (rv *rbdVolume) releaseNamespaceQuotaOf(ctx context.Context, cr *util.Credentials, size int64) {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		log.WarningLog(ctx, "failed to release the quota of volume %s: %v", rv, err)
+
+		return
+	}
+	defer j.Destroy()
+
+	rv.releaseNamespaceQuota(ctx, j, size)
+}
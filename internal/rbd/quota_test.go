@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/journal"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckQuota(t *testing.T) {
+	t.Parallel()
+
+	const gib = 1024 * 1024 * 1024
+
+	tests := []struct {
+		name         string
+		quota        kubernetes.NamespaceQuota
+		volumes      int
+		usedBytes    int64
+		requestBytes int64
+		wantErr      bool
+	}{
+		{
+			name:         "unlimited",
+			quota:        kubernetes.NamespaceQuota{},
+			volumes:      100,
+			usedBytes:    100 * gib,
+			requestBytes: gib,
+		},
+		{
+			name:         "below volume limit",
+			quota:        kubernetes.NamespaceQuota{MaxVolumes: 3},
+			volumes:      2,
+			requestBytes: gib,
+		},
+		{
+			name:         "volume limit reached",
+			quota:        kubernetes.NamespaceQuota{MaxVolumes: 3},
+			volumes:      3,
+			requestBytes: gib,
+			wantErr:      true,
+		},
+		{
+			name:         "fits exactly in byte limit",
+			quota:        kubernetes.NamespaceQuota{MaxBytes: 10 * gib},
+			volumes:      9,
+			usedBytes:    9 * gib,
+			requestBytes: gib,
+		},
+		{
+			name:         "byte limit exceeded",
+			quota:        kubernetes.NamespaceQuota{MaxBytes: 10 * gib},
+			volumes:      9,
+			usedBytes:    9 * gib,
+			requestBytes: 2 * gib,
+			wantErr:      true,
+		},
+		{
+			name:         "both limits, bytes exceeded",
+			quota:        kubernetes.NamespaceQuota{MaxBytes: 10 * gib, MaxVolumes: 10},
+			volumes:      1,
+			usedBytes:    8 * gib,
+			requestBytes: 4 * gib,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkQuota(&tt.quota, tt.volumes, tt.usedBytes, tt.requestBytes)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrQuotaExceeded)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	t.Parallel()
+
+	counters := addUsage(nil, 1, 1024)
+	require.Equal(t, journal.Counters{quotaVolumesCounter: 1, quotaBytesCounter: 1024}, counters)
+
+	counters = addUsage(counters, 0, 1024)
+	require.Equal(t, journal.Counters{quotaVolumesCounter: 1, quotaBytesCounter: 2048}, counters)
+
+	// volumes that were created before the counters existed do not make
+	// the counters negative
+	counters = addUsage(counters, -2, -4096)
+	require.Equal(t, journal.Counters{quotaVolumesCounter: 0, quotaBytesCounter: 0}, counters)
+}
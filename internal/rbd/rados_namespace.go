@@ -0,0 +1,335 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// journalObjectPrefix is the prefix of the names of the objects of the
+// volume and snapshot journals.
+const journalObjectPrefix = "csi."
+
+// errNoProvisionerCredentials is returned when the CSI configuration has no
+// provisioner credentials for a cluster.
+var errNoProvisionerCredentials = errors.New("no provisioner credentials configured")
+
+// existingNamespaces contains the RADOS namespaces that were created or found
+// by ensureRadosNamespace, by "<clusterID>/<pool>/<namespace>".
+var existingNamespaces sync.Map
+
+// createRadosNamespace creates the RBD namespace in the pool of the ioctx when
+// it does not exist yet, and returns true when it was created.
+func createRadosNamespace(ioctx *rados.IOContext, namespace string) (bool, error) {
+	exists, err := librbd.NamespaceExists(ioctx, namespace)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if namespace %q exists: %w", namespace, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	err = librbd.NamespaceCreate(ioctx, namespace)
+	if errors.Is(err, rados.ErrObjectExists) {
+		// created concurrently by another provisioner
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to create namespace %q: %w", namespace, err)
+	}
+
+	return true, nil
+}
+
+// ensureRadosNamespace creates the RADOS namespace of the volume in its pool,
+// when the createRadosNamespace option is set for the cluster.
+func (rv *rbdVolume) ensureRadosNamespace(ctx context.Context) error {
+	if rv.RadosNamespace == "" {
+		return nil
+	}
+
+	create, err := util.GetRBDCreateRadosNamespace(util.CsiConfigFile, rv.ClusterID)
+	if err != nil || !create {
+		return err
+	}
+
+	key := rv.ClusterID + "/" + rv.Pool + "/" + rv.RadosNamespace
+	if _, ok := existingNamespaces.Load(key); ok {
+		return nil
+	}
+
+	ioctx, err := rv.conn.GetIoctx(rv.Pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	created, err := createRadosNamespace(ioctx, rv.RadosNamespace)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.DebugLog(ctx, "created namespace %q in pool %q", rv.RadosNamespace, rv.Pool)
+	}
+	existingNamespaces.Store(key, true)
+
+	return nil
+}
+
+// configuredProvisionerCredentials returns the provisioner credentials of the
+// CSI configuration and the monitors of the cluster, for operations that are
+// not started by a request with secrets.
+func configuredProvisionerCredentials(ctx context.Context, clusterID string) (*util.Credentials, string, error) {
+	secrets, err := util.GetConfiguredSecrets(util.CsiConfigFile, clusterID, util.ProvisionerCredentials, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(secrets) == 0 {
+		return nil, "", fmt.Errorf("%w for cluster %q", errNoProvisionerCredentials, clusterID)
+	}
+
+	monitors, _, err := util.GetMonsAndClusterID(ctx, clusterID, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return cr, monitors, nil
+}
+
+// ValidateRadosNamespaces validates the access to the RADOS namespaces of the
+// clusters in the CSI configuration, in the pools of their
+// radosNamespacePools option. Missing namespaces are created when the
+// createRadosNamespace option is set, and the directory objects of the
+// journals are created in them. Clusters without provisioner credentials in
+// the CSI configuration are skipped. Failures are logged, they do not stop
+// the provisioner.
+func ValidateRadosNamespaces(ctx context.Context) {
+	clusterIDs, err := util.ConfiguredClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to validate the rados namespaces: %v", err)
+
+		return
+	}
+
+	for _, clusterID := range clusterIDs {
+		err = validateRadosNamespace(ctx, clusterID)
+		if err != nil {
+			log.ErrorLog(ctx, "rados namespace of cluster %q is not usable: %v", clusterID, err)
+		}
+	}
+}
+
+// validateRadosNamespace validates the access to the RADOS namespace of the
+// cluster in its radosNamespacePools.
+func validateRadosNamespace(ctx context.Context, clusterID string) error {
+	namespace, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+	pools, err := util.GetRBDRadosNamespacePools(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+	if namespace == "" || len(pools) == 0 {
+		return nil
+	}
+
+	create, err := util.GetRBDCreateRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+
+	cr, monitors, err := configuredProvisionerCredentials(ctx, clusterID)
+	if errors.Is(err, errNoProvisionerCredentials) {
+		log.DebugLog(ctx, "skipping validation of the rados namespace of cluster %q: %v", clusterID, err)
+
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	for _, pool := range pools {
+		err = validateRadosNamespaceInPool(ctx, monitors, cr, pool, namespace, create)
+		if err != nil {
+			return fmt.Errorf("pool %q: %w", pool, err)
+		}
+		if create {
+			existingNamespaces.Store(clusterID+"/"+pool+"/"+namespace, true)
+		}
+		log.DefaultLog("validated namespace %q in pool %q of cluster %q", namespace, pool, clusterID)
+	}
+
+	return nil
+}
+
+// validateRadosNamespaceInPool checks that the namespace exists in the pool,
+// or creates it, and creates the directory objects of the journals in it.
+func validateRadosNamespaceInPool(
+	ctx context.Context,
+	monitors string,
+	cr *util.Credentials,
+	pool, namespace string,
+	create bool,
+) error {
+	conn := &util.ClusterConnection{}
+	err := conn.Connect(monitors, cr)
+	if err != nil {
+		return err
+	}
+	defer conn.Destroy()
+
+	ioctx, err := conn.GetIoctx(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	if create {
+		_, err = createRadosNamespace(ioctx, namespace)
+		if err != nil {
+			return err
+		}
+	} else {
+		exists, existsErr := librbd.NamespaceExists(ioctx, namespace)
+		if existsErr != nil {
+			return fmt.Errorf("failed to check if namespace %q exists: %w", namespace, existsErr)
+		}
+		if !exists {
+			return fmt.Errorf("namespace %q does not exist", namespace)
+		}
+	}
+
+	for _, cj := range []*journal.Config{volJournal, snapJournal} {
+		j, err := cj.Connect(monitors, namespace, cr)
+		if err != nil {
+			return err
+		}
+		err = j.CreateDirectory(ctx, pool)
+		j.Destroy()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CleanupRadosNamespace removes the RADOS namespace from the pool of the
+// cluster, after removing the objects of the journals in it. The namespace
+// must not contain images, also not in the trash. It uses the provisioner
+// credentials of the CSI configuration of the cluster.
+func CleanupRadosNamespace(ctx context.Context, clusterID, pool, namespace string) error {
+	cr, monitors, err := configuredProvisionerCredentials(ctx, clusterID)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return err
+	}
+	defer conn.Destroy()
+
+	ioctx, err := conn.GetIoctx(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	exists, err := librbd.NamespaceExists(ioctx, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to check if namespace %q exists: %w", namespace, err)
+	}
+	if !exists {
+		return fmt.Errorf("namespace %q does not exist in pool %q", namespace, pool)
+	}
+
+	ioctx.SetNamespace(namespace)
+	err = checkRadosNamespaceEmpty(ioctx)
+	if err != nil {
+		return fmt.Errorf("namespace %q in pool %q: %w", namespace, pool, err)
+	}
+
+	objects := []string{}
+	err = ioctx.ListObjects(func(oid string) {
+		if strings.HasPrefix(oid, journalObjectPrefix) {
+			objects = append(objects, oid)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list the objects in namespace %q: %w", namespace, err)
+	}
+
+	for _, oid := range objects {
+		err = ioctx.Delete(oid)
+		if err != nil && !errors.Is(err, rados.ErrNotFound) {
+			return fmt.Errorf("failed to remove object %q from namespace %q: %w", oid, namespace, err)
+		}
+		log.DebugLog(ctx, "removed object %q from namespace %q in pool %q", oid, namespace, pool)
+	}
+
+	ioctx.SetNamespace("")
+	err = librbd.NamespaceRemove(ioctx, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to remove namespace %q from pool %q: %w", namespace, pool, err)
+	}
+	existingNamespaces.Delete(clusterID + "/" + pool + "/" + namespace)
+	log.DefaultLog("removed namespace %q and %d journal objects from pool %q of cluster %q",
+		namespace, len(objects), pool, clusterID)
+
+	return nil
+}
+
+// checkRadosNamespaceEmpty returns ErrNamespaceNotEmpty when there are images
+// in the namespace of the ioctx, or in its trash.
+func checkRadosNamespaceEmpty(ioctx *rados.IOContext) error {
+	images, err := librbd.GetImageNames(ioctx)
+	if err != nil {
+		return fmt.Errorf("failed to list images: %w", err)
+	}
+	if len(images) != 0 {
+		return fmt.Errorf("%w: contains %d images", ErrNamespaceNotEmpty, len(images))
+	}
+
+	trash, err := librbd.GetTrashList(ioctx)
+	if err != nil {
+		return fmt.Errorf("failed to list the trash: %w", err)
+	}
+	if len(trash) != 0 {
+		return fmt.Errorf("%w: contains %d images in the trash", ErrNamespaceNotEmpty, len(trash))
+	}
+
+	return nil
+}
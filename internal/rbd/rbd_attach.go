@@ -22,11 +22,13 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -65,6 +67,16 @@ const (
 	// `io-timeout` of rbd-nbd is to tweak NBD_ATTR_TIMEOUT. It specifies
 	// how long the IO should wait to get handled before bailing out.
 	setNbdIOTimeout = "io-timeout"
+
+	// `rbd_op_threads` is the Ceph option for the number of librbd worker
+	// threads that handle the IO of rbd-nbd.
+	setNbdThreads = "rbd_op_threads"
+
+	// StorageClass parameters to tune rbd-nbd, they take precedence over the
+	// same options in the nbd mapOptions.
+	nbdIOTimeoutParam       = "nbdIOTimeout"
+	nbdReattachTimeoutParam = "nbdReattachTimeout"
+	nbdThreadsParam         = "nbdThreads"
 )
 
 var (
@@ -306,9 +318,153 @@ func parseMapOptions(mapOptions string) (string, string, error) {
 	return krbdMapOptions, nbdMapOptions, nil
 }
 
+// splitMapOptions returns the individual options from the comma separated
+// map options.
+func splitMapOptions(mapOptions string) []string {
+	var options []string
+	for _, opt := range strings.Split(mapOptions, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt != "" {
+			options = append(options, opt)
+		}
+	}
+
+	return options
+}
+
+// mapOptionName returns the name of the map option, without the value.
+func mapOptionName(option string) string {
+	name, _, _ := strings.Cut(option, "=")
+
+	return name
+}
+
+// removeMapOption returns the comma separated map options without the option
+// with the given name.
+func removeMapOption(mapOptions, name string) string {
+	var options []string
+	for _, opt := range splitMapOptions(mapOptions) {
+		if mapOptionName(opt) != name {
+			options = append(options, opt)
+		}
+	}
+
+	return strings.Join(options, ",")
+}
+
+// mergeMapOptions merges the comma separated map options. Options in
+// overrides replace the options with the same name in base.
+func mergeMapOptions(base, overrides string) string {
+	overrideOptions := splitMapOptions(overrides)
+	overridden := make(map[string]bool, len(overrideOptions))
+	for _, opt := range overrideOptions {
+		overridden[mapOptionName(opt)] = true
+	}
+
+	var merged []string
+	for _, opt := range splitMapOptions(base) {
+		if !overridden[mapOptionName(opt)] {
+			merged = append(merged, opt)
+		}
+	}
+
+	return strings.Join(append(merged, overrideOptions...), ",")
+}
+
+// checkMapOptionsConflict returns an error when an option in mapOptions is
+// also set in nodeMapOptions, but with a different value.
+func checkMapOptionsConflict(mapOptions, nodeMapOptions string) error {
+	nodeOptions := map[string]string{}
+	for _, opt := range splitMapOptions(nodeMapOptions) {
+		nodeOptions[mapOptionName(opt)] = opt
+	}
+
+	for _, opt := range splitMapOptions(mapOptions) {
+		nodeOpt, ok := nodeOptions[mapOptionName(opt)]
+		if ok && nodeOpt != opt {
+			return fmt.Errorf("%w: map option %q conflicts with node map option %q",
+				ErrInvalidArgument, opt, nodeOpt)
+		}
+	}
+
+	return nil
+}
+
+// mergeConfiguredMapOptions merges the map options of the volume with the
+// default map options of the cluster and the node specific map options from
+// the CSI config. The volume options take precedence over the cluster
+// defaults, the node options are added to the volume options, but are not
+// allowed to change an option that is set for the volume.
+func mergeConfiguredMapOptions(
+	krbdMapOptions, nbdMapOptions, defaultMapOptions string,
+	nodeMapOptions []string,
+) (string, string, error) {
+	defaultKrbd, defaultNbd, err := parseMapOptions(defaultMapOptions)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid default map options: %w", err)
+	}
+
+	var nodeKrbd, nodeNbd string
+	for _, options := range nodeMapOptions {
+		krbd, nbd, pErr := parseMapOptions(options)
+		if pErr != nil {
+			return "", "", fmt.Errorf("invalid node map options: %w", pErr)
+		}
+		nodeKrbd = mergeMapOptions(nodeKrbd, krbd)
+		nodeNbd = mergeMapOptions(nodeNbd, nbd)
+	}
+
+	err = checkMapOptionsConflict(krbdMapOptions, nodeKrbd)
+	if err != nil {
+		return "", "", err
+	}
+	err = checkMapOptionsConflict(nbdMapOptions, nodeNbd)
+	if err != nil {
+		return "", "", err
+	}
+
+	krbd := mergeMapOptions(mergeMapOptions(defaultKrbd, krbdMapOptions), nodeKrbd)
+	nbd := mergeMapOptions(mergeMapOptions(defaultNbd, nbdMapOptions), nodeNbd)
+
+	return krbd, nbd, nil
+}
+
+// getNbdTuningOptions returns the rbd-nbd map options for the nbd tuning
+// parameters in the volume context.
+func getNbdTuningOptions(volumeContext map[string]string) (string, error) {
+	tunables := []struct {
+		param   string
+		option  string
+		minimum uint64
+	}{
+		{param: nbdIOTimeoutParam, option: setNbdIOTimeout, minimum: 0},
+		{param: nbdReattachTimeoutParam, option: setNbdReattach, minimum: 0},
+		{param: nbdThreadsParam, option: setNbdThreads, minimum: 1},
+	}
+
+	var options []string
+	for _, t := range tunables {
+		val := volumeContext[t.param]
+		if val == "" {
+			continue
+		}
+
+		n, err := strconv.ParseUint(val, 10, 32)
+		if err == nil && n < t.minimum {
+			err = fmt.Errorf("must be at least %d", t.minimum)
+		}
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid value %q for %s: %w", ErrInvalidArgument, val, t.param, err)
+		}
+		options = append(options, fmt.Sprintf("%s=%d", t.option, n))
+	}
+
+	return strings.Join(options, ","), nil
+}
+
 // getMapOptions is a wrapper func, calls parse map/unmap funcs and feeds the
 // rbdVolume object.
-func (ns *NodeServer) getMapOptions(req *csi.NodeStageVolumeRequest, rv *rbdVolume) error {
+func (ns *NodeServer) getMapOptions(ctx context.Context, req *csi.NodeStageVolumeRequest, rv *rbdVolume) error {
 	krbdMapOptions, nbdMapOptions, err := parseMapOptions(req.GetVolumeContext()["mapOptions"])
 	if err != nil {
 		return err
@@ -317,6 +473,31 @@ func (ns *NodeServer) getMapOptions(req *csi.NodeStageVolumeRequest, rv *rbdVolu
 	if err != nil {
 		return err
 	}
+
+	nodeLabels, cliReadAffinityOptions := ns.getNodeLabels()
+	defaultMapOptions, nodeMapOptions, err := util.GetRBDMapOptions(util.CsiConfigFile, rv.ClusterID, nodeLabels)
+	if err != nil {
+		return err
+	}
+	krbdMapOptions, nbdMapOptions, err = mergeConfiguredMapOptions(
+		krbdMapOptions, nbdMapOptions, defaultMapOptions, nodeMapOptions)
+	if err != nil {
+		return err
+	}
+
+	nbdTuningOptions, err := getNbdTuningOptions(req.GetVolumeContext())
+	if err != nil {
+		return err
+	}
+	nbdMapOptions = mergeMapOptions(nbdMapOptions, nbdTuningOptions)
+
+	msMode, err := util.GetMsMode(util.CsiConfigFile, rv.ClusterID)
+	if err != nil {
+		return err
+	}
+	krbdMapOptions = util.SetMsModeOption(krbdMapOptions, msMode)
+	krbdMapOptions = addKrbdCompressionHint(ctx, krbdMapOptions, req.GetVolumeContext()[compressionHintParam])
+
 	if rv.Mounter == rbdDefaultMounter {
 		rv.MapOptions = krbdMapOptions
 		rv.UnmapOptions = krbdUnmapOptions
@@ -326,7 +507,7 @@ func (ns *NodeServer) getMapOptions(req *csi.NodeStageVolumeRequest, rv *rbdVolu
 	}
 
 	readAffinityMapOptions, err := util.GetReadAffinityMapOptions(
-		util.CsiConfigFile, rv.ClusterID, ns.CLIReadAffinityOptions, ns.NodeLabels,
+		util.CsiConfigFile, rv.ClusterID, cliReadAffinityOptions, nodeLabels,
 	)
 	if err != nil {
 		return err
@@ -346,6 +527,15 @@ func attachRBDImage(ctx context.Context, volOptions *rbdVolume, device string, c
 	}
 
 	devicePath, found := waitForPath(ctx, volOptions.Pool, volOptions.RadosNamespace, image, 1, useNBD)
+	if found && !useNBD {
+		// the image may still be mapped with a client that was blocklisted
+		// while the node was fenced, its I/O fails
+		remapped, rErr := remapBlocklistedDevice(ctx, volOptions, devicePath)
+		if rErr != nil {
+			return "", rErr
+		}
+		found = !remapped
+	}
 	if !found {
 		backoff := wait.Backoff{
 			Duration: rbdImageWatcherInitDelay,
@@ -353,11 +543,27 @@ func attachRBDImage(ctx context.Context, volOptions *rbdVolume, device string, c
 			Steps:    rbdImageWatcherSteps,
 		}
 
-		err = waitForrbdImage(ctx, backoff, volOptions)
-		if err != nil {
-			return "", err
-		}
-		devicePath, err = createPath(ctx, volOptions, device, cr)
+		// the maps of the node are rate limited, waiting for the watchers
+		// of the image is part of the map and delayed after failures too
+		devicePath, err = nodeMapLimiter.run(ctx, volOptions.String(), func() (string, error) {
+			err = waitForrbdImage(ctx, backoff, volOptions)
+			if err != nil {
+				return "", err
+			}
+
+			path, mapErr := createPath(ctx, volOptions, device, cr)
+			if isBlocklistedMapError(mapErr) && !useNBD && device == "" &&
+				!slices.Contains(splitMapOptions(volOptions.MapOptions), krbdNoShareOption) {
+				// the client that krbd shares between the mappings of the
+				// cluster is blocklisted, map with a new client instance
+				log.WarningLog(ctx, "rbd: map of %s failed with a blocklisted client, retrying with %s",
+					volOptions, krbdNoShareOption)
+				volOptions.MapOptions = mergeMapOptions(volOptions.MapOptions, krbdNoShareOption)
+				path, mapErr = createPath(ctx, volOptions, device, cr)
+			}
+
+			return path, mapErr
+		})
 	}
 
 	return devicePath, err
@@ -381,10 +587,10 @@ func appendNbdDeviceTypeAndOptions(cmdArgs []string, userOptions, cookie string)
 		}
 	}
 
-	if userOptions != "" {
-		// userOptions is appended after, possibly overriding the above
-		// default options.
-		cmdArgs = append(cmdArgs, "--"+userOptions)
+	// userOptions are appended after, possibly overriding the above
+	// default options.
+	for _, opt := range splitMapOptions(userOptions) {
+		cmdArgs = append(cmdArgs, "--"+opt)
 	}
 
 	return cmdArgs
@@ -510,9 +716,20 @@ func createPath(ctx context.Context, volOpt *rbdVolume, device string, cr *util.
 }
 
 func waitForrbdImage(ctx context.Context, backoff wait.Backoff, volOptions *rbdVolume) error {
-	imagePath := volOptions.String()
+	if volOptions.forceLockBreak && !volOptions.DisableInUseChecks {
+		err := volOptions.breakStaleLocks(ctx)
+		if err != nil {
+			log.WarningLog(ctx, "failed to break stale locks of image %s: %v", volOptions, err)
+		}
+	}
 
+	attempts := 0
 	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		if attempts > 0 {
+			metrics.CountRetry("rbd image in use")
+		}
+		attempts++
+
 		used, err := volOptions.isInUse()
 		if err != nil {
 			return false, fmt.Errorf("fail to check rbd image status: (%w)", err)
@@ -527,7 +744,7 @@ func waitForrbdImage(ctx context.Context, backoff wait.Backoff, volOptions *rbdV
 	})
 	// return error if rbd image has not become available for the specified timeout
 	if wait.Interrupted(err) {
-		return fmt.Errorf("rbd image %s is still being used", imagePath)
+		return volOptions.imageInUseError(ctx)
 	}
 	// return error if any other errors were encountered during waiting for the image to become available
 	return err
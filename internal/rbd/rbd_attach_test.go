@@ -17,6 +17,7 @@ limitations under the License.
 package rbd
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -103,3 +104,142 @@ func TestParseMapOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeConfiguredMapOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name              string
+		krbdMapOptions    string
+		nbdMapOptions     string
+		defaultMapOptions string
+		nodeMapOptions    []string
+		expectKrbdOptions string
+		expectNbdOptions  string
+		expectErr         bool
+	}{
+		{
+			name:              "no configured options",
+			krbdMapOptions:    "kOp1,kOp2",
+			nbdMapOptions:     "nOp1",
+			expectKrbdOptions: "kOp1,kOp2",
+			expectNbdOptions:  "nOp1",
+		},
+		{
+			name:              "volume options override defaults",
+			krbdMapOptions:    "queue_depth=256",
+			defaultMapOptions: "krbd:queue_depth=128,noshare;nbd:try-netlink",
+			expectKrbdOptions: "noshare,queue_depth=256",
+			expectNbdOptions:  "try-netlink",
+		},
+		{
+			name:              "node options are added",
+			krbdMapOptions:    "kOp1",
+			defaultMapOptions: "queue_depth=128",
+			nodeMapOptions:    []string{"queue_depth=64", "read_from_replica=localize"},
+			expectKrbdOptions: "kOp1,queue_depth=64,read_from_replica=localize",
+		},
+		{
+			name:              "later node options win",
+			nodeMapOptions:    []string{"nbd:timeout=30", "nbd:timeout=60"},
+			expectKrbdOptions: "",
+			expectNbdOptions:  "timeout=60",
+		},
+		{
+			name:              "same option and value in volume and node options",
+			krbdMapOptions:    "read_from_replica=localize",
+			nodeMapOptions:    []string{"read_from_replica=localize"},
+			expectKrbdOptions: "read_from_replica=localize",
+		},
+		{
+			name:           "conflicting volume and node options",
+			krbdMapOptions: "read_from_replica=balance",
+			nodeMapOptions: []string{"read_from_replica=localize"},
+			expectErr:      true,
+		},
+		{
+			name:              "invalid default options",
+			defaultMapOptions: "xyz:xOp1",
+			expectErr:         true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			krbdOpts, nbdOpts, err := mergeConfiguredMapOptions(
+				tt.krbdMapOptions, tt.nbdMapOptions, tt.defaultMapOptions, tt.nodeMapOptions)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("mergeConfiguredMapOptions() error = %v, expectErr %v", err, tt.expectErr)
+
+				return
+			}
+			if krbdOpts != tt.expectKrbdOptions {
+				t.Errorf("mergeConfiguredMapOptions() returned unexpected krbd options, expected: %q, got: %q",
+					tt.expectKrbdOptions, krbdOpts)
+			}
+			if nbdOpts != tt.expectNbdOptions {
+				t.Errorf("mergeConfiguredMapOptions() returned unexpected nbd options, expected: %q, got: %q",
+					tt.expectNbdOptions, nbdOpts)
+			}
+		})
+	}
+}
+
+func TestGetNbdTuningOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		volumeContext map[string]string
+		expectOptions string
+		expectErr     bool
+	}{
+		{
+			name:          "no tuning parameters",
+			volumeContext: map[string]string{"mapOptions": "nbd:try-netlink"},
+			expectOptions: "",
+		},
+		{
+			name: "all tuning parameters",
+			volumeContext: map[string]string{
+				nbdIOTimeoutParam:       "120",
+				nbdReattachTimeoutParam: "600",
+				nbdThreadsParam:         "4",
+			},
+			expectOptions: "io-timeout=120,reattach-timeout=600,rbd_op_threads=4",
+		},
+		{
+			name:          "empty values are ignored",
+			volumeContext: map[string]string{nbdIOTimeoutParam: "0", nbdThreadsParam: ""},
+			expectOptions: "io-timeout=0",
+		},
+		{
+			name:          "invalid timeout",
+			volumeContext: map[string]string{nbdIOTimeoutParam: "30s"},
+			expectErr:     true,
+		},
+		{
+			name:          "zero threads",
+			volumeContext: map[string]string{nbdThreadsParam: "0"},
+			expectErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			options, err := getNbdTuningOptions(tt.volumeContext)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("getNbdTuningOptions() error = %v, expectErr %v", err, tt.expectErr)
+
+				return
+			}
+			if err != nil && !errors.Is(err, ErrInvalidArgument) {
+				t.Errorf("getNbdTuningOptions() error = %v, expected ErrInvalidArgument", err)
+			}
+			if options != tt.expectOptions {
+				t.Errorf("getNbdTuningOptions() returned unexpected options, expected: %q, got: %q",
+					tt.expectOptions, options)
+			}
+		})
+	}
+}
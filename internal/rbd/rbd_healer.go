@@ -20,6 +20,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
@@ -108,6 +109,18 @@ func callNodeStageVolume(ns *NodeServer, c *k8s.Clientset, pv *v1.PersistentVolu
 		return err
 	}
 
+	nbd, err := stagedWithNbd(stagingParentPath)
+	if err != nil {
+		log.ErrorLogMsg("failed to check the mounter of volID: %s, err: %v", volID, err)
+
+		return err
+	}
+	if !nbd {
+		log.DebugLogMsg("not healing volID: %s, it is not mapped with rbd-nbd", volID)
+
+		return nil
+	}
+
 	log.DefaultLog("sending nodeStageVolume for volID: %s, stagingPath: %s",
 		volID, stagingParentPath)
 
@@ -159,6 +172,21 @@ func callNodeStageVolume(ns *NodeServer, c *k8s.Clientset, pv *v1.PersistentVolu
 	return nil
 }
 
+// stagedWithNbd returns true when the volume at the staging path was mapped
+// with rbd-nbd. The `auto` mounter stashes the mounter that it selected,
+// volumes that are not staged on the node do not have a stash.
+func stagedWithNbd(stagingParentPath string) (bool, error) {
+	imgInfo, err := lookupRBDImageMetadataStash(stagingParentPath)
+	if errors.Is(err, ErrMissingStash) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return imgInfo.Mounter == rbdNbdMounter, nil
+}
+
 // RunVolumeHealer heal the volumes attached on a node.
 func RunVolumeHealer(ns *NodeServer, conf *util.Config) error {
 	c, err := kubeclient.NewK8sClient()
@@ -200,8 +228,10 @@ func RunVolumeHealer(ns *NodeServer, conf *util.Config) error {
 		if pv.Spec.PersistentVolumeSource.CSI == nil {
 			continue
 		}
-		// skip if mounter is not rbd-nbd
-		if pv.Spec.PersistentVolumeSource.CSI.VolumeAttributes["mounter"] != "rbd-nbd" {
+		// skip if mounter is not rbd-nbd, the auto mounter may have
+		// selected rbd-nbd as well, which is checked in the stash
+		mounter := pv.Spec.PersistentVolumeSource.CSI.VolumeAttributes["mounter"]
+		if mounter != rbdNbdMounter && mounter != rbdAutoMounter {
 			continue
 		}
 
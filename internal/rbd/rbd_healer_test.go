@@ -0,0 +1,68 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStagedWithNbd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		stash string
+		want  bool
+	}{
+		{
+			name:  "rbd-nbd",
+			stash: `{"Version":4,"pool":"replicapool","image":"csi-vol-1","mounter":"rbd-nbd","device":"/dev/nbd0"}`,
+			want:  true,
+		},
+		{
+			// the `auto` mounter is stashed as the mounter that it selected
+			name:  "auto resolved to krbd",
+			stash: `{"Version":4,"pool":"replicapool","image":"csi-vol-1","mounter":"rbd"}`,
+		},
+		{
+			name:  "rbd-nbd stashed before version 4",
+			stash: `{"Version":3,"pool":"replicapool","image":"csi-vol-1","accessType":true,"device":"/dev/nbd0"}`,
+			want:  true,
+		},
+		{
+			name: "not staged",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			if tt.stash != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, stashFileName), []byte(tt.stash), 0o600))
+			}
+
+			nbd, err := stagedWithNbd(dir)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, nbd)
+		})
+	}
+}
@@ -432,6 +432,12 @@ func reserveSnap(ctx context.Context, rbdSnap *rbdSnapshot, rbdVol *rbdVolume, c
 		return err
 	}
 
+	errCount := updateSnapshotsCount(ctx, rbdSnap.Monitors, rbdSnap.RadosNamespace, rbdSnap.JournalPool,
+		rbdVol.RbdImageName, cr, 1)
+	if errCount != nil {
+		log.WarningLog(ctx, "failed to count snapshot %q of volume %s: %v", rbdSnap, rbdVol, errCount)
+	}
+
 	rbdSnap.VolID, err = util.GenerateVolID(ctx, rbdSnap.Monitors, cr, imagePoolID, rbdSnap.Pool,
 		rbdSnap.ClusterID, rbdSnap.ReservedID)
 	if err != nil {
@@ -446,6 +452,18 @@ func reserveSnap(ctx context.Context, rbdSnap *rbdSnapshot, rbdVol *rbdVolume, c
 
 func updateTopologyConstraints(rbdVol *rbdVolume, rbdSnap *rbdSnapshot) error {
 	var err error
+	if rbdSnap != nil {
+		// the pools of a snapshot in a different cluster are not related
+		// to the topology of the volume
+		var remote bool
+		remote, err = rbdVol.isRemoteSnapshot(rbdSnap)
+		if err != nil {
+			return err
+		}
+		if remote {
+			rbdSnap = nil
+		}
+	}
 	if rbdSnap != nil {
 		// check if topology constraints matches snapshot pool
 		var poolName string
@@ -506,6 +524,23 @@ func reserveVol(ctx context.Context, rbdVol *rbdVolume, cr *util.Credentials) er
 		return err
 	}
 
+	err = rbdVol.storeVolumeSize(ctx, j)
+	if err == nil {
+		err = rbdVol.storeTrashExpiry(ctx, j)
+	}
+	if err == nil {
+		err = rbdVol.storeForceDeleteMirrored(ctx, j)
+	}
+	if err != nil {
+		undoErr := j.UndoReservation(ctx, rbdVol.JournalPool, rbdVol.volJournalPool(),
+			rbdVol.RbdImageName, rbdVol.RequestName)
+		if undoErr != nil {
+			log.WarningLog(ctx, "failed undoing reservation of volume: %s (%v)", rbdVol.RequestName, undoErr)
+		}
+
+		return err
+	}
+
 	rbdVol.VolID, err = util.GenerateVolID(ctx, rbdVol.Monitors, cr, imagePoolID, rbdVol.Pool,
 		rbdVol.ClusterID, rbdVol.ReservedID)
 	if err != nil {
@@ -526,11 +561,30 @@ func undoSnapReservation(ctx context.Context, rbdSnap *rbdSnapshot, cr *util.Cre
 	}
 	defer j.Destroy()
 
+	// the source of the snapshot is needed to update the snapshots counter
+	// of the volume once the reservation is gone
+	source := ""
+	if rbdSnap.ReservedID != "" {
+		source, err = j.FetchAttribute(ctx, rbdSnap.JournalPool, rbdSnap.ReservedID, snapSourceAttribute)
+		if err != nil && !errors.Is(err, util.ErrKeyNotFound) {
+			log.WarningLog(ctx, "failed to get source of snapshot %q: %v", rbdSnap, err)
+		}
+	}
+
 	err = j.UndoReservation(
 		ctx, rbdSnap.JournalPool, rbdSnap.Pool, rbdSnap.RbdSnapName,
 		rbdSnap.RequestName)
+	if err != nil || source == "" {
+		return err
+	}
 
-	return err
+	errCount := updateSnapshotsCount(ctx, rbdSnap.Monitors, rbdSnap.RadosNamespace, rbdSnap.JournalPool,
+		source, cr, -1)
+	if errCount != nil {
+		log.WarningLog(ctx, "failed to uncount snapshot %q of volume %s: %v", rbdSnap, source, errCount)
+	}
+
+	return nil
 }
 
 // undoVolReservation is a helper routine to undo a name reservation for rbdVolume.
@@ -541,10 +595,16 @@ func undoVolReservation(ctx context.Context, rbdVol *rbdVolume, cr *util.Credent
 	}
 	defer j.Destroy()
 
-	err = j.UndoReservation(ctx, rbdVol.JournalPool, rbdVol.Pool,
+	size := rbdVol.fetchVolumeSize(ctx, j)
+	err = j.UndoReservation(ctx, rbdVol.JournalPool, rbdVol.volJournalPool(),
 		rbdVol.RbdImageName, rbdVol.RequestName)
+	if err != nil {
+		return err
+	}
 
-	return err
+	rbdVol.releaseNamespaceQuota(ctx, j, size)
+
+	return nil
 }
 
 // RegenerateJournal regenerates the omap data for the static volumes, the
@@ -646,6 +706,14 @@ func RegenerateJournal(
 		rbdVol.ImageID = imageData.ImageAttributes.ImageID
 		rbdVol.Owner = imageData.ImageAttributes.Owner
 		rbdVol.RbdImageName = imageData.ImageAttributes.ImageName
+		// the image was moved to a different pool by a live-migration
+		if imageData.ImageAttributes.ImagePoolID >= 0 {
+			rbdVol.VolJournalPool = rbdVol.Pool
+			rbdVol.Pool, err = util.GetPoolName(rbdVol.Monitors, cr, imageData.ImageAttributes.ImagePoolID)
+			if err != nil {
+				return "", err
+			}
+		}
 		if rbdVol.ImageID == "" {
 			err = rbdVol.storeImageID(ctx, j)
 			if err != nil {
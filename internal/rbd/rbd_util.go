@@ -28,14 +28,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ceph/ceph-csi/internal/journal"
 	"github.com/ceph/ceph-csi/internal/rbd/types"
 	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/ceph/go-ceph/rados"
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/ceph/go-ceph/rbd/admin"
 	"github.com/container-storage-interface/spec/lib/go/csi"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/cloud-provider/volume/helpers"
 	mount "k8s.io/mount-utils"
@@ -49,6 +54,7 @@ const (
 	rbdImageWatcherSteps     = 10
 	rbdDefaultMounter        = "rbd"
 	rbdNbdMounter            = "rbd-nbd"
+	rbdAutoMounter           = "auto" // krbd, or rbd-nbd if krbd lacks image features
 	defaultLogDir            = "/var/log/ceph"
 	defaultLogStrategy       = "remove" // supports remove, compress and preserve
 
@@ -81,6 +87,9 @@ const (
 
 	// clusterNameKey cluster Key, set on RBD image.
 	clusterNameKey = "csi.ceph.com/cluster/name"
+	// usedBytesKey is set on the RBD image of a snapshot, it contains the
+	// number of bytes that are allocated by the snapshot.
+	usedBytesKey = "csi.ceph.com/snapshot/used-bytes"
 )
 
 // rbdImage contains common attributes and methods for the rbdVolume and
@@ -103,7 +112,16 @@ type rbdImage struct {
 	// is stored, and could be the same as `JournalPool` (retained as Pool instead of
 	// renaming to ImagePool or such, as this is referenced in the code
 	// extensively)
-	Pool           string
+	Pool string
+	// DataPool is where the data of the image is stored, like an erasure
+	// coded pool. It is used as the `--data-pool` argument when the image is
+	// created, and is read from the image by getImageInfo(). It is empty
+	// when the data is stored in `Pool`.
+	DataPool string
+	// VolJournalPool is the ceph pool where the per image journal is stored,
+	// it is only set when the image was moved by a live-migration, in all
+	// other cases the per image journal is in `Pool`
+	VolJournalPool string
 	RadosNamespace string
 	ClusterID      string `json:"clusterId"`
 	// RequestName is the CSI generated volume name for the rbdVolume.
@@ -162,18 +180,15 @@ type rbdVolume struct {
 	TopologyPools       *[]util.TopologyConstrainedPool
 	TopologyRequirement *csi.TopologyRequirement
 	Topology            map[string]string
-	// DataPool is where the data for images in `Pool` are stored, this is used as the `--data-pool`
-	// argument when the pool is created, and is not used anywhere else
-	DataPool           string
-	AdminID            string
-	UserID             string
-	Mounter            string
-	MapOptions         string
-	UnmapOptions       string
-	LogDir             string
-	LogStrategy        string
-	VolName            string
-	MonValueFromSecret string
+	AdminID             string
+	UserID              string
+	Mounter             string
+	MapOptions          string
+	UnmapOptions        string
+	LogDir              string
+	LogStrategy         string
+	VolName             string
+	MonValueFromSecret  string
 	// Network namespace file path to execute nsenter command
 	NetNamespaceFilePath string
 	// RequestedVolSize has the size of the volume requested by the user and
@@ -181,6 +196,39 @@ type rbdVolume struct {
 	RequestedVolSize   int64
 	DisableInUseChecks bool
 	readOnly           bool
+	// forceLockBreak is set to break stale exclusive locks before mapping.
+	forceLockBreak bool
+	// QoS contains the QoS limits that should be applied on the image.
+	QoS *qosSpec
+	// SourceImage is the image that is not managed by Ceph-CSI, which the
+	// volume gets cloned from.
+	SourceImage *imageSpec
+	// ThickProvision is set when all extents of the image should be
+	// allocated on creation.
+	ThickProvision bool
+	// CloneWarmup is the mode of copying the data of the parent into a
+	// volume that is cloned, empty when it is read from the parent.
+	CloneWarmup string
+	// CopyParallelism is the number of extents that are copied at the same
+	// time, when the data of the parent is copied instead of cloned.
+	CopyParallelism int
+	// CopyVerify is set when the copied data is read back and its checksum
+	// is compared with the data of the parent.
+	CopyVerify bool
+	// CompressionHint is the rbd_compression_hint that is set on the image.
+	CompressionHint string
+	// CompressionMode is the BlueStore compression mode that the pool of
+	// the image needs to have.
+	CompressionMode string
+	// TrashExpiry is the time that the image is kept in the trash after the
+	// volume was deleted, the image is removed immediately when 0.
+	TrashExpiry time.Duration
+	// ForceDeleteMirrored is set when the image may be deleted while it is
+	// mirrored, but not primary.
+	ForceDeleteMirrored bool
+	// objects are the Kubernetes objects of the volume that events are
+	// posted on while staging.
+	objects k8s.VolumeObjects
 }
 
 // rbdSnapshot represents a CSI snapshot and its RBD snapshot specifics.
@@ -431,7 +479,16 @@ func (rs *rbdSnapshot) String() string {
 }
 
 // createImage creates a new ceph image with provision and volume options.
-func createImage(ctx context.Context, pOpts *rbdVolume, cr *util.Credentials) error {
+func createImage(ctx context.Context, pOpts *rbdVolume, cr *util.Credentials) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.createImage", attribute.String("image", pOpts.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, pOpts.ClusterID, util.CreateOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	volSzMiB := fmt.Sprintf("%dM", util.RoundOffVolSize(pOpts.VolSize))
 
 	log.DebugLog(ctx, "rbd: create %s size %s (features: %s) using mon %s",
@@ -490,6 +547,15 @@ func (ri *rbdImage) openIoctx() error {
 	return nil
 }
 
+// volJournalPool returns the pool that contains the per image journal.
+func (ri *rbdImage) volJournalPool() string {
+	if ri.VolJournalPool != "" {
+		return ri.VolJournalPool
+	}
+
+	return ri.Pool
+}
+
 // getImageID queries rbd about the given image and stores its id, returns
 // ErrImageNotFound if provided image is not found.
 func (ri *rbdImage) getImageID() error {
@@ -637,6 +703,13 @@ func (ri *rbdImage) ensureImageCleanup(ctx context.Context) error {
 	}
 	for _, val := range trashInfoList {
 		if val.Name == ri.RbdImageName {
+			// images of volumes with a trash expiry are kept until
+			// they expire
+			if val.DefermentEndTime.After(time.Now()) {
+				log.DebugLog(ctx, "rbd: image %s is kept in trash until %s", ri, val.DefermentEndTime)
+
+				return nil
+			}
 			ri.ImageID = val.Id
 
 			return ri.trashRemoveImage(ctx)
@@ -648,12 +721,18 @@ func (ri *rbdImage) ensureImageCleanup(ctx context.Context) error {
 
 // Delete deletes a ceph image with provision and volume options.
 func (ri *rbdImage) Delete(ctx context.Context) error {
+	release, err := util.AcquireOperation(ctx, ri.ClusterID, util.DeleteOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	image := ri.RbdImageName
 
 	log.DebugLog(ctx, "rbd: delete %s using mon %s, pool %s", image, ri.Monitors, ri.Pool)
 
 	// Support deleting the older rbd images whose imageID is not stored in omap
-	err := ri.getImageID()
+	err = ri.getImageID()
 	if err != nil {
 		return err
 	}
@@ -690,7 +769,10 @@ func (ri *rbdImage) Delete(ctx context.Context) error {
 
 // trashRemoveImage adds a task to trash remove an image using ceph manager if supported,
 // otherwise removes the image from trash.
-func (ri *rbdImage) trashRemoveImage(ctx context.Context) error {
+func (ri *rbdImage) trashRemoveImage(ctx context.Context) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.trashRemoveImage", attribute.String("image", ri.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// attempt to use Ceph manager based deletion support if available
 	log.DebugLog(ctx, "rbd: adding task to remove image %q with id %q from trash", ri, ri.ImageID)
 
@@ -838,9 +920,11 @@ func (ri *rbdImage) flattenRbdImage(
 	ctx context.Context,
 	forceFlatten bool,
 	hardlimit, softlimit uint,
-) error {
+) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.flattenRbdImage", attribute.String("image", ri.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	var depth uint
-	var err error
 
 	// skip clone depth check if request is for force flatten
 	if !forceFlatten {
@@ -858,46 +942,80 @@ func (ri *rbdImage) flattenRbdImage(
 	}
 
 	if !forceFlatten && (depth < hardlimit) && (depth < softlimit) {
+		// a flatten task that was added before has finished
+		util.FinishBackgroundOperation(ri.ClusterID, util.FlattenOperation, ri.String())
+
 		return nil
 	}
 
-	log.DebugLog(ctx, "rbd: adding task to flatten image %q", ri)
-
 	ta, err := ri.conn.GetTaskAdmin()
 	if err != nil {
 		return err
 	}
 
-	_, err = ta.AddFlatten(admin.NewImageSpec(ri.Pool, ri.RadosNamespace, ri.RbdImageName))
+	// the flatten task counts against the limits of the background
+	// operations until the image has been flattened
+	if !util.StartBackgroundOperation(ri.ClusterID, util.FlattenOperation, ri.String()) {
+		log.UsefulLog(ctx, "flatten of image %s waits until other background operations finished", ri)
+		if forceFlatten || depth >= hardlimit {
+			return fmt.Errorf("%w: flatten of image %s waits for the limit of background operations",
+				ErrFlattenInProgress, ri.RbdImageName)
+		}
+
+		return nil
+	}
+	ri.setManagementOps(ctx, util.FlattenOperation)
+
+	log.DebugLog(ctx, "rbd: adding task to flatten image %q", ri)
+
+	task, err := ta.AddFlatten(admin.NewImageSpec(ri.Pool, ri.RadosNamespace, ri.RbdImageName))
 	rbdCephMgrSupported := isCephMgrSupported(ctx, ri.ClusterID, err)
 	if rbdCephMgrSupported {
 		if err != nil {
+			util.FinishBackgroundOperation(ri.ClusterID, util.FlattenOperation, ri.String())
 			// discard flattening error if the image does not have any parent
 			rbdFlattenNoParent := fmt.Sprintf("Image %s/%s does not have a parent", ri.Pool, ri.RbdImageName)
 			if strings.Contains(err.Error(), rbdFlattenNoParent) {
+				ri.resetManagementOps(ctx)
+
 				return nil
 			}
 			log.ErrorLog(ctx, "failed to add task flatten for %s : %v", ri, err)
 
 			return err
 		}
+		ri.volumeEvent(ctx, corev1.EventTypeNormal, eventFlattenQueued,
+			"Added a Ceph Manager task to flatten image %s", ri)
+		// the limits and the metadata are reset once the task finished,
+		// also when no later request checks the image again
+		ri.watchFlattenTask(ctx, task.ID)
 		if forceFlatten || depth >= hardlimit {
 			return fmt.Errorf("%w: flatten is in progress for image %s", ErrFlattenInProgress, ri.RbdImageName)
 		}
 		log.DebugLog(ctx, "successfully added task to flatten image %q", ri)
 	}
 	if !rbdCephMgrSupported {
+		// the image is flattened by this process, which waits for the limits
+		util.FinishBackgroundOperation(ri.ClusterID, util.FlattenOperation, ri.String())
+		defer ri.resetManagementOps(ctx)
 		log.ErrorLog(
 			ctx,
 			"task manager does not support flatten,image will be flattened once hardlimit is reached: %v",
 			err)
 		if forceFlatten || depth >= hardlimit {
-			err := ri.flatten()
+			release, err := util.AcquireOperation(ctx, ri.ClusterID, util.FlattenOperation)
+			if err != nil {
+				return err
+			}
+			defer release()
+
+			err = ri.flatten()
 			if err != nil {
 				log.ErrorLog(ctx, "rbd failed to flatten image %s %s: %v", ri.Pool, ri.RbdImageName, err)
 
 				return err
 			}
+			ri.volumeEvent(ctx, corev1.EventTypeNormal, eventFlattened, "Flattened image %s", ri)
 		}
 	}
 
@@ -1115,6 +1233,7 @@ func updateSnapshotDetails(ctx context.Context, rbdSnap *rbdSnapshot) error {
 		return err
 	}
 	rbdSnap.VolSize = vol.VolSize
+	rbdSnap.DataPool = vol.DataPool
 
 	return nil
 }
@@ -1200,6 +1319,16 @@ func generateVolumeFromVolumeID(
 		}
 	}
 
+	// the image was migrated to a different pool, the per image journal
+	// stays in the pool that is part of the volume ID
+	if imageAttributes.ImagePoolID >= 0 {
+		rbdVol.VolJournalPool = rbdVol.Pool
+		rbdVol.Pool, err = util.GetPoolName(rbdVol.Monitors, cr, imageAttributes.ImagePoolID)
+		if err != nil {
+			return rbdVol, err
+		}
+	}
+
 	if rbdVol.ImageID == "" {
 		err = rbdVol.storeImageID(ctx, j)
 		if err != nil {
@@ -1397,6 +1526,49 @@ func genVolFromVolumeOptions(
 		return nil, err
 	}
 
+	rbdVol.QoS, err = parseQoSSpec(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rbdVol.parseSourceImage(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if val, ok := volOptions[thickProvisionParam]; ok {
+		rbdVol.ThickProvision, err = strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %q: %w", thickProvisionParam, val, err)
+		}
+	}
+
+	rbdVol.TrashExpiry, err = parseTrashExpiry(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rbdVol.ForceDeleteMirrored, err = parseForceDeleteMirrored(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rbdVol.CloneWarmup = volOptions[cloneWarmupParam]
+	err = validateCloneWarmup(rbdVol.CloneWarmup, rbdVol.Mounter)
+	if err != nil {
+		return nil, err
+	}
+
+	rbdVol.CopyParallelism, rbdVol.CopyVerify, err = parseCopyOptions(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	rbdVol.CompressionHint, rbdVol.CompressionMode, err = parseCompressionOptions(volOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	return rbdVol, nil
 }
 
@@ -1448,7 +1620,7 @@ func (rv *rbdVolume) validateImageFeatures(imageFeatures string) error {
 			}
 		}
 
-		if sf.needRbdNbd && rv.Mounter != rbdNbdMounter {
+		if sf.needRbdNbd && rv.Mounter != rbdNbdMounter && rv.Mounter != rbdAutoMounter {
 			return fmt.Errorf("feature %s requires rbd-nbd for mounter", f)
 		}
 	}
@@ -1464,6 +1636,7 @@ func genSnapFromOptions(ctx context.Context, rbdVol *rbdVolume, snapOptions map[
 	rbdSnap.Pool = rbdVol.Pool
 	rbdSnap.JournalPool = rbdVol.JournalPool
 	rbdSnap.RadosNamespace = rbdVol.RadosNamespace
+	rbdSnap.DataPool = rbdVol.DataPool
 
 	clusterID, err := util.GetClusterID(snapOptions)
 	if err != nil {
@@ -1480,6 +1653,12 @@ func genSnapFromOptions(ctx context.Context, rbdVol *rbdVolume, snapOptions map[
 		rbdSnap.NamePrefix = namePrefix
 	}
 
+	label, err := k8s.GetSnapshotLabel(snapOptions)
+	if err != nil {
+		return nil, err
+	}
+	rbdSnap.NamePrefix = journal.GetSnapshotNamePrefix(rbdSnap.NamePrefix, label)
+
 	return rbdSnap, nil
 }
 
@@ -1488,7 +1667,16 @@ func (ri *rbdImage) hasSnapshotFeature() bool {
 	return (uint64(ri.ImageFeatureSet) & librbd.FeatureLayering) == librbd.FeatureLayering
 }
 
-func (ri *rbdImage) createSnapshot(ctx context.Context, pOpts *rbdSnapshot) error {
+func (ri *rbdImage) createSnapshot(ctx context.Context, pOpts *rbdSnapshot) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.createSnapshot", attribute.String("image", ri.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, ri.ClusterID, util.SnapshotOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	pOpts.RbdImageName = ri.RbdImageName
 	log.DebugLog(ctx, "rbd: snap create %s using mon %s", pOpts, pOpts.Monitors)
 	image, err := ri.open()
@@ -1502,7 +1690,16 @@ func (ri *rbdImage) createSnapshot(ctx context.Context, pOpts *rbdSnapshot) erro
 	return err
 }
 
-func (ri *rbdImage) deleteSnapshot(ctx context.Context, pOpts *rbdSnapshot) error {
+func (ri *rbdImage) deleteSnapshot(ctx context.Context, pOpts *rbdSnapshot) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.deleteSnapshot", attribute.String("image", ri.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, ri.ClusterID, util.SnapshotOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	log.DebugLog(ctx, "rbd: snap rm %s using mon %s", pOpts, pOpts.Monitors)
 	image, err := ri.open()
 	if err != nil {
@@ -1526,8 +1723,16 @@ func (rv *rbdVolume) cloneRbdImageFromSnapshot(
 	ctx context.Context,
 	pSnapOpts *rbdSnapshot,
 	parentVol *rbdVolume,
-) error {
-	var err error
+) (err error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.cloneRbdImageFromSnapshot", attribute.String("image", rv.String()))
+	defer func() { tracing.EndSpan(span, err) }()
+
+	release, err := util.AcquireOperation(ctx, rv.ClusterID, util.CloneOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	log.DebugLog(ctx, "rbd: clone %s %s (features: %s) using mon %s",
 		pSnapOpts, rv, rv.ImageFeatureSet.Names(), rv.Monitors)
 
@@ -1571,9 +1776,9 @@ func (rv *rbdVolume) cloneRbdImageFromSnapshot(
 	deleteClone := true
 	defer func() {
 		if deleteClone {
-			err = librbd.RemoveImage(rv.ioctx, rv.RbdImageName)
-			if err != nil {
-				log.ErrorLog(ctx, "failed to delete temporary image %q: %v", rv, err)
+			rmErr := librbd.RemoveImage(rv.ioctx, rv.RbdImageName)
+			if rmErr != nil {
+				log.ErrorLog(ctx, "failed to delete temporary image %q: %v", rv, rmErr)
 			}
 		}
 	}()
@@ -1603,7 +1808,7 @@ func (rv *rbdVolume) constructImageOptions(ctx context.Context) (*librbd.ImageOp
 
 	logMsg := fmt.Sprintf("setting image options on %s", rv)
 	if rv.DataPool != "" {
-		logMsg += ", data pool %s" + rv.DataPool
+		logMsg += ", data pool " + rv.DataPool
 		err = options.SetString(librbd.RbdImageOptionDataPool, rv.DataPool)
 		if err != nil {
 			return nil, fmt.Errorf("failed to set data pool: %w", err)
@@ -1682,6 +1887,19 @@ func (ri *rbdImage) getImageInfo() error {
 	}
 	ri.ImageFeatureSet = librbd.FeatureSet(features)
 
+	ri.DataPool = ""
+	if ri.hasFeature(librbd.FeatureDataPool) {
+		id, err := image.GetId()
+		if err != nil {
+			return err
+		}
+
+		ri.DataPool, err = ri.getDataPool(id)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Get parent information.
 	parentInfo, err := image.GetParent()
 	if err != nil {
@@ -1785,12 +2003,16 @@ type rbdImageMetadataStash struct {
 	Pool           string `json:"pool"`
 	RadosNamespace string `json:"radosNamespace"`
 	ImageName      string `json:"image"`
+	MapOptions     string `json:"mapOptions"` // options of the rbd-nbd attachment
 	UnmapOptions   string `json:"unmapOptions"`
 	NbdAccess      bool   `json:"accessType"`
+	Mounter        string `json:"mounter"` // mounter that mapped the image
 	Encrypted      bool   `json:"encrypted"`
 	DevicePath     string `json:"device"`          // holds NBD device path for now
 	LogDir         string `json:"logDir"`          // holds the client log path
 	LogStrategy    string `json:"logFileStrategy"` // ceph client log strategy
+	// the Kubernetes objects of the volume, for the events of NodeUnstage
+	k8s.VolumeObjects
 }
 
 // file name in which image metadata is stashed.
@@ -1810,19 +2032,23 @@ func (ri *rbdImageMetadataStash) String() string {
 func stashRBDImageMetadata(volOptions *rbdVolume, metaDataPath string) error {
 	imgMeta := rbdImageMetadataStash{
 		// there are no checks for this at present
-		Version:        3, //nolint:gomnd // number specifies version.
+		Version:        4, //nolint:gomnd // number specifies version.
 		Pool:           volOptions.Pool,
 		RadosNamespace: volOptions.RadosNamespace,
 		ImageName:      volOptions.RbdImageName,
 		Encrypted:      volOptions.isBlockEncrypted(),
 		UnmapOptions:   volOptions.UnmapOptions,
+		Mounter:        rbdDefaultMounter,
+		VolumeObjects:  volOptions.objects,
 	}
 
 	imgMeta.NbdAccess = false
 	if volOptions.Mounter == rbdTonbd && hasNBD {
 		imgMeta.NbdAccess = true
+		imgMeta.Mounter = rbdNbdMounter
 		imgMeta.LogDir = volOptions.LogDir
 		imgMeta.LogStrategy = volOptions.LogStrategy
+		imgMeta.MapOptions = volOptions.MapOptions
 	}
 
 	encodedBytes, err := json.Marshal(imgMeta)
@@ -1866,6 +2092,15 @@ func lookupRBDImageMetadataStash(metaDataPath string) (rbdImageMetadataStash, er
 		return imgMeta, fmt.Errorf("failed to unmarshall stashed JSON image metadata from path (%s): %w", fPath, err)
 	}
 
+	// metadata stashed before version 4 does not contain the mounter
+	if imgMeta.Mounter == "" {
+		imgMeta.Mounter = rbdDefaultMounter
+		if imgMeta.NbdAccess {
+			imgMeta.Mounter = rbdNbdMounter
+		}
+	}
+	imgMeta.NbdAccess = imgMeta.Mounter == rbdNbdMounter
+
 	return imgMeta, nil
 }
 
@@ -2144,6 +2379,41 @@ func (ri *rbdImage) AddSnapshotScheduling(
 	return nil
 }
 
+// ListSnapshotSchedules returns the mirror snapshot schedules of the image.
+// Schedules of the pool or RADOS namespace are not included.
+func (ri *rbdImage) ListSnapshotSchedules() ([]admin.ScheduleTerm, error) {
+	ls := admin.NewLevelSpec(ri.Pool, ri.RadosNamespace, ri.RbdImageName)
+	ra, err := ri.conn.GetRBDAdmin()
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := ra.MirrorSnashotSchedule().List(ls)
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []admin.ScheduleTerm
+	for _, schedule := range schedules {
+		terms = append(terms, schedule.Schedule...)
+	}
+
+	return terms, nil
+}
+
+// RemoveSnapshotScheduling removes a mirror snapshot schedule from the image.
+func (ri *rbdImage) RemoveSnapshotScheduling(
+	interval admin.Interval,
+	startTime admin.StartTime,
+) error {
+	ls := admin.NewLevelSpec(ri.Pool, ri.RadosNamespace, ri.RbdImageName)
+	ra, err := ri.conn.GetRBDAdmin()
+	if err != nil {
+		return err
+	}
+
+	return ra.MirrorSnashotSchedule().Remove(ls, interval, startTime)
+}
+
 // getCephClientLogFileName compiles the complete log file path based on inputs.
 func getCephClientLogFileName(id, logDir, prefix string) string {
 	if prefix == "" {
@@ -2187,7 +2457,7 @@ func genVolFromVolIDWithMigration(
 			return nil, pErr
 		}
 
-		return genVolFromMigVolID(ctx, pmVolID, cr)
+		return genVolFromMigVolIDWithImageInfo(ctx, pmVolID, cr, secrets)
 	}
 	rv, err := GenVolFromVolID(ctx, volID, cr, secrets)
 	if err != nil {
@@ -2238,6 +2508,45 @@ func (rv *rbdVolume) unsetAllMetadata(keys []string) error {
 	return nil
 }
 
+// setUserMetadata sets the user metadata from the StorageClass on the image,
+// and removes user metadata that is not in it, like the user metadata that a
+// clone inherited from its parent. User metadata is set independent of
+// EnableMetadata.
+func (ri *rbdImage) setUserMetadata(metadata map[string]string) error {
+	image, err := ri.open()
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	current, err := image.ListMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list metadata of %q: %w", ri, err)
+	}
+
+	for key := range current {
+		if _, ok := metadata[key]; ok || !k8s.IsUserMetadataKey(key) {
+			continue
+		}
+		err = image.RemoveMetadata(key)
+		if err != nil && !errors.Is(err, librbd.ErrNotExist) {
+			return fmt.Errorf("failed to unset metadata key %q on %q: %w", key, ri, err)
+		}
+	}
+
+	for key, value := range metadata {
+		if v, ok := current[key]; ok && v == value {
+			continue
+		}
+		err = image.SetMetadata(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to set metadata key %q, value %q on %q: %w", key, value, ri, err)
+		}
+	}
+
+	return nil
+}
+
 // GetID returns the ID of the volume.
 func (ri *rbdImage) GetID(ctx context.Context) (string, error) {
 	if ri.VolID == "" {
@@ -0,0 +1,206 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// singleWriterLockPrefix is the prefix of the cookie of the advisory lock
+// that a Pod holds on the image of a ReadWriteOncePod volume. The cookie is
+// completed with the ID of the node and the UID of the Pod.
+const singleWriterLockPrefix = "csi-single-writer/"
+
+// singleWriterCookie returns the cookie of the advisory lock of the Pod.
+func singleWriterCookie(nodeID, podUID string) string {
+	return singleWriterLockPrefix + nodeID + "/" + podUID
+}
+
+// singleWriterLockNode returns the node of a single writer lock, false is
+// returned when the cookie is not one of a single writer lock.
+func singleWriterLockNode(cookie string) (string, bool) {
+	rest, ok := strings.CutPrefix(cookie, singleWriterLockPrefix)
+	if !ok {
+		return "", false
+	}
+
+	i := strings.LastIndex(rest, "/")
+	if i == -1 {
+		return "", false
+	}
+
+	return rest[:i], true
+}
+
+// checkSingleWriterLockers returns true when the image is locked with the
+// cookie already, otherwise the locks that can be broken before the image
+// is locked. The locks of other Pods on this node are stale, the single
+// writer claim on the node checked that these Pods do not use the volume
+// anymore. The locks of other nodes are stale when the image is not watched
+// from the address of the locker, the image is not mapped on that node then.
+// ErrPublishedForOtherPod is returned for all other locks.
+func checkSingleWriterLockers(
+	lockers []librbd.Locker,
+	watchers []librbd.ImageWatcher,
+	nodeID, cookie string,
+) (bool, []librbd.Locker, error) {
+	var stale []librbd.Locker
+	for _, l := range lockers {
+		if l.Cookie == cookie {
+			return true, nil, nil
+		}
+
+		node, ok := singleWriterLockNode(l.Cookie)
+		if !ok {
+			return false, nil, fmt.Errorf("%w: image is locked by %s with cookie %q",
+				util.ErrPublishedForOtherPod, l.Client, l.Cookie)
+		}
+		if node == nodeID || !isWatchedFrom(watchers, watcherIP(l.Addr)) {
+			stale = append(stale, l)
+
+			continue
+		}
+
+		return false, nil, fmt.Errorf("%w: image is locked on node %s by %s",
+			util.ErrPublishedForOtherPod, node, l.Client)
+	}
+
+	return false, stale, nil
+}
+
+// isWatchedFrom returns true when one of the watchers has the IP address.
+func isWatchedFrom(watchers []librbd.ImageWatcher, ip string) bool {
+	for _, w := range watchers {
+		if watcherIP(w.Addr) == ip {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lockSingleWriter takes the advisory lock of the Pod on the image, after
+// the stale locks of Pods that do not use the image anymore are broken. The
+// lock does not block the IO of other clients, but prevents that the volume
+// is published for another Pod through Ceph-CSI on any node.
+func (ri *rbdImage) lockSingleWriter(ctx context.Context, nodeID, podUID string) error {
+	image, err := ri.open()
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	_, lockers, err := image.ListLockers()
+	if err != nil {
+		return fmt.Errorf("failed to list lockers of %q: %w", ri, err)
+	}
+
+	watchers, err := image.ListWatchers()
+	if err != nil {
+		return fmt.Errorf("failed to list watchers of %q: %w", ri, err)
+	}
+
+	cookie := singleWriterCookie(nodeID, podUID)
+	locked, stale, err := checkSingleWriterLockers(lockers, watchers, nodeID, cookie)
+	if err != nil || locked {
+		return err
+	}
+
+	for _, l := range stale {
+		log.DebugLog(ctx, "breaking stale single writer lock %q of %s on image %s", l.Cookie, l.Client, ri)
+
+		err = image.BreakLock(l.Client, l.Cookie)
+		if err != nil && !errors.Is(err, librbd.ErrNotExist) {
+			return fmt.Errorf("failed to break lock %q of %s on %q: %w", l.Cookie, l.Client, ri, err)
+		}
+	}
+
+	err = image.LockExclusive(cookie)
+	var ec interface{ ErrorCode() int }
+	if errors.As(err, &ec) && ec.ErrorCode() == -int(syscall.EBUSY) {
+		return fmt.Errorf("%w: image %s was locked by another pod", util.ErrPublishedForOtherPod, ri)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock %q for pod %s: %w", ri, podUID, err)
+	}
+
+	return nil
+}
+
+// lockSingleWriter locks the image of the ReadWriteOncePod volume for the
+// Pod that it is published for. The image is not locked when the Pod
+// information (podInfoOnMount) or the credentials are missing, NodePublish
+// only has credentials when they are configured for the nodeplugin or with
+// a node-publish secret.
+func (ns *NodeServer) lockSingleWriter(ctx context.Context, req *csi.NodePublishVolumeRequest) error {
+	volID := req.GetVolumeId()
+	podUID := req.GetVolumeContext()[util.PodUIDKey]
+	if podUID == "" {
+		return nil
+	}
+
+	secrets, err := getNodeStageSecrets(volID, req.GetVolumeContext(), req.GetSecrets())
+	if err != nil {
+		return err
+	}
+	cr, err := util.NewUserCredentialsWithMigration(secrets)
+	if err != nil {
+		log.DebugLog(ctx, "no credentials to lock the image of volume %s for pod %s: %v", volID, podUID, err)
+
+		return nil
+	}
+	defer cr.DeleteCredentials()
+
+	imgInfo, err := lookupRBDImageMetadataStash(req.GetStagingTargetPath())
+	if err != nil {
+		return err
+	}
+
+	clusterID := req.GetVolumeContext()["clusterID"]
+	if clusterID == "" {
+		clusterID = util.GetClusterIDFromVolumeID(volID)
+	}
+	monitors, _, err := util.GetMonsAndClusterID(ctx, clusterID, false)
+	if err != nil {
+		return err
+	}
+
+	ri := &rbdImage{
+		ClusterID:      clusterID,
+		Monitors:       monitors,
+		Pool:           imgInfo.Pool,
+		RadosNamespace: imgInfo.RadosNamespace,
+		RbdImageName:   imgInfo.ImageName,
+	}
+	err = ri.Connect(cr)
+	if err != nil {
+		return err
+	}
+	defer ri.Destroy(ctx)
+
+	return ri.lockSingleWriter(ctx, ns.Driver.GetNodeID(), podUID)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleWriterLockNode(t *testing.T) {
+	t.Parallel()
+
+	node, ok := singleWriterLockNode(singleWriterCookie("node-1", "pod-a"))
+	require.True(t, ok)
+	require.Equal(t, "node-1", node)
+
+	_, ok = singleWriterLockNode("auto 18446462598732840961")
+	require.False(t, ok)
+
+	_, ok = singleWriterLockNode(singleWriterLockPrefix + "node-1")
+	require.False(t, ok)
+}
+
+func TestCheckSingleWriterLockers(t *testing.T) {
+	t.Parallel()
+
+	cookie := singleWriterCookie("node-1", "pod-a")
+	watchers := []librbd.ImageWatcher{
+		{Addr: "10.0.0.1:0/2310812345", Id: 4123},
+		{Addr: "10.0.0.2:0/1234567890", Id: 4200},
+	}
+	tests := []struct {
+		name    string
+		lockers []librbd.Locker
+		locked  bool
+		stale   []librbd.Locker
+		wantErr bool
+	}{
+		{
+			name: "not locked",
+		},
+		{
+			name: "locked for the pod",
+			lockers: []librbd.Locker{
+				{Client: "client.4100", Cookie: cookie, Addr: "10.0.0.1:0/1111"},
+			},
+			locked: true,
+		},
+		{
+			name: "locked by another pod on this node",
+			lockers: []librbd.Locker{
+				{Client: "client.4100", Cookie: singleWriterCookie("node-1", "pod-b"), Addr: "10.0.0.1:0/1111"},
+			},
+			stale: []librbd.Locker{
+				{Client: "client.4100", Cookie: singleWriterCookie("node-1", "pod-b"), Addr: "10.0.0.1:0/1111"},
+			},
+		},
+		{
+			name: "locked on another node that maps the image",
+			lockers: []librbd.Locker{
+				{Client: "client.4150", Cookie: singleWriterCookie("node-2", "pod-b"), Addr: "10.0.0.2:0/2222"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "locked on another node that does not map the image",
+			lockers: []librbd.Locker{
+				{Client: "client.4160", Cookie: singleWriterCookie("node-3", "pod-b"), Addr: "10.0.0.3:0/3333"},
+			},
+			stale: []librbd.Locker{
+				{Client: "client.4160", Cookie: singleWriterCookie("node-3", "pod-b"), Addr: "10.0.0.3:0/3333"},
+			},
+		},
+		{
+			name: "locked by another application",
+			lockers: []librbd.Locker{
+				{Client: "client.4170", Cookie: "backup", Addr: "10.0.0.4:0/4444"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			locked, stale, err := checkSingleWriterLockers(tt.lockers, watchers, "node-1", cookie)
+			if tt.wantErr {
+				require.ErrorIs(t, err, util.ErrPublishedForOtherPod)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.locked, locked)
+			require.Equal(t, tt.stale, stale)
+		})
+	}
+}
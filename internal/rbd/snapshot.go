@@ -69,7 +69,7 @@ func createRBDClone(
 		return err
 	}
 
-	return nil
+	return err
 }
 
 // cleanUpSnapshot removes the RBD-snapshot (rbdSnap) from the RBD-image
@@ -111,6 +111,7 @@ func (rv *rbdVolume) toSnapshot() *rbdSnapshot {
 			VolSize:        rv.VolSize,
 			Monitors:       rv.Monitors,
 			Pool:           rv.Pool,
+			DataPool:       rv.DataPool,
 			JournalPool:    rv.JournalPool,
 			RadosNamespace: rv.RadosNamespace,
 			RbdImageName:   rv.RbdImageName,
@@ -132,6 +133,7 @@ func (rbdSnap *rbdSnapshot) toVolume() *rbdVolume {
 			VolID:          rbdSnap.VolID,
 			Monitors:       rbdSnap.Monitors,
 			Pool:           rbdSnap.Pool,
+			DataPool:       rbdSnap.DataPool,
 			JournalPool:    rbdSnap.JournalPool,
 			RadosNamespace: rbdSnap.RadosNamespace,
 			RbdImageName:   rbdSnap.RbdSnapName,
@@ -339,3 +341,23 @@ func (rbdSnap *rbdSnapshot) SetVolumeGroup(ctx context.Context, cr *util.Credent
 
 	return nil
 }
+
+// flattenRestoreToPool adds a task to flatten a volume that was restored from
+// a snapshot in a different pool. A clone references the data of its parent,
+// only after flattening the data of the volume is stored in the pool (and
+// data pool) of the volume. The volume can be used while the flatten task is
+// running.
+func (rv *rbdVolume) flattenRestoreToPool(ctx context.Context, snapPool string) error {
+	if rv.Pool == snapPool {
+		return nil
+	}
+
+	log.DebugLog(ctx, "volume %s is restored from a snapshot in pool %s, flattening it", rv, snapPool)
+
+	err := rv.flattenRbdImage(ctx, true, 0, 0)
+	if err != nil && !errors.Is(err, ErrFlattenInProgress) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// snapSourceAttribute is the attribute in the snapshot journal that contains
+// the name of the image the snapshot was created from.
+const snapSourceAttribute = "source"
+
+// snapshotsCounter is the counter in the journal object of a volume that
+// holds the number of its snapshots.
+const snapshotsCounter = "snapshots"
+
+// countSnapshots returns the number of snapshots of the volume that are
+// reserved in the snapshot journal of the pool. It lists all snapshot
+// reservations in the pool, and is only used when the snapshots counter of
+// the volume does not exist yet.
+func (rv *rbdVolume) countSnapshots(ctx context.Context, rbdSnap *rbdSnapshot, cr *util.Credentials) (int, error) {
+	journalPoolID, imagePoolID, err := util.GetPoolIDs(ctx, rbdSnap.Monitors, rbdSnap.JournalPool, rbdSnap.Pool, cr)
+	if err != nil {
+		return 0, err
+	}
+
+	j, err := snapJournal.Connect(rbdSnap.Monitors, rbdSnap.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	reservations, err := j.ListReservations(ctx, rbdSnap.JournalPool, journalPoolID, imagePoolID,
+		snapSourceAttribute)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshots in pool %q: %w", rbdSnap.Pool, err)
+	}
+
+	snapshots := 0
+	for _, source := range reservations {
+		if source == rv.RbdImageName {
+			snapshots++
+		}
+	}
+
+	return snapshots, nil
+}
+
+// getSnapshotsCount returns the number of snapshots of the volume. The count
+// is kept in the snapshots counter in the journal object of the volume, the
+// counter is initialized from the snapshot journal when it does not exist.
+// Static volumes do not have a journal object, their snapshots are always
+// counted in the snapshot journal.
+func (rv *rbdVolume) getSnapshotsCount(ctx context.Context, rbdSnap *rbdSnapshot, cr *util.Credentials) (int, error) {
+	if rv.ReservedID == "" {
+		return rv.countSnapshots(ctx, rbdSnap, cr)
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	oid := j.ReservationObject(rv.ReservedID)
+	counters, err := j.GetCounters(ctx, rv.JournalPool, oid)
+	if err != nil {
+		return 0, err
+	}
+	if counters != nil {
+		return int(counters[snapshotsCounter]), nil
+	}
+
+	snapshots := 0
+	err = j.UpdateCounters(ctx, rv.JournalPool, oid, func(counters journal.Counters) (journal.Counters, error) {
+		if counters != nil {
+			// initialized by another request while waiting for the lock
+			snapshots = int(counters[snapshotsCounter])
+
+			return counters, nil
+		}
+
+		var cErr error
+		snapshots, cErr = rv.countSnapshots(ctx, rbdSnap, cr)
+		if cErr != nil {
+			return nil, cErr
+		}
+
+		return journal.Counters{snapshotsCounter: int64(snapshots)}, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to initialize snapshots counter of volume %s: %w", rv, err)
+	}
+
+	return snapshots, nil
+}
+
+// updateSnapshotsCount adds delta to the snapshots counter of the volume with
+// the image name source. Nothing is done when the counter does not exist, it
+// is initialized with the current number of snapshots when the snapshot
+// limits are checked the next time.
+func updateSnapshotsCount(
+	ctx context.Context,
+	monitors, radosNamespace, journalPool, source string,
+	cr *util.Credentials,
+	delta int64,
+) error {
+	reservedID, ok := journal.GetUUIDFromName(source)
+	if !ok {
+		// static volumes are not counted
+		return nil
+	}
+
+	j, err := volJournal.Connect(monitors, radosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return j.AddToCounter(ctx, journalPool, j.ReservationObject(reservedID), snapshotsCounter, delta)
+}
+
+// fetchLastSnapshotTime returns the time of the last snapshot of the volume
+// from the journal. It is empty when the time is not known, like for static
+// volumes or volumes without snapshots.
+func (rv *rbdVolume) fetchLastSnapshotTime(ctx context.Context, cr *util.Credentials) (string, error) {
+	if rv.ReservedID == "" {
+		return "", nil
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return "", err
+	}
+	defer j.Destroy()
+
+	last, err := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, util.LastSnapshotAttribute)
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return last, nil
+}
+
+// storeLastSnapshotTime stores the time of the last snapshot of the volume in
+// the journal, so that the minimum interval between snapshots can be
+// enforced.
+func (rv *rbdVolume) storeLastSnapshotTime(ctx context.Context, cr *util.Credentials, t time.Time) error {
+	if rv.ReservedID == "" {
+		return nil
+	}
+
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, util.LastSnapshotAttribute, util.FormatSnapshotTime(t))
+}
+
+// checkSnapshotLimits verifies that a new snapshot of the volume does not
+// exceed the snapshot limits of the CSI config and the VolumeSnapshotClass
+// parameters. It returns util.ErrSnapshotLimitExceeded when it does.
+func (rv *rbdVolume) checkSnapshotLimits(
+	ctx context.Context,
+	rbdSnap *rbdSnapshot,
+	cr *util.Credentials,
+	parameters map[string]string,
+) error {
+	limits, err := util.GetSnapshotLimits(util.CsiConfigFile, rbdSnap.ClusterID, parameters)
+	if err != nil {
+		return err
+	}
+
+	if !limits.Enabled() {
+		return nil
+	}
+
+	snapshots, err := rv.getSnapshotsCount(ctx, rbdSnap, cr)
+	if err != nil {
+		return err
+	}
+
+	last, err := rv.fetchLastSnapshotTime(ctx, cr)
+	if err != nil {
+		return fmt.Errorf("failed to get time of last snapshot of volume %s: %w", rv, err)
+	}
+
+	log.DebugLog(ctx, "volume %s has %d snapshots, last snapshot at %q", rv, snapshots, last)
+
+	return limits.Check(snapshots, last, time.Now())
+}
@@ -0,0 +1,455 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultMaxBlockMetadata is the number of extents that are returned
+	// in a response, when the request does not limit it.
+	defaultMaxBlockMetadata = 1024
+
+	// deltaBlockSize is the size of the blocks that are compared between
+	// two snapshots, it is the granularity of the changed extents.
+	deltaBlockSize = 64 * 1024
+)
+
+// SnapshotMetadataServer implements the CSI SnapshotMetadata service. It
+// returns the allocated extents of a snapshot, and the extents that changed
+// between two snapshots of a volume, for incremental backups.
+type SnapshotMetadataServer struct {
+	csi.UnimplementedSnapshotMetadataServer
+}
+
+// NewSnapshotMetadataServer returns a SnapshotMetadataServer.
+func NewSnapshotMetadataServer() *SnapshotMetadataServer {
+	return &SnapshotMetadataServer{}
+}
+
+// blockStream collects the extents of a response stream. Adjacent extents
+// are merged, and a response is sent when maxResults extents are pending.
+type blockStream struct {
+	maxResults int
+	pending    []*csi.BlockMetadata
+	send       func(blocks []*csi.BlockMetadata) error
+}
+
+// newBlockStream returns a blockStream that sends at most maxResults extents
+// per response.
+func newBlockStream(maxResults int32, send func(blocks []*csi.BlockMetadata) error) *blockStream {
+	n := int(maxResults)
+	if n <= 0 {
+		n = defaultMaxBlockMetadata
+	}
+
+	return &blockStream{maxResults: n, send: send}
+}
+
+// add adds the extent, which needs to start at or after the end of the
+// previous extent.
+func (bs *blockStream) add(offset, length int64) error {
+	if length <= 0 {
+		return nil
+	}
+
+	if n := len(bs.pending); n > 0 {
+		last := bs.pending[n-1]
+		if last.GetByteOffset()+last.GetSizeBytes() == offset {
+			last.SizeBytes += length
+
+			return nil
+		}
+		if n == bs.maxResults {
+			err := bs.flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	bs.pending = append(bs.pending, &csi.BlockMetadata{ByteOffset: offset, SizeBytes: length})
+
+	return nil
+}
+
+// flush sends the pending extents.
+func (bs *blockStream) flush() error {
+	if len(bs.pending) == 0 {
+		return nil
+	}
+
+	err := bs.send(bs.pending)
+	bs.pending = nil
+
+	return err
+}
+
+// appendMerged adds the extent, which may not start before the last extent,
+// and merges it with the last extent when they overlap or are adjacent.
+func appendMerged(extents []imageExtent, e imageExtent) []imageExtent {
+	if n := len(extents); n > 0 {
+		last := &extents[n-1]
+		if e.offset <= last.offset+last.length {
+			last.length = max(last.offset+last.length, e.offset+e.length) - last.offset
+
+			return extents
+		}
+	}
+
+	return append(extents, e)
+}
+
+// mergeExtents returns the union of the sorted extents of a and b, as sorted
+// extents that do not overlap.
+func mergeExtents(a, b []imageExtent) []imageExtent {
+	merged := make([]imageExtent, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if j == len(b) || (i < len(a) && a[i].offset <= b[j].offset) {
+			merged = appendMerged(merged, a[i])
+			i++
+		} else {
+			merged = appendMerged(merged, b[j])
+			j++
+		}
+	}
+
+	return merged
+}
+
+// alignExtents extends the sorted extents to the boundaries of deltaBlockSize
+// within the size, and merges the extents that overlap after that.
+func alignExtents(extents []imageExtent, size uint64) []imageExtent {
+	aligned := make([]imageExtent, 0, len(extents))
+	for _, e := range extents {
+		start := e.offset - e.offset%deltaBlockSize
+		end := (e.offset + e.length + deltaBlockSize - 1) / deltaBlockSize * deltaBlockSize
+		end = min(end, size)
+		aligned = appendMerged(aligned, imageExtent{offset: start, length: end - start})
+	}
+
+	return aligned
+}
+
+// changedBlocks calls changed for the blocks of deltaBlockSize that differ
+// between base and target, which contain the data at offset.
+func changedBlocks(base, target []byte, offset int64, changed func(offset, length int64) error) error {
+	for start := 0; start < len(target); start += deltaBlockSize {
+		end := min(start+deltaBlockSize, len(target))
+		if bytes.Equal(base[start:end], target[start:end]) {
+			continue
+		}
+
+		err := changed(offset+int64(start), int64(end-start))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openSnapshotImage opens the snapshot of the image that backs a CSI
+// snapshot read-only. Encrypted snapshots are rejected, the offsets of the
+// RBD image do not match the offsets of the decrypted volume.
+func openSnapshotImage(rbdSnap *rbdSnapshot) (*librbd.Image, error) {
+	if rbdSnap.isBlockEncrypted() {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"snapshot %s is encrypted, its metadata is not supported", rbdSnap.VolID)
+	}
+
+	err := rbdSnap.openIoctx()
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := librbd.OpenImageReadOnly(rbdSnap.ioctx, rbdSnap.RbdSnapName, rbdSnap.RbdSnapName)
+	if err != nil {
+		if errors.Is(err, librbd.ErrNotFound) {
+			return nil, status.Errorf(codes.NotFound, "snapshot %s not found: %v", rbdSnap.VolID, err)
+		}
+
+		return nil, err
+	}
+
+	return image, nil
+}
+
+// allocatedExtents returns the allocated extents of the image, including
+// the data of its parents, from the offset to the end of the image.
+func allocatedExtents(image *librbd.Image, offset, size uint64) ([]imageExtent, error) {
+	var extents []imageExtent
+	if offset >= size {
+		return extents, nil
+	}
+
+	err := image.DiffIterate(librbd.DiffIterateConfig{
+		Offset:        offset,
+		Length:        size - offset,
+		IncludeParent: librbd.IncludeParent,
+		WholeObject:   librbd.DisableWholeObject,
+		Callback: func(offset, length uint64, exists int, _ interface{}) int {
+			if exists != 0 {
+				extents = append(extents, imageExtent{offset: offset, length: length})
+			}
+
+			return 0
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the allocated extents: %w", err)
+	}
+
+	return extents, nil
+}
+
+// getSnapshot returns the snapshot with the ID, connected with the
+// provisioner credentials of its cluster.
+func getSnapshot(ctx context.Context, snapshotID string, secrets map[string]string) (*rbdSnapshot, error) {
+	if snapshotID == "" {
+		return nil, status.Error(codes.InvalidArgument, "snapshot ID cannot be empty")
+	}
+
+	secrets, err := getProvisionerSecrets(util.GetClusterIDFromVolumeID(snapshotID), secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return nil, util.GRPCError(err)
+	}
+	defer cr.DeleteCredentials()
+
+	rbdSnap, err := genSnapFromSnapID(ctx, snapshotID, cr, secrets)
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+			return nil, status.Errorf(codes.NotFound, "snapshot %s not found: %v", snapshotID, err)
+		}
+
+		return nil, util.GRPCError(err)
+	}
+
+	return rbdSnap, nil
+}
+
+// GetMetadataAllocated streams the allocated extents of a snapshot, which
+// are listed with the fast-diff of the image when it is enabled.
+func (sms *SnapshotMetadataServer) GetMetadataAllocated(
+	req *csi.GetMetadataAllocatedRequest,
+	stream csi.SnapshotMetadata_GetMetadataAllocatedServer,
+) error {
+	ctx := stream.Context()
+
+	if req.GetStartingOffset() < 0 {
+		return status.Error(codes.OutOfRange, "starting offset cannot be negative")
+	}
+
+	rbdSnap, err := getSnapshot(ctx, req.GetSnapshotId(), req.GetSecrets())
+	if err != nil {
+		return err
+	}
+	defer rbdSnap.Destroy(ctx)
+
+	image, err := openSnapshotImage(rbdSnap)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	if uint64(req.GetStartingOffset()) >= size {
+		return status.Errorf(codes.OutOfRange, "starting offset %d is beyond the size %d of snapshot %s",
+			req.GetStartingOffset(), size, rbdSnap.VolID)
+	}
+
+	extents, err := allocatedExtents(image, uint64(req.GetStartingOffset()), size)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+
+	bs := newBlockStream(req.GetMaxResults(), func(blocks []*csi.BlockMetadata) error {
+		return stream.Send(&csi.GetMetadataAllocatedResponse{
+			BlockMetadataType:   csi.BlockMetadataType_VARIABLE_LENGTH,
+			VolumeCapacityBytes: int64(size),
+			BlockMetadata:       blocks,
+		})
+	})
+	for _, e := range extents {
+		err = bs.add(int64(e.offset), int64(e.length))
+		if err != nil {
+			return err
+		}
+	}
+
+	log.DebugLog(ctx, "listed %d allocated extents of snapshot %s", len(extents), rbdSnap)
+
+	return bs.flush()
+}
+
+// GetMetadataDelta streams the extents that changed between two snapshots
+// of a volume. The snapshots are RBD images of their own, the allocated
+// extents of both snapshots are listed with the fast-diff of the images, and
+// the data in these extents is compared in blocks of deltaBlockSize.
+func (sms *SnapshotMetadataServer) GetMetadataDelta(
+	req *csi.GetMetadataDeltaRequest,
+	stream csi.SnapshotMetadata_GetMetadataDeltaServer,
+) error {
+	ctx := stream.Context()
+
+	if req.GetStartingOffset() < 0 {
+		return status.Error(codes.OutOfRange, "starting offset cannot be negative")
+	}
+
+	baseSnap, err := getSnapshot(ctx, req.GetBaseSnapshotId(), req.GetSecrets())
+	if err != nil {
+		return err
+	}
+	defer baseSnap.Destroy(ctx)
+
+	targetSnap, err := getSnapshot(ctx, req.GetTargetSnapshotId(), req.GetSecrets())
+	if err != nil {
+		return err
+	}
+	defer targetSnap.Destroy(ctx)
+
+	if baseSnap.ClusterID != targetSnap.ClusterID || baseSnap.Pool != targetSnap.Pool ||
+		baseSnap.RadosNamespace != targetSnap.RadosNamespace || baseSnap.RbdImageName != targetSnap.RbdImageName {
+		return status.Errorf(codes.InvalidArgument, "snapshots %s and %s are not snapshots of the same volume",
+			baseSnap.VolID, targetSnap.VolID)
+	}
+
+	baseImage, err := openSnapshotImage(baseSnap)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	defer baseImage.Close()
+
+	targetImage, err := openSnapshotImage(targetSnap)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	defer targetImage.Close()
+
+	baseSize, err := baseImage.GetSize()
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	size, err := targetImage.GetSize()
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	start := uint64(req.GetStartingOffset())
+	if start >= size {
+		return status.Errorf(codes.OutOfRange, "starting offset %d is beyond the size %d of snapshot %s",
+			start, size, targetSnap.VolID)
+	}
+	// compare whole blocks, the first block may start before the offset
+	start -= start % deltaBlockSize
+
+	baseExtents, err := allocatedExtents(baseImage, start, min(baseSize, size))
+	if err != nil {
+		return util.GRPCError(err)
+	}
+	targetExtents, err := allocatedExtents(targetImage, start, size)
+	if err != nil {
+		return util.GRPCError(err)
+	}
+
+	bs := newBlockStream(req.GetMaxResults(), func(blocks []*csi.BlockMetadata) error {
+		return stream.Send(&csi.GetMetadataDeltaResponse{
+			BlockMetadataType:   csi.BlockMetadataType_VARIABLE_LENGTH,
+			VolumeCapacityBytes: int64(size),
+			BlockMetadata:       blocks,
+		})
+	})
+
+	baseBuf := make([]byte, copyReadSize)
+	targetBuf := make([]byte, copyReadSize)
+	for _, e := range alignExtents(mergeExtents(baseExtents, targetExtents), size) {
+		err = compareExtent(ctx, baseImage, targetImage, baseSize, e, baseBuf, targetBuf, bs.add)
+		if err != nil {
+			return util.GRPCError(err)
+		}
+	}
+
+	log.DebugLog(ctx, "compared snapshot %s with snapshot %s", targetSnap, baseSnap)
+
+	return bs.flush()
+}
+
+// compareExtent reads the extent from both images and calls changed for the
+// blocks that differ. Data beyond the size of the base image is compared
+// with zeros.
+func compareExtent(
+	ctx context.Context,
+	baseImage, targetImage *librbd.Image,
+	baseSize uint64,
+	extent imageExtent,
+	baseBuf, targetBuf []byte,
+	changed func(offset, length int64) error,
+) error {
+	offset := extent.offset
+	length := extent.length
+	for length > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n := min(length, uint64(len(targetBuf)))
+		target := targetBuf[:n]
+		_, err := targetImage.ReadAt(target, int64(offset))
+		if err != nil {
+			return fmt.Errorf("failed to read %d bytes at offset %d: %w", n, offset, err)
+		}
+
+		base := baseBuf[:n]
+		clear(base)
+		if offset < baseSize {
+			_, err = baseImage.ReadAt(base[:min(n, baseSize-offset)], int64(offset))
+			if err != nil {
+				return fmt.Errorf("failed to read %d bytes at offset %d: %w", n, offset, err)
+			}
+		}
+
+		err = changedBlocks(base, target, int64(offset), changed)
+		if err != nil {
+			return err
+		}
+
+		offset += n
+		length -= n
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockStream(t *testing.T) {
+	t.Parallel()
+
+	var sent [][]*csi.BlockMetadata
+	bs := newBlockStream(2, func(blocks []*csi.BlockMetadata) error {
+		sent = append(sent, blocks)
+
+		return nil
+	})
+
+	// adjacent extents are merged
+	require.NoError(t, bs.add(0, 4096))
+	require.NoError(t, bs.add(4096, 4096))
+	require.NoError(t, bs.add(16384, 4096))
+	require.Empty(t, sent)
+
+	// the third extent starts a new response
+	require.NoError(t, bs.add(32768, 4096))
+	require.Len(t, sent, 1)
+	require.Equal(t, []*csi.BlockMetadata{
+		{ByteOffset: 0, SizeBytes: 8192},
+		{ByteOffset: 16384, SizeBytes: 4096},
+	}, sent[0])
+
+	// empty extents are ignored
+	require.NoError(t, bs.add(65536, 0))
+	require.NoError(t, bs.flush())
+	require.Len(t, sent, 2)
+	require.Equal(t, []*csi.BlockMetadata{{ByteOffset: 32768, SizeBytes: 4096}}, sent[1])
+
+	// nothing is sent without pending extents
+	require.NoError(t, bs.flush())
+	require.Len(t, sent, 2)
+
+	require.Equal(t, defaultMaxBlockMetadata, newBlockStream(0, nil).maxResults)
+}
+
+func TestMergeExtents(t *testing.T) {
+	t.Parallel()
+
+	a := []imageExtent{{offset: 0, length: 10}, {offset: 100, length: 10}}
+	b := []imageExtent{{offset: 5, length: 10}, {offset: 15, length: 5}, {offset: 200, length: 1}}
+	require.Equal(t, []imageExtent{
+		{offset: 0, length: 20},
+		{offset: 100, length: 10},
+		{offset: 200, length: 1},
+	}, mergeExtents(a, b))
+
+	require.Empty(t, mergeExtents(nil, nil))
+}
+
+func TestAlignExtents(t *testing.T) {
+	t.Parallel()
+
+	extents := []imageExtent{
+		{offset: 10, length: 10},
+		{offset: deltaBlockSize + 10, length: 10},
+		{offset: 4 * deltaBlockSize, length: deltaBlockSize},
+		{offset: 6*deltaBlockSize + 1, length: 10},
+	}
+	require.Equal(t, []imageExtent{
+		{offset: 0, length: 2 * deltaBlockSize},
+		{offset: 4 * deltaBlockSize, length: deltaBlockSize},
+		// the last extent ends at the size of the image
+		{offset: 6 * deltaBlockSize, length: 100},
+	}, alignExtents(extents, 6*deltaBlockSize+100))
+}
+
+func TestChangedBlocks(t *testing.T) {
+	t.Parallel()
+
+	base := make([]byte, 3*deltaBlockSize+10)
+	target := make([]byte, len(base))
+	target[deltaBlockSize+1] = 1
+	target[len(target)-1] = 1
+
+	type extent struct{ offset, length int64 }
+	var changed []extent
+	err := changedBlocks(base, target, 1<<20, func(offset, length int64) error {
+		changed = append(changed, extent{offset, length})
+
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []extent{
+		{1<<20 + deltaBlockSize, deltaBlockSize},
+		{1<<20 + 3*deltaBlockSize, 10},
+	}, changed)
+}
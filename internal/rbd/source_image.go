@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// sourceImageParam is the StorageClass parameter that points to an image
+// which is not managed by Ceph-CSI (a "golden image"). New volumes are
+// cloned from the latest protected snapshot of this image.
+const sourceImageParam = "sourceImage"
+
+// ErrNoProtectedSnapshot is returned when the source image does not have a
+// protected snapshot that can be cloned.
+var ErrNoProtectedSnapshot = errors.New("no protected snapshot found")
+
+// imageSpec identifies an RBD image by pool, rados namespace and name.
+type imageSpec struct {
+	Pool           string
+	RadosNamespace string
+	ImageName      string
+}
+
+// String returns the image specification in the format that the rbd CLI
+// uses.
+func (is *imageSpec) String() string {
+	if is.RadosNamespace != "" {
+		return fmt.Sprintf("%s/%s/%s", is.Pool, is.RadosNamespace, is.ImageName)
+	}
+
+	return fmt.Sprintf("%s/%s", is.Pool, is.ImageName)
+}
+
+// parseImageSpec parses an image specification in the format
+// [<pool>/[<namespace>/]]<image>. When the pool is not part of the
+// specification, the defaultPool is used.
+func parseImageSpec(spec, defaultPool string) (*imageSpec, error) {
+	is := &imageSpec{Pool: defaultPool}
+
+	parts := strings.Split(spec, "/")
+	switch len(parts) {
+	case 1:
+		is.ImageName = parts[0]
+	case 2:
+		is.Pool, is.ImageName = parts[0], parts[1]
+	case 3:
+		is.Pool, is.RadosNamespace, is.ImageName = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("invalid image specification %q, expected [<pool>/[<namespace>/]]<image>", spec)
+	}
+
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid image specification %q, empty component", spec)
+		}
+	}
+
+	if is.Pool == "" {
+		return nil, fmt.Errorf("missing pool in image specification %q", spec)
+	}
+
+	return is, nil
+}
+
+// parseSourceImage sets the SourceImage of the volume from the parameters,
+// if the sourceImage parameter is set.
+func (rv *rbdVolume) parseSourceImage(parameters map[string]string) error {
+	spec, ok := parameters[sourceImageParam]
+	if !ok {
+		return nil
+	}
+
+	var err error
+	rv.SourceImage, err = parseImageSpec(spec, rv.Pool)
+
+	return err
+}
+
+// toVolume returns a rbdVolume for the image that uses a copy of the
+// connection of the given volume.
+func (is *imageSpec) toVolume(rv *rbdVolume) *rbdVolume {
+	return &rbdVolume{
+		rbdImage: rbdImage{
+			Pool:           is.Pool,
+			RadosNamespace: is.RadosNamespace,
+			RbdImageName:   is.ImageName,
+			ClusterID:      rv.ClusterID,
+			Monitors:       rv.Monitors,
+			conn:           rv.conn.Copy(),
+		},
+	}
+}
+
+// getLatestProtectedSnapshot returns the name of the most recently created
+// snapshot of the image that is protected.
+func (ri *rbdImage) getLatestProtectedSnapshot() (string, error) {
+	image, err := ri.open()
+	if err != nil {
+		return "", err
+	}
+	defer image.Close()
+
+	snaps, err := image.GetSnapshotNames()
+	if err != nil {
+		return "", fmt.Errorf("failed to list snapshots of %q: %w", ri, err)
+	}
+
+	var (
+		latestID   uint64
+		latestName string
+	)
+	for _, snap := range snaps {
+		if latestName != "" && snap.Id < latestID {
+			continue
+		}
+
+		protected, pErr := image.GetSnapshot(snap.Name).IsProtected()
+		if pErr != nil {
+			return "", fmt.Errorf("failed to check protection of snapshot %q of %q: %w", snap.Name, ri, pErr)
+		}
+		if protected {
+			latestID = snap.Id
+			latestName = snap.Name
+		}
+	}
+
+	if latestName == "" {
+		return "", fmt.Errorf("%w on image %q", ErrNoProtectedSnapshot, ri)
+	}
+
+	return latestName, nil
+}
+
+// createCloneFromSourceImage creates the image for the volume by cloning the
+// latest protected snapshot of the SourceImage.
+func (rv *rbdVolume) createCloneFromSourceImage(ctx context.Context) error {
+	parentVol := rv.SourceImage.toVolume(rv)
+	defer parentVol.Destroy(ctx)
+
+	err := parentVol.getImageInfo()
+	if err != nil {
+		return fmt.Errorf("failed to get source image %q: %w", rv.SourceImage, err)
+	}
+
+	if rv.VolSize < parentVol.VolSize {
+		return fmt.Errorf("%w: volume size %d is smaller than source image %q size %d",
+			ErrInvalidArgument, rv.VolSize, rv.SourceImage, parentVol.VolSize)
+	}
+
+	snapName, err := parentVol.getLatestProtectedSnapshot()
+	if err != nil {
+		return err
+	}
+
+	snap := &rbdSnapshot{}
+	snap.RbdImageName = parentVol.RbdImageName
+	snap.RbdSnapName = snapName
+	snap.Pool = parentVol.Pool
+
+	log.DebugLog(ctx, "cloning volume %s from source image snapshot %s", rv, snap)
+
+	err = rv.cloneRbdImageFromSnapshot(ctx, snap, parentVol)
+	if err != nil {
+		return fmt.Errorf("failed to clone %q from source image snapshot %q: %w", rv, snap, err)
+	}
+
+	// expand the image if the requested size is greater than the current size
+	err = rv.expand()
+	if err != nil {
+		if deleteErr := rv.Delete(ctx); deleteErr != nil {
+			log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v", rv, deleteErr)
+		}
+
+		return fmt.Errorf("failed to resize volume %q: %w", rv, err)
+	}
+
+	return nil
+}
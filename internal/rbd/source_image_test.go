@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseImageSpec(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		spec    string
+		want    *imageSpec
+		wantErr bool
+	}{
+		{
+			name: "image name only",
+			spec: "golden",
+			want: &imageSpec{Pool: "replicapool", ImageName: "golden"},
+		},
+		{
+			name: "pool and image name",
+			spec: "images/golden",
+			want: &imageSpec{Pool: "images", ImageName: "golden"},
+		},
+		{
+			name: "pool, namespace and image name",
+			spec: "images/tenant/golden",
+			want: &imageSpec{Pool: "images", RadosNamespace: "tenant", ImageName: "golden"},
+		},
+		{
+			name:    "empty image name",
+			spec:    "images/",
+			wantErr: true,
+		},
+		{
+			name:    "too many components",
+			spec:    "a/b/c/d",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseImageSpec(tt.spec, "replicapool")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseImageSpec() error = %v, wantErr %v", err, tt.wantErr)
+
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseImageSpec() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
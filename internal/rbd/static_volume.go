@@ -0,0 +1,118 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// StaticImage contains the details of an existing image that are needed to
+// use it as static PersistentVolume.
+type StaticImage struct {
+	// RadosNamespace of the image, static volumes use the one of the CSI
+	// configuration.
+	RadosNamespace string
+	// Size of the image in bytes.
+	Size int64
+	// ImageFeatures are the features of the image that are handled by
+	// ceph-csi, as comma separated list for the `imageFeatures` attribute.
+	ImageFeatures string
+	// NeedsRbdNbd is set when a feature of the image is not supported by
+	// krbd, the image needs to be mapped with rbd-nbd.
+	NeedsRbdNbd bool
+}
+
+// InspectStaticImage checks that the image exists in the pool and that
+// ceph-csi can map it, and returns the details for a static
+// PersistentVolume.
+func InspectStaticImage(
+	ctx context.Context,
+	cr *util.Credentials,
+	clusterID, pool, image string,
+) (*StaticImage, error) {
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", clusterID, err)
+	}
+
+	si := &StaticImage{}
+	si.RadosNamespace, err = util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rados namespace using clusterID (%s): %w", clusterID, err)
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	ioctx, err := conn.GetIoctx(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer ioctx.Destroy()
+	ioctx.SetNamespace(si.RadosNamespace)
+
+	img, err := librbd.OpenImageReadOnly(ioctx, image, librbd.NoSnapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image %q in pool %q: %w", image, pool, err)
+	}
+	defer img.Close()
+
+	size, err := img.GetSize()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the size of image %q: %w", image, err)
+	}
+	si.Size = int64(size)
+
+	features, err := img.GetFeatures()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the features of image %q: %w", image, err)
+	}
+	featureSet := librbd.FeatureSet(features)
+	si.ImageFeatures, si.NeedsRbdNbd = staticImageFeatures(featureSet.Names())
+
+	return si, nil
+}
+
+// staticImageFeatures returns the features that are handled by ceph-csi as
+// sorted, comma separated list, and if one of them requires rbd-nbd. Other
+// features, like `data-pool`, do not need to be passed.
+func staticImageFeatures(names []string) (string, bool) {
+	features := []string{}
+	needsRbdNbd := false
+	for _, name := range names {
+		sf, found := supportedFeatures[name]
+		if !found {
+			continue
+		}
+		features = append(features, name)
+		needsRbdNbd = needsRbdNbd || sf.needRbdNbd
+	}
+	slices.Sort(features)
+
+	return strings.Join(features, ","), needsRbdNbd
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticImageFeatures(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		names           []string
+		wantFeatures    string
+		wantNeedsRbdNbd bool
+	}{
+		{
+			name:         "no features",
+			names:        []string{},
+			wantFeatures: "",
+		},
+		{
+			name:         "default features of rbd create",
+			names:        []string{"layering", "exclusive-lock", "object-map", "fast-diff", "deep-flatten"},
+			wantFeatures: "deep-flatten,exclusive-lock,fast-diff,layering,object-map",
+		},
+		{
+			name:            "journaling needs rbd-nbd",
+			names:           []string{"layering", "exclusive-lock", "journaling"},
+			wantFeatures:    "exclusive-lock,journaling,layering",
+			wantNeedsRbdNbd: true,
+		},
+		{
+			name:         "features that are not handled are skipped",
+			names:        []string{"layering", "data-pool", "striping"},
+			wantFeatures: "layering",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			features, needsRbdNbd := staticImageFeatures(tt.names)
+			require.Equal(t, tt.wantFeatures, features)
+			require.Equal(t, tt.wantNeedsRbdNbd, needsRbdNbd)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+const (
+	// minObjectSize and maxObjectSize are the limits of the object size
+	// (order 12 to 25) that librbd accepts.
+	minObjectSize = uint64(1) << 12
+	maxObjectSize = uint64(1) << 25
+
+	// rbd configuration options that provide the defaults for striping.
+	rbdDefaultOrderOption       = "rbd_default_order"
+	rbdDefaultStripeUnitOption  = "rbd_default_stripe_unit"
+	rbdDefaultStripeCountOption = "rbd_default_stripe_count"
+)
+
+// checkStripingLayout validates the combination of object size, stripe unit
+// and stripe count the same way librbd does when creating an image. A zero
+// stripe unit or stripe count means the default (no fancy striping) is used.
+func checkStripingLayout(objectSize, stripeUnit, stripeCount uint64) error {
+	if objectSize == 0 || (objectSize&(objectSize-1)) != 0 {
+		return fmt.Errorf("objectSize %d is not power of 2", objectSize)
+	}
+
+	if objectSize < minObjectSize || objectSize > maxObjectSize {
+		return fmt.Errorf("objectSize %d is not in the range of %d-%d bytes",
+			objectSize, minObjectSize, maxObjectSize)
+	}
+
+	if stripeUnit == 0 && stripeCount == 0 {
+		return nil
+	}
+
+	if stripeUnit == 0 || stripeCount == 0 {
+		return fmt.Errorf("stripeUnit %d and stripeCount %d must both be set", stripeUnit, stripeCount)
+	}
+
+	if stripeUnit > objectSize || objectSize%stripeUnit != 0 {
+		return fmt.Errorf("stripeUnit %d is not a factor of the objectSize %d", stripeUnit, objectSize)
+	}
+
+	return nil
+}
+
+// getPoolConfigOption returns the value of the rbd configuration option for
+// the pool of the image. An override that is configured for the pool takes
+// precedence over the configuration of the cluster connection.
+func (ri *rbdImage) getPoolConfigOption(name string) (string, error) {
+	// pool level overrides are not stored in the rados namespace
+	ioctx, err := ri.conn.GetIoctx(ri.Pool)
+	if err != nil {
+		return "", err
+	}
+	defer ioctx.Destroy()
+
+	value, err := librbd.GetPoolMetadata(ioctx, imageConfigMetaPrefix+name)
+	if err == nil {
+		return value, nil
+	} else if !errors.Is(err, librbd.ErrNotFound) {
+		return "", fmt.Errorf("failed to get %q from pool %q: %w", name, ri.Pool, err)
+	}
+
+	return ri.conn.GetConfigOption(name)
+}
+
+// getPoolConfigUint64 returns the value of the rbd configuration option for
+// the pool of the image as an uint64.
+func (ri *rbdImage) getPoolConfigUint64(name string) (uint64, error) {
+	value, err := ri.getPoolConfigOption(name)
+	if err != nil {
+		return 0, err
+	}
+
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %q value %q of pool %q: %w", name, value, ri.Pool, err)
+	}
+
+	return number, nil
+}
+
+// validateStripingWithPoolDefaults checks if the striping configuration of
+// the volume is compatible with the defaults of the pool that the image
+// will be created in. Parameters that were not set by the user get replaced
+// by the defaults that librbd will use, so that incompatible combinations
+// are detected before the image gets created. Errors that are caused by an
+// invalid configuration wrap ErrInvalidArgument.
+func (rv *rbdVolume) validateStripingWithPoolDefaults(ctx context.Context) error {
+	if rv.ObjectSize == 0 && rv.StripeUnit == 0 && rv.StripeCount == 0 {
+		// nothing requested, the defaults of librbd are always valid
+		return nil
+	}
+
+	objectSize := rv.ObjectSize
+	if objectSize == 0 {
+		order, err := rv.getPoolConfigUint64(rbdDefaultOrderOption)
+		if err != nil {
+			return err
+		}
+		objectSize = uint64(1) << order
+	}
+
+	stripeUnit := rv.StripeUnit
+	stripeCount := rv.StripeCount
+	if stripeUnit == 0 && stripeCount == 0 {
+		var err error
+		stripeUnit, err = rv.getPoolConfigUint64(rbdDefaultStripeUnitOption)
+		if err != nil {
+			return err
+		}
+
+		stripeCount, err = rv.getPoolConfigUint64(rbdDefaultStripeCountOption)
+		if err != nil {
+			return err
+		}
+
+		// a default of 0 (or a count of 1) means that the object size is
+		// used as stripe unit, which is always compatible
+		if stripeUnit == 0 || stripeCount <= 1 {
+			stripeUnit = 0
+			stripeCount = 0
+		}
+	}
+
+	log.DebugLog(ctx, "validating striping of %s in pool %q: object size %d, stripe unit %d, stripe count %d",
+		rv, rv.Pool, objectSize, stripeUnit, stripeCount)
+
+	err := checkStripingLayout(objectSize, stripeUnit, stripeCount)
+	if err != nil {
+		return fmt.Errorf("%w: incompatible striping for pool %q: %w", ErrInvalidArgument, rv.Pool, err)
+	}
+
+	return nil
+}
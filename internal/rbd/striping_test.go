@@ -0,0 +1,49 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import "testing"
+
+func TestCheckStripingLayout(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		objectSize  uint64
+		stripeUnit  uint64
+		stripeCount uint64
+		wantErr     bool
+	}{
+		{"default layout", 4194304, 0, 0, false},
+		{"valid striping", 4194304, 65536, 16, false},
+		{"stripe unit equals object size", 4194304, 4194304, 4, false},
+		{"object size not power of 2", 3000000, 0, 0, true},
+		{"object size too small", 2048, 0, 0, true},
+		{"object size too large", 67108864, 0, 0, true},
+		{"stripe count missing", 4194304, 65536, 0, true},
+		{"stripe unit larger than object size", 4194304, 8388608, 2, true},
+		{"stripe unit not a factor", 4194304, 12288, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkStripingLayout(tt.objectSize, tt.stripeUnit, tt.stripeCount)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkStripingLayout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
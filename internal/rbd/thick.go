@@ -0,0 +1,206 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+const (
+	// thickProvisionParam is the StorageClass parameter to request the
+	// allocation of all extents of new volumes.
+	thickProvisionParam = "thickProvision"
+
+	// thickProvisionMetaKey is set on images that are thick-provisioned.
+	thickProvisionMetaKey  = "rbd.csi.ceph.com/thick-provisioned"
+	thickProvisionMetaData = "true"
+
+	// thickProvisionOffsetMetaKey contains the offset up to where the image
+	// has been allocated. It is removed once the whole image is allocated,
+	// and used to resume an interrupted allocation.
+	thickProvisionOffsetMetaKey = "rbd.csi.ceph.com/thick-provision-offset"
+
+	// thickProvisionChunkSize is the maximum size that is allocated with a
+	// single WriteSame() call, the progress is recorded after each chunk.
+	thickProvisionChunkSize = helpers.GiB
+)
+
+// allocationSize returns the number of bytes to allocate with the next
+// WriteSame() call. The size is a multiple of the blockSize and at most
+// thickProvisionChunkSize (unless the blockSize is larger). When less than
+// blockSize bytes remain, 0 is returned and the remaining bytes need to be
+// written with WriteAt().
+func allocationSize(remaining, blockSize uint64) uint64 {
+	if remaining < blockSize {
+		return 0
+	}
+
+	size := remaining
+	if size > thickProvisionChunkSize {
+		size = thickProvisionChunkSize
+	}
+
+	// round down to the size of a zeroBlock
+	size = (size / blockSize) * blockSize
+	if size == 0 {
+		size = blockSize
+	}
+
+	return size
+}
+
+// thickProvision marks the image as thick-provisioned and allocates all of
+// its extents.
+func (rv *rbdVolume) thickProvision(ctx context.Context) error {
+	err := rv.SetMetadata(thickProvisionMetaKey, thickProvisionMetaData)
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", thickProvisionMetaKey, rv, err)
+	}
+
+	err = rv.SetMetadata(thickProvisionOffsetMetaKey, "0")
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", thickProvisionOffsetMetaKey, rv, err)
+	}
+
+	return rv.allocate(ctx, 0)
+}
+
+// resumeThickProvision continues the allocation of a thick-provisioned image
+// in case it was interrupted.
+func (rv *rbdVolume) resumeThickProvision(ctx context.Context) error {
+	val, err := rv.GetMetadata(thickProvisionOffsetMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		if !rv.ThickProvision {
+			return nil
+		}
+
+		// the allocation might not have been started at all
+		_, err = rv.GetMetadata(thickProvisionMetaKey)
+		if errors.Is(err, librbd.ErrNotFound) {
+			return rv.thickProvision(ctx)
+		}
+
+		return err
+	} else if err != nil {
+		return fmt.Errorf("failed to get metadata key %q on %q: %w", thickProvisionOffsetMetaKey, rv, err)
+	}
+
+	offset, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse allocation offset %q of %q: %w", val, rv, err)
+	}
+
+	log.DebugLog(ctx, "resuming allocation of image %s at offset %d", rv, offset)
+
+	return rv.allocate(ctx, offset)
+}
+
+// prepareThickProvisionResize records the current size of a thick-provisioned
+// image as the offset from where the allocation needs to continue after the
+// image is resized.
+func (rv *rbdVolume) prepareThickProvisionResize() error {
+	_, err := rv.GetMetadata(thickProvisionMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get metadata key %q on %q: %w", thickProvisionMetaKey, rv, err)
+	}
+
+	// an earlier allocation is still pending, continue from there
+	_, err = rv.GetMetadata(thickProvisionOffsetMetaKey)
+	if err == nil {
+		return nil
+	} else if !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to get metadata key %q on %q: %w", thickProvisionOffsetMetaKey, rv, err)
+	}
+
+	return rv.SetMetadata(thickProvisionOffsetMetaKey, strconv.FormatInt(rv.VolSize, 10))
+}
+
+// allocate writes zeros to the image from the offset up to the end of the
+// image. The progress is stored in the image metadata, and the metadata key
+// is removed once the image is completely allocated.
+func (rv *rbdVolume) allocate(ctx context.Context, offset uint64) error {
+	// We do not want to call discard, we really want to write zeros to get
+	// the allocation. This sets the option for the re-used connection, and
+	// all subsequent images that are opened. That is not a problem, as this
+	// is the only place images get written.
+	err := rv.conn.DisableDiscardOnZeroedWriteSame()
+	if err != nil {
+		return err
+	}
+
+	image, err := rv.open()
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	st, err := image.Stat()
+	if err != nil {
+		return err
+	}
+
+	sc, err := image.GetStripeCount()
+	if err != nil {
+		return err
+	}
+
+	// blockSize is the stripe-period: size of the object-size multiplied
+	// by the stripe-count
+	blockSize := sc * (1 << st.Order)
+	zeroBlock := make([]byte, blockSize)
+
+	for offset < st.Size {
+		size := allocationSize(st.Size-offset, blockSize)
+		if size != 0 {
+			_, err = image.WriteSame(offset, size, zeroBlock, rados.OpFlagNone)
+		} else {
+			// write the last remaining bytes, in case the image size can
+			// not be written with the optimal blockSize
+			size = st.Size - offset
+			_, err = image.WriteAt(zeroBlock[:size], int64(offset))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to allocate %d bytes at offset %d of %q: %w", size, offset, rv, err)
+		}
+
+		offset += size
+		err = image.SetMetadata(thickProvisionOffsetMetaKey, strconv.FormatUint(offset, 10))
+		if err != nil {
+			return fmt.Errorf("failed to set metadata key %q on %q: %w", thickProvisionOffsetMetaKey, rv, err)
+		}
+	}
+
+	err = image.RemoveMetadata(thickProvisionOffsetMetaKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to remove metadata key %q on %q: %w", thickProvisionOffsetMetaKey, rv, err)
+	}
+
+	log.DebugLog(ctx, "allocated image %s with size %d", rv, st.Size)
+
+	return nil
+}
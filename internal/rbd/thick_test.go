@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+func TestAllocationSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		remaining uint64
+		blockSize uint64
+		want      uint64
+	}{
+		{
+			name:      "less than a block",
+			remaining: 3 * helpers.MiB,
+			blockSize: 4 * helpers.MiB,
+			want:      0,
+		},
+		{
+			name:      "multiple blocks",
+			remaining: 10 * helpers.MiB,
+			blockSize: 4 * helpers.MiB,
+			want:      8 * helpers.MiB,
+		},
+		{
+			name:      "limited to chunk size",
+			remaining: 10 * helpers.GiB,
+			blockSize: 4 * helpers.MiB,
+			want:      helpers.GiB,
+		},
+		{
+			name:      "chunk size not a multiple of the block size",
+			remaining: 10 * helpers.GiB,
+			blockSize: 12 * helpers.MiB,
+			want:      1020 * helpers.MiB,
+		},
+		{
+			name:      "block larger than chunk size",
+			remaining: 4 * helpers.GiB,
+			blockSize: 2 * helpers.GiB,
+			want:      2 * helpers.GiB,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := allocationSize(tt.remaining, tt.blockSize); got != tt.want {
+				t.Errorf("allocationSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+const (
+	// trashExpiryParam is the StorageClass parameter with the time that the
+	// images of deleted volumes are kept in the trash, so that they can be
+	// restored.
+	trashExpiryParam = "trashExpiry"
+
+	// trashExpiryAttribute is the attribute in the journal that contains the
+	// trash expiry of the volume in seconds. The StorageClass parameters are
+	// not passed to DeleteVolume.
+	trashExpiryAttribute = "trashexpiry"
+)
+
+// errTrashedImageNotFound is returned when the image is not in the trash.
+var errTrashedImageNotFound = errors.New("image not found in trash")
+
+// parseTrashExpiry returns the trashExpiry parameter of the StorageClass, 0
+// when it is not set.
+func parseTrashExpiry(volOptions map[string]string) (time.Duration, error) {
+	val, ok := volOptions[trashExpiryParam]
+	if !ok {
+		return 0, nil
+	}
+
+	expiry, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %q: %w", trashExpiryParam, val, err)
+	}
+	if expiry < time.Second {
+		return 0, fmt.Errorf("%s %q needs to be at least 1s", trashExpiryParam, val)
+	}
+
+	return expiry, nil
+}
+
+// storeTrashExpiry stores the trash expiry of the volume in the journal,
+// volumes without expiry are deleted immediately.
+func (rv *rbdVolume) storeTrashExpiry(ctx context.Context, j *journal.Connection) error {
+	if rv.TrashExpiry == 0 {
+		return nil
+	}
+
+	return j.StoreAttribute(ctx, rv.JournalPool, rv.ReservedID, trashExpiryAttribute,
+		strconv.FormatInt(int64(rv.TrashExpiry.Seconds()), 10))
+}
+
+// fetchTrashExpiry returns the trash expiry of the volume from the journal,
+// 0 when the volume has none.
+func (rv *rbdVolume) fetchTrashExpiry(ctx context.Context, cr *util.Credentials) (time.Duration, error) {
+	j, err := volJournal.Connect(rv.Monitors, rv.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	val, err := j.FetchAttribute(ctx, rv.JournalPool, rv.ReservedID, trashExpiryAttribute)
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	seconds, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid trash expiry %q of volume %s: %w", val, rv, err)
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// moveToTrash moves the image of the volume, and the temporary clone it was
+// created from, to the trash. They can not be removed from the trash before
+// the expiry, a `rbd trash purge schedule` removes them afterwards. Images
+// that are not found were moved on a previous attempt.
+func (rv *rbdVolume) moveToTrash(ctx context.Context, expiry time.Duration) error {
+	release, err := util.AcquireOperation(ctx, rv.ClusterID, util.DeleteOperation)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err = rv.openIoctx(); err != nil {
+		return err
+	}
+
+	tempClone := rv.generateTempClone()
+	defer tempClone.Destroy(ctx)
+
+	// the clone first, the temporary clone is its parent
+	for _, name := range []string{rv.RbdImageName, tempClone.RbdImageName} {
+		log.DebugLog(ctx, "rbd: moving image %s/%s to trash for %s", rv.Pool, name, expiry)
+
+		err = librbd.GetImage(rv.ioctx, name).Trash(expiry)
+		if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+			return fmt.Errorf("failed to move image %s/%s to trash: %w", rv.Pool, name, err)
+		}
+	}
+
+	return nil
+}
+
+// findTrashedImage returns the last deleted image with the name in the
+// trash.
+func findTrashedImage(trashList []librbd.TrashInfo, name string) (*librbd.TrashInfo, error) {
+	var found *librbd.TrashInfo
+	for i := range trashList {
+		if trashList[i].Name != name {
+			continue
+		}
+		if found == nil || trashList[i].DeletionTime.After(found.DeletionTime) {
+			found = &trashList[i]
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %q", errTrashedImageNotFound, name)
+	}
+
+	return found, nil
+}
+
+// RestoreTrashedImage restores the image of a deleted volume from the trash
+// of the pool, with the RADOS namespace of the cluster. The temporary clone
+// the image was created from is restored as well. The image is not
+// journaled anymore, it can be used as static volume.
+func RestoreTrashedImage(ctx context.Context, cr *util.Credentials, clusterID, pool, image string) error {
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", clusterID, err)
+	}
+
+	radosNamespace, err := util.GetRBDRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch rados namespace using clusterID (%s): %w", clusterID, err)
+	}
+
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return err
+	}
+	defer conn.Destroy()
+
+	ioctx, err := conn.GetIoctx(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+	ioctx.SetNamespace(radosNamespace)
+
+	trashList, err := librbd.GetTrashList(ioctx)
+	if err != nil {
+		return fmt.Errorf("failed to list images in trash: %w", err)
+	}
+
+	info, err := findTrashedImage(trashList, image)
+	if err != nil {
+		return err
+	}
+
+	// the parent first, the clone can not be opened without it
+	tempClone := image + "-temp"
+	if tempInfo, tErr := findTrashedImage(trashList, tempClone); tErr == nil {
+		if err = librbd.TrashRestore(ioctx, tempInfo.Id, tempClone); err != nil {
+			return fmt.Errorf("failed to restore image %s/%s from trash: %w", pool, tempClone, err)
+		}
+	}
+
+	if err = librbd.TrashRestore(ioctx, info.Id, image); err != nil {
+		return fmt.Errorf("failed to restore image %s/%s from trash: %w", pool, image, err)
+	}
+	log.DebugLog(ctx, "rbd: restored image %s/%s from trash", pool, image)
+
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+	"time"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrashExpiry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:    "not set",
+			options: map[string]string{},
+			want:    0,
+		},
+		{
+			name:    "hours",
+			options: map[string]string{trashExpiryParam: "72h"},
+			want:    72 * time.Hour,
+		},
+		{
+			name:    "invalid duration",
+			options: map[string]string{trashExpiryParam: "3d"},
+			wantErr: true,
+		},
+		{
+			name:    "zero",
+			options: map[string]string{trashExpiryParam: "0s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			options: map[string]string{trashExpiryParam: "-1h"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseTrashExpiry(tt.options)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFindTrashedImage(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	trashList := []librbd.TrashInfo{
+		{Id: "1", Name: "csi-vol-a", DeletionTime: now.Add(-2 * time.Hour)},
+		{Id: "2", Name: "csi-vol-b", DeletionTime: now.Add(-time.Hour)},
+		{Id: "3", Name: "csi-vol-a", DeletionTime: now.Add(-time.Hour)},
+	}
+
+	info, err := findTrashedImage(trashList, "csi-vol-a")
+	require.NoError(t, err)
+	require.Equal(t, "3", info.Id)
+
+	_, err = findTrashedImage(trashList, "csi-vol-c")
+	require.ErrorIs(t, err, errTrashedImageNotFound)
+}
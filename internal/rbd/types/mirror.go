@@ -56,6 +56,10 @@ type Mirror interface {
 	GetGlobalMirroringStatus(ctx context.Context) (GlobalStatus, error)
 	// AddSnapshotScheduling adds a snapshot scheduling to the resource
 	AddSnapshotScheduling(interval admin.Interval, startTime admin.StartTime) error
+	// ListSnapshotSchedules returns the snapshot schedules of the resource
+	ListSnapshotSchedules() ([]admin.ScheduleTerm, error)
+	// RemoveSnapshotScheduling removes a snapshot schedule from the resource
+	RemoveSnapshotScheduling(interval admin.Interval, startTime admin.StartTime) error
 }
 
 // MirrorImage is the interface for managing mirroring on an RBD image or group of images.
@@ -0,0 +1,165 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/rbd/types"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// healthyVolumeCondition returns the condition of a volume without problems.
+func healthyVolumeCondition() *csi.VolumeCondition {
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is in a healthy condition",
+	}
+}
+
+// ControllerGetVolume returns the condition of the volume. The request has
+// no secrets, the provisioner credentials of the CSI configuration are used.
+// A volume that is reserved in the journal, but has no image, is abnormal.
+func (cs *ControllerServer) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest,
+) (*csi.ControllerGetVolumeResponse, error) {
+	volumeID := req.GetVolumeId()
+	if volumeID == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
+	}
+
+	var vi util.CSIIdentifier
+	if err := vi.DecomposeCSIID(volumeID); err != nil {
+		return nil, status.Errorf(codes.NotFound, "invalid volume ID %s: %v", volumeID, err)
+	}
+
+	cr, _, err := configuredProvisionerCredentials(ctx, vi.ClusterID)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get credentials for volume %s: %v", volumeID, err)
+
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, nil)
+	defer func() {
+		if rbdVol != nil {
+			rbdVol.Destroy(ctx)
+		}
+	}()
+
+	var condition *csi.VolumeCondition
+	switch {
+	case errors.Is(err, ErrImageNotFound):
+		condition, err = rbdVol.missingImageCondition()
+	case errors.Is(err, util.ErrKeyNotFound), errors.Is(err, util.ErrPoolNotFound):
+		return nil, status.Errorf(codes.NotFound, "volume %s not found: %v", volumeID, err)
+	case err == nil:
+		condition, err = rbdVol.volumeCondition(ctx)
+	}
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get the condition of volume %s: %v", volumeID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{
+			VolumeId:      volumeID,
+			CapacityBytes: rbdVol.VolSize,
+		},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, nil
+}
+
+// missingImageCondition returns the abnormal condition of a volume that has
+// no image. Images that are removed by Ceph-CSI are not in the journal
+// anymore, the image was moved to the trash or removed by someone else.
+func (rv *rbdVolume) missingImageCondition() (*csi.VolumeCondition, error) {
+	if err := rv.openIoctx(); err != nil {
+		return nil, err
+	}
+
+	trashList, err := librbd.GetTrashList(rv.ioctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images in trash: %w", err)
+	}
+
+	if _, err = findTrashedImage(trashList, rv.RbdImageName); err == nil {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("image %s was moved to the trash", rv),
+		}, nil
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: true,
+		Message:  fmt.Sprintf("image %s does not exist", rv),
+	}, nil
+}
+
+// volumeCondition returns the condition of a volume that has an image. The
+// volume is abnormal when mirroring of the image fails.
+func (rv *rbdVolume) volumeCondition(ctx context.Context) (*csi.VolumeCondition, error) {
+	info, err := rv.GetMirroringInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if info.GetState() != librbd.MirrorImageEnabled.String() {
+		return healthyVolumeCondition(), nil
+	}
+
+	sts, err := rv.GetGlobalMirroringStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return mirroringCondition(sts.GetAllSitesStatus()), nil
+}
+
+// mirroringCondition returns the condition of a mirrored image for the
+// mirroring status of the sites, abnormal when a site reports an error.
+func mirroringCondition(sites []types.SiteStatus) *csi.VolumeCondition {
+	for _, s := range sites {
+		if s.GetState() != librbd.MirrorImageStatusStateError.String() {
+			continue
+		}
+
+		site := s.GetMirrorUUID()
+		if site == "" {
+			site = "local"
+		}
+
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("mirroring failed on site %s: %s", site, s.GetDescription()),
+		}
+	}
+
+	return healthyVolumeCondition()
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirroringCondition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		status       GlobalMirrorStatus
+		wantAbnormal bool
+		wantMessage  string
+	}{
+		{
+			name: "replaying on all sites",
+			status: GlobalMirrorStatus{
+				GlobalMirrorImageStatus: librbd.GlobalMirrorImageStatus{
+					SiteStatuses: []librbd.SiteMirrorImageStatus{
+						{
+							State: librbd.MirrorImageStatusStateStopped,
+							Up:    true,
+						},
+						{
+							MirrorUUID: "remote",
+							State:      librbd.MirrorImageStatusStateReplaying,
+							Up:         true,
+						},
+					},
+				},
+			},
+			wantAbnormal: false,
+			wantMessage:  "volume is in a healthy condition",
+		},
+		{
+			name: "error on the local site",
+			status: GlobalMirrorStatus{
+				GlobalMirrorImageStatus: librbd.GlobalMirrorImageStatus{
+					SiteStatuses: []librbd.SiteMirrorImageStatus{
+						{
+							State:       librbd.MirrorImageStatusStateError,
+							Description: "split-brain",
+							Up:          true,
+						},
+					},
+				},
+			},
+			wantAbnormal: true,
+			wantMessage:  "mirroring failed on site local: split-brain",
+		},
+		{
+			name: "error on a remote site",
+			status: GlobalMirrorStatus{
+				GlobalMirrorImageStatus: librbd.GlobalMirrorImageStatus{
+					SiteStatuses: []librbd.SiteMirrorImageStatus{
+						{
+							State: librbd.MirrorImageStatusStateStopped,
+							Up:    true,
+						},
+						{
+							MirrorUUID:  "remote",
+							State:       librbd.MirrorImageStatusStateError,
+							Description: "failed to bootstrap",
+							Up:          true,
+						},
+					},
+				},
+			},
+			wantAbnormal: true,
+			wantMessage:  "mirroring failed on site remote: failed to bootstrap",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			condition := mirroringCondition(tt.status.GetAllSitesStatus())
+			require.Equal(t, tt.wantAbnormal, condition.GetAbnormal())
+			require.Equal(t, tt.wantMessage, condition.GetMessage())
+		})
+	}
+}
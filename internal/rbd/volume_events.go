@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+)
+
+// Reasons of the events that are posted on the PersistentVolumes and
+// PersistentVolumeClaims of volumes.
+const (
+	eventVolumeMapped       = "VolumeMapped"
+	eventVolumeUnmapped     = "VolumeUnmapped"
+	eventEncryptionUnlocked = "EncryptionUnlocked"
+	eventFlattenQueued      = "FlattenQueued"
+	eventFlattened          = "Flattened"
+)
+
+// volumeObjects returns the Kubernetes objects of the image, from the image
+// metadata that is set with the --setmetadata option. The metadata is only
+// read when events are enabled.
+func (ri *rbdImage) volumeObjects() k8s.VolumeObjects {
+	if !k8s.VolumeEventsEnabled() {
+		return k8s.VolumeObjects{}
+	}
+
+	image, err := ri.open()
+	if err != nil {
+		return k8s.VolumeObjects{}
+	}
+	defer image.Close()
+
+	metadata := map[string]string{}
+	for _, key := range k8s.GetVolumeMetadataKeys() {
+		value, err := image.GetMetadata(key)
+		if err == nil {
+			metadata[key] = value
+		}
+	}
+
+	return k8s.GetVolumeObjects(metadata)
+}
+
+// volumeEvent posts an event on the Kubernetes objects of the image.
+func (ri *rbdImage) volumeEvent(ctx context.Context, eventType, reason, messageFmt string, args ...any) {
+	ri.volumeObjects().Event(ctx, eventType, reason, messageFmt, args...)
+}
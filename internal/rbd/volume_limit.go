@@ -0,0 +1,215 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+const (
+	procDevicesFile = "/proc/devices"
+	procMeminfoFile = "/proc/meminfo"
+	// krbdSingleMajorFile is set to Y when all krbd devices share a single
+	// major number
+	krbdSingleMajorFile = "/sys/module/rbd/parameters/single_major"
+	nbdsMaxFile         = "/sys/module/nbd/parameters/nbds_max"
+	cgroupV2MemoryFile  = "/sys/fs/cgroup/memory.max"
+	cgroupV1MemoryFile  = "/sys/fs/cgroup/memory/memory.limit_in_bytes"
+
+	// krbdSingleMajorDevices is the number of krbd devices with the
+	// single_major parameter, the minor numbers of a major are shared by
+	// the devices and their 16 partitions.
+	krbdSingleMajorDevices = 1 << 16
+	// maxDynamicMajor is the highest major number that the kernel assigns
+	// to drivers like krbd that do not have a fixed major number.
+	maxDynamicMajor = 254
+	// nbdVolumeMemoryBytes is the memory that is accounted for every
+	// rbd-nbd volume of the node, for the rbd-nbd process and the buffers
+	// of the device. krbd devices are mapped by the kernel.
+	nbdVolumeMemoryBytes = 64 * helpers.MiB
+)
+
+// MaxVolumesPerNode returns the number of volumes that can be staged on the
+// node. It is the number of krbd and nbd devices that can be mapped, the nbd
+// devices are limited by the memory of the node (or of the cgroup of the
+// nodeplugin, which runs the rbd-nbd processes).
+func MaxVolumesPerNode() (int64, error) {
+	krbd, err := krbdMaxDevices()
+	if err != nil {
+		return 0, err
+	}
+
+	nbd, err := readUintFile(nbdsMaxFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	memory, err := nodeMemory()
+	if err != nil {
+		return 0, err
+	}
+
+	limit := nodeVolumeLimit(krbd, int64(nbd), memory)
+	log.DefaultLog("node can stage %d volumes (%d krbd devices, %d nbd devices, %d bytes of memory)",
+		limit, krbd, nbd, memory)
+
+	return limit, nil
+}
+
+// nodeVolumeLimit returns the number of volumes for the number of krbd and
+// nbd devices that can be mapped and the available memory. Only the rbd-nbd
+// volumes need memory of the nodeplugin.
+func nodeVolumeLimit(krbd, nbd int64, memory uint64) int64 {
+	return max(krbd+min(nbd, int64(memory/nbdVolumeMemoryBytes)), 1)
+}
+
+// krbdMaxDevices returns the number of krbd devices that can be mapped. A
+// device needs its own major number, unless the rbd module uses a single
+// major number for all devices.
+func krbdMaxDevices() (int64, error) {
+	singleMajor, err := os.ReadFile(krbdSingleMajorFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	if strings.TrimSpace(string(singleMajor)) == "Y" {
+		return krbdSingleMajorDevices, nil
+	}
+
+	f, err := os.Open(procDevicesFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	used, err := usedBlockMajors(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", procDevicesFile, err)
+	}
+
+	return int64(maxDynamicMajor - used), nil
+}
+
+// usedBlockMajors returns the number of major numbers of block devices that
+// can not be assigned to krbd devices, from the contents of /proc/devices.
+// The major numbers of mapped krbd devices can be used again.
+func usedBlockMajors(r io.Reader) (int, error) {
+	used := 0
+	block := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasSuffix(line, ":"):
+			block = line == "Block devices:"
+
+			continue
+		case !block:
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("unexpected line %q", line)
+		}
+		major, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return 0, fmt.Errorf("unexpected line %q: %w", line, err)
+		}
+		if major >= 1 && major <= maxDynamicMajor && fields[1] != rbdDefaultMounter {
+			used++
+		}
+	}
+
+	return used, scanner.Err()
+}
+
+// nodeMemory returns the memory of the node, or the memory limit of the
+// cgroup when it is lower.
+func nodeMemory() (uint64, error) {
+	f, err := os.Open(procMeminfoFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	memory, err := parseMemTotal(f)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", procMeminfoFile, err)
+	}
+
+	for _, file := range []string{cgroupV2MemoryFile, cgroupV1MemoryFile} {
+		limit, err := readUintFile(file)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) || errors.Is(err, strconv.ErrSyntax) {
+				// no cgroup limit ("max" with cgroup v2)
+				continue
+			}
+
+			return 0, err
+		}
+
+		memory = min(memory, limit)
+	}
+
+	return memory, nil
+}
+
+// parseMemTotal returns the MemTotal in bytes from the contents of
+// /proc/meminfo.
+func parseMemTotal(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "MemTotal:" || fields[2] != "kB" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemTotal %q: %w", fields[1], err)
+		}
+
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, errors.New("MemTotal not found")
+}
+
+// readUintFile reads a file that contains a number.
+func readUintFile(file string) (uint64, error) {
+	data, err := os.ReadFile(file) // #nosec:G304, file is one of the constants above
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/cloud-provider/volume/helpers"
+)
+
+func TestUsedBlockMajors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		devices string
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "character and block devices",
+			devices: `Character devices:
+  1 mem
+  4 tty
+
+Block devices:
+  7 loop
+  8 sd
+252 rbd
+253 device-mapper
+254 mdp
+259 blkext
+`,
+			// 259 is above the dynamic range, rbd majors can be reused
+			want: 4,
+		},
+		{
+			name:    "no block devices",
+			devices: "Character devices:\n  1 mem\n",
+			want:    0,
+		},
+		{
+			name:    "invalid major",
+			devices: "Block devices:\nx loop\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := usedBlockMajors(strings.NewReader(tt.devices))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseMemTotal(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		meminfo string
+		want    uint64
+		wantErr bool
+	}{
+		{
+			name:    "MemTotal",
+			meminfo: "MemTotal:        8041604 kB\nMemFree:          316448 kB\n",
+			want:    8041604 * 1024,
+		},
+		{
+			name:    "missing MemTotal",
+			meminfo: "MemFree:          316448 kB\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid MemTotal",
+			meminfo: "MemTotal:        8G kB\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseMemTotal(strings.NewReader(tt.meminfo))
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNodeVolumeLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		krbd   int64
+		nbd    int64
+		memory uint64
+		want   int64
+	}{
+		{
+			name:   "krbd devices without memory bound",
+			krbd:   krbdSingleMajorDevices,
+			memory: 4 * helpers.GiB,
+			want:   krbdSingleMajorDevices,
+		},
+		{
+			name:   "nbd devices limited by memory",
+			krbd:   40,
+			nbd:    256,
+			memory: 4 * helpers.GiB,
+			want:   40 + 64,
+		},
+		{
+			name:   "limited by devices",
+			krbd:   40,
+			nbd:    16,
+			memory: 16 * helpers.GiB,
+			want:   56,
+		},
+		{
+			name:   "nbd devices without memory",
+			nbd:    16,
+			memory: helpers.MiB,
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, nodeVolumeLimit(tt.krbd, tt.nbd, tt.memory))
+		})
+	}
+}
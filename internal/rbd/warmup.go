@@ -0,0 +1,140 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rbd/admin"
+)
+
+const (
+	// cloneWarmupParam is the StorageClass parameter that selects how the
+	// data of the parent is copied into volumes that are created from a
+	// snapshot, another volume or a source image.
+	cloneWarmupParam = "cloneWarmup"
+
+	// warmupCopyOnRead copies the objects of the parent into the image
+	// when they are read for the first time, so that following reads of
+	// the hot extents are served by the image. Only librbd copies up on
+	// read, it requires the rbd-nbd mounter.
+	warmupCopyOnRead = "copy-on-read"
+	// warmupFlatten copies all data of the parent into the image in the
+	// background, with a flatten task of the Ceph manager.
+	warmupFlatten = "flatten"
+
+	// warmupMetaKey contains the warmup mode of the image.
+	warmupMetaKey = "rbd.csi.ceph.com/warmup"
+	// warmupStartedMetaKey contains the time the warmup was started.
+	warmupStartedMetaKey = "rbd.csi.ceph.com/warmup-started"
+	// warmupTaskMetaKey contains the ID of the flatten task of the Ceph
+	// manager, its progress is listed by `ceph rbd task list`.
+	warmupTaskMetaKey = "rbd.csi.ceph.com/warmup-task"
+
+	// copyOnReadOption is the librbd option that copies up the objects of
+	// the parent on read.
+	copyOnReadOption = "rbd_clone_copy_on_read"
+)
+
+// validateCloneWarmup checks the value of the cloneWarmup parameter. The
+// copy-on-read mode is only supported with the rbd-nbd mounter, krbd
+// ignores the librbd option.
+func validateCloneWarmup(mode, mounter string) error {
+	switch mode {
+	case "", warmupFlatten:
+		return nil
+	case warmupCopyOnRead:
+		if mounter != rbdNbdMounter {
+			return fmt.Errorf("%s %q is only supported with the %q mounter",
+				cloneWarmupParam, mode, rbdNbdMounter)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("invalid %s %q, supported are %q and %q",
+		cloneWarmupParam, mode, warmupCopyOnRead, warmupFlatten)
+}
+
+// startWarmup starts the warmup of a volume that was cloned, and records it
+// in the image metadata. Failures do not affect the volume, the data is
+// still read from the parent then.
+func (rv *rbdVolume) startWarmup(ctx context.Context) error {
+	if rv.CloneWarmup == "" {
+		return nil
+	}
+
+	err := rv.SetMetadata(warmupMetaKey, rv.CloneWarmup)
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", warmupMetaKey, rv, err)
+	}
+	err = rv.SetMetadata(warmupStartedMetaKey, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", warmupStartedMetaKey, rv, err)
+	}
+
+	switch rv.CloneWarmup {
+	case warmupCopyOnRead:
+		// image metadata with the prefix overrides the client option
+		err = rv.SetMetadata(imageConfigMetaPrefix+copyOnReadOption, "true")
+		if err != nil {
+			return fmt.Errorf("failed to enable %s on %q: %w", copyOnReadOption, rv, err)
+		}
+	case warmupFlatten:
+		return rv.queueWarmupFlatten(ctx)
+	}
+
+	log.DebugLog(ctx, "started %s warmup of %s", rv.CloneWarmup, rv)
+
+	return nil
+}
+
+// queueWarmupFlatten adds a task to flatten the image to the Ceph manager,
+// which runs the flatten in the background. The volume can be used while
+// it is flattened.
+func (rv *rbdVolume) queueWarmupFlatten(ctx context.Context) error {
+	ta, err := rv.conn.GetTaskAdmin()
+	if err != nil {
+		return err
+	}
+
+	task, err := ta.AddFlatten(admin.NewImageSpec(rv.Pool, rv.RadosNamespace, rv.RbdImageName))
+	if !isCephMgrSupported(ctx, rv.ClusterID, err) {
+		return fmt.Errorf("the Ceph manager can not flatten %q: %w", rv, err)
+	}
+	if err != nil {
+		// a clone of a flattened image has no parent
+		if strings.Contains(err.Error(), "does not have a parent") {
+			return nil
+		}
+
+		return fmt.Errorf("failed to add task to flatten %q: %w", rv, err)
+	}
+
+	err = rv.SetMetadata(warmupTaskMetaKey, task.ID)
+	if err != nil {
+		return fmt.Errorf("failed to set metadata key %q on %q: %w", warmupTaskMetaKey, rv, err)
+	}
+	log.DebugLog(ctx, "added task %s to flatten %s for the warmup", task.ID, rv)
+
+	return nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCloneWarmup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mode    string
+		mounter string
+		wantErr bool
+	}{
+		{
+			name: "disabled",
+			mode: "",
+		},
+		{
+			name:    "copy on read with rbd-nbd",
+			mode:    warmupCopyOnRead,
+			mounter: rbdNbdMounter,
+		},
+		{
+			name:    "copy on read with krbd",
+			mode:    warmupCopyOnRead,
+			mounter: rbdDefaultMounter,
+			wantErr: true,
+		},
+		{
+			name:    "copy on read with default mounter",
+			mode:    warmupCopyOnRead,
+			wantErr: true,
+		},
+		{
+			name:    "copy on read with auto mounter",
+			mode:    warmupCopyOnRead,
+			mounter: rbdAutoMounter,
+			wantErr: true,
+		},
+		{
+			name: "flatten",
+			mode: warmupFlatten,
+		},
+		{
+			name:    "flatten with krbd",
+			mode:    warmupFlatten,
+			mounter: rbdDefaultMounter,
+		},
+		{
+			name:    "unknown mode",
+			mode:    "prefetch",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := validateCloneWarmup(tt.mode, tt.mounter)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
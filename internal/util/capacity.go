@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// dfOutput contains the pool statistics of `ceph df --format=json`.
+type dfOutput struct {
+	Pools []struct {
+		Name  string `json:"name"`
+		Stats struct {
+			MaxAvail int64 `json:"max_avail"`
+		} `json:"stats"`
+	} `json:"pools"`
+}
+
+// parsePoolMaxAvail returns the max_avail of the pool from the output of
+// `ceph df --format=json`.
+func parsePoolMaxAvail(output []byte, pool string) (int64, error) {
+	df := &dfOutput{}
+	if err := json.Unmarshal(output, df); err != nil {
+		return 0, fmt.Errorf("failed to parse ceph df output: %w", err)
+	}
+
+	for _, p := range df.Pools {
+		if p.Name == pool {
+			return p.Stats.MaxAvail, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: %s", ErrPoolNotFound, pool)
+}
+
+// GetPoolMaxAvail returns the number of bytes that can still be stored in the
+// pool. Ceph calculates the value from the fullest OSD of the CRUSH rule and
+// divides it by the replication factor (or the erasure coding overhead) of
+// the pool, a quota on the pool limits the value too.
+func (cc *ClusterConnection) GetPoolMaxAvail(pool string) (int64, error) {
+	cmd, err := json.Marshal(map[string]string{
+		"prefix": "df",
+		"format": "json",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode df command: %w", err)
+	}
+
+	output, err := cc.MonCommand(cmd)
+	if err != nil {
+		return 0, err
+	}
+
+	return parsePoolMaxAvail(output, pool)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePoolMaxAvail(t *testing.T) {
+	t.Parallel()
+
+	output := []byte(`{
+	"stats": {"total_bytes": 322122547200, "total_avail_bytes": 321048805376},
+	"pools": [
+		{"name": ".mgr", "id": 1, "stats": {"stored": 459280, "max_avail": 101662490624}},
+		{"name": "replicapool", "id": 2, "stats": {"stored": 1073741824, "max_avail": 101662490624}},
+		{"name": "ec-data", "id": 3, "stats": {"stored": 0, "max_avail": 203324981248}}
+	]
+}`)
+
+	tests := []struct {
+		name    string
+		output  []byte
+		pool    string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name:   "replicated pool",
+			output: output,
+			pool:   "replicapool",
+			want:   101662490624,
+		},
+		{
+			name:   "erasure coded pool",
+			output: output,
+			pool:   "ec-data",
+			want:   203324981248,
+		},
+		{
+			name:    "missing pool",
+			output:  output,
+			pool:    "unknown",
+			wantErr: true,
+		},
+		{
+			name:    "invalid output",
+			output:  []byte("not json"),
+			pool:    "replicapool",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parsePoolMaxAvail(tt.output, tt.pool)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
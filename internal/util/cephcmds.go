@@ -27,6 +27,7 @@ import (
 
 	"github.com/ceph/ceph-csi/internal/util/log"
 	"github.com/ceph/ceph-csi/internal/util/stripsecrets"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/ceph/go-ceph/rados"
 )
@@ -37,15 +38,22 @@ const InvalidPoolID int64 = -1
 // ExecuteCommandWithNSEnter executes passed in program with args with nsenter
 // and returns separate stdout and stderr streams. In case ctx is not set to
 // context.TODO(), the command will be logged after it was executed.
-func ExecuteCommandWithNSEnter(ctx context.Context, netPath, program string, args ...string) (string, string, error) {
+func ExecuteCommandWithNSEnter(
+	ctx context.Context,
+	netPath, program string,
+	args ...string,
+) (stdout, stderr string, err error) {
 	var (
 		stdoutBuf bytes.Buffer
 		stderrBuf bytes.Buffer
 		nsenter   = "nsenter"
 	)
 
+	_, span := tracing.StartSpan(ctx, "exec "+program)
+	defer func() { tracing.EndSpan(span, err) }()
+
 	// check netPath exists
-	if _, err := os.Stat(netPath); err != nil {
+	if _, err = os.Stat(netPath); err != nil {
 		return "", "", fmt.Errorf("failed to get stat for %s %w", netPath, err)
 	}
 	//  nsenter --net=%s -- <program> <args>
@@ -55,9 +63,9 @@ func ExecuteCommandWithNSEnter(ctx context.Context, netPath, program string, arg
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
-	err := cmd.Run()
-	stdout := stdoutBuf.String()
-	stderr := stderrBuf.String()
+	err = cmd.Run()
+	stdout = stdoutBuf.String()
+	stderr = stderrBuf.String()
 
 	if err != nil {
 		err = fmt.Errorf("an error (%w) occurred while running %s args: %v", err, nsenter, sanitizedArgs)
@@ -78,7 +86,7 @@ func ExecuteCommandWithNSEnter(ctx context.Context, netPath, program string, arg
 // ExecCommand executes passed in program with args and returns separate stdout
 // and stderr streams. In case ctx is not set to context.TODO(), the command
 // will be logged after it was executed.
-func ExecCommand(ctx context.Context, program string, args ...string) (string, string, error) {
+func ExecCommand(ctx context.Context, program string, args ...string) (stdout, stderr string, err error) {
 	var (
 		cmd           = exec.Command(program, args...) // #nosec:G204, commands executing not vulnerable.
 		sanitizedArgs = stripsecrets.InArgs(args)
@@ -86,12 +94,15 @@ func ExecCommand(ctx context.Context, program string, args ...string) (string, s
 		stderrBuf     bytes.Buffer
 	)
 
+	_, span := tracing.StartSpan(ctx, "exec "+program)
+	defer func() { tracing.EndSpan(span, err) }()
+
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
-	err := cmd.Run()
-	stdout := stdoutBuf.String()
-	stderr := stderrBuf.String()
+	err = cmd.Run()
+	stdout = stdoutBuf.String()
+	stderr = stderrBuf.String()
 
 	if err != nil {
 		err = fmt.Errorf("an error (%w) occurred while running %s args: %v", err, program, sanitizedArgs)
@@ -118,9 +129,9 @@ func ExecCommandWithTimeout(
 	timeout time.Duration,
 	program string,
 	args ...string) (
-	string,
-	string,
-	error,
+	stdout string,
+	stderr string,
+	err error,
 ) {
 	var (
 		sanitizedArgs = stripsecrets.InArgs(args)
@@ -128,6 +139,9 @@ func ExecCommandWithTimeout(
 		stderrBuf     bytes.Buffer
 	)
 
+	_, span := tracing.StartSpan(ctx, "exec "+program)
+	defer func() { tracing.EndSpan(span, err) }()
+
 	cctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
@@ -135,9 +149,9 @@ func ExecCommandWithTimeout(
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
-	err := cmd.Run()
-	stdout := stdoutBuf.String()
-	stderr := stderrBuf.String()
+	err = cmd.Run()
+	stdout = stdoutBuf.String()
+	stderr = stderrBuf.String()
 	if err != nil {
 		// if its a timeout log return context deadline exceeded error message
 		if errors.Is(cctx.Err(), context.DeadlineExceeded) {
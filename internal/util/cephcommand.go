@@ -0,0 +1,163 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
+	"github.com/ceph/go-ceph/cephfs"
+)
+
+// CephCommand is a command for the Ceph monitors or an MDS. It is sent with
+// the librados connection, the `ceph` CLI is only used as fallback when the
+// library can not send the command.
+type CephCommand struct {
+	// Name identifies the command in logs and metrics, like
+	// "osd blocklist add"
+	Name string
+	// MDS is the name of the MDS that receives the command, like "0" for
+	// rank 0. The command is sent to the monitors when it is empty.
+	MDS string
+	// Command contains the JSON formatted command, including the "prefix"
+	Command map[string]any
+	// Args are the arguments of the `ceph` CLI command with the same
+	// effect, without the credentials and monitors. There is no fallback
+	// when Args is empty.
+	Args []string
+}
+
+// CommandError is returned when a Ceph command fails. The Errno can be
+// checked with errors.Is, like errors.Is(err, syscall.EINVAL) for a command
+// that the cluster does not know.
+type CommandError struct {
+	// Name is the name of the CephCommand
+	Name string
+	// Errno is the error that the daemon or the CLI returned
+	Errno syscall.Errno
+	// Status is the status message of the daemon, or the stderr of the CLI
+	Status string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("ceph command %q failed: %v (%s)", e.Name, e.Errno, e.Status)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Errno
+}
+
+// errLibraryUnavailable is returned when the library can not send the
+// command, the CLI is used as fallback then.
+var errLibraryUnavailable = errors.New("library can not send the command")
+
+// newCommandError returns a CommandError for the error of a go-ceph call.
+// Errors without error code are returned unchanged.
+func newCommandError(name string, err error, status string) error {
+	var ec interface{ ErrorCode() int }
+	if errors.As(err, &ec) && ec.ErrorCode() < 0 {
+		return &CommandError{Name: name, Errno: syscall.Errno(-ec.ErrorCode()), Status: status}
+	}
+
+	return fmt.Errorf("ceph command %q failed: %w (%s)", name, err, status)
+}
+
+// RunCephCommand sends the command to the cluster of the connection, and
+// returns its output.
+func RunCephCommand(ctx context.Context, cc *ClusterConnection, cmd *CephCommand) ([]byte, error) {
+	buf, err := json.Marshal(cmd.Command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ceph command %q: %w", cmd.Name, err)
+	}
+
+	if cmd.MDS == "" {
+		out, status, monErr := metrics.NewCountingCommander(cc.conn).MonCommand(buf)
+		if monErr != nil {
+			return nil, newCommandError(cmd.Name, monErr, status)
+		}
+
+		return out, nil
+	}
+
+	out, err := cc.mdsCommand(cmd, buf)
+	if !errors.Is(err, errLibraryUnavailable) || len(cmd.Args) == 0 {
+		return out, err
+	}
+
+	log.WarningLog(ctx, "running ceph command %q with the CLI: %v", cmd.Name, err)
+	metrics.CountCommandFallback(cmd.Name)
+
+	return runCephCLI(ctx, cc, cmd)
+}
+
+// mdsCommand sends the command to the MDS with libcephfs.
+func (cc *ClusterConnection) mdsCommand(cmd *CephCommand, buf []byte) ([]byte, error) {
+	if cc.conn == nil {
+		return nil, errors.New("cluster is not connected yet")
+	}
+
+	mount, err := cephfs.CreateFromRados(cc.conn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errLibraryUnavailable, err)
+	}
+	defer mount.Release() //nolint:errcheck // the mount was not used, nothing to clean up
+
+	if err = mount.Init(); err != nil {
+		return nil, fmt.Errorf("%w: %w", errLibraryUnavailable, err)
+	}
+
+	out, status, err := mount.MdsCommand(cmd.MDS, [][]byte{buf})
+	if err != nil {
+		return nil, newCommandError(cmd.Name, err, status)
+	}
+
+	return out, nil
+}
+
+// runCephCLI runs the command with the `ceph` CLI, the exit status of the CLI
+// is the errno of the failed command.
+func runCephCLI(ctx context.Context, cc *ClusterConnection, cmd *CephCommand) ([]byte, error) {
+	if cc.Creds == nil {
+		return nil, fmt.Errorf("ceph command %q needs credentials for the CLI", cmd.Name)
+	}
+
+	monitors, err := cc.conn.GetConfigOption("mon_host")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the monitors for ceph command %q: %w", cmd.Name, err)
+	}
+
+	args := append([]string{}, cmd.Args...)
+	args = append(args, "--id", cc.Creds.ID, "--keyfile="+cc.Creds.KeyFile, "-m", monitors)
+	stdout, stderr, err := ExecCommand(ctx, "ceph", args...)
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+			return nil, &CommandError{Name: cmd.Name, Errno: syscall.Errno(exitErr.ExitCode()), Status: stderr}
+		}
+
+		return nil, fmt.Errorf("ceph command %q failed: %w (%s)", cmd.Name, err, stderr)
+	}
+
+	return []byte(stdout), nil
+}
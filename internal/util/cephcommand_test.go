@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type errorCodeError int
+
+func (e errorCodeError) Error() string {
+	return "go-ceph error"
+}
+
+func (e errorCodeError) ErrorCode() int {
+	return int(e)
+}
+
+func TestNewCommandError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		err       error
+		wantErrno syscall.Errno
+	}{
+		{
+			name:      "invalid command",
+			err:       errorCodeError(-int(syscall.EINVAL)),
+			wantErrno: syscall.EINVAL,
+		},
+		{
+			name:      "wrapped error code",
+			err:       errors.Join(errors.New("context"), errorCodeError(-int(syscall.ENOENT))),
+			wantErrno: syscall.ENOENT,
+		},
+		{
+			name:      "no error code",
+			err:       errors.New("no error code"),
+			wantErrno: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := newCommandError("osd blocklist add", tt.err, "status")
+
+			var cmdErr *CommandError
+			if tt.wantErrno == 0 {
+				require.ErrorIs(t, err, tt.err)
+				require.False(t, errors.As(err, &cmdErr))
+
+				return
+			}
+			require.ErrorAs(t, err, &cmdErr)
+			require.ErrorIs(t, err, tt.wantErrno)
+			require.Equal(t, "status", cmdErr.Status)
+		})
+	}
+}
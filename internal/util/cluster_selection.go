@@ -0,0 +1,133 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+const (
+	// ClusterIDsKey is the name of the parameter with an ordered list of
+	// clusterIDs to provision volumes on.
+	ClusterIDsKey = "clusterIDs"
+
+	// clusterQuorumTimeout is the time the monitors of a cluster have to
+	// report their quorum.
+	clusterQuorumTimeout = 5 * time.Second
+)
+
+// ErrNoHealthyCluster is returned when none of the clusters to select from is
+// healthy.
+var ErrNoHealthyCluster = errors.New("no healthy cluster")
+
+// GetClusterIDs returns the clusterIDs of the comma separated ClusterIDsKey
+// parameter, in the order of the parameter.
+func GetClusterIDs(options map[string]string) []string {
+	clusterIDs := []string{}
+	for _, clusterID := range strings.Split(options[ClusterIDsKey], ",") {
+		clusterID = strings.TrimSpace(clusterID)
+		if clusterID != "" {
+			clusterIDs = append(clusterIDs, clusterID)
+		}
+	}
+
+	return clusterIDs
+}
+
+// SelectCluster returns the first of the clusterIDs for which check does not
+// return an error. A cluster that passes the check and for which reserved
+// returns true is preferred, it contains the volume of an earlier request
+// already. The reservations of the clusters that do not pass the check can
+// not be looked up.
+func SelectCluster(
+	ctx context.Context,
+	clusterIDs []string,
+	check func(ctx context.Context, clusterID string) error,
+	reserved func(ctx context.Context, clusterID string) (bool, error),
+) (string, error) {
+	selected := ""
+	errs := []error{}
+	for _, clusterID := range clusterIDs {
+		err := check(ctx, clusterID)
+		if err != nil {
+			log.WarningLog(ctx, "skipping cluster %q: %v", clusterID, err)
+			errs = append(errs, fmt.Errorf("cluster %q: %w", clusterID, err))
+
+			continue
+		}
+
+		found, err := reserved(ctx, clusterID)
+		if err != nil {
+			return "", fmt.Errorf("failed to look up the reservation in cluster %q: %w", clusterID, err)
+		}
+		if found {
+			return clusterID, nil
+		}
+
+		if selected == "" {
+			selected = clusterID
+		}
+	}
+
+	if selected == "" {
+		return "", fmt.Errorf("%w out of %v: %w", ErrNoHealthyCluster, clusterIDs, errors.Join(errs...))
+	}
+
+	return selected, nil
+}
+
+// CheckClusterQuorum checks that the monitors of the cluster have quorum, by
+// requesting the quorum status. A cluster that does not answer within a few
+// seconds is not healthy. The request keeps running in the background until
+// librados returns, it can not be interrupted.
+func CheckClusterQuorum(ctx context.Context, monitors string, cr *Credentials) error {
+	done := make(chan error, 1)
+	go func() {
+		conn := &ClusterConnection{}
+		err := conn.Connect(monitors, cr)
+		if err != nil {
+			done <- err
+
+			return
+		}
+		defer conn.Destroy()
+
+		_, _, err = conn.conn.MonCommand([]byte(`{"prefix":"quorum_status","format":"json"}`))
+		if errors.Is(err, rados.ErrPermissionDenied) {
+			// the monitors answered, so they have quorum
+			err = nil
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(clusterQuorumTimeout):
+		return fmt.Errorf("monitors %s did not report their quorum within %v", monitors, clusterQuorumTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetClusterIDs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options map[string]string
+		want    []string
+	}{
+		{
+			name:    "not set",
+			options: map[string]string{ClusterIDKey: "cluster-1"},
+			want:    []string{},
+		},
+		{
+			name:    "single cluster",
+			options: map[string]string{ClusterIDsKey: "cluster-1"},
+			want:    []string{"cluster-1"},
+		},
+		{
+			name:    "ordered list with spaces",
+			options: map[string]string{ClusterIDsKey: "cluster-2, cluster-1,,cluster-3 "},
+			want:    []string{"cluster-2", "cluster-1", "cluster-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, GetClusterIDs(tt.options))
+		})
+	}
+}
+
+func TestSelectCluster(t *testing.T) {
+	t.Parallel()
+
+	errUnhealthy := errors.New("no quorum")
+	healthy := func(healthy ...string) func(context.Context, string) error {
+		return func(_ context.Context, clusterID string) error {
+			for _, h := range healthy {
+				if h == clusterID {
+					return nil
+				}
+			}
+
+			return errUnhealthy
+		}
+	}
+
+	errLookup := errors.New("lookup failed")
+	reserved := func(clusterID string, err error) func(context.Context, string) (bool, error) {
+		return func(_ context.Context, c string) (bool, error) {
+			return c == clusterID, err
+		}
+	}
+
+	tests := []struct {
+		name     string
+		check    func(context.Context, string) error
+		reserved func(context.Context, string) (bool, error)
+		want     string
+		wantErr  error
+	}{
+		{
+			name:     "first cluster healthy",
+			check:    healthy("cluster-1", "cluster-2"),
+			reserved: reserved("", nil),
+			want:     "cluster-1",
+		},
+		{
+			name:     "fail over to the next cluster",
+			check:    healthy("cluster-3"),
+			reserved: reserved("", nil),
+			want:     "cluster-3",
+		},
+		{
+			name:     "volume reserved in a later cluster",
+			check:    healthy("cluster-1", "cluster-2"),
+			reserved: reserved("cluster-2", nil),
+			want:     "cluster-2",
+		},
+		{
+			name:     "reservation in an unhealthy cluster",
+			check:    healthy("cluster-2", "cluster-3"),
+			reserved: reserved("cluster-1", nil),
+			want:     "cluster-2",
+		},
+		{
+			name:     "reservation can not be looked up",
+			check:    healthy("cluster-1"),
+			reserved: reserved("", errLookup),
+			wantErr:  errLookup,
+		},
+		{
+			name:     "no healthy cluster",
+			check:    healthy(),
+			reserved: reserved("", nil),
+			wantErr:  ErrNoHealthyCluster,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clusterID, err := SelectCluster(context.TODO(), []string{"cluster-1", "cluster-2", "cluster-3"},
+				tt.check, tt.reserved)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				if errors.Is(tt.wantErr, ErrNoHealthyCluster) {
+					require.ErrorIs(t, err, errUnhealthy)
+				}
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, clusterID)
+		})
+	}
+}
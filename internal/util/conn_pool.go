@@ -17,18 +17,63 @@ limitations under the License.
 package util
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
 	"github.com/ceph/go-ceph/rados"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// connProbeInterval is the interval to check the health of the
+	// connections in the pool.
+	connProbeInterval = time.Minute
+	// connProbeTimeout is the time a connection has to respond to a probe
+	// before it is considered unhealthy.
+	connProbeTimeout = 10 * time.Second
+	// connectAttempts is the number of attempts to connect to the cluster.
+	connectAttempts = 3
+	// connectBackoff is the delay before the 2nd attempt to connect, it
+	// doubles with every attempt and gets a random jitter added.
+	connectBackoff = 500 * time.Millisecond
+)
+
+var (
+	errProbeTimeout = errors.New("connection did not respond to the probe in time")
+
+	connectionsDesc = prometheus.NewDesc(
+		"csi_connection_pool_connections",
+		"Number of connections to Ceph clusters in the pool, by state",
+		[]string{"state"}, nil)
+	connectionAgeDesc = prometheus.NewDesc(
+		"csi_connection_pool_oldest_connection_seconds",
+		"Age of the oldest connection to a Ceph cluster in the pool",
+		nil, nil)
+	probeFailuresDesc = prometheus.NewDesc(
+		"csi_connection_pool_probe_failures_total",
+		"Number of connections that failed the health probe and were replaced",
+		nil, nil)
 )
 
 type connEntry struct {
-	conn     *rados.Conn
-	lastUsed time.Time
-	users    int
+	conn      *rados.Conn
+	user      string
+	created   time.Time
+	lastUsed  time.Time
+	lastProbe time.Time
+	users     int
+	// probing is set while the health of the connection is checked
+	probing bool
+	// expired connections are destroyed as soon as they are not used
+	expired bool
 }
 
 // ConnPool is the struct which contains details of connection entries in the pool and gc controlled params.
@@ -39,26 +84,53 @@ type ConnPool struct {
 	expiry time.Duration
 	// Timer used to schedule calls to the garbage collector
 	timer *time.Timer
+	// interval to check the health of the connections
+	probeInterval time.Duration
+	// time a connection has to respond to a probe
+	probeTimeout time.Duration
+	// Timer used to schedule the health probes
+	probeTimer *time.Timer
+	// probe checks the health of a connection
+	probe func(conn *rados.Conn) error
 	// Mutex for loading and touching connEntry's from the conns Map
 	lock *sync.RWMutex
 	// all connEntry's in this pool
 	conns map[string]*connEntry
+	// number of connections that failed the health probe
+	probeFailures uint64
 }
 
 // NewConnPool creates a new connection pool instance and start the garbage collector running
-// every @interval.
+// every @interval. The health of the connections is checked every minute,
+// unhealthy connections are replaced by new ones.
 func NewConnPool(interval, expiry time.Duration) *ConnPool {
 	cp := ConnPool{
-		interval: interval,
-		expiry:   expiry,
-		lock:     &sync.RWMutex{},
-		conns:    make(map[string]*connEntry),
+		interval:      interval,
+		expiry:        expiry,
+		probeInterval: connProbeInterval,
+		probeTimeout:  connProbeTimeout,
+		probe:         probeConn,
+		lock:          &sync.RWMutex{},
+		conns:         make(map[string]*connEntry),
 	}
 	cp.timer = time.AfterFunc(interval, cp.gc)
+	cp.probeTimer = time.AfterFunc(cp.probeInterval, cp.probeAll)
 
 	return &cp
 }
 
+// probeConn checks that the connection can talk to the Ceph monitors. A
+// denied request is an answer of the monitors too, so the connection is
+// healthy in that case.
+func probeConn(conn *rados.Conn) error {
+	_, err := conn.GetClusterStats()
+	if errors.Is(err, rados.ErrPermissionDenied) {
+		return nil
+	}
+
+	return err
+}
+
 // loop through all cp.conns and destroy objects that have not been used for cp.expiry.
 func (cp *ConnPool) gc() {
 	cp.lock.Lock()
@@ -66,7 +138,7 @@ func (cp *ConnPool) gc() {
 
 	now := time.Now()
 	for key, ce := range cp.conns {
-		if ce.users == 0 && (now.Sub(ce.lastUsed)) > cp.expiry {
+		if ce.users == 0 && (ce.expired || now.Sub(ce.lastUsed) > cp.expiry) {
 			ce.destroy()
 			delete(cp.conns, key)
 		}
@@ -76,9 +148,102 @@ func (cp *ConnPool) gc() {
 	cp.timer.Reset(cp.interval)
 }
 
+// probeAll checks the health of the connections that have not been probed
+// for cp.probeInterval. The probes run without holding cp.lock, so that a
+// hanging connection does not block the other users of the pool.
+func (cp *ConnPool) probeAll() {
+	cp.lock.Lock()
+	now := time.Now()
+	probes := []*connEntry{}
+	for _, ce := range cp.conns {
+		if ce.expired || ce.probing || now.Sub(ce.lastProbe) < cp.probeInterval {
+			continue
+		}
+
+		// the probe holds a reference, so that the connection is not
+		// destroyed while it is checked
+		ce.probing = true
+		ce.users++
+		probes = append(probes, ce)
+	}
+	cp.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, ce := range probes {
+		wg.Add(1)
+		go func(ce *connEntry) {
+			defer wg.Done()
+			cp.probeEntry(ce)
+		}(ce)
+	}
+	wg.Wait()
+
+	// schedule the next probeAll() run
+	cp.probeTimer.Reset(cp.probeInterval)
+}
+
+// probeEntry checks the health of the connection of the connEntry, and
+// expires it when the probe fails or does not return within cp.probeTimeout.
+// Users that hold the connection can continue to use it, new users get a new
+// connection.
+//
+// Requires: a reference to the connEntry that is held for the probe.
+func (cp *ConnPool) probeEntry(ce *connEntry) {
+	done := make(chan error, 1)
+	go func() {
+		done <- cp.probe(ce.conn)
+	}()
+
+	var err error
+	timedOut := false
+	select {
+	case err = <-done:
+	case <-time.After(cp.probeTimeout):
+		err = errProbeTimeout
+		timedOut = true
+	}
+
+	cp.lock.Lock()
+	ce.lastProbe = time.Now()
+	if err != nil {
+		log.WarningLogMsg("connection of user %q failed the health probe and is replaced: %v", ce.user, err)
+		cp.probeFailures++
+		cp.expireEntry(ce)
+	}
+	cp.lock.Unlock()
+
+	if timedOut {
+		// the connection can only be destroyed once the probe returned
+		<-done
+	}
+
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+	ce.probing = false
+	cp.putEntry(ce)
+}
+
+// expireEntry marks the connEntry as expired. It is removed from the unique
+// key in cp.conns, so that a new connection can be added for it, and is
+// destroyed once the remaining users returned it.
+//
+// Requires: locked cp.lock.
+func (cp *ConnPool) expireEntry(ce *connEntry) {
+	ce.expired = true
+	for key, entry := range cp.conns {
+		if entry == ce {
+			delete(cp.conns, key)
+			cp.conns[fmt.Sprintf("%s|expired-%p", key, ce)] = ce
+
+			return
+		}
+	}
+}
+
 // Destroy stops the garbage collector and destroys all connections in the pool.
 func (cp *ConnPool) Destroy() {
 	cp.timer.Stop()
+	cp.probeTimer.Stop()
 	// wait until gc() has finished, in case it is running
 	cp.lock.Lock()
 	defer cp.lock.Unlock()
@@ -134,30 +299,19 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 		return conn, nil
 	}
 
-	// construct and connect a new rados.Conn
-	args := []string{"-m", monitors, "--keyfile=" + keyfile}
-	conn, err = rados.NewConnWithUser(user)
+	conn, err = cp.connect(monitors, user, keyfile)
 	if err != nil {
-		return nil, fmt.Errorf("creating a new connection failed: %w", err)
-	}
-	err = conn.ParseCmdLineArgs(args)
-	if err != nil {
-		return nil, fmt.Errorf("parsing cmdline args (%v) failed: %w", args, err)
-	}
-
-	if err = conn.ReadConfigFile(CephConfigPath); err != nil {
-		return nil, fmt.Errorf("failed to read config file %q: %w", CephConfigPath, err)
-	}
-
-	err = conn.Connect()
-	if err != nil {
-		return nil, fmt.Errorf("connecting failed: %w", err)
+		return nil, err
 	}
 
+	now := time.Now()
 	ce := &connEntry{
-		conn:     conn,
-		lastUsed: time.Now(),
-		users:    1,
+		conn:      conn,
+		user:      user,
+		created:   now,
+		lastUsed:  now,
+		lastProbe: now,
+		users:     1,
 	}
 
 	cp.lock.Lock()
@@ -174,6 +328,68 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 	return conn, nil
 }
 
+// connect constructs and connects a new rados.Conn. Failed attempts to
+// connect are retried with an exponential backoff and a random jitter, so
+// that the drivers do not reconnect all at the same time when the monitors
+// come back.
+func (cp *ConnPool) connect(monitors, user, keyfile string) (*rados.Conn, error) {
+	args := []string{"-m", monitors, "--keyfile=" + keyfile}
+	msMode := msModeForMonitors(CsiConfigFile, monitors)
+	args = append(args, msModeArgs(msMode)...)
+	backoff := connectBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := rados.NewConnWithUser(user)
+		if err != nil {
+			return nil, fmt.Errorf("creating a new connection failed: %w", err)
+		}
+		err = conn.ParseCmdLineArgs(args)
+		if err != nil {
+			return nil, fmt.Errorf("parsing cmdline args (%v) failed: %w", args, err)
+		}
+
+		if err = conn.ReadConfigFile(CephConfigPath); err != nil {
+			return nil, fmt.Errorf("failed to read config file %q: %w", CephConfigPath, err)
+		}
+
+		err = conn.Connect()
+		if err == nil {
+			if msMode != "" {
+				err = validateMsgr2(conn)
+				if err != nil {
+					conn.Shutdown()
+
+					return nil, err
+				}
+			}
+
+			return conn, nil
+		}
+		if attempt == connectAttempts {
+			return nil, fmt.Errorf("connecting failed after %d attempts: %w", attempt, err)
+		}
+
+		metrics.CountRetry("connect")
+		time.Sleep(backoff + rand.N(backoff)) // #nosec:G404, the jitter does not need a secure random number
+		backoff *= 2
+	}
+}
+
+// validateMsgr2 returns ErrMsgr2NotSupported when the monitors of the
+// connected cluster do not all have a messenger v2 address.
+func validateMsgr2(conn *rados.Conn) error {
+	cmd, err := json.Marshal(map[string]string{"prefix": "mon dump", "format": "json"})
+	if err != nil {
+		return err
+	}
+
+	dump, _, err := conn.MonCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to get the monitor map: %w", err)
+	}
+
+	return checkMsgr2(dump)
+}
+
 // Copy adds an extra reference count to the used ConnEntry and returns the
 // *rados.Conn if it was found.
 func (cp *ConnPool) Copy(conn *rados.Conn) *rados.Conn {
@@ -199,13 +415,99 @@ func (cp *ConnPool) Put(conn *rados.Conn) {
 
 	for _, ce := range cp.conns {
 		if ce.conn == conn {
-			ce.put()
+			cp.putEntry(ce)
+
+			return
+		}
+	}
+}
+
+// putEntry reduces the reference count of the connEntry, and destroys it when
+// it is expired and not used anymore.
+//
+// Requires: locked cp.lock.
+func (cp *ConnPool) putEntry(ce *connEntry) {
+	ce.put()
+	if ce.users != 0 || !ce.expired {
+		return
+	}
+
+	ce.destroy()
+	for key, entry := range cp.conns {
+		if entry == ce {
+			delete(cp.conns, key)
 
 			return
 		}
 	}
 }
 
+// ExpireUser expires the connections of the user, so that they are destroyed
+// as soon as they are not used anymore. This is used when the key of the
+// user changed, new connections are established with the new key.
+func (cp *ConnPool) ExpireUser(user string) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	used := []*connEntry{}
+	for key, ce := range cp.conns {
+		if ce.user != user || ce.expired {
+			continue
+		}
+
+		if ce.users == 0 {
+			ce.destroy()
+			delete(cp.conns, key)
+
+			continue
+		}
+
+		used = append(used, ce)
+	}
+
+	for _, ce := range used {
+		cp.expireEntry(ce)
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (cp *ConnPool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectionsDesc
+	ch <- connectionAgeDesc
+	ch <- probeFailuresDesc
+}
+
+// Collect implements prometheus.Collector, it exports the number of
+// connections in the pool and the age of the oldest one.
+func (cp *ConnPool) Collect(ch chan<- prometheus.Metric) {
+	cp.lock.RLock()
+	defer cp.lock.RUnlock()
+
+	inUse, idle, expired := 0, 0, 0
+	var oldest time.Duration
+	now := time.Now()
+	for _, ce := range cp.conns {
+		switch {
+		case ce.expired:
+			expired++
+		case ce.users == 0:
+			idle++
+		default:
+			inUse++
+		}
+
+		if age := now.Sub(ce.created); age > oldest {
+			oldest = age
+		}
+	}
+
+	ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(inUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(idle), "idle")
+	ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(expired), "expired")
+	ch <- prometheus.MustNewConstMetric(connectionAgeDesc, prometheus.GaugeValue, oldest.Seconds())
+	ch <- prometheus.MustNewConstMetric(probeFailuresDesc, prometheus.CounterValue, float64(cp.probeFailures))
+}
+
 // Add a reference to the connEntry.
 // /!\ Only call this while holding the ConnPool.lock.
 func (ce *connEntry) get() {
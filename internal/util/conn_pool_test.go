@@ -17,7 +17,9 @@ limitations under the License.
 package util
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -53,10 +55,13 @@ func (cp *ConnPool) fakeGet(monitors, user, keyfile string) (*rados.Conn, string
 		return nil, "", err
 	}
 
+	now := time.Now()
 	ce := &connEntry{
-		conn:     conn,
-		lastUsed: time.Now(),
-		users:    1,
+		conn:      conn,
+		created:   now,
+		lastUsed:  now,
+		lastProbe: now,
+		users:     1,
 	}
 
 	cp.lock.Lock()
@@ -177,3 +182,64 @@ func TestConnPool(t *testing.T) {
 		}
 	})
 }
+
+//nolint:paralleltest // replaces the probe of the ConnPool
+func TestConnPoolProbe(t *testing.T) {
+	cp := NewConnPool(interval, expiry)
+	defer cp.Destroy()
+
+	keyfile := filepath.Join(t.TempDir(), "keyfile")
+	err := os.WriteFile(keyfile, []byte("the-key"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to create keyfile: %v", err)
+	}
+
+	conn, unique, err := cp.fakeGet("monitors", "user", keyfile)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+
+	// a healthy connection stays in the pool
+	cp.probe = func(*rados.Conn) error { return nil }
+	cp.conns[unique].lastProbe = time.Now().Add(-2 * cp.probeInterval)
+	cp.probeAll()
+	ce, exists := cp.conns[unique]
+	if !exists || ce.expired {
+		t.Fatalf("a healthy connection should not be expired")
+	}
+	if ce.users != 1 {
+		t.Errorf("the probe should have released its reference: %v", ce.users)
+	}
+
+	// an unhealthy connection is expired, and replaced for new users
+	cp.probe = func(*rados.Conn) error { return errors.New("mon session lost") }
+	ce.lastProbe = time.Now().Add(-2 * cp.probeInterval)
+	cp.probeAll()
+	if _, exists = cp.conns[unique]; exists {
+		t.Errorf("an unhealthy connection should not be returned for new users")
+	}
+	if !ce.expired || ce.users != 1 {
+		t.Errorf("an unhealthy connection should be expired and kept for its user: %v", ce.users)
+	}
+	if cp.probeFailures != 1 {
+		t.Errorf("the failed probe should have been counted: %v", cp.probeFailures)
+	}
+
+	newConn, _, err := cp.fakeGet("monitors", "user", keyfile)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	if newConn == conn {
+		t.Errorf("the unhealthy connection should have been replaced")
+	}
+	if len(cp.conns) != 2 {
+		t.Errorf("the new and the expired connection should be in cp.conns: %v", len(cp.conns))
+	}
+
+	// the expired connection is destroyed once it is returned
+	cp.Put(conn)
+	if len(cp.conns) != 1 {
+		t.Errorf("the expired connection should have been removed: %v", len(cp.conns))
+	}
+	cp.Put(newConn)
+}
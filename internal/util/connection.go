@@ -21,10 +21,13 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
 	ca "github.com/ceph/go-ceph/cephfs/admin"
 	"github.com/ceph/go-ceph/common/admin/nfs"
 	"github.com/ceph/go-ceph/rados"
 	ra "github.com/ceph/go-ceph/rbd/admin"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type ClusterConnection struct {
@@ -47,6 +50,10 @@ var (
 	connPool   = NewConnPool(cpInterval, cpExpiry)
 )
 
+func init() {
+	prometheus.MustRegister(connPool)
+}
+
 // rbdVol.Connect() connects to the Ceph cluster and sets rbdVol.conn for further usage.
 func (cc *ClusterConnection) Connect(monitors string, cr *Credentials) error {
 	if cc.conn == nil {
@@ -107,12 +114,42 @@ func (cc *ClusterConnection) GetIoctx(pool string) (*rados.IOContext, error) {
 	return ioctx, nil
 }
 
+// GetPoolName returns the name of the pool with the poolID.
+func (cc *ClusterConnection) GetPoolName(poolID int64) (string, error) {
+	if cc.conn == nil {
+		return "", errors.New("cluster is not connected yet")
+	}
+
+	name, err := cc.conn.GetPoolByID(poolID)
+	if errors.Is(err, rados.ErrNotFound) {
+		return "", fmt.Errorf("%w: pool ID(%d) not found in Ceph cluster", ErrPoolNotFound, poolID)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get pool ID %d: %w", poolID, err)
+	}
+
+	return name, nil
+}
+
+// ListPools returns the names of all pools in the cluster.
+func (cc *ClusterConnection) ListPools() ([]string, error) {
+	if cc.conn == nil {
+		return nil, errors.New("cluster is not connected yet")
+	}
+
+	pools, err := cc.conn.ListPools()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	return pools, nil
+}
+
 func (cc *ClusterConnection) GetFSAdmin() (*ca.FSAdmin, error) {
 	if cc.conn == nil {
 		return nil, errors.New("cluster is not connected yet")
 	}
 
-	return ca.NewFromConn(cc.conn), nil
+	return ca.NewFromConn(metrics.NewCountingCommander(cc.conn)), nil
 }
 
 func (cc *ClusterConnection) GetFSID() (string, error) {
@@ -129,7 +166,7 @@ func (cc *ClusterConnection) GetRBDAdmin() (*ra.RBDAdmin, error) {
 		return nil, errors.New("cluster is not connected yet")
 	}
 
-	return ra.NewFromConn(cc.conn), nil
+	return ra.NewFromConn(metrics.NewCountingCommander(cc.conn)), nil
 }
 
 // GetTaskAdmin returns TaskAdmin to add tasks on rbd images.
@@ -149,7 +186,7 @@ func (cc *ClusterConnection) GetNFSAdmin() (*nfs.Admin, error) {
 		return nil, errors.New("cluster is not connected yet")
 	}
 
-	return nfs.NewFromConn(cc.conn), nil
+	return nfs.NewFromConn(metrics.NewCountingCommander(cc.conn)), nil
 }
 
 // GetAddrs returns the addresses of the RADOS session,
@@ -161,3 +198,90 @@ func (cc *ClusterConnection) GetAddrs() (string, error) {
 
 	return cc.conn.GetAddrs()
 }
+
+// GetInstanceID returns the global ID of the RADOS session, it matches the ID
+// of the watchers and lock owners that the session creates.
+func (cc *ClusterConnection) GetInstanceID() (uint64, error) {
+	if cc.conn == nil {
+		return 0, errors.New("cluster is not connected yet")
+	}
+
+	return cc.conn.GetInstanceID(), nil
+}
+
+// MonCommand sends the JSON formatted command to the Ceph monitors, and
+// returns the output of the command.
+func (cc *ClusterConnection) MonCommand(cmd []byte) ([]byte, error) {
+	if cc.conn == nil {
+		return nil, errors.New("cluster is not connected yet")
+	}
+
+	buf, info, err := metrics.NewCountingCommander(cc.conn).MonCommand(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("mon command failed: %w (%s)", err, info)
+	}
+
+	return buf, nil
+}
+
+// MgrCommand sends the JSON formatted command to the Ceph manager, and
+// returns the output of the command.
+func (cc *ClusterConnection) MgrCommand(cmd []byte) ([]byte, error) {
+	if cc.conn == nil {
+		return nil, errors.New("cluster is not connected yet")
+	}
+
+	buf, info, err := metrics.NewCountingCommander(cc.conn).MgrCommand([][]byte{cmd})
+	if err != nil {
+		return nil, fmt.Errorf("mgr command failed: %w (%s)", err, info)
+	}
+
+	return buf, nil
+}
+
+// MgrCommandWithInputBuffer sends the JSON formatted command with the input
+// buffer to the Ceph manager, and returns the output of the command.
+func (cc *ClusterConnection) MgrCommandWithInputBuffer(cmd, inbuf []byte) ([]byte, error) {
+	if cc.conn == nil {
+		return nil, errors.New("cluster is not connected yet")
+	}
+
+	buf, info, err := cc.conn.MgrCommandWithInputBuffer([][]byte{cmd}, inbuf)
+	if err != nil {
+		return nil, fmt.Errorf("mgr command failed: %w (%s)", err, info)
+	}
+
+	return buf, nil
+}
+
+// GetConfigOption returns the value of the Ceph configuration option as it
+// is used by the connection.
+func (cc *ClusterConnection) GetConfigOption(name string) (string, error) {
+	if cc.conn == nil {
+		return "", errors.New("cluster is not connected yet")
+	}
+
+	return cc.conn.GetConfigOption(name)
+}
+
+// DisableDiscardOnZeroedWriteSame disables the
+// `rbd_discard_on_zeroed_write_same` option in librbd, so that writing zero
+// blocks with WriteSame() allocates the blocks instead of discarding them.
+func (cc *ClusterConnection) DisableDiscardOnZeroedWriteSame() error {
+	if cc.discardOnZeroedWriteSameDisabled {
+		return nil
+	}
+
+	if cc.conn == nil {
+		return errors.New("cluster is not connected yet")
+	}
+
+	err := cc.conn.SetConfigOption("rbd_discard_on_zeroed_write_same", "false")
+	if err != nil {
+		return fmt.Errorf("failed to disable rbd_discard_on_zeroed_write_same: %w", err)
+	}
+
+	cc.discardOnZeroedWriteSameDisabled = true
+
+	return nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CredentialsType selects the Ceph user from the credentials in the
+// configuration of a cluster.
+type CredentialsType string
+
+const (
+	// ProvisionerCredentials are used by the controller.
+	ProvisionerCredentials CredentialsType = "provisioner"
+	// NodeStageCredentials are used by the nodeplugin to stage volumes.
+	NodeStageCredentials CredentialsType = "nodeStage"
+	// MirrorCredentials are used for the replication operations.
+	MirrorCredentials CredentialsType = "mirror"
+)
+
+// getCredentialsPath returns the path of the directory with the credentials
+// of the type for the clusterID. An empty path is returned when there are no
+// credentials of the type configured.
+func getCredentialsPath(pathToConfig, clusterID string, credType CredentialsType) string {
+	if clusterID == "" {
+		return ""
+	}
+
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		// the secrets of the request are used for clusters that are
+		// not in the configuration
+		return ""
+	}
+
+	switch credType {
+	case ProvisionerCredentials:
+		return cluster.Credentials.Provisioner
+	case NodeStageCredentials:
+		return cluster.Credentials.NodeStage
+	case MirrorCredentials:
+		return cluster.Credentials.Mirror
+	}
+
+	return ""
+}
+
+// readCredentialsDir returns the contents of the files in the directory by
+// their name. Hidden files are skipped, a mounted Kubernetes Secret contains
+// links like "..data" that point to the current version of the keys.
+func readCredentialsDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials from %q: %w", dir, err)
+	}
+
+	keys := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		value, err := os.ReadFile(filepath.Join(dir, name)) // #nosec:G304, file inclusion via variable.
+		if err != nil {
+			return nil, fmt.Errorf("failed to read credentials from %q: %w", dir, err)
+		}
+		keys[name] = strings.TrimSpace(string(value))
+	}
+
+	return keys, nil
+}
+
+// GetConfiguredSecrets returns the secrets of a request with the keys of the
+// credentials of the type that are configured for the clusterID. Keys that are
+// not part of the credentials (like the passphrase for encryption) are kept.
+// The secrets are returned unmodified when there are no credentials configured.
+func GetConfiguredSecrets(
+	pathToConfig, clusterID string,
+	credType CredentialsType,
+	secrets map[string]string,
+) (map[string]string, error) {
+	dir := getCredentialsPath(pathToConfig, clusterID, credType)
+	if dir == "" {
+		return secrets, nil
+	}
+
+	keys, err := readCredentialsDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]string, len(secrets)+len(keys))
+	for k, v := range secrets {
+		merged[k] = v
+	}
+	for k, v := range keys {
+		merged[k] = v
+	}
+
+	return merged, nil
+}
+
+// GetClusterIDFromVolumeID returns the clusterID that is encoded in the
+// volume ID (or snapshot ID). An empty clusterID is returned for IDs that
+// can not be decoded, like the IDs of static or migrated volumes.
+func GetClusterIDFromVolumeID(volumeID string) string {
+	var vi CSIIdentifier
+	if err := vi.DecomposeCSIID(volumeID); err != nil {
+		return ""
+	}
+
+	return vi.ClusterID
+}
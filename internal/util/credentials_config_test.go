@@ -0,0 +1,116 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConfiguredSecrets(t *testing.T) {
+	t.Parallel()
+
+	credDir := t.TempDir()
+	// a mounted Secret has hidden links to the current version of the keys
+	require.NoError(t, os.Mkdir(filepath.Join(credDir, "..data"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(credDir, "userID"), []byte("csi-rbd-node\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(credDir, "userKey"), []byte("node-key"), 0o600))
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1", "ip-2"},
+			Credentials: cephcsi.Credentials{
+				NodeStage: credDir,
+				Mirror:    filepath.Join(credDir, "missing"),
+			},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	require.NoError(t, err)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	require.NoError(t, err)
+
+	secrets := map[string]string{
+		"userID":               "csi-rbd-provisioner",
+		"userKey":              "provisioner-key",
+		"encryptionPassphrase": "passphrase",
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		credType  CredentialsType
+		want      map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "configured credentials",
+			clusterID: "cluster-1",
+			credType:  NodeStageCredentials,
+			want: map[string]string{
+				"userID":               "csi-rbd-node",
+				"userKey":              "node-key",
+				"encryptionPassphrase": "passphrase",
+			},
+		},
+		{
+			name:      "no credentials of the type",
+			clusterID: "cluster-1",
+			credType:  ProvisionerCredentials,
+			want:      secrets,
+		},
+		{
+			name:      "unknown clusterID",
+			clusterID: "cluster-2",
+			credType:  NodeStageCredentials,
+			want:      secrets,
+		},
+		{
+			name:      "empty clusterID",
+			clusterID: "",
+			credType:  NodeStageCredentials,
+			want:      secrets,
+		},
+		{
+			name:      "missing directory",
+			clusterID: "cluster-1",
+			credType:  MirrorCredentials,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetConfiguredSecrets(tmpConfPath, tt.clusterID, tt.credType, secrets)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// credentialsRefreshInterval is the interval to check the credentials in the
+// CSI configuration for changes. Kubernetes updates mounted Secrets with a
+// delay of about a minute too.
+const credentialsRefreshInterval = time.Minute
+
+// credentialsUsers contains the keys of the user IDs in the credentials, and
+// the keys of their cephx keys.
+var credentialsUsers = map[string]string{
+	credUserID:  credUserKey,
+	credAdminID: credAdminKey,
+}
+
+// credentialsState contains the keys of the credentials by the directory they
+// are read from.
+type credentialsState map[string]map[string]string
+
+// readCredentialsState reads the credentials of all clusters in the CSI
+// configuration. Directories that can not be read are skipped, they are read
+// again on the next refresh.
+func readCredentialsState(ctx context.Context, pathToConfig string) (credentialsState, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	state := credentialsState{}
+	for i := range config {
+		creds := config[i].Credentials
+		for _, dir := range []string{creds.Provisioner, creds.NodeStage, creds.Mirror} {
+			if dir == "" {
+				continue
+			}
+
+			if _, ok := state[dir]; ok {
+				continue
+			}
+
+			keys, err := readCredentialsDir(dir)
+			if err != nil {
+				log.ErrorLog(ctx, "failed to refresh credentials: %v", err)
+
+				continue
+			}
+			state[dir] = keys
+		}
+	}
+
+	return state, nil
+}
+
+// changedUsers returns the users of the previous state that have a different
+// key (or were removed) in the current state.
+func changedUsers(previous, current credentialsState) []string {
+	var users []string
+	for dir, prevKeys := range previous {
+		curKeys, ok := current[dir]
+		if !ok {
+			// the directory could not be read, or it was removed from
+			// the configuration and is not used anymore
+			continue
+		}
+
+		for idKey, keyKey := range credentialsUsers {
+			user := prevKeys[idKey]
+			if user == "" {
+				continue
+			}
+
+			if curKeys[idKey] != user || curKeys[keyKey] != prevKeys[keyKey] {
+				users = append(users, user)
+			}
+		}
+	}
+
+	return users
+}
+
+// WatchCredentials periodically reads the credentials that are configured in
+// the CSI configuration. When the key of a user is rotated, the connections of
+// the user in the connection pool are expired. The credentials are read for
+// each operation, new operations connect to the cluster with the new key.
+func WatchCredentials(ctx context.Context, pathToConfig string) {
+	ticker := time.NewTicker(credentialsRefreshInterval)
+	defer ticker.Stop()
+
+	previous, err := readCredentialsState(ctx, pathToConfig)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to read credentials: %v", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current, err := readCredentialsState(ctx, pathToConfig)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to refresh credentials: %v", err)
+
+			continue
+		}
+
+		for _, user := range changedUsers(previous, current) {
+			log.DefaultLog("key of user %q changed, expiring its connections", user)
+			connPool.ExpireUser(user)
+		}
+
+		// keep the keys of directories that could not be read, so that
+		// a change is detected once they can be read again
+		for dir, keys := range previous {
+			if _, ok := current[dir]; !ok {
+				current[dir] = keys
+			}
+		}
+		previous = current
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangedUsers(t *testing.T) {
+	t.Parallel()
+
+	previous := credentialsState{
+		"/provisioner": {
+			"userID":   "csi-rbd-provisioner",
+			"userKey":  "provisioner-key",
+			"adminID":  "csi-admin",
+			"adminKey": "admin-key",
+		},
+		"/node": {
+			"userID":  "csi-rbd-node",
+			"userKey": "node-key",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		current credentialsState
+		want    []string
+	}{
+		{
+			name:    "unchanged",
+			current: previous,
+			want:    nil,
+		},
+		{
+			name: "rotated key",
+			current: credentialsState{
+				"/provisioner": previous["/provisioner"],
+				"/node": {
+					"userID":  "csi-rbd-node",
+					"userKey": "new-node-key",
+				},
+			},
+			want: []string{"csi-rbd-node"},
+		},
+		{
+			name: "replaced user",
+			current: credentialsState{
+				"/provisioner": {
+					"userID":   "csi-rbd-provisioner-2",
+					"userKey":  "provisioner-key",
+					"adminID":  "csi-admin",
+					"adminKey": "admin-key",
+				},
+				"/node": previous["/node"],
+			},
+			want: []string{"csi-rbd-provisioner"},
+		},
+		{
+			name: "unreadable directory",
+			current: credentialsState{
+				"/provisioner": previous["/provisioner"],
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.ElementsMatch(t, tt.want, changedUsers(previous, tt.current))
+		})
+	}
+}
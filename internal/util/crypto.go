@@ -185,6 +185,13 @@ func (ve *VolumeEncryption) SetDEKStore(dekStore kms.DEKStore) {
 	ve.dekStore = dekStore
 }
 
+// HasDEKStore returns true when the DEKs of the volumes are stored in a
+// DEKStore, either by the KMS itself or by the one that was set with
+// VolumeEncryption.SetDEKStore().
+func (ve *VolumeEncryption) HasDEKStore() bool {
+	return ve.dekStore != nil
+}
+
 // Destroy frees any resources that the VolumeEncryption instance allocated.
 func (ve *VolumeEncryption) Destroy() {
 	ve.KMS.Destroy()
@@ -267,9 +274,9 @@ func VolumeMapper(volumeID string) (string, string) {
 // EncryptVolume encrypts provided device with LUKS.
 func EncryptVolume(ctx context.Context, devicePath, passphrase string) error {
 	log.DebugLog(ctx, "Encrypting device %q	 with LUKS", devicePath)
-	_, stdErr, err := luks.Format(devicePath, passphrase)
-	if err != nil || stdErr != "" {
-		log.ErrorLog(ctx, "failed to encrypt device %q with LUKS (%v): %s", devicePath, err, stdErr)
+	err := luks.Format(devicePath, passphrase)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to encrypt device %q with LUKS: %v", devicePath, err)
 	}
 
 	return err
@@ -278,9 +285,9 @@ func EncryptVolume(ctx context.Context, devicePath, passphrase string) error {
 // OpenEncryptedVolume opens volume so that it can be used by the client.
 func OpenEncryptedVolume(ctx context.Context, devicePath, mapperFile, passphrase string) error {
 	log.DebugLog(ctx, "Opening device %q with LUKS on %q", devicePath, mapperFile)
-	_, stdErr, err := luks.Open(devicePath, mapperFile, passphrase)
-	if err != nil || stdErr != "" {
-		log.ErrorLog(ctx, "failed to open device %q (%v): %s", devicePath, err, stdErr)
+	err := luks.Open(devicePath, mapperFile, passphrase)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to open device %q: %v", devicePath, err)
 	}
 
 	return err
@@ -289,9 +296,9 @@ func OpenEncryptedVolume(ctx context.Context, devicePath, mapperFile, passphrase
 // ResizeEncryptedVolume resizes encrypted volume so that it can be used by the client.
 func ResizeEncryptedVolume(ctx context.Context, mapperFile string) error {
 	log.DebugLog(ctx, "Resizing LUKS device %q", mapperFile)
-	_, stdErr, err := luks.Resize(mapperFile)
-	if err != nil || stdErr != "" {
-		log.ErrorLog(ctx, "failed to resize LUKS device %q (%v): %s", mapperFile, err, stdErr)
+	err := luks.Resize(mapperFile)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to resize LUKS device %q: %v", mapperFile, err)
 	}
 
 	return err
@@ -300,9 +307,9 @@ func ResizeEncryptedVolume(ctx context.Context, mapperFile string) error {
 // CloseEncryptedVolume closes encrypted volume so it can be detached.
 func CloseEncryptedVolume(ctx context.Context, mapperFile string) error {
 	log.DebugLog(ctx, "Closing LUKS device %q", mapperFile)
-	_, stdErr, err := luks.Close(mapperFile)
-	if err != nil || stdErr != "" {
-		log.ErrorLog(ctx, "failed to close LUKS device %q (%v): %s", mapperFile, err, stdErr)
+	err := luks.Close(mapperFile)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to close LUKS device %q: %v", mapperFile, err)
 	}
 
 	return err
@@ -323,31 +330,16 @@ func DeviceEncryptionStatus(ctx context.Context, devicePath string) (string, str
 		return devicePath, "", nil
 	}
 	mapPath := strings.TrimPrefix(devicePath, mapperFilePathPrefix+"/")
-	stdout, stdErr, err := luks.Status(mapPath)
-	if err != nil || stdErr != "" {
-		log.DebugLog(ctx, "%q is not an active LUKS device (%v): %s", devicePath, err, stdErr)
+	device, err := luks.Status(mapPath)
+	if err != nil {
+		log.DebugLog(ctx, "%q is not an active LUKS device: %v", devicePath, err)
 
 		return devicePath, "", nil
 	}
-	lines := strings.Split(stdout, "\n")
-	if len(lines) < 1 {
-		return "", "", fmt.Errorf("device encryption status returned no stdout for %s", devicePath)
+	if device == "" {
+		// Identified as LUKS, but failed to identify a mapped device
+		return "", "", fmt.Errorf("mapped device not found in path %s", devicePath)
 	}
-	// The line will look like: "/dev/mapper/xxx is active and is in use."
-	if !strings.Contains(lines[0], " is active") {
-		// Implies this is not a LUKS device
-		return devicePath, "", nil
-	}
-	for i := 1; i < len(lines); i++ {
-		kv := strings.SplitN(strings.TrimSpace(lines[i]), ":", 2)
-		if len(kv) < 1 {
-			return "", "", fmt.Errorf("device encryption status output for %s is badly formatted: %s",
-				devicePath, lines[i])
-		}
-		if kv[0] == "device" {
-			return strings.TrimSpace(kv[1]), mapPath, nil
-		}
-	}
-	// Identified as LUKS, but failed to identify a mapped device
-	return "", "", fmt.Errorf("mapped device not found in path %s", devicePath)
+
+	return device, mapPath, nil
 }
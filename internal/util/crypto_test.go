@@ -53,6 +53,7 @@ func TestKMSWorkflow(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, ve)
 	require.Equal(t, kms.DefaultKMSType, ve.GetID())
+	require.True(t, ve.HasDEKStore())
 
 	volumeID := "volume-id"
 	ctx := context.TODO()
@@ -16,255 +16,436 @@ limitations under the License.
 
 package cryptsetup
 
+/*
+#cgo LDFLAGS: -lcryptsetup
+#include <errno.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libcryptsetup.h>
+*/
+import "C"
+
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"strconv"
-	"strings"
+	"syscall"
 	"time"
-
-	"github.com/ceph/ceph-csi/internal/util/file"
-	"github.com/ceph/ceph-csi/internal/util/log"
-	"github.com/ceph/ceph-csi/internal/util/stripsecrets"
+	"unsafe"
 )
 
 const (
-	// Maximum time to wait for cryptsetup commands to complete.
+	// Maximum time to wait for cryptsetup operations to complete.
 	ExecutionTimeout = 2*time.Minute + 30*time.Second
 
 	// Limit memory used by Argon2i PBKDF to 32 MiB.
 	pkdbfMemoryLimit = 32 << 10 // 32768 KiB
+
+	// parameters of the LUKS2 format, the defaults of the cryptsetup
+	// command
+	luksType       = "LUKS2"
+	luksCipher     = "aes"
+	luksCipherMode = "xts-plain64"
+	luksKeySize    = 64 // 512 bits for aes-xts-plain64
+	luksPBKDF      = "argon2id"
+	luksHash       = "sha256"
+	luksPBKDFTime  = 2000 // milliseconds
+	luksPBKDFJobs  = 4
 )
 
-// LuksWrapper is a struct that provides a context-aware wrapper around cryptsetup commands.
+var (
+	// ErrWrongPassphrase is returned when no key slot can be unlocked with
+	// the passphrase.
+	ErrWrongPassphrase = errors.New("no key available with this passphrase")
+
+	// ErrNotActive is returned by Status when the mapping is not active.
+	ErrNotActive = errors.New("device mapping is not active")
+)
+
+// Error is returned when a libcryptsetup function fails. The Errno can be
+// checked with errors.Is, like errors.Is(err, syscall.EBUSY).
+type Error struct {
+	// Op is the libcryptsetup function that failed
+	Op string
+	// Device is the device or the name of the mapping
+	Device string
+	// Errno is the error that libcryptsetup returned
+	Errno syscall.Errno
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s for %s failed: %v", e.Op, e.Device, e.Errno)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Errno
+}
+
+// getError returns an Error for the negative errno that a libcryptsetup
+// function returned, and nil for other return values.
+func getError(op, device string, ret C.int) error {
+	if ret >= 0 {
+		return nil
+	}
+
+	return &Error{Op: op, Device: device, Errno: syscall.Errno(-ret)}
+}
+
+// LUKSWrapper provides the LUKS operations on devices.
 type LUKSWrapper interface {
-	Format(devicePath, passphrase string) (string, string, error)
-	Open(devicePath, mapperFile, passphrase string) (string, string, error)
-	Close(mapperFile string) (string, string, error)
-	AddKey(devicePath, passphrase, newPassphrase, slot string) error
-	RemoveKey(devicePath, passphrase, slot string) error
-	Resize(mapperFile string) (string, string, error)
-	VerifyKey(devicePath, passphrase, slot string) (bool, error)
-	Status(mapperFile string) (string, string, error)
+	Format(devicePath, passphrase string) error
+	Open(devicePath, mapperFile, passphrase string) error
+	Close(mapperFile string) error
+	AddKey(devicePath, passphrase, newPassphrase string, slot int) error
+	RemoveKey(devicePath, passphrase string, slot int) error
+	Resize(mapperFile string) error
+	VerifyKey(devicePath, passphrase string, slot int) (bool, error)
+	KeySlots(devicePath string) ([]int, error)
+	Status(mapperFile string) (string, error)
 }
 
-// luksWrapper is a type that implements LUKSWrapper interface
-// and provides a shared context for its methods.
+// luksWrapper is a type that implements LUKSWrapper interface with
+// libcryptsetup, and provides a shared context for its methods.
 type luksWrapper struct {
 	ctx context.Context
 }
 
 // NewLUKSWrapper creates a new LUKSWrapper instance with the provided context.
-// The context is used to control the lifetime of the cryptsetup commands.
+// The context is checked before each operation, an operation that started
+// already can not be interrupted.
 func NewLUKSWrapper(ctx context.Context) LUKSWrapper {
 	return &luksWrapper{ctx: ctx}
 }
 
-// LuksFormat sets up volume as an encrypted LUKS partition.
-func (l *luksWrapper) Format(devicePath, passphrase string) (string, string, error) {
-	return l.execCryptsetupCommand(
-		&passphrase,
-		"-q",
-		"luksFormat",
-		"--type",
-		"luks2",
-		"--hash",
-		"sha256",
-		"--pbkdf-memory",
-		strconv.Itoa(pkdbfMemoryLimit),
-		devicePath,
-		"-d",
-		"/dev/stdin")
+// cSecret is a copy of a passphrase in C memory, that is overwritten when it
+// is freed.
+type cSecret struct {
+	ptr  *C.char
+	size C.size_t
 }
 
-// LuksOpen opens LUKS encrypted partition and sets up a mapping.
-func (l *luksWrapper) Open(devicePath, mapperFile, passphrase string) (string, string, error) {
-	// cryptsetup option --disable-keyring (introduced with cryptsetup v2.0.0)
-	// will be ignored with luks1
-	return l.execCryptsetupCommand(
-		&passphrase,
-		"luksOpen",
-		devicePath,
-		mapperFile,
-		"--disable-keyring",
-		"-d",
-		"/dev/stdin")
+func newCSecret(p string) *cSecret {
+	return &cSecret{
+		ptr:  (*C.char)(C.CBytes([]byte(p))),
+		size: C.size_t(len(p)),
+	}
 }
 
-// LuksResize resizes LUKS encrypted partition.
-func (l *luksWrapper) Resize(mapperFile string) (string, string, error) {
-	return l.execCryptsetupCommand(nil, "resize", mapperFile)
+func (p *cSecret) free() {
+	C.memset(unsafe.Pointer(p.ptr), 0, p.size)
+	C.free(unsafe.Pointer(p.ptr))
 }
 
-// LuksClose removes existing mapping.
-func (l *luksWrapper) Close(mapperFile string) (string, string, error) {
-	return l.execCryptsetupCommand(nil, "luksClose", mapperFile)
+// device is an initialized libcryptsetup context.
+type device struct {
+	cd   *C.struct_crypt_device
+	name string
+}
+
+// openDevice initializes a context for the device, and loads the LUKS header
+// when load is set.
+func (l *luksWrapper) openDevice(devicePath string, load bool) (*device, error) {
+	if err := l.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("cryptsetup operation on %s canceled: %w", devicePath, err)
+	}
+
+	cPath := C.CString(devicePath)
+	defer C.free(unsafe.Pointer(cPath))
+
+	d := &device{name: devicePath}
+	if err := getError("crypt_init", devicePath, C.crypt_init(&d.cd, cPath)); err != nil {
+		return nil, err
+	}
+
+	if load {
+		if err := getError("crypt_load", devicePath, C.crypt_load(d.cd, nil, nil)); err != nil {
+			d.free()
+
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// openMapping initializes a context for the active mapping.
+func (l *luksWrapper) openMapping(mapperFile string) (*device, error) {
+	if err := l.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("cryptsetup operation on %s canceled: %w", mapperFile, err)
+	}
+
+	cName := C.CString(mapperFile)
+	defer C.free(unsafe.Pointer(cName))
+
+	d := &device{name: mapperFile}
+	if err := getError("crypt_init_by_name", mapperFile, C.crypt_init_by_name(&d.cd, cName)); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *device) free() {
+	C.crypt_free(d.cd)
+}
+
+// checkPassphrase returns the key slot that the passphrase unlocks, slot can
+// be C.CRYPT_ANY_SLOT. ErrWrongPassphrase is returned when the passphrase
+// does not match, or the slot is not active.
+func (d *device) checkPassphrase(pass *cSecret, slot C.int) (int, error) {
+	ret := C.crypt_activate_by_passphrase(d.cd, nil, slot, pass.ptr, pass.size, 0)
+	if ret == -C.EPERM || ret == -C.ENOENT {
+		return 0, fmt.Errorf("%w for %s", ErrWrongPassphrase, d.name)
+	}
+	if err := getError("crypt_activate_by_passphrase", d.name, ret); err != nil {
+		return 0, err
+	}
+
+	return int(ret), nil
+}
+
+// Format sets up volume as an encrypted LUKS partition.
+func (l *luksWrapper) Format(devicePath, passphrase string) error {
+	d, err := l.openDevice(devicePath, false)
+	if err != nil {
+		return err
+	}
+	defer d.free()
+
+	cPBKDF := C.CString(luksPBKDF)
+	defer C.free(unsafe.Pointer(cPBKDF))
+	cHash := C.CString(luksHash)
+	defer C.free(unsafe.Pointer(cHash))
+
+	pbkdf := C.struct_crypt_pbkdf_type{
+		_type:            cPBKDF,
+		hash:             cHash,
+		time_ms:          luksPBKDFTime,
+		max_memory_kb:    pkdbfMemoryLimit,
+		parallel_threads: luksPBKDFJobs,
+	}
+	if err = getError("crypt_set_pbkdf_type", devicePath, C.crypt_set_pbkdf_type(d.cd, &pbkdf)); err != nil {
+		return err
+	}
+
+	cType := C.CString(luksType)
+	defer C.free(unsafe.Pointer(cType))
+	cCipher := C.CString(luksCipher)
+	defer C.free(unsafe.Pointer(cCipher))
+	cMode := C.CString(luksCipherMode)
+	defer C.free(unsafe.Pointer(cMode))
+
+	ret := C.crypt_format(d.cd, cType, cCipher, cMode, nil, nil, luksKeySize, nil)
+	if err = getError("crypt_format", devicePath, ret); err != nil {
+		return err
+	}
+
+	pass := newCSecret(passphrase)
+	defer pass.free()
+
+	ret = C.crypt_keyslot_add_by_volume_key(d.cd, C.CRYPT_ANY_SLOT, nil, 0, pass.ptr, pass.size)
+
+	return getError("crypt_keyslot_add_by_volume_key", devicePath, ret)
 }
 
-// LuksStatus returns encryption status of a provided device.
-func (l *luksWrapper) Status(mapperFile string) (string, string, error) {
-	return l.execCryptsetupCommand(nil, "status", mapperFile)
+// Open opens LUKS encrypted partition and sets up a mapping.
+func (l *luksWrapper) Open(devicePath, mapperFile, passphrase string) error {
+	d, err := l.openDevice(devicePath, true)
+	if err != nil {
+		return err
+	}
+	defer d.free()
+
+	// keep the volume key in the device-mapper table instead of the kernel
+	// keyring, like `cryptsetup --disable-keyring`, so that the mapping can
+	// be resized without passphrase
+	if err = getError("crypt_volume_key_keyring", devicePath, C.crypt_volume_key_keyring(d.cd, 0)); err != nil {
+		return err
+	}
+
+	cName := C.CString(mapperFile)
+	defer C.free(unsafe.Pointer(cName))
+	pass := newCSecret(passphrase)
+	defer pass.free()
+
+	ret := C.crypt_activate_by_passphrase(d.cd, cName, C.CRYPT_ANY_SLOT, pass.ptr, pass.size, 0)
+	if ret == -C.EPERM {
+		return fmt.Errorf("%w for %s", ErrWrongPassphrase, devicePath)
+	}
+
+	return getError("crypt_activate_by_passphrase", devicePath, ret)
 }
 
-// LuksAddKey adds a new key to the specified slot.
-func (l *luksWrapper) AddKey(devicePath, passphrase, newPassphrase, slot string) error {
-	passFile, err := file.CreateTempFile("luks-", passphrase)
+// Resize resizes the mapping to the size of the LUKS encrypted partition.
+func (l *luksWrapper) Resize(mapperFile string) error {
+	d, err := l.openMapping(mapperFile)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(passFile.Name())
+	defer d.free()
+
+	cName := C.CString(mapperFile)
+	defer C.free(unsafe.Pointer(cName))
 
-	newPassFile, err := file.CreateTempFile("luks-", newPassphrase)
+	return getError("crypt_resize", mapperFile, C.crypt_resize(d.cd, cName, 0))
+}
+
+// Close removes existing mapping.
+func (l *luksWrapper) Close(mapperFile string) error {
+	d, err := l.openMapping(mapperFile)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(newPassFile.Name())
+	defer d.free()
 
-	_, stderr, err := l.execCryptsetupCommand(
-		nil,
-		"--verbose",
-		"--key-file="+passFile.Name(),
-		"--key-slot="+slot,
-		"luksAddKey",
-		devicePath,
-		newPassFile.Name(),
-	)
+	cName := C.CString(mapperFile)
+	defer C.free(unsafe.Pointer(cName))
 
-	// Return early if no error to save us some time
-	if err == nil {
-		return nil
+	return getError("crypt_deactivate", mapperFile, C.crypt_deactivate(d.cd, cName))
+}
+
+// Status returns the encrypted device of an active mapping. ErrNotActive is
+// returned when the mapping is not active.
+func (l *luksWrapper) Status(mapperFile string) (string, error) {
+	d, err := l.openMapping(mapperFile)
+	if errors.Is(err, syscall.ENODEV) {
+		return "", fmt.Errorf("%w: %s", ErrNotActive, mapperFile)
+	} else if err != nil {
+		return "", err
 	}
+	defer d.free()
 
-	// Possible scenarios
-	// 1. The provided passphrase to unlock the disk is wrong
-	// 2. The key slot is already in use
-	// 	  If so, check if the key we want to add to the slot is already there
-	//    If not, remove it and then add the new key to the slot
-	if strings.Contains(stderr, fmt.Sprintf("Key slot %s is full", slot)) {
-		// The given slot already has a key
-		// Check if it is the one that we want to update with
-		exists, fErr := l.VerifyKey(devicePath, newPassphrase, slot)
-		if fErr != nil {
-			return fErr
-		}
+	cName := C.CString(mapperFile)
+	defer C.free(unsafe.Pointer(cName))
 
-		// Verification passed, return early
-		if exists {
+	switch C.crypt_status(d.cd, cName) {
+	case C.CRYPT_ACTIVE, C.CRYPT_BUSY:
+	default:
+		return "", fmt.Errorf("%w: %s", ErrNotActive, mapperFile)
+	}
+
+	return C.GoString(C.crypt_get_device_name(d.cd)), nil
+}
+
+// AddKey adds a new key to the specified slot. When the slot contains a
+// different key already, the key in the slot is replaced.
+func (l *luksWrapper) AddKey(devicePath, passphrase, newPassphrase string, slot int) error {
+	d, err := l.openDevice(devicePath, true)
+	if err != nil {
+		return err
+	}
+	defer d.free()
+
+	switch C.crypt_keyslot_status(d.cd, C.int(slot)) {
+	case C.CRYPT_SLOT_ACTIVE, C.CRYPT_SLOT_ACTIVE_LAST:
+		newPass := newCSecret(newPassphrase)
+		_, vErr := d.checkPassphrase(newPass, C.int(slot))
+		newPass.free()
+		if vErr == nil {
+			// the slot has the new key already
 			return nil
+		} else if !errors.Is(vErr, ErrWrongPassphrase) {
+			return vErr
 		}
 
-		// Else, we remove the key from the given slot and add the new one
-		// Note: we use existing passphrase here as we are not yet sure if
-		// the newPassphrase is present in the headers
-		fErr = l.RemoveKey(devicePath, passphrase, slot)
-		if fErr != nil {
-			return fErr
+		// replace the key in the slot, the existing passphrase is used
+		// as the new passphrase might not be in the header yet
+		if err = l.RemoveKey(devicePath, passphrase, slot); err != nil {
+			return err
 		}
 
-		// Now the slot is free, add the new key to it
-		fErr = l.AddKey(devicePath, passphrase, newPassphrase, slot)
-		if fErr != nil {
-			return fErr
-		}
+		// reload the header after the slot was removed
+		return l.AddKey(devicePath, passphrase, newPassphrase, slot)
+	case C.CRYPT_SLOT_INVALID:
+		return getError("crypt_keyslot_status", devicePath, -C.EINVAL)
+	}
 
-		// No errors, we good.
-		return nil
+	pass := newCSecret(passphrase)
+	defer pass.free()
+	newPass := newCSecret(newPassphrase)
+	defer newPass.free()
+
+	ret := C.crypt_keyslot_add_by_passphrase(d.cd, C.int(slot), pass.ptr, pass.size, newPass.ptr, newPass.size)
+	if ret == -C.EPERM {
+		return fmt.Errorf("%w for %s", ErrWrongPassphrase, devicePath)
 	}
 
-	// The existing passphrase is wrong and the slot is empty
-	return err
+	return getError("crypt_keyslot_add_by_passphrase", devicePath, ret)
 }
 
-// LuksRemoveKey removes the key by killing the specified slot.
-func (l *luksWrapper) RemoveKey(devicePath, passphrase, slot string) error {
-	keyFile, err := file.CreateTempFile("luks-", passphrase)
+// RemoveKey removes the key in the specified slot, after the passphrase was
+// verified against the keys of the device. Removing an inactive slot is not
+// an error.
+func (l *luksWrapper) RemoveKey(devicePath, passphrase string, slot int) error {
+	d, err := l.openDevice(devicePath, true)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(keyFile.Name())
+	defer d.free()
+
+	pass := newCSecret(passphrase)
+	defer pass.free()
 
-	_, stderr, err := l.execCryptsetupCommand(
-		nil,
-		"--verbose",
-		"--key-file="+keyFile.Name(),
-		"luksKillSlot",
-		devicePath,
-		slot,
-	)
+	if _, err = d.checkPassphrase(pass, C.CRYPT_ANY_SLOT); err != nil {
+		return err
+	}
+
+	switch C.crypt_keyslot_status(d.cd, C.int(slot)) {
+	case C.CRYPT_SLOT_ACTIVE, C.CRYPT_SLOT_ACTIVE_LAST, C.CRYPT_SLOT_UNBOUND:
+	default:
+		return nil
+	}
+
+	err = getError("crypt_keyslot_destroy", devicePath, C.crypt_keyslot_destroy(d.cd, C.int(slot)))
 	if err != nil {
-		// If a slot is not active, don't treat that as an error
-		if !strings.Contains(stderr, fmt.Sprintf("Keyslot %s is not active.", slot)) {
-			return fmt.Errorf("failed to kill slot %s for device %s: %w", slot, devicePath, err)
-		}
+		return fmt.Errorf("failed to kill slot %d for device %s: %w", slot, devicePath, err)
 	}
 
 	return nil
 }
 
-// LuksVerifyKey verifies that a key exists in a given slot.
-func (l *luksWrapper) VerifyKey(devicePath, passphrase, slot string) (bool, error) {
-	// Create a temp file that we will use to open the device
-	keyFile, err := file.CreateTempFile("luks-", passphrase)
+// VerifyKey verifies that the passphrase unlocks the given slot.
+func (l *luksWrapper) VerifyKey(devicePath, passphrase string, slot int) (bool, error) {
+	d, err := l.openDevice(devicePath, true)
 	if err != nil {
 		return false, err
 	}
-	defer os.Remove(keyFile.Name())
-
-	_, stderr, err := l.execCryptsetupCommand(
-		nil,
-		"--verbose",
-		"--key-file="+keyFile.Name(),
-		"--key-slot="+slot,
-		"luksChangeKey",
-		devicePath,
-		keyFile.Name(),
-	)
-	if err != nil {
-		// If the passphrase doesn't match the key in given slot
-		if strings.Contains(stderr, "No key available with this passphrase.") {
-			// No match, no error
-			return false, nil
-		}
+	defer d.free()
 
-		// Otherwise it was something else, return the wrapped error
-		log.ErrorLogMsg("failed to verify key in slot %s. stderr: %s. err: %v", slot, stderr, err)
+	pass := newCSecret(passphrase)
+	defer pass.free()
 
-		return false, fmt.Errorf("failed to verify key in slot %s for device %s: %w", slot, devicePath, err)
+	_, err = d.checkPassphrase(pass, C.int(slot))
+	if errors.Is(err, ErrWrongPassphrase) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to verify key in slot %d for device %s: %w", slot, devicePath, err)
 	}
 
 	return true, nil
 }
 
-func (l *luksWrapper) execCryptsetupCommand(stdin *string, args ...string) (string, string, error) {
-	var (
-		program       = "cryptsetup"
-		cmd           = exec.CommandContext(l.ctx, program, args...) // #nosec:G204, commands executing not vulnerable.
-		sanitizedArgs = stripsecrets.InArgs(args)
-		stdoutBuf     bytes.Buffer
-		stderrBuf     bytes.Buffer
-	)
-
-	cmd.Stdout = &stdoutBuf
-	cmd.Stderr = &stderrBuf
-	if stdin != nil {
-		cmd.Stdin = strings.NewReader(*stdin)
+// KeySlots returns the key slots of the device that contain a key.
+func (l *luksWrapper) KeySlots(devicePath string) ([]int, error) {
+	d, err := l.openDevice(devicePath, true)
+	if err != nil {
+		return nil, err
 	}
-	err := cmd.Run()
-	stdout := stdoutBuf.String()
-	stderr := stderrBuf.String()
+	defer d.free()
 
-	if errors.Is(l.ctx.Err(), context.DeadlineExceeded) {
-		return stdout, stderr, fmt.Errorf("timeout occurred while running %s args: %v", program, sanitizedArgs)
+	cType := C.crypt_get_type(d.cd)
+	maxSlots := C.crypt_keyslot_max(cType)
+	if err = getError("crypt_keyslot_max", devicePath, maxSlots); err != nil {
+		return nil, err
 	}
 
-	if err != nil {
-		return stdout, stderr, fmt.Errorf("an error (%v)"+
-			" occurred while running %s args: %v", err, program, sanitizedArgs)
+	slots := []int{}
+	for slot := C.int(0); slot < maxSlots; slot++ {
+		switch C.crypt_keyslot_status(d.cd, slot) {
+		case C.CRYPT_SLOT_ACTIVE, C.CRYPT_SLOT_ACTIVE_LAST:
+			slots = append(slots, int(slot))
+		}
 	}
 
-	return stdout, stderr, err
+	return slots, nil
 }
@@ -61,13 +61,35 @@ const (
 }]
 */
 func readClusterInfo(pathToConfig, clusterID string) (*kubernetes.ClusterInfo, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration for cluster ID %q: %w", clusterID, err)
+	}
+
+	for i := range config {
+		if config[i].ClusterID == clusterID {
+			// the loaded configuration is shared, return a copy
+			cluster := config[i]
+
+			return &cluster, nil
+		}
+	}
+
+	return nil, fmt.Errorf("missing configuration for cluster ID %q", clusterID)
+}
+
+// readCSIConfig returns the configuration of all clusters. The loaded
+// configuration is returned when the file is watched with WatchCSIConfig.
+func readCSIConfig(pathToConfig string) ([]kubernetes.ClusterInfo, error) {
+	if clusters, ok := getLoadedCSIConfig(pathToConfig); ok {
+		return clusters, nil
+	}
+
 	var config []kubernetes.ClusterInfo
 
 	// #nosec
 	content, err := os.ReadFile(pathToConfig)
 	if err != nil {
-		err = fmt.Errorf("error fetching configuration for cluster ID %q: %w", clusterID, err)
-
 		return nil, err
 	}
 
@@ -77,13 +99,23 @@ func readClusterInfo(pathToConfig, clusterID string) (*kubernetes.ClusterInfo, e
 			err, string(content))
 	}
 
+	return config, nil
+}
+
+// ConfiguredClusterIDs returns the clusterIDs of all clusters in the
+// configuration.
+func ConfiguredClusterIDs(pathToConfig string) ([]string, error) {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the configuration of the clusters: %w", err)
+	}
+
+	clusterIDs := make([]string, 0, len(config))
 	for i := range config {
-		if config[i].ClusterID == clusterID {
-			return &config[i], nil
-		}
+		clusterIDs = append(clusterIDs, config[i].ClusterID)
 	}
 
-	return nil, fmt.Errorf("missing configuration for cluster ID %q", clusterID)
+	return clusterIDs, nil
 }
 
 // Mons returns a comma separated MON list from the csi config for the given clusterID.
@@ -110,6 +142,28 @@ func GetRBDRadosNamespace(pathToConfig, clusterID string) (string, error) {
 	return cluster.RBD.RadosNamespace, nil
 }
 
+// GetRBDCreateRadosNamespace returns true when the RADOS namespace of the
+// given clusterID is created for RBD volumes when it does not exist.
+func GetRBDCreateRadosNamespace(pathToConfig, clusterID string) (bool, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return false, err
+	}
+
+	return cluster.RBD.CreateRadosNamespace, nil
+}
+
+// GetRBDRadosNamespacePools returns the pools in which the RADOS namespace of
+// the given clusterID is validated when the provisioner starts.
+func GetRBDRadosNamespacePools(pathToConfig, clusterID string) ([]string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return cluster.RBD.RadosNamespacePools, nil
+}
+
 // GetCephFSRadosNamespace returns the namespace for the given clusterID.
 // If not set, it returns the default value "csi".
 func GetCephFSRadosNamespace(pathToConfig, clusterID string) (string, error) {
@@ -232,6 +286,81 @@ func GetCrushLocationLabels(pathToConfig, clusterID string) (bool, string, error
 	return true, crushLocationLabels, nil
 }
 
+// GetRBDMapOptions returns the default map options for RBD volumes, and the
+// map options of all entries in `rbd.nodeMapOptions` that match the
+// nodeLabels, in the order of the CSI config for the given clusterID.
+func GetRBDMapOptions(pathToConfig, clusterID string, nodeLabels map[string]string) (string, []string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var nodeMapOptions []string
+	for _, nmo := range cluster.RBD.NodeMapOptions {
+		if nmo.MapOptions == "" || !matchesNodeLabels(nmo.NodeLabels, nodeLabels) {
+			continue
+		}
+		nodeMapOptions = append(nodeMapOptions, nmo.MapOptions)
+	}
+
+	return cluster.RBD.MapOptions, nodeMapOptions, nil
+}
+
+// GetRBDMkfsOptionsAllowList returns the mkfs options that can be used for
+// RBD volumes of the given clusterID. An empty list allows all options.
+func GetRBDMkfsOptionsAllowList(pathToConfig, clusterID string) ([]string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return cluster.RBD.MkfsOptionsAllowList, nil
+}
+
+// GetRBDNamespaceQuota returns the quota for the RBD volumes in the pool and
+// RADOS namespace of the given clusterID. nil is returned when there is no
+// quota configured.
+func GetRBDNamespaceQuota(
+	pathToConfig, clusterID, pool, radosNamespace string,
+) (*kubernetes.NamespaceQuota, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range cluster.RBD.NamespaceQuotas {
+		quota := &cluster.RBD.NamespaceQuotas[i]
+		if quota.Pool == pool && quota.RadosNamespace == radosNamespace {
+			return quota, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetRBDManagementOps returns the rbd_concurrent_management_ops for the
+// background operations on the RBD images of the given clusterID.
+func GetRBDManagementOps(pathToConfig, clusterID string) (kubernetes.ManagementOps, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return kubernetes.ManagementOps{}, err
+	}
+
+	return cluster.RBD.ManagementOps, nil
+}
+
+// matchesNodeLabels returns true when all the selector labels are set with the
+// same value in the nodeLabels.
+func matchesNodeLabels(selector, nodeLabels map[string]string) bool {
+	for key, value := range selector {
+		if nodeLabels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
 // GetCephFSMountOptions returns the `kernelMountOptions` and `fuseMountOptions` for CephFS volumes.
 func GetCephFSMountOptions(pathToConfig, clusterID string) (string, string, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
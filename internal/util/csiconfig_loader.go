@@ -0,0 +1,244 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// csiConfigRefreshInterval is the interval to check the CSI
+	// configuration for changes.
+	csiConfigRefreshInterval = 10 * time.Second
+
+	// CSIConfigRevisionKey is the key in the manifest of GetPluginInfo with
+	// the revision of the loaded CSI configuration.
+	CSIConfigRevisionKey = "configRevision"
+	// CSIConfigRejectedEntriesKey is the key in the manifest of
+	// GetPluginInfo with the number of entries that were rejected while
+	// loading the CSI configuration.
+	CSIConfigRejectedEntriesKey = "configRejectedEntries"
+)
+
+// loadedCSIConfig is the validated CSI configuration that is used for the
+// operations, it is replaced as a whole when the configuration changes.
+type loadedCSIConfig struct {
+	path     string
+	clusters []kubernetes.ClusterInfo
+	// revision is the checksum of the contents of the file
+	revision string
+	// rejected is the number of entries that failed validation
+	rejected int
+}
+
+var currentCSIConfig atomic.Pointer[loadedCSIConfig]
+
+// getLoadedCSIConfig returns the clusters of the loaded CSI configuration if
+// it was loaded from the path.
+func getLoadedCSIConfig(pathToConfig string) ([]kubernetes.ClusterInfo, bool) {
+	loaded := currentCSIConfig.Load()
+	if loaded == nil || loaded.path != pathToConfig {
+		return nil, false
+	}
+
+	return loaded.clusters, true
+}
+
+// validateClusterInfo returns an error when the configuration of the cluster
+// can not be used.
+func validateClusterInfo(cluster *kubernetes.ClusterInfo) error {
+	if cluster.ClusterID == "" {
+		return errors.New("missing clusterID")
+	}
+
+	if len(cluster.Monitors) == 0 {
+		return fmt.Errorf("cluster ID %q has no monitors", cluster.ClusterID)
+	}
+
+	if cluster.RBD.MirrorDaemonCount < 0 {
+		return fmt.Errorf("cluster ID %q has a negative mirrorDaemonCount", cluster.ClusterID)
+	}
+
+	for _, quota := range cluster.RBD.NamespaceQuotas {
+		if quota.Pool == "" {
+			return fmt.Errorf("cluster ID %q has a namespace quota without pool", cluster.ClusterID)
+		}
+
+		if quota.MaxBytes < 0 || quota.MaxVolumes < 0 {
+			return fmt.Errorf("cluster ID %q has a negative namespace quota for pool %q",
+				cluster.ClusterID, quota.Pool)
+		}
+	}
+
+	limits := cluster.OperationLimits
+	if limits.Create < 0 || limits.Delete < 0 || limits.Clone < 0 || limits.Snapshot < 0 {
+		return fmt.Errorf("cluster ID %q has a negative operation limit", cluster.ClusterID)
+	}
+
+	if err := validateMsMode(cluster.MsMode); err != nil {
+		return fmt.Errorf("cluster ID %q: %w", cluster.ClusterID, err)
+	}
+
+	if _, err := parseSnapshotLimits(cluster.SnapshotLimits, nil); err != nil {
+		return fmt.Errorf("cluster ID %q has invalid snapshot limits: %w", cluster.ClusterID, err)
+	}
+
+	return nil
+}
+
+// parseCSIConfig parses and validates the contents of the CSI configuration.
+// Entries that fail validation are rejected, the entry with the same clusterID
+// of the previous configuration is kept for them. The number of rejected
+// entries is returned too.
+func parseCSIConfig(
+	ctx context.Context,
+	content []byte,
+	previous []kubernetes.ClusterInfo,
+) ([]kubernetes.ClusterInfo, int, error) {
+	var config []kubernetes.ClusterInfo
+	if err := json.Unmarshal(content, &config); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal failed (%w), raw buffer response: %s",
+			err, string(content))
+	}
+
+	clusters := make([]kubernetes.ClusterInfo, 0, len(config))
+	seen := make(map[string]bool, len(config))
+	rejected := 0
+	for i := range config {
+		cluster := &config[i]
+		err := validateClusterInfo(cluster)
+		if err == nil && seen[cluster.ClusterID] {
+			err = fmt.Errorf("duplicate cluster ID %q", cluster.ClusterID)
+		}
+		if err == nil {
+			seen[cluster.ClusterID] = true
+			clusters = append(clusters, *cluster)
+
+			continue
+		}
+
+		rejected++
+		log.ErrorLog(ctx, "rejected entry %d of the CSI configuration: %v", i, err)
+
+		if cluster.ClusterID == "" || seen[cluster.ClusterID] {
+			continue
+		}
+
+		for j := range previous {
+			if previous[j].ClusterID == cluster.ClusterID {
+				log.WarningLog(ctx, "keeping the previous configuration of cluster ID %q", cluster.ClusterID)
+				seen[cluster.ClusterID] = true
+				clusters = append(clusters, previous[j])
+
+				break
+			}
+		}
+	}
+
+	return clusters, rejected, nil
+}
+
+// LoadCSIConfig loads the CSI configuration from the file, if its contents
+// changed since it was loaded last. Operations use the loaded configuration
+// instead of reading the file. The previously loaded configuration is kept
+// when the file can not be read or parsed.
+func LoadCSIConfig(ctx context.Context, pathToConfig string) error {
+	// #nosec
+	content, err := os.ReadFile(pathToConfig)
+	if err != nil {
+		return fmt.Errorf("failed to read CSI configuration: %w", err)
+	}
+
+	checksum := sha256.Sum256(content)
+	revision := hex.EncodeToString(checksum[:8])
+
+	previous := currentCSIConfig.Load()
+	if previous != nil && previous.path == pathToConfig && previous.revision == revision {
+		return nil
+	}
+
+	var previousClusters []kubernetes.ClusterInfo
+	if previous != nil && previous.path == pathToConfig {
+		previousClusters = previous.clusters
+	}
+
+	clusters, rejected, err := parseCSIConfig(ctx, content, previousClusters)
+	if err != nil {
+		return fmt.Errorf("failed to parse CSI configuration: %w", err)
+	}
+
+	currentCSIConfig.Store(&loadedCSIConfig{
+		path:     pathToConfig,
+		clusters: clusters,
+		revision: revision,
+		rejected: rejected,
+	})
+	log.DefaultLog("loaded revision %s of the CSI configuration with %d clusters, rejected %d entries",
+		revision, len(clusters), rejected)
+
+	return nil
+}
+
+// WatchCSIConfig loads the CSI configuration and reloads it when the file
+// changes, like when the ConfigMap that is mounted is updated.
+func WatchCSIConfig(ctx context.Context, pathToConfig string) {
+	if err := LoadCSIConfig(ctx, pathToConfig); err != nil {
+		log.ErrorLog(ctx, "%v", err)
+	}
+
+	ticker := time.NewTicker(csiConfigRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := LoadCSIConfig(ctx, pathToConfig); err != nil {
+			log.ErrorLog(ctx, "%v", err)
+		}
+	}
+}
+
+// GetCSIConfigManifest returns the revision of the loaded CSI configuration
+// and the number of rejected entries, for the manifest of GetPluginInfo. An
+// empty manifest is returned when no configuration was loaded.
+func GetCSIConfigManifest() map[string]string {
+	loaded := currentCSIConfig.Load()
+	if loaded == nil {
+		return nil
+	}
+
+	return map[string]string{
+		CSIConfigRevisionKey:        loaded.revision,
+		CSIConfigRejectedEntriesKey: strconv.Itoa(loaded.rejected),
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	cluster1 := cephcsi.ClusterInfo{
+		ClusterID: "cluster-1",
+		Monitors:  []string{"ip-1", "ip-2"},
+	}
+	cluster2 := cephcsi.ClusterInfo{
+		ClusterID: "cluster-2",
+		Monitors:  []string{"ip-3"},
+	}
+	previous := []cephcsi.ClusterInfo{cluster1, cluster2}
+
+	tests := []struct {
+		name         string
+		config       []cephcsi.ClusterInfo
+		want         []cephcsi.ClusterInfo
+		wantRejected int
+	}{
+		{
+			name:         "valid entries",
+			config:       []cephcsi.ClusterInfo{cluster1, cluster2},
+			want:         []cephcsi.ClusterInfo{cluster1, cluster2},
+			wantRejected: 0,
+		},
+		{
+			name: "missing clusterID",
+			config: []cephcsi.ClusterInfo{
+				cluster1,
+				{Monitors: []string{"ip-4"}},
+			},
+			want:         []cephcsi.ClusterInfo{cluster1},
+			wantRejected: 1,
+		},
+		{
+			name: "previous entry is kept",
+			config: []cephcsi.ClusterInfo{
+				cluster1,
+				{ClusterID: "cluster-2"},
+			},
+			want:         []cephcsi.ClusterInfo{cluster1, cluster2},
+			wantRejected: 1,
+		},
+		{
+			name: "new invalid entry",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID: "cluster-3",
+					Monitors:  []string{"ip-5"},
+					RBD:       cephcsi.RBD{MirrorDaemonCount: -1},
+				},
+			},
+			want:         []cephcsi.ClusterInfo{},
+			wantRejected: 1,
+		},
+		{
+			name: "invalid namespace quota",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID: "cluster-1",
+					Monitors:  []string{"ip-1"},
+					RBD: cephcsi.RBD{
+						NamespaceQuotas: []cephcsi.NamespaceQuota{{MaxBytes: 1024}},
+					},
+				},
+			},
+			want:         []cephcsi.ClusterInfo{cluster1},
+			wantRejected: 1,
+		},
+		{
+			name: "negative operation limit",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID:       "cluster-2",
+					Monitors:        []string{"ip-3"},
+					OperationLimits: cephcsi.OperationLimits{Clone: -1},
+				},
+			},
+			want:         []cephcsi.ClusterInfo{cluster2},
+			wantRejected: 1,
+		},
+		{
+			name: "invalid msMode",
+			config: []cephcsi.ClusterInfo{
+				{
+					ClusterID: "cluster-2",
+					Monitors:  []string{"ip-3"},
+					MsMode:    "legacy",
+				},
+			},
+			want:         []cephcsi.ClusterInfo{cluster2},
+			wantRejected: 1,
+		},
+		{
+			name:         "duplicate clusterID",
+			config:       []cephcsi.ClusterInfo{cluster1, cluster2, cluster1},
+			want:         []cephcsi.ClusterInfo{cluster1, cluster2},
+			wantRejected: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := json.Marshal(tt.config)
+			require.NoError(t, err)
+
+			got, rejected, err := parseCSIConfig(context.TODO(), content, previous)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantRejected, rejected)
+		})
+	}
+
+	_, _, err := parseCSIConfig(context.TODO(), []byte("{"), previous)
+	require.Error(t, err)
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"os"
+	"reflect"
 	"testing"
 
 	cephcsi "github.com/ceph/ceph-csi/api/deploy/kubernetes"
@@ -612,3 +613,240 @@ func TestGetRBDMirrorDaemonCount(t *testing.T) {
 	_, err = GetRBDMirrorDaemonCount(tmpCSIConfPath, "test")
 	require.Error(t, err)
 }
+
+func TestGetRBDMapOptions(t *testing.T) {
+	t.Parallel()
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			RBD: cephcsi.RBD{
+				MapOptions: "krbd:queue_depth=128",
+				NodeMapOptions: []cephcsi.NodeMapOptions{
+					{
+						NodeLabels: map[string]string{"topology.kubernetes.io/zone": "zone-a"},
+						MapOptions: "krbd:read_from_replica=localize",
+					},
+					{
+						NodeLabels: map[string]string{
+							"topology.kubernetes.io/zone": "zone-a",
+							"node-role":                   "storage",
+						},
+						MapOptions: "krbd:queue_depth=64",
+					},
+					{
+						MapOptions: "nbd:timeout=60",
+					},
+				},
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name               string
+		clusterID          string
+		nodeLabels         map[string]string
+		wantDefault        string
+		wantNodeMapOptions []string
+	}{
+		{
+			name:               "node without labels",
+			clusterID:          "cluster-1",
+			wantDefault:        "krbd:queue_depth=128",
+			wantNodeMapOptions: []string{"nbd:timeout=60"},
+		},
+		{
+			name:        "node with partially matching labels",
+			clusterID:   "cluster-1",
+			nodeLabels:  map[string]string{"topology.kubernetes.io/zone": "zone-a"},
+			wantDefault: "krbd:queue_depth=128",
+			wantNodeMapOptions: []string{
+				"krbd:read_from_replica=localize",
+				"nbd:timeout=60",
+			},
+		},
+		{
+			name:      "node with all labels",
+			clusterID: "cluster-1",
+			nodeLabels: map[string]string{
+				"topology.kubernetes.io/zone": "zone-a",
+				"node-role":                   "storage",
+			},
+			wantDefault: "krbd:queue_depth=128",
+			wantNodeMapOptions: []string{
+				"krbd:read_from_replica=localize",
+				"krbd:queue_depth=64",
+				"nbd:timeout=60",
+			},
+		},
+		{
+			name:       "cluster without map options",
+			clusterID:  "cluster-2",
+			nodeLabels: map[string]string{"topology.kubernetes.io/zone": "zone-a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			defaultMapOptions, nodeMapOptions, err := GetRBDMapOptions(tmpConfPath, tt.clusterID, tt.nodeLabels)
+			if err != nil {
+				t.Errorf("GetRBDMapOptions() error = %v", err)
+
+				return
+			}
+			if defaultMapOptions != tt.wantDefault {
+				t.Errorf("GetRBDMapOptions() default = %q, want %q", defaultMapOptions, tt.wantDefault)
+			}
+			if !reflect.DeepEqual(nodeMapOptions, tt.wantNodeMapOptions) {
+				t.Errorf("GetRBDMapOptions() node map options = %v, want %v", nodeMapOptions, tt.wantNodeMapOptions)
+			}
+		})
+	}
+}
+
+func TestGetRBDNamespaceQuota(t *testing.T) {
+	t.Parallel()
+
+	quota := cephcsi.NamespaceQuota{
+		Pool:           "replicapool",
+		RadosNamespace: "tenant-a",
+		MaxBytes:       10 * 1024 * 1024 * 1024,
+		MaxVolumes:     10,
+	}
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1", "ip-2"},
+			RBD: cephcsi.RBD{
+				RadosNamespace:  "tenant-a",
+				NamespaceQuotas: []cephcsi.NamespaceQuota{quota},
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			Monitors:  []string{"ip-3", "ip-4"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	require.NoError(t, err)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		clusterID      string
+		pool           string
+		radosNamespace string
+		want           *cephcsi.NamespaceQuota
+	}{
+		{
+			name:           "quota for pool and namespace",
+			clusterID:      "cluster-1",
+			pool:           "replicapool",
+			radosNamespace: "tenant-a",
+			want:           &quota,
+		},
+		{
+			name:           "no quota for other pool",
+			clusterID:      "cluster-1",
+			pool:           "otherpool",
+			radosNamespace: "tenant-a",
+			want:           nil,
+		},
+		{
+			name:           "no quota for other namespace",
+			clusterID:      "cluster-1",
+			pool:           "replicapool",
+			radosNamespace: "",
+			want:           nil,
+		},
+		{
+			name:           "no quotas configured",
+			clusterID:      "cluster-2",
+			pool:           "replicapool",
+			radosNamespace: "tenant-a",
+			want:           nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetRBDNamespaceQuota(tmpConfPath, tt.clusterID, tt.pool, tt.radosNamespace)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetRBDRadosNamespaceOptions(t *testing.T) {
+	t.Parallel()
+
+	csiConfig := []cephcsi.ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1", "ip-2"},
+			RBD: cephcsi.RBD{
+				RadosNamespace:       "tenant-a",
+				CreateRadosNamespace: true,
+				RadosNamespacePools:  []string{"replicapool", "ecpool"},
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			Monitors:  []string{"ip-3", "ip-4"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	require.NoError(t, err)
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	require.NoError(t, err)
+
+	clusterIDs, err := ConfiguredClusterIDs(tmpConfPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{"cluster-1", "cluster-2"}, clusterIDs)
+
+	tests := []struct {
+		name       string
+		clusterID  string
+		wantCreate bool
+		wantPools  []string
+	}{
+		{
+			name:       "namespace is created",
+			clusterID:  "cluster-1",
+			wantCreate: true,
+			wantPools:  []string{"replicapool", "ecpool"},
+		},
+		{
+			name:       "not configured",
+			clusterID:  "cluster-2",
+			wantCreate: false,
+			wantPools:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			create, err := GetRBDCreateRadosNamespace(tmpConfPath, tt.clusterID)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCreate, create)
+
+			pools, err := GetRBDRadosNamespacePools(tmpConfPath, tt.clusterID)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantPools, pools)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util/parameters"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errnoCodes maps the errno values that the Ceph libraries and commands
+// return to gRPC codes. Transient errors map to codes that the COs retry
+// (Unavailable, Aborted, DeadlineExceeded), errors that do not go away by
+// retrying map to the matching final code.
+var errnoCodes = map[syscall.Errno]codes.Code{
+	syscall.ENOENT:       codes.NotFound,
+	syscall.ENODATA:      codes.NotFound,
+	syscall.EEXIST:       codes.AlreadyExists,
+	syscall.EINVAL:       codes.InvalidArgument,
+	syscall.ERANGE:       codes.InvalidArgument,
+	syscall.ENAMETOOLONG: codes.InvalidArgument,
+	syscall.EPERM:        codes.PermissionDenied,
+	syscall.EACCES:       codes.PermissionDenied,
+	syscall.ENOSPC:       codes.ResourceExhausted,
+	syscall.EDQUOT:       codes.ResourceExhausted,
+	syscall.EMLINK:       codes.ResourceExhausted,
+	syscall.ENOTEMPTY:    codes.FailedPrecondition,
+	syscall.EROFS:        codes.FailedPrecondition,
+	syscall.EXDEV:        codes.FailedPrecondition,
+	syscall.EOPNOTSUPP:   codes.Unimplemented,
+	syscall.ENOSYS:       codes.Unimplemented,
+	syscall.EBUSY:        codes.Aborted,
+	syscall.EAGAIN:       codes.Unavailable,
+	syscall.EINTR:        codes.Unavailable,
+	syscall.ESHUTDOWN:    codes.Unavailable,
+	syscall.ENOTCONN:     codes.Unavailable,
+	syscall.ECONNREFUSED: codes.Unavailable,
+	syscall.ECONNRESET:   codes.Unavailable,
+	syscall.EHOSTUNREACH: codes.Unavailable,
+	syscall.ETIMEDOUT:    codes.DeadlineExceeded,
+}
+
+// errorCodes maps errors of Ceph-CSI to gRPC codes.
+var errorCodes = map[error]codes.Code{
+	ErrPoolNotFound:                codes.NotFound,
+	ErrObjectNotFound:              codes.NotFound,
+	ErrClusterIDNotSet:             codes.InvalidArgument,
+	ErrSnapNameConflict:            codes.AlreadyExists,
+	ErrSnapshotLimitExceeded:       codes.ResourceExhausted,
+	ErrPublishedForOtherPod:        codes.FailedPrecondition,
+	parameters.ErrInvalidParameter: codes.InvalidArgument,
+	context.Canceled:               codes.Canceled,
+	context.DeadlineExceeded:       codes.DeadlineExceeded,
+}
+
+// errnoOf returns the errno of the error. The errors of go-ceph carry a
+// negative errno, CommandError and errors of the syscall package a positive
+// one.
+func errnoOf(err error) (syscall.Errno, bool) {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno, true
+	}
+
+	var ec interface{ ErrorCode() int }
+	if errors.As(err, &ec) {
+		code := ec.ErrorCode()
+		if code < 0 {
+			code = -code
+		}
+
+		return syscall.Errno(code), true
+	}
+
+	return 0, false
+}
+
+// GRPCCode classifies the error and returns the gRPC code for it. Errors
+// that already are a gRPC status keep their code, errors that can not be
+// classified are Internal.
+func GRPCCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
+	}
+
+	for e, code := range errorCodes {
+		if errors.Is(err, e) {
+			return code
+		}
+	}
+
+	if errno, ok := errnoOf(err); ok {
+		if code, found := errnoCodes[errno]; found {
+			return code
+		}
+	}
+
+	return codes.Internal
+}
+
+// GRPCError returns the error as gRPC status with the code of GRPCCode.
+func GRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return status.Error(GRPCCode(err), err.Error())
+}
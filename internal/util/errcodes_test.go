@@ -0,0 +1,92 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCCode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{
+			name: "no error",
+			err:  nil,
+			want: codes.OK,
+		},
+		{
+			name: "status error",
+			err:  status.Error(codes.Aborted, "operation in progress"),
+			want: codes.Aborted,
+		},
+		{
+			name: "missing pool",
+			err:  fmt.Errorf("failed to get pool ID: %w", ErrPoolNotFound),
+			want: codes.NotFound,
+		},
+		{
+			name: "timeout of the context",
+			err:  fmt.Errorf("failed to connect: %w", context.DeadlineExceeded),
+			want: codes.DeadlineExceeded,
+		},
+		{
+			name: "negative errno of go-ceph",
+			err:  fmt.Errorf("failed to create image: %w", errorCodeError(-int(syscall.EEXIST))),
+			want: codes.AlreadyExists,
+		},
+		{
+			name: "monitor timeout",
+			err:  errorCodeError(-int(syscall.ETIMEDOUT)),
+			want: codes.DeadlineExceeded,
+		},
+		{
+			name: "command error",
+			err:  &CommandError{Name: "fs subvolume resize", Errno: syscall.EDQUOT},
+			want: codes.ResourceExhausted,
+		},
+		{
+			name: "unknown errno",
+			err:  syscall.ENOTTY,
+			want: codes.Internal,
+		},
+		{
+			name: "unclassified error",
+			err:  errors.New("something failed"),
+			want: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, GRPCCode(tt.err))
+		})
+	}
+}
@@ -36,4 +36,7 @@ var (
 	ErrClusterIDNotSet = errors.New("clusterID must be set")
 	// ErrMissingConfigForMonitor is returned when clusterID is not found for the mon.
 	ErrMissingConfigForMonitor = errors.New("missing configuration of cluster ID for monitor")
+	// ErrSnapshotLimitExceeded is returned when a snapshot of a volume would
+	// exceed the configured snapshot limits of the volume.
+	ErrSnapshotLimitExceeded = errors.New("snapshot limit of the volume exceeded")
 )
@@ -74,15 +74,17 @@ func getPassphrase(ctx context.Context, encryption util.VolumeEncryption, volID
 		err        error
 	)
 
-	switch encryption.KMS.RequiresDEKStore() {
-	case kms.DEKStoreIntegrated:
+	// KMS that do not store the DEK themselves either provide the
+	// passphrase with GetSecret, or a DEKStore has been configured.
+	switch {
+	case encryption.HasDEKStore():
 		passphrase, err = encryption.GetCryptoPassphrase(ctx, volID)
 		if err != nil {
 			log.ErrorLog(ctx, "fscrypt: failed to get passphrase from KMS: %v", err)
 
 			return "", err
 		}
-	case kms.DEKStoreMetadata:
+	case encryption.KMS.RequiresDEKStore() == kms.DEKStoreMetadata:
 		passphrase, err = encryption.KMS.GetSecret(ctx, volID)
 		if err != nil {
 			log.ErrorLog(ctx, "fscrypt: failed to GetSecret: %v", err)
@@ -433,15 +435,15 @@ func Unlock(
 
 	protectorName := FscryptProtectorPrefix
 
-	switch volEncryption.KMS.RequiresDEKStore() {
-	case kms.DEKStoreMetadata:
+	switch {
+	case volEncryption.HasDEKStore():
+		fscryptContext.Config.Source = fscryptmetadata.SourceType_raw_key
+	case volEncryption.KMS.RequiresDEKStore() == kms.DEKStoreMetadata:
 		// Metadata style KMS use the KMS secret as a custom
 		// passphrase directly in fscrypt, circumenting key
 		// derivation on the CSI side to allow users to fall
 		// back on the fscrypt commandline tool easily
 		fscryptContext.Config.Source = fscryptmetadata.SourceType_custom_passphrase
-	case kms.DEKStoreIntegrated:
-		fscryptContext.Config.Source = fscryptmetadata.SourceType_raw_key
 	}
 
 	if kernelPolicyExists && metadataDirExists {
@@ -452,7 +454,7 @@ func Unlock(
 
 	if !kernelPolicyExists && !metadataDirExists {
 		log.DebugLog(ctx, "fscrypt: Creating new protector and policy")
-		if volEncryption.KMS.RequiresDEKStore() == kms.DEKStoreIntegrated {
+		if volEncryption.HasDEKStore() {
 			if err := volEncryption.StoreNewCryptoPassphrase(ctx, volID, encryptionPassphraseSize); err != nil {
 				log.ErrorLog(ctx, "fscrypt: store new crypto passphrase failed: %v", err)
 
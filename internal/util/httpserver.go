@@ -24,9 +24,13 @@ func ValidateURL(c *Config) error {
 func StartMetricsServer(c *Config) {
 	addr := net.JoinHostPort(c.MetricsIP, strconv.Itoa(c.MetricsPort))
 	http.Handle(c.MetricsPath, promhttp.Handler())
+	err := registerLockHandlers(c.LockBreakDeadline, c.LockBreakTokenFile)
+	if err != nil {
+		log.FatalLogMsg("failed to register the lock handlers: %v", err)
+	}
 
 	//nolint:gosec // TODO: add support for passing timeouts
-	err := http.ListenAndServe(addr, nil)
+	err = http.ListenAndServe(addr, nil)
 	if err != nil {
 		log.FatalLogMsg("failed to listen on address %v: %s", addr, err)
 	}
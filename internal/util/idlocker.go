@@ -16,10 +16,9 @@ package util
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
-
-	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 const (
@@ -33,38 +32,98 @@ const (
 	TargetPathOperationAlreadyExistsFmt = "an operation with the given target path %s already exists"
 )
 
-// VolumeLocks implements a map with atomic operations. It stores a set of all volume IDs
-// with an ongoing operation.
+// LockToken identifies an acquisition of a lock of VolumeLocks.
+type LockToken uint64
+
+// volumeLock is a lock of VolumeLocks that is held since the time, with the
+// token of its acquisition.
+type volumeLock struct {
+	since time.Time
+	token LockToken
+}
+
+// VolumeLocks implements a map with atomic operations. It stores all volume IDs
+// with an ongoing operation, together with the time the operation started.
 type VolumeLocks struct {
-	locks sets.Set[string]
-	mux   sync.Mutex
+	locks map[string]volumeLock
+	// lastToken is the token of the last acquired lock
+	lastToken LockToken
+	mux       sync.Mutex
 }
 
 // NewVolumeLocks returns new VolumeLocks.
 func NewVolumeLocks() *VolumeLocks {
 	return &VolumeLocks{
-		locks: sets.New[string](),
+		locks: make(map[string]volumeLock),
 	}
 }
 
+// NewNamedVolumeLocks returns new VolumeLocks that are registered with the
+// name, so that the locks are exported as metrics and can be listed (and
+// released) through the metrics server. The name needs to be unique in the
+// process.
+func NewNamedVolumeLocks(name string) *VolumeLocks {
+	vl := NewVolumeLocks()
+	registerVolumeLocks(name, vl)
+
+	return vl
+}
+
 // TryAcquire tries to acquire the lock for operating on volumeID and returns true if successful.
-// If another operation is already using volumeID, returns false.
-func (vl *VolumeLocks) TryAcquire(volumeID string) bool {
+// If another operation is already using volumeID, returns false. The returned
+// token needs to be passed to Release.
+func (vl *VolumeLocks) TryAcquire(volumeID string) (LockToken, bool) {
 	vl.mux.Lock()
 	defer vl.mux.Unlock()
-	if vl.locks.Has(volumeID) {
-		return false
+	if _, ok := vl.locks[volumeID]; ok {
+		return 0, false
 	}
-	vl.locks.Insert(volumeID)
+	vl.lastToken++
+	vl.locks[volumeID] = volumeLock{since: time.Now(), token: vl.lastToken}
 
-	return true
+	return vl.lastToken, true
 }
 
-// Release deletes the lock on volumeID.
-func (vl *VolumeLocks) Release(volumeID string) {
+// Release deletes the lock on volumeID, when it is still held with the token
+// of its acquisition. Nothing happens when the lock was released through the
+// metrics server in the meantime, and possibly acquired by another operation.
+func (vl *VolumeLocks) Release(volumeID string, token LockToken) {
 	vl.mux.Lock()
 	defer vl.mux.Unlock()
-	vl.locks.Delete(volumeID)
+	if lock, ok := vl.locks[volumeID]; ok && lock.token == token {
+		delete(vl.locks, volumeID)
+	}
+}
+
+// acquired returns the IDs of the held locks, with the time they were
+// acquired.
+func (vl *VolumeLocks) acquired() map[string]time.Time {
+	vl.mux.Lock()
+	defer vl.mux.Unlock()
+
+	acquired := make(map[string]time.Time, len(vl.locks))
+	for id, lock := range vl.locks {
+		acquired[id] = lock.since
+	}
+
+	return acquired
+}
+
+// releaseOlderThan releases the lock on volumeID, when it was acquired longer
+// than the age ago. It returns false when the lock is not held, or when it is
+// younger. The operation that holds the lock can not release the lock anymore
+// once it continues, its token is stale.
+func (vl *VolumeLocks) releaseOlderThan(volumeID string, age time.Duration) bool {
+	vl.mux.Lock()
+	defer vl.mux.Unlock()
+
+	lock, ok := vl.locks[volumeID]
+	if !ok || time.Since(lock.since) < age {
+		return false
+	}
+	delete(vl.locks, volumeID)
+
+	return true
 }
 
 type operation string
@@ -26,7 +26,7 @@ func TestIDLocker(t *testing.T) {
 	fakeID := "fake-id"
 	locks := NewVolumeLocks()
 	// acquire lock for fake-id
-	ok := locks.TryAcquire(fakeID)
+	token, ok := locks.TryAcquire(fakeID)
 
 	if !ok {
 		t.Errorf("TryAcquire failed: want (%v), got (%v)",
@@ -35,7 +35,7 @@ func TestIDLocker(t *testing.T) {
 
 	// try to acquire lock  again for fake-id, as lock is already present
 	// it should fail
-	ok = locks.TryAcquire(fakeID)
+	_, ok = locks.TryAcquire(fakeID)
 
 	if ok {
 		t.Errorf("TryAcquire failed: want (%v), got (%v)",
@@ -43,8 +43,8 @@ func TestIDLocker(t *testing.T) {
 	}
 
 	// release the lock for fake-id and try to get lock again, it should pass
-	locks.Release(fakeID)
-	ok = locks.TryAcquire(fakeID)
+	locks.Release(fakeID, token)
+	_, ok = locks.TryAcquire(fakeID)
 
 	if !ok {
 		t.Errorf("TryAcquire failed: want (%v), got (%v)",
@@ -0,0 +1,122 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// volumeRecorder posts the events of volumes, events are not posted when it
+// is nil.
+var volumeRecorder record.EventRecorder
+
+// EnableVolumeEvents starts to post events on the PersistentVolumes and
+// PersistentVolumeClaims of volumes, with the component and the host as
+// source of the events.
+func EnableVolumeEvents(component, host string) error {
+	client, err := NewK8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to create client for volume events: %w", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	volumeRecorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component, Host: host})
+
+	return nil
+}
+
+// VolumeEventsEnabled returns true when events of volumes are posted.
+func VolumeEventsEnabled() bool {
+	return volumeRecorder != nil
+}
+
+// VolumeObjects contains the names of the Kubernetes objects of a volume.
+type VolumeObjects struct {
+	PVName       string `json:"pvName,omitempty"`
+	PVCName      string `json:"pvcName,omitempty"`
+	PVCNamespace string `json:"pvcNamespace,omitempty"`
+}
+
+// GetVolumeObjects returns the Kubernetes objects of a volume from its
+// metadata, like the metadata of PrepareVolumeMetadata.
+func GetVolumeObjects(metadata map[string]string) VolumeObjects {
+	return VolumeObjects{
+		PVName:       metadata[pvNameKey],
+		PVCName:      metadata[pvcNameKey],
+		PVCNamespace: metadata[pvcNamespaceKey],
+	}
+}
+
+// Event posts an event on the PersistentVolume and the
+// PersistentVolumeClaim of the volume, when events are enabled. The objects
+// are read in the background, so that the requests are not delayed by the
+// Kubernetes API.
+func (vo VolumeObjects) Event(ctx context.Context, eventType, reason, messageFmt string, args ...any) {
+	if volumeRecorder == nil || (vo.PVName == "" && vo.PVCName == "") {
+		return
+	}
+
+	go func() {
+		for _, obj := range vo.objects(ctx) {
+			volumeRecorder.Eventf(obj, eventType, reason, messageFmt, args...)
+		}
+	}()
+}
+
+// objects returns the objects of the volume that exist.
+func (vo VolumeObjects) objects(ctx context.Context) []runtime.Object {
+	client, err := NewK8sClient()
+	if err != nil {
+		log.WarningLog(ctx, "failed to post volume event: %v", err)
+
+		return nil
+	}
+
+	// the context of the request may be done before the objects are read
+	ctx = context.WithoutCancel(ctx)
+	objects := []runtime.Object{}
+	if vo.PVName != "" {
+		pv, err := client.CoreV1().PersistentVolumes().Get(ctx, vo.PVName, metav1.GetOptions{})
+		if err != nil {
+			log.WarningLog(ctx, "failed to get PersistentVolume %q for event: %v", vo.PVName, err)
+		} else {
+			objects = append(objects, pv)
+		}
+	}
+	if vo.PVCName != "" && vo.PVCNamespace != "" {
+		pvc, err := client.CoreV1().PersistentVolumeClaims(vo.PVCNamespace).Get(ctx, vo.PVCName, metav1.GetOptions{})
+		if err != nil {
+			log.WarningLog(ctx, "failed to get PersistentVolumeClaim %s/%s for event: %v",
+				vo.PVCNamespace, vo.PVCName, err)
+		} else {
+			objects = append(objects, pvc)
+		}
+	}
+
+	return objects
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVolumeObjects(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		want     VolumeObjects
+	}{
+		{
+			name:     "no metadata",
+			metadata: map[string]string{},
+			want:     VolumeObjects{},
+		},
+		{
+			name:     "metadata of a volume",
+			metadata: PrepareVolumeMetadata("data", "apps", "pvc-0123"),
+			want: VolumeObjects{
+				PVName:       "pvc-0123",
+				PVCName:      "data",
+				PVCNamespace: "apps",
+			},
+		},
+		{
+			name: "metadata of a snapshot",
+			metadata: map[string]string{
+				"csi.storage.k8s.io/volumesnapshot/name":      "snap",
+				"csi.storage.k8s.io/volumesnapshot/namespace": "apps",
+			},
+			want: VolumeObjects{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, GetVolumeObjects(tt.metadata))
+		})
+	}
+}
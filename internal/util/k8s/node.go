@@ -37,3 +37,26 @@ func GetNodeLabels(nodeName string) (map[string]string, error) {
 
 	return node.GetLabels(), nil
 }
+
+// GetNodeNamesByAddress returns the names of the nodes in the cluster, mapped
+// by the addresses of the nodes.
+func GetNodeNamesByAddress(ctx context.Context) (map[string]string, error) {
+	client, err := NewK8sClient()
+	if err != nil {
+		return nil, fmt.Errorf("can not list nodes, failed to connect to Kubernetes: %w", err)
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	names := map[string]string{}
+	for i := range nodes.Items {
+		for _, addr := range nodes.Items[i].Status.Addresses {
+			names[addr.Address] = nodes.Items[i].Name
+		}
+	}
+
+	return names, nil
+}
@@ -16,6 +16,10 @@ limitations under the License.
 package k8s
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -34,6 +38,23 @@ const (
 	volSnapNameKey        = csiParameterPrefix + "volumesnapshot/name"
 	volSnapNamespaceKey   = csiParameterPrefix + "volumesnapshot/namespace"
 	volSnapContentNameKey = csiParameterPrefix + "volumesnapshotcontent/name"
+
+	// UserMetadataPrefix is the prefix of the StorageClass parameters that
+	// are stored as metadata on the image or subvolume of a volume.
+	UserMetadataPrefix = "imageMetadata/"
+
+	// includeVolumeSnapshotNameKey is the VolumeSnapshotClass parameter that
+	// adds the namespace and name of the VolumeSnapshot to the names of the
+	// snapshots in Ceph.
+	includeVolumeSnapshotNameKey = "includeVolumeSnapshotName"
+
+	// maxSnapshotLabelLength is the maximum length of the label of a
+	// snapshot, so that the names of the snapshots stay usable with the
+	// name limits of RBD images and CephFS directories.
+	maxSnapshotLabelLength = 64
+	// snapshotLabelHashLength is the number of hex characters of the hash
+	// that replaces the end of labels that are too long.
+	snapshotLabelHashLength = 8
 )
 
 // RemoveCSIPrefixedParameters removes parameters prefixed with csiParameterPrefix.
@@ -118,3 +139,66 @@ func GetSnapshotMetadataKeys() []string {
 		volSnapContentNameKey,
 	}
 }
+
+// GetUserMetadata filter parameters, only return the parameters with the
+// UserMetadataPrefix. The keys keep the prefix, so that the metadata can be
+// told apart from the metadata of Ceph-CSI and other tools.
+func GetUserMetadata(parameters map[string]string) map[string]string {
+	newParam := map[string]string{}
+	for k, v := range parameters {
+		if IsUserMetadataKey(k) {
+			newParam[k] = v
+		}
+	}
+
+	return newParam
+}
+
+// IsUserMetadataKey returns true when the metadata key has the
+// UserMetadataPrefix.
+func IsUserMetadataKey(key string) bool {
+	return strings.HasPrefix(key, UserMetadataPrefix) && len(key) > len(UserMetadataPrefix)
+}
+
+// GetSnapshotLabel returns the label of the VolumeSnapshot that is added to
+// the name of the snapshot in Ceph, when the includeVolumeSnapshotName
+// parameter is set. The label is "<namespace>_<name>", the underscore can
+// not be part of Kubernetes names. Labels that are longer than
+// maxSnapshotLabelLength are shortened and end with a hash of the complete
+// label, so that they stay unique. An empty label is returned when the
+// parameter is not set, or the VolumeSnapshot is not passed by the
+// csi-snapshotter with --extra-create-metadata.
+func GetSnapshotLabel(parameters map[string]string) (string, error) {
+	val, ok := parameters[includeVolumeSnapshotNameKey]
+	if !ok {
+		return "", nil
+	}
+
+	include, err := strconv.ParseBool(val)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s %q: %w", includeVolumeSnapshotNameKey, val, err)
+	}
+
+	name := parameters[volSnapNameKey]
+	namespace := parameters[volSnapNamespaceKey]
+	if !include || name == "" || namespace == "" {
+		return "", nil
+	}
+
+	return encodeSnapshotLabel(namespace, name), nil
+}
+
+// encodeSnapshotLabel returns the label of the VolumeSnapshot with at most
+// maxSnapshotLabelLength characters.
+func encodeSnapshotLabel(namespace, name string) string {
+	label := namespace + "_" + name
+	if len(label) <= maxSnapshotLabelLength {
+		return label
+	}
+
+	sum := sha256.Sum256([]byte(label))
+	hash := hex.EncodeToString(sum[:])[:snapshotLabelHashLength]
+	prefix := strings.TrimRight(label[:maxSnapshotLabelLength-snapshotLabelHashLength-1], "-._")
+
+	return prefix + "-" + hash
+}
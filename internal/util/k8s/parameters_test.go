@@ -17,6 +17,7 @@ package k8s
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -91,3 +92,125 @@ func TestGetOwner(t *testing.T) {
 		})
 	}
 }
+
+func TestGetUserMetadata(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		param map[string]string
+		want  map[string]string
+	}{
+		{
+			name: "without user metadata",
+			param: map[string]string{
+				"foo":                         "bar",
+				"csi.storage.k8s.io/pvc/name": "foo",
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "with user metadata",
+			param: map[string]string{
+				"foo":                   "bar",
+				"imageMetadata/owner":   "team-a",
+				"imageMetadata/cost/id": "42",
+				"imageMetadata/":        "no key",
+			},
+			want: map[string]string{
+				"imageMetadata/owner":   "team-a",
+				"imageMetadata/cost/id": "42",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := GetUserMetadata(tt.param)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetUserMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSnapshotLabel(t *testing.T) {
+	t.Parallel()
+	longName := strings.Repeat("snapshot-", 10)
+	tests := []struct {
+		name    string
+		param   map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "not enabled",
+			param: map[string]string{
+				"csi.storage.k8s.io/volumesnapshot/name":      "snap-1",
+				"csi.storage.k8s.io/volumesnapshot/namespace": "team-a",
+			},
+			want: "",
+		},
+		{
+			name: "enabled",
+			param: map[string]string{
+				"includeVolumeSnapshotName":                   "true",
+				"csi.storage.k8s.io/volumesnapshot/name":      "snap-1",
+				"csi.storage.k8s.io/volumesnapshot/namespace": "team-a",
+			},
+			want: "team-a_snap-1",
+		},
+		{
+			name: "without extra create metadata",
+			param: map[string]string{
+				"includeVolumeSnapshotName": "true",
+			},
+			want: "",
+		},
+		{
+			name: "shortened",
+			param: map[string]string{
+				"includeVolumeSnapshotName":                   "true",
+				"csi.storage.k8s.io/volumesnapshot/name":      longName,
+				"csi.storage.k8s.io/volumesnapshot/namespace": "team-a",
+			},
+			want: encodeSnapshotLabel("team-a", longName),
+		},
+		{
+			name: "invalid value",
+			param: map[string]string{
+				"includeVolumeSnapshotName": "yes please",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetSnapshotLabel(tt.param)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetSnapshotLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetSnapshotLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeSnapshotLabel(t *testing.T) {
+	t.Parallel()
+	name := strings.Repeat("a", 100)
+	label := encodeSnapshotLabel("team-a", name)
+	if len(label) != maxSnapshotLabelLength {
+		t.Errorf("encodeSnapshotLabel() returned %d characters, want %d", len(label), maxSnapshotLabelLength)
+	}
+	if !strings.HasPrefix(label, "team-a_aaa") {
+		t.Errorf("encodeSnapshotLabel() = %q, want the start of the label", label)
+	}
+
+	// labels that only differ after the cut get different hashes
+	other := encodeSnapshotLabel("team-a", name+"b")
+	if label == other {
+		t.Errorf("encodeSnapshotLabel() returned %q for different labels", label)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// StorageClass parameters that reference the secret which the
+	// external-provisioner passes with CreateVolume requests.
+	provisionerSecretNameKey      = csiParameterPrefix + "provisioner-secret-name"
+	provisionerSecretNamespaceKey = csiParameterPrefix + "provisioner-secret-namespace"
+)
+
+// ErrNoProvisionerSecret is returned when the parameters do not reference a
+// provisioner secret that can be resolved without a PersistentVolumeClaim.
+var ErrNoProvisionerSecret = errors.New("no provisioner secret in parameters")
+
+// getProvisionerSecretRef returns the namespace and name of the provisioner
+// secret in the parameters. Templated references like `${pvc.namespace}`
+// can not be resolved and are rejected.
+func getProvisionerSecretRef(params map[string]string) (string, string, error) {
+	name := params[provisionerSecretNameKey]
+	namespace := params[provisionerSecretNamespaceKey]
+	if name == "" || namespace == "" {
+		return "", "", ErrNoProvisionerSecret
+	}
+
+	if strings.Contains(name, "${") || strings.Contains(namespace, "${") {
+		return "", "", fmt.Errorf("%w: templated secret %s/%s", ErrNoProvisionerSecret, namespace, name)
+	}
+
+	return namespace, name, nil
+}
+
+// GetProvisionerSecret returns the contents of the provisioner secret that is
+// referenced by the StorageClass parameters. Requests like GetCapacity do not
+// contain secrets, but the external-provisioner passes the parameters of the
+// StorageClass with them.
+func GetProvisionerSecret(ctx context.Context, params map[string]string) (map[string]string, error) {
+	namespace, name, err := getProvisionerSecretRef(params)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewK8sClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Kubernetes: %w", err)
+	}
+
+	secret, err := c.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	secrets := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		secrets[k] = string(v)
+	}
+
+	return secrets, nil
+}
+
+// StoreSecret creates the secret with the data in the namespace, or updates
+// the data of the secret when it exists already.
+func StoreSecret(ctx context.Context, namespace, name string, data map[string]string) error {
+	c, err := NewK8sClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Kubernetes: %w", err)
+	}
+
+	secret, err := c.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			StringData: data,
+		}
+		_, err = c.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %w", namespace, name, err)
+		}
+
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	changed := false
+	for k, v := range data {
+		if string(secret.Data[k]) != v {
+			changed = true
+
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	secret.StringData = data
+	_, err = c.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", namespace, name, err)
+	}
+
+	return nil
+}
@@ -18,6 +18,7 @@ package lock
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"syscall"
 	"time"
@@ -27,10 +28,20 @@ import (
 	"github.com/ceph/ceph-csi/internal/util/log"
 )
 
+// ErrBusy is returned by LockExclusive when the lock is held by another
+// client and cookie pair.
+var ErrBusy = errors.New("lock is already held by another client and cookie pair")
+
+// lockFlagMayRenew is LIBRADOS_LOCK_FLAG_MAY_RENEW, it allows acquiring a
+// lock that is already held by the same client and cookie pair, which resets
+// the duration of the lock.
+const lockFlagMayRenew byte = 0x1
+
 // IOCtxLock provides methods for acquiring and releasing exclusive locks on a volume.
 // using rados IO context locks.
 type IOCtxLock interface {
 	LockExclusive(ctx context.Context) error
+	Renew(ctx context.Context) error
 	Unlock(ctx context.Context)
 }
 
@@ -77,8 +88,7 @@ func (lck *lock) LockExclusive(ctx context.Context) error {
 	if ret != 0 {
 		switch ret {
 		case -int(syscall.EBUSY):
-			return fmt.Errorf("lock is already held by another client and cookie pair for %v volume",
-				lck.volID)
+			return fmt.Errorf("%w for %v volume", ErrBusy, lck.volID)
 		case -int(syscall.EEXIST):
 			return fmt.Errorf("lock is already held by the same client and cookie pair for %v volume",
 				lck.volID)
@@ -90,6 +100,29 @@ func (lck *lock) LockExclusive(ctx context.Context) error {
 	return nil
 }
 
+// Renew resets the duration of the exclusive lock that is held by the name
+// and cookie pair. The lock is acquired again when it expired in the
+// meantime and no other client holds it.
+func (lck *lock) Renew(ctx context.Context) error {
+	flags := lockFlagMayRenew
+	ret, err := lck.ioctx.LockExclusive(
+		lck.volID,
+		lck.lockName,
+		lck.lockCookie,
+		lck.lockDesc,
+		lck.timeout,
+		&flags)
+
+	switch ret {
+	case 0:
+		return nil
+	case -int(syscall.EBUSY):
+		return fmt.Errorf("%w for %v volume", ErrBusy, lck.volID)
+	default:
+		return fmt.Errorf("failed to renew lock of volume ID %v: %w", lck.volID, err)
+	}
+}
+
 // Unlock releases the exclusive lock on the volume.
 func (lck *lock) Unlock(ctx context.Context) {
 	ret, err := lck.ioctx.Unlock(lck.volID, lck.lockName, lck.lockCookie)
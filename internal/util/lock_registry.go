@@ -0,0 +1,218 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// locksPath is the path on the metrics server to list the locks.
+	locksPath = "/locks"
+	// releaseLockPath is the path on the metrics server to release a lock.
+	releaseLockPath = "/locks/release"
+)
+
+// lockRegistry contains the named VolumeLocks of the process.
+type lockRegistry struct {
+	mutex sync.RWMutex
+	locks map[string]*VolumeLocks
+}
+
+var (
+	volumeLocksRegistry = &lockRegistry{
+		locks: make(map[string]*VolumeLocks),
+	}
+
+	lockAgeDesc = prometheus.NewDesc(
+		"csi_lock_age_seconds",
+		"Time since the lock for the operation on the ID was acquired",
+		[]string{"locks", "id"}, nil)
+)
+
+func init() {
+	prometheus.MustRegister(volumeLocksRegistry)
+}
+
+// registerVolumeLocks adds the VolumeLocks to the registry with the name.
+func registerVolumeLocks(name string, vl *VolumeLocks) {
+	volumeLocksRegistry.mutex.Lock()
+	defer volumeLocksRegistry.mutex.Unlock()
+
+	volumeLocksRegistry.locks[name] = vl
+}
+
+// heldLock describes a lock that is held, it is returned by the locksPath.
+type heldLock struct {
+	Locks string  `json:"locks"`
+	ID    string  `json:"id"`
+	Age   float64 `json:"ageSeconds"`
+}
+
+// list returns all held locks, the oldest first.
+func (lr *lockRegistry) list() []heldLock {
+	lr.mutex.RLock()
+	defer lr.mutex.RUnlock()
+
+	held := []heldLock{}
+	for name, vl := range lr.locks {
+		for id, since := range vl.acquired() {
+			held = append(held, heldLock{
+				Locks: name,
+				ID:    id,
+				Age:   time.Since(since).Seconds(),
+			})
+		}
+	}
+
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].Age > held[j].Age
+	})
+
+	return held
+}
+
+// get returns the VolumeLocks with the name, or nil.
+func (lr *lockRegistry) get(name string) *VolumeLocks {
+	lr.mutex.RLock()
+	defer lr.mutex.RUnlock()
+
+	return lr.locks[name]
+}
+
+// Describe implements prometheus.Collector.
+func (lr *lockRegistry) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lockAgeDesc
+}
+
+// Collect implements prometheus.Collector, it exports the age of the held
+// locks.
+func (lr *lockRegistry) Collect(ch chan<- prometheus.Metric) {
+	for _, l := range lr.list() {
+		ch <- prometheus.MustNewConstMetric(lockAgeDesc, prometheus.GaugeValue, l.Age, l.Locks, l.ID)
+	}
+}
+
+// listLocksHandler returns the held locks in JSON format.
+func listLocksHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(volumeLocksRegistry.list())
+	if err != nil {
+		log.ErrorLogMsg("failed to encode the list of locks: %v", err)
+	}
+}
+
+// authorized returns true when the request carries the token in the
+// "Authorization: Bearer <token>" header.
+func authorized(r *http.Request, token string) bool {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// releaseLockHandler returns a handler that releases a lock that was held
+// longer than the deadline. The lock is selected with the "locks" and "id"
+// query parameters, and only released with the POST method by requests that
+// are authorized with the token.
+//
+// The operation that holds the lock is not stopped, and may run at the same
+// time as the next operation that acquires the lock. When it continues, it
+// does not release the lock of the next operation. Only locks of operations
+// that are stuck should be released.
+func releaseLockHandler(deadline time.Duration, token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		if !authorized(r, token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+
+			return
+		}
+
+		name := r.URL.Query().Get("locks")
+		id := r.URL.Query().Get("id")
+		vl := volumeLocksRegistry.get(name)
+		if vl == nil || id == "" {
+			http.Error(w, "unknown locks or missing id", http.StatusBadRequest)
+
+			return
+		}
+
+		if !vl.releaseOlderThan(id, deadline) {
+			http.Error(w, "lock is not held, or held shorter than "+deadline.String(), http.StatusConflict)
+
+			return
+		}
+
+		log.WarningLogMsg("released lock %q of %q that was held longer than %s", id, name, deadline)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// readLockBreakToken returns the token in the file, without surrounding
+// whitespace.
+func readLockBreakToken(tokenFile string) (string, error) {
+	data, err := os.ReadFile(tokenFile) // #nosec:G304, the file is passed by the administrator.
+	if err != nil {
+		return "", fmt.Errorf("failed to read the lock break token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("the lock break token in %q is empty", tokenFile)
+	}
+
+	return token, nil
+}
+
+// registerLockHandlers adds the handlers for the locks to the metrics server.
+// Releasing locks is only possible when the deadline is larger than 0, the
+// requests need to carry the token from the tokenFile.
+func registerLockHandlers(deadline time.Duration, tokenFile string) error {
+	http.HandleFunc(locksPath, listLocksHandler)
+	if deadline <= 0 {
+		return nil
+	}
+
+	token, err := readLockBreakToken(tokenFile)
+	if err != nil {
+		return err
+	}
+	http.Handle(releaseLockPath, releaseLockHandler(deadline, token))
+
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseOlderThan(t *testing.T) {
+	t.Parallel()
+
+	vl := NewVolumeLocks()
+	require.False(t, vl.releaseOlderThan("fake-id", 0))
+
+	stale, ok := vl.TryAcquire("fake-id")
+	require.True(t, ok)
+	require.False(t, vl.releaseOlderThan("fake-id", time.Hour))
+	require.True(t, vl.releaseOlderThan("fake-id", 0))
+	token, ok := vl.TryAcquire("fake-id")
+	require.True(t, ok)
+
+	// the stuck operation continues, and does not release the lock of the
+	// next operation
+	vl.Release("fake-id", stale)
+	_, ok = vl.TryAcquire("fake-id")
+	require.False(t, ok)
+
+	vl.Release("fake-id", token)
+	_, ok = vl.TryAcquire("fake-id")
+	require.True(t, ok)
+}
+
+//nolint:paralleltest // the test cases depend on each other
+func TestReleaseLockHandler(t *testing.T) {
+	t.Parallel()
+
+	vl := NewNamedVolumeLocks("test-release-lock-handler")
+	_, ok := vl.TryAcquire("fake-id")
+	require.True(t, ok)
+
+	const token = "secret-token"
+
+	tests := []struct {
+		name     string
+		method   string
+		query    string
+		auth     string
+		deadline time.Duration
+		want     int
+	}{
+		{
+			name:   "GET is not allowed",
+			method: http.MethodGet,
+			query:  "locks=test-release-lock-handler&id=fake-id",
+			auth:   "Bearer " + token,
+			want:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "missing token",
+			method: http.MethodPost,
+			query:  "locks=test-release-lock-handler&id=fake-id",
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "invalid token",
+			method: http.MethodPost,
+			query:  "locks=test-release-lock-handler&id=fake-id",
+			auth:   "Bearer wrong-token",
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown locks",
+			method: http.MethodPost,
+			query:  "locks=unknown&id=fake-id",
+			auth:   "Bearer " + token,
+			want:   http.StatusBadRequest,
+		},
+		{
+			name:     "lock held shorter than the deadline",
+			method:   http.MethodPost,
+			query:    "locks=test-release-lock-handler&id=fake-id",
+			auth:     "Bearer " + token,
+			deadline: time.Hour,
+			want:     http.StatusConflict,
+		},
+		{
+			name:   "lock is released",
+			method: http.MethodPost,
+			query:  "locks=test-release-lock-handler&id=fake-id",
+			auth:   "Bearer " + token,
+			want:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, releaseLockPath+"?"+tt.query, nil)
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			releaseLockHandler(tt.deadline, token)(rec, req)
+			require.Equal(t, tt.want, rec.Code)
+		})
+	}
+
+	_, ok = vl.TryAcquire("fake-id")
+	require.True(t, ok)
+}
+
+func TestLockRegistryList(t *testing.T) {
+	t.Parallel()
+
+	lr := &lockRegistry{locks: map[string]*VolumeLocks{}}
+	vl := NewVolumeLocks()
+	lr.locks["test"] = vl
+	require.Empty(t, lr.list())
+
+	_, ok := vl.TryAcquire("old")
+	require.True(t, ok)
+	time.Sleep(10 * time.Millisecond)
+	_, ok = vl.TryAcquire("new")
+	require.True(t, ok)
+
+	held := lr.list()
+	require.Len(t, held, 2)
+	require.Equal(t, "old", held[0].ID)
+	require.Equal(t, "test", held[0].Locks)
+}
+
+func TestReadLockBreakToken(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret-token\n"), 0o600))
+	token, err := readLockBreakToken(tokenFile)
+	require.NoError(t, err)
+	require.Equal(t, "secret-token", token)
+
+	emptyFile := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(emptyFile, []byte("\n"), 0o600))
+	_, err = readLockBreakToken(emptyFile)
+	require.Error(t, err)
+
+	_, err = readLockBreakToken(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -16,6 +16,8 @@ package log
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
 
 	"k8s.io/klog/v2"
 )
@@ -37,6 +39,64 @@ var CtxKey = contextKey("ID")
 // ReqID for logging request ID.
 var ReqID = contextKey("Req-ID")
 
+// Method for logging the gRPC method of the request.
+var Method = contextKey("Method")
+
+const (
+	// TextFormat logs plain text messages, prefixed with the IDs of the
+	// request.
+	TextFormat = "text"
+	// JSONFormat logs structured JSON entries, with the IDs of the request
+	// and the gRPC method as fields.
+	JSONFormat = "json"
+)
+
+// jsonFormat is set when the messages are logged in the JSON format.
+var jsonFormat bool
+
+// SetFormat sets the format of the log messages, TextFormat or JSONFormat.
+func SetFormat(format string) error {
+	switch format {
+	case TextFormat:
+		jsonFormat = false
+	case JSONFormat:
+		jsonFormat = true
+		klog.SetSlogLogger(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+	default:
+		return fmt.Errorf("unsupported log format %q", format)
+	}
+
+	return nil
+}
+
+// contextFields returns the IDs of the request and the gRPC method in the
+// context as key/value pairs for structured logging.
+func contextFields(ctx context.Context) []interface{} {
+	var fields []interface{}
+	if id := ctx.Value(CtxKey); id != nil {
+		fields = append(fields, "id", id)
+	}
+	if reqID := ctx.Value(ReqID); reqID != nil {
+		fields = append(fields, "reqID", reqID)
+	}
+	if method := ctx.Value(Method); method != nil {
+		fields = append(fields, "method", method)
+	}
+
+	return fields
+}
+
+// infoDepth logs the message with the IDs of the request in the context.
+func infoDepth(ctx context.Context, message string, args ...interface{}) {
+	if jsonFormat {
+		klog.InfoSDepth(2, fmt.Sprintf(message, args...), contextFields(ctx)...)
+
+		return
+	}
+
+	klog.InfoDepth(2, fmt.Sprintf(Log(ctx, message), args...))
+}
+
 // Log helps in context based logging.
 func Log(ctx context.Context, format string) string {
 	id := ctx.Value(CtxKey)
@@ -67,6 +127,12 @@ func ErrorLogMsg(message string, args ...interface{}) {
 
 // ErrorLog helps in logging errors with context.
 func ErrorLog(ctx context.Context, message string, args ...interface{}) {
+	if jsonFormat {
+		klog.ErrorSDepth(1, nil, fmt.Sprintf(message, args...), contextFields(ctx)...)
+
+		return
+	}
+
 	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	klog.ErrorDepth(1, logMessage)
 }
@@ -79,6 +145,14 @@ func WarningLogMsg(message string, args ...interface{}) {
 
 // WarningLog helps in logging warnings with context.
 func WarningLog(ctx context.Context, message string, args ...interface{}) {
+	if jsonFormat {
+		// structured logging in klog has no warning severity
+		fields := append(contextFields(ctx), "severity", "warning")
+		klog.InfoSDepth(1, fmt.Sprintf(message, args...), fields...)
+
+		return
+	}
+
 	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	klog.WarningDepth(1, logMessage)
 }
@@ -94,10 +168,9 @@ func DefaultLog(message string, args ...interface{}) {
 
 // UsefulLog helps in logging with klog.level 2.
 func UsefulLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Useful).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		infoDepth(ctx, message, args...)
 	}
 }
 
@@ -112,10 +185,9 @@ func ExtendedLogMsg(message string, args ...interface{}) {
 
 // ExtendedLog helps in logging with klog.level 3.
 func ExtendedLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Extended).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		infoDepth(ctx, message, args...)
 	}
 }
 
@@ -130,10 +202,9 @@ func DebugLogMsg(message string, args ...interface{}) {
 
 // DebugLog helps in logging with klog.level 4.
 func DebugLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Debug).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		infoDepth(ctx, message, args...)
 	}
 }
 
@@ -148,9 +219,8 @@ func TraceLogMsg(message string, args ...interface{}) {
 
 // TraceLog helps in logging with klog.level 5.
 func TraceLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Trace).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		infoDepth(ctx, message, args...)
 	}
 }
@@ -0,0 +1,66 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextFields(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.WithValue(context.TODO(), CtxKey, uint64(7))
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []interface{}
+	}{
+		{
+			name: "no IDs",
+			ctx:  context.TODO(),
+			want: nil,
+		},
+		{
+			name: "request ID",
+			ctx:  ctx,
+			want: []interface{}{"id", uint64(7)},
+		},
+		{
+			name: "all fields",
+			ctx: context.WithValue(
+				context.WithValue(ctx, ReqID, "pvc-1"),
+				Method, "/csi.v1.Controller/CreateVolume"),
+			want: []interface{}{"id", uint64(7), "reqID", "pvc-1", "method", "/csi.v1.Controller/CreateVolume"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, contextFields(tt.ctx))
+		})
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, SetFormat(TextFormat))
+	require.Error(t, SetFormat("xml"))
+}
@@ -0,0 +1,310 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics contains the Prometheus metrics of the operations of the
+// drivers.
+package metrics
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "csi"
+
+var (
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the gRPC calls",
+		// 10ms up to about 10 minutes
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 17),
+	}, []string{"method", "cluster_id"})
+
+	operationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_errors_total",
+		Help:      "Number of gRPC calls that failed, by gRPC status code",
+	}, []string{"method", "cluster_id", "code"})
+
+	cephCommands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ceph_commands_total",
+		Help:      "Number of commands that were sent to the Ceph monitors and managers",
+	}, []string{"command", "result"})
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retries_total",
+		Help:      "Number of retried operations on the Ceph cluster",
+	}, []string{"operation"})
+
+	queuedOperations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations_queued",
+		Help:      "Number of operations that wait for the concurrency limit of the cluster",
+	}, []string{"cluster_id", "operation"})
+
+	runningOperations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "operations_running",
+		Help:      "Number of operations that run on the cluster, for operations with a concurrency limit",
+	}, []string{"cluster_id", "operation"})
+
+	volumeProvisioned = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "volume_provisioned_bytes",
+		Help:      "Provisioned size of the volume in the Ceph cluster",
+	}, []string{"volume_id"})
+
+	volumeAllocated = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "volume_allocated_bytes",
+		Help:      "Bytes that are allocated by the volume in the Ceph cluster, without its snapshots",
+	}, []string{"volume_id"})
+
+	volumeSnapshots = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "volume_snapshots",
+		Help:      "Number of snapshots of the volume in the Ceph cluster",
+	}, []string{"volume_id"})
+
+	orphanedVolumes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "orphaned_volumes",
+		Help:      "Number of volumes in the Ceph cluster that have no PersistentVolume",
+	}, []string{"cluster_id", "location"})
+
+	orphanedVolumesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orphaned_volumes_deleted_total",
+		Help:      "Number of orphaned volumes that were deleted, by result",
+	}, []string{"cluster_id", "result"})
+
+	mounterSelections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cephfs_mounter_selections_total",
+		Help:      "Number of CephFS volumes that were staged with the mounter, by the reason of the selection",
+	}, []string{"mounter", "reason"})
+
+	clonesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cephfs_clones_in_flight",
+		Help:      "Number of CephFS clones that are pending or in progress",
+	})
+
+	abandonedClonesDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cephfs_abandoned_clones_deleted_total",
+		Help:      "Number of abandoned CephFS clones that were deleted, by result",
+	}, []string{"cluster_id", "result"})
+
+	commandFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ceph_command_fallbacks_total",
+		Help:      "Number of commands that were run with the ceph CLI as fallback",
+	}, []string{"command"})
+
+	mapQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rbd_map_queue_depth",
+		Help:      "Number of RBD images that wait to be mapped on the node",
+	})
+
+	mapBackoffs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rbd_map_backoffs_total",
+		Help:      "Number of maps of RBD images that were delayed after a failed map of the image",
+	})
+
+	deviceErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rbd_device_errors_total",
+		Help:      "Number of errors of krbd and rbd-nbd devices in the kernel log of the node, by kind of error",
+	}, []string{"device_type", "device", "error"})
+)
+
+func init() {
+	prometheus.MustRegister(operationDuration, operationErrors, cephCommands, retries,
+		queuedOperations, runningOperations,
+		volumeProvisioned, volumeAllocated, volumeSnapshots,
+		orphanedVolumes, orphanedVolumesDeleted, mounterSelections, clonesInFlight, abandonedClonesDeleted,
+		commandFallbacks, mapQueueDepth, mapBackoffs, deviceErrors)
+}
+
+// ObserveOperation records the duration of a gRPC call, and the status code
+// when it failed.
+func ObserveOperation(method, clusterID string, duration time.Duration, code string) {
+	operationDuration.WithLabelValues(method, clusterID).Observe(duration.Seconds())
+	if code != "" {
+		operationErrors.WithLabelValues(method, clusterID, code).Inc()
+	}
+}
+
+// CountRetry counts a retry of the operation.
+func CountRetry(operation string) {
+	retries.WithLabelValues(operation).Inc()
+}
+
+// AddQueuedOperations changes the number of queued operations of the type on
+// the cluster by delta.
+func AddQueuedOperations(clusterID, operation string, delta float64) {
+	queuedOperations.WithLabelValues(clusterID, operation).Add(delta)
+}
+
+// AddRunningOperations changes the number of running operations of the type on
+// the cluster by delta.
+func AddRunningOperations(clusterID, operation string, delta float64) {
+	runningOperations.WithLabelValues(clusterID, operation).Add(delta)
+}
+
+// SetVolumeUsage records the usage of the volume in the Ceph cluster.
+func SetVolumeUsage(volumeID string, provisioned, allocated uint64, snapshots int) {
+	volumeProvisioned.WithLabelValues(volumeID).Set(float64(provisioned))
+	volumeAllocated.WithLabelValues(volumeID).Set(float64(allocated))
+	volumeSnapshots.WithLabelValues(volumeID).Set(float64(snapshots))
+}
+
+// DeleteVolumeUsage removes the usage of the volume, it is called when the
+// volume is not used on the node anymore.
+func DeleteVolumeUsage(volumeID string) {
+	volumeProvisioned.DeleteLabelValues(volumeID)
+	volumeAllocated.DeleteLabelValues(volumeID)
+	volumeSnapshots.DeleteLabelValues(volumeID)
+}
+
+// SetOrphanedVolumes records the number of orphaned volumes in the location
+// (pool or filesystem) of the cluster.
+func SetOrphanedVolumes(clusterID, location string, count int) {
+	orphanedVolumes.WithLabelValues(clusterID, location).Set(float64(count))
+}
+
+// CountOrphanedVolumeDeletion counts the deletion of an orphaned volume, and
+// whether it failed.
+func CountOrphanedVolumeDeletion(clusterID string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	orphanedVolumesDeleted.WithLabelValues(clusterID, result).Inc()
+}
+
+// SetClonesInFlight records the number of CephFS clones that are pending or
+// in progress.
+func SetClonesInFlight(count int) {
+	clonesInFlight.Set(float64(count))
+}
+
+// CountAbandonedCloneDeletion counts the deletion of an abandoned CephFS
+// clone, and whether it failed.
+func CountAbandonedCloneDeletion(clusterID string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	abandonedClonesDeleted.WithLabelValues(clusterID, result).Inc()
+}
+
+// CountMounterSelection counts the selection of a CephFS mounter for a volume
+// that is staged.
+func CountMounterSelection(mounter, reason string) {
+	mounterSelections.WithLabelValues(mounter, reason).Inc()
+}
+
+// CountCommandFallback counts a command that was run with the ceph CLI,
+// because the library could not run it.
+func CountCommandFallback(command string) {
+	commandFallbacks.WithLabelValues(command).Inc()
+}
+
+// SetMapQueueDepth records the number of RBD images that wait to be mapped.
+func SetMapQueueDepth(count int) {
+	mapQueueDepth.Set(float64(count))
+}
+
+// CountMapBackoff counts a map of an RBD image that is delayed, because the
+// previous map of the image failed.
+func CountMapBackoff() {
+	mapBackoffs.Inc()
+}
+
+// CountDeviceError counts an error of a krbd or rbd-nbd device that was
+// logged by the kernel.
+func CountDeviceError(deviceType, device, kind string) {
+	deviceErrors.WithLabelValues(deviceType, device, kind).Inc()
+}
+
+// commandPrefix returns the prefix of a JSON formatted command, like
+// "fs subvolume create". Commands without prefix are counted as "unknown".
+func commandPrefix(cmd []byte) string {
+	var c struct {
+		Prefix string `json:"prefix"`
+	}
+	if err := json.Unmarshal(cmd, &c); err != nil || c.Prefix == "" {
+		return "unknown"
+	}
+
+	return c.Prefix
+}
+
+// countCommand counts the command with the result.
+func countCommand(cmd []byte, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	cephCommands.WithLabelValues(commandPrefix(cmd), result).Inc()
+}
+
+// RadosCommander is the interface of a connection to send commands to the
+// Ceph monitors and managers, it is implemented by rados.Conn.
+type RadosCommander interface {
+	MgrCommand(buf [][]byte) ([]byte, string, error)
+	MonCommand(buf []byte) ([]byte, string, error)
+}
+
+// countingCommander counts the commands that are sent with a RadosCommander.
+type countingCommander struct {
+	RadosCommander
+}
+
+// NewCountingCommander returns a RadosCommander that counts the commands that
+// are sent, it can be passed to the admin APIs of go-ceph.
+func NewCountingCommander(rc RadosCommander) RadosCommander {
+	return &countingCommander{RadosCommander: rc}
+}
+
+// MgrCommand sends the command to the Ceph managers and counts it.
+func (cc *countingCommander) MgrCommand(buf [][]byte) ([]byte, string, error) {
+	out, status, err := cc.RadosCommander.MgrCommand(buf)
+	var cmd []byte
+	if len(buf) > 0 {
+		cmd = buf[0]
+	}
+	countCommand(cmd, err)
+
+	return out, status, err
+}
+
+// MonCommand sends the command to the Ceph monitors and counts it.
+func (cc *countingCommander) MonCommand(buf []byte) ([]byte, string, error) {
+	out, status, err := cc.RadosCommander.MonCommand(buf)
+	countCommand(buf, err)
+
+	return out, status, err
+}
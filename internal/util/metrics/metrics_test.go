@@ -0,0 +1,112 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCommander returns the error for all commands.
+type fakeCommander struct {
+	err error
+}
+
+func (fc *fakeCommander) MgrCommand(buf [][]byte) ([]byte, string, error) {
+	return nil, "", fc.err
+}
+
+func (fc *fakeCommander) MonCommand(buf []byte) ([]byte, string, error) {
+	return nil, "", fc.err
+}
+
+func TestCommandPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cmd  []byte
+		want string
+	}{
+		{
+			name: "command with prefix",
+			cmd:  []byte(`{"prefix": "fs subvolume create", "format": "json"}`),
+			want: "fs subvolume create",
+		},
+		{
+			name: "command without prefix",
+			cmd:  []byte(`{"format": "json"}`),
+			want: "unknown",
+		},
+		{
+			name: "invalid command",
+			cmd:  []byte(`df`),
+			want: "unknown",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, commandPrefix(tt.cmd))
+		})
+	}
+}
+
+func TestCountingCommander(t *testing.T) {
+	t.Parallel()
+
+	cmd := []byte(`{"prefix": "test counting commander"}`)
+	succeeded := cephCommands.WithLabelValues("test counting commander", "success")
+	failed := cephCommands.WithLabelValues("test counting commander", "error")
+
+	_, _, err := NewCountingCommander(&fakeCommander{}).MonCommand(cmd)
+	require.NoError(t, err)
+	_, _, err = NewCountingCommander(&fakeCommander{}).MgrCommand([][]byte{cmd})
+	require.NoError(t, err)
+	_, _, err = NewCountingCommander(&fakeCommander{err: errors.New("failed")}).MonCommand(cmd)
+	require.Error(t, err)
+
+	require.InDelta(t, 2, testutil.ToFloat64(succeeded), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(failed), 0)
+}
+
+func TestObserveOperation(t *testing.T) {
+	t.Parallel()
+
+	ObserveOperation("/test/Succeeded", "cluster-1", time.Second, "")
+	ObserveOperation("/test/Failed", "cluster-1", time.Second, "Internal")
+
+	require.Equal(t, 1, testutil.CollectAndCount(operationErrors, "csi_operation_errors_total"))
+	require.InDelta(t, 1,
+		testutil.ToFloat64(operationErrors.WithLabelValues("/test/Failed", "cluster-1", "Internal")), 0)
+}
+
+func TestVolumeUsage(t *testing.T) {
+	t.Parallel()
+
+	SetVolumeUsage("test-volume-usage", 1024, 512, 2)
+	require.InDelta(t, 1024, testutil.ToFloat64(volumeProvisioned.WithLabelValues("test-volume-usage")), 0)
+	require.InDelta(t, 512, testutil.ToFloat64(volumeAllocated.WithLabelValues("test-volume-usage")), 0)
+	require.InDelta(t, 2, testutil.ToFloat64(volumeSnapshots.WithLabelValues("test-volume-usage")), 0)
+
+	DeleteVolumeUsage("test-volume-usage")
+	require.Equal(t, 0, testutil.CollectAndCount(volumeSnapshots, "csi_volume_snapshots"))
+}
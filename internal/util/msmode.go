@@ -0,0 +1,151 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// msModeOption is the kernel CephFS mount and krbd map option that selects
+// the mode of the messenger v2 protocol.
+const msModeOption = "ms_mode"
+
+// msModes are the modes of the messenger v2 protocol that can be configured
+// with `msMode` in the CSI configuration.
+var msModes = []string{"crc", "secure", "prefer-crc", "prefer-secure"}
+
+// ErrMsgr2NotSupported is returned when a messenger v2 mode is configured for
+// a cluster that has monitors without a v2 address.
+var ErrMsgr2NotSupported = errors.New("cluster does not support the messenger v2 protocol")
+
+// validateMsMode returns an error when mode is not a supported messenger v2
+// mode. An empty mode is valid, the defaults are used then.
+func validateMsMode(mode string) error {
+	if mode != "" && !slices.Contains(msModes, mode) {
+		return fmt.Errorf("invalid msMode %q, supported modes are %v", mode, msModes)
+	}
+
+	return nil
+}
+
+// GetMsMode returns the `msMode` of the cluster, the mode of the messenger v2
+// protocol that is used for all connections to the cluster.
+func GetMsMode(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	if err = validateMsMode(cluster.MsMode); err != nil {
+		return "", err
+	}
+
+	return cluster.MsMode, nil
+}
+
+// msModeForMonitors returns the `msMode` of the cluster with the monitors.
+// The connection pool only knows the monitors of a connection. Connections to
+// monitors that are not in the configuration use the defaults of the Ceph
+// configuration file.
+func msModeForMonitors(pathToConfig, monitors string) string {
+	config, err := readCSIConfig(pathToConfig)
+	if err != nil {
+		return ""
+	}
+
+	for i := range config {
+		if strings.Join(config[i].Monitors, ",") == monitors && validateMsMode(config[i].MsMode) == nil {
+			return config[i].MsMode
+		}
+	}
+
+	return ""
+}
+
+// msModeArgs returns the command line arguments that configure a librados
+// connection with the messenger v2 mode.
+func msModeArgs(mode string) []string {
+	if mode == "" {
+		return nil
+	}
+
+	return []string{"--ms_client_mode=" + mode, "--ms_mon_client_mode=" + mode}
+}
+
+// SetMsModeOption sets the `ms_mode` in the comma separated kernel mount or
+// krbd map options. The mode of the cluster replaces an `ms_mode` of the
+// volume, so that the configuration of the cluster can not be weakened by a
+// StorageClass. The options are returned unchanged when mode is empty.
+func SetMsModeOption(options, mode string) string {
+	if mode == "" {
+		return options
+	}
+
+	opts := []string{}
+	for _, opt := range strings.Split(options, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt == "" || strings.HasPrefix(opt, msModeOption+"=") {
+			continue
+		}
+		opts = append(opts, opt)
+	}
+
+	return strings.Join(append(opts, msModeOption+"="+mode), ",")
+}
+
+// monDump contains the parts of the output of `ceph mon dump` that are needed
+// to validate the messenger v2 support of the monitors.
+type monDump struct {
+	Mons []struct {
+		Name        string `json:"name"`
+		PublicAddrs struct {
+			Addrvec []struct {
+				Type string `json:"type"`
+			} `json:"addrvec"`
+		} `json:"public_addrs"`
+	} `json:"mons"`
+}
+
+// checkMsgr2 returns ErrMsgr2NotSupported when a monitor in the JSON
+// formatted output of `ceph mon dump` has no v2 address.
+func checkMsgr2(dump []byte) error {
+	md := monDump{}
+	if err := json.Unmarshal(dump, &md); err != nil {
+		return fmt.Errorf("failed to parse the monitor map: %w", err)
+	}
+
+	for _, mon := range md.Mons {
+		hasV2 := false
+		for _, addr := range mon.PublicAddrs.Addrvec {
+			if addr.Type == "v2" {
+				hasV2 = true
+
+				break
+			}
+		}
+
+		if !hasV2 {
+			return fmt.Errorf("%w: monitor %q has no v2 address", ErrMsgr2NotSupported, mon.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMsModeOption(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		options string
+		mode    string
+		want    string
+	}{
+		{
+			name:    "no mode",
+			options: "noatime,ms_mode=crc",
+			mode:    "",
+			want:    "noatime,ms_mode=crc",
+		},
+		{
+			name:    "no options",
+			options: "",
+			mode:    "secure",
+			want:    "ms_mode=secure",
+		},
+		{
+			name:    "append mode",
+			options: "noatime,nowsync",
+			mode:    "secure",
+			want:    "noatime,nowsync,ms_mode=secure",
+		},
+		{
+			name:    "replace mode of the volume",
+			options: "ms_mode=crc, noatime",
+			mode:    "secure",
+			want:    "noatime,ms_mode=secure",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, SetMsModeOption(tt.options, tt.mode))
+		})
+	}
+}
+
+func TestCheckMsgr2(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		dump    string
+		wantErr error
+	}{
+		{
+			name: "v2 addresses",
+			dump: `{"mons": [
+				{"name": "a", "public_addrs": {"addrvec": [
+					{"type": "v2", "addr": "10.0.0.1:3300"},
+					{"type": "v1", "addr": "10.0.0.1:6789"}
+				]}},
+				{"name": "b", "public_addrs": {"addrvec": [
+					{"type": "v2", "addr": "10.0.0.2:3300"}
+				]}}
+			]}`,
+			wantErr: nil,
+		},
+		{
+			name: "v1 address only",
+			dump: `{"mons": [
+				{"name": "a", "public_addrs": {"addrvec": [
+					{"type": "v2", "addr": "10.0.0.1:3300"}
+				]}},
+				{"name": "b", "public_addrs": {"addrvec": [
+					{"type": "v1", "addr": "10.0.0.2:6789"}
+				]}}
+			]}`,
+			wantErr: ErrMsgr2NotSupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkMsgr2([]byte(tt.dump))
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	require.Error(t, checkMsgr2([]byte("{")))
+}
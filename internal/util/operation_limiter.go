@@ -0,0 +1,331 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+	"github.com/ceph/ceph-csi/internal/util/metrics"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// OperationType is the type of an operation on the Ceph cluster that can be
+// limited in the CSI configuration.
+type OperationType string
+
+const (
+	// CreateOperation creates a volume.
+	CreateOperation OperationType = "create"
+	// DeleteOperation deletes a volume.
+	DeleteOperation OperationType = "delete"
+	// CloneOperation clones a volume, or restores a snapshot.
+	CloneOperation OperationType = "clone"
+	// SnapshotOperation creates or deletes a snapshot.
+	SnapshotOperation OperationType = "snapshot"
+	// FlattenOperation flattens an RBD image, and copies the data of its
+	// parent.
+	FlattenOperation OperationType = "flatten"
+	// ResyncOperation resyncs a mirrored RBD image from the primary image.
+	ResyncOperation OperationType = "resync"
+	// SparsifyOperation deallocates the zeroed blocks of an RBD image.
+	SparsifyOperation OperationType = "sparsify"
+	// BackgroundOperation is the budget of the flatten, resync and sparsify
+	// operations together.
+	BackgroundOperation OperationType = "background"
+)
+
+// BackgroundOperationTimeout is the time after which a background operation
+// that was not reported as finished does not count against the limits
+// anymore.
+const BackgroundOperationTimeout = 6 * time.Hour
+
+// operationLimiter limits the concurrent operations of a type on a cluster.
+type operationLimiter struct {
+	limit int
+	sem   *semaphore.Weighted
+}
+
+// operationLimiters contains the limiters by clusterID and OperationType.
+type operationLimiters struct {
+	mutex    sync.Mutex
+	limiters map[string]*operationLimiter
+}
+
+var clusterOperationLimiters = &operationLimiters{
+	limiters: make(map[string]*operationLimiter),
+}
+
+// getOperationLimit returns the limit for the operation from the limits of
+// the cluster, 0 means unlimited.
+func getOperationLimit(limits kubernetes.OperationLimits, op OperationType) int {
+	switch op {
+	case CreateOperation:
+		return limits.Create
+	case DeleteOperation:
+		return limits.Delete
+	case CloneOperation:
+		return limits.Clone
+	case SnapshotOperation:
+		return limits.Snapshot
+	case FlattenOperation:
+		return limits.Flatten
+	case ResyncOperation:
+		return limits.Resync
+	case SparsifyOperation:
+		return limits.Sparsify
+	case BackgroundOperation:
+		return limits.Background
+	}
+
+	return 0
+}
+
+// isBackgroundOperation returns true when the operation counts against the
+// budget of the BackgroundOperation.
+func isBackgroundOperation(op OperationType) bool {
+	switch op {
+	case FlattenOperation, ResyncOperation, SparsifyOperation:
+		return true
+	}
+
+	return false
+}
+
+// get returns the limiter for the operation on the cluster, or nil when the
+// operation is not limited. A new limiter is created when the limit was
+// changed in the CSI configuration, operations that run already release the
+// previous limiter.
+func (ol *operationLimiters) get(clusterID string, op OperationType, limit int) *operationLimiter {
+	key := fmt.Sprintf("%s/%s", clusterID, op)
+
+	ol.mutex.Lock()
+	defer ol.mutex.Unlock()
+
+	if limit <= 0 {
+		delete(ol.limiters, key)
+
+		return nil
+	}
+
+	l, ok := ol.limiters[key]
+	if !ok || l.limit != limit {
+		l = &operationLimiter{
+			limit: limit,
+			sem:   semaphore.NewWeighted(int64(limit)),
+		}
+		ol.limiters[key] = l
+	}
+
+	return l
+}
+
+// acquire waits until the operation may run, and returns the function to
+// release it again.
+func (ol *operationLimiters) acquire(
+	ctx context.Context,
+	clusterID string,
+	op OperationType,
+	limit int,
+) (func(), error) {
+	l := ol.get(clusterID, op, limit)
+	if l == nil {
+		return func() {}, nil
+	}
+
+	metrics.AddQueuedOperations(clusterID, string(op), 1)
+	err := l.sem.Acquire(ctx, 1)
+	metrics.AddQueuedOperations(clusterID, string(op), -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for the %s operation limit of cluster %q: %w", op, clusterID, err)
+	}
+
+	return l.running(clusterID, op), nil
+}
+
+// tryAcquire returns the function to release the operation when it may run
+// immediately, or false when the limit is reached.
+func (ol *operationLimiters) tryAcquire(clusterID string, op OperationType, limit int) (func(), bool) {
+	l := ol.get(clusterID, op, limit)
+	if l == nil {
+		return func() {}, true
+	}
+
+	if !l.sem.TryAcquire(1) {
+		return nil, false
+	}
+
+	return l.running(clusterID, op), true
+}
+
+// running counts the operation that acquired the limiter as running, and
+// returns the function to release it again.
+func (l *operationLimiter) running(clusterID string, op OperationType) func() {
+	metrics.AddRunningOperations(clusterID, string(op), 1)
+
+	return func() {
+		metrics.AddRunningOperations(clusterID, string(op), -1)
+		l.sem.Release(1)
+	}
+}
+
+// readOperationLimits returns the operation limits of the cluster, there are
+// no limits when the cluster is not in the CSI configuration.
+func readOperationLimits(clusterID string) kubernetes.OperationLimits {
+	cluster, err := readClusterInfo(CsiConfigFile, clusterID)
+	if err != nil {
+		return kubernetes.OperationLimits{}
+	}
+
+	return cluster.OperationLimits
+}
+
+// AcquireOperation waits until an operation of the type may run on the
+// cluster, when the number of concurrent operations is limited in the CSI
+// configuration. Flatten, resync and sparsify operations wait for the budget
+// of the background operations too. The returned function needs to be called
+// once the operation finished. An error is returned when the ctx is done
+// before the operation may run.
+func AcquireOperation(ctx context.Context, clusterID string, op OperationType) (func(), error) {
+	limits := readOperationLimits(clusterID)
+
+	release, err := clusterOperationLimiters.acquire(ctx, clusterID, op, getOperationLimit(limits, op))
+	if err != nil || !isBackgroundOperation(op) {
+		return release, err
+	}
+
+	releaseBudget, err := clusterOperationLimiters.acquire(ctx, clusterID, BackgroundOperation, limits.Background)
+	if err != nil {
+		release()
+
+		return nil, err
+	}
+
+	return func() {
+		releaseBudget()
+		release()
+	}, nil
+}
+
+// backgroundOperation is an operation that runs outside of this process, and
+// holds its limits until it finished or timed out.
+type backgroundOperation struct {
+	release func()
+	timer   *time.Timer
+}
+
+// backgroundOperations contains the running background operations by
+// clusterID, OperationType and name.
+type backgroundOperations struct {
+	mutex      sync.Mutex
+	operations map[string]*backgroundOperation
+}
+
+var runningBackgroundOperations = &backgroundOperations{
+	operations: make(map[string]*backgroundOperation),
+}
+
+// start registers the operation when it runs already, or when tryAcquire
+// returns the function to release its limits. False is returned when the
+// operation may not run yet.
+func (bo *backgroundOperations) start(key string, timeout time.Duration, tryAcquire func() (func(), bool)) bool {
+	bo.mutex.Lock()
+	defer bo.mutex.Unlock()
+
+	if _, ok := bo.operations[key]; ok {
+		return true
+	}
+
+	release, ok := tryAcquire()
+	if !ok {
+		return false
+	}
+
+	operation := &backgroundOperation{release: release}
+	operation.timer = time.AfterFunc(timeout, func() {
+		bo.finish(key, operation)
+	})
+	bo.operations[key] = operation
+
+	return true
+}
+
+// finish releases the limits of the operation. When operation is not nil,
+// only that operation is released, and not one that was started again.
+func (bo *backgroundOperations) finish(key string, operation *backgroundOperation) {
+	bo.mutex.Lock()
+	running, ok := bo.operations[key]
+	if !ok || (operation != nil && running != operation) {
+		bo.mutex.Unlock()
+
+		return
+	}
+	delete(bo.operations, key)
+	bo.mutex.Unlock()
+
+	running.timer.Stop()
+	running.release()
+}
+
+// StartBackgroundOperation registers an operation of the type on the
+// cluster that runs outside of this process, like a flatten task of the Ceph
+// Manager or the resync by the rbd-mirror daemon. The operation counts
+// against the limits of its type and the background operations until
+// FinishBackgroundOperation is called with the same name, or until
+// BackgroundOperationTimeout passed. False is returned when a limit is
+// reached and the operation should not be started yet, true is returned
+// when the operation is registered already.
+func StartBackgroundOperation(clusterID string, op OperationType, name string) bool {
+	key := backgroundOperationKey(clusterID, op, name)
+
+	return runningBackgroundOperations.start(key, BackgroundOperationTimeout, func() (func(), bool) {
+		limits := readOperationLimits(clusterID)
+
+		release, ok := clusterOperationLimiters.tryAcquire(clusterID, op, getOperationLimit(limits, op))
+		if !ok {
+			return nil, false
+		}
+
+		releaseBudget, ok := clusterOperationLimiters.tryAcquire(clusterID, BackgroundOperation, limits.Background)
+		if !ok {
+			release()
+
+			return nil, false
+		}
+
+		return func() {
+			releaseBudget()
+			release()
+		}, true
+	})
+}
+
+// FinishBackgroundOperation releases the limits of an operation that was
+// started with StartBackgroundOperation. Nothing happens when the operation
+// is not running.
+func FinishBackgroundOperation(clusterID string, op OperationType, name string) {
+	runningBackgroundOperations.finish(backgroundOperationKey(clusterID, op, name), nil)
+}
+
+// backgroundOperationKey returns the key of a background operation.
+func backgroundOperationKey(clusterID string, op OperationType, name string) string {
+	return fmt.Sprintf("%s/%s/%s", clusterID, op, name)
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOperationLimit(t *testing.T) {
+	t.Parallel()
+
+	limits := kubernetes.OperationLimits{
+		Create:     1,
+		Delete:     2,
+		Clone:      3,
+		Snapshot:   4,
+		Flatten:    5,
+		Resync:     6,
+		Sparsify:   7,
+		Background: 8,
+	}
+	require.Equal(t, 1, getOperationLimit(limits, CreateOperation))
+	require.Equal(t, 2, getOperationLimit(limits, DeleteOperation))
+	require.Equal(t, 3, getOperationLimit(limits, CloneOperation))
+	require.Equal(t, 4, getOperationLimit(limits, SnapshotOperation))
+	require.Equal(t, 5, getOperationLimit(limits, FlattenOperation))
+	require.Equal(t, 6, getOperationLimit(limits, ResyncOperation))
+	require.Equal(t, 7, getOperationLimit(limits, SparsifyOperation))
+	require.Equal(t, 8, getOperationLimit(limits, BackgroundOperation))
+	require.Equal(t, 0, getOperationLimit(limits, OperationType("unknown")))
+}
+
+func TestOperationLimitersAcquire(t *testing.T) {
+	t.Parallel()
+
+	ol := &operationLimiters{limiters: make(map[string]*operationLimiter)}
+	ctx := context.Background()
+
+	// without limit, operations are not queued
+	release, err := ol.acquire(ctx, "cluster-1", CreateOperation, 0)
+	require.NoError(t, err)
+	release()
+	require.Empty(t, ol.limiters)
+
+	release, err = ol.acquire(ctx, "cluster-1", CreateOperation, 1)
+	require.NoError(t, err)
+
+	// the limit is reached, the operation waits until the ctx is done
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = ol.acquire(timeoutCtx, "cluster-1", CreateOperation, 1)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// other operations and clusters have their own limit
+	releaseDelete, err := ol.acquire(ctx, "cluster-1", DeleteOperation, 1)
+	require.NoError(t, err)
+	releaseDelete()
+	releaseOther, err := ol.acquire(ctx, "cluster-2", CreateOperation, 1)
+	require.NoError(t, err)
+	releaseOther()
+
+	release()
+	release, err = ol.acquire(ctx, "cluster-1", CreateOperation, 1)
+	require.NoError(t, err)
+
+	// an updated limit replaces the limiter
+	releaseUpdated, err := ol.acquire(ctx, "cluster-1", CreateOperation, 2)
+	require.NoError(t, err)
+	releaseUpdated()
+	release()
+}
+
+func TestOperationLimitersTryAcquire(t *testing.T) {
+	t.Parallel()
+
+	ol := &operationLimiters{limiters: make(map[string]*operationLimiter)}
+
+	release, ok := ol.tryAcquire("cluster-1", FlattenOperation, 0)
+	require.True(t, ok)
+	release()
+
+	release, ok = ol.tryAcquire("cluster-1", FlattenOperation, 1)
+	require.True(t, ok)
+
+	// the limit is reached, the operation does not wait
+	_, ok = ol.tryAcquire("cluster-1", FlattenOperation, 1)
+	require.False(t, ok)
+
+	release()
+	release, ok = ol.tryAcquire("cluster-1", FlattenOperation, 1)
+	require.True(t, ok)
+	release()
+}
+
+func TestBackgroundOperations(t *testing.T) {
+	t.Parallel()
+
+	ol := &operationLimiters{limiters: make(map[string]*operationLimiter)}
+	bo := &backgroundOperations{operations: make(map[string]*backgroundOperation)}
+	tryAcquire := func() (func(), bool) {
+		return ol.tryAcquire("cluster-1", BackgroundOperation, 1)
+	}
+
+	require.True(t, bo.start("image-1", time.Hour, tryAcquire))
+	// a running operation can be started again
+	require.True(t, bo.start("image-1", time.Hour, tryAcquire))
+	// the budget is used by image-1
+	require.False(t, bo.start("image-2", time.Hour, tryAcquire))
+
+	bo.finish("image-1", nil)
+	require.True(t, bo.start("image-2", time.Hour, tryAcquire))
+	// finishing an operation that does not run is a no-op
+	bo.finish("image-1", nil)
+	require.False(t, bo.start("image-1", time.Hour, tryAcquire))
+	bo.finish("image-2", nil)
+
+	// the budget is released when the operation times out
+	require.True(t, bo.start("image-1", time.Millisecond, tryAcquire))
+	require.Eventually(t, func() bool {
+		return bo.start("image-2", time.Hour, tryAcquire)
+	}, time.Second, time.Millisecond)
+	bo.finish("image-2", nil)
+}
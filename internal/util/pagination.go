@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/ceph/ceph-csi/internal/util/volumeid"
+)
+
+// ErrInvalidStartingToken is returned when the starting token of a
+// ListVolumes or ListSnapshots request is not valid.
+var ErrInvalidStartingToken = errors.New("invalid starting token")
+
+// Paginate sorts the IDs of volumes or snapshots, and returns at most
+// maxEntries of them, starting at the startingToken. All IDs are returned
+// when maxEntries is 0. The returned token is the first ID of the next page,
+// it is empty when there are no more IDs.
+//
+// The token is an ID, so that IDs that are added or removed between the
+// requests for the pages do not cause entries to be skipped or returned
+// twice. A startingToken that is not an ID returns ErrInvalidStartingToken.
+func Paginate(ids []string, maxEntries int32, startingToken string) ([]string, string, error) {
+	if maxEntries < 0 {
+		return nil, "", fmt.Errorf("max_entries %d is negative", maxEntries)
+	}
+
+	sorted := slices.Clone(ids)
+	slices.Sort(sorted)
+
+	start := 0
+	if startingToken != "" {
+		if _, err := volumeid.Decode(startingToken); err != nil {
+			return nil, "", fmt.Errorf("%w %q: %w", ErrInvalidStartingToken, startingToken, err)
+		}
+		start = sort.SearchStrings(sorted, startingToken)
+	}
+
+	end := len(sorted)
+	if maxEntries > 0 && start+int(maxEntries) < end {
+		end = start + int(maxEntries)
+	}
+
+	nextToken := ""
+	if end < len(sorted) {
+		nextToken = sorted[end]
+	}
+
+	return sorted[start:end], nextToken, nil
+}
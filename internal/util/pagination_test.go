@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+
+	id := func(uuid string) string {
+		return "0001-0009-cluster-1-0000000000000001-" + uuid
+	}
+	ids := []string{
+		id("00000000-0000-0000-0000-000000000003"),
+		id("00000000-0000-0000-0000-000000000001"),
+		id("00000000-0000-0000-0000-000000000004"),
+		id("00000000-0000-0000-0000-000000000002"),
+	}
+
+	tests := []struct {
+		name          string
+		maxEntries    int32
+		startingToken string
+		want          []string
+		wantToken     string
+		wantErr       error
+	}{
+		{
+			name: "all entries",
+			want: []string{
+				id("00000000-0000-0000-0000-000000000001"),
+				id("00000000-0000-0000-0000-000000000002"),
+				id("00000000-0000-0000-0000-000000000003"),
+				id("00000000-0000-0000-0000-000000000004"),
+			},
+		},
+		{
+			name:       "first page",
+			maxEntries: 2,
+			want: []string{
+				id("00000000-0000-0000-0000-000000000001"),
+				id("00000000-0000-0000-0000-000000000002"),
+			},
+			wantToken: id("00000000-0000-0000-0000-000000000003"),
+		},
+		{
+			name:          "last page",
+			maxEntries:    2,
+			startingToken: id("00000000-0000-0000-0000-000000000003"),
+			want: []string{
+				id("00000000-0000-0000-0000-000000000003"),
+				id("00000000-0000-0000-0000-000000000004"),
+			},
+		},
+		{
+			name:          "token of a removed entry",
+			maxEntries:    1,
+			startingToken: id("00000000-0000-0000-0000-000000000000"),
+			want:          []string{id("00000000-0000-0000-0000-000000000001")},
+			wantToken:     id("00000000-0000-0000-0000-000000000002"),
+		},
+		{
+			name:          "token after the last entry",
+			startingToken: id("00000000-0000-0000-0000-000000000005"),
+			want:          []string{},
+		},
+		{
+			name:          "invalid token",
+			startingToken: "invalid-token",
+			wantErr:       ErrInvalidStartingToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, token, err := Paginate(ids, tt.maxEntries, tt.startingToken)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+			require.Equal(t, tt.wantToken, token)
+		})
+	}
+
+	_, _, err := Paginate(ids, -1, "")
+	require.Error(t, err)
+}
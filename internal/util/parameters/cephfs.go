@@ -0,0 +1,141 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+// CephFS is the name of the schema of the CephFS driver.
+const CephFS = "cephfs"
+
+func init() {
+	register(CephFS, commonParameters()...)
+	register(CephFS, cephFSParameters()...)
+}
+
+func cephFSParameters() []Parameter {
+	return []Parameter{
+		{
+			Name:        "fsName",
+			Type:        String,
+			Scopes:      []Scope{StorageClass, VolumeGroupSnapshotClass},
+			Required:    true,
+			Description: "name of the CephFS filesystem",
+		},
+		{
+			Name:        "mounter",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"kernel", "fuse"},
+			Description: "mount the volumes with the kernel client or ceph-fuse, selected on the node when empty",
+		},
+		{
+			Name:        "pool",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "data pool of the subvolumes",
+		},
+		{
+			Name:        "kernelMountOptions",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "comma separated options of the kernel client",
+		},
+		{
+			Name:        "fuseMountOptions",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "comma separated options of ceph-fuse",
+		},
+		{
+			Name:        "backingSnapshot",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "false",
+			Description: "back read-only volumes by the snapshot of the data source instead of a clone",
+		},
+		{
+			Name:        "snapshotRetention",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"retain", "delete"},
+			Default:     "retain",
+			Description: "keep the snapshots of a subvolume when the volume is deleted, or delete them",
+		},
+		{
+			Name:        "pinType",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"export", "distributed", "random"},
+			Description: "pin policy of the subvolumes, requires pinSetting",
+		},
+		{
+			Name:        "pinSetting",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "setting of the pinType",
+		},
+		{
+			Name:        "tenantSecretName",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "Secret in the namespace of the PVC that gets the credentials of a cephx user of the subvolume",
+		},
+		{
+			Name:        "subvolumeGroup",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "subvolumegroup of the subvolumes, overrides the subvolumeGroup of the CSI configuration",
+		},
+		{
+			Name:        "subvolumeGroupMode",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "octal permissions of a subvolumegroup that is created",
+		},
+		{
+			Name:        "subvolumeGroupUID",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: "owner of a subvolumegroup that is created",
+		},
+		{
+			Name:        "subvolumeGroupGID",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: "group of a subvolumegroup that is created",
+		},
+		{
+			Name:        "subvolumeGroupPinType",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"export", "distributed", "random"},
+			Description: "pin policy of a subvolumegroup that is created",
+		},
+		{
+			Name:        "subvolumeGroupPinSetting",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "setting of the subvolumeGroupPinType",
+		},
+		{
+			Name:        "mountGroupPolicy",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"RootOnly", "Recursive"},
+			Default:     "RootOnly",
+			Description: "how the fsGroup of Pods is applied with --volume-mount-group",
+		},
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+var (
+	storageClass        = []Scope{StorageClass}
+	volumeSnapshotClass = []Scope{VolumeSnapshotClass}
+	allClasses          = []Scope{StorageClass, VolumeSnapshotClass, VolumeGroupSnapshotClass}
+)
+
+// commonParameters returns the parameters that all drivers accept.
+func commonParameters() []Parameter {
+	return []Parameter{
+		{
+			Name:        "clusterID",
+			Type:        String,
+			Scopes:      allClasses,
+			Required:    true,
+			Description: "ID of the Ceph cluster in the CSI configuration",
+		},
+		{
+			Name:        "volumeNamePrefix",
+			Type:        String,
+			Scopes:      storageClass,
+			Default:     "csi-vol-",
+			Description: "prefix of the names of the images or subvolumes of the volumes",
+		},
+		{
+			Name:        "snapshotNamePrefix",
+			Type:        String,
+			Scopes:      volumeSnapshotClass,
+			Default:     "csi-snap-",
+			Description: "prefix of the names of the snapshots",
+		},
+		{
+			Name:        "includeVolumeSnapshotName",
+			Type:        Bool,
+			Scopes:      volumeSnapshotClass,
+			Default:     "false",
+			Description: "add the namespace and name of the VolumeSnapshot to the names of the snapshots",
+		},
+		{
+			Name:        "maxSnapshots",
+			Type:        Uint,
+			Scopes:      volumeSnapshotClass,
+			Description: "maximum number of snapshots of a volume, overrides the limit of the CSI configuration",
+		},
+		{
+			Name:        "minSnapshotInterval",
+			Type:        Duration,
+			Scopes:      volumeSnapshotClass,
+			Description: "minimum time between two snapshots of a volume",
+		},
+		{
+			Name:        "topologyConstrainedPools",
+			Type:        JSON,
+			Scopes:      storageClass,
+			Description: "pools with the topology domain segments they are accessible from",
+		},
+		{
+			Name:        "encrypted",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "false",
+			Description: "encrypt the volumes",
+		},
+		{
+			Name:        "encryptionKMSID",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "ID of the KMS configuration of the passphrases of encrypted volumes",
+		},
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+// NFS is the name of the schema of the NFS driver.
+const NFS = "nfs"
+
+func init() {
+	// the volumes of the NFS driver are CephFS subvolumes
+	register(NFS, commonParameters()...)
+	register(NFS, cephFSParameters()...)
+	register(NFS, nfsParameters()...)
+}
+
+func nfsParameters() []Parameter {
+	return []Parameter{
+		{
+			Name:        "nfsCluster",
+			Type:        String,
+			Scopes:      storageClass,
+			Required:    true,
+			Description: "name of the NFS-cluster that is managed by Ceph",
+		},
+		{
+			Name:        "server",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "address of the NFS-server, the ingress or the backends of the NFS-cluster when empty",
+		},
+		{
+			Name:        "nfsMountOptions",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "comma separated mount options that are added to the mountOptions",
+		},
+		{
+			Name:        "secTypes",
+			Type:        List,
+			Scopes:      storageClass,
+			Values:      []string{"none", "sys", "krb5", "krb5i", "krb5p"},
+			IgnoreCase:  true,
+			Description: "security flavors of the NFS-exports",
+		},
+		{
+			Name:        "clients",
+			Type:        List,
+			Scopes:      storageClass,
+			Description: "hostnames, networks or addresses that can access the NFS-exports",
+		},
+		{
+			Name:        "squash",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"none", "root", "all", "rootid"},
+			IgnoreCase:  true,
+			Description: "squash mode of the NFS-exports",
+		},
+		{
+			Name:        "transports",
+			Type:        List,
+			Scopes:      storageClass,
+			Values:      []string{"TCP", "UDP"},
+			IgnoreCase:  true,
+			Description: "transport protocols of the NFS-exports",
+		},
+		{
+			Name:        "nfsVersions",
+			Type:        List,
+			Scopes:      storageClass,
+			Values:      []string{"3", "4"},
+			Description: "NFS protocol versions of the NFS-exports",
+		},
+	}
+}
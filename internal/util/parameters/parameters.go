@@ -0,0 +1,268 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package parameters contains the schemas of the parameters that the drivers
+// accept in StorageClasses and VolumeSnapshotClasses.
+package parameters
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// ErrInvalidParameter is returned when the value of a parameter does not
+// match the type of the parameter.
+var ErrInvalidParameter = errors.New("invalid parameter")
+
+// Type is the type of the value of a parameter.
+type Type string
+
+const (
+	// String accepts any value.
+	String Type = "string"
+	// Bool accepts the values of strconv.ParseBool, like "true" or "false".
+	Bool Type = "bool"
+	// Int accepts a signed integer.
+	Int Type = "int"
+	// Uint accepts an unsigned integer.
+	Uint Type = "uint"
+	// Duration accepts the values of time.ParseDuration, like "72h".
+	Duration Type = "duration"
+	// Enum accepts one of the Values of the parameter. The case of the
+	// value needs to match, unless IgnoreCase is set.
+	Enum Type = "enum"
+	// List accepts a comma separated list, of the Values of the parameter
+	// when they are set. The case of the items needs to match, unless
+	// IgnoreCase is set.
+	List Type = "list"
+	// JSON accepts a JSON document.
+	JSON Type = "json"
+)
+
+// Scope is the kind of object that a parameter is set in.
+type Scope string
+
+const (
+	StorageClass             Scope = "StorageClass"
+	VolumeSnapshotClass      Scope = "VolumeSnapshotClass"
+	VolumeGroupSnapshotClass Scope = "VolumeGroupSnapshotClass"
+)
+
+// Parameter describes a parameter that a driver accepts.
+type Parameter struct {
+	Name   string  `json:"name"`
+	Type   Type    `json:"type"`
+	Scopes []Scope `json:"scopes"`
+	// Required is set for parameters that need to be set, the drivers check
+	// these themselves as some have alternatives
+	Required bool `json:"required,omitempty"`
+	// Values are the accepted values of Enum and List parameters
+	Values []string `json:"values,omitempty"`
+	// IgnoreCase is set when the driver accepts the Values in any case
+	IgnoreCase bool   `json:"ignoreCase,omitempty"`
+	Default    string `json:"default,omitempty"`
+	// Deprecated is the reason of the deprecation of the parameter, like
+	// the parameter to use instead, empty when it is not deprecated
+	Deprecated  string `json:"deprecated,omitempty"`
+	Description string `json:"description"`
+}
+
+// Schema contains the parameters of a driver.
+type Schema struct {
+	Driver     string      `json:"driver"`
+	Parameters []Parameter `json:"parameters"`
+}
+
+var (
+	schemas = map[string]*Schema{}
+
+	// deprecationWarnings contains the deprecated parameters that a warning
+	// was logged for, by driver and name
+	deprecationWarnings   = map[string]bool{}
+	deprecationWarningsMu sync.Mutex
+)
+
+// register adds the parameters to the schema of the driver.
+func register(driver string, params ...Parameter) {
+	s, ok := schemas[driver]
+	if !ok {
+		s = &Schema{Driver: driver}
+		schemas[driver] = s
+	}
+	s.Parameters = append(s.Parameters, params...)
+}
+
+// Schemas returns the schemas of all drivers, sorted by driver.
+func Schemas() []Schema {
+	all := make([]Schema, 0, len(schemas))
+	for _, s := range schemas {
+		all = append(all, *s)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Driver < all[j].Driver })
+
+	return all
+}
+
+// Check returns an error when a schema is inconsistent, like a parameter
+// that is listed twice or a default that is not valid.
+func Check() error {
+	for _, s := range Schemas() {
+		if err := s.check(); err != nil {
+			return fmt.Errorf("schema of %s parameters: %w", s.Driver, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) check() error {
+	names := map[string]bool{}
+	for _, p := range s.Parameters {
+		if names[p.Name] {
+			return fmt.Errorf("parameter %q is listed more than once", p.Name)
+		}
+		names[p.Name] = true
+
+		if len(p.Scopes) == 0 {
+			return fmt.Errorf("parameter %q has no scope", p.Name)
+		}
+		if p.Type == Enum && len(p.Values) == 0 {
+			return fmt.Errorf("enum parameter %q has no values", p.Name)
+		}
+		if p.Default != "" {
+			if err := p.validate(p.Default); err != nil {
+				return fmt.Errorf("default of parameter %q: %w", p.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the parameter of the scope with the name.
+func (s *Schema) lookup(scope Scope, name string) (Parameter, bool) {
+	for _, p := range s.Parameters {
+		if p.Name == name && slices.Contains(p.Scopes, scope) {
+			return p, true
+		}
+	}
+
+	return Parameter{}, false
+}
+
+// Validate checks the values of the parameters of the scope against the
+// schema of the driver, and logs a warning for deprecated parameters once.
+// Parameters that are not in the schema and empty values are not checked.
+func Validate(ctx context.Context, driver string, scope Scope, params map[string]string) error {
+	s, ok := schemas[driver]
+	if !ok {
+		return nil
+	}
+
+	for name, value := range params {
+		p, found := s.lookup(scope, name)
+		if !found {
+			continue
+		}
+
+		if p.Deprecated != "" {
+			warnDeprecated(ctx, driver, p)
+		}
+
+		if value == "" {
+			continue
+		}
+		if err := p.validate(value); err != nil {
+			return fmt.Errorf("%w %q: %w", ErrInvalidParameter, name, err)
+		}
+	}
+
+	return nil
+}
+
+// warnDeprecated logs a warning for the deprecated parameter, once for each
+// driver.
+func warnDeprecated(ctx context.Context, driver string, p Parameter) {
+	deprecationWarningsMu.Lock()
+	defer deprecationWarningsMu.Unlock()
+
+	key := driver + "/" + p.Name
+	if deprecationWarnings[key] {
+		return
+	}
+	deprecationWarnings[key] = true
+
+	log.WarningLog(ctx, "the %s parameter %q is deprecated: %s", driver, p.Name, p.Deprecated)
+}
+
+// validate returns an error when the value does not match the type of the
+// parameter.
+func (p Parameter) validate(value string) error {
+	var err error
+	switch p.Type {
+	case Bool:
+		_, err = strconv.ParseBool(value)
+	case Int:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case Uint:
+		_, err = strconv.ParseUint(value, 10, 64)
+	case Duration:
+		_, err = time.ParseDuration(value)
+	case Enum:
+		if !p.accepts(value) {
+			err = fmt.Errorf("%q is not one of %v", value, p.Values)
+		}
+	case List:
+		if len(p.Values) == 0 {
+			break
+		}
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" && !p.accepts(item) {
+				return fmt.Errorf("%q is not one of %v", item, p.Values)
+			}
+		}
+	case JSON:
+		if !json.Valid([]byte(value)) {
+			err = errors.New("not a valid JSON document")
+		}
+	case String:
+	}
+
+	return err
+}
+
+// accepts returns true when the Values of the parameter contain the value.
+// The case is only ignored when the driver does so as well.
+func (p Parameter) accepts(value string) bool {
+	if !p.IgnoreCase {
+		return slices.Contains(p.Values, value)
+	}
+
+	return slices.ContainsFunc(p.Values, func(v string) bool {
+		return strings.EqualFold(v, value)
+	})
+}
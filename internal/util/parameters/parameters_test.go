@@ -0,0 +1,213 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, Check())
+	for _, driver := range []string{RBD, CephFS, NFS} {
+		require.Contains(t, schemas, driver)
+	}
+}
+
+func TestSchemaCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		params  []Parameter
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			params: []Parameter{
+				{Name: "a", Type: Uint, Scopes: storageClass, Default: "1"},
+				{Name: "b", Type: Enum, Scopes: storageClass, Values: []string{"x", "y"}, Default: "y"},
+			},
+		},
+		{
+			name: "duplicate",
+			params: []Parameter{
+				{Name: "a", Type: String, Scopes: storageClass},
+				{Name: "a", Type: Bool, Scopes: storageClass},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no scope",
+			params:  []Parameter{{Name: "a", Type: String}},
+			wantErr: true,
+		},
+		{
+			name:    "enum without values",
+			params:  []Parameter{{Name: "a", Type: Enum, Scopes: storageClass}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid default",
+			params:  []Parameter{{Name: "a", Type: Duration, Scopes: storageClass, Default: "1 day"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := &Schema{Driver: "test", Parameters: tt.params}
+			err := s.check()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	tests := []struct {
+		name    string
+		driver  string
+		scope   Scope
+		params  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "valid rbd parameters",
+			driver: RBD,
+			scope:  StorageClass,
+			params: map[string]string{
+				"clusterID":      "cluster-1",
+				"thickProvision": "true",
+				"stripeCount":    "4",
+				"imageFeatures":  "layering,exclusive-lock",
+				"trashExpiry":    "72h",
+				"encryptionType": "block",
+			},
+		},
+		{
+			name:    "enum with a different case",
+			driver:  RBD,
+			scope:   StorageClass,
+			params:  map[string]string{"encryptionType": "Block"},
+			wantErr: true,
+		},
+		{
+			name:   "enum that ignores the case",
+			driver: NFS,
+			scope:  StorageClass,
+			params: map[string]string{"squash": "Root", "transports": "tcp", "secTypes": "SYS,krb5"},
+		},
+		{
+			name:    "invalid bool",
+			driver:  RBD,
+			scope:   StorageClass,
+			params:  map[string]string{"thickProvision": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "negative uint",
+			driver:  RBD,
+			scope:   StorageClass,
+			params:  map[string]string{"stripeCount": "-1"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid enum",
+			driver:  CephFS,
+			scope:   StorageClass,
+			params:  map[string]string{"mounter": "nfs"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			driver:  CephFS,
+			scope:   StorageClass,
+			params:  map[string]string{"topologyConstrainedPools": "[{"},
+			wantErr: true,
+		},
+		{
+			name:   "empty values are not checked",
+			driver: CephFS,
+			scope:  StorageClass,
+			params: map[string]string{"backingSnapshot": ""},
+		},
+		{
+			name:   "unknown parameters are not checked",
+			driver: CephFS,
+			scope:  StorageClass,
+			params: map[string]string{"csi.storage.k8s.io/fstype": "ext4", "nfsCluster": "x"},
+		},
+		{
+			name:    "list item not in values",
+			driver:  NFS,
+			scope:   StorageClass,
+			params:  map[string]string{"nfsVersions": "3, 4.1"},
+			wantErr: true,
+		},
+		{
+			name:   "parameter of another scope",
+			driver: RBD,
+			scope:  VolumeSnapshotClass,
+			params: map[string]string{"thickProvision": "maybe"},
+		},
+		{
+			name:   "unknown driver",
+			driver: "unknown",
+			scope:  StorageClass,
+			params: map[string]string{"thickProvision": "maybe"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := Validate(ctx, tt.driver, tt.scope, tt.params)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidParameter)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWarnDeprecated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	p := Parameter{Name: "test-deprecated", Deprecated: "use another parameter"}
+
+	warnDeprecated(ctx, "test", p)
+	warnDeprecated(ctx, "test", p)
+
+	deprecationWarningsMu.Lock()
+	defer deprecationWarningsMu.Unlock()
+	require.True(t, deprecationWarnings["test/test-deprecated"])
+	require.Len(t, deprecationWarnings, 1)
+}
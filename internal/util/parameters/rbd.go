@@ -0,0 +1,278 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parameters
+
+// RBD is the name of the schema of the RBD driver.
+const RBD = "rbd"
+
+func init() {
+	register(RBD, commonParameters()...)
+	register(RBD, rbdParameters()...)
+	register(RBD, qosParameters()...)
+}
+
+func rbdParameters() []Parameter {
+	return []Parameter{
+		{
+			Name:        "clusterIDs",
+			Type:        List,
+			Scopes:      storageClass,
+			Description: "ordered list of clusterIDs, volumes are created on the first available cluster",
+		},
+		{
+			Name:        "pool",
+			Type:        String,
+			Scopes:      []Scope{StorageClass, VolumeGroupSnapshotClass},
+			Required:    true,
+			Description: "pool of the images",
+		},
+		{
+			Name:        "dataPool",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "pool of the data of the images",
+		},
+		{
+			Name:        "journalPool",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "pool of the journal of the volumes, the pool of the images when empty",
+		},
+		{
+			Name:        "imageFeatures",
+			Type:        List,
+			Scopes:      storageClass,
+			Description: "features of the images, like layering,exclusive-lock,object-map,fast-diff",
+		},
+		{
+			Name:        "mkfsOptions",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "options of mkfs for the filesystem of the volumes",
+		},
+		{
+			Name:        "mkfsAlignment",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "true",
+			Description: "align new ext4 and xfs filesystems to the stripe unit and count of the images",
+		},
+		{
+			Name:    "mounter",
+			Type:    String,
+			Scopes:  storageClass,
+			Default: "rbd",
+			Description: "map the images with krbd (rbd), rbd-nbd, or with rbd-nbd when krbd lacks features " +
+				"of the image (auto)",
+		},
+		{
+			Name:        "tryOtherMounters",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "false",
+			Description: "try the other mounter when mapping the image fails",
+		},
+		{
+			Name:        "mapOptions",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "options to map the images, optionally prefixed with krbd: or nbd:",
+		},
+		{
+			Name:        "unmapOptions",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "options to unmap the images, optionally prefixed with krbd: or nbd:",
+		},
+		{
+			Name:        "nbdIOTimeout",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Default:     "0",
+			Description: "seconds before rbd-nbd aborts an IO request, 0 to never abort them",
+		},
+		{
+			Name:        "nbdReattachTimeout",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Default:     "300",
+			Description: "seconds that the device waits for rbd-nbd to reattach after a restart of the nodeplugin",
+		},
+		{
+			Name:        "nbdThreads",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: "number of librbd worker threads that handle the IO of rbd-nbd",
+		},
+		{
+			Name:        "cephLogDir",
+			Type:        String,
+			Scopes:      storageClass,
+			Default:     "/var/log/ceph",
+			Description: "directory of the logs of rbd-nbd",
+		},
+		{
+			Name:        "cephLogStrategy",
+			Type:        String,
+			Scopes:      storageClass,
+			Default:     "remove",
+			Description: "action on the log of rbd-nbd when the image is unmapped: remove, compress or preserve",
+		},
+		{
+			Name:        "encryptionType",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"block", "file"},
+			Default:     "block",
+			Description: "encrypt the device with LUKS (block) or the filesystem with fscrypt (file)",
+		},
+		{
+			Name:        "stripeUnit",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: "stripe unit of the images in bytes",
+		},
+		{
+			Name:        "stripeCount",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: "objects to stripe over before looping",
+		},
+		{
+			Name:        "objectSize",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: "object size of the images in bytes, a power of 2 between 4KiB and 32MiB",
+		},
+		{
+			Name:        "sourceImage",
+			Type:        String,
+			Scopes:      storageClass,
+			Description: "image that new volumes are cloned from, as [<pool>/[<namespace>/]]<image>",
+		},
+		{
+			Name:        "cloneWarmup",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"copy-on-read", "flatten"},
+			Description: "copy the data of the parent into cloned volumes",
+		},
+		{
+			Name:        "copyParallelism",
+			Type:        Uint,
+			Scopes:      storageClass,
+			Default:     "4",
+			Description: "number of extents copied at the same time when the data of a volume is copied",
+		},
+		{
+			Name:        "copyVerify",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "false",
+			Description: "compare the checksums of the copied data with the source",
+		},
+		{
+			Name:        "compressionHint",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"none", "compressible", "incompressible"},
+			Description: "hint for BlueStore compression that is set as rbd_compression_hint on the images",
+		},
+		{
+			Name:        "compressionMode",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"none", "passive", "aggressive", "force"},
+			Description: "BlueStore compression_mode that the (data) pool of the images needs to have",
+		},
+		{
+			Name:        "thickProvision",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "false",
+			Description: "allocate all extents of the images on creation and expansion",
+		},
+		{
+			Name:        "trashExpiry",
+			Type:        Duration,
+			Scopes:      storageClass,
+			Description: "time the images of deleted volumes are kept in the trash",
+		},
+		{
+			Name:        "forceDeleteMirrored",
+			Type:        Bool,
+			Scopes:      storageClass,
+			Default:     "false",
+			Description: "delete volumes with mirrored images that are not primary",
+		},
+		{
+			Name:        "fsckMode",
+			Type:        Enum,
+			Scopes:      storageClass,
+			Values:      []string{"warn", "repair", "fail"},
+			Description: "check the filesystem on NodeStageVolume",
+		},
+		{
+			Name:        "groupNamePrefix",
+			Type:        String,
+			Scopes:      []Scope{VolumeGroupSnapshotClass},
+			Description: "prefix of the names of the groups of images",
+		},
+	}
+}
+
+// qosParameters returns the parameters of the IO limits of RBD volumes.
+func qosParameters() []Parameter {
+	limits := []struct {
+		name, description string
+	}{
+		{"qosIOPSLimit", "IOPS limit of the images"},
+		{"qosReadIOPSLimit", "read IOPS limit of the images"},
+		{"qosWriteIOPSLimit", "write IOPS limit of the images"},
+		{"qosBPSLimit", "bytes per second limit of the images"},
+		{"qosReadBPSLimit", "read bytes per second limit of the images"},
+		{"qosWriteBPSLimit", "write bytes per second limit of the images"},
+		{"qosIOPSBurst", "IOPS burst limit of the images"},
+		{"qosReadIOPSBurst", "read IOPS burst limit of the images"},
+		{"qosWriteIOPSBurst", "write IOPS burst limit of the images"},
+		{"qosBPSBurst", "bytes per second burst limit of the images"},
+		{"qosReadBPSBurst", "read bytes per second burst limit of the images"},
+		{"qosWriteBPSBurst", "write bytes per second burst limit of the images"},
+		{"qosPerGiBIOPS", "IOPS limit per GiB of the volume size"},
+		{"qosPerGiBReadIOPS", "read IOPS limit per GiB of the volume size"},
+		{"qosPerGiBWriteIOPS", "write IOPS limit per GiB of the volume size"},
+		{"qosPerGiBBandwidth", "bytes per second limit per GiB of the volume size"},
+		{"qosPerGiBReadBandwidth", "read bytes per second limit per GiB of the volume size"},
+		{"qosPerGiBWriteBandwidth", "write bytes per second limit per GiB of the volume size"},
+		{"podReadBPSLimit", "read bytes per second limit of each Pod"},
+		{"podWriteBPSLimit", "write bytes per second limit of each Pod"},
+		{"podReadIOPSLimit", "read IOPS limit of each Pod"},
+		{"podWriteIOPSLimit", "write IOPS limit of each Pod"},
+	}
+
+	params := make([]Parameter, 0, len(limits))
+	for _, l := range limits {
+		params = append(params, Parameter{
+			Name:        l.name,
+			Type:        Uint,
+			Scopes:      storageClass,
+			Description: l.description,
+		})
+	}
+
+	return params
+}
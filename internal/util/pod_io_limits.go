@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// PodUIDKey is the key in the volume context of NodePublishVolume with
+	// the UID of the Pod. Kubelet only sets it when podInfoOnMount is
+	// enabled in the CSIDriver object.
+	PodUIDKey = "csi.storage.k8s.io/pod.uid"
+
+	cgroupV2Root = "/sys/fs/cgroup"
+)
+
+var (
+	// ErrPodCgroupNotFound is returned when the cgroup of a Pod is not
+	// found.
+	ErrPodCgroupNotFound = errors.New("cgroup of pod not found")
+
+	// ioMaxKeys are the keys of the limits in the cgroup v2 io.max file,
+	// in the order they are written.
+	ioMaxKeys = []string{"rbps", "wbps", "riops", "wiops"}
+)
+
+// findPodCgroup returns the cgroup v2 directory of the Pod under the root.
+// Kubelet creates the cgroups of Pods with the cgroupfs driver as
+// kubepods/[<qos>/]pod<uid>, and with the systemd driver as
+// kubepods.slice/[kubepods-<qos>.slice/]kubepods-[<qos>-]pod<uid>.slice with
+// the dashes of the UID replaced by underscores.
+func findPodCgroup(root, podUID string) (string, error) {
+	systemdUID := strings.ReplaceAll(podUID, "-", "_")
+	patterns := []string{
+		filepath.Join(root, "kubepods*", "pod"+podUID),
+		filepath.Join(root, "kubepods*", "*", "pod"+podUID),
+		filepath.Join(root, "kubepods*", "kubepods-*pod"+systemdUID+".slice"),
+		filepath.Join(root, "kubepods*", "*", "kubepods-*pod"+systemdUID+".slice"),
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return "", err
+		}
+		if len(matches) != 0 {
+			return matches[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrPodCgroupNotFound, podUID)
+}
+
+// ioMaxLine returns the line for the cgroup v2 io.max file that sets the
+// limits on the device. The limits are keyed by rbps, wbps, riops and wiops,
+// limits that are not set are not changed.
+func ioMaxLine(major, minor uint32, limits map[string]uint64) string {
+	line := fmt.Sprintf("%d:%d", major, minor)
+	for _, key := range ioMaxKeys {
+		if limit, ok := limits[key]; ok {
+			line += " " + key + "=" + strconv.FormatUint(limit, 10)
+		}
+	}
+
+	return line
+}
+
+// deviceNumber returns the major and minor number of the block device at the
+// path, or of the device with the filesystem that contains the path.
+func deviceNumber(path string) (uint32, uint32, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, 0, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	dev := st.Dev
+	if st.Mode&unix.S_IFMT == unix.S_IFBLK {
+		dev = st.Rdev
+	}
+
+	return unix.Major(dev), unix.Minor(dev), nil
+}
+
+// SetPodIOLimits limits the IO of the Pod on the block device at the path, or
+// on the device with the filesystem that contains the path. The limits are
+// keyed by the names in the cgroup v2 io.max file (rbps, wbps, riops and
+// wiops). The cgroup of the Pod is removed with the Pod, the limits do not
+// need to be reset.
+func SetPodIOLimits(podUID, path string, limits map[string]uint64) error {
+	if _, err := os.Stat(filepath.Join(cgroupV2Root, "cgroup.controllers")); err != nil {
+		return fmt.Errorf("IO limits for pods require cgroup v2: %w", err)
+	}
+
+	major, minor, err := deviceNumber(path)
+	if err != nil {
+		return err
+	}
+
+	cgroup, err := findPodCgroup(cgroupV2Root, podUID)
+	if err != nil {
+		return err
+	}
+
+	ioMax := filepath.Join(cgroup, "io.max")
+	// #nosec:G304, the cgroup is found in the cgroup v2 hierarchy
+	f, err := os.OpenFile(ioMax, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s, is the io controller enabled: %w", ioMax, err)
+	}
+	defer f.Close() // #nosec: error on close is not critical here
+
+	if _, err = f.WriteString(ioMaxLine(major, minor, limits)); err != nil {
+		return fmt.Errorf("failed to set IO limits in %s: %w", ioMax, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindPodCgroup(t *testing.T) {
+	t.Parallel()
+
+	podUID := "2c0b4a3e-7c1f-4b8a-9d5e-3f6a1b2c3d4e"
+
+	tests := []struct {
+		name    string
+		cgroup  string
+		wantErr bool
+	}{
+		{
+			name:   "cgroupfs guaranteed",
+			cgroup: "kubepods/pod" + podUID,
+		},
+		{
+			name:   "cgroupfs burstable",
+			cgroup: "kubepods/burstable/pod" + podUID,
+		},
+		{
+			name:   "systemd guaranteed",
+			cgroup: "kubepods.slice/kubepods-pod2c0b4a3e_7c1f_4b8a_9d5e_3f6a1b2c3d4e.slice",
+		},
+		{
+			name: "systemd besteffort",
+			cgroup: "kubepods.slice/kubepods-besteffort.slice/" +
+				"kubepods-besteffort-pod2c0b4a3e_7c1f_4b8a_9d5e_3f6a1b2c3d4e.slice",
+		},
+		{
+			name:    "other pod",
+			cgroup:  "kubepods/burstable/pod8f0c6a1d-2b3e-4c5f-a6b7-c8d9e0f1a2b3",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(root, tt.cgroup), 0o755))
+
+			cgroup, err := findPodCgroup(root, podUID)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrPodCgroupNotFound)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(root, tt.cgroup), cgroup)
+		})
+	}
+}
+
+func TestIOMaxLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		limits map[string]uint64
+		want   string
+	}{
+		{
+			name:   "all limits",
+			limits: map[string]uint64{"wiops": 400, "riops": 300, "wbps": 200, "rbps": 100},
+			want:   "252:0 rbps=100 wbps=200 riops=300 wiops=400",
+		},
+		{
+			name:   "write limits",
+			limits: map[string]uint64{"wbps": 1048576, "wiops": 100},
+			want:   "252:0 wbps=1048576 wiops=100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.want, ioMaxLine(252, 0, tt.limits))
+		})
+	}
+}
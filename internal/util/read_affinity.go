@@ -75,3 +75,30 @@ func GetReadAffinityMapOptions(
 
 	return readAffinityMapOptions, nil
 }
+
+// ConvertReadAffinityMapOptionsForNbd converts read affinity map options in
+// the krbd format ("read_from_replica=localize,crush_location=a:b|c:d") to
+// the librbd configuration options that rbd-nbd accepts
+// ("rbd_read_from_replica_policy=localize,crush_location=a=b c=d").
+func ConvertReadAffinityMapOptionsForNbd(readAffinityMapOptions string) string {
+	if readAffinityMapOptions == "" {
+		return ""
+	}
+
+	options := strings.Split(readAffinityMapOptions, ",")
+	for i, option := range options {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "read_from_replica":
+			options[i] = "rbd_read_from_replica_policy=" + value
+		case "crush_location":
+			locations := strings.Split(value, "|")
+			for j, location := range locations {
+				locations[j] = strings.Replace(location, ":", "=", 1)
+			}
+			options[i] = "crush_location=" + strings.Join(locations, " ")
+		}
+	}
+
+	return strings.Join(options, ",")
+}
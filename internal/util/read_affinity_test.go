@@ -65,3 +65,34 @@ func TestReadAffinity_ConstructReadAffinityMapOption(t *testing.T) {
 		})
 	}
 }
+
+func TestConvertReadAffinityMapOptionsForNbd(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		options string
+		want    string
+	}{
+		{
+			name:    "empty options",
+			options: "",
+			want:    "",
+		},
+		{
+			name:    "single crush location",
+			options: "read_from_replica=localize,crush_location=region:east",
+			want:    "rbd_read_from_replica_policy=localize,crush_location=region=east",
+		},
+		{
+			name:    "multiple crush locations",
+			options: "read_from_replica=localize,crush_location=region:east|zone:east-1",
+			want:    "rbd_read_from_replica_policy=localize,crush_location=region=east zone=east-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, ConvertReadAffinityMapOptionsForNbd(tt.options))
+		})
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseRPCTimeouts parses a comma separated list of timeouts for gRPC
+// methods, like "NodeStageVolume=5m,CreateVolume=10m". The method is the name
+// of the gRPC method without its service.
+func ParseRPCTimeouts(timeouts string) (map[string]time.Duration, error) {
+	parsed := make(map[string]time.Duration)
+	if timeouts == "" {
+		return parsed, nil
+	}
+
+	for _, entry := range strings.Split(timeouts, ",") {
+		method, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || method == "" {
+			return nil, fmt.Errorf("invalid RPC timeout %q, expected <method>=<duration>", entry)
+		}
+
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for RPC timeout of %q: %w", method, err)
+		}
+		if timeout <= 0 {
+			return nil, fmt.Errorf("RPC timeout of %q needs to be positive", method)
+		}
+
+		parsed[method] = timeout
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRPCTimeouts(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		timeouts string
+		want     map[string]time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "empty",
+			timeouts: "",
+			want:     map[string]time.Duration{},
+		},
+		{
+			name:     "multiple methods",
+			timeouts: "NodeStageVolume=5m, CreateVolume=90s",
+			want: map[string]time.Duration{
+				"NodeStageVolume": 5 * time.Minute,
+				"CreateVolume":    90 * time.Second,
+			},
+		},
+		{
+			name:     "missing duration",
+			timeouts: "NodeStageVolume",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid duration",
+			timeouts: "NodeStageVolume=5",
+			wantErr:  true,
+		},
+		{
+			name:     "negative duration",
+			timeouts: "NodeStageVolume=-5m",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseRPCTimeouts(tt.timeouts)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
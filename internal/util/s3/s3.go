@@ -0,0 +1,282 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package s3 uploads objects to an S3 compatible object store, like the
+// RADOS Gateway, with multipart uploads.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+const (
+	// the keys in the secret that configure the object store.
+	endpointKey        = "s3Endpoint"
+	bucketKey          = "s3Bucket"
+	regionKey          = "s3Region"
+	accessKeyIDKey     = "s3AccessKeyID"
+	secretAccessKeyKey = "s3SecretAccessKey"
+
+	defaultRegion = "us-east-1"
+
+	// partSize is the size of the parts of a multipart upload. S3 requires
+	// all parts, except the last one, to be at least 5 MiB.
+	partSize = 16 * 1024 * 1024
+
+	requestTimeout = 5 * time.Minute
+)
+
+// ErrMissingConfig is returned when the secret does not contain all the
+// required options to connect to the object store.
+var ErrMissingConfig = errors.New("missing object store configuration")
+
+// Config contains the endpoint, bucket and credentials of the object store.
+type Config struct {
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// NewConfig returns the configuration of the object store from the secrets.
+func NewConfig(secrets map[string]string) (*Config, error) {
+	cfg := &Config{
+		Endpoint:        secrets[endpointKey],
+		Bucket:          secrets[bucketKey],
+		Region:          secrets[regionKey],
+		AccessKeyID:     secrets[accessKeyIDKey],
+		SecretAccessKey: secrets[secretAccessKeyKey],
+	}
+
+	for key, value := range map[string]string{
+		endpointKey:        cfg.Endpoint,
+		bucketKey:          cfg.Bucket,
+		accessKeyIDKey:     cfg.AccessKeyID,
+		secretAccessKeyKey: cfg.SecretAccessKey,
+	} {
+		if value == "" {
+			return nil, fmt.Errorf("%w: %q is not set", ErrMissingConfig, key)
+		}
+	}
+
+	if _, err := url.ParseRequestURI(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid %q %q: %w", endpointKey, cfg.Endpoint, err)
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+
+	return cfg, nil
+}
+
+// objectURL returns the path-style URL of the object with the key.
+func (cfg *Config) objectURL(key string, query url.Values) string {
+	u := strings.TrimSuffix(cfg.Endpoint, "/") + "/" + url.PathEscape(cfg.Bucket) + "/"
+	for i, part := range strings.Split(key, "/") {
+		if i > 0 {
+			u += "/"
+		}
+		u += url.PathEscape(part)
+	}
+
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+
+	return u
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// Uploader is an io.WriteCloser that uploads the written data as an object
+// in parts of partSize. The object is created in the object store when the
+// Uploader is closed.
+type Uploader struct {
+	ctx      context.Context
+	cfg      *Config
+	client   *http.Client
+	signer   *v4.Signer
+	key      string
+	uploadID string
+	parts    []completedPart
+	buf      bytes.Buffer
+}
+
+// NewUploader starts a multipart upload of the object with the key. The
+// upload needs to be completed with Close, or cancelled with Abort.
+func NewUploader(ctx context.Context, cfg *Config, key string) (*Uploader, error) {
+	u := &Uploader{
+		ctx:    ctx,
+		cfg:    cfg,
+		client: &http.Client{Timeout: requestTimeout},
+		signer: v4.NewSigner(credentials.NewStaticCredentials(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+			func(s *v4.Signer) {
+				s.DisableURIPathEscaping = true
+			}),
+		key: key,
+	}
+
+	body, _, err := u.do(http.MethodPost, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start upload of %q: %w", key, err)
+	}
+
+	result := &initiateMultipartUploadResult{}
+	if err = xml.Unmarshal(body, result); err != nil {
+		return nil, fmt.Errorf("failed to parse response to upload of %q: %w", key, err)
+	}
+	if result.UploadID == "" {
+		return nil, fmt.Errorf("no upload ID returned for upload of %q", key)
+	}
+	u.uploadID = result.UploadID
+
+	return u, nil
+}
+
+// do sends a signed request for the object, and returns the body and the
+// headers of the response.
+func (u *Uploader) do(method string, query url.Values, data []byte) ([]byte, http.Header, error) {
+	reader := bytes.NewReader(data)
+	req, err := http.NewRequestWithContext(u.ctx, method, u.cfg.objectURL(u.key, query), reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = u.signer.Sign(req, reader, "s3", u.cfg.Region, time.Now())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("%s %s failed with status %q: %s",
+			method, u.key, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, resp.Header, nil
+}
+
+// uploadPart uploads the buffered data as the next part.
+func (u *Uploader) uploadPart() error {
+	partNumber := len(u.parts) + 1
+	query := url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {u.uploadID},
+	}
+
+	_, header, err := u.do(http.MethodPut, query, u.buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to upload part %d of %q: %w", partNumber, u.key, err)
+	}
+
+	u.parts = append(u.parts, completedPart{
+		PartNumber: partNumber,
+		ETag:       header.Get("ETag"),
+	})
+	u.buf.Reset()
+
+	return nil
+}
+
+// Write buffers the data and uploads a part once partSize bytes are
+// buffered.
+func (u *Uploader) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), partSize-u.buf.Len())
+		u.buf.Write(p[:n])
+		written += n
+		p = p[n:]
+
+		if u.buf.Len() == partSize {
+			if err := u.uploadPart(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// Close uploads the remaining data and completes the multipart upload, the
+// object is available in the bucket after that.
+func (u *Uploader) Close() error {
+	if u.buf.Len() != 0 || len(u.parts) == 0 {
+		if err := u.uploadPart(); err != nil {
+			return err
+		}
+	}
+
+	data, err := xml.Marshal(&completeMultipartUpload{Parts: u.parts})
+	if err != nil {
+		return fmt.Errorf("failed to encode parts of %q: %w", u.key, err)
+	}
+
+	_, _, err = u.do(http.MethodPost, url.Values{"uploadId": {u.uploadID}}, data)
+	if err != nil {
+		return fmt.Errorf("failed to complete upload of %q: %w", u.key, err)
+	}
+
+	return nil
+}
+
+// Abort cancels the multipart upload and removes the parts that were
+// uploaded already.
+func (u *Uploader) Abort() error {
+	_, _, err := u.do(http.MethodDelete, url.Values{"uploadId": {u.uploadID}}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to abort upload of %q: %w", u.key, err)
+	}
+
+	return nil
+}
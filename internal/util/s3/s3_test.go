@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfig(t *testing.T) {
+	t.Parallel()
+
+	secrets := map[string]string{
+		endpointKey:        "https://s3.example.com",
+		bucketKey:          "backups",
+		accessKeyIDKey:     "access",
+		secretAccessKeyKey: "secret",
+	}
+
+	tests := []struct {
+		name    string
+		remove  string
+		wantErr bool
+	}{
+		{
+			name: "all options set",
+		},
+		{
+			name:    "missing endpoint",
+			remove:  endpointKey,
+			wantErr: true,
+		},
+		{
+			name:    "missing bucket",
+			remove:  bucketKey,
+			wantErr: true,
+		},
+		{
+			name:    "missing secret access key",
+			remove:  secretAccessKeyKey,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s := map[string]string{}
+			for k, v := range secrets {
+				if k != tt.remove {
+					s[k] = v
+				}
+			}
+
+			cfg, err := NewConfig(s)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrMissingConfig)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, defaultRegion, cfg.Region)
+		})
+	}
+}
+
+// fakeObjectStore implements the multipart upload requests of S3.
+type fakeObjectStore struct {
+	mu      sync.Mutex
+	parts   map[string][]byte
+	objects map[string][]byte
+}
+
+func (f *fakeObjectStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		w.WriteHeader(http.StatusForbidden)
+
+		return
+	}
+
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		_, _ = w.Write([]byte("<InitiateMultipartUploadResult><UploadId>id-1</UploadId></InitiateMultipartUploadResult>"))
+	case r.Method == http.MethodPut && query.Get("uploadId") == "id-1":
+		etag := "etag-" + query.Get("partNumber")
+		f.parts[etag] = body
+		w.Header().Set("ETag", etag)
+	case r.Method == http.MethodPost && query.Get("uploadId") == "id-1":
+		complete := &completeMultipartUpload{}
+		if err := xml.Unmarshal(body, complete); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, f.parts[part.ETag]...)
+		}
+		f.objects[r.URL.Path] = data
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestUploader(t *testing.T) {
+	t.Parallel()
+
+	store := &fakeObjectStore{
+		parts:   map[string][]byte{},
+		objects: map[string][]byte{},
+	}
+	server := httptest.NewServer(store)
+	defer server.Close()
+
+	cfg := &Config{
+		Endpoint:        server.URL,
+		Bucket:          "backups",
+		Region:          defaultRegion,
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	}
+
+	u, err := NewUploader(context.Background(), cfg, "pool/image/full.diff")
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), partSize/8+3)
+	n, err := u.Write(data)
+	require.NoError(t, err)
+	require.Equal(t, len(data), n)
+	require.NoError(t, u.Close())
+
+	require.Len(t, u.parts, 3)
+	require.Equal(t, data, store.objects["/backups/pool/image/full.diff"])
+}
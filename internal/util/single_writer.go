@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	mount "k8s.io/mount-utils"
+)
+
+// singleWriterFile is the file in the staging directory of a volume that
+// records the Pod that the volume is published for, when the volume uses the
+// SINGLE_NODE_SINGLE_WRITER (ReadWriteOncePod) access mode.
+const singleWriterFile = "single-writer.json"
+
+// ErrPublishedForOtherPod is returned when a ReadWriteOncePod volume is
+// published for a Pod, while it is still published for another Pod.
+var ErrPublishedForOtherPod = errors.New("volume is published for another pod")
+
+// singleWriter is the content of the singleWriterFile.
+type singleWriter struct {
+	PodUID     string `json:"podUID"`
+	TargetPath string `json:"targetPath"`
+}
+
+// IsSingleWriter returns true when the access mode of the capability only
+// allows a single Pod to use the volume.
+func IsSingleWriter(vc *csi.VolumeCapability) bool {
+	return vc.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER
+}
+
+// ClaimSingleWriter records the Pod of the volume context as the only Pod
+// that the volume is published for, in the staging directory dir. It returns
+// ErrPublishedForOtherPod when the volume was claimed by another Pod whose
+// target path is still mounted. Pods that are gone, with their target path
+// unmounted, do not need to release their claim. Without the Pod information
+// (podInfoOnMount) the volume can not be claimed, nil is returned then.
+func ClaimSingleWriter(
+	ctx context.Context,
+	mounter mount.Interface,
+	dir string,
+	volumeContext map[string]string,
+	targetPath string,
+) error {
+	podUID := volumeContext[PodUIDKey]
+	if podUID == "" {
+		log.DebugLog(ctx, "pod information missing, not claiming the single writer of %s", targetPath)
+
+		return nil
+	}
+
+	file := filepath.Join(dir, singleWriterFile)
+	data, err := os.ReadFile(file) // #nosec:G304, file inclusion via variable.
+	switch {
+	case err == nil:
+		var owner singleWriter
+		if err = json.Unmarshal(data, &owner); err != nil {
+			log.WarningLog(ctx, "ignoring invalid single writer file %s: %v", file, err)
+
+			break
+		}
+		if owner.PodUID == podUID || owner.TargetPath == targetPath {
+			break
+		}
+
+		mounted, mErr := IsMountPoint(mounter, owner.TargetPath)
+		if mErr != nil && !os.IsNotExist(mErr) {
+			return fmt.Errorf("failed to check the target path %s of pod %s: %w", owner.TargetPath, owner.PodUID, mErr)
+		}
+		if mounted {
+			return fmt.Errorf("%w %s at %s", ErrPublishedForOtherPod, owner.PodUID, owner.TargetPath)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	data, err = json.Marshal(singleWriter{PodUID: podUID, TargetPath: targetPath})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the single writer of %s: %w", targetPath, err)
+	}
+	if err = os.WriteFile(file, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", file, err)
+	}
+
+	return nil
+}
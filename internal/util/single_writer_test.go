@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	mount "k8s.io/mount-utils"
+)
+
+func TestClaimSingleWriter(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	pod := func(uid string) map[string]string {
+		return map[string]string{PodUIDKey: uid}
+	}
+
+	tests := []struct {
+		name string
+		// claim is called for pod-a on target-a first, when set
+		claim      bool
+		mounted    bool
+		volumeCtx  map[string]string
+		targetPath string
+		wantErr    bool
+	}{
+		{
+			name:       "first claim",
+			volumeCtx:  pod("pod-a"),
+			targetPath: "target-a",
+		},
+		{
+			name:       "same pod again",
+			claim:      true,
+			mounted:    true,
+			volumeCtx:  pod("pod-a"),
+			targetPath: "target-a",
+		},
+		{
+			name:       "other pod while published",
+			claim:      true,
+			mounted:    true,
+			volumeCtx:  pod("pod-b"),
+			targetPath: "target-b",
+			wantErr:    true,
+		},
+		{
+			name:       "other pod after unpublish",
+			claim:      true,
+			volumeCtx:  pod("pod-b"),
+			targetPath: "target-b",
+		},
+		{
+			name:       "without pod information",
+			claim:      true,
+			mounted:    true,
+			volumeCtx:  map[string]string{},
+			targetPath: "target-b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			targetA := filepath.Join(dir, "target-a")
+			require.NoError(t, os.Mkdir(targetA, 0o750))
+			mounter := mount.NewFakeMounter(nil)
+			if tt.mounted {
+				mounter.MountPoints = []mount.MountPoint{{Device: "/dev/rbd0", Path: targetA}}
+			}
+
+			if tt.claim {
+				require.NoError(t, ClaimSingleWriter(ctx, mounter, dir, pod("pod-a"), targetA))
+			}
+
+			err := ClaimSingleWriter(ctx, mounter, dir, tt.volumeCtx, filepath.Join(dir, tt.targetPath))
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrPublishedForOtherPod)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
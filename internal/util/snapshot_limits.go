@@ -0,0 +1,131 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+const (
+	// maxSnapshotsParam is the VolumeSnapshotClass parameter that overrides
+	// the maximum number of snapshots of a volume of the CSI config.
+	maxSnapshotsParam = "maxSnapshots"
+	// minSnapshotIntervalParam is the VolumeSnapshotClass parameter that
+	// overrides the minimum interval between snapshots of the CSI config.
+	minSnapshotIntervalParam = "minSnapshotInterval"
+
+	// LastSnapshotAttribute is the attribute in the journal of a volume that
+	// contains the time of the last snapshot of the volume.
+	LastSnapshotAttribute = "lastsnapshot"
+)
+
+// SnapshotLimits contains the limits for the snapshots of a volume. There is
+// no limit when a value is 0.
+type SnapshotLimits struct {
+	// MaxSnapshots is the maximum number of snapshots of a volume.
+	MaxSnapshots int
+	// MinInterval is the minimum duration between two snapshots of a volume.
+	MinInterval time.Duration
+}
+
+// parseSnapshotLimits returns the snapshot limits of the CSI config, with the
+// values of the parameters of the VolumeSnapshotClass taking precedence.
+func parseSnapshotLimits(limits kubernetes.SnapshotLimits, parameters map[string]string) (SnapshotLimits, error) {
+	var err error
+	parsed := SnapshotLimits{MaxSnapshots: limits.MaxSnapshots}
+
+	if value, ok := parameters[maxSnapshotsParam]; ok {
+		parsed.MaxSnapshots, err = strconv.Atoi(value)
+		if err != nil {
+			return SnapshotLimits{}, fmt.Errorf("failed to parse %s %q: %w", maxSnapshotsParam, value, err)
+		}
+	}
+	if parsed.MaxSnapshots < 0 {
+		return SnapshotLimits{}, fmt.Errorf("maximum number of snapshots %d is negative", parsed.MaxSnapshots)
+	}
+
+	interval := limits.MinInterval
+	if value, ok := parameters[minSnapshotIntervalParam]; ok {
+		interval = value
+	}
+	if interval != "" {
+		parsed.MinInterval, err = time.ParseDuration(interval)
+		if err != nil {
+			return SnapshotLimits{}, fmt.Errorf("failed to parse minimum snapshot interval %q: %w", interval, err)
+		}
+	}
+	if parsed.MinInterval < 0 {
+		return SnapshotLimits{}, fmt.Errorf("minimum snapshot interval %s is negative", parsed.MinInterval)
+	}
+
+	return parsed, nil
+}
+
+// GetSnapshotLimits returns the limits for the snapshots of the volumes of
+// the given clusterID. The `maxSnapshots` and `minSnapshotInterval`
+// parameters of the VolumeSnapshotClass override the CSI config.
+func GetSnapshotLimits(pathToConfig, clusterID string, parameters map[string]string) (SnapshotLimits, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return SnapshotLimits{}, err
+	}
+
+	return parseSnapshotLimits(cluster.SnapshotLimits, parameters)
+}
+
+// Enabled returns true when any of the limits is set.
+func (sl SnapshotLimits) Enabled() bool {
+	return sl.MaxSnapshots > 0 || sl.MinInterval > 0
+}
+
+// Check returns ErrSnapshotLimitExceeded when a new snapshot would exceed
+// the limits, given the number of existing snapshots of the volume and the
+// time of its last snapshot. lastSnapshot is empty when the time of the last
+// snapshot is not known.
+func (sl SnapshotLimits) Check(snapshots int, lastSnapshot string, now time.Time) error {
+	if sl.MaxSnapshots > 0 && snapshots >= sl.MaxSnapshots {
+		return fmt.Errorf("%w: volume has %d of %d snapshots",
+			ErrSnapshotLimitExceeded, snapshots, sl.MaxSnapshots)
+	}
+
+	if sl.MinInterval == 0 || lastSnapshot == "" {
+		return nil
+	}
+
+	last, err := time.Parse(time.RFC3339, lastSnapshot)
+	if err != nil {
+		return fmt.Errorf("failed to parse time of last snapshot %q: %w", lastSnapshot, err)
+	}
+
+	if next := last.Add(sl.MinInterval); now.Before(next) {
+		return fmt.Errorf("%w: volume has %d snapshots, the last snapshot was created at %s,"+
+			" the next snapshot can be created at %s",
+			ErrSnapshotLimitExceeded, snapshots, last.Format(time.RFC3339), next.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// FormatSnapshotTime returns the time of a snapshot in the format that is
+// stored in the LastSnapshotAttribute of a volume.
+func FormatSnapshotTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ceph/ceph-csi/api/deploy/kubernetes"
+)
+
+func TestParseSnapshotLimits(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		limits     kubernetes.SnapshotLimits
+		parameters map[string]string
+		want       SnapshotLimits
+		wantErr    bool
+	}{
+		{
+			name: "no limits",
+			want: SnapshotLimits{},
+		},
+		{
+			name:   "limits of the config",
+			limits: kubernetes.SnapshotLimits{MaxSnapshots: 10, MinInterval: "1h"},
+			want:   SnapshotLimits{MaxSnapshots: 10, MinInterval: time.Hour},
+		},
+		{
+			name:       "parameters override the config",
+			limits:     kubernetes.SnapshotLimits{MaxSnapshots: 10, MinInterval: "1h"},
+			parameters: map[string]string{"maxSnapshots": "5", "minSnapshotInterval": "0s"},
+			want:       SnapshotLimits{MaxSnapshots: 5},
+		},
+		{
+			name:       "invalid maxSnapshots parameter",
+			parameters: map[string]string{"maxSnapshots": "many"},
+			wantErr:    true,
+		},
+		{
+			name:    "negative maxSnapshots",
+			limits:  kubernetes.SnapshotLimits{MaxSnapshots: -1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid minInterval",
+			limits:  kubernetes.SnapshotLimits{MinInterval: "daily"},
+			wantErr: true,
+		},
+		{
+			name:       "negative minSnapshotInterval parameter",
+			parameters: map[string]string{"minSnapshotInterval": "-1h"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseSnapshotLimits(tt.limits, tt.parameters)
+			if tt.wantErr {
+				require.Error(t, err)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSnapshotLimitsCheck(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	limits := SnapshotLimits{MaxSnapshots: 3, MinInterval: time.Hour}
+
+	tests := []struct {
+		name         string
+		limits       SnapshotLimits
+		snapshots    int
+		lastSnapshot string
+		wantErr      error
+	}{
+		{
+			name:      "no limits",
+			snapshots: 100,
+		},
+		{
+			name:      "below maximum without last snapshot",
+			limits:    limits,
+			snapshots: 2,
+		},
+		{
+			name:      "maximum reached",
+			limits:    limits,
+			snapshots: 3,
+			wantErr:   ErrSnapshotLimitExceeded,
+		},
+		{
+			name:         "last snapshot within interval",
+			limits:       limits,
+			snapshots:    1,
+			lastSnapshot: FormatSnapshotTime(now.Add(-30 * time.Minute)),
+			wantErr:      ErrSnapshotLimitExceeded,
+		},
+		{
+			name:         "last snapshot before interval",
+			limits:       limits,
+			snapshots:    1,
+			lastSnapshot: FormatSnapshotTime(now.Add(-time.Hour)),
+		},
+		{
+			name:         "last snapshot without interval",
+			limits:       SnapshotLimits{MaxSnapshots: 3},
+			snapshots:    1,
+			lastSnapshot: FormatSnapshotTime(now),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.limits.Check(tt.snapshots, tt.lastSnapshot, now)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+
+	err := limits.Check(0, "yesterday", now)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrSnapshotLimitExceeded)
+}
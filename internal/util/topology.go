@@ -155,6 +155,34 @@ func GetTopologyFromRequest(
 	return &topologyPools, accessibilityRequirements, nil
 }
 
+// GetPoolFromTopology returns the pool and data pool of the topology
+// constrained pools in the parameters that match the topology. Empty names
+// are returned when there are no topology constrained pools, or no topology.
+func GetPoolFromTopology(params map[string]string, topology *csi.Topology) (string, string, error) {
+	var topologyPools []TopologyConstrainedPool
+
+	topologyPoolsStr := params[topologyPoolsParam]
+	if topologyPoolsStr == "" || topology == nil {
+		return "", "", nil
+	}
+
+	err := json.Unmarshal([]byte(strings.ReplaceAll(topologyPoolsStr, "\n", " ")), &topologyPools)
+	if err != nil {
+		return "", "", fmt.Errorf(
+			"failed to parse JSON encoded topology constrained pools parameter (%s): %w",
+			topologyPoolsStr,
+			err)
+	}
+
+	topologyPool := matchPoolToTopology(&topologyPools, topology)
+	if topologyPool.PoolName == "" {
+		return "", "", fmt.Errorf("none of the topology constrained pools (%+v) matched topology (%+v)",
+			topologyPools, topology)
+	}
+
+	return topologyPool.PoolName, topologyPool.DataPoolName, nil
+}
+
 // MatchPoolAndTopology returns the topology map, if the passed in pool matches any
 // passed in accessibility constraints.
 func MatchPoolAndTopology(topologyPools *[]TopologyConstrainedPool,
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing exports traces of the operations with OpenTelemetry.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// tracerName is the name of the instrumentation of the spans.
+const tracerName = "github.com/ceph/ceph-csi"
+
+// provider exports the traces, it is set by Setup.
+var provider *sdktrace.TracerProvider
+
+// Setup exports the traces to the OTLP endpoint (like
+// "http://otel-collector:4317"). The traces of a service are not exported
+// when Setup is not called.
+func Setup(ctx context.Context, endpoint, serviceName, version string) error {
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP trace exporter for %q: %w", endpoint, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return nil
+}
+
+// Shutdown exports the spans that are still queued and stops the exporter.
+// It needs to be called before the process exits, the spans of the last
+// operations are lost otherwise.
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	err := provider.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to shut down the trace exporter: %w", err)
+	}
+
+	return nil
+}
+
+// ServerOptions returns the options for a gRPC server to create a span for
+// each call. The span continues the trace of the caller, if it was passed.
+func ServerOptions() []grpc.ServerOption {
+	if provider == nil {
+		return nil
+	}
+
+	return []grpc.ServerOption{grpc.StatsHandler(otelgrpc.NewServerHandler())}
+}
+
+// StartSpan starts a span with the name and attributes as a child of the span
+// in the context. The span needs to be ended with EndSpan.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records the error (if any) in the span and ends it. It is meant to
+// be deferred with the named error result of a function.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanRecorder keeps the spans that ended.
+type spanRecorder struct {
+	sdktrace.SpanProcessor
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (sr *spanRecorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	sr.spans = append(sr.spans, s)
+}
+
+func (sr *spanRecorder) Shutdown(context.Context) error {
+	return nil
+}
+
+//nolint:paralleltest // the global tracer provider is replaced
+func TestSpans(t *testing.T) {
+	sr := &spanRecorder{SpanProcessor: sdktrace.NewSimpleSpanProcessor(nil)}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+
+	require.Empty(t, ServerOptions())
+
+	ctx, parent := StartSpan(context.TODO(), "parent", attribute.String("image", "pool/image"))
+	_, child := StartSpan(ctx, "child")
+	EndSpan(child, errors.New("failed"))
+	EndSpan(parent, nil)
+
+	require.Len(t, sr.spans, 2)
+	require.Equal(t, "child", sr.spans[0].Name())
+	require.Equal(t, codes.Error, sr.spans[0].Status().Code)
+	require.Equal(t, "failed", sr.spans[0].Status().Description)
+	require.Equal(t, parent.SpanContext().SpanID(), sr.spans[0].Parent().SpanID())
+
+	require.Equal(t, "parent", sr.spans[1].Name())
+	require.Equal(t, codes.Unset, sr.spans[1].Status().Code)
+	require.Equal(t, []attribute.KeyValue{attribute.String("image", "pool/image")}, sr.spans[1].Attributes())
+}
+
+//nolint:paralleltest // the global tracer provider is replaced
+func TestShutdown(t *testing.T) {
+	// nothing to flush when the traces are not exported
+	require.NoError(t, Shutdown(context.TODO()))
+
+	sr := &spanRecorder{SpanProcessor: sdktrace.NewSimpleSpanProcessor(nil)}
+	provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	t.Cleanup(func() { provider = nil })
+	otel.SetTracerProvider(provider)
+
+	require.NotEmpty(t, ServerOptions())
+	require.NoError(t, Shutdown(context.TODO()))
+
+	// spans are not recorded after the shutdown
+	_, span := StartSpan(context.TODO(), "after shutdown")
+	EndSpan(span, nil)
+	require.Empty(t, sr.spans)
+}
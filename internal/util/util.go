@@ -134,8 +134,47 @@ type Config struct {
 	// Log interval for slow GRPC calls. Calls that outlive their context deadline
 	// are considered slow.
 	LogSlowOpInterval time.Duration
+	// DrainTimeout is the time to wait for in-flight requests to finish,
+	// when the driver is stopped
+	DrainTimeout time.Duration
+	// LockBreakDeadline is the time after which a lock of an operation can
+	// be released through the metrics server, disabled when 0
+	LockBreakDeadline time.Duration
+	// LockBreakTokenFile contains the bearer token that is required to
+	// release a lock through the metrics server
+	LockBreakTokenFile string
+	// MaxNodeRPCs and MaxControllerRPCs limit the concurrent RPCs of the
+	// node and controller services, unlimited when 0
+	MaxNodeRPCs       int
+	MaxControllerRPCs int
+	// MaxVolumesPerNode is the number of volumes that can be published on
+	// a node, unlimited when 0 and computed from the node when negative
+	MaxVolumesPerNode int64
+	// MapRate is the number of RBD images that can be mapped per second on
+	// a node, unlimited when 0
+	MapRate float64
+	// RPCTimeouts contains the timeouts for RPCs, by method name
+	RPCTimeouts map[string]time.Duration
+	// LogFormat is the format of the log messages, text or json
+	LogFormat string
+	// TracingEndpoint is the URL of the OTLP endpoint to export traces to
+	TracingEndpoint string
+	// GCInterval is the interval of the search for orphaned volumes by the
+	// controller, disabled when 0
+	GCInterval time.Duration
+	// GCGracePeriod is the time a volume needs to be orphaned before it is
+	// reported or deleted
+	GCGracePeriod time.Duration
+	// GCDelete is set to delete the orphaned volumes instead of only
+	// reporting them
+	GCDelete bool
+	// CloneTTL is the time after which a CephFS clone that is not checked
+	// by CreateVolume requests anymore is deleted by the controller,
+	// disabled when 0
+	CloneTTL time.Duration
 
 	EnableProfiling    bool // flag to enable profiling
+	EnableMetrics      bool // flag to serve the metrics of the operations
 	IsControllerServer bool // if set to true start provisioner server
 	IsNodeServer       bool // if set to true start node server
 	Version            bool // cephcsi version
@@ -144,11 +183,41 @@ type Config struct {
 	// rbd image or the image chain has the deep-flatten feature.
 	SkipForceFlatten bool
 
+	// ForceLockBreak is set to true to break the exclusive lock of an rbd
+	// image on NodeStage when the lock owner has no watch on the image
+	// anymore (the client is gone).
+	ForceLockBreak bool
+
+	// VolumeEvents is set to post Kubernetes Events on the PVs and PVCs of
+	// volumes for actions like mapping and flattening of images.
+	VolumeEvents bool
+
 	// cephfs related flags
 	ForceKernelCephFS    bool   // force to use the ceph kernel client even if the kernel is < 4.17
 	RadosNamespaceCephFS string // RadosNamespace used to store CSI specific objects and keys
 	SetMetadata          bool   // set metadata on the volume
 
+	// KernelMountRecovery is set to true to remount CephFS kernel mounts
+	// that went stale after the client was evicted and blocklisted.
+	KernelMountRecovery bool
+
+	// VolumeMountGroup is set to advertise the VOLUME_MOUNT_GROUP node
+	// capability, the CephFS node plugin applies the fsGroup of Pods.
+	VolumeMountGroup bool
+
+	// AsyncDelete is set to remove CephFS subvolumes in the background,
+	// DeleteVolume returns once the deletion is recorded in the journal.
+	AsyncDelete bool
+
+	// SnapshotMetadata is set to serve the CSI SnapshotMetadata service,
+	// which returns the allocated and changed blocks of snapshots.
+	SnapshotMetadata bool
+
+	// ReservationLock is set to serialize the reservations of request names
+	// in the journal with RADOS locks, for provisioners that run without
+	// leader election.
+	ReservationLock bool
+
 	// Read affinity related options
 	EnableReadAffinity  bool   // enable OSD read affinity.
 	CrushLocationLabels string // list of CRUSH location labels to read from the node.
@@ -387,6 +456,7 @@ func GetVolumeContext(parameters map[string]string) map[string]string {
 	// parameters that are not required in the volume context
 	notRequiredParams := []string{
 		topologyPoolsParam,
+		ClusterIDsKey,
 	}
 	for k, v := range parameters {
 		if !slices.Contains(notRequiredParams, k) {
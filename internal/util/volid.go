@@ -17,15 +17,7 @@ limitations under the License.
 package util
 
 import (
-	"encoding/binary"
-	"encoding/hex"
-	"errors"
-	"strings"
-)
-
-const (
-	// defaultEncodingVersion is only one version for the encoding at the moment.
-	defaultEncodingVersion = uint16(1)
+	"github.com/ceph/ceph-csi/internal/util/volumeid"
 )
 
 /*
@@ -33,7 +25,7 @@ CSIIdentifier contains the elements that form a CSI ID to be returned by the CSI
 contains enough information to decompose and extract required cluster and pool information to locate
 the volume that relates to the CSI ID.
 
-The CSI identifier is composed as elaborated in the comment against ComposeCSIID and thus,
+The CSI identifier is composed as elaborated in the comment against volumeid.Handle.Encode and thus,
 DecomposeCSIID is the inverse of the same function.
 
 The CSIIdentifier structure carries the following fields,
@@ -54,115 +46,29 @@ type CSIIdentifier struct {
 	ObjectUUID      string
 }
 
-// This maximum comes from the CSI spec on max bytes allowed in the various CSI ID fields.
-const maxVolIDLen = 128
-
-const (
-	knownFieldSize = 64
-	uuidSize       = 36
-)
-
-/*
-ComposeCSIID composes a CSI ID from passed in parameters.
-Version 1 of the encoding scheme is as follows,
-
-	[csi_id_version=1:4byte] + [-:1byte]
-	[length of clusterID=1:4byte] + [-:1byte]
-	[clusterID:36bytes (MAX)] + [-:1byte]
-	[poolID:16bytes] + [-:1byte]
-	[ObjectUUID:36bytes]
-
-	Total of constant field lengths, including '-' field separators would hence be,
-	4+1+4+1+1+16+1+36 = 64
-*/
+// ComposeCSIID composes a CSI ID from passed in parameters.
 func (ci CSIIdentifier) ComposeCSIID() (string, error) {
-	buf16 := make([]byte, 2)
-	buf64 := make([]byte, 8)
-
-	if (knownFieldSize + len(ci.ClusterID)) > maxVolIDLen {
-		return "", errors.New("CSI ID encoding length overflow")
-	}
-
-	if len(ci.ObjectUUID) != uuidSize {
-		return "", errors.New("CSI ID invalid object uuid")
-	}
-
-	// set the encoding version, as it is not set by default anywhere else
-	encodingVersion := ci.encodingVersion
-	if encodingVersion == 0 {
-		encodingVersion = defaultEncodingVersion
-	}
-
-	binary.BigEndian.PutUint16(buf16, encodingVersion)
-	versionEncodedHex := hex.EncodeToString(buf16)
-
-	binary.BigEndian.PutUint16(buf16, uint16(len(ci.ClusterID)))
-	clusterIDLength := hex.EncodeToString(buf16)
-
-	binary.BigEndian.PutUint64(buf64, uint64(ci.LocationID))
-	poolIDEncodedHex := hex.EncodeToString(buf64)
-
-	return strings.Join([]string{
-		versionEncodedHex, clusterIDLength, ci.ClusterID,
-		poolIDEncodedHex, ci.ObjectUUID,
-	}, "-"), nil
+	return volumeid.Handle{
+		Version:    ci.encodingVersion,
+		ClusterID:  ci.ClusterID,
+		LocationID: ci.LocationID,
+		ObjectUUID: ci.ObjectUUID,
+	}.Encode()
 }
 
 /*
 DecomposeCSIID composes a CSIIdentifier from passed in string.
 */
 func (ci *CSIIdentifier) DecomposeCSIID(composedCSIID string) error {
-	bytesToProcess := uint16(len(composedCSIID))
-
-	// if length is less that expected constant elements, then bail out!
-	if bytesToProcess < knownFieldSize {
-		return errors.New("failed to decode CSI identifier, string underflow")
-	}
-
-	buf16, err := hex.DecodeString(composedCSIID[0:4])
-	if err != nil {
-		return err
-	}
-	ci.encodingVersion = binary.BigEndian.Uint16(buf16)
-	// 4 for version encoding and 1 for '-' separator
-	bytesToProcess -= 5
-
-	buf16, err = hex.DecodeString(composedCSIID[5:9])
+	h, err := volumeid.Decode(composedCSIID)
 	if err != nil {
 		return err
 	}
-	clusterIDLength := binary.BigEndian.Uint16(buf16)
-	// 4 for length encoding and 1 for '-' separator
-	bytesToProcess -= 5
 
-	if bytesToProcess < (clusterIDLength + 1) {
-		return errors.New("failed to decode CSI identifier, string underflow")
-	}
-	ci.ClusterID = composedCSIID[10 : 10+clusterIDLength]
-	// additional 1 for '-' separator
-	bytesToProcess -= (clusterIDLength + 1)
-	nextFieldStartIdx := (10 + clusterIDLength + 1)
-
-	// minLenToDecode is now 17 as composedCSIID should include
-	// at least 16 for poolID encoding and 1 for '-' separator.
-	const minLenToDecode = 17
-	if bytesToProcess < minLenToDecode {
-		return errors.New("failed to decode CSI identifier, string underflow")
-	}
-	buf64, err := hex.DecodeString(composedCSIID[nextFieldStartIdx : nextFieldStartIdx+16])
-	if err != nil {
-		return err
-	}
-	ci.LocationID = int64(binary.BigEndian.Uint64(buf64))
-	// 16 for poolID encoding and 1 for '-' separator
-	bytesToProcess -= 17
-	nextFieldStartIdx += 17
-
-	// has to be an exact match
-	if bytesToProcess != uuidSize {
-		return errors.New("failed to decode CSI identifier, string size mismatch")
-	}
-	ci.ObjectUUID = composedCSIID[nextFieldStartIdx : nextFieldStartIdx+uuidSize]
+	ci.encodingVersion = h.Version
+	ci.ClusterID = h.ClusterID
+	ci.LocationID = h.LocationID
+	ci.ObjectUUID = h.ObjectUUID
 
-	return err
+	return nil
 }
@@ -0,0 +1,161 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package volumeid encodes and decodes the volume and snapshot handles that
+// Ceph-CSI returns to the container orchestrator. The handles contain the
+// clusterID, the ID of the pool (RBD) or filesystem (CephFS) and the UUID of
+// the object in the journal, the name of the image or subvolume is stored in
+// the journal under that UUID.
+package volumeid
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// DefaultVersion is the only version of the encoding at the moment.
+	DefaultVersion = uint16(1)
+
+	// maxLen comes from the CSI spec on max bytes allowed in the various
+	// CSI ID fields.
+	maxLen = 128
+
+	knownFieldSize = 64
+	uuidSize       = 36
+)
+
+// ErrInvalid is returned when a handle can not be decoded or encoded.
+var ErrInvalid = errors.New("invalid volume handle")
+
+// Handle contains the fields of a volume or snapshot handle.
+type Handle struct {
+	// Version of the encoding, DefaultVersion when not set.
+	Version uint16
+	// ClusterID is the ID of the cluster in the CSI configuration.
+	ClusterID string
+	// LocationID is the ID of the pool for RBD, and the ID of the
+	// filesystem for CephFS.
+	LocationID int64
+	// ObjectUUID is the UUID of the volume or snapshot in the journal.
+	ObjectUUID string
+}
+
+/*
+Encode returns the handle as string. Version 1 of the encoding scheme is as
+follows,
+
+	[csi_id_version=1:4byte] + [-:1byte]
+	[length of clusterID=1:4byte] + [-:1byte]
+	[clusterID:36bytes (MAX)] + [-:1byte]
+	[poolID:16bytes] + [-:1byte]
+	[ObjectUUID:36bytes]
+
+	Total of constant field lengths, including '-' field separators would hence be,
+	4+1+4+1+1+16+1+36 = 64
+*/
+func (h Handle) Encode() (string, error) {
+	buf16 := make([]byte, 2)
+	buf64 := make([]byte, 8)
+
+	if (knownFieldSize + len(h.ClusterID)) > maxLen {
+		return "", fmt.Errorf("%w: encoding length overflow", ErrInvalid)
+	}
+
+	if len(h.ObjectUUID) != uuidSize {
+		return "", fmt.Errorf("%w: invalid object uuid", ErrInvalid)
+	}
+
+	version := h.Version
+	if version == 0 {
+		version = DefaultVersion
+	}
+
+	binary.BigEndian.PutUint16(buf16, version)
+	versionEncodedHex := hex.EncodeToString(buf16)
+
+	binary.BigEndian.PutUint16(buf16, uint16(len(h.ClusterID)))
+	clusterIDLength := hex.EncodeToString(buf16)
+
+	binary.BigEndian.PutUint64(buf64, uint64(h.LocationID))
+	poolIDEncodedHex := hex.EncodeToString(buf64)
+
+	return strings.Join([]string{
+		versionEncodedHex, clusterIDLength, h.ClusterID,
+		poolIDEncodedHex, h.ObjectUUID,
+	}, "-"), nil
+}
+
+// Decode returns the fields of the handle, it is the inverse of Encode.
+func Decode(handle string) (Handle, error) {
+	var h Handle
+	bytesToProcess := uint16(len(handle))
+
+	// if length is less that expected constant elements, then bail out!
+	if bytesToProcess < knownFieldSize {
+		return h, fmt.Errorf("%w: string underflow", ErrInvalid)
+	}
+
+	buf16, err := hex.DecodeString(handle[0:4])
+	if err != nil {
+		return h, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	h.Version = binary.BigEndian.Uint16(buf16)
+	// 4 for version encoding and 1 for '-' separator
+	bytesToProcess -= 5
+
+	buf16, err = hex.DecodeString(handle[5:9])
+	if err != nil {
+		return h, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	clusterIDLength := binary.BigEndian.Uint16(buf16)
+	// 4 for length encoding and 1 for '-' separator
+	bytesToProcess -= 5
+
+	if bytesToProcess < (clusterIDLength + 1) {
+		return h, fmt.Errorf("%w: string underflow", ErrInvalid)
+	}
+	h.ClusterID = handle[10 : 10+clusterIDLength]
+	// additional 1 for '-' separator
+	bytesToProcess -= (clusterIDLength + 1)
+	nextFieldStartIdx := (10 + clusterIDLength + 1)
+
+	// minLenToDecode is now 17 as the handle should include at least 16
+	// for poolID encoding and 1 for '-' separator.
+	const minLenToDecode = 17
+	if bytesToProcess < minLenToDecode {
+		return h, fmt.Errorf("%w: string underflow", ErrInvalid)
+	}
+	buf64, err := hex.DecodeString(handle[nextFieldStartIdx : nextFieldStartIdx+16])
+	if err != nil {
+		return h, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	h.LocationID = int64(binary.BigEndian.Uint64(buf64))
+	// 16 for poolID encoding and 1 for '-' separator
+	bytesToProcess -= 17
+	nextFieldStartIdx += 17
+
+	// has to be an exact match
+	if bytesToProcess != uuidSize {
+		return h, fmt.Errorf("%w: string size mismatch", ErrInvalid)
+	}
+	h.ObjectUUID = handle[nextFieldStartIdx : nextFieldStartIdx+uuidSize]
+
+	return h, nil
+}
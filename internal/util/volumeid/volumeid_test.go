@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumeid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		handle  Handle
+		encoded string
+		wantErr bool
+	}{
+		{
+			name: "rbd volume",
+			handle: Handle{
+				Version:    DefaultVersion,
+				ClusterID:  "01616094-9d93-4178-bf45-c7eac19e8b15",
+				LocationID: 7,
+				ObjectUUID: "00000000-1111-2222-bbbb-cacacacacaca",
+			},
+			encoded: "0001-0024-01616094-9d93-4178-bf45-c7eac19e8b15-0000000000000007-00000000-1111-2222-bbbb-cacacacacaca",
+		},
+		{
+			name: "short clusterID",
+			handle: Handle{
+				Version:    DefaultVersion,
+				ClusterID:  "rook-ceph",
+				LocationID: 0xffff,
+				ObjectUUID: "00000000-1111-2222-bbbb-cacacacacaca",
+			},
+			encoded: "0001-0009-rook-ceph-000000000000ffff-00000000-1111-2222-bbbb-cacacacacaca",
+		},
+		{
+			name: "invalid uuid",
+			handle: Handle{
+				ClusterID:  "rook-ceph",
+				ObjectUUID: "not-a-uuid",
+			},
+			wantErr: true,
+		},
+		{
+			name: "clusterID too long",
+			handle: Handle{
+				ClusterID:  "a-clusterID-that-is-too-long-to-fit-into-the-128-bytes-of-a-volume-handle",
+				ObjectUUID: "00000000-1111-2222-bbbb-cacacacacaca",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			encoded, err := tt.handle.Encode()
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalid)
+
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.encoded, encoded)
+
+			decoded, err := Decode(encoded)
+			require.NoError(t, err)
+			require.Equal(t, tt.handle, decoded)
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		handle string
+	}{
+		{"empty", ""},
+		{"static volume", "pvc-1b2e2a5c-8e3a-4c4d-9b1e-1d2c3b4a5f6e"},
+		{"invalid version", "zzzz-0009-rook-ceph-000000000000ffff-00000000-1111-2222-bbbb-cacacacacaca"},
+		{"truncated uuid", "0001-0009-rook-ceph-000000000000ffff-00000000-1111-2222-bbbb-cacacacacac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Decode(tt.handle)
+			require.ErrorIs(t, err, ErrInvalid)
+		})
+	}
+}
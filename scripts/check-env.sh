@@ -26,6 +26,7 @@ package main
 /*
 #include <rados/librados.h>
 #include <rbd/librbd.h>
+#include <libcryptsetup.h>
 */
 import "C"
 
@@ -33,6 +34,7 @@ func main() {
 	_ = C.LIBRADOS_VERSION_CODE
 	_ = C.LIBRBD_VER_MAJOR
 	_ = C.RBD_MAX_IMAGE_NAME_SIZE
+	_ = C.CRYPT_ANY_SLOT
 }
 EOF
 
@@ -43,9 +45,9 @@ if [ -n "$(command -v go)" ]; then
 	# based systems.
 	if ! go run -mod=vendor "${LIBCHECK}" > /dev/null; then
 		if [ -n "${RPM_CMD}" ]; then
-			echo "Packages librbd-devel librados-devel need to be installed"
+			echo "Packages librbd-devel librados-devel cryptsetup-devel need to be installed"
 		elif [ -n "${DPKG_CMD}" ]; then
-			echo "Packages librbd-dev librados-dev need to be installed"
+			echo "Packages librbd-dev librados-dev libcryptsetup-dev need to be installed"
 		else
 			fail "error can't verify Ceph development headers"
 		fi